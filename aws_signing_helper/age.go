@@ -0,0 +1,87 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"io"
+	"os"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// Header of binary age files
+const ageHeader = "age-encryption.org/v1\n"
+
+// Type of the block that readPrivateKeyBlock returns for age-encrypted
+// files, whose contents are the whole file
+const ageBlockType = "AGE ENCRYPTED FILE"
+
+// Whether the data is an age-encrypted file, either binary or armored
+func isAgeEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(ageHeader)) ||
+		bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte(armor.Header))
+}
+
+// Decrypts an age-encrypted file with the first of the identities that
+// the file was encrypted to
+func decryptAge(data []byte, identities ...age.Identity) ([]byte, error) {
+	var src io.Reader = bytes.NewReader(data)
+	if !bytes.HasPrefix(data, []byte(ageHeader)) {
+		src = armor.NewReader(bytes.NewReader(bytes.TrimLeft(data, " \t\r\n")))
+	}
+	reader, err := age.Decrypt(src, identities...)
+	if err != nil {
+		var noMatch *age.NoIdentityMatchError
+		if errors.As(err, &noMatch) {
+			return nil, ErrIncorrectPassphrase
+		}
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
+
+// Decrypts an age-encrypted private key with a passphrase (the file must
+// have been encrypted with `age --passphrase`)
+func readAgePassphraseEncryptedKey(data []byte, passphrase string) (crypto.PrivateKey, error) {
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	decrypted, err := decryptAge(data, identity)
+	if err != nil {
+		return nil, err
+	}
+	return parsePrivateKey(decrypted)
+}
+
+// Load the age-encrypted private key referenced by `privateKeyId`,
+// decrypting it with the X25519 identities in the age identity file
+// referenced by `identityFile` (as created by age-keygen)
+func ReadAgeEncryptedPrivateKeyData(privateKeyId string, identityFile string) (crypto.PrivateKey, error) {
+	data, err := readCredentialFile(privateKeyId)
+	if err != nil {
+		return nil, err
+	}
+	if !isAgeEncrypted(data) {
+		return nil, errors.New("the private key isn't encrypted with age")
+	}
+	file, err := os.Open(identityFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	identities, err := age.ParseIdentities(file)
+	if err != nil {
+		return nil, err
+	}
+	decrypted, err := decryptAge(data, identities...)
+	if err != nil {
+		if errors.Is(err, ErrIncorrectPassphrase) {
+			return nil, errors.New("the private key isn't encrypted to any of the identities in " + identityFile)
+		}
+		return nil, err
+	}
+	return parsePrivateKey(decrypted)
+}
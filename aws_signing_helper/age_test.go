@@ -0,0 +1,98 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// Encrypts the file to the recipient, optionally armored, and returns the
+// path of the encrypted file
+func writeAgeEncryptedFile(t *testing.T, path string, recipient age.Recipient, armored bool) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	var dst io.WriteCloser = nopWriteCloser{&buf}
+	if armored {
+		dst = armor.NewWriter(&buf)
+	}
+	writer, err := age.Encrypt(dst, recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Write(data)
+	writer.Close()
+	dst.Close()
+
+	encryptedPath := filepath.Join(t.TempDir(), "key.age")
+	if err = os.WriteFile(encryptedPath, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return encryptedPath
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestAgeEncryptedPrivateKey(t *testing.T) {
+	expectedKey, _ := ReadPrivateKeyData("../tst/certs/ec-prime256v1-key.pem")
+
+	identity, _ := age.GenerateX25519Identity()
+	identityFile := filepath.Join(t.TempDir(), "identity.txt")
+	os.WriteFile(identityFile, []byte("# test identity\n"+identity.String()+"\n"), 0600)
+	for _, armored := range []bool{false, true} {
+		keyPath := writeAgeEncryptedFile(t, "../tst/certs/ec-prime256v1-key.pem", identity.Recipient(), armored)
+		if _, err := ReadPrivateKeyData(keyPath); err != ErrEncryptedPrivateKey {
+			t.Logf("Expected the age-encrypted key to be reported as encrypted, got %v", err)
+			t.Fail()
+		}
+		privateKey, err := ReadAgeEncryptedPrivateKeyData(keyPath, identityFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(privateKey, expectedKey) {
+			t.Log("Decrypted key doesn't match the original key")
+			t.Fail()
+		}
+	}
+
+	// A file encrypted to a different identity can't be decrypted
+	otherIdentity, _ := age.GenerateX25519Identity()
+	keyPath := writeAgeEncryptedFile(t, "../tst/certs/ec-prime256v1-key.pem", otherIdentity.Recipient(), false)
+	if _, err := ReadAgeEncryptedPrivateKeyData(keyPath, identityFile); err == nil {
+		t.Log("Expected a key encrypted to another identity to be rejected")
+		t.Fail()
+	}
+}
+
+func TestAgePassphraseEncryptedPrivateKey(t *testing.T) {
+	recipient, _ := age.NewScryptRecipient("test-passphrase")
+	recipient.SetWorkFactor(10)
+	keyPath := writeAgeEncryptedFile(t, "../tst/certs/rsa-2048-key.pem", recipient, true)
+
+	passphraseFile := filepath.Join(t.TempDir(), "passphrase")
+	os.WriteFile(passphraseFile, []byte("test-passphrase\n"), 0600)
+	signer, err := GetFileSystemSigner(keyPath, "../tst/certs/rsa-2048-sha256-cert.pem", "", passphraseFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := signer.Certificate()
+	if !publicKeysEqual(cert.PublicKey, signer.Public()) {
+		t.Log("Expected the decrypted key to match the certificate")
+		t.Fail()
+	}
+
+	if _, err = ReadEncryptedPrivateKeyData(keyPath, "wrong-passphrase"); err == nil {
+		t.Log("Expected the wrong passphrase to be rejected")
+		t.Fail()
+	}
+}
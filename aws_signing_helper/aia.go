@@ -0,0 +1,167 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Longest chain of intermediates that is fetched through the Authority
+// Information Access extension, to guard against loops
+const maxFetchedIntermediates = 5
+
+var aiaHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// Completes an ordered certificate chain (see orderCertificateChain) by
+// fetching the issuers that are missing from it over HTTP, from the URLs in
+// the certificates' Authority Information Access extension. Trust anchors
+// (self-signed certificates) aren't fetched, since IAM Roles Anywhere
+// already has them. Fetching is best-effort: failures are logged, and the
+// chain is returned with whatever could be found.
+func fetchMissingIntermediates(certificate *x509.Certificate, chain []*x509.Certificate) []*x509.Certificate {
+	// Find the end of the part of the chain that leads from the
+	// end-entity certificate
+	current, pathLength := certificate, 0
+	for _, cert := range chain {
+		if !bytes.Equal(current.RawIssuer, cert.RawSubject) || current.CheckSignatureFrom(cert) != nil {
+			break
+		}
+		current = cert
+		pathLength++
+	}
+
+	var fetched []*x509.Certificate
+	for len(fetched) < maxFetchedIntermediates && !bytes.Equal(current.RawIssuer, current.RawSubject) {
+		issuer, err := fetchIssuer(current)
+		if err != nil {
+			log.Println("unable to fetch the issuer of", current.Subject, "-", err)
+			break
+		}
+		if bytes.Equal(issuer.RawIssuer, issuer.RawSubject) {
+			break
+		}
+		fetched = append(fetched, issuer)
+		current = issuer
+	}
+
+	completed := append([]*x509.Certificate{}, chain[:pathLength]...)
+	completed = append(completed, fetched...)
+	return append(completed, chain[pathLength:]...)
+}
+
+// Fetches the certificate that issued the given one, from the first of its
+// CA Issuers URLs that provides it
+func fetchIssuer(cert *x509.Certificate) (*x509.Certificate, error) {
+	err := errors.New("the certificate has no CA Issuers URL")
+	for _, url := range cert.IssuingCertificateURL {
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			continue
+		}
+		var candidates []*x509.Certificate
+		if candidates, err = fetchAIACertificates(url); err != nil {
+			continue
+		}
+		for _, candidate := range candidates {
+			if bytes.Equal(cert.RawIssuer, candidate.RawSubject) && cert.CheckSignatureFrom(candidate) == nil {
+				return candidate, nil
+			}
+		}
+		err = errors.New("no certificate from " + url + " issued the certificate")
+	}
+	return nil, err
+}
+
+// Directory in which fetched certificates are cached, if there is one
+func aiaCacheDir() string {
+	userCacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(userCacheDir, "aws_signing_helper", "aia")
+}
+
+// Fetches the certificates (usually a single one, but possibly a PKCS#7
+// bundle) published at a CA Issuers URL. They're cached until one of them
+// expires.
+func fetchAIACertificates(url string) ([]*x509.Certificate, error) {
+	var cachePath string
+	if cacheDir := aiaCacheDir(); cacheDir != "" {
+		sum := sha256.Sum256([]byte(url))
+		cachePath = filepath.Join(cacheDir, hex.EncodeToString(sum[:])+".der")
+		if data, err := os.ReadFile(cachePath); err == nil {
+			certs, err := parseAIACertificates(data)
+			if err == nil && !anyExpired(certs) {
+				return certs, nil
+			}
+		}
+	}
+
+	resp, err := aiaHTTPClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("unexpected status fetching " + url + ": " + resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	certs, err := parseAIACertificates(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if cachePath != "" {
+		if err = os.MkdirAll(filepath.Dir(cachePath), 0700); err == nil {
+			err = os.WriteFile(cachePath, data, 0600)
+		}
+		if err != nil {
+			log.Println("unable to cache the certificate from", url, "-", err)
+		}
+	}
+	return certs, nil
+}
+
+// Parses the certificates served at a CA Issuers URL: a DER certificate, as
+// RFC 5280 specifies, or a PKCS#7 bundle, or PEM data, as some CAs serve
+func parseAIACertificates(data []byte) ([]*x509.Certificate, error) {
+	if isPEM(data) {
+		var certs []*x509.Certificate
+		for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			certs = append(certs, cert)
+		}
+		return certs, nil
+	}
+	if cert, err := x509.ParseCertificate(data); err == nil {
+		return []*x509.Certificate{cert}, nil
+	}
+	return parsePKCS7Certificates(data)
+}
+
+func anyExpired(certs []*x509.Certificate) bool {
+	for _, cert := range certs {
+		if time.Now().After(cert.NotAfter) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package aws_signing_helper
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Issues a CA certificate whose Authority Information Access extension
+// points at the given URL
+func createAIATestCertificate(t *testing.T, commonName string, issuingURL string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	if issuingURL != "" {
+		template.IssuingCertificateURL = []string{issuingURL}
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestFetchMissingIntermediates(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	published := map[string][]byte{}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		data, ok := published[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	root, rootKey := createAIATestCertificate(t, "Root", "", nil, nil)
+	intermediate, intermediateKey := createAIATestCertificate(t, "Intermediate", server.URL+"/root.cer", root, rootKey)
+	issuing, issuingKey := createAIATestCertificate(t, "Issuing", server.URL+"/intermediate.pem", intermediate, intermediateKey)
+	leaf, _ := createAIATestCertificate(t, "Leaf", server.URL+"/issuing.cer", issuing, issuingKey)
+	published["/root.cer"] = root.Raw
+	published["/intermediate.pem"] = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: intermediate.Raw})
+	published["/issuing.cer"] = issuing.Raw
+	unrelated, _ := createAIATestCertificate(t, "Unrelated", "", nil, nil)
+
+	fixtures := []struct {
+		chain    []*x509.Certificate
+		expected []string
+		requests int
+	}{
+		// The root isn't added to the chain
+		{nil, []string{"Issuing", "Intermediate"}, 3},
+		// Fetched certificates are cached
+		{nil, []string{"Issuing", "Intermediate"}, 0},
+		{[]*x509.Certificate{issuing, unrelated}, []string{"Issuing", "Intermediate", "Unrelated"}, 0},
+		{[]*x509.Certificate{issuing, intermediate}, []string{"Issuing", "Intermediate"}, 0},
+	}
+	for _, fixture := range fixtures {
+		requests = 0
+		var names []string
+		for _, cert := range fetchMissingIntermediates(leaf, fixture.chain) {
+			names = append(names, cert.Subject.CommonName)
+		}
+		if !reflect.DeepEqual(names, fixture.expected) {
+			t.Logf("Unexpected chain: %v (expected %v)", names, fixture.expected)
+			t.Fail()
+		}
+		if requests != fixture.requests {
+			t.Logf("Unexpected number of requests: %d (expected %d)", requests, fixture.requests)
+			t.Fail()
+		}
+	}
+
+	// Certificates that can't be fetched are left out
+	orphan, _ := createAIATestCertificate(t, "Orphan", server.URL+"/missing.cer", issuing, issuingKey)
+	chain := fetchMissingIntermediates(orphan, []*x509.Certificate{unrelated})
+	if len(chain) != 1 || chain[0] != unrelated {
+		t.Log("Expected the chain to be left as it was")
+		t.Fail()
+	}
+}
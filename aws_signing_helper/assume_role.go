@@ -0,0 +1,200 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// Longest session that STS issues for a role that's assumed with the
+// temporary credentials of another (role chaining)
+const maxChainedSessionDuration = 3600
+
+// Tag of the sessions of chained roles. Its value can refer to attributes
+// of the certificate (see expandCertificateTemplate).
+type SessionTag struct {
+	Key   string
+	Value string
+}
+
+// IAM Roles Anywhere doesn't accept session policies in CreateSession (only
+// in the profile), so they can only scope down the credentials of a chained
+// role
+var ErrSessionPolicyWithoutChainedRole = errors.New("session policies can only be applied to a chained role (pass --chained-role-arn), since IAM Roles Anywhere only applies the profile's")
+
+// Nor does it accept a source identity (it sets its own, from the
+// certificate), so one can only be set on the session of a chained role
+var ErrSourceIdentityWithoutChainedRole = errors.New("a source identity can only be set on a chained role (pass --chained-role-arn), since IAM Roles Anywhere sets its own")
+
+// Longest source identity that STS accepts
+const maxSourceIdentityLength = 64
+
+// Endpoint through which chained roles are assumed, if not the regional STS
+// endpoint (for tests)
+var stsEndpoint = ""
+
+// Assumes each of the chained roles in turn, starting with the temporary
+// credentials obtained from IAM Roles Anywhere, and returns the credentials
+// for the last one, scoped down by the session policies. Without chained
+// roles, the credentials are returned as they are.
+func assumeChainedRoles(ctx context.Context, opts *CredentialsOpts, signer Signer, credentialProcessOutput CredentialProcessOutput) (CredentialProcessOutput, error) {
+	if len(opts.ChainedRoleArns) == 0 {
+		if opts.SessionPolicy != "" || len(opts.PolicyArns) != 0 {
+			return CredentialProcessOutput{}, ErrSessionPolicyWithoutChainedRole
+		}
+		if opts.SourceIdentity != "" {
+			return CredentialProcessOutput{}, ErrSourceIdentityWithoutChainedRole
+		}
+		return credentialProcessOutput, nil
+	}
+	certificate, err := signer.Certificate()
+	if err != nil {
+		return CredentialProcessOutput{}, err
+	}
+	sessionName, _, err := roleSessionName(opts, certificate)
+	if err != nil {
+		return CredentialProcessOutput{}, err
+	}
+	tags, err := chainedSessionTags(opts, certificate)
+	if err != nil {
+		return CredentialProcessOutput{}, err
+	}
+	sourceIdentity, err := chainedSourceIdentity(opts, certificate)
+	if err != nil {
+		return CredentialProcessOutput{}, err
+	}
+	for i, roleArn := range opts.ChainedRoleArns {
+		// The session policies only apply to the last role, since they'd
+		// otherwise have to allow assuming the next one
+		last := i == len(opts.ChainedRoleArns)-1
+		credentialProcessOutput, err = assumeRole(ctx, opts, credentialProcessOutput, roleArn, sessionName, sourceIdentity, tags, last)
+		if err != nil {
+			return CredentialProcessOutput{}, fmt.Errorf("unable to assume the chained role %s: %w", roleArn, err)
+		}
+	}
+	return credentialProcessOutput, nil
+}
+
+// Returns the tags of the sessions of chained roles, with the references
+// to attributes of the certificate in their values replaced
+func chainedSessionTags(opts *CredentialsOpts, certificate *x509.Certificate) ([]ststypes.Tag, error) {
+	var tags []ststypes.Tag
+	for _, tag := range opts.SessionTags {
+		value, err := expandCertificateTemplate(tag.Value, certificate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of the session tag %s: %w", tag.Key, err)
+		}
+		tags = append(tags, ststypes.Tag{Key: aws.String(tag.Key), Value: aws.String(value)})
+	}
+	return tags, nil
+}
+
+// Returns the source identity of the sessions of chained roles, with the
+// references to attributes of the certificate in it replaced, or nothing,
+// if there's none (in which case they keep the source identity of the
+// session that assumes them, if any)
+func chainedSourceIdentity(opts *CredentialsOpts, certificate *x509.Certificate) (string, error) {
+	if opts.SourceIdentity == "" {
+		return "", nil
+	}
+	sourceIdentity, err := expandCertificateTemplate(opts.SourceIdentity, certificate)
+	if err != nil {
+		return "", fmt.Errorf("invalid source identity: %w", err)
+	}
+	if len(sourceIdentity) < 2 || len(sourceIdentity) > maxSourceIdentityLength || invalidRoleSessionNameCharacters.MatchString(sourceIdentity) {
+		return "", fmt.Errorf("invalid source identity %s (expected 2 to %d letters, digits, and characters among +=,.@_-)", sourceIdentity, maxSourceIdentityLength)
+	}
+	return sourceIdentity, nil
+}
+
+// Returns a provider of the given credentials, for the clients of other
+// services
+func staticCredentials(credentialProcessOutput CredentialProcessOutput) aws.CredentialsProviderFunc {
+	return func(context.Context) (aws.Credentials, error) {
+		return aws.Credentials{
+			AccessKeyID:     credentialProcessOutput.AccessKeyId,
+			SecretAccessKey: credentialProcessOutput.SecretAccessKey,
+			SessionToken:    credentialProcessOutput.SessionToken,
+			Source:          CredentialsSource,
+		}, nil
+	}
+}
+
+// Assumes the given role with the given credentials, session name, source
+// identity (if any), and session tags (and, if asked to, the session
+// policies in the options), through the regional STS endpoint, for the
+// session duration in the options (or as long as STS allows for a chained
+// role, if that's shorter)
+func assumeRole(ctx context.Context, opts *CredentialsOpts, credentialProcessOutput CredentialProcessOutput, roleArn string, sessionName string, sourceIdentity string, tags []ststypes.Tag, withSessionPolicies bool) (CredentialProcessOutput, error) {
+	retryer, err := newRetryer()
+	if err != nil {
+		return CredentialProcessOutput{}, err
+	}
+	httpClient, err := createHTTPClient(opts)
+	if err != nil {
+		return CredentialProcessOutput{}, err
+	}
+	userAgent, err := addToUserAgent(opts, "")
+	if err != nil {
+		return CredentialProcessOutput{}, err
+	}
+	stsClient := sts.New(sts.Options{
+		APIOptions:  []func(*middleware.Stack) error{userAgent},
+		Credentials: staticCredentials(credentialProcessOutput),
+		HTTPClient:  httpClient,
+		Region:      opts.Region,
+		Retryer:     retryer,
+	}, withEndpointVariants(opts), func(options *sts.Options) {
+		if stsEndpoint != "" {
+			options.BaseEndpoint = aws.String(stsEndpoint)
+		}
+	})
+	durationSeconds := int32(opts.SessionDuration)
+	if durationSeconds > maxChainedSessionDuration {
+		durationSeconds = maxChainedSessionDuration
+	}
+	input := &sts.AssumeRoleInput{
+		RoleArn:         aws.String(roleArn),
+		RoleSessionName: aws.String(sessionName),
+		DurationSeconds: aws.Int32(durationSeconds),
+		Tags:            tags,
+	}
+	if len(opts.TransitiveTagKeys) != 0 {
+		input.TransitiveTagKeys = opts.TransitiveTagKeys
+	}
+	if opts.ExternalId != "" {
+		input.ExternalId = aws.String(opts.ExternalId)
+	}
+	if sourceIdentity != "" {
+		input.SourceIdentity = aws.String(sourceIdentity)
+	}
+	if withSessionPolicies {
+		if opts.SessionPolicy != "" {
+			input.Policy = aws.String(opts.SessionPolicy)
+		}
+		for _, policyArn := range opts.PolicyArns {
+			input.PolicyArns = append(input.PolicyArns, ststypes.PolicyDescriptorType{Arn: aws.String(policyArn)})
+		}
+	}
+	output, err := stsClient.AssumeRole(ctx, input)
+	if err != nil {
+		return CredentialProcessOutput{}, err
+	}
+	if output.Credentials == nil {
+		return CredentialProcessOutput{}, errors.New("unable to obtain temporary security credentials from AssumeRole")
+	}
+	return CredentialProcessOutput{
+		Version:         1,
+		AccessKeyId:     aws.ToString(output.Credentials.AccessKeyId),
+		SecretAccessKey: aws.ToString(output.Credentials.SecretAccessKey),
+		SessionToken:    aws.ToString(output.Credentials.SessionToken),
+		Expiration:      aws.ToTime(output.Credentials.Expiration).UTC().Format(time.RFC3339),
+	}, nil
+}
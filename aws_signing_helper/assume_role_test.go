@@ -0,0 +1,117 @@
+package aws_signing_helper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChainedRoles(t *testing.T) {
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	// Each role is assumed with the credentials of the previous one, which
+	// are named after it
+	var assumed []string
+	stsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("Action") != "AssumeRole" || r.Form.Get("DurationSeconds") != "3600" ||
+			r.Form.Get("Tags.member.1.Key") != "device" || r.Form.Get("Tags.member.1.Value") != "TEST CLIENT" ||
+			r.Form.Get("TransitiveTagKeys.member.1") != "device" || r.Form.Get("ExternalId") != "external" ||
+			r.Form.Get("RoleSessionName") != "TEST-CLIENT-2" || r.Form.Get("SourceIdentity") != "device-2" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		roleArn := r.Form.Get("RoleArn")
+		assumed = append(assumed, roleArn+" with "+strings.SplitN(strings.SplitN(r.Header.Get("Authorization"), "Credential=", 2)[1], "/", 2)[0])
+		roleName := roleArn[strings.LastIndex(roleArn, "/")+1:]
+		w.Write([]byte(`<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><AssumeRoleResult><Credentials>` +
+			`<AccessKeyId>` + roleName + `</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>token</SessionToken>` +
+			`<Expiration>2022-07-27T04:36:55Z</Expiration></Credentials></AssumeRoleResult></AssumeRoleResponse>`))
+	}))
+	defer stsServer.Close()
+	stsEndpoint = stsServer.URL
+	defer func() { stsEndpoint = "" }()
+
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   43200,
+		ChainedRoleArns:   []string{"arn:aws:iam::000000000000:role/Hub", "arn:aws:iam::111111111111:role/Workload"},
+		SessionTags:       []SessionTag{{Key: "device", Value: "${subject.CN}"}},
+		TransitiveTagKeys: []string{"device"},
+		ExternalId:        "external",
+		SourceIdentity:    "device-${serial}",
+	}
+	credentialProcessOutput, err := GenerateCredentials(&credentialsOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"arn:aws:iam::000000000000:role/Hub with accessKeyId",
+		"arn:aws:iam::111111111111:role/Workload with Hub",
+	}
+	if strings.Join(assumed, "\n") != strings.Join(expected, "\n") {
+		t.Log("unexpected roles assumed:", assumed)
+		t.Fail()
+	}
+	if credentialProcessOutput.AccessKeyId != "Workload" || credentialProcessOutput.Expiration != "2022-07-27T04:36:55Z" {
+		t.Log("unexpected credentials:", credentialProcessOutput)
+		t.Fail()
+	}
+}
+
+func TestChainedRoleSessionPolicies(t *testing.T) {
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	// The session policies only apply to the last role
+	policies := make(map[string]string)
+	stsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		policies[r.Form.Get("RoleArn")] = r.Form.Get("Policy") + " " + r.Form.Get("PolicyArns.member.1.arn")
+		w.Write([]byte(`<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><AssumeRoleResult><Credentials>` +
+			`<AccessKeyId>accessKeyId</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>token</SessionToken>` +
+			`<Expiration>2022-07-27T04:36:55Z</Expiration></Credentials></AssumeRoleResult></AssumeRoleResponse>`))
+	}))
+	defer stsServer.Close()
+	stsEndpoint = stsServer.URL
+	defer func() { stsEndpoint = "" }()
+
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+		ChainedRoleArns:   []string{"arn:aws:iam::000000000000:role/Hub", "arn:aws:iam::111111111111:role/Workload"},
+		SessionPolicy:     `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`,
+		PolicyArns:        []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"},
+	}
+	if _, err := GenerateCredentials(&credentialsOpts); err != nil {
+		t.Fatal(err)
+	}
+	if policies["arn:aws:iam::000000000000:role/Hub"] != " " ||
+		policies["arn:aws:iam::111111111111:role/Workload"] != credentialsOpts.SessionPolicy+" arn:aws:iam::aws:policy/ReadOnlyAccess" {
+		t.Log("unexpected session policies:", policies)
+		t.Fail()
+	}
+
+	credentialsOpts.ChainedRoleArns = nil
+	if _, err := GenerateCredentials(&credentialsOpts); err != ErrSessionPolicyWithoutChainedRole {
+		t.Log("unexpected error without chained roles:", err)
+		t.Fail()
+	}
+	credentialsOpts.SessionPolicy = ""
+	credentialsOpts.PolicyArns = nil
+	credentialsOpts.SourceIdentity = "device"
+	if _, err := GenerateCredentials(&credentialsOpts); err != ErrSourceIdentityWithoutChainedRole {
+		t.Log("unexpected error without chained roles:", err)
+		t.Fail()
+	}
+}
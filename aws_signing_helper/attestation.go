@@ -0,0 +1,142 @@
+package aws_signing_helper
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+)
+
+// PEM block types of the parts of a TPM attestation statement
+const (
+	// TPMT_PUBLIC of the attested key
+	tpmKeyPublicBlockType = "TPM2 KEY PUBLIC"
+	// TPMT_PUBLIC of the attestation key
+	tpmAKPublicBlockType = "TPM2 AK PUBLIC"
+	// TPMS_ATTEST produced by TPM2_Certify
+	tpmAttestationBlockType = "TPM2 ATTESTATION"
+	// TPMT_SIGNATURE of the TPMS_ATTEST, by the attestation key
+	tpmSignatureBlockType = "TPM2 SIGNATURE"
+)
+
+// NV indices at which the TPM manufacturer stores the endorsement key
+// certificates (see the TCG EK Credential Profile)
+var tpmEKCertificateIndices = []tpmutil.Handle{
+	0x01c00002, // RSA 2048
+	0x01c0000a, // ECC NIST P-256
+}
+
+// Template of the attestation key, a restricted signing key in the
+// endorsement hierarchy (TPM2_Certify, as implemented by go-tpm, always
+// signs with RSASSA and SHA-256)
+var tpmAKTemplate = tpm2.Public{
+	Type:       tpm2.AlgRSA,
+	NameAlg:    tpm2.AlgSHA256,
+	Attributes: tpm2.FlagSignerDefault | tpm2.FlagNoDA,
+	RSAParameters: &tpm2.RSAParams{
+		Sign:    &tpm2.SigScheme{Alg: tpm2.AlgRSASSA, Hash: tpm2.AlgSHA256},
+		KeyBits: 2048,
+	},
+}
+
+// Produces a statement, signed by an attestation key of the TPM, that the
+// TSS2 private key at the provided path is held by the TPM (and was created
+// by it, if the key's attributes include fixedTPM and sensitiveDataOrigin).
+// The nonce, if any, is included in the statement as its qualifying data.
+// The statement consists of PEM blocks: the public areas of the key and of
+// the attestation key, the TPMS_ATTEST structure and its signature, and the
+// endorsement key certificates that the TPM holds. Tying the attestation key
+// to the endorsement key (through TPM2_ActivateCredential) is left to the
+// verifier.
+func AttestTPMKey(tpmDevice string, privateKeyId string, keyPassword string, pinFile string, nonce []byte) ([]byte, error) {
+	key, err := readTPMKey(privateKeyId)
+	if err != nil {
+		return nil, err
+	}
+	keyPublic, err := unmarshalTPM2B(key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if !key.EmptyAuth {
+		keyPassword, err = GetPin(PinOpts{Pin: keyPassword, PinFile: pinFile, Prompt: "Please enter the password for the TPM key:"})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if tpmDevice == "" && runtime.GOOS != "windows" {
+		tpmDevice = DefaultTPMDevice
+	}
+	rw, err := openTPM(tpmDevice)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open TPM: %w", err)
+	}
+	defer rw.Close()
+
+	keyHandle, err := loadTPMKey(rw, key)
+	if err != nil {
+		return nil, err
+	}
+	defer tpm2.FlushContext(rw, keyHandle)
+	akHandle, _, err := tpm2.CreatePrimary(rw, tpm2.HandleEndorsement, tpm2.PCRSelection{}, "", "", tpmAKTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create attestation key: %w", err)
+	}
+	defer tpm2.FlushContext(rw, akHandle)
+	akPublicArea, _, _, err := tpm2.ReadPublic(rw, akHandle)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read attestation key: %w", err)
+	}
+	akPublic, err := akPublicArea.Encode()
+	if err != nil {
+		return nil, err
+	}
+	attestation, signature, err := tpm2.Certify(rw, keyPassword, "", keyHandle, akHandle, nonce)
+	if err != nil {
+		return nil, fmt.Errorf("unable to certify TPM key: %w", err)
+	}
+
+	var statement []byte
+	for _, block := range []*pem.Block{
+		{Type: tpmKeyPublicBlockType, Bytes: keyPublic},
+		{Type: tpmAKPublicBlockType, Bytes: akPublic},
+		{Type: tpmAttestationBlockType, Bytes: attestation},
+		{Type: tpmSignatureBlockType, Bytes: signature},
+	} {
+		statement = append(statement, pem.EncodeToMemory(block)...)
+	}
+	ekCertificates := 0
+	for _, index := range tpmEKCertificateIndices {
+		data, err := tpm2.NVReadEx(rw, index, index, "", 0)
+		if err != nil {
+			continue
+		}
+		cert, err := parsePaddedCertificate(data)
+		if err != nil {
+			log.Println("unable to parse the endorsement key certificate at NV index", fmt.Sprintf("%#x", uint32(index)), "-", err)
+			continue
+		}
+		statement = append(statement, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+		ekCertificates++
+	}
+	if ekCertificates == 0 {
+		log.Println("the TPM holds no endorsement key certificate")
+	}
+	return statement, nil
+}
+
+// Parses a DER certificate that may be followed by padding, as some TPM
+// manufacturers store endorsement key certificates
+func parsePaddedCertificate(data []byte) (*x509.Certificate, error) {
+	var raw asn1.RawValue
+	if _, err := asn1.Unmarshal(data, &raw); err != nil {
+		return nil, errors.New("could not parse certificate")
+	}
+	return x509.ParseCertificate(raw.FullBytes)
+}
@@ -0,0 +1,30 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParsePaddedCertificate(t *testing.T) {
+	cert, _ := createChainTestCertificate(t, "Endorsement Key", nil, nil)
+
+	fixtures := []struct {
+		name  string
+		data  []byte
+		valid bool
+	}{
+		{"unpadded", cert.Raw, true},
+		{"padded", append(append([]byte{}, cert.Raw...), bytes.Repeat([]byte{0xff}, 64)...), true},
+		{"truncated", cert.Raw[:len(cert.Raw)/2], false},
+	}
+	for _, fixture := range fixtures {
+		parsed, err := parsePaddedCertificate(fixture.data)
+		if fixture.valid && (err != nil || !parsed.Equal(cert)) {
+			t.Logf("Expected the %s certificate to be parsed: %v", fixture.name, err)
+			t.Fail()
+		} else if !fixture.valid && err == nil {
+			t.Logf("Expected the %s certificate not to be parsed", fixture.name)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	azureKeyVaultAPIVersion = "7.4"
+	azureKeyVaultResource   = "https://vault.azure.net"
+	// Instance Metadata Service endpoint, which provides managed identity
+	// tokens on Azure VMs (and AKS nodes)
+	azureIMDSTokenEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+	// How often the certificate is fetched again, to pick up renewals
+	azureCertificateRefreshInterval = time.Hour
+)
+
+// Options for signing with a key in Azure Key Vault
+type AzureKeyVaultOpts struct {
+	// URL of the vault (https://<name>.vault.azure.net)
+	VaultURL string
+	// Name of the Key Vault certificate, whose key is used for signing
+	CertificateName string
+	// Client ID of the user-assigned managed identity to authenticate as
+	// (the system-assigned identity is used, if not provided)
+	ClientId string
+}
+
+// Signer that uses the key of a certificate in Azure Key Vault, so that the
+// private key never leaves the vault. The certificate is fetched from the
+// vault as well, and fetched again periodically, so that renewals (which
+// create a new version of the certificate and key) are picked up.
+type AzureKeyVaultSigner struct {
+	mutex            sync.Mutex
+	opts             AzureKeyVaultOpts
+	httpClient       *http.Client
+	token            string
+	tokenExpiry      time.Time
+	keyId            string
+	cert             *x509.Certificate
+	certificateChain []*x509.Certificate
+	fetchedAt        time.Time
+}
+
+// Creates a signer that uses the key of the given Key Vault certificate,
+// authenticating with a managed identity. Since the vault only returns the
+// end-entity certificate, a certificate bundle can be provided for the chain.
+func GetAzureKeyVaultSigner(opts AzureKeyVaultOpts, certificateBundleId string) (Signer, error) {
+	if opts.VaultURL == "" || opts.CertificateName == "" {
+		return nil, errors.New("both the Azure Key Vault URL and certificate name are required")
+	}
+	opts.VaultURL = strings.TrimSuffix(opts.VaultURL, "/")
+	signer := &AzureKeyVaultSigner{
+		opts:       opts,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+	var err error
+	if certificateBundleId != "" {
+		if signer.certificateChain, err = ReadCertificateBundleData(certificateBundleId); err != nil {
+			return nil, err
+		}
+	}
+	if err = signer.fetchCertificate(); err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
+
+// Obtains an access token for Key Vault from the managed identity endpoint:
+// the one that App Service and Functions provide through IDENTITY_ENDPOINT,
+// or else the Instance Metadata Service
+func (signer *AzureKeyVaultSigner) getToken() (string, error) {
+	if signer.token != "" && time.Now().Add(5*time.Minute).Before(signer.tokenExpiry) {
+		return signer.token, nil
+	}
+
+	query := url.Values{"resource": {azureKeyVaultResource}}
+	var request *http.Request
+	var err error
+	if identityEndpoint := os.Getenv("IDENTITY_ENDPOINT"); identityEndpoint != "" {
+		query.Set("api-version", "2019-08-01")
+		if signer.opts.ClientId != "" {
+			query.Set("client_id", signer.opts.ClientId)
+		}
+		if request, err = http.NewRequest(http.MethodGet, identityEndpoint+"?"+query.Encode(), nil); err != nil {
+			return "", err
+		}
+		request.Header.Set("X-IDENTITY-HEADER", os.Getenv("IDENTITY_HEADER"))
+	} else {
+		query.Set("api-version", "2018-02-01")
+		if signer.opts.ClientId != "" {
+			query.Set("client_id", signer.opts.ClientId)
+		}
+		if request, err = http.NewRequest(http.MethodGet, azureIMDSTokenEndpoint+"?"+query.Encode(), nil); err != nil {
+			return "", err
+		}
+		request.Header.Set("Metadata", "true")
+	}
+
+	var response struct {
+		AccessToken string `json:"access_token"`
+		// Seconds since the epoch, as a string
+		ExpiresOn string `json:"expires_on"`
+	}
+	if err = signer.do(request, &response); err != nil {
+		return "", fmt.Errorf("unable to obtain a managed identity token: %w", err)
+	}
+	expiresOn, err := strconv.ParseInt(response.ExpiresOn, 10, 64)
+	if err != nil {
+		expiresOn = time.Now().Add(time.Hour).Unix()
+	}
+	signer.token = response.AccessToken
+	signer.tokenExpiry = time.Unix(expiresOn, 0)
+	return signer.token, nil
+}
+
+// Makes an authenticated request to the Key Vault API
+func (signer *AzureKeyVaultSigner) request(method string, requestURL string, body interface{}, response interface{}) error {
+	token, err := signer.getToken()
+	if err != nil {
+		return err
+	}
+	var requestBody io.Reader
+	if body != nil {
+		bodyData, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		requestBody = bytes.NewReader(bodyData)
+	}
+	request, err := http.NewRequest(method, requestURL+"?api-version="+azureKeyVaultAPIVersion, requestBody)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	return signer.do(request, response)
+}
+
+func (signer *AzureKeyVaultSigner) do(request *http.Request, response interface{}) error {
+	httpResponse, err := signer.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer httpResponse.Body.Close()
+	responseData, err := io.ReadAll(httpResponse.Body)
+	if err != nil {
+		return err
+	}
+	if httpResponse.StatusCode < 200 || httpResponse.StatusCode > 299 {
+		var errorResponse struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(responseData, &errorResponse) == nil && errorResponse.Error.Message != "" {
+			return fmt.Errorf("request failed with status %d: %s", httpResponse.StatusCode, errorResponse.Error.Message)
+		}
+		return fmt.Errorf("request failed with status %d", httpResponse.StatusCode)
+	}
+	return json.Unmarshal(responseData, response)
+}
+
+// Fetches the current version of the certificate, along with the ID of the
+// matching version of its key
+func (signer *AzureKeyVaultSigner) fetchCertificate() error {
+	var response struct {
+		Kid string `json:"kid"`
+		Cer string `json:"cer"`
+	}
+	certificateURL := signer.opts.VaultURL + "/certificates/" + url.PathEscape(signer.opts.CertificateName)
+	if err := signer.request(http.MethodGet, certificateURL, nil, &response); err != nil {
+		return fmt.Errorf("unable to fetch the certificate from Azure Key Vault: %w", err)
+	}
+	der, err := base64.StdEncoding.DecodeString(response.Cer)
+	if err != nil {
+		return errors.New("unexpected certificate format from Azure Key Vault")
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("could not parse the certificate from Azure Key Vault: %w", err)
+	}
+	switch cert.PublicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return errors.New("unsupported certificate key type")
+	}
+	if response.Kid == "" {
+		return errors.New("the Azure Key Vault certificate has no key")
+	}
+	signer.keyId = response.Kid
+	signer.cert = cert
+	signer.fetchedAt = time.Now()
+	return nil
+}
+
+func (signer *AzureKeyVaultSigner) Public() crypto.PublicKey {
+	signer.mutex.Lock()
+	defer signer.mutex.Unlock()
+	return signer.cert.PublicKey
+}
+
+// Names of the Key Vault signing algorithms, for each key type and digest
+func azureSignatureAlgorithm(publicKey crypto.PublicKey, opts crypto.SignerOpts) (string, error) {
+	var prefix string
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		prefix = "RS"
+		if _, ok := opts.(*rsa.PSSOptions); ok {
+			prefix = "PS"
+		}
+	case *ecdsa.PublicKey:
+		prefix = "ES"
+	default:
+		return "", errors.New("unsupported key type")
+	}
+	switch opts.HashFunc() {
+	case crypto.SHA256:
+		return prefix + "256", nil
+	case crypto.SHA384:
+		return prefix + "384", nil
+	case crypto.SHA512:
+		return prefix + "512", nil
+	}
+	return "", errors.New("unsupported digest")
+}
+
+// Signs the digest with the key version that matches the current
+// certificate. ECDSA signatures are returned by Key Vault as r || s, and are
+// converted to their ASN.1 encoding.
+func (signer *AzureKeyVaultSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	signer.mutex.Lock()
+	defer signer.mutex.Unlock()
+	algorithm, err := azureSignatureAlgorithm(signer.cert.PublicKey, opts)
+	if err != nil {
+		return nil, err
+	}
+	request := map[string]string{
+		"alg":   algorithm,
+		"value": base64.RawURLEncoding.EncodeToString(digest),
+	}
+	var response struct {
+		Value string `json:"value"`
+	}
+	if err = signer.request(http.MethodPost, signer.keyId+"/sign", request, &response); err != nil {
+		return nil, fmt.Errorf("Azure Key Vault signing failed: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(response.Value, "="))
+	if err != nil {
+		return nil, errors.New("unexpected signature format from Azure Key Vault")
+	}
+
+	valid := false
+	switch publicKey := signer.cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		valid = verifyRSASignature(publicKey, digest, sig, opts)
+	case *ecdsa.PublicKey:
+		if sig, err = encodeECDSASignature(sig); err != nil {
+			return nil, err
+		}
+		valid = ecdsa.VerifyASN1(publicKey, digest, sig)
+	}
+	if !valid {
+		return nil, errors.New("the Azure Key Vault signature doesn't match the certificate")
+	}
+	return sig, nil
+}
+
+// Returns the certificate, after fetching it again if it's been a while,
+// so that a renewed certificate (and its key) is used. If it can't be
+// fetched, the current one keeps being used.
+func (signer *AzureKeyVaultSigner) Certificate() (*x509.Certificate, error) {
+	signer.mutex.Lock()
+	defer signer.mutex.Unlock()
+	if time.Since(signer.fetchedAt) > azureCertificateRefreshInterval {
+		if err := signer.fetchCertificate(); err != nil {
+			log.Println("unable to refresh the certificate, using the current one:", err)
+		}
+	}
+	return signer.cert, nil
+}
+
+func (signer *AzureKeyVaultSigner) supportsPSS() bool {
+	return true
+}
+
+func (signer *AzureKeyVaultSigner) CertificateChain() ([]*x509.Certificate, error) {
+	return signer.certificateChain, nil
+}
+
+func (signer *AzureKeyVaultSigner) Close() {
+}
@@ -0,0 +1,137 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Serves a managed identity endpoint and the Key Vault certificate and
+// sign operations, for the given key and certificate
+func startTestAzureKeyVault(t *testing.T, privateKeyId string, certificateId string) *httptest.Server {
+	privateKey, err := ReadPrivateKeyData(privateKeyId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := readCertificate(certificateId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/identity", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-IDENTITY-HEADER") != "test-identity-header" || r.URL.Query().Get("resource") != azureKeyVaultResource {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "test-token", "expires_on": "4102444800"})
+	})
+	mux.HandleFunc("/certificates/test-cert", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"kid": server.URL + "/keys/test-cert/v1",
+			"cer": base64.StdEncoding.EncodeToString(cert.Raw),
+		})
+	})
+	mux.HandleFunc("/keys/test-cert/v1/sign", func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Alg   string `json:"alg"`
+			Value string `json:"value"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		digest, _ := base64.RawURLEncoding.DecodeString(request.Value)
+		var sig []byte
+		switch key := privateKey.(type) {
+		case ecdsa.PrivateKey:
+			if request.Alg != "ES256" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			r, s, _ := ecdsa.Sign(rand.Reader, &key, digest)
+			size := (key.Curve.Params().BitSize + 7) / 8
+			sig = append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...)
+		case rsa.PrivateKey:
+			if request.Alg != "RS256" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			sig, _ = rsa.SignPKCS1v15(rand.Reader, &key, crypto.SHA256, digest)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"kid": server.URL + "/keys/test-cert/v1", "value": base64.RawURLEncoding.EncodeToString(sig)})
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	t.Setenv("IDENTITY_ENDPOINT", server.URL+"/identity")
+	t.Setenv("IDENTITY_HEADER", "test-identity-header")
+	return server
+}
+
+func TestAzureKeyVaultSigner(t *testing.T) {
+	fixtures := []struct {
+		privateKeyId  string
+		certificateId string
+	}{
+		{"../tst/certs/ec-prime256v1-key.pem", "../tst/certs/ec-prime256v1-sha256-cert.pem"},
+		{"../tst/certs/rsa-2048-key.pem", "../tst/certs/rsa-2048-sha256-cert.pem"},
+	}
+	msg := []byte("test message")
+	digest := sha256.Sum256(msg)
+	for _, fixture := range fixtures {
+		server := startTestAzureKeyVault(t, fixture.privateKeyId, fixture.certificateId)
+		signer, err := GetAzureKeyVaultSigner(AzureKeyVaultOpts{VaultURL: server.URL + "/", CertificateName: "test-cert"}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, _ := signer.Certificate()
+		signingResult, err := Sign(msg, SigningOpts{signer, crypto.SHA256})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, _ := hex.DecodeString(signingResult.Signature)
+
+		valid := false
+		switch publicKey := cert.PublicKey.(type) {
+		case *ecdsa.PublicKey:
+			valid = ecdsa.VerifyASN1(publicKey, digest[:], sig)
+		case *rsa.PublicKey:
+			valid = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], sig) == nil
+		}
+		if !valid {
+			t.Logf("Failed to verify the signature for %s", fixture.certificateId)
+			t.Fail()
+		}
+	}
+}
+
+func TestAzureKeyVaultSignerMismatch(t *testing.T) {
+	// The vault signs with a key that doesn't match its certificate
+	server := startTestAzureKeyVault(t, "../tst/certs/ec-prime256v1-key.pem", "../tst/certs/ec-prime256v1-sha256-cert.pem")
+	signer, err := GetAzureKeyVaultSigner(AzureKeyVaultOpts{VaultURL: server.URL, CertificateName: "test-cert"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	azureSigner := signer.(*AzureKeyVaultSigner)
+	otherCert, _ := readCertificate("../tst/certs/ec-prime256v1-sha256-cert.pem")
+	otherKey := *otherCert.PublicKey.(*ecdsa.PublicKey)
+	otherKey.X = new(big.Int).Add(otherKey.X, big.NewInt(1))
+	otherCert.PublicKey = &otherKey
+	azureSigner.cert = otherCert
+	if _, err = Sign([]byte("test message"), SigningOpts{signer, crypto.SHA256}); err == nil {
+		t.Log("Expected a signature that doesn't match the certificate to be rejected")
+		t.Fail()
+	}
+}
@@ -0,0 +1,238 @@
+package aws_signing_helper
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/google/go-tpm/tpm2"
+)
+
+// How cached credentials are encrypted at rest, if they are: with a key
+// sealed to the TPM, with DPAPI (on Windows), or with a key kept in the OS's
+// secret store, so that the cache can't be read on another machine (or, with
+// DPAPI and the secret store, by another user)
+const (
+	CacheEncryptionTPM      = "tpm"
+	CacheEncryptionDPAPI    = "dpapi"
+	CacheEncryptionKeychain = "keychain"
+)
+
+// Names of the file in the cache directory that holds the TPM-sealed key,
+// and of the secret under which the key is kept in the secret store
+const (
+	tpmCacheKeyFileName = "cache-key.tpm"
+	cacheKeySecretName  = "cache-key"
+)
+
+// Encrypts and decrypts cache entries. The label (the entry's key) is bound
+// to the ciphertext, so that an entry can't be passed off as another.
+type cacheCipher interface {
+	seal(plaintext []byte, label []byte) ([]byte, error)
+	open(ciphertext []byte, label []byte) ([]byte, error)
+}
+
+// Returns the cipher with which the options say to encrypt cache entries,
+// or nil, if they aren't encrypted
+func newCacheCipher(cacheOpts CacheOpts) (cacheCipher, error) {
+	switch cacheOpts.Encryption {
+	case "":
+		return nil, nil
+	case CacheEncryptionTPM:
+		return &aesCacheCipher{key: func() ([]byte, error) {
+			return tpmCacheKey(cacheOpts.TpmDevice, filepath.Join(cacheOpts.Dir, tpmCacheKeyFileName))
+		}}, nil
+	case CacheEncryptionDPAPI:
+		return dpapiCacheCipher{}, nil
+	case CacheEncryptionKeychain:
+		return &aesCacheCipher{key: func() ([]byte, error) {
+			return keychainCacheKey(filepath.Join(cacheOpts.Dir, cacheKeySecretName+".lock"))
+		}}, nil
+	}
+	return nil, fmt.Errorf("unknown cache encryption %s (expected %s, %s, or %s)", cacheOpts.Encryption, CacheEncryptionTPM, CacheEncryptionDPAPI, CacheEncryptionKeychain)
+}
+
+// Encrypts cache entries with AES-256-GCM, with a key that's obtained (say,
+// unsealed by the TPM) the first time it's needed
+type aesCacheCipher struct {
+	key     func() ([]byte, error)
+	once    sync.Once
+	aead    cipher.AEAD
+	initErr error
+}
+
+func (c *aesCacheCipher) init() (cipher.AEAD, error) {
+	c.once.Do(func() {
+		var key []byte
+		if key, c.initErr = c.key(); c.initErr != nil {
+			return
+		}
+		var block cipher.Block
+		if block, c.initErr = aes.NewCipher(key); c.initErr != nil {
+			return
+		}
+		c.aead, c.initErr = cipher.NewGCM(block)
+	})
+	return c.aead, c.initErr
+}
+
+// Returns the nonce followed by the ciphertext
+func (c *aesCacheCipher) seal(plaintext []byte, label []byte) ([]byte, error) {
+	aead, err := c.init()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, label), nil
+}
+
+func (c *aesCacheCipher) open(ciphertext []byte, label []byte) ([]byte, error) {
+	aead, err := c.init()
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("the encrypted cache entry is truncated")
+	}
+	return aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], label)
+}
+
+// Encrypts cache entries with DPAPI, for the current user, with the label as
+// additional entropy
+type dpapiCacheCipher struct{}
+
+func (dpapiCacheCipher) seal(plaintext []byte, label []byte) ([]byte, error) {
+	return protectDPAPI(plaintext, label)
+}
+
+func (dpapiCacheCipher) open(ciphertext []byte, label []byte) ([]byte, error) {
+	if !isDPAPIBlob(ciphertext) {
+		return nil, errors.New("the cache entry isn't protected with DPAPI")
+	}
+	return unprotectDPAPIWithEntropy(ciphertext, label)
+}
+
+// Returned by the functions that read the cache encryption key if there's
+// none yet
+var errNoCacheKey = errors.New("no cache encryption key")
+
+// Reads the key with the given function, or, if there's none yet, creates
+// one, and stores it with the other. The key is created while holding the
+// lock on the given file, so that processes that run at the same time don't
+// create different ones. A key that can't be read (say, since it was sealed
+// by another machine's TPM, in a shared home directory) isn't replaced, so
+// that the entries that it encrypts stay readable where it can be.
+func getOrCreateCacheKey(lockPath string, read func() ([]byte, error), create func(key []byte) error) ([]byte, error) {
+	if key, err := read(); err != errNoCacheKey {
+		return key, err
+	}
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0700); err != nil {
+		return nil, err
+	}
+	lock, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Close()
+	if err = lockFile(lock); err != nil {
+		return nil, err
+	}
+	defer unlockFile(lock)
+	if key, err := read(); err != errNoCacheKey {
+		return key, err
+	}
+	key := make([]byte, 32)
+	if _, err = rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err = create(key); err != nil {
+		return nil, fmt.Errorf("unable to store the cache encryption key: %w", err)
+	}
+	return key, nil
+}
+
+// Returns the key with which cache entries are encrypted, unsealing it with
+// the TPM from the file at the given path (which holds the public and
+// private parts of the sealed object), or creating and sealing one, if
+// there's none yet. The key is sealed under the storage root key, so it can
+// only be unsealed by the same TPM.
+func tpmCacheKey(tpmDevice string, keyPath string) ([]byte, error) {
+	rw, err := openTPM(tpmDevice)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the TPM: %w", err)
+	}
+	defer rw.Close()
+	srkHandle, _, err := tpm2.CreatePrimary(rw, tpm2.HandleOwner, tpm2.PCRSelection{}, "", "", tpmSRKTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the TPM's storage root key: %w", err)
+	}
+	defer tpm2.FlushContext(rw, srkHandle)
+
+	read := func() ([]byte, error) {
+		data, err := os.ReadFile(keyPath)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, errNoCacheKey
+		}
+		if err != nil {
+			return nil, err
+		}
+		publicLength := 0
+		if len(data) >= 2 {
+			publicLength = int(data[0])<<8 | int(data[1])
+		}
+		if len(data) < 2+publicLength || publicLength == 0 {
+			return nil, errors.New("invalid sealed cache encryption key")
+		}
+		publicBlob, err := unmarshalTPM2B(data[:2+publicLength])
+		if err != nil {
+			return nil, err
+		}
+		privateBlob, err := unmarshalTPM2B(data[2+publicLength:])
+		if err != nil {
+			return nil, err
+		}
+		handle, _, err := tpm2.Load(rw, srkHandle, "", publicBlob, privateBlob)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load the sealed cache encryption key (which only the TPM that sealed it can): %w", err)
+		}
+		defer tpm2.FlushContext(rw, handle)
+		return tpm2.Unseal(rw, handle, "")
+	}
+	create := func(key []byte) error {
+		privateBlob, publicBlob, err := tpm2.Seal(rw, srkHandle, "", "", nil, key)
+		if err != nil {
+			return err
+		}
+		return writeFileAtomically(keyPath, append(marshalTPM2B(publicBlob), marshalTPM2B(privateBlob)...))
+	}
+	return getOrCreateCacheKey(keyPath+".lock", read, create)
+}
+
+// Returns the key with which cache entries are encrypted from the OS's
+// secret store, or creates and stores one, if there's none yet
+func keychainCacheKey(lockPath string) ([]byte, error) {
+	read := func() ([]byte, error) {
+		secret, err := readSecret(cacheKeySecretName)
+		if errors.Is(err, errSecretNotFound) {
+			return nil, errNoCacheKey
+		}
+		if err != nil {
+			return nil, err
+		}
+		return hex.DecodeString(strings.TrimSpace(string(secret)))
+	}
+	create := func(key []byte) error {
+		return writeSecret(cacheKeySecretName, []byte(hex.EncodeToString(key)))
+	}
+	return getOrCreateCacheKey(lockPath, read, create)
+}
@@ -0,0 +1,89 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptedFileCredentialCache(t *testing.T) {
+	cipher := &aesCacheCipher{key: func() ([]byte, error) {
+		return bytes.Repeat([]byte{0x42}, 32), nil
+	}}
+	cache := fileCredentialCache{dir: t.TempDir(), cipher: cipher}
+	credentialProcessOutput := CredentialProcessOutput{
+		Version:         1,
+		AccessKeyId:     "accessKeyId",
+		SecretAccessKey: "secretAccessKey",
+		SessionToken:    "sessionToken",
+		Expiration:      "2022-07-27T04:36:55Z",
+	}
+	if err := cache.put("key", credentialProcessOutput); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(cache.dir, "key.enc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("secretAccessKey")) {
+		t.Log("the cached credentials weren't encrypted")
+		t.Fail()
+	}
+	if cached, ok := cache.get("key"); !ok || cached != credentialProcessOutput {
+		t.Log("the encrypted credentials weren't read back:", cached)
+		t.Fail()
+	}
+
+	// An entry can't be passed off as another
+	if err = os.WriteFile(filepath.Join(cache.dir, "other.enc"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.get("other"); ok {
+		t.Log("an entry was decrypted under another key")
+		t.Fail()
+	}
+}
+
+func TestCacheEncryptionOptions(t *testing.T) {
+	if _, err := newCredentialCache(CacheOpts{Dir: t.TempDir(), Encryption: "rot13"}); err == nil {
+		t.Log("an unknown cache encryption was accepted")
+		t.Fail()
+	}
+	if _, err := newCredentialCache(CacheOpts{Dir: t.TempDir(), Backend: CacheBackendKeychain, Encryption: CacheEncryptionTPM}); err == nil {
+		t.Log("cache encryption was accepted with the keychain backend")
+		t.Fail()
+	}
+}
+
+func TestGetOrCreateCacheKey(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), "key.lock")
+	var stored []byte
+	read := func() ([]byte, error) {
+		if stored == nil {
+			return nil, errNoCacheKey
+		}
+		return stored, nil
+	}
+	create := func(key []byte) error {
+		stored = key
+		return nil
+	}
+	first, err := getOrCreateCacheKey(lockPath, read, create)
+	if err != nil || len(first) != 32 {
+		t.Fatal("unable to create a key:", err)
+	}
+	second, err := getOrCreateCacheKey(lockPath, read, create)
+	if err != nil || !bytes.Equal(first, second) {
+		t.Log("the key that was created wasn't reused")
+		t.Fail()
+	}
+
+	// A key that can't be read isn't replaced
+	unreadable := errors.New("sealed by another TPM")
+	if _, err = getOrCreateCacheKey(lockPath, func() ([]byte, error) { return nil, unreadable }, create); err != unreadable || !bytes.Equal(stored, first) {
+		t.Log("a key that couldn't be read was replaced")
+		t.Fail()
+	}
+}
@@ -0,0 +1,159 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Whether the path refers to a directory (rather than a file, a stream, or
+// an object on a token)
+func isDirectory(path string) bool {
+	if path == "" {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// Certificate file found in a directory
+type directoryCertificate struct {
+	path string
+	cert *x509.Certificate
+}
+
+// Reads the certificates in the files of a directory (not recursively), in
+// the order of their names. Files that don't contain a certificate, such as
+// private keys, are skipped. Only the first certificate of each file is
+// considered, as the others are usually its chain.
+func readDirectoryCertificates(dir string) ([]directoryCertificate, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var certs []directoryCertificate
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		der := data
+		if isPEM(data) {
+			der = nil
+			for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+				if block.Type == "CERTIFICATE" {
+					der = block.Bytes
+					break
+				}
+			}
+		}
+		if cert, err := x509.ParseCertificate(der); err == nil {
+			certs = append(certs, directoryCertificate{path, cert})
+		}
+	}
+	return certs, nil
+}
+
+// Finds the file, in a directory, holding the certificate that matches the
+// selector (any certificate, if there's no selector). If several match, the
+// one that preferCertificate favors is used.
+func selectDirectoryCertificate(dir string, certSelector *CertSelector) (directoryCertificate, error) {
+	certs, err := readDirectoryCertificates(dir)
+	if err != nil {
+		return directoryCertificate{}, err
+	}
+	var match *directoryCertificate
+	now := time.Now()
+	for i, cert := range certs {
+		if certSelector != nil && !certSelector.Matches(cert.cert) {
+			continue
+		}
+		if match == nil || preferCertificate(cert.cert, match.cert, now) {
+			match = &certs[i]
+		}
+	}
+	if match == nil {
+		return directoryCertificate{}, errors.New("no certificate in " + dir + " matches the selector")
+	}
+	return *match, nil
+}
+
+// Public key of a private key, as read by ReadPrivateKeyData
+func privateKeyPublic(privateKey crypto.PrivateKey) crypto.PublicKey {
+	switch key := privateKey.(type) {
+	case ecdsa.PrivateKey:
+		return &key.PublicKey
+	case rsa.PrivateKey:
+		return &key.PublicKey
+	case ed25519.PrivateKey:
+		return key.Public()
+	}
+	return nil
+}
+
+// Finds the file, in a directory, holding the private key of the
+// certificate. Encrypted private keys can't be matched, since their public
+// key isn't known until they're decrypted.
+func findDirectoryPrivateKey(dir string, cert *x509.Certificate) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		privateKey, err := ReadPrivateKeyData(path)
+		if err != nil {
+			continue
+		}
+		if publicKeysEqual(cert.PublicKey, privateKeyPublic(privateKey)) {
+			return path, nil
+		}
+	}
+	return "", errors.New("no private key in " + dir + " matches the certificate " + cert.Subject.String())
+}
+
+// Resolves a certificate directory (passed to --certificate) to the file
+// holding the certificate that matches the certificate selector, and a
+// private key directory to the file holding the matching private key. If no
+// private key was given, it's looked for in the certificate directory (but
+// it may also be held elsewhere, such as in a KMS).
+func resolveCertificateDirectory(opts CredentialsOpts) (CredentialsOpts, error) {
+	var certSelector *CertSelector
+	if opts.CertSelector != "" {
+		parsedCertSelector, err := ParseCertSelector(opts.CertSelector)
+		if err != nil {
+			return CredentialsOpts{}, err
+		}
+		certSelector = &parsedCertSelector
+	}
+	selected, err := selectDirectoryCertificate(opts.CertificateId, certSelector)
+	if err != nil {
+		return CredentialsOpts{}, err
+	}
+	if isDirectory(opts.PrivateKeyId) {
+		if opts.PrivateKeyId, err = findDirectoryPrivateKey(opts.PrivateKeyId, selected.cert); err != nil {
+			return CredentialsOpts{}, err
+		}
+	} else if opts.PrivateKeyId == "" {
+		opts.PrivateKeyId, _ = findDirectoryPrivateKey(opts.CertificateId, selected.cert)
+	}
+	opts.CertificateId = selected.path
+	// The selector has been applied, and mustn't select from the Windows
+	// certificate store as well
+	opts.CertSelector = ""
+	return opts, nil
+}
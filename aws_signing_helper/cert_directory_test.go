@@ -0,0 +1,140 @@
+package aws_signing_helper
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Copies test certificates and keys into a temporary directory
+func createCertificateDirectory(t *testing.T, files ...string) string {
+	dir := t.TempDir()
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join("../tst/certs", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(filepath.Join(dir, file), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestResolveCertificateDirectory(t *testing.T) {
+	dir := createCertificateDirectory(t,
+		"rsa-2048-sha256-cert.pem", "rsa-2048-key.pem",
+		"ec-prime256v1-sha256-cert.pem", "ec-prime256v1-key.pem")
+	keyDir := createCertificateDirectory(t, "rsa-2048-key.pem", "ec-prime256v1-key.pem")
+	fixtures := []struct {
+		privateKeyId  string
+		certSelector  string
+		certificateId string
+		expectedKey   string
+	}{
+		{"", "subject=CN=roles-anywhere-rsa-2048", "rsa-2048-sha256-cert.pem", "rsa-2048-key.pem"},
+		{"", "subject=CN=roles-anywhere-prime256v1-sha256", "ec-prime256v1-sha256-cert.pem", "ec-prime256v1-key.pem"},
+		{keyDir, "subject=CN=roles-anywhere-rsa-2048", "rsa-2048-sha256-cert.pem", "rsa-2048-key.pem"},
+		{"../tst/certs/rsa-2048-key.pem", "issuer=CN=roles-anywhere-rsa-2048", "rsa-2048-sha256-cert.pem", "rsa-2048-key.pem"},
+	}
+	for _, fixture := range fixtures {
+		opts, err := resolveCertificateDirectory(CredentialsOpts{
+			CertificateId: dir,
+			PrivateKeyId:  fixture.privateKeyId,
+			CertSelector:  fixture.certSelector,
+		})
+		if err != nil {
+			t.Log(err)
+			t.Fail()
+			continue
+		}
+		if filepath.Base(opts.CertificateId) != fixture.certificateId || filepath.Base(opts.PrivateKeyId) != fixture.expectedKey {
+			t.Logf("Unexpected files for %s: %s, %s", fixture.certSelector, opts.CertificateId, opts.PrivateKeyId)
+			t.Fail()
+		}
+		if opts.CertSelector != "" {
+			t.Log("Expected the certificate selector to be cleared")
+			t.Fail()
+		}
+	}
+
+	if _, err := resolveCertificateDirectory(CredentialsOpts{CertificateId: dir, CertSelector: "subject=CN=other"}); err == nil {
+		t.Log("Expected a selector that matches no certificate to be rejected")
+		t.Fail()
+	}
+}
+
+func TestSelectRotatedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	now := time.Now()
+	validity := []struct {
+		name      string
+		notBefore time.Time
+		notAfter  time.Time
+	}{
+		{"expired.pem", now.Add(-48 * time.Hour), now.Add(-time.Hour)},
+		{"current.pem", now.Add(-24 * time.Hour), now.Add(24 * time.Hour)},
+		{"rotated.pem", now.Add(-time.Hour), now.Add(72 * time.Hour)},
+		{"future.pem", now.Add(time.Hour), now.Add(96 * time.Hour)},
+	}
+	for i, certValidity := range validity {
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(i + 1)),
+			Subject:      pkix.Name{CommonName: "host"},
+			NotBefore:    certValidity.notBefore,
+			NotAfter:     certValidity.notAfter,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		if err = os.WriteFile(filepath.Join(dir, certValidity.name), certPem, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	selected, err := selectDirectoryCertificate(dir, &CertSelector{Subject: "CN=host"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(selected.path) != "rotated.pem" {
+		t.Log("Expected the valid certificate with the longest remaining lifetime, got", selected.path)
+		t.Fail()
+	}
+}
+
+func TestCredentialProcessCertificateDirectory(t *testing.T) {
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	dir := createCertificateDirectory(t,
+		"rsa-2048-sha256-cert.pem", "rsa-2048-key.pem",
+		"ec-prime256v1-sha256-cert.pem", "ec-prime256v1-key.pem")
+	credentialsOpts := CredentialsOpts{
+		CertificateId:     dir,
+		CertSelector:      "subject=CN=roles-anywhere-prime256v1-sha256",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	if _, err := GenerateCredentials(&credentialsOpts); err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+	if credentialsOpts.CertificateId != dir || !strings.HasPrefix(credentialsOpts.CertSelector, "subject=") {
+		t.Log("Expected the options not to be modified")
+		t.Fail()
+	}
+}
@@ -0,0 +1,256 @@
+package aws_signing_helper
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// OIDs of the Microsoft certificate template extensions. The first one
+// (used by version 1 templates) contains the name of the template, while
+// the second one (used by version 2 and later templates) contains its OID.
+var (
+	oidCertificateTemplateName = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 20, 2}
+	oidCertificateTemplate     = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 21, 7}
+)
+
+// Well-known extended key usages that can be referred to by name
+var extKeyUsageNames = map[string]x509.ExtKeyUsage{
+	"serverauth":      x509.ExtKeyUsageServerAuth,
+	"clientauth":      x509.ExtKeyUsageClientAuth,
+	"codesigning":     x509.ExtKeyUsageCodeSigning,
+	"emailprotection": x509.ExtKeyUsageEmailProtection,
+	"timestamping":    x509.ExtKeyUsageTimeStamping,
+	"ocspsigning":     x509.ExtKeyUsageOCSPSigning,
+}
+
+// OIDs of the extended key usages in x509.ExtKeyUsage
+var extKeyUsageOIDs = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:             "2.5.29.37.0",
+	x509.ExtKeyUsageServerAuth:      "1.3.6.1.5.5.7.3.1",
+	x509.ExtKeyUsageClientAuth:      "1.3.6.1.5.5.7.3.2",
+	x509.ExtKeyUsageCodeSigning:     "1.3.6.1.5.5.7.3.3",
+	x509.ExtKeyUsageEmailProtection: "1.3.6.1.5.5.7.3.4",
+	x509.ExtKeyUsageTimeStamping:    "1.3.6.1.5.5.7.3.8",
+	x509.ExtKeyUsageOCSPSigning:     "1.3.6.1.5.5.7.3.9",
+}
+
+// Criteria that a certificate has to match in order to be selected. Empty
+// criteria match any certificate.
+type CertSelector struct {
+	// Distinguished name of the subject, for example "CN=host,O=Example"
+	Subject string `json:"subject,omitempty"`
+	// Distinguished name of the issuer
+	Issuer string `json:"issuer,omitempty"`
+	// Serial number, in hex
+	Serial string `json:"serial,omitempty"`
+	// Extended key usage, as an OID or a well-known name such as "clientAuth"
+	EKU string `json:"eku,omitempty"`
+	// Certificate template, either by name (version 1 templates) or OID
+	Template string `json:"template,omitempty"`
+	// Subject alternative name: a DNS name, email address, IP address, or URI
+	SAN string `json:"san,omitempty"`
+}
+
+// Parses a certificate selector, provided either as a JSON object, or as
+// `key=value` pairs separated by semicolons (for example,
+// `subject=CN=host,O=Example;eku=clientAuth`)
+func ParseCertSelector(selector string) (CertSelector, error) {
+	var certSelector CertSelector
+	selector = strings.TrimSpace(selector)
+	if strings.HasPrefix(selector, "{") {
+		decoder := json.NewDecoder(strings.NewReader(selector))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&certSelector); err != nil {
+			return CertSelector{}, fmt.Errorf("invalid certificate selector: %w", err)
+		}
+	} else {
+		for _, pair := range strings.Split(selector, ";") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			key, value, found := strings.Cut(pair, "=")
+			if !found {
+				return CertSelector{}, fmt.Errorf("invalid certificate selector criterion: %s", pair)
+			}
+			value = strings.TrimSpace(value)
+			switch strings.ToLower(strings.TrimSpace(key)) {
+			case "subject":
+				certSelector.Subject = value
+			case "issuer":
+				certSelector.Issuer = value
+			case "serial":
+				certSelector.Serial = value
+			case "eku":
+				certSelector.EKU = value
+			case "template":
+				certSelector.Template = value
+			case "san":
+				certSelector.SAN = value
+			default:
+				return CertSelector{}, fmt.Errorf("unsupported certificate selector key: %s", key)
+			}
+		}
+	}
+
+	if certSelector.Serial != "" {
+		if _, err := parseSerialNumber(certSelector.Serial); err != nil {
+			return CertSelector{}, err
+		}
+	}
+	if certSelector == (CertSelector{}) {
+		return CertSelector{}, errors.New("certificate selector doesn't contain any criteria")
+	}
+	return certSelector, nil
+}
+
+// Parses a hex serial number, which may contain spaces or colons
+func parseSerialNumber(serial string) (*big.Int, error) {
+	serialBytes, err := hex.DecodeString(strings.NewReplacer(" ", "", ":", "").Replace(serial))
+	if err != nil {
+		return nil, fmt.Errorf("invalid serial number: %s", serial)
+	}
+	return new(big.Int).SetBytes(serialBytes), nil
+}
+
+// Normalizes a distinguished name for comparison, ignoring case and the
+// whitespace around separators
+func normalizeDistinguishedName(name string) string {
+	var parts []string
+	for _, part := range strings.Split(name, ",") {
+		parts = append(parts, strings.TrimSpace(part))
+	}
+	return strings.ToLower(strings.Join(parts, ","))
+}
+
+// Whether the certificate matches all of the selector's criteria
+func (certSelector CertSelector) Matches(cert *x509.Certificate) bool {
+	if certSelector.Subject != "" &&
+		normalizeDistinguishedName(certSelector.Subject) != normalizeDistinguishedName(cert.Subject.String()) {
+		return false
+	}
+	if certSelector.Issuer != "" &&
+		normalizeDistinguishedName(certSelector.Issuer) != normalizeDistinguishedName(cert.Issuer.String()) {
+		return false
+	}
+	if certSelector.Serial != "" {
+		serial, err := parseSerialNumber(certSelector.Serial)
+		if err != nil || serial.Cmp(cert.SerialNumber) != 0 {
+			return false
+		}
+	}
+	if certSelector.EKU != "" && !hasExtKeyUsage(cert, certSelector.EKU) {
+		return false
+	}
+	if certSelector.Template != "" && !hasCertificateTemplate(cert, certSelector.Template) {
+		return false
+	}
+	if certSelector.SAN != "" && !hasSubjectAltName(cert, certSelector.SAN) {
+		return false
+	}
+	return true
+}
+
+func hasSubjectAltName(cert *x509.Certificate, san string) bool {
+	for _, name := range cert.DNSNames {
+		if strings.EqualFold(name, san) {
+			return true
+		}
+	}
+	for _, address := range cert.EmailAddresses {
+		if strings.EqualFold(address, san) {
+			return true
+		}
+	}
+	if ip := net.ParseIP(san); ip != nil {
+		for _, address := range cert.IPAddresses {
+			if address.Equal(ip) {
+				return true
+			}
+		}
+	}
+	for _, uri := range cert.URIs {
+		if uri.String() == san {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether the first of two matching certificates should be used rather than
+// the second (for example, a newly rotated certificate, rather than the one
+// it replaces): certificates that are currently valid are preferred, and
+// then the one with the longest remaining lifetime
+func preferCertificate(a *x509.Certificate, b *x509.Certificate, now time.Time) bool {
+	aValid := !now.Before(a.NotBefore) && !now.After(a.NotAfter)
+	bValid := !now.Before(b.NotBefore) && !now.After(b.NotAfter)
+	if aValid != bValid {
+		return aValid
+	}
+	return a.NotAfter.After(b.NotAfter)
+}
+
+func hasExtKeyUsage(cert *x509.Certificate, eku string) bool {
+	if usage, ok := extKeyUsageNames[strings.ToLower(eku)]; ok {
+		eku = extKeyUsageOIDs[usage]
+	}
+	for _, usage := range cert.ExtKeyUsage {
+		if extKeyUsageOIDs[usage] == eku {
+			return true
+		}
+	}
+	for _, oid := range cert.UnknownExtKeyUsage {
+		if oid.String() == eku {
+			return true
+		}
+	}
+	return false
+}
+
+func hasCertificateTemplate(cert *x509.Certificate, template string) bool {
+	for _, extension := range cert.Extensions {
+		switch {
+		case extension.Id.Equal(oidCertificateTemplateName):
+			var name asn1.RawValue
+			if _, err := asn1.Unmarshal(extension.Value, &name); err != nil {
+				continue
+			}
+			if strings.EqualFold(decodeTemplateName(name), template) {
+				return true
+			}
+		case extension.Id.Equal(oidCertificateTemplate):
+			var templateInfo struct {
+				Id    asn1.ObjectIdentifier
+				Major int `asn1:"optional"`
+				Minor int `asn1:"optional"`
+			}
+			if _, err := asn1.Unmarshal(extension.Value, &templateInfo); err != nil {
+				continue
+			}
+			if templateInfo.Id.String() == template {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Decodes the template name, which is usually a BMPString (UTF-16BE)
+func decodeTemplateName(name asn1.RawValue) string {
+	if name.Tag != 30 {
+		return string(name.Bytes)
+	}
+	codeUnits := make([]uint16, len(name.Bytes)/2)
+	for i := range codeUnits {
+		codeUnits[i] = uint16(name.Bytes[2*i])<<8 | uint16(name.Bytes[2*i+1])
+	}
+	return string(utf16.Decode(codeUnits))
+}
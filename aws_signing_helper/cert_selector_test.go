@@ -0,0 +1,109 @@
+package aws_signing_helper
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+func createSelectorTestCertificate(t *testing.T) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var templateName []byte
+	for _, codeUnit := range utf16.Encode([]rune("Machine")) {
+		templateName = append(templateName, byte(codeUnit>>8), byte(codeUnit))
+	}
+	templateNameExtension, _ := asn1.Marshal(asn1.RawValue{Tag: 30, Bytes: templateName})
+	templateExtension, _ := asn1.Marshal(struct {
+		Id    asn1.ObjectIdentifier
+		Major int
+	}{asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 21, 8, 1, 2}, 100})
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(0x0a1b2c),
+		Subject:      pkix.Name{CommonName: "host", Organization: []string{"Example"}},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"host.example.com"},
+		IPAddresses:  []net.IP{net.ParseIP("192.0.2.1")},
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidCertificateTemplateName, Value: templateNameExtension},
+			{Id: oidCertificateTemplate, Value: templateExtension},
+		},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestCertSelector(t *testing.T) {
+	cert := createSelectorTestCertificate(t)
+	fixtures := []struct {
+		selector string
+		matches  bool
+	}{
+		{"subject=CN=host, O=Example", true},
+		{"subject=CN=other,O=Example", false},
+		{"issuer=cn=host,o=example;serial=0A:1B:2C", true},
+		{"serial=0a1b2d", false},
+		{"eku=clientAuth", true},
+		{"eku=1.3.6.1.5.5.7.3.2", true},
+		{"eku=serverAuth", false},
+		{"template=machine", true},
+		{"template=1.3.6.1.4.1.311.21.8.1.2", true},
+		{"template=User", false},
+		{`{"subject": "CN=host,O=Example", "eku": "clientAuth"}`, true},
+		{`{"issuer": "CN=other"}`, false},
+		{"san=Host.Example.com", true},
+		{"san=192.0.2.1", true},
+		{"san=other.example.com", false},
+		{`{"subject": "CN=host,O=Example", "san": "host.example.com"}`, true},
+	}
+	for _, fixture := range fixtures {
+		certSelector, err := ParseCertSelector(fixture.selector)
+		if err != nil {
+			t.Logf("Unable to parse %s: %s", fixture.selector, err)
+			t.Fail()
+			continue
+		}
+		if certSelector.Matches(cert) != fixture.matches {
+			t.Logf("Unexpected result for %s", fixture.selector)
+			t.Fail()
+		}
+	}
+}
+
+func TestParseInvalidCertSelector(t *testing.T) {
+	fixtures := []string{
+		"",
+		"subject",
+		"color=blue",
+		"serial=xyz",
+		`{"color": "blue"}`,
+		`{"subject": `,
+	}
+	for _, fixture := range fixtures {
+		if _, err := ParseCertSelector(fixture); err == nil {
+			t.Logf("Expected %q to be rejected", fixture)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package aws_signing_helper
+
+import (
+	"errors"
+)
+
+func GetWindowsCertStoreSigner(storeLocation string, thumbprint string, subject string, certSelector *CertSelector, certificateBundleId string) (Signer, error) {
+	return nil, errors.New("the Windows certificate store is only supported on Windows")
+}
@@ -0,0 +1,193 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Signer that uses a certificate, and its private key, from the Windows
+// certificate store. Signing is done through CNG, so the key can be held
+// by any key storage provider (software, smart card, or TPM).
+type WindowsCertStoreSigner struct {
+	mutex            sync.Mutex
+	store            windows.Handle
+	certContext      *windows.CertContext
+	key              uintptr
+	freeKey          bool
+	cert             *x509.Certificate
+	certificateChain []*x509.Certificate
+}
+
+// Maps the supported store locations to the flags used to open them
+var certStoreLocations = map[string]uint32{
+	"currentuser":  windows.CERT_SYSTEM_STORE_CURRENT_USER,
+	"localmachine": windows.CERT_SYSTEM_STORE_LOCAL_MACHINE,
+}
+
+// Creates a signer that uses the certificate in the MY store at the given
+// location (CurrentUser or LocalMachine) that has the given SHA-1
+// thumbprint, or whose subject contains the given string, and that matches
+// the certificate selector (if any)
+func GetWindowsCertStoreSigner(storeLocation string, thumbprint string, subject string, certSelector *CertSelector, certificateBundleId string) (signer Signer, err error) {
+	if storeLocation == "" {
+		storeLocation = "CurrentUser"
+	}
+	locationFlags, ok := certStoreLocations[strings.ToLower(storeLocation)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported certificate store location: %s", storeLocation)
+	}
+
+	storeName, err := windows.UTF16PtrFromString("MY")
+	if err != nil {
+		return nil, err
+	}
+	store, err := windows.CertOpenStore(windows.CERT_STORE_PROV_SYSTEM, 0, 0,
+		locationFlags|windows.CERT_STORE_OPEN_EXISTING_FLAG|windows.CERT_STORE_READONLY_FLAG, uintptr(unsafe.Pointer(storeName)))
+	if err != nil {
+		return nil, fmt.Errorf("unable to open certificate store: %w", err)
+	}
+	certStoreSigner := &WindowsCertStoreSigner{store: store}
+	defer func() {
+		if err != nil {
+			certStoreSigner.Close()
+		}
+	}()
+
+	certStoreSigner.certContext, certStoreSigner.cert, err = findCertInStore(store, thumbprint, subject, certSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	var keySpec uint32
+	var key windows.Handle
+	err = windows.CryptAcquireCertificatePrivateKey(certStoreSigner.certContext, windows.CRYPT_ACQUIRE_ONLY_NCRYPT_KEY_FLAG,
+		nil, &key, &keySpec, &certStoreSigner.freeKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to acquire the certificate's private key: %w", err)
+	}
+	if keySpec != windows.CERT_NCRYPT_KEY_SPEC {
+		return nil, errors.New("the certificate's private key isn't a CNG key")
+	}
+	certStoreSigner.key = uintptr(key)
+
+	if certificateBundleId != "" {
+		if certStoreSigner.certificateChain, err = ReadCertificateBundleData(certificateBundleId); err != nil {
+			return nil, err
+		}
+	}
+	return certStoreSigner, nil
+}
+
+// Finds the certificate in the store that matches the thumbprint
+// or subject, as well as the certificate selector. The returned context has
+// to be freed by the caller.
+func findCertInStore(store windows.Handle, thumbprint string, subject string, certSelector *CertSelector) (*windows.CertContext, *x509.Certificate, error) {
+	findType := uint32(windows.CERT_FIND_ANY)
+	var findPara unsafe.Pointer
+	if thumbprint != "" {
+		hash, err := hex.DecodeString(strings.NewReplacer(" ", "", ":", "").Replace(thumbprint))
+		if err != nil || len(hash) != 20 {
+			return nil, nil, errors.New("invalid certificate thumbprint")
+		}
+		findType = windows.CERT_FIND_SHA1_HASH
+		findPara = unsafe.Pointer(&windows.CryptHashBlob{Size: uint32(len(hash)), Data: &hash[0]})
+	} else if subject != "" {
+		subjectPtr, err := windows.UTF16PtrFromString(subject)
+		if err != nil {
+			return nil, nil, err
+		}
+		findType = windows.CERT_FIND_SUBJECT_STR
+		findPara = unsafe.Pointer(subjectPtr)
+	} else if certSelector == nil {
+		return nil, nil, errors.New("either a certificate thumbprint, subject, or selector has to be provided")
+	}
+
+	// If several certificates match (such as a certificate and the one that
+	// replaced it), the one that preferCertificate favors is used
+	var match *windows.CertContext
+	var matchCert *x509.Certificate
+	var prev *windows.CertContext
+	now := time.Now()
+	for {
+		certContext, err := windows.CertFindCertificateInStore(store, windows.X509_ASN_ENCODING|windows.PKCS_7_ASN_ENCODING, 0, findType, findPara, prev)
+		if err != nil {
+			if errors.Is(err, windows.Errno(windows.CRYPT_E_NOT_FOUND)) {
+				break
+			}
+			if match != nil {
+				windows.CertFreeCertificateContext(match)
+			}
+			return nil, nil, err
+		}
+		prev = certContext
+
+		cert, err := x509.ParseCertificate(unsafe.Slice(certContext.EncodedCert, certContext.Length))
+		if err != nil || (certSelector != nil && !certSelector.Matches(cert)) {
+			continue
+		}
+		if match != nil {
+			if !preferCertificate(cert, matchCert, now) {
+				continue
+			}
+			windows.CertFreeCertificateContext(match)
+		}
+		match = windows.CertDuplicateCertificateContext(certContext)
+		matchCert = cert
+	}
+	if match == nil {
+		return nil, nil, errors.New("no matching certificate found in the certificate store")
+	}
+	return match, matchCert, nil
+}
+
+func (certStoreSigner *WindowsCertStoreSigner) Public() crypto.PublicKey {
+	return certStoreSigner.cert.PublicKey
+}
+
+func (certStoreSigner *WindowsCertStoreSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	certStoreSigner.mutex.Lock()
+	defer certStoreSigner.mutex.Unlock()
+	if certStoreSigner.key == 0 {
+		return nil, errors.New("signer has been closed")
+	}
+	return ncryptSignHash(certStoreSigner.key, certStoreSigner.cert.PublicKey, digest, opts)
+}
+
+func (certStoreSigner *WindowsCertStoreSigner) supportsPSS() bool {
+	return true
+}
+
+func (certStoreSigner *WindowsCertStoreSigner) Certificate() (*x509.Certificate, error) {
+	return certStoreSigner.cert, nil
+}
+
+func (certStoreSigner *WindowsCertStoreSigner) CertificateChain() ([]*x509.Certificate, error) {
+	return certStoreSigner.certificateChain, nil
+}
+
+func (certStoreSigner *WindowsCertStoreSigner) Close() {
+	certStoreSigner.mutex.Lock()
+	defer certStoreSigner.mutex.Unlock()
+	if certStoreSigner.key != 0 && certStoreSigner.freeKey {
+		ncryptFreeKey(certStoreSigner.key)
+	}
+	certStoreSigner.key = 0
+	if certStoreSigner.certContext != nil {
+		windows.CertFreeCertificateContext(certStoreSigner.certContext)
+		certStoreSigner.certContext = nil
+	}
+	if certStoreSigner.store != 0 {
+		windows.CertCloseStore(certStoreSigner.store, 0)
+		certStoreSigner.store = 0
+	}
+}
@@ -0,0 +1,74 @@
+package aws_signing_helper
+
+import (
+	"crypto/x509"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Matches the references to certificate attributes in a template, such as
+// ${subject.CN}
+var certTemplateReference = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// Returns the value of a certificate attribute that a template refers to:
+// subject.CN, subject.O, subject.OU, issuer.CN, serial (in hex), or the first
+// subject alternative name of a kind (san.dns, san.email, san.ip, or
+// san.uri)
+func certificateAttribute(certificate *x509.Certificate, name string) (string, bool) {
+	first := func(values []string) string {
+		if len(values) == 0 {
+			return ""
+		}
+		return values[0]
+	}
+	switch strings.ToLower(name) {
+	case "subject.cn":
+		return certificate.Subject.CommonName, true
+	case "subject.o":
+		return first(certificate.Subject.Organization), true
+	case "subject.ou":
+		return first(certificate.Subject.OrganizationalUnit), true
+	case "issuer.cn":
+		return certificate.Issuer.CommonName, true
+	case "serial":
+		return fmt.Sprintf("%x", certificate.SerialNumber), true
+	case "san.dns":
+		return first(certificate.DNSNames), true
+	case "san.email":
+		return first(certificate.EmailAddresses), true
+	case "san.ip":
+		if len(certificate.IPAddresses) == 0 {
+			return "", true
+		}
+		return certificate.IPAddresses[0].String(), true
+	case "san.uri":
+		if len(certificate.URIs) == 0 {
+			return "", true
+		}
+		return certificate.URIs[0].String(), true
+	}
+	return "", false
+}
+
+// Replaces the references to certificate attributes in the template (such
+// as ${subject.CN} or ${san.dns}) with their values. A reference to an
+// attribute that the certificate doesn't have is an error, so that
+// templates don't silently produce empty values.
+func expandCertificateTemplate(template string, certificate *x509.Certificate) (string, error) {
+	var err error
+	expanded := certTemplateReference.ReplaceAllStringFunc(template, func(reference string) string {
+		name := certTemplateReference.FindStringSubmatch(reference)[1]
+		value, ok := certificateAttribute(certificate, name)
+		if !ok {
+			err = fmt.Errorf("unknown certificate attribute %s in %s", name, template)
+		} else if value == "" {
+			err = fmt.Errorf("the certificate has no %s, which %s refers to", name, template)
+		}
+		return value
+	})
+	if err != nil {
+		return "", err
+	}
+	return expanded, nil
+}
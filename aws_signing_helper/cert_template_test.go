@@ -0,0 +1,44 @@
+package aws_signing_helper
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestExpandCertificateTemplate(t *testing.T) {
+	uri, _ := url.Parse("spiffe://example.org/host")
+	certificate := &x509.Certificate{
+		Subject:      pkix.Name{CommonName: "host", Organization: []string{"Example"}},
+		Issuer:       pkix.Name{CommonName: "Example CA"},
+		SerialNumber: big.NewInt(0x1f),
+		DNSNames:     []string{"host.example.com", "alias.example.com"},
+		IPAddresses:  []net.IP{net.ParseIP("192.0.2.1")},
+		URIs:         []*url.URL{uri},
+	}
+	fixtures := []struct {
+		template string
+		expected string
+	}{
+		{"static", "static"},
+		{"${subject.CN}", "host"},
+		{"${subject.O}/${issuer.CN}", "Example/Example CA"},
+		{"serial-${serial}", "serial-1f"},
+		{"${san.dns}", "host.example.com"},
+		{"${SAN.IP}", "192.0.2.1"},
+		{"${san.uri}", "spiffe://example.org/host"},
+		{"${subject.OU}", ""},
+		{"${san.email}", ""},
+		{"${unknown}", ""},
+	}
+	for _, fixture := range fixtures {
+		expanded, err := expandCertificateTemplate(fixture.template, certificate)
+		if expanded != fixture.expected || (err != nil) != (fixture.expected == "") {
+			t.Logf("%s: unexpected result %q, %v", fixture.template, expanded, err)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package aws_signing_helper
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Number of consecutive transient failures to obtain credentials after which
+// the long-running modes stop sending CreateSession requests for a while
+// (the circuit breaker opens), rather than keep hammering a degraded
+// endpoint. If it's 0, they never stop.
+var CircuitBreakerThreshold = 5
+
+// How long the circuit breaker stays open the first time it opens, and at
+// most: each time the request that's let through after that (the probe)
+// fails, it stays open twice as long, and each time one succeeds, the next
+// time it opens, it stays open half as long, so that it recovers gradually
+// from an endpoint that keeps failing
+var (
+	circuitBreakerMinCooldown = 30 * time.Second
+	circuitBreakerMaxCooldown = 10 * time.Minute
+)
+
+// Returned (wrapped) instead of sending a CreateSession request while the
+// circuit breaker is open
+var ErrCircuitOpen = errors.New("the circuit breaker is open after repeated failures to obtain credentials")
+
+// States of the circuit breaker, as reported by the health endpoints
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half-open"
+)
+
+type circuitBreaker struct {
+	sync.Mutex
+	failures  int
+	open      bool
+	openUntil time.Time
+	cooldown  time.Duration
+	probing   bool
+}
+
+// The circuit breaker of the process, which all the roles that it serves
+// share, since they're obtained from the same endpoint
+var breaker circuitBreaker
+
+// Returns an error if no request is let through: while the circuit breaker
+// is open, and, once it's half-open, while the probe is in flight
+func (b *circuitBreaker) allow(now time.Time) error {
+	b.Lock()
+	defer b.Unlock()
+	if !b.open || CircuitBreakerThreshold <= 0 {
+		return nil
+	}
+	if now.Before(b.openUntil) || b.probing {
+		return fmt.Errorf("%w (%d consecutive failures), so no request is sent until %s", ErrCircuitOpen, b.failures, b.openUntil.Format(time.RFC3339))
+	}
+	b.probing = true
+	return nil
+}
+
+// Records the outcome of a request that was let through. Only transient
+// errors count as failures: the endpoint did respond to requests that were
+// rejected.
+func (b *circuitBreaker) record(err error, now time.Time) {
+	b.Lock()
+	defer b.Unlock()
+	probe := b.probing
+	b.probing = false
+	if err == nil || !isTransientError(err) {
+		b.failures = 0
+		if b.open {
+			b.open = false
+			if b.cooldown /= 2; b.cooldown < circuitBreakerMinCooldown {
+				b.cooldown = 0
+			}
+			log.Println("the circuit breaker closed, since obtaining credentials succeeded again")
+		}
+		return
+	}
+	b.failures++
+	if CircuitBreakerThreshold <= 0 || (!probe && b.failures < CircuitBreakerThreshold) {
+		return
+	}
+	if b.cooldown == 0 {
+		b.cooldown = circuitBreakerMinCooldown
+	} else if probe {
+		b.cooldown *= 2
+	}
+	if b.cooldown > circuitBreakerMaxCooldown {
+		b.cooldown = circuitBreakerMaxCooldown
+	}
+	b.open = true
+	b.openUntil = now.Add(b.cooldown)
+	log.Printf("the circuit breaker opened after %d consecutive failures to obtain credentials, so no request is sent until %s", b.failures, b.openUntil.Format(time.RFC3339))
+}
+
+// Returns the state of the circuit breaker, the number of consecutive
+// failures, and, if it's open, until when
+func (b *circuitBreaker) state(now time.Time) (string, int, time.Time) {
+	b.Lock()
+	defer b.Unlock()
+	switch {
+	case !b.open:
+		return circuitClosed, b.failures, time.Time{}
+	case now.Before(b.openUntil):
+		return circuitOpen, b.failures, b.openUntil
+	}
+	return circuitHalfOpen, b.failures, b.openUntil
+}
+
+// Describes the state of the circuit breaker, if it isn't closed
+func describeCircuitBreaker(now time.Time) string {
+	state, failures, openUntil := breaker.state(now)
+	switch state {
+	case circuitOpen:
+		return fmt.Sprintf("circuit breaker open until %s, after %d consecutive failures to obtain credentials", openUntil.Format(time.RFC3339), failures)
+	case circuitHalfOpen:
+		return fmt.Sprintf("circuit breaker half-open, after %d consecutive failures to obtain credentials", failures)
+	}
+	return ""
+}
+
+// Obtains credentials for the long-running modes, unless the circuit
+// breaker is open
+func generateCredentialsWithBreaker(opts *CredentialsOpts, signer Signer) (CredentialProcessOutput, error) {
+	if err := breaker.allow(time.Now()); err != nil {
+		return CredentialProcessOutput{}, err
+	}
+	credentialProcessOutput, err := GenerateCredentialsWithSigner(opts, signer)
+	breaker.record(err, time.Now())
+	return credentialProcessOutput, err
+}
@@ -0,0 +1,106 @@
+package aws_signing_helper
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	smithy "github.com/aws/smithy-go"
+)
+
+func resetCircuitBreaker() {
+	breaker.Lock()
+	defer breaker.Unlock()
+	breaker.failures, breaker.open, breaker.cooldown, breaker.probing = 0, false, 0, false
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	defer func(threshold int) { CircuitBreakerThreshold = threshold }(CircuitBreakerThreshold)
+	CircuitBreakerThreshold = 2
+	transient := newResponseError(http.StatusServiceUnavailable, &smithy.GenericAPIError{Code: "ServiceUnavailable", Message: "unavailable"})
+	var b circuitBreaker
+	now := time.Now()
+
+	b.record(transient, now)
+	b.record(errors.New("rejected"), now)
+	b.record(transient, now)
+	if state, _, _ := b.state(now); state != circuitClosed {
+		t.Log("the circuit breaker opened, although the failures weren't consecutive")
+		t.Fail()
+	}
+	b.record(transient, now)
+	if err := b.allow(now); !errors.Is(err, ErrCircuitOpen) || !isTransientError(err) {
+		t.Log("the circuit breaker didn't open after consecutive failures:", err)
+		t.Fail()
+	}
+
+	// Once it's half-open, a single request is let through at a time
+	now = now.Add(circuitBreakerMinCooldown)
+	if state, _, _ := b.state(now); state != circuitHalfOpen {
+		t.Log("the circuit breaker isn't half-open after it cooled down:", state)
+		t.Fail()
+	}
+	if b.allow(now) != nil || b.allow(now) == nil {
+		t.Log("the circuit breaker didn't let through exactly one probe")
+		t.Fail()
+	}
+
+	// A failed probe keeps it open twice as long
+	b.record(transient, now)
+	if state, _, openUntil := b.state(now); state != circuitOpen || !openUntil.Equal(now.Add(2*circuitBreakerMinCooldown)) {
+		t.Log("the circuit breaker didn't back off after the probe failed:", state, openUntil)
+		t.Fail()
+	}
+
+	now = now.Add(2 * circuitBreakerMinCooldown)
+	if err := b.allow(now); err != nil {
+		t.Fatal(err)
+	}
+	b.record(nil, now)
+	if state, failures, _ := b.state(now); state != circuitClosed || failures != 0 {
+		t.Log("the circuit breaker didn't close after the probe succeeded:", state, failures)
+		t.Fail()
+	}
+}
+
+func TestRefreshThroughCircuitBreaker(t *testing.T) {
+	os.Setenv(MaxAttemptsEnvVarName, "1")
+	defer os.Unsetenv(MaxAttemptsEnvVarName)
+	defer func(threshold int) { CircuitBreakerThreshold = threshold }(CircuitBreakerThreshold)
+	CircuitBreakerThreshold = 2
+	resetCircuitBreaker()
+	defer resetCircuitBreaker()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	signer, err := GetSigner(&credentialsOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+
+	var cred RefreshableCred
+	for i := 0; i < 3; i++ {
+		err = refreshCredentials(&cred, &credentialsOpts, signer)
+	}
+	if !errors.Is(err, ErrCircuitOpen) || atomic.LoadInt32(&requests) != 2 {
+		t.Log("requests kept being sent after the circuit breaker should have opened:", requests, err)
+		t.Fail()
+	}
+}
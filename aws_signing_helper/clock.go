@@ -0,0 +1,115 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	smithy "github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Largest difference between the local clock and the server's that
+// requests signed with Signature Version 4 tolerate
+const maxClockSkew = 5 * time.Minute
+
+// Difference (in nanoseconds) between the server's clock and the local one,
+// learned from a request that was rejected because the local clock is off,
+// and applied to the time with which subsequent requests are signed
+var clockOffset int64
+
+// Time with which requests are signed: the local time, corrected by the
+// offset of the local clock from the server's, if it's known
+func signingTime() time.Time {
+	return correctedTime(time.Now())
+}
+
+// Corrects the given local time by the offset of the local clock from the
+// server's, if it's known
+func correctedTime(t time.Time) time.Time {
+	return t.Add(time.Duration(atomic.LoadInt64(&clockOffset)))
+}
+
+// Messages with which requests signed at a time too far from the server's
+// are rejected
+var clockSkewMessages = []string{
+	"signature expired",
+	"signature not yet current",
+	"request time too skewed",
+	"time is too skewed",
+}
+
+// Whether the request was rejected because it was signed at a time too far
+// from the server's
+func isClockSkewError(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode() {
+	case "RequestTimeTooSkewed", "RequestExpired", "SignatureExpired":
+		return true
+	}
+	message := strings.ToLower(apiErr.ErrorMessage())
+	for _, clockSkewMessage := range clockSkewMessages {
+		if strings.Contains(message, clockSkewMessage) {
+			return true
+		}
+	}
+	return false
+}
+
+// Remembers the offset of the local clock from the server's time (as seen
+// in the Date header of the response, received at the given local time), if
+// the request was rejected because the local clock is off, and returns
+// whether the request should be signed again with the corrected time
+func compensateClockSkew(err error, serverTime time.Time, received time.Time) bool {
+	if serverTime.IsZero() || !isClockSkewError(err) {
+		return false
+	}
+	offset := serverTime.Sub(received)
+	// The Date header has a resolution of a second, so an offset smaller
+	// than that can't be corrected
+	if offset < time.Second && offset > -time.Second {
+		return false
+	}
+	previous := time.Duration(atomic.SwapInt64(&clockOffset, int64(offset)))
+	log.Printf("the local clock is %s off from the server's; signing requests with the server's time\n", (-offset).Round(time.Second))
+	// If the offset was already known, the request was signed with (nearly)
+	// the server's time, so the rejection has another cause
+	change := offset - previous
+	return change >= time.Second || change <= -time.Second
+}
+
+// Records the server's time from the Date header of each response to a
+// request, along with the local time at which the response was received
+type serverTimeRecorder struct {
+	serverTime time.Time
+	received   time.Time
+}
+
+func (*serverTimeRecorder) ID() string {
+	return "v4x509.ServerTime"
+}
+
+func (recorder *serverTimeRecorder) HandleDeserialize(ctx context.Context, in middleware.DeserializeInput, next middleware.DeserializeHandler) (
+	out middleware.DeserializeOutput, metadata middleware.Metadata, err error,
+) {
+	out, metadata, err = next.HandleDeserialize(ctx, in)
+	if response, ok := out.RawResponse.(*smithyhttp.Response); ok {
+		recorder.received = time.Now()
+		recorder.serverTime, _ = http.ParseTime(response.Header.Get("Date"))
+	}
+	return out, metadata, err
+}
+
+// Adds the recorder to a client's middleware, ahead of the rest, so that it
+// sees every response, whether or not it's an error
+func (recorder *serverTimeRecorder) addTo(stack *middleware.Stack) error {
+	return stack.Deserialize.Add(recorder, middleware.Before)
+}
@@ -0,0 +1,92 @@
+package aws_signing_helper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/rolesanywhere-credential-helper/rolesanywhere/types"
+)
+
+func TestCredentialProcessClockSkew(t *testing.T) {
+	defer atomic.StoreInt64(&clockOffset, 0)
+	signer, err := GetFileSystemSigner("../tst/certs/ec-prime256v1-key.pem", "../tst/certs/ec-prime256v1-sha256-cert.pem", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+
+	// The server's clock is an hour ahead of the local one, and it rejects
+	// requests signed at a time too far from its own
+	serverOffset := time.Hour
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		serverTime := time.Now().Add(serverOffset)
+		w.Header().Set("Date", serverTime.UTC().Format(http.TimeFormat))
+		signedAt, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+		if err != nil || serverTime.Sub(signedAt) > maxClockSkew || signedAt.Sub(serverTime) > maxClockSkew {
+			w.Header().Set("X-Amzn-Errortype", "AccessDeniedException")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message": "Signature expired: ` + r.Header.Get("X-Amz-Date") + ` is now earlier than ` +
+				serverTime.Add(-maxClockSkew).UTC().Format("20060102T150405Z") + `"}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(mockedCreateSessionResponse))
+	}))
+	defer server.Close()
+
+	credentialsOpts := CredentialsOpts{
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	if _, err = GenerateCredentialsWithSigner(&credentialsOpts, signer); err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+	if requests != 2 {
+		t.Logf("Expected the request to be signed again once, got %d requests", requests)
+		t.Fail()
+	}
+	offset := time.Duration(atomic.LoadInt64(&clockOffset))
+	if offset < serverOffset-2*time.Second || offset > serverOffset+2*time.Second {
+		t.Logf("Expected a clock offset of about %s, got %s", serverOffset, offset)
+		t.Fail()
+	}
+
+	// The offset is remembered for subsequent requests
+	requests = 0
+	if _, err = GenerateCredentialsWithSigner(&credentialsOpts, signer); err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+	if requests != 1 {
+		t.Logf("Expected the remembered offset to be used, got %d requests", requests)
+		t.Fail()
+	}
+}
+
+func TestIsClockSkewError(t *testing.T) {
+	fixtures := []struct {
+		message  string
+		expected bool
+	}{
+		{"Signature expired: 20240101T000000Z is now earlier than 20240101T010000Z", true},
+		{"Signature not yet current: 20240101T010000Z is still later than 20240101T000500Z", true},
+		{"Untrusted certificate", false},
+	}
+	for _, fixture := range fixtures {
+		err := newResponseError(http.StatusForbidden, &types.AccessDeniedException{Message: aws.String(fixture.message)})
+		if isClockSkewError(err) != fixture.expected {
+			t.Logf("Unexpected result for %q", fixture.message)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package aws_signing_helper
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+const DefaultContainerPort = 9912
+
+const CONTAINER_CREDENTIALS_RESOURCE_PATH = "/v1/credentials"
+
+// Credentials served from the local endpoint, in the format of the
+// container credentials provider (as used on ECS and EKS)
+type ContainerCredentials struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	Token           string
+	Expiration      time.Time
+	RoleArn         string
+}
+
+// Handles GET requests to the container credentials endpoint, which have
+// to carry the authorization token in their Authorization header (as SDKs
+// send the one in AWS_CONTAINER_AUTHORIZATION_TOKEN, or in the file in
+// AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE)
+func ContainerCredentialsHandler(cred *RefreshableCred, authToken string, opts *CredentialsOpts, signer Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(authToken)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, "invalid authorization token provided")
+			return
+		}
+
+		current, err := currentCredentials(cred, opts, signer)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, "unable to obtain credentials")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(ContainerCredentials{
+			AccessKeyId:     current.AccessKeyId,
+			SecretAccessKey: current.SecretAccessKey,
+			Token:           current.Token,
+			Expiration:      current.Expiration,
+			RoleArn:         opts.RoleArn,
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, "failed to encode credentials")
+			return
+		}
+	}
+}
+
+// Obtains the first set of credentials (exiting if they can't be obtained),
+// and keeps them refreshed in the background (and reloaded on SIGHUP)
+func startRefreshingCredentials(credentialsOptions *CredentialsOpts) (Signer, *RefreshableCred) {
+	var refreshableCred = RefreshableCred{}
+
+	signer, err := GetSigner(credentialsOptions)
+	if err != nil {
+		log.Println(err)
+		syscall.Exit(1)
+	}
+	watchSigner(signer)
+
+	if err = refreshCredentials(&refreshableCred, credentialsOptions, signer); err != nil {
+		log.Println(err)
+		syscall.Exit(1)
+	}
+	go refreshCredentialsPeriodically(&refreshableCred, credentialsOptions, signer)
+	reloadCredentialsOnHangup(signer, []*RefreshableCred{&refreshableCred}, []*CredentialsOpts{credentialsOptions})
+	return signer, &refreshableCred
+}
+
+// Vends temporary credentials through an endpoint on localhost that
+// implements the container credentials provider, so that SDKs can obtain
+// them through AWS_CONTAINER_CREDENTIALS_FULL_URI. Requests have to carry
+// the given authorization token, or, if none is given, one that is
+// generated (and logged).
+func ServeContainerCredentials(port int, authToken string, credentialsOptions CredentialsOpts) {
+	generatedAuthToken := authToken == ""
+	if generatedAuthToken {
+		var err error
+		if authToken, err = GenerateToken(64); err != nil {
+			log.Println("unable to generate authorization token")
+			syscall.Exit(1)
+		}
+	}
+
+	signer, refreshableCred := startRefreshingCredentials(&credentialsOptions)
+	defer signer.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(CONTAINER_CREDENTIALS_RESOURCE_PATH, ContainerCredentialsHandler(refreshableCred, authToken, &credentialsOptions, signer))
+	registerMonitoringHandlers(mux, signer, []*RefreshableCred{refreshableCred})
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", LocalHostAddress, port))
+	if err != nil {
+		log.Println("failed to create listener")
+		syscall.Exit(1)
+	}
+	port = listener.Addr().(*net.TCPAddr).Port
+	log.Println("Local server started on port:", port)
+	log.Println("Make it available to the sdk by running:")
+	log.Printf("export AWS_CONTAINER_CREDENTIALS_FULL_URI=http://%s:%d%s", LocalHostAddress, port, CONTAINER_CREDENTIALS_RESOURCE_PATH)
+	if generatedAuthToken {
+		log.Printf("export AWS_CONTAINER_AUTHORIZATION_TOKEN=%s", authToken)
+	} else {
+		log.Println("and setting AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE to the path of the authorization token file")
+	}
+	notifySystemdReady()
+	if err := serveUntilTerminated(&http.Server{Handler: mux}, listener); err != nil {
+		log.Println("Httpserver: Serve() error")
+		syscall.Exit(1)
+	}
+}
@@ -0,0 +1,63 @@
+package aws_signing_helper
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContainerCredentialsHandler(t *testing.T) {
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	signer, err := GetSigner(&credentialsOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+	handler := ContainerCredentialsHandler(&RefreshableCred{}, "authorization-token", &credentialsOpts, signer)
+
+	fixtures := []struct {
+		authorization  string
+		expectedStatus int
+	}{
+		{"", http.StatusUnauthorized},
+		{"another-token", http.StatusUnauthorized},
+		{"authorization-token", http.StatusOK},
+	}
+	for _, fixture := range fixtures {
+		request := httptest.NewRequest("GET", CONTAINER_CREDENTIALS_RESOURCE_PATH, nil)
+		if fixture.authorization != "" {
+			request.Header.Set("Authorization", fixture.authorization)
+		}
+		recorder := httptest.NewRecorder()
+		handler(recorder, request)
+		if recorder.Code != fixture.expectedStatus {
+			t.Logf("unexpected status %d for authorization %q", recorder.Code, fixture.authorization)
+			t.Fail()
+			continue
+		}
+		if recorder.Code != http.StatusOK {
+			continue
+		}
+
+		var served ContainerCredentials
+		if err = json.NewDecoder(recorder.Body).Decode(&served); err != nil {
+			t.Fatal(err)
+		}
+		if served.AccessKeyId != "accessKeyId" || served.SecretAccessKey != "secretAccessKey" ||
+			served.Token != "sessionToken" || served.RoleArn != credentialsOpts.RoleArn {
+			t.Log("unexpected credentials served:", served)
+			t.Fail()
+		}
+	}
+}
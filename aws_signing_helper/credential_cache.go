@@ -0,0 +1,321 @@
+package aws_signing_helper
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Cached credentials are reused until this long before they expire
+const CacheRefreshTime = 5 * time.Minute
+
+// How long to wait for the process that holds the lock of a cache entry
+// (and is obtaining credentials for it) to release it, and how often to
+// check whether it has
+var (
+	CacheLockTimeout      = time.Minute
+	cacheLockPollInterval = 100 * time.Millisecond
+)
+
+// Directory in which credentials are cached, if no other is given:
+// `~/.aws/rolesanywhere/cache`
+func DefaultCacheDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".aws", "rolesanywhere", "cache"), nil
+}
+
+// Where credentials are cached: in files, or in the OS's secret store (the
+// Keychain on macOS, the Credential Manager on Windows, and the Secret
+// Service, through libsecret, on Linux)
+const (
+	CacheBackendFile     = "file"
+	CacheBackendKeychain = "keychain"
+)
+
+// Name under which credentials are kept in the OS's secret store
+const secretStoreService = "aws_signing_helper"
+
+// Returned by readSecret if there's no secret under the given key, as
+// opposed to the secret store failing (say, since it's locked)
+var errSecretNotFound = errors.New("secret not found")
+
+// Options of the credential cache
+type CacheOpts struct {
+	// Directory in which credentials (or, with the keychain backend, the
+	// locks of the cache entries) are kept (default: DefaultCacheDir())
+	Dir string
+	// CacheBackendFile (the default) or CacheBackendKeychain
+	Backend string
+	// How cached files are encrypted (CacheEncryptionTPM, CacheEncryptionDPAPI,
+	// or CacheEncryptionKeychain), if they are
+	Encryption string
+	// TPM with which to seal the encryption key (default: the platform's)
+	TpmDevice string
+}
+
+// Cache of credentials, by key. Each entry is read and written while
+// holding its lock.
+type credentialCache interface {
+	// Takes the lock of the entry with the given key, waiting for the process
+	// that holds it (if any) to release it, and returns the function that
+	// releases it
+	lock(key string) (func(), error)
+	// Returns the credentials cached under the given key, if there are any
+	get(key string) (CredentialProcessOutput, bool)
+	// Caches the credentials under the given key
+	put(key string, credentialProcessOutput CredentialProcessOutput) error
+}
+
+// Returns the credential cache that the options select
+func newCredentialCache(cacheOpts CacheOpts) (credentialCache, error) {
+	if cacheOpts.Dir == "" {
+		var err error
+		if cacheOpts.Dir, err = DefaultCacheDir(); err != nil {
+			return nil, errors.New("unable to locate the home directory, in which credentials are cached")
+		}
+	}
+	switch cacheOpts.Backend {
+	case "", CacheBackendFile:
+		cipher, err := newCacheCipher(cacheOpts)
+		if err != nil {
+			return nil, err
+		}
+		return fileCredentialCache{dir: cacheOpts.Dir, cipher: cipher}, nil
+	case CacheBackendKeychain:
+		// The secret stores already encrypt what they hold
+		if cacheOpts.Encryption != "" {
+			return nil, errors.New("cache encryption only applies to the file cache backend")
+		}
+		return keychainCredentialCache{fileCredentialCache{dir: cacheOpts.Dir}}, nil
+	}
+	return nil, fmt.Errorf("unknown cache backend %s (expected %s or %s)", cacheOpts.Backend, CacheBackendFile, CacheBackendKeychain)
+}
+
+// Credentials cached on disk, one file per key, in the format of the
+// credential process (or, if the cache is encrypted, encrypted with the
+// cipher). Each entry is guarded by a lock on a separate file, since the
+// cached file is replaced when it's written.
+type fileCredentialCache struct {
+	dir    string
+	cipher cacheCipher
+}
+
+// Returns the path of the file that caches the entry with the given key
+func (cache fileCredentialCache) path(key string) string {
+	if cache.cipher != nil {
+		return filepath.Join(cache.dir, key+".enc")
+	}
+	return filepath.Join(cache.dir, key+".json")
+}
+
+func (cache fileCredentialCache) lock(key string) (func(), error) {
+	if err := os.MkdirAll(cache.dir, 0700); err != nil {
+		return nil, err
+	}
+	lock, err := os.OpenFile(filepath.Join(cache.dir, key+".lock"), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	// The lock is polled for, rather than waited for, so that a process that
+	// hangs while holding it (say, waiting for a PIN) doesn't hang the others
+	// with it
+	deadline := time.Now().Add(CacheLockTimeout)
+	for {
+		locked, err := tryLockFile(lock)
+		if err != nil {
+			lock.Close()
+			return nil, err
+		}
+		if locked {
+			return func() {
+				unlockFile(lock)
+				lock.Close()
+			}, nil
+		}
+		if time.Now().After(deadline) {
+			lock.Close()
+			return nil, fmt.Errorf("timed out waiting for the lock of the cache entry %s", key)
+		}
+		time.Sleep(cacheLockPollInterval)
+	}
+}
+
+func (cache fileCredentialCache) get(key string) (CredentialProcessOutput, bool) {
+	var credentialProcessOutput CredentialProcessOutput
+	data, err := os.ReadFile(cache.path(key))
+	if err != nil {
+		return CredentialProcessOutput{}, false
+	}
+	if cache.cipher != nil {
+		if data, err = cache.cipher.open(data, []byte(key)); err != nil {
+			log.Println("unable to decrypt the cached credentials:", err)
+			return CredentialProcessOutput{}, false
+		}
+	}
+	return credentialProcessOutput, json.Unmarshal(data, &credentialProcessOutput) == nil
+}
+
+func (cache fileCredentialCache) put(key string, credentialProcessOutput CredentialProcessOutput) error {
+	if cache.cipher == nil {
+		return WriteCredentialProcessOutput(cache.path(key), credentialProcessOutput)
+	}
+	data, err := json.Marshal(credentialProcessOutput)
+	if err != nil {
+		return err
+	}
+	if data, err = cache.cipher.seal(data, []byte(key)); err != nil {
+		return fmt.Errorf("unable to encrypt the credentials: %w", err)
+	}
+	return writeFileAtomically(cache.path(key), data)
+}
+
+// Credentials cached in the OS's secret store, rather than in plaintext
+// files. The cache entries are still guarded by locks on files, since the
+// secret stores don't provide any.
+type keychainCredentialCache struct {
+	files fileCredentialCache
+}
+
+func (cache keychainCredentialCache) lock(key string) (func(), error) {
+	return cache.files.lock(key)
+}
+
+func (cache keychainCredentialCache) get(key string) (CredentialProcessOutput, bool) {
+	var credentialProcessOutput CredentialProcessOutput
+	data, err := readSecret(key)
+	if err != nil {
+		return CredentialProcessOutput{}, false
+	}
+	return credentialProcessOutput, json.Unmarshal(data, &credentialProcessOutput) == nil
+}
+
+func (cache keychainCredentialCache) put(key string, credentialProcessOutput CredentialProcessOutput) error {
+	data, err := json.Marshal(credentialProcessOutput)
+	if err != nil {
+		return err
+	}
+	return writeSecret(key, data)
+}
+
+// Returns the key under which the credentials obtained with the certificate
+// and the options are cached: a digest of the certificate and of all the
+// options that determine which credentials are obtained, so that different
+// certificates, roles, and profiles (or a rotated certificate) don't share
+// cached credentials
+func credentialCacheKey(opts *CredentialsOpts, certificate *x509.Certificate) (string, error) {
+	scope, err := json.Marshal(struct {
+		Certificate       []byte
+		RoleArn           string
+		ProfileArn        string
+		TrustAnchorArn    string
+		SessionDuration   int
+		RoleSessionName   string
+		SendDefaultName   bool
+		ChainedRoleArns   []string
+		SessionTags       []SessionTag
+		TransitiveTagKeys []string
+		ExternalId        string
+		SessionPolicy     string
+		PolicyArns        []string
+		SourceIdentity    string
+		ExpirationBuffer  int
+		Region            string
+		Endpoint          string
+	}{
+		certificate.Raw,
+		opts.RoleArn,
+		opts.ProfileArnStr,
+		opts.TrustAnchorArnStr,
+		opts.SessionDuration,
+		opts.RoleSessionName,
+		opts.SendDefaultName,
+		opts.ChainedRoleArns,
+		opts.SessionTags,
+		opts.TransitiveTagKeys,
+		opts.ExternalId,
+		opts.SessionPolicy,
+		opts.PolicyArns,
+		opts.SourceIdentity,
+		opts.ExpirationBuffer,
+		opts.Region,
+		opts.Endpoint,
+	})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(scope)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Whether cached credentials can still be used: they're reused until
+// shortly before they expire
+func isCacheable(credentialProcessOutput CredentialProcessOutput, now time.Time) bool {
+	expiration, err := time.Parse(time.RFC3339, credentialProcessOutput.Expiration)
+	return err == nil && expiration.Sub(now) > CacheRefreshTime
+}
+
+// Returns credentials from the cache that the options select that are
+// still valid, or else obtains new ones, and caches them. Since SDKs run the
+// credential process each time they need credentials, this saves a
+// CreateSession request (and a signature, which may be slow with a
+// hardware-backed key) for each of them. The cache entry's lock is held
+// while the credentials are obtained, so that, when many processes run at
+// the same time, only one of them sends a CreateSession request, and the
+// others wait for its credentials, rather than all of them being throttled.
+// Failing to use the cache isn't fatal.
+func GenerateCachedCredentials(opts *CredentialsOpts, cacheOpts CacheOpts) (CredentialProcessOutput, error) {
+	cache, err := newCredentialCache(cacheOpts)
+	if err != nil {
+		return CredentialProcessOutput{}, err
+	}
+
+	signer, err := GetSigner(opts)
+	if err != nil {
+		return CredentialProcessOutput{}, err
+	}
+	defer signer.Close()
+	certificate, err := signer.Certificate()
+	if err != nil {
+		return CredentialProcessOutput{}, err
+	}
+	key, err := credentialCacheKey(opts, certificate)
+	if err != nil {
+		return CredentialProcessOutput{}, err
+	}
+	unlock, err := cache.lock(key)
+	if err != nil {
+		log.Println("unable to use the credential cache:", err)
+		return GenerateCredentialsWithSigner(opts, signer)
+	}
+	defer unlock()
+	cached, ok := cache.get(key)
+	if ok && isCacheable(cached, time.Now()) {
+		return cached, nil
+	}
+
+	credentialProcessOutput, err := GenerateCredentialsWithSigner(opts, signer)
+	if err != nil {
+		// Cached credentials that are due to be replaced, but haven't expired
+		// yet, are still returned if new ones can't be obtained because of a
+		// transient failure
+		if expiration, parseErr := time.Parse(time.RFC3339, cached.Expiration); ok && parseErr == nil && time.Now().Before(expiration) && isTransientError(err) {
+			log.Printf("unable to obtain credentials (transient error), so the cached ones, which expire at %s, are returned: %v", cached.Expiration, err)
+			return cached, nil
+		}
+		return CredentialProcessOutput{}, err
+	}
+	if err = cache.put(key, credentialProcessOutput); err != nil {
+		log.Println("unable to cache the credentials:", err)
+	}
+	return credentialProcessOutput, nil
+}
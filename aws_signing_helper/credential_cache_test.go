@@ -0,0 +1,189 @@
+package aws_signing_helper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Returns a server that responds to CreateSession requests with credentials
+// that expire after the given duration, and counts the requests
+func getCountingCreateSessionServer(lifetime time.Duration, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		expiration := time.Now().Add(lifetime).UTC().Format(time.RFC3339)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(strings.Replace(mockedCreateSessionResponse, "2022-07-27T04:36:55Z", expiration, 1)))
+	}))
+}
+
+func TestGenerateCachedCredentials(t *testing.T) {
+	var requests int32
+	server := getCountingCreateSessionServer(time.Hour, &requests)
+	defer server.Close()
+	cacheDir := t.TempDir()
+
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	first, err := GenerateCachedCredentials(&credentialsOpts, CacheOpts{Dir: cacheDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := GenerateCachedCredentials(&credentialsOpts, CacheOpts{Dir: cacheDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&requests) != 1 || first != second {
+		t.Log("the cached credentials weren't reused:", requests, "requests")
+		t.Fail()
+	}
+
+	// A different role doesn't share the cached credentials
+	otherRoleOpts := credentialsOpts
+	otherRoleOpts.RoleArn = "arn:aws:iam::000000000000:role/OtherRole"
+	if _, err = GenerateCachedCredentials(&otherRoleOpts, CacheOpts{Dir: cacheDir}); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&requests) != 2 {
+		t.Log("cached credentials were reused for a different role")
+		t.Fail()
+	}
+}
+
+func TestExpiringCredentialsAreNotReused(t *testing.T) {
+	var requests int32
+	server := getCountingCreateSessionServer(CacheRefreshTime-time.Minute, &requests)
+	defer server.Close()
+	cacheDir := t.TempDir()
+
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := GenerateCachedCredentials(&credentialsOpts, CacheOpts{Dir: cacheDir}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if atomic.LoadInt32(&requests) != 2 {
+		t.Log("credentials that expire soon were reused")
+		t.Fail()
+	}
+}
+
+func TestStaleCachedCredentialsOnTransientError(t *testing.T) {
+	t.Setenv(MaxAttemptsEnvVarName, "1")
+	// The server issues credentials that are due to be replaced right away,
+	// and then fails with the given status
+	var requests int32
+	var failureStatus int32 = http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) > 1 {
+			w.WriteHeader(int(atomic.LoadInt32(&failureStatus)))
+			return
+		}
+		expiration := time.Now().Add(CacheRefreshTime - time.Minute).UTC().Format(time.RFC3339)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(strings.Replace(mockedCreateSessionResponse, "2022-07-27T04:36:55Z", expiration, 1)))
+	}))
+	defer server.Close()
+	cacheDir := t.TempDir()
+
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	first, err := GenerateCachedCredentials(&credentialsOpts, CacheOpts{Dir: cacheDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := GenerateCachedCredentials(&credentialsOpts, CacheOpts{Dir: cacheDir})
+	if err != nil || first != second {
+		t.Log("the cached credentials weren't returned after a transient error:", err)
+		t.Fail()
+	}
+
+	// Errors that retrying won't overcome are still returned
+	atomic.StoreInt32(&failureStatus, http.StatusForbidden)
+	if _, err = GenerateCachedCredentials(&credentialsOpts, CacheOpts{Dir: cacheDir}); err == nil {
+		t.Log("the cached credentials were returned after an access denied error")
+		t.Fail()
+	}
+}
+
+func TestUnknownCacheBackend(t *testing.T) {
+	if _, err := newCredentialCache(CacheOpts{Dir: t.TempDir(), Backend: "memory"}); err == nil {
+		t.Log("an unknown cache backend was accepted")
+		t.Fail()
+	}
+}
+
+func TestConcurrentCachedCredentials(t *testing.T) {
+	var requests int32
+	server := getCountingCreateSessionServer(time.Hour, &requests)
+	defer server.Close()
+	cacheDir := t.TempDir()
+
+	// Only one of the concurrent invocations sends a request, and the others
+	// reuse its credentials
+	errs := make(chan error)
+	for i := 0; i < 8; i++ {
+		go func() {
+			credentialsOpts := CredentialsOpts{
+				PrivateKeyId:      "../credential-process-data/client-key.pem",
+				CertificateId:     "../credential-process-data/client-cert.pem",
+				RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+				ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+				TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+				Endpoint:          server.URL,
+				SessionDuration:   900,
+			}
+			_, err := GenerateCachedCredentials(&credentialsOpts, CacheOpts{Dir: cacheDir})
+			errs <- err
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Log("concurrent invocations sent", requests, "requests")
+		t.Fail()
+	}
+}
+
+func TestCacheLockTimeout(t *testing.T) {
+	cache := fileCredentialCache{dir: t.TempDir()}
+	unlock, err := cache.lock("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	defer func(timeout time.Duration) { CacheLockTimeout = timeout }(CacheLockTimeout)
+	CacheLockTimeout = 300 * time.Millisecond
+	if _, err = cache.lock("key"); err == nil {
+		t.Log("took a lock that was already held")
+		t.Fail()
+	}
+}
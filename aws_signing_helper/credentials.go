@@ -1,130 +1,354 @@
 package aws_signing_helper
 
 import (
-	"crypto/tls"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
 	"crypto/x509"
-	"encoding/base64"
 	"errors"
+	"fmt"
+	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
 	"runtime"
+	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/arn"
-	"github.com/aws/aws-sdk-go/aws/request"
-	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/rolesanywhere-credential-helper/rolesanywhere"
+	"github.com/aws/rolesanywhere-credential-helper/rolesanywhere/types"
+	"github.com/aws/smithy-go/logging"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 )
 
 type CredentialsOpts struct {
-	PrivateKeyId        string
-	CertificateId       string
-	CertificateBundleId string
-	RoleArn             string
-	ProfileArnStr       string
-	TrustAnchorArnStr   string
-	SessionDuration     int
-	Region              string
-	Endpoint            string
-	NoVerifySSL         bool
-	WithProxy           bool
-	Debug               bool
-	Version             string
+	PrivateKeyId         string
+	CertificateId        string
+	CertificateBundleId  string
+	LibPkcs11            string
+	PinFile              string
+	TpmDevice            string
+	TpmKeyPassword       string
+	TpmKeyPasswordFile   string
+	KeyContainer         string
+	MachineKey           bool
+	CertStoreLocation    string
+	CertThumbprint       string
+	CertSubject          string
+	CertSelector         string
+	KeychainLabel        string
+	KeychainHash         string
+	SecureEnclaveKey     string
+	PivCard              string
+	PivSlot              string
+	PivPinPolicy         string
+	SSHAgentKey          string
+	GPGKeygrip           string
+	SignerCommand        string
+	SignerEndpoint       string
+	SignerKeyId          string
+	VaultAddr            string
+	VaultKey             string
+	VaultTransitMount    string
+	VaultRoleId          string
+	VaultSecretIdFile    string
+	VaultPKIMount        string
+	VaultPKIRole         string
+	VaultPKICommonName   string
+	VaultPKITTL          string
+	VaultPKICacheDir     string
+	AzureKeyVault        string
+	AzureCertificate     string
+	AzureClientId        string
+	GCPKMSKey            string
+	SPIFFESocket         string
+	SPIFFEId             string
+	Pkcs12Bundle         string
+	Keystore             string
+	KeystorePassword     string
+	KeystoreAlias        string
+	PassphraseFile       string
+	AgeIdentity          string
+	EnableEd25519        bool
+	SigningAlgorithm     string
+	Digest               string
+	FetchIntermediates   bool
+	ExpiryWarningDays    int
+	CheckRevocation      bool
+	RoleArn              string
+	ProfileArnStr        string
+	TrustAnchorArnStr    string
+	SessionDuration      int
+	RoleSessionName      string
+	SendDefaultName      bool
+	ChainedRoleArns      []string
+	SessionTags          []SessionTag
+	TransitiveTagKeys    []string
+	ExternalId           string
+	SessionPolicy        string
+	PolicyArns           []string
+	SourceIdentity       string
+	ExpirationBuffer     int
+	Region               string
+	Endpoint             string
+	FailoverTargets      []FailoverTarget
+	UseFIPSEndpoint      bool
+	UseDualStackEndpoint bool
+	NoVerifySSL          bool
+	CABundle             string
+	TLSMinVersion        string
+	TLSCipherSuites      []string
+	WithProxy            bool
+	ProxyURL             string
+	ProxyUser            string
+	ProxyPasswordFile    string
+	ProxyAuth            string
+	ConnectTimeout       time.Duration
+	TLSHandshakeTimeout  time.Duration
+	RequestTimeout       time.Duration
+	Debug                bool
+	Version              string
+	UserAgentAppId       string
+	UserAgentMetadata    []string
 }
 
 // Function to create session and generate credentials
 func GenerateCredentials(opts *CredentialsOpts) (CredentialProcessOutput, error) {
-	// assign values to region and endpoint if they haven't already been assigned
-	trustAnchorArn, err := arn.Parse(opts.TrustAnchorArnStr)
+	return GenerateCredentialsWithContext(context.Background(), opts)
+}
+
+// Function to create session and generate credentials, with requests that
+// are abandoned when the given context is done
+func GenerateCredentialsWithContext(ctx context.Context, opts *CredentialsOpts) (CredentialProcessOutput, error) {
+	signer, err := GetSigner(opts)
+	if err != nil {
+		return CredentialProcessOutput{}, err
+	}
+	defer signer.Close()
+	return generateCredentials(ctx, opts, signer)
+}
+
+// Function to create session and generate credentials, using a signer
+// that has already been created. Long-running modes use this to keep the
+// same signer (and any sessions it holds) across refreshes. If there are
+// chained roles, the credentials returned are those of the last one.
+func GenerateCredentialsWithSigner(opts *CredentialsOpts, signer Signer) (CredentialProcessOutput, error) {
+	return generateCredentials(context.Background(), opts, signer)
+}
+
+func generateCredentials(ctx context.Context, opts *CredentialsOpts, signer Signer) (CredentialProcessOutput, error) {
+	credentialProcessOutput, sessionOpts, err := createSessionWithFailover(ctx, opts, signer)
+	// The certificate may have been rotated (along with the trust anchor or
+	// the CRL that revokes it) after it was read, so it's read again, and the
+	// request retried once, if that produces a different certificate
+	if err != nil && isCertificateRejection(err) {
+		if reloadable, ok := signer.(reloadableSigner); ok && reloadable.reload() {
+			log.Println("retrying with the certificate that was read again, since the previous one was rejected:", err)
+			credentialProcessOutput, sessionOpts, err = createSessionWithFailover(ctx, opts, signer)
+		}
+	}
 	if err != nil {
 		return CredentialProcessOutput{}, err
 	}
-	profileArn, err := arn.Parse(opts.ProfileArnStr)
+	// Chained roles are assumed in the region that vended the credentials
+	credentialProcessOutput, err = assumeChainedRoles(ctx, sessionOpts, signer, credentialProcessOutput)
 	if err != nil {
 		return CredentialProcessOutput{}, err
 	}
+	return applyExpirationBuffer(opts, credentialProcessOutput)
+}
 
-	if trustAnchorArn.Region != profileArn.Region {
+// Reports the credentials as expiring the expiration buffer in the options
+// (in seconds) before they actually do, so that SDKs (and the long-running
+// modes) replace them early enough for applications that take a while to
+// use them not to have them expire mid-request
+func applyExpirationBuffer(opts *CredentialsOpts, credentialProcessOutput CredentialProcessOutput) (CredentialProcessOutput, error) {
+	if opts.ExpirationBuffer == 0 {
+		return credentialProcessOutput, nil
+	}
+	if opts.ExpirationBuffer < 0 {
+		return CredentialProcessOutput{}, fmt.Errorf("invalid expiration buffer %d (expected a number of seconds)", opts.ExpirationBuffer)
+	}
+	expiration, err := time.Parse(time.RFC3339, credentialProcessOutput.Expiration)
+	if err != nil {
 		return CredentialProcessOutput{}, err
 	}
+	expiration = expiration.Add(-time.Duration(opts.ExpirationBuffer) * time.Second)
+	if !expiration.After(time.Now()) {
+		return CredentialProcessOutput{}, fmt.Errorf("the expiration buffer (%d seconds) isn't shorter than the lifetime of the credentials (which expire at %s)", opts.ExpirationBuffer, credentialProcessOutput.Expiration)
+	}
+	credentialProcessOutput.Expiration = expiration.UTC().Format(time.RFC3339)
+	return credentialProcessOutput, nil
+}
+
+// Whether IAM Roles Anywhere rejected the request (or would, since the
+// certificate has been revoked) in a way that a stale certificate can cause
+func isCertificateRejection(err error) bool {
+	if errors.Is(err, ErrCertificateRevoked) {
+		return true
+	}
+	var accessDeniedErr *types.AccessDeniedException
+	var validationErr *types.ValidationException
+	if errors.As(err, &accessDeniedErr) || errors.As(err, &validationErr) {
+		return true
+	}
+	var responseErr *smithyhttp.ResponseError
+	return errors.As(err, &responseErr) && responseErr.HTTPStatusCode() == http.StatusForbidden
+}
+
+// Whether obtaining credentials failed in a way that retrying may overcome:
+// the endpoint couldn't be reached, failed, or throttled the request.
+// Previously issued credentials keep being used after such failures, while
+// they're still valid. So do requests that the circuit breaker holds back.
+func isTransientError(err error) bool {
+	if errors.Is(err, ErrCircuitOpen) {
+		return true
+	}
+	isThrottle := retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err) == aws.TrueTernary
+	// Requests that weren't sent come with a ResponseError too, but without a
+	// status
+	var responseErr *smithyhttp.ResponseError
+	if errors.As(err, &responseErr) && responseErr.HTTPStatusCode() != 0 {
+		return responseErr.HTTPStatusCode() >= http.StatusInternalServerError ||
+			responseErr.HTTPStatusCode() == http.StatusTooManyRequests ||
+			isThrottle
+	}
+	if isThrottle || retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
 
-	if opts.Region == "" {
-		opts.Region = trustAnchorArn.Region
+// Returns the region in which credentials are obtained with the options: the
+// one that they set, or, if they don't, that of the (primary) trust anchor.
+// Obtaining credentials doesn't fill it in in the options, so the commands
+// that pass it on along with the credentials get it from this.
+func CredentialsRegion(opts *CredentialsOpts) (string, error) {
+	if opts.Region != "" {
+		return opts.Region, nil
 	}
+	trustAnchorArn, err := arn.Parse(opts.TrustAnchorArnStr)
+	if err != nil {
+		return "", err
+	}
+	return trustAnchorArn.Region, nil
+}
 
-	privateKey, err := ReadPrivateKeyData(opts.PrivateKeyId)
+func generateCredentialsWithSigner(ctx context.Context, opts *CredentialsOpts, signer Signer) (CredentialProcessOutput, error) {
+	// The region (and the partition, in which the endpoint is resolved) is
+	// that of the ARNs, unless the options set it, and the ARNs have to agree
+	// on it
+	if err := validateArns(opts); err != nil {
+		return CredentialProcessOutput{}, err
+	}
+	region, err := CredentialsRegion(opts)
 	if err != nil {
 		return CredentialProcessOutput{}, err
 	}
-	certificateData, err := ReadCertificateData(opts.CertificateId)
+	opts.Region = region
+	endpointURL, err := rolesAnywhereEndpoint(opts)
 	if err != nil {
 		return CredentialProcessOutput{}, err
 	}
-	certificateDerData, err := base64.StdEncoding.DecodeString(certificateData.CertificateData)
+
+	certificate, err := signer.Certificate()
 	if err != nil {
 		return CredentialProcessOutput{}, err
 	}
-	certificate, err := x509.ParseCertificate([]byte(certificateDerData))
+	if err = checkCertificateValidity(certificate, opts.ExpiryWarningDays, time.Now()); err != nil {
+		return CredentialProcessOutput{}, err
+	}
+	digest, err := checkSigningOptions(opts, signer, certificate)
 	if err != nil {
 		return CredentialProcessOutput{}, err
 	}
-	var certificateChain []x509.Certificate
-	if opts.CertificateBundleId != "" {
-		certificateChainPointers, err := ReadCertificateBundleData(opts.CertificateBundleId)
-		if err != nil {
+	certificateChainPointers, err := signer.CertificateChain()
+	if err != nil {
+		return CredentialProcessOutput{}, err
+	}
+	certificateChainPointers = orderCertificateChain(certificate, certificateChainPointers)
+	if opts.FetchIntermediates {
+		certificateChainPointers = fetchMissingIntermediates(certificate, certificateChainPointers)
+	}
+	if opts.CheckRevocation {
+		if err = checkRevocation(certificate, certificateChainPointers); err != nil {
 			return CredentialProcessOutput{}, err
 		}
-		for _, certificate := range certificateChainPointers {
-			certificateChain = append(certificateChain, *certificate)
-		}
 	}
-
-	mySession := session.Must(session.NewSession())
-
-	var logLevel aws.LogLevelType
-	if opts.Debug {
-		logLevel = aws.LogDebug
-	} else {
-		logLevel = aws.LogOff
+	var certificateChain []x509.Certificate
+	for _, certificate := range certificateChainPointers {
+		certificateChain = append(certificateChain, *certificate)
+	}
+	certificateData := certificateToString(*certificate)
+	sessionName, explicitSessionName, err := roleSessionName(opts, certificate)
+	if err != nil {
+		return CredentialProcessOutput{}, err
 	}
 
-	var tr *http.Transport
-	if opts.WithProxy {
-		tr = &http.Transport{
-			TLSClientConfig: &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: opts.NoVerifySSL},
-			Proxy:           http.ProxyFromEnvironment,
-		}
-	} else {
-		tr = &http.Transport{
-			TLSClientConfig: &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: opts.NoVerifySSL},
-		}
+	retryer, err := newRetryer()
+	if err != nil {
+		return CredentialProcessOutput{}, err
+	}
+	httpClient, err := createHTTPClient(opts)
+	if err != nil {
+		return CredentialProcessOutput{}, err
+	}
+	userAgent, err := addToUserAgent(opts, fmt.Sprintf("CredHelper/%s (%s; %s; %s)", opts.Version, runtime.Version(), runtime.GOOS, runtime.GOARCH))
+	if err != nil {
+		return CredentialProcessOutput{}, err
+	}
+	// The server's time is recorded from the response, so that a request that
+	// was rejected because the local clock is off can be signed again
+	var serverTime serverTimeRecorder
+	options := rolesanywhere.Options{
+		APIOptions:   []func(*middleware.Stack) error{userAgent, serverTime.addTo},
+		BaseEndpoint: aws.String(endpointURL.String()),
+		HTTPClient:   httpClient,
+		HTTPSignerV4: RolesAnywhereSigner{signer, *certificate, certificateChain, opts.SigningAlgorithm, digest},
+		Region:       opts.Region,
+		Retryer:      retryer,
 	}
-	client := &http.Client{Transport: tr}
-	config := aws.NewConfig().WithRegion(opts.Region).WithHTTPClient(client).WithLogLevel(logLevel)
-	if opts.Endpoint != "" {
-		config.WithEndpoint(opts.Endpoint)
+	if opts.Debug {
+		options.ClientLogMode = aws.LogRequestWithBody | aws.LogResponseWithBody | aws.LogRetries
+		options.Logger = logging.NewStandardLogger(os.Stderr)
 	}
-	rolesAnywhereClient := rolesanywhere.New(mySession, config)
-	rolesAnywhereClient.Handlers.Build.RemoveByName("core.SDKVersionUserAgentHandler")
-	rolesAnywhereClient.Handlers.Build.PushBackNamed(request.NamedHandler{Name: "v4x509.CredHelperUserAgentHandler", Fn: request.MakeAddToUserAgentHandler("CredHelper", opts.Version, runtime.Version(), runtime.GOOS, runtime.GOARCH)})
-	rolesAnywhereClient.Handlers.Sign.Clear()
-	rolesAnywhereClient.Handlers.Sign.PushBackNamed(request.NamedHandler{Name: "v4x509.SignRequestHandler", Fn: CreateSignFunction(privateKey, *certificate, certificateChain)})
+	rolesAnywhereClient := rolesanywhere.New(options)
 
-	durationSeconds := int64(opts.SessionDuration)
 	createSessionRequest := rolesanywhere.CreateSessionInput{
-		Cert:               &certificateData.CertificateData,
-		ProfileArn:         &opts.ProfileArnStr,
-		TrustAnchorArn:     &opts.TrustAnchorArnStr,
-		DurationSeconds:    &(durationSeconds),
-		InstanceProperties: nil,
-		RoleArn:            &opts.RoleArn,
-		SessionName:        nil,
+		Cert:            &certificateData,
+		ProfileArn:      &opts.ProfileArnStr,
+		TrustAnchorArn:  &opts.TrustAnchorArnStr,
+		DurationSeconds: aws.Int32(int32(opts.SessionDuration)),
+		RoleArn:         &opts.RoleArn,
+	}
+	// IAM Roles Anywhere rejects role session names unless the profile
+	// accepts them, so the default one is only sent if the options ask for it
+	if explicitSessionName || opts.SendDefaultName {
+		createSessionRequest.SessionName = &sessionName
+	}
+	createSession := func() (*rolesanywhere.CreateSessionOutput, error) {
+		start := time.Now()
+		output, err := rolesAnywhereClient.CreateSession(ctx, &createSessionRequest)
+		observeCreateSession(time.Since(start), err)
+		return output, err
+	}
+	output, err := createSession()
+	if err != nil && compensateClockSkew(err, serverTime.serverTime, serverTime.received) {
+		output, err = createSession()
 	}
-	output, err := rolesAnywhereClient.CreateSession(&createSessionRequest)
 	if err != nil {
 		return CredentialProcessOutput{}, err
 	}
 
-	if len(output.CredentialSet) == 0 {
+	if len(output.CredentialSet) == 0 || output.CredentialSet[0].Credentials == nil {
 		msg := "unable to obtain temporary security credentials from CreateSession"
 		return CredentialProcessOutput{}, errors.New(msg)
 	}
@@ -138,3 +362,226 @@ func GenerateCredentials(opts *CredentialsOpts) (CredentialProcessOutput, error)
 	}
 	return credentialProcessOutput, nil
 }
+
+// Creates the transport through which requests are sent to IAM Roles
+// Anywhere, through the proxy in the environment if the options ask for it
+func createTransport(opts *CredentialsOpts) (*http.Transport, error) {
+	dialer := &net.Dialer{
+		Timeout:   timeoutOrDefault(opts.ConnectTimeout, DefaultConnectTimeout),
+		KeepAlive: 30 * time.Second,
+	}
+	tlsConfig, err := newTLSConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	transport := &http.Transport{
+		TLSClientConfig:     tlsConfig,
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: timeoutOrDefault(opts.TLSHandshakeTimeout, DefaultTLSHandshakeTimeout),
+	}
+	transport.Proxy = proxyFunc(opts)
+	if opts.ProxyAuth == ProxyAuthNTLM {
+		transport.DialContext = ntlmProxyDialer{proxy: transport.Proxy, dial: dialer.DialContext}.DialContext
+		transport.Proxy = nil
+	}
+	return transport, nil
+}
+
+// Environment variable that holds the path of the CA bundle against which
+// the endpoint's certificate is verified, as with the AWS CLI and SDKs
+const CABundleEnvVarName = "AWS_CA_BUNDLE"
+
+// Returns the pool of the CA certificates in the PEM bundle at the given
+// path, which replace the system's, so that the endpoint can be reached
+// through a proxy that intercepts TLS with a corporate CA
+func loadCABundle(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("the CA bundle %s holds no PEM certificates", path)
+	}
+	return pool, nil
+}
+
+// Returns the function that selects the proxy through which to connect to
+// the endpoint: the one in the options, or else the one that the
+// environment (HTTPS_PROXY, HTTP_PROXY, and NO_PROXY) selects, if any.
+// WithProxy is no longer needed for the environment to be honored. The
+// credentials of the proxy user in the options, if there's one, replace
+// those in the proxy's URL.
+func proxyFunc(opts *CredentialsOpts) func(*http.Request) (*url.URL, error) {
+	if err := checkProxyAuth(opts); err != nil {
+		return func(*http.Request) (*url.URL, error) {
+			return nil, err
+		}
+	}
+	selectProxy := http.ProxyFromEnvironment
+	if opts.ProxyURL != "" {
+		proxyURL, err := ParseProxyURL(opts.ProxyURL)
+		selectProxy = func(*http.Request) (*url.URL, error) {
+			return proxyURL, err
+		}
+	}
+	if opts.ProxyUser == "" {
+		return selectProxy
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		proxyURL, err := selectProxy(req)
+		if err != nil || proxyURL == nil {
+			return proxyURL, err
+		}
+		user, err := proxyUserinfo(opts)
+		if err != nil {
+			return nil, err
+		}
+		authenticated := *proxyURL
+		authenticated.User = user
+		return &authenticated, nil
+	}
+}
+
+// Parses the URL of a proxy (http://, https://, or socks5://, defaulting to
+// http:// if there's no scheme), which may hold the credentials with which
+// to authenticate to it (user:password@, percent-encoded)
+func ParseProxyURL(value string) (*url.URL, error) {
+	if !strings.Contains(value, "://") {
+		value = "http://" + value
+	}
+	proxyURL, err := url.Parse(value)
+	if err != nil || proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %s", value)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+		return proxyURL, nil
+	}
+	return nil, fmt.Errorf("unsupported proxy scheme %s (expected http, https, or socks5)", proxyURL.Scheme)
+}
+
+// Returns the client through which requests to AWS are sent, which gives up
+// on each attempt after the request timeout (and its retries are then
+// subject to the retry mode)
+func createHTTPClient(opts *CredentialsOpts) (*http.Client, error) {
+	transport, err := createTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeoutOrDefault(opts.RequestTimeout, DefaultRequestTimeout),
+	}, nil
+}
+
+// Timeouts of requests to AWS, unless the options set others: for
+// connecting to the endpoint, for the TLS handshake, and for each attempt at
+// a request in all (including reading the response)
+const (
+	DefaultConnectTimeout      = 10 * time.Second
+	DefaultTLSHandshakeTimeout = 10 * time.Second
+	DefaultRequestTimeout      = 60 * time.Second
+)
+
+func timeoutOrDefault(timeout time.Duration, defaultTimeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return defaultTimeout
+	}
+	return timeout
+}
+
+// Checks that the signer can sign requests as the options ask (with the
+// signature scheme and digest that they select), and returns the digest
+func checkSigningOptions(opts *CredentialsOpts, signer Signer, certificate *x509.Certificate) (crypto.Hash, error) {
+	// Ed25519 signatures are only sent when they're explicitly enabled, since
+	// IAM Roles Anywhere doesn't accept Ed25519 trust anchors yet
+	if _, ok := certificate.PublicKey.(ed25519.PublicKey); ok && !opts.EnableEd25519 {
+		return 0, errors.New("Ed25519 certificates aren't supported by IAM Roles Anywhere yet (pass --enable-ed25519 to use them anyway)")
+	}
+	switch opts.SigningAlgorithm {
+	case "", SigningAlgorithmPKCS1v15:
+	case SigningAlgorithmPSS:
+		if _, ok := certificate.PublicKey.(*rsa.PublicKey); !ok {
+			return 0, errors.New("RSASSA-PSS signatures require an RSA key")
+		}
+		if pssSigner, ok := signer.(pssSigner); !ok || !pssSigner.supportsPSS() {
+			return 0, errors.New("RSASSA-PSS signatures aren't supported with this key source")
+		}
+	case SigningAlgorithmRFC6979:
+		if _, ok := certificate.PublicKey.(*ecdsa.PublicKey); !ok {
+			return 0, errors.New("deterministic ECDSA signatures require an ECDSA key")
+		}
+		if deterministicSigner, ok := signer.(deterministicECDSASigner); !ok || !deterministicSigner.supportsDeterministicECDSA() {
+			return 0, errors.New("deterministic ECDSA signatures aren't supported with this key source")
+		}
+	default:
+		return 0, errors.New("unsupported signing algorithm " + opts.SigningAlgorithm + " (expected pkcs1v15, pss, or rfc6979)")
+	}
+	return signingDigest(opts.Digest, certificate.PublicKey)
+}
+
+// Checks that the certificate is currently valid, since IAM Roles Anywhere
+// would otherwise reject it with a less helpful error, and warns when it
+// expires within the given number of days (if that's not zero)
+func checkCertificateValidity(certificate *x509.Certificate, warningDays int, now time.Time) error {
+	if now.After(certificate.NotAfter) {
+		return fmt.Errorf("the certificate %s (serial number %s) expired on %s; renew it, or point the helper at the renewed certificate",
+			certificate.Subject, certificate.SerialNumber, certificate.NotAfter.Format(time.RFC3339))
+	}
+	if now.Before(certificate.NotBefore) {
+		return fmt.Errorf("the certificate %s (serial number %s) isn't valid until %s; check that the system clock is correct",
+			certificate.Subject, certificate.SerialNumber, certificate.NotBefore.Format(time.RFC3339))
+	}
+	if warningDays > 0 {
+		if remaining := certificate.NotAfter.Sub(now); remaining < time.Duration(warningDays)*24*time.Hour {
+			log.Printf("warning: the certificate %s (serial number %s) expires in %.1f days, on %s",
+				certificate.Subject, certificate.SerialNumber, remaining.Hours()/24, certificate.NotAfter.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// Finds the digest with which requests are signed. For ECDSA keys, it's the
+// one that matches the size of the curve (SHA256 for P-256, SHA384 for
+// P-384, and SHA512 for P-521), and a digest that's chosen has to be that
+// one; RSA keys sign with SHA256, unless SHA384 or SHA512 is chosen. "auto"
+// picks the default. Since Ed25519 signatures don't use a separate digest,
+// none can be chosen for Ed25519 keys.
+func signingDigest(digestName string, publicKey crypto.PublicKey) (crypto.Hash, error) {
+	if _, ok := publicKey.(ed25519.PublicKey); ok {
+		if digestName != "" {
+			return 0, errors.New("a digest can't be chosen for Ed25519 keys")
+		}
+		return crypto.SHA256, nil
+	}
+	defaultDigest := crypto.SHA256
+	ecdsaPublicKey, isECDSA := publicKey.(*ecdsa.PublicKey)
+	if isECDSA {
+		switch bitSize := ecdsaPublicKey.Curve.Params().BitSize; {
+		case bitSize > 384:
+			defaultDigest = crypto.SHA512
+		case bitSize > 256:
+			defaultDigest = crypto.SHA384
+		}
+	}
+
+	var digest crypto.Hash
+	switch strings.ToUpper(strings.ReplaceAll(digestName, "-", "")) {
+	case "", "AUTO":
+		return defaultDigest, nil
+	case "SHA256":
+		digest = crypto.SHA256
+	case "SHA384":
+		digest = crypto.SHA384
+	case "SHA512":
+		digest = crypto.SHA512
+	default:
+		return 0, errors.New("unsupported digest " + digestName + " (expected SHA256, SHA384, SHA512, or auto)")
+	}
+	if isECDSA && digest != defaultDigest {
+		return 0, fmt.Errorf("the %s digest doesn't match the certificate's %s key (expected %s)",
+			signingDigestNames[digest], ecdsaPublicKey.Curve.Params().Name, signingDigestNames[defaultDigest])
+	}
+	return digest, nil
+}
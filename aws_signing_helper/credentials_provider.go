@@ -0,0 +1,65 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Source that credentials obtained from IAM Roles Anywhere report
+const CredentialsSource = "RolesAnywhere"
+
+// Provider of credentials, obtained from IAM Roles Anywhere with the given
+// options, for the clients of aws-sdk-go-v2, so that Go applications can
+// use the helper as a library rather than through credential_process. The
+// provider obtains new credentials each time they're retrieved, so it's
+// meant to be wrapped in an aws.CredentialsCache, which only retrieves them
+// again when they're about to expire.
+type RolesAnywhereCredentialsProvider struct {
+	opts CredentialsOpts
+}
+
+// Returns a provider of credentials obtained with the given options, which
+// are copied, so later changes to them don't affect the provider
+func NewRolesAnywhereCredentialsProvider(opts CredentialsOpts) *RolesAnywhereCredentialsProvider {
+	return &RolesAnywhereCredentialsProvider{opts: opts}
+}
+
+// Obtains credentials from IAM Roles Anywhere (assuming the chained roles
+// in the options, if there are any), which expire when those that it
+// vended do
+func (p *RolesAnywhereCredentialsProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	credentialProcessOutput, expiration, err := retrieveCredentials(ctx, p.opts)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	return aws.Credentials{
+		AccessKeyID:     credentialProcessOutput.AccessKeyId,
+		SecretAccessKey: credentialProcessOutput.SecretAccessKey,
+		SessionToken:    credentialProcessOutput.SessionToken,
+		Source:          CredentialsSource,
+		CanExpire:       true,
+		Expires:         expiration,
+	}, nil
+}
+
+// Obtains credentials with the given options, for the providers, and
+// returns them along with when they expire
+func retrieveCredentials(ctx context.Context, opts CredentialsOpts) (CredentialProcessOutput, time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return CredentialProcessOutput{}, time.Time{}, err
+	}
+	// Obtaining credentials may fill in the options (such as the region), so
+	// each retrieval gets its own copy, and concurrent ones don't race
+	credentialProcessOutput, err := GenerateCredentialsWithContext(ctx, &opts)
+	if err != nil {
+		return CredentialProcessOutput{}, time.Time{}, err
+	}
+	expiration, err := time.Parse(time.RFC3339, credentialProcessOutput.Expiration)
+	if err != nil {
+		return CredentialProcessOutput{}, time.Time{}, fmt.Errorf("invalid expiration of the credentials: %w", err)
+	}
+	return credentialProcessOutput, expiration, nil
+}
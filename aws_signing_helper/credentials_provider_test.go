@@ -0,0 +1,116 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestRolesAnywhereCredentialsProvider(t *testing.T) {
+	var requests int32
+	server := getCountingCreateSessionServer(time.Hour, &requests)
+	defer server.Close()
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	provider := aws.NewCredentialsCache(NewRolesAnywhereCredentialsProvider(credentialsOpts))
+
+	first, err := provider.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.AccessKeyID != "accessKeyId" || first.SecretAccessKey != "secretAccessKey" || first.SessionToken != "sessionToken" ||
+		!first.CanExpire || time.Until(first.Expires) < 59*time.Minute || first.Source != CredentialsSource {
+		t.Log("unexpected credentials:", first)
+		t.Fail()
+	}
+	// The cache keeps the credentials until they're about to expire
+	if second, err := provider.Retrieve(context.Background()); err != nil || second != first || atomic.LoadInt32(&requests) != 1 {
+		t.Log("the credentials weren't cached:", err)
+		t.Fail()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewRolesAnywhereCredentialsProvider(credentialsOpts).Retrieve(ctx); err == nil || atomic.LoadInt32(&requests) != 1 {
+		t.Log("credentials were obtained with a canceled context")
+		t.Fail()
+	}
+}
+
+// Returns a server that holds requests until they're abandoned (or for at
+// most 10 seconds, so that tests fail rather than hang), after signalling
+// that one was received
+func getHangingServer(received chan<- struct{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server only notices that the client went away once it's read
+		// the request
+		io.Copy(io.Discard, r.Body)
+		received <- struct{}{}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+}
+
+func TestRolesAnywhereCredentialsProviderCancellation(t *testing.T) {
+	t.Setenv(MaxAttemptsEnvVarName, "1")
+	received := make(chan struct{}, 1)
+	server := getHangingServer(received)
+	defer server.Close()
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+
+	// Canceling the context abandons the request that's in flight
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-received
+		cancel()
+	}()
+	start := time.Now()
+	if _, err := NewRolesAnywhereCredentialsProvider(credentialsOpts).Retrieve(ctx); !errors.Is(err, context.Canceled) || time.Since(start) > 5*time.Second {
+		t.Log("the request in flight wasn't abandoned:", err)
+		t.Fail()
+	}
+
+	// So does canceling it while a chained role is being assumed
+	createSessionServer := GetMockedCreateSessionResponseServer()
+	defer createSessionServer.Close()
+	stsServer := getHangingServer(received)
+	defer stsServer.Close()
+	stsEndpoint = stsServer.URL
+	defer func() { stsEndpoint = "" }()
+	credentialsOpts.Endpoint = createSessionServer.URL
+	credentialsOpts.ChainedRoleArns = []string{"arn:aws:iam::000000000000:role/Hub"}
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		<-received
+		cancel()
+	}()
+	start = time.Now()
+	if _, err := NewRolesAnywhereCredentialsProvider(credentialsOpts).Retrieve(ctx); !errors.Is(err, context.Canceled) || time.Since(start) > 5*time.Second {
+		t.Log("the AssumeRole request in flight wasn't abandoned:", err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,189 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Types of keys that can be generated (for CSRs)
+const (
+	KeyTypeP256    = "p256"
+	KeyTypeP384    = "p384"
+	KeyTypeRSA2048 = "rsa2048"
+)
+
+// Attributes that can appear in the subject of a CSR, by their short names
+var subjectAttributeOIDs = map[string]asn1.ObjectIdentifier{
+	"CN":           {2, 5, 4, 3},
+	"SERIALNUMBER": {2, 5, 4, 5},
+	"C":            {2, 5, 4, 6},
+	"L":            {2, 5, 4, 7},
+	"ST":           {2, 5, 4, 8},
+	"STREET":       {2, 5, 4, 9},
+	"O":            {2, 5, 4, 10},
+	"OU":           {2, 5, 4, 11},
+	"POSTALCODE":   {2, 5, 4, 17},
+	"DC":           {0, 9, 2342, 19200300, 100, 1, 25},
+	"UID":          {0, 9, 2342, 19200300, 100, 1, 1},
+}
+
+// Creates a PEM-encoded certificate signing request for the signer's key,
+// with the given common name as its subject
+func CreateCertificateRequest(signer crypto.Signer, commonName string) ([]byte, error) {
+	return createCertificateRequest(signer, pkix.Name{CommonName: commonName}, nil)
+}
+
+// Creates a PEM-encoded certificate signing request for the signer's key,
+// with the given subject (a distinguished name, such as
+// "CN=host.example.com,O=Example") and subject alternative names (DNS
+// names, IP addresses, email addresses, or URIs)
+func CreateCertificateRequestWithSubject(signer crypto.Signer, subject string, subjectAltNames []string) ([]byte, error) {
+	name, err := ParseSubject(subject)
+	if err != nil {
+		return nil, err
+	}
+	return createCertificateRequest(signer, name, subjectAltNames)
+}
+
+func createCertificateRequest(signer crypto.Signer, subject pkix.Name, subjectAltNames []string) ([]byte, error) {
+	template := &x509.CertificateRequest{
+		Subject: subject,
+	}
+	if err := addSubjectAltNames(template, subjectAltNames); err != nil {
+		return nil, err
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, signer)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
+
+// Parses a distinguished name of the form "CN=host.example.com,O=Example".
+// Attributes are listed from the most specific to the least specific one,
+// as in the output of `openssl x509 -subject -nameopt RFC2253`, and commas
+// within values have to be escaped with a backslash.
+func ParseSubject(subject string) (pkix.Name, error) {
+	var name pkix.Name
+	var parts []string
+	var part strings.Builder
+	escaped := false
+	for _, c := range subject {
+		switch {
+		case escaped:
+			part.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == ',':
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteRune(c)
+		}
+	}
+	parts = append(parts, part.String())
+
+	// The RDNs are encoded from the least specific to the most specific one
+	for i := len(parts) - 1; i >= 0; i-- {
+		if strings.TrimSpace(parts[i]) == "" {
+			continue
+		}
+		key, value, found := strings.Cut(parts[i], "=")
+		if !found {
+			return pkix.Name{}, fmt.Errorf("invalid subject attribute: %s", parts[i])
+		}
+		oid, ok := subjectAttributeOIDs[strings.ToUpper(strings.TrimSpace(key))]
+		if !ok {
+			return pkix.Name{}, fmt.Errorf("unsupported subject attribute: %s", key)
+		}
+		name.ExtraNames = append(name.ExtraNames, pkix.AttributeTypeAndValue{Type: oid, Value: strings.TrimSpace(value)})
+	}
+	if len(name.ExtraNames) == 0 {
+		return pkix.Name{}, errors.New("the subject doesn't contain any attributes")
+	}
+	return name, nil
+}
+
+// Adds subject alternative names to a CSR template, according to their
+// form: IP addresses, URIs (such as SPIFFE IDs), email addresses, and
+// otherwise, DNS names
+func addSubjectAltNames(template *x509.CertificateRequest, subjectAltNames []string) error {
+	for _, san := range subjectAltNames {
+		san = strings.TrimSpace(san)
+		if san == "" {
+			continue
+		}
+		if ip := net.ParseIP(san); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if strings.Contains(san, "://") {
+			uri, err := url.Parse(san)
+			if err != nil {
+				return fmt.Errorf("invalid URI: %s", san)
+			}
+			template.URIs = append(template.URIs, uri)
+		} else if strings.Contains(san, "@") {
+			template.EmailAddresses = append(template.EmailAddresses, san)
+		} else {
+			template.DNSNames = append(template.DNSNames, san)
+		}
+	}
+	return nil
+}
+
+// Generates a software key of the given type, and writes it, as an
+// unencrypted PKCS#8 PEM file that only the current user can read, to the
+// given path (which mustn't exist yet)
+func GenerateSoftwareKey(keyType string, privateKeyId string) (crypto.Signer, error) {
+	var privateKey crypto.Signer
+	var err error
+	switch strings.ToLower(keyType) {
+	case KeyTypeP256, "":
+		privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyTypeP384:
+		privateKey, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyTypeRSA2048:
+		privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", keyType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	if err = writeNewFile(privateKeyId, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})); err != nil {
+		return nil, err
+	}
+	return privateKey, nil
+}
+
+// Writes data to a file that only the current user can read, failing if the
+// file already exists rather than overwriting (say) an existing key
+func writeNewFile(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+	return file.Close()
+}
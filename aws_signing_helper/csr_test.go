@@ -0,0 +1,126 @@
+package aws_signing_helper
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSubject(t *testing.T) {
+	fixtures := []struct {
+		subject  string
+		expected string
+		valid    bool
+	}{
+		{"CN=host.example.com", "CN=host.example.com", true},
+		{"CN=host.example.com, O=Example, C=US", "CN=host.example.com,O=Example,C=US", true},
+		{`CN=host,O=Example\, Inc.`, `CN=host,O=Example\, Inc.`, true},
+		{"cn=host,ou=Operations,st=Washington", "CN=host,OU=Operations,ST=Washington", true},
+		{"CN=host,X=unknown", "", false},
+		{"host.example.com", "", false},
+		{"", "", false},
+	}
+	for _, fixture := range fixtures {
+		name, err := ParseSubject(fixture.subject)
+		if fixture.valid && (err != nil || name.String() != fixture.expected) {
+			t.Logf("Expected %q to be parsed as %q, got %q (%v)", fixture.subject, fixture.expected, name.String(), err)
+			t.Fail()
+		} else if !fixture.valid && err == nil {
+			t.Logf("Expected %q to be rejected", fixture.subject)
+			t.Fail()
+		}
+	}
+}
+
+func TestCreateCertificateRequestWithSubject(t *testing.T) {
+	privateKey, err := GenerateSoftwareKey(KeyTypeP256, filepath.Join(t.TempDir(), "key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sans := []string{"host.example.com", "10.0.0.1", "spiffe://example.org/host", "admin@example.com", ""}
+	data, err := CreateCertificateRequestWithSubject(privateKey, "CN=host.example.com,O=Example", sans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		t.Fatal("expected a PEM-encoded CSR")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = csr.CheckSignature(); err != nil {
+		t.Log("CSR signature doesn't verify:", err)
+		t.Fail()
+	}
+	if csr.Subject.String() != "CN=host.example.com,O=Example" {
+		t.Log("Unexpected subject:", csr.Subject)
+		t.Fail()
+	}
+	if len(csr.DNSNames) != 1 || csr.DNSNames[0] != "host.example.com" ||
+		len(csr.IPAddresses) != 1 || csr.IPAddresses[0].String() != "10.0.0.1" ||
+		len(csr.URIs) != 1 || csr.URIs[0].String() != "spiffe://example.org/host" ||
+		len(csr.EmailAddresses) != 1 || csr.EmailAddresses[0] != "admin@example.com" {
+		t.Log("Unexpected subject alternative names:", csr.DNSNames, csr.IPAddresses, csr.URIs, csr.EmailAddresses)
+		t.Fail()
+	}
+}
+
+func TestGenerateSoftwareKey(t *testing.T) {
+	dir := t.TempDir()
+	fixtures := []struct {
+		keyType string
+		check   func(interface{}) bool
+	}{
+		{KeyTypeP256, func(key interface{}) bool {
+			ecKey, ok := key.(ecdsa.PrivateKey)
+			return ok && ecKey.Curve.Params().BitSize == 256
+		}},
+		{KeyTypeP384, func(key interface{}) bool {
+			ecKey, ok := key.(ecdsa.PrivateKey)
+			return ok && ecKey.Curve.Params().BitSize == 384
+		}},
+		{KeyTypeRSA2048, func(key interface{}) bool {
+			rsaKey, ok := key.(rsa.PrivateKey)
+			return ok && rsaKey.N.BitLen() == 2048
+		}},
+	}
+	for _, fixture := range fixtures {
+		path := filepath.Join(dir, fixture.keyType+".pem")
+		if _, err := GenerateSoftwareKey(fixture.keyType, path); err != nil {
+			t.Fatal(err)
+		}
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+			t.Log("Expected the key file to be readable by the current user only")
+			t.Fail()
+		}
+		privateKey, err := ReadPrivateKeyData(path)
+		if err != nil || !fixture.check(privateKey) {
+			t.Logf("Unexpected %s key: %v", fixture.keyType, err)
+			t.Fail()
+		}
+		if _, err = GenerateSoftwareKey(fixture.keyType, path); err == nil {
+			t.Log("Expected an existing key file not to be overwritten")
+			t.Fail()
+		}
+	}
+
+	if _, err := GenerateSoftwareKey("dsa", filepath.Join(dir, "dsa.pem")); err == nil {
+		t.Log("Expected an unsupported key type to be rejected")
+		t.Fail()
+	}
+}
+
+func TestMarshalTPM2B(t *testing.T) {
+	data := []byte("public area")
+	unmarshaled, err := unmarshalTPM2B(marshalTPM2B(data))
+	if err != nil || string(unmarshaled) != string(data) {
+		t.Log("Expected the TPM2B structure to round-trip:", err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,109 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+)
+
+var oidPKCS7SignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+
+// ContentInfo, as defined in RFC 2315
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+// SignedData, as defined in RFC 2315. Only the certificates are of interest
+// (a "certs-only" PKCS#7 bundle, as created by `openssl crl2pkcs7`, has no
+// content or signers).
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      asn1.RawValue
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      asn1.RawValue
+}
+
+// Whether the data contains a PEM block. Files that don't are treated as
+// DER (binary) data.
+func isPEM(data []byte) bool {
+	block, _ := pem.Decode(data)
+	return block != nil
+}
+
+// Parses the certificates in a DER-encoded PKCS#7 (.p7b or .p7c) bundle
+func parsePKCS7Certificates(der []byte) ([]*x509.Certificate, error) {
+	var contentInfo pkcs7ContentInfo
+	if rest, err := asn1.Unmarshal(der, &contentInfo); err != nil || len(rest) != 0 {
+		return nil, errors.New("could not parse PKCS#7 data")
+	}
+	if !contentInfo.ContentType.Equal(oidPKCS7SignedData) {
+		return nil, errors.New("PKCS#7 data doesn't contain signed data")
+	}
+	var signedData pkcs7SignedData
+	if _, err := asn1.Unmarshal(contentInfo.Content.Bytes, &signedData); err != nil {
+		return nil, errors.New("could not parse PKCS#7 signed data")
+	}
+	if len(signedData.Certificates.Bytes) == 0 {
+		return nil, errors.New("no certificates found in PKCS#7 data")
+	}
+	return x509.ParseCertificates(signedData.Certificates.Bytes)
+}
+
+// Finds the end-entity certificate in a set of certificates (such as a
+// PKCS#7 bundle, which is unordered), as the first one that didn't issue
+// any of the others
+func findLeafCertificate(certs []*x509.Certificate) *x509.Certificate {
+	for _, cert := range certs {
+		isIssuer := false
+		for _, other := range certs {
+			if other != cert && bytes.Equal(other.RawIssuer, cert.RawSubject) {
+				isIssuer = true
+				break
+			}
+		}
+		if !isIssuer {
+			return cert
+		}
+	}
+	return nil
+}
+
+// Returns DER data as a block of the requested PEM type, if it parses as
+// such, so that DER files can be used wherever PEM files are expected. A
+// PKCS#7 bundle is accepted where a certificate is requested, in which case
+// its end-entity certificate is used.
+func decodeDER(der []byte, blockType string) (*pem.Block, error) {
+	var err error
+	switch blockType {
+	case "CERTIFICATE":
+		if certs, pkcs7Err := parsePKCS7Certificates(der); pkcs7Err == nil {
+			if cert := findLeafCertificate(certs); cert != nil {
+				return &pem.Block{Type: blockType, Bytes: cert.Raw}, nil
+			}
+		}
+		_, err = x509.ParseCertificate(der)
+	case "PRIVATE KEY":
+		_, err = x509.ParsePKCS8PrivateKey(der)
+	case "EC PRIVATE KEY":
+		_, err = x509.ParseECPrivateKey(der)
+	case "RSA PRIVATE KEY":
+		_, err = x509.ParsePKCS1PrivateKey(der)
+	case "ENCRYPTED PRIVATE KEY":
+		var keyInfo encryptedPrivateKeyInfo
+		var rest []byte
+		if rest, err = asn1.Unmarshal(der, &keyInfo); err == nil && len(rest) != 0 {
+			err = errors.New("trailing data")
+		}
+	default:
+		return nil, errors.New("requested block type could not be found")
+	}
+	if err != nil {
+		return nil, errors.New("requested block type could not be found")
+	}
+	return &pem.Block{Type: blockType, Bytes: der}, nil
+}
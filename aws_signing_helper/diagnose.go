@@ -0,0 +1,133 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const diagnoseTimeout = 10 * time.Second
+
+// Diagnoses connectivity to the IAM Roles Anywhere endpoint, without
+// sending it any credentials: whether its name resolves, whether it (or the
+// proxy, if one is used) can be connected to, whether a TLS connection
+// can be established (through the proxy), and whether the local clock
+// agrees with the server's (as seen in the Date header of its response)
+// closely enough for signed requests to be accepted
+func Diagnose(opts *CredentialsOpts) []CheckResult {
+	var results []CheckResult
+	check := func(description string, err error) bool {
+		results = append(results, CheckResult{description, err})
+		return err == nil
+	}
+
+	endpointURL, err := rolesAnywhereEndpoint(opts)
+	if !check("determine the endpoint", err) {
+		return results
+	}
+	port := endpointURL.Port()
+	if port == "" {
+		port = "443"
+		if endpointURL.Scheme == "http" {
+			port = "80"
+		}
+	}
+	address := net.JoinHostPort(endpointURL.Hostname(), port)
+
+	// The transport doesn't select the proxy itself when it authenticates to
+	// it with NTLM, so it's selected the same way it would be
+	transport, err := createTransport(opts)
+	if err != nil {
+		check("configure the connection", err)
+		return results
+	}
+	proxyURL, err := proxyFunc(opts)(&http.Request{URL: endpointURL})
+	if !check("determine the proxy", err) {
+		return results
+	}
+
+	// When a proxy is used, it's the proxy that resolves the endpoint's name
+	ctx, cancel := context.WithTimeout(context.Background(), diagnoseTimeout)
+	addresses, err := net.DefaultResolver.LookupHost(ctx, endpointURL.Hostname())
+	cancel()
+	if err != nil && proxyURL != nil {
+		err = fmt.Errorf("%w (the proxy may still be able to resolve it)", err)
+	}
+	description := "resolve " + endpointURL.Hostname()
+	if len(addresses) > 0 {
+		description += " (" + strings.Join(addresses, ", ") + ")"
+	}
+	check(description, err)
+
+	dialAddress, dialDescription := address, address
+	if proxyURL != nil {
+		dialAddress = proxyURL.Host
+		if proxyURL.Port() == "" {
+			dialAddress = net.JoinHostPort(proxyURL.Hostname(), "80")
+		}
+		dialDescription = "the proxy at " + dialAddress
+	}
+	conn, err := net.DialTimeout("tcp", dialAddress, diagnoseTimeout)
+	if err == nil {
+		conn.Close()
+	}
+	if !check("connect to "+dialDescription, err) {
+		return results
+	}
+
+	// Any response (even an error) shows that the endpoint is reachable, and
+	// carries the server's time
+	client := &http.Client{Transport: transport, Timeout: diagnoseTimeout}
+	sent := time.Now()
+	resp, err := client.Get(endpointURL.String())
+	received := time.Now()
+	description = "send a request to " + endpointURL.String()
+	if proxyURL != nil {
+		description += " through the proxy"
+	}
+	if err == nil {
+		resp.Body.Close()
+		if resp.TLS != nil {
+			description += fmt.Sprintf(" (%s, certificate issued to %s)",
+				tlsVersionName(resp.TLS.Version), resp.TLS.PeerCertificates[0].Subject)
+		}
+	}
+	if !check(description, err) {
+		return results
+	}
+
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		check("compare the local clock with the server's", errors.New("the response has no valid Date header"))
+		return results
+	}
+	// The Date header has a resolution of a second, and is set somewhere
+	// between sending the request and receiving the response
+	skew := sent.Add(received.Sub(sent) / 2).Sub(serverTime)
+	err = nil
+	if skew > maxClockSkew+time.Second || skew < -maxClockSkew-time.Second {
+		err = fmt.Errorf("the local clock is %s off, which is more than the %s that signed requests tolerate; synchronize it (for example, with NTP)",
+			skew.Round(time.Second), maxClockSkew)
+	}
+	check(fmt.Sprintf("local clock is within %s of the server's (off by %s)", maxClockSkew, skew.Round(time.Second)), err)
+	return results
+}
+
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	}
+	return fmt.Sprintf("TLS version %#04x", version)
+}
@@ -0,0 +1,80 @@
+package aws_signing_helper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRolesAnywhereEndpoint(t *testing.T) {
+	fixtures := []struct {
+		name     string
+		opts     CredentialsOpts
+		expected string
+	}{
+		{"endpoint", CredentialsOpts{Endpoint: "https://localhost:8443", Region: "us-east-1"}, "https://localhost:8443"},
+		{"endpoint without a scheme", CredentialsOpts{Endpoint: "localhost:8443"}, "https://localhost:8443"},
+		{"region", CredentialsOpts{Region: "eu-west-1"}, "https://rolesanywhere.eu-west-1.amazonaws.com"},
+		{"trust anchor region", CredentialsOpts{TrustAnchorArnStr: "arn:aws-cn:rolesanywhere:cn-north-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45"},
+			"https://rolesanywhere.cn-north-1.amazonaws.com.cn"},
+		{"FIPS endpoint", CredentialsOpts{Region: "us-east-1", UseFIPSEndpoint: true}, "https://rolesanywhere-fips.us-east-1.amazonaws.com"},
+		{"GovCloud FIPS endpoint", CredentialsOpts{Region: "us-gov-west-1", UseFIPSEndpoint: true}, "https://rolesanywhere-fips.us-gov-west-1.amazonaws.com"},
+		{"dual-stack endpoint", CredentialsOpts{Region: "us-east-1", UseDualStackEndpoint: true}, "https://rolesanywhere.us-east-1.api.aws"},
+		{"China dual-stack endpoint", CredentialsOpts{Region: "cn-north-1", UseDualStackEndpoint: true}, "https://rolesanywhere.cn-north-1.api.amazonwebservices.com.cn"},
+		{"FIPS dual-stack endpoint", CredentialsOpts{Region: "us-gov-west-1", UseFIPSEndpoint: true, UseDualStackEndpoint: true}, "https://rolesanywhere-fips.us-gov-west-1.api.aws"},
+		{"endpoint with FIPS", CredentialsOpts{Endpoint: "https://localhost:8443", UseFIPSEndpoint: true}, "https://localhost:8443"},
+		{"trust anchor partition", CredentialsOpts{TrustAnchorArnStr: "arn:aws-iso-b:rolesanywhere:xx-new-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45"},
+			"https://rolesanywhere.xx-new-1.sc2s.sgov.gov"},
+		{"no region", CredentialsOpts{}, ""},
+	}
+	for _, fixture := range fixtures {
+		endpointURL, err := rolesAnywhereEndpoint(&fixture.opts)
+		if fixture.expected == "" {
+			if err == nil {
+				t.Logf("Expected no endpoint to be found for the %s", fixture.name)
+				t.Fail()
+			}
+		} else if err != nil || endpointURL.String() != fixture.expected {
+			t.Logf("Expected the endpoint for the %s to be %s, got %v (%v)", fixture.name, fixture.expected, endpointURL, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	fixtures := []struct {
+		name   string
+		skew   time.Duration
+		passed bool
+	}{
+		{"synchronized clock", 0, true},
+		{"slightly skewed clock", time.Minute, true},
+		{"skewed clock", 10 * time.Minute, false},
+		{"clock behind", -10 * time.Minute, false},
+	}
+	for _, fixture := range fixtures {
+		skew := fixture.skew
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Date", time.Now().Add(skew).UTC().Format(http.TimeFormat))
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		results := Diagnose(&CredentialsOpts{Endpoint: server.URL, NoVerifySSL: true})
+		server.Close()
+		if ChecksPassed(results) != fixture.passed {
+			t.Logf("Unexpected diagnosis with a %s:", fixture.name)
+			for _, result := range results {
+				t.Log(result.Check, result.Err)
+			}
+			t.Fail()
+		}
+	}
+
+	// Nothing listens on the endpoint
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	server.Close()
+	if results := Diagnose(&CredentialsOpts{Endpoint: server.URL, NoVerifySSL: true}); ChecksPassed(results) {
+		t.Log("Expected the diagnosis to fail when the endpoint is unreachable")
+		t.Fail()
+	}
+}
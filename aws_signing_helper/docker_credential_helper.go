@@ -0,0 +1,134 @@
+package aws_signing_helper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// Prefix of the names under which Docker runs credential helpers
+const DockerCredentialHelperPrefix = "docker-credential-"
+
+// Environment variable that holds the parameters of the helper when Docker
+// runs it as a credential helper (since Docker passes it none), which
+// SplitDockerCredentialArgs splits
+const DockerCredentialArgsEnvVarName = "AWS_ROLESANYWHERE_DOCKER_CREDENTIAL_ARGS"
+
+// Error that Docker expects from a credential helper that has no
+// credentials for a registry, so that it falls back to anonymous access
+var ErrDockerCredentialsNotFound = errors.New("credentials not found in native keychain")
+
+// Credentials that a Docker credential helper writes for the get action,
+// and reads for the store action
+type DockerCredentials struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+// Implements Docker's credential helper protocol, in which the action is
+// passed as an argument and its input is read from standard input. For get,
+// credentials for the private ECR registry whose URL is read are obtained
+// with temporary credentials for the role. Since those are derived rather
+// than stored, store and erase have nothing to do, and list has nothing to
+// list. Storing credentials for a registry other than a private ECR one is
+// an error, though, since they'd be discarded, and Docker would then fail
+// to pull from it.
+func ServeDockerCredentials(opts *CredentialsOpts, action string, in io.Reader, out io.Writer) error {
+	switch action {
+	case "get":
+		serverURL, err := io.ReadAll(in)
+		if err != nil {
+			return err
+		}
+		_, region, err := parseECRImage(strings.TrimSpace(string(serverURL)))
+		if err != nil {
+			return ErrDockerCredentialsNotFound
+		}
+		credentialProcessOutput, err := GenerateCredentials(opts)
+		if err != nil {
+			return err
+		}
+		authConfig, _, err := getECRAuthorization(credentialProcessOutput, region, ecrEndpoint)
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(out).Encode(DockerCredentials{
+			ServerURL: strings.TrimSpace(string(serverURL)),
+			Username:  authConfig.Username,
+			Secret:    authConfig.Password,
+		})
+	case "store":
+		var credentials DockerCredentials
+		if err := json.NewDecoder(in).Decode(&credentials); err != nil {
+			return fmt.Errorf("invalid credentials: %w", err)
+		}
+		if _, _, err := parseECRImage(credentials.ServerURL); err != nil {
+			return fmt.Errorf("unable to store credentials for %s: only private ECR registries are supported", credentials.ServerURL)
+		}
+		return nil
+	case "erase":
+		_, err := io.ReadAll(in)
+		return err
+	case "list":
+		_, err := fmt.Fprintln(out, "{}")
+		return err
+	default:
+		return fmt.Errorf("unknown action: %s", action)
+	}
+}
+
+// Splits the parameters in DockerCredentialArgsEnvVarName at whitespace,
+// except within single or double quotes, which are removed, so that paths
+// with spaces can be quoted. Within double quotes, a backslash escapes a
+// double quote or another backslash. Backslashes are otherwise kept as is,
+// so that Windows paths don't have to be escaped.
+func SplitDockerCredentialArgs(value string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	runes := []rune(value)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else if r == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\') {
+				i++
+				arg.WriteRune(runes[i])
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in %s", quote, DockerCredentialArgsEnvVarName)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
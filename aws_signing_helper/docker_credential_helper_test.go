@@ -0,0 +1,95 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeDockerCredentials(t *testing.T) {
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	ecrServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		token := base64.StdEncoding.EncodeToString([]byte("AWS:password"))
+		fmt.Fprintf(w, `{"authorizationData":[{"authorizationToken":"%s","expiresAt":%d}]}`, token, time.Now().Add(12*time.Hour).Unix())
+	}))
+	defer ecrServer.Close()
+	ecrEndpoint = ecrServer.URL
+	defer func() { ecrEndpoint = "" }()
+
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	var out bytes.Buffer
+	if err := ServeDockerCredentials(&credentialsOpts, "get", strings.NewReader("000000000000.dkr.ecr.us-east-1.amazonaws.com\n"), &out); err != nil {
+		t.Fatal(err)
+	}
+	var credentials DockerCredentials
+	if err := json.Unmarshal(out.Bytes(), &credentials); err != nil {
+		t.Fatal(err)
+	}
+	if credentials.ServerURL != "000000000000.dkr.ecr.us-east-1.amazonaws.com" || credentials.Username != "AWS" || credentials.Secret != "password" {
+		t.Log("unexpected credentials:", out.String())
+		t.Fail()
+	}
+
+	if err := ServeDockerCredentials(&credentialsOpts, "get", strings.NewReader("docker.io"), &out); err != ErrDockerCredentialsNotFound {
+		t.Log("unexpected error for a registry other than ECR:", err)
+		t.Fail()
+	}
+	if err := ServeDockerCredentials(&credentialsOpts, "store", strings.NewReader(`{"ServerURL":"000000000000.dkr.ecr.us-east-1.amazonaws.com","Username":"AWS","Secret":"secret"}`), &out); err != nil {
+		t.Log("unexpected error for store:", err)
+		t.Fail()
+	}
+	// Credentials for other registries would be discarded
+	if err := ServeDockerCredentials(&credentialsOpts, "store", strings.NewReader(`{"ServerURL":"docker.io","Username":"user","Secret":"secret"}`), &out); err == nil {
+		t.Log("expected store to fail for a registry other than ECR")
+		t.Fail()
+	}
+	if err := ServeDockerCredentials(&credentialsOpts, "erase", strings.NewReader("docker.io"), &out); err != nil {
+		t.Log("unexpected error for erase:", err)
+		t.Fail()
+	}
+}
+
+func TestSplitDockerCredentialArgs(t *testing.T) {
+	testTable := []struct {
+		value    string
+		expected []string
+	}{
+		{"", nil},
+		{"  --role-arn  arn \t--debug ", []string{"--role-arn", "arn", "--debug"}},
+		{`--certificate "C:\Program Files\cert.pem"`, []string{"--certificate", `C:\Program Files\cert.pem`}},
+		{`--private-key '/path/with spaces/key.pem'`, []string{"--private-key", "/path/with spaces/key.pem"}},
+		{`--private-key C:\keys\key.pem`, []string{"--private-key", `C:\keys\key.pem`}},
+		{`"say \"hi\"" a""b ''`, []string{`say "hi"`, "ab", ""}},
+	}
+	for _, tc := range testTable {
+		args, err := SplitDockerCredentialArgs(tc.value)
+		if err != nil || fmt.Sprint(args) != fmt.Sprint(tc.expected) || len(args) != len(tc.expected) {
+			t.Logf("%q: expected %q, got %q (%v)", tc.value, tc.expected, args, err)
+			t.Fail()
+		}
+	}
+
+	if _, err := SplitDockerCredentialArgs(`--certificate "cert.pem`); err == nil {
+		t.Log("expected an unterminated quote to be an error")
+		t.Fail()
+	}
+}
@@ -0,0 +1,29 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"encoding/asn1"
+)
+
+// Header of the blobs created by CryptProtectData: the version (1) followed
+// by the GUID of the DPAPI provider, df9d8cd0-1501-11d1-8c7a-00c04fc297eb
+var dpapiBlobHeader = []byte{
+	0x01, 0x00, 0x00, 0x00,
+	0xd0, 0x8c, 0x9d, 0xdf, 0x01, 0x15, 0xd1, 0x11,
+	0x8c, 0x7a, 0x00, 0xc0, 0x4f, 0xc2, 0x97, 0xeb,
+}
+
+var oidPKCS7EnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+
+// Whether the data is a DPAPI blob, as created by CryptProtectData
+func isDPAPIBlob(data []byte) bool {
+	return bytes.HasPrefix(data, dpapiBlobHeader)
+}
+
+// Whether the data is a DPAPI-NG blob, as created by NCryptProtectSecret,
+// which is a CMS enveloped data structure
+func isDPAPINGBlob(data []byte) bool {
+	var contentInfo pkcs7ContentInfo
+	rest, err := asn1.Unmarshal(data, &contentInfo)
+	return err == nil && len(rest) == 0 && contentInfo.ContentType.Equal(oidPKCS7EnvelopedData)
+}
@@ -0,0 +1,24 @@
+//go:build !windows
+
+package aws_signing_helper
+
+import (
+	"errors"
+)
+
+func unprotectDPAPI(data []byte) ([]byte, error) {
+	if isDPAPIBlob(data) || isDPAPINGBlob(data) {
+		return nil, errors.New("DPAPI-protected files can only be decrypted on Windows")
+	}
+	return data, nil
+}
+
+var errDPAPIUnsupported = errors.New("DPAPI is only supported on Windows")
+
+func protectDPAPI(data []byte, entropy []byte) ([]byte, error) {
+	return nil, errDPAPIUnsupported
+}
+
+func unprotectDPAPIWithEntropy(data []byte, entropy []byte) ([]byte, error) {
+	return nil, errDPAPIUnsupported
+}
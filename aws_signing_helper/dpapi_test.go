@@ -0,0 +1,37 @@
+package aws_signing_helper
+
+import (
+	"encoding/asn1"
+	"os"
+	"testing"
+)
+
+func TestDPAPIBlobDetection(t *testing.T) {
+	blob := append(append([]byte(nil), dpapiBlobHeader...), 0x00, 0x01, 0x02)
+	if !isDPAPIBlob(blob) || isDPAPINGBlob(blob) {
+		t.Log("Expected a DPAPI blob to be detected as such")
+		t.Fail()
+	}
+
+	envelopedData, _ := asn1.Marshal(struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}{oidPKCS7EnvelopedData, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: []byte{0x30, 0x00}}})
+	if !isDPAPINGBlob(envelopedData) || isDPAPIBlob(envelopedData) {
+		t.Log("Expected a DPAPI-NG blob to be detected as such")
+		t.Fail()
+	}
+
+	// Neither PEM nor DER keys and certificates are mistaken for blobs
+	for _, fixture := range []string{
+		"../tst/certs/rsa-2048-key.pem",
+		"../tst/certs/rsa-2048-key.der",
+		"../tst/certs/cert-bundle.p7b",
+	} {
+		data, _ := os.ReadFile(fixture)
+		if isDPAPIBlob(data) || isDPAPINGBlob(data) {
+			t.Logf("Didn't expect %s to be detected as a DPAPI blob", fixture)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package aws_signing_helper
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var procNCryptUnprotectSecret = ncrypt.NewProc("NCryptUnprotectSecret")
+
+// Decrypts a DPAPI or DPAPI-NG blob, which only succeeds for the user or
+// machine (or, with DPAPI-NG, the principals in the protection descriptor)
+// that the blob was protected for. Data that isn't such a blob is returned
+// as is.
+func unprotectDPAPI(data []byte) ([]byte, error) {
+	switch {
+	case isDPAPIBlob(data):
+		dataIn := windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+		var dataOut windows.DataBlob
+		if err := windows.CryptUnprotectData(&dataIn, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &dataOut); err != nil {
+			return nil, err
+		}
+		defer windows.LocalFree(windows.Handle(unsafe.Pointer(dataOut.Data)))
+		return append([]byte(nil), unsafe.Slice(dataOut.Data, dataOut.Size)...), nil
+	case isDPAPINGBlob(data):
+		var unprotected *byte
+		var unprotectedSize uint32
+		status, _, _ := procNCryptUnprotectSecret.Call(0, ncryptSilentFlag, uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)), 0, 0, uintptr(unsafe.Pointer(&unprotected)), uintptr(unsafe.Pointer(&unprotectedSize)))
+		if err := ncryptError("NCryptUnprotectSecret", status); err != nil {
+			return nil, err
+		}
+		defer windows.LocalFree(windows.Handle(unsafe.Pointer(unprotected)))
+		return append([]byte(nil), unsafe.Slice(unprotected, unprotectedSize)...), nil
+	}
+	return data, nil
+}
+
+// Encrypts the data with DPAPI, so that only the current user, on this
+// machine, can decrypt it, and only with the same entropy
+func protectDPAPI(data []byte, entropy []byte) ([]byte, error) {
+	dataIn := windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+	entropyBlob := windows.DataBlob{Size: uint32(len(entropy)), Data: &entropy[0]}
+	var dataOut windows.DataBlob
+	if err := windows.CryptProtectData(&dataIn, nil, &entropyBlob, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &dataOut); err != nil {
+		return nil, err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(dataOut.Data)))
+	return append([]byte(nil), unsafe.Slice(dataOut.Data, dataOut.Size)...), nil
+}
+
+// Decrypts a DPAPI blob that was encrypted with the given entropy
+func unprotectDPAPIWithEntropy(data []byte, entropy []byte) ([]byte, error) {
+	dataIn := windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+	entropyBlob := windows.DataBlob{Size: uint32(len(entropy)), Data: &entropy[0]}
+	var dataOut windows.DataBlob
+	if err := windows.CryptUnprotectData(&dataIn, nil, &entropyBlob, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &dataOut); err != nil {
+		return nil, err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(dataOut.Data)))
+	return append([]byte(nil), unsafe.Slice(dataOut.Data, dataOut.Size)...), nil
+}
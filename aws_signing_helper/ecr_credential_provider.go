@@ -0,0 +1,123 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+)
+
+// Matches the hosts of private ECR registries, capturing their region
+var ecrRegistryPattern = regexp.MustCompile(`^[0-9]{12}\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(?:\.cn)?$`)
+
+// Endpoint through which ECR authorization tokens are obtained, if not the
+// registry region's (for tests)
+var ecrEndpoint = ""
+
+// Request that the kubelet sends an image credential provider plugin on
+// its standard input
+type CredentialProviderRequest struct {
+	Kind       string `json:"kind"`
+	APIVersion string `json:"apiVersion"`
+	Image      string `json:"image"`
+}
+
+// Response that an image credential provider plugin writes to its
+// standard output
+type CredentialProviderResponse struct {
+	Kind          string                        `json:"kind"`
+	APIVersion    string                        `json:"apiVersion"`
+	CacheKeyType  string                        `json:"cacheKeyType"`
+	CacheDuration string                        `json:"cacheDuration,omitempty"`
+	Auth          map[string]RegistryAuthConfig `json:"auth"`
+}
+
+type RegistryAuthConfig struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Returns the host of the private ECR registry that the image is pulled
+// from, and the registry's region
+func parseECRImage(image string) (string, string, error) {
+	registry := strings.SplitN(strings.TrimPrefix(strings.TrimPrefix(image, "https://"), "http://"), "/", 2)[0]
+	match := ecrRegistryPattern.FindStringSubmatch(registry)
+	if match == nil {
+		return "", "", fmt.Errorf("%s isn't in a private ECR registry", image)
+	}
+	return registry, match[1], nil
+}
+
+// Obtains an authorization token for the ECR registries in the given region
+// with the given credentials (through the given endpoint, if there is one),
+// and returns the user name and password that it encodes, along with when
+// it expires
+func getECRAuthorization(credentialProcessOutput CredentialProcessOutput, region string, endpoint string) (RegistryAuthConfig, time.Time, error) {
+	ecrClient := ecr.New(ecr.Options{
+		Credentials: staticCredentials(credentialProcessOutput),
+		Region:      region,
+	}, func(options *ecr.Options) {
+		if endpoint != "" {
+			options.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+	output, err := ecrClient.GetAuthorizationToken(context.Background(), &ecr.GetAuthorizationTokenInput{})
+	if err != nil {
+		return RegistryAuthConfig{}, time.Time{}, err
+	}
+	if len(output.AuthorizationData) == 0 || output.AuthorizationData[0].AuthorizationToken == nil {
+		return RegistryAuthConfig{}, time.Time{}, errors.New("ECR returned no authorization token")
+	}
+	authorizationData := output.AuthorizationData[0]
+	decoded, err := base64.StdEncoding.DecodeString(*authorizationData.AuthorizationToken)
+	if err != nil {
+		return RegistryAuthConfig{}, time.Time{}, fmt.Errorf("invalid ECR authorization token: %w", err)
+	}
+	userAndPassword := strings.SplitN(string(decoded), ":", 2)
+	if len(userAndPassword) != 2 {
+		return RegistryAuthConfig{}, time.Time{}, errors.New("invalid ECR authorization token")
+	}
+	return RegistryAuthConfig{Username: userAndPassword[0], Password: userAndPassword[1]}, aws.ToTime(authorizationData.ExpiresAt), nil
+}
+
+// Implements the kubelet's image credential provider protocol: reads the
+// request for the image that's being pulled, and, if it's in a private ECR
+// registry, writes a response with credentials for the registry, which are
+// obtained with temporary credentials for the role. The kubelet caches them
+// for the registry until the ECR authorization token expires.
+func ProvideECRCredentials(opts *CredentialsOpts, in io.Reader, out io.Writer) error {
+	var request CredentialProviderRequest
+	if err := json.NewDecoder(in).Decode(&request); err != nil {
+		return fmt.Errorf("invalid CredentialProviderRequest: %w", err)
+	}
+	registry, region, err := parseECRImage(request.Image)
+	if err != nil {
+		return err
+	}
+	credentialProcessOutput, err := GenerateCredentials(opts)
+	if err != nil {
+		return err
+	}
+	authConfig, expiresAt, err := getECRAuthorization(credentialProcessOutput, region, ecrEndpoint)
+	if err != nil {
+		return err
+	}
+	response := CredentialProviderResponse{
+		Kind:         "CredentialProviderResponse",
+		APIVersion:   request.APIVersion,
+		CacheKeyType: "Registry",
+		Auth:         map[string]RegistryAuthConfig{registry: authConfig},
+	}
+	if cacheDuration := time.Until(expiresAt).Truncate(time.Second); cacheDuration > 0 {
+		response.CacheDuration = cacheDuration.String()
+	}
+	return json.NewEncoder(out).Encode(response)
+}
@@ -0,0 +1,79 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseECRImage(t *testing.T) {
+	fixtures := []struct {
+		image            string
+		expectedRegistry string
+		expectedRegion   string
+	}{
+		{"000000000000.dkr.ecr.us-east-1.amazonaws.com/app:latest", "000000000000.dkr.ecr.us-east-1.amazonaws.com", "us-east-1"},
+		{"000000000000.dkr.ecr-fips.us-gov-west-1.amazonaws.com/team/app@sha256:0123", "000000000000.dkr.ecr-fips.us-gov-west-1.amazonaws.com", "us-gov-west-1"},
+		{"https://000000000000.dkr.ecr.cn-north-1.amazonaws.com.cn/app", "000000000000.dkr.ecr.cn-north-1.amazonaws.com.cn", "cn-north-1"},
+		{"public.ecr.aws/app:latest", "", ""},
+		{"docker.io/library/busybox", "", ""},
+	}
+	for _, fixture := range fixtures {
+		registry, region, err := parseECRImage(fixture.image)
+		if registry != fixture.expectedRegistry || region != fixture.expectedRegion || (err != nil) != (fixture.expectedRegistry == "") {
+			t.Logf("%s: unexpected result %s, %s, %v", fixture.image, registry, region, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestProvideECRCredentials(t *testing.T) {
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	expiresAt := time.Now().Add(12 * time.Hour)
+	ecrServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken" ||
+			!strings.Contains(r.Header.Get("Authorization"), "Credential=accessKeyId/") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		token := base64.StdEncoding.EncodeToString([]byte("AWS:password"))
+		fmt.Fprintf(w, `{"authorizationData":[{"authorizationToken":"%s","expiresAt":%d,"proxyEndpoint":"https://000000000000.dkr.ecr.us-east-1.amazonaws.com"}]}`, token, expiresAt.Unix())
+	}))
+	defer ecrServer.Close()
+	ecrEndpoint = ecrServer.URL
+	defer func() { ecrEndpoint = "" }()
+
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	request := `{"apiVersion":"credentialprovider.kubelet.k8s.io/v1","kind":"CredentialProviderRequest","image":"000000000000.dkr.ecr.us-east-1.amazonaws.com/app:latest"}`
+	var out bytes.Buffer
+	if err := ProvideECRCredentials(&credentialsOpts, strings.NewReader(request), &out); err != nil {
+		t.Fatal(err)
+	}
+	var response CredentialProviderResponse
+	if err := json.Unmarshal(out.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	auth := response.Auth["000000000000.dkr.ecr.us-east-1.amazonaws.com"]
+	cacheDuration, _ := time.ParseDuration(response.CacheDuration)
+	if response.Kind != "CredentialProviderResponse" || response.APIVersion != "credentialprovider.kubelet.k8s.io/v1" ||
+		response.CacheKeyType != "Registry" || auth.Username != "AWS" || auth.Password != "password" ||
+		cacheDuration < 11*time.Hour || cacheDuration > 12*time.Hour {
+		t.Log("unexpected response:", out.String())
+		t.Fail()
+	}
+}
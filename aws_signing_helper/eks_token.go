@@ -0,0 +1,129 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// Prefix of the bearer tokens that EKS clusters accept, in front of a
+// presigned STS GetCallerIdentity URL
+const EKSTokenPrefix = "k8s-aws-v1."
+
+// Header, signed into the presigned URL, that names the cluster that the
+// token is meant for
+const eksClusterIdHeader = "x-k8s-aws-id"
+
+// How long the presigned URL is valid for. EKS accepts tokens for 15
+// minutes after they've been signed, regardless, so the token is reported
+// to expire a minute before that.
+const (
+	eksTokenPresignDuration = time.Minute
+	eksTokenLifetime        = 14 * time.Minute
+)
+
+// Environment variable in which kubectl passes the ExecCredential (without
+// a status) that the exec plugin is expected to return
+const kubernetesExecInfoEnvVarName = "KUBERNETES_EXEC_INFO"
+
+const defaultExecCredentialAPIVersion = "client.authentication.k8s.io/v1beta1"
+
+// Credentials that a Kubernetes client-go exec plugin (such as kubectl's)
+// returns
+type ExecCredential struct {
+	Kind       string               `json:"kind"`
+	APIVersion string               `json:"apiVersion"`
+	Spec       struct{}             `json:"spec"`
+	Status     ExecCredentialStatus `json:"status"`
+}
+
+type ExecCredentialStatus struct {
+	ExpirationTimestamp time.Time `json:"expirationTimestamp"`
+	Token               string    `json:"token"`
+}
+
+// Returns a token for the given EKS cluster, which is a presigned STS
+// GetCallerIdentity request, signed with the given credentials through the
+// regional STS endpoint
+func GetEKSToken(credentialProcessOutput CredentialProcessOutput, region string, clusterName string) (string, error) {
+	stsClient := sts.New(sts.Options{
+		Credentials: staticCredentials(credentialProcessOutput),
+		Region:      region,
+	})
+	request, err := sts.NewPresignClient(stsClient, func(options *sts.PresignOptions) {
+		options.Presigner = eksTokenPresigner{v4.NewSigner(), clusterName}
+	}).PresignGetCallerIdentity(context.Background(), &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", err
+	}
+	return EKSTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(request.URL)), nil
+}
+
+// Presigns GetCallerIdentity requests for EKS tokens: with the header that
+// names the cluster, and for as long as EKS expects
+type eksTokenPresigner struct {
+	presigner   sts.HTTPPresignerV4
+	clusterName string
+}
+
+func (presigner eksTokenPresigner) PresignHTTP(ctx context.Context, credentials aws.Credentials, r *http.Request, payloadHash string, service string, region string, signingTime time.Time, optFns ...func(*v4.SignerOptions)) (string, http.Header, error) {
+	r.Header.Add(eksClusterIdHeader, presigner.clusterName)
+	query := r.URL.Query()
+	query.Set("X-Amz-Expires", strconv.Itoa(int(eksTokenPresignDuration.Seconds())))
+	r.URL.RawQuery = query.Encode()
+	return presigner.presigner.PresignHTTP(ctx, credentials, r, payloadHash, service, region, signingTime, optFns...)
+}
+
+// Obtains temporary credentials, and returns an ExecCredential that holds a
+// token for the given EKS cluster, signed with them, so that the helper can
+// be used as kubectl's exec plugin. The token expires when it's no longer
+// accepted, or when the credentials expire, if that's sooner.
+func GetEKSExecCredential(opts *CredentialsOpts, clusterName string) (ExecCredential, error) {
+	credentialProcessOutput, err := GenerateCredentials(opts)
+	if err != nil {
+		return ExecCredential{}, err
+	}
+	expiration := time.Now().Add(eksTokenLifetime).UTC().Truncate(time.Second)
+	if credentialsExpiration, err := time.Parse(time.RFC3339, credentialProcessOutput.Expiration); err == nil && credentialsExpiration.Before(expiration) {
+		expiration = credentialsExpiration
+	}
+	// The token is signed in the region that vended the credentials, unless
+	// the options set one
+	region, err := CredentialsRegion(opts)
+	if err != nil {
+		return ExecCredential{}, err
+	}
+	token, err := GetEKSToken(credentialProcessOutput, region, clusterName)
+	if err != nil {
+		return ExecCredential{}, err
+	}
+	return ExecCredential{
+		Kind:       "ExecCredential",
+		APIVersion: execCredentialAPIVersion(),
+		Status: ExecCredentialStatus{
+			ExpirationTimestamp: expiration,
+			Token:               token,
+		},
+	}, nil
+}
+
+// Returns the API version of the ExecCredential that kubectl expects (which
+// it passes in KUBERNETES_EXEC_INFO), or v1beta1, which all the versions of
+// kubectl that support exec plugins accept
+func execCredentialAPIVersion() string {
+	var execInfo struct {
+		APIVersion string `json:"apiVersion"`
+	}
+	if err := json.Unmarshal([]byte(os.Getenv(kubernetesExecInfoEnvVarName)), &execInfo); err == nil && execInfo.APIVersion != "" {
+		return execInfo.APIVersion
+	}
+	return defaultExecCredentialAPIVersion
+}
@@ -0,0 +1,70 @@
+package aws_signing_helper
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetEKSToken(t *testing.T) {
+	credentialProcessOutput := CredentialProcessOutput{
+		AccessKeyId:     "accessKeyId",
+		SecretAccessKey: "secretAccessKey",
+		SessionToken:    "sessionToken",
+	}
+	token, err := GetEKSToken(credentialProcessOutput, "us-west-2", "example-cluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(token, EKSTokenPrefix) {
+		t.Fatalf("unexpected token %s", token)
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, EKSTokenPrefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	presignedURL, err := url.Parse(string(decoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := presignedURL.Query()
+	if presignedURL.Host != "sts.us-west-2.amazonaws.com" || query.Get("Action") != "GetCallerIdentity" ||
+		query.Get("X-Amz-Expires") != "60" || query.Get("X-Amz-Security-Token") != "sessionToken" ||
+		!strings.Contains(query.Get("X-Amz-SignedHeaders"), eksClusterIdHeader) {
+		t.Log("unexpected presigned URL:", presignedURL)
+		t.Fail()
+	}
+}
+
+func TestGetEKSExecCredential(t *testing.T) {
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	t.Setenv(kubernetesExecInfoEnvVarName, `{"kind":"ExecCredential","apiVersion":"client.authentication.k8s.io/v1","spec":{"interactive":false}}`)
+
+	execCredential, err := GetEKSExecCredential(&credentialsOpts, "example-cluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if execCredential.Kind != "ExecCredential" || execCredential.APIVersion != "client.authentication.k8s.io/v1" ||
+		!strings.HasPrefix(execCredential.Status.Token, EKSTokenPrefix) {
+		t.Log("unexpected ExecCredential:", execCredential)
+		t.Fail()
+	}
+	// The token doesn't outlive the credentials it's signed with
+	credentialsExpiration, _ := time.Parse(time.RFC3339, "2022-07-27T04:36:55Z")
+	if !execCredential.Status.ExpirationTimestamp.Equal(credentialsExpiration) {
+		t.Log("unexpected expiration:", execCredential.Status.ExpirationTimestamp)
+		t.Fail()
+	}
+}
@@ -0,0 +1,231 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"hash"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Error returned by ReadPrivateKeyData when the private key is encrypted,
+// in which case ReadEncryptedPrivateKeyData has to be used instead
+var ErrEncryptedPrivateKey = errors.New("the private key is encrypted")
+
+// Error returned when an encrypted private key can't be decrypted
+var ErrIncorrectPassphrase = errors.New("unable to decrypt the private key (is the passphrase correct?)")
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC     = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+// EncryptedPrivateKeyInfo, as defined in RFC 5958
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// PBES2-params, as defined in RFC 8018
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// PBKDF2-params, as defined in RFC 8018. The PRF defaults to HMAC-SHA1.
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// Finds the first private key block in the file, and whether it's
+// encrypted (either as an encrypted PKCS#8 key, or through the legacy
+// OpenSSL PEM encryption)
+func readPrivateKeyBlock(privateKeyId string) (*pem.Block, bool, error) {
+	bytes, err := readCredentialFile(privateKeyId)
+	if err != nil {
+		return nil, false, err
+	}
+	if isAgeEncrypted(bytes) {
+		return &pem.Block{Type: ageBlockType, Bytes: bytes}, true, nil
+	}
+	if !isPEM(bytes) {
+		if block, err := decodeDER(bytes, "ENCRYPTED PRIVATE KEY"); err == nil {
+			return block, true, nil
+		}
+		return nil, false, errors.New("no private key found")
+	}
+	for len(bytes) > 0 {
+		var block *pem.Block
+		block, bytes = pem.Decode(bytes)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "ENCRYPTED PRIVATE KEY":
+			return block, true, nil
+		case "PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY":
+			//lint:ignore SA1019 legacy PEM encryption is still commonly used
+			return block, x509.IsEncryptedPEMBlock(block), nil
+		}
+	}
+	return nil, false, errors.New("no private key found")
+}
+
+// Load the encrypted private key referenced by `privateKeyId`, decrypting
+// it with the given passphrase. Both encrypted PKCS#8 keys (using PBES2 with
+// PBKDF2, and AES or 3DES), keys with legacy OpenSSL PEM encryption
+// ("Proc-Type: 4,ENCRYPTED"), and keys encrypted with `age --passphrase`
+// are supported.
+func ReadEncryptedPrivateKeyData(privateKeyId string, passphrase string) (crypto.PrivateKey, error) {
+	block, encrypted, err := readPrivateKeyBlock(privateKeyId)
+	if err != nil {
+		return nil, err
+	}
+	if !encrypted {
+		return ReadPrivateKeyData(privateKeyId)
+	}
+
+	if block.Type == ageBlockType {
+		return readAgePassphraseEncryptedKey(block.Bytes, passphrase)
+	}
+
+	var privateKey interface{}
+	if block.Type == "ENCRYPTED PRIVATE KEY" {
+		der, err := decryptPKCS8(block.Bytes, []byte(passphrase))
+		if err != nil {
+			return nil, err
+		}
+		if privateKey, err = x509.ParsePKCS8PrivateKey(der); err != nil {
+			return nil, ErrIncorrectPassphrase
+		}
+	} else {
+		//lint:ignore SA1019 legacy PEM encryption is still commonly used
+		der, err := x509.DecryptPEMBlock(block, []byte(passphrase))
+		if err != nil {
+			return nil, ErrIncorrectPassphrase
+		}
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			privateKey, err = x509.ParsePKCS1PrivateKey(der)
+		case "EC PRIVATE KEY":
+			privateKey, err = x509.ParseECPrivateKey(der)
+		default:
+			privateKey, err = x509.ParsePKCS8PrivateKey(der)
+		}
+		if err != nil {
+			return nil, ErrIncorrectPassphrase
+		}
+	}
+
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		return *key, nil
+	case *ecdsa.PrivateKey:
+		return *key, nil
+	}
+	return nil, errors.New("unsupported private key type")
+}
+
+// Decrypts a DER-encoded EncryptedPrivateKeyInfo, returning the DER-encoded
+// PKCS#8 private key
+func decryptPKCS8(der []byte, passphrase []byte) ([]byte, error) {
+	var keyInfo encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &keyInfo); err != nil {
+		return nil, errors.New("could not parse encrypted private key")
+	}
+	if !keyInfo.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, errors.New("unsupported private key encryption (only PBES2 is supported)")
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(keyInfo.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, errors.New("could not parse encrypted private key")
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, errors.New("unsupported key derivation function (only PBKDF2 is supported)")
+	}
+	var kdfParams pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, errors.New("could not parse encrypted private key")
+	}
+
+	var prf func() hash.Hash
+	switch {
+	case len(kdfParams.PRF.Algorithm) == 0, kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	case kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA384):
+		prf = sha512.New384
+	case kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA512):
+		prf = sha512.New
+	default:
+		return nil, errors.New("unsupported PBKDF2 pseudorandom function")
+	}
+
+	var keyLength int
+	var newCipher func([]byte) (cipher.Block, error)
+	switch {
+	case params.EncryptionScheme.Algorithm.Equal(oidAES128CBC):
+		keyLength, newCipher = 16, aes.NewCipher
+	case params.EncryptionScheme.Algorithm.Equal(oidAES192CBC):
+		keyLength, newCipher = 24, aes.NewCipher
+	case params.EncryptionScheme.Algorithm.Equal(oidAES256CBC):
+		keyLength, newCipher = 32, aes.NewCipher
+	case params.EncryptionScheme.Algorithm.Equal(oidDESEDE3CBC):
+		keyLength, newCipher = 24, des.NewTripleDESCipher
+	default:
+		return nil, errors.New("unsupported private key encryption algorithm")
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, errors.New("could not parse encrypted private key")
+	}
+
+	key := pbkdf2.Key(passphrase, kdfParams.Salt, kdfParams.IterationCount, keyLength, prf)
+	block, err := newCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	data := keyInfo.EncryptedData
+	if len(iv) != block.BlockSize() || len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, errors.New("could not parse encrypted private key")
+	}
+	decrypted := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, data)
+
+	// Remove the PKCS#7 padding, whose validity is the first indication of
+	// whether the passphrase is correct
+	padding := int(decrypted[len(decrypted)-1])
+	if padding == 0 || padding > block.BlockSize() {
+		return nil, ErrIncorrectPassphrase
+	}
+	for _, b := range decrypted[len(decrypted)-padding:] {
+		if int(b) != padding {
+			return nil, ErrIncorrectPassphrase
+		}
+	}
+	return decrypted[:len(decrypted)-padding], nil
+}
@@ -0,0 +1,137 @@
+package aws_signing_helper
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// Environment variables that select the FIPS and the dual-stack endpoints,
+// as with the AWS CLI and SDKs
+const (
+	UseFIPSEndpointEnvVarName      = "AWS_USE_FIPS_ENDPOINT"
+	UseDualStackEndpointEnvVarName = "AWS_USE_DUALSTACK_ENDPOINT"
+)
+
+// Whether requests go to the FIPS endpoints (rolesanywhere-fips, and
+// sts-fips for chained roles), which GovCloud and FedRAMP workloads require.
+// An endpoint in the options still takes precedence.
+func useFIPSEndpoint(opts *CredentialsOpts) bool {
+	return opts.UseFIPSEndpoint || strings.EqualFold(os.Getenv(UseFIPSEndpointEnvVarName), "true")
+}
+
+// Whether requests go to the dual-stack endpoints, which can be reached over
+// IPv6 as well as IPv4. Their domain depends on the partition (api.aws, or
+// api.amazonwebservices.com.cn in China), and not every partition has them.
+func useDualStackEndpoint(opts *CredentialsOpts) bool {
+	return opts.UseDualStackEndpoint || strings.EqualFold(os.Getenv(UseDualStackEndpointEnvVarName), "true")
+}
+
+// Selects the variants of the STS endpoints that the options ask for
+func withEndpointVariants(opts *CredentialsOpts) func(*sts.Options) {
+	return func(options *sts.Options) {
+		if useFIPSEndpoint(opts) {
+			options.EndpointOptions.UseFIPSEndpoint = aws.FIPSEndpointStateEnabled
+		}
+		if useDualStackEndpoint(opts) {
+			options.EndpointOptions.UseDualStackEndpoint = aws.DualStackEndpointStateEnabled
+		}
+	}
+}
+
+// Partition, in which endpoints are in the same domain
+type partition struct {
+	id     string
+	regex  *regexp.Regexp
+	domain string
+	// Domain of the dual-stack endpoints, if the partition has them
+	dualStackDomain string
+}
+
+// Partitions in which IAM Roles Anywhere has endpoints. A region's partition
+// is the first whose pattern matches it, or else the aws partition.
+var partitions = []partition{
+	{"aws-cn", regexp.MustCompile(`^cn-\w+-\d+$`), "amazonaws.com.cn", "api.amazonwebservices.com.cn"},
+	{"aws-us-gov", regexp.MustCompile(`^us-gov-\w+-\d+$`), "amazonaws.com", "api.aws"},
+	{"aws-iso", regexp.MustCompile(`^us-iso-\w+-\d+$`), "c2s.ic.gov", ""},
+	{"aws-iso-b", regexp.MustCompile(`^us-isob-\w+-\d+$`), "sc2s.sgov.gov", ""},
+	{"aws-iso-e", regexp.MustCompile(`^eu-isoe-\w+-\d+$`), "cloud.adc-e.uk", ""},
+	{"aws-iso-f", regexp.MustCompile(`^us-isof-\w+-\d+$`), "csp.hci.ic.gov", ""},
+	{"aws-eusc", regexp.MustCompile(`^eusc-(de)-\w+-\d+$`), "amazonaws.eu", ""},
+	{"aws", regexp.MustCompile(`^(us|eu|ap|sa|ca|me|af|il|mx)-\w+-\d+$`), "amazonaws.com", "api.aws"},
+}
+
+// Finds the URL of the IAM Roles Anywhere endpoint that requests are sent
+// to: the one passed through --endpoint, or else the regional endpoint (or
+// its FIPS or dual-stack variant) for the region passed through --region,
+// or else the trust anchor's region, in the trust anchor's partition
+func rolesAnywhereEndpoint(opts *CredentialsOpts) (*url.URL, error) {
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		region := opts.Region
+		var partitionID string
+		if trustAnchorArn, err := arn.Parse(opts.TrustAnchorArnStr); err == nil {
+			partitionID = trustAnchorArn.Partition
+			if region == "" {
+				region = trustAnchorArn.Region
+			}
+		}
+		if region == "" {
+			return nil, errors.New("the region isn't known (pass --region, --trust-anchor-arn, or --endpoint)")
+		}
+		resolved, err := resolveRegionalEndpoint(opts, partitionID, region)
+		if err != nil {
+			return nil, err
+		}
+		endpoint = resolved
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint %s: %w", endpoint, err)
+	}
+	return endpointURL, nil
+}
+
+// Resolves the IAM Roles Anywhere endpoint of the region in the partition
+// of the ARNs, if it's a known one, rather than in the partition that the
+// region's name suggests, so that the endpoints of regions that the helper
+// doesn't know of yet are still in the right domain
+func resolveRegionalEndpoint(opts *CredentialsOpts, partitionID string, region string) (string, error) {
+	var regionPartition *partition
+	for i := range partitions {
+		if partitions[i].id == partitionID {
+			regionPartition = &partitions[i]
+			break
+		}
+	}
+	if regionPartition == nil {
+		regionPartition = &partitions[len(partitions)-1]
+		for i := range partitions {
+			if partitions[i].regex.MatchString(region) {
+				regionPartition = &partitions[i]
+				break
+			}
+		}
+	}
+	hostname, domain := "rolesanywhere", regionPartition.domain
+	if useFIPSEndpoint(opts) {
+		hostname += "-fips"
+	}
+	if useDualStackEndpoint(opts) {
+		if regionPartition.dualStackDomain == "" {
+			return "", fmt.Errorf("the %s partition has no dual-stack endpoints", regionPartition.id)
+		}
+		domain = regionPartition.dualStackDomain
+	}
+	return "https://" + hostname + "." + region + "." + domain, nil
+}
@@ -0,0 +1,191 @@
+package aws_signing_helper
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Environment variables through which credentials are passed to the
+// command, which replace any that the helper inherited
+var execCredentialEnvVarNames = []string{
+	"AWS_ACCESS_KEY_ID",
+	"AWS_SECRET_ACCESS_KEY",
+	"AWS_SESSION_TOKEN",
+	"AWS_SECURITY_TOKEN",
+	"AWS_CREDENTIAL_EXPIRATION",
+}
+
+// Environment variables through which the region is passed to the command,
+// unless they're already set
+var execRegionEnvVarNames = []string{"AWS_REGION", "AWS_DEFAULT_REGION"}
+
+// Returns the environment variables that the certificate and the private
+// key are read from (env://NAME, or the default ones), which aren't passed
+// on to the command, so that it's only given the temporary credentials
+func withheldEnvVarNames(opts *CredentialsOpts) []string {
+	names := []string{CertificateEnvVarName, PrivateKeyEnvVarName}
+	for _, path := range []string{opts.CertificateId, opts.PrivateKeyId, opts.CertificateBundleId} {
+		if strings.HasPrefix(path, envPathPrefix) {
+			names = append(names, strings.TrimPrefix(path, envPathPrefix))
+		}
+	}
+	return names
+}
+
+// How long a command that's being restarted is given to exit, before it's
+// killed
+const execStopTimeout = 10 * time.Second
+
+// Returns the variables (as NAME=value) that pass the credentials, and,
+// unless the given environment already sets it, the region
+func credentialEnvVars(environ []string, credentials CredentialProcessOutput, region string) []string {
+	vars := []string{
+		"AWS_ACCESS_KEY_ID=" + credentials.AccessKeyId,
+		"AWS_SECRET_ACCESS_KEY=" + credentials.SecretAccessKey,
+		"AWS_SESSION_TOKEN=" + credentials.SessionToken,
+		"AWS_CREDENTIAL_EXPIRATION=" + credentials.Expiration,
+	}
+	if region == "" {
+		return vars
+	}
+	for _, variable := range environ {
+		name := strings.SplitN(variable, "=", 2)[0]
+		for _, regionEnvVarName := range execRegionEnvVarNames {
+			if strings.EqualFold(name, regionEnvVarName) {
+				return vars
+			}
+		}
+	}
+	for _, regionEnvVarName := range execRegionEnvVarNames {
+		vars = append(vars, regionEnvVarName+"="+region)
+	}
+	return vars
+}
+
+// Returns the environment of the command: the given one, without the
+// withheld variables, and with the credentials (and, if it isn't set, the
+// region) added
+func execEnvironment(environ []string, credentials CredentialProcessOutput, region string, withheld []string) []string {
+	removed := append(append([]string(nil), execCredentialEnvVarNames...), withheld...)
+	var env []string
+	for _, variable := range environ {
+		name := strings.SplitN(variable, "=", 2)[0]
+		replaced := false
+		for _, removedEnvVarName := range removed {
+			if strings.EqualFold(name, removedEnvVarName) {
+				replaced = true
+			}
+		}
+		if !replaced {
+			env = append(env, variable)
+		}
+	}
+	return append(env, credentialEnvVars(environ, credentials, region)...)
+}
+
+// Runs the command with temporary credentials in its environment, and
+// returns its exit status. Signals that the helper receives are passed on to
+// the command. If restart is set, the command is stopped shortly before the
+// credentials expire, and started again with new ones; otherwise, it's left
+// to run with the credentials it was given.
+func Exec(opts *CredentialsOpts, args []string, restart bool) (int, error) {
+	if len(args) == 0 {
+		return 0, errors.New("no command given")
+	}
+	region, err := CredentialsRegion(opts)
+	if err != nil {
+		return 0, err
+	}
+	signer, err := GetSigner(opts)
+	if err != nil {
+		return 0, err
+	}
+	defer signer.Close()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	for {
+		credentials, err := GenerateCredentialsWithSigner(opts, signer)
+		if err != nil {
+			return 0, err
+		}
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		cmd.Env = execEnvironment(os.Environ(), credentials, region, withheldEnvVarNames(opts))
+		if err = cmd.Start(); err != nil {
+			return 0, err
+		}
+		exited := make(chan error, 1)
+		go func() {
+			exited <- cmd.Wait()
+		}()
+
+		var refresh <-chan time.Time
+		if restart {
+			expiration, err := time.Parse(time.RFC3339, credentials.Expiration)
+			if err != nil {
+				return 0, err
+			}
+			refresh = time.After(time.Until(expiration.Add(-RefreshTime)))
+		}
+
+	waiting:
+		for {
+			select {
+			case sig := <-signals:
+				cmd.Process.Signal(sig)
+			case err = <-exited:
+				return execExitStatus(err)
+			case <-refresh:
+				log.Println("restarting the command with new credentials, since its credentials are about to expire")
+				if err = stopCommand(cmd, exited); err != nil {
+					return 0, err
+				}
+				break waiting
+			}
+		}
+	}
+}
+
+// Asks the command to exit (or, on Windows, where it can't be asked, makes
+// it), and kills it if it hasn't within execStopTimeout
+func stopCommand(cmd *exec.Cmd, exited <-chan error) error {
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		cmd.Process.Kill()
+	}
+	select {
+	case <-exited:
+		return nil
+	case <-time.After(execStopTimeout):
+		log.Println("killing the command, since it hasn't exited")
+		if err := cmd.Process.Kill(); err != nil {
+			return err
+		}
+		<-exited
+		return nil
+	}
+}
+
+// Returns the exit status of the command that Wait returned the error for
+func execExitStatus(err error) (int, error) {
+	if err == nil {
+		return 0, nil
+	}
+	var exitError *exec.ExitError
+	if !errors.As(err, &exitError) {
+		return 0, err
+	}
+	// Commands that were killed by a signal have no exit status
+	if exitError.ExitCode() < 0 {
+		return 1, nil
+	}
+	return exitError.ExitCode(), nil
+}
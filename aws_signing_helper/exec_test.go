@@ -0,0 +1,148 @@
+package aws_signing_helper
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestExecEnvironment(t *testing.T) {
+	credentials := CredentialProcessOutput{
+		AccessKeyId:     "accessKeyId",
+		SecretAccessKey: "secretAccessKey",
+		SessionToken:    "sessionToken",
+		Expiration:      "2022-07-27T04:36:55Z",
+	}
+	fixtures := []struct {
+		name     string
+		environ  []string
+		expected []string
+	}{
+		{"empty", nil, []string{
+			"AWS_ACCESS_KEY_ID=accessKeyId",
+			"AWS_SECRET_ACCESS_KEY=secretAccessKey",
+			"AWS_SESSION_TOKEN=sessionToken",
+			"AWS_CREDENTIAL_EXPIRATION=2022-07-27T04:36:55Z",
+			"AWS_REGION=us-east-1",
+			"AWS_DEFAULT_REGION=us-east-1",
+		}},
+		{"replaced", []string{"PATH=/bin", "AWS_ACCESS_KEY_ID=old", "AWS_SECURITY_TOKEN=old", "AWS_REGION=eu-west-1"}, []string{
+			"PATH=/bin",
+			"AWS_REGION=eu-west-1",
+			"AWS_ACCESS_KEY_ID=accessKeyId",
+			"AWS_SECRET_ACCESS_KEY=secretAccessKey",
+			"AWS_SESSION_TOKEN=sessionToken",
+			"AWS_CREDENTIAL_EXPIRATION=2022-07-27T04:36:55Z",
+		}},
+		{"withheld", []string{"PATH=/bin", "AWS_ROLESANYWHERE_PRIVATE_KEY=key", "AWS_ROLESANYWHERE_CERTIFICATE=cert", "MY_KEY=key", "AWS_REGION=eu-west-1"}, []string{
+			"PATH=/bin",
+			"AWS_REGION=eu-west-1",
+			"AWS_ACCESS_KEY_ID=accessKeyId",
+			"AWS_SECRET_ACCESS_KEY=secretAccessKey",
+			"AWS_SESSION_TOKEN=sessionToken",
+			"AWS_CREDENTIAL_EXPIRATION=2022-07-27T04:36:55Z",
+		}},
+	}
+	withheld := withheldEnvVarNames(&CredentialsOpts{PrivateKeyId: "env://MY_KEY", CertificateId: "../credential-process-data/client-cert.pem"})
+	for _, fixture := range fixtures {
+		env := execEnvironment(fixture.environ, credentials, "us-east-1", withheld)
+		if strings.Join(env, "\n") != strings.Join(fixture.expected, "\n") {
+			t.Logf("%s: unexpected environment %v", fixture.name, env)
+			t.Fail()
+		}
+	}
+}
+
+func TestExec(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh isn't available")
+	}
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	// The command's exit status is returned
+	status, err := Exec(&credentialsOpts, []string{"sh", "-c", `test "$AWS_ACCESS_KEY_ID" = accessKeyId && test "$AWS_SESSION_TOKEN" = sessionToken && exit 3`}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != 3 {
+		t.Logf("expected the command to see the credentials, and exit with status 3, got %d", status)
+		t.Fail()
+	}
+}
+
+func TestExecWithoutRegion(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh isn't available")
+	}
+	for _, name := range execRegionEnvVarNames {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:eu-west-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:eu-west-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	// Without --region, the command is given the trust anchor's
+	status, err := Exec(&credentialsOpts, []string{"sh", "-c", `test "$AWS_REGION" = eu-west-1 && test "$AWS_DEFAULT_REGION" = eu-west-1 && exit 3`}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != 3 {
+		t.Logf("expected the command to see the trust anchor's region, and exit with status 3, got %d", status)
+		t.Fail()
+	}
+}
+
+func TestExecWithholdsPrivateKey(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh isn't available")
+	}
+	keyData, err := os.ReadFile("../credential-process-data/client-key.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certData, err := os.ReadFile("../credential-process-data/client-cert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_PRIVATE_KEY", string(keyData))
+	t.Setenv(CertificateEnvVarName, string(certData))
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "env://TEST_PRIVATE_KEY",
+		CertificateId:     EnvCredentialPath(CertificateEnvVarName),
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	// The command is given the credentials, but not the key and certificate
+	// that they were obtained with
+	status, err := Exec(&credentialsOpts, []string{"sh", "-c", `test -z "${TEST_PRIVATE_KEY+set}" && test -z "${AWS_ROLESANYWHERE_CERTIFICATE+set}" && test "$AWS_ACCESS_KEY_ID" = accessKeyId && exit 3`}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != 3 {
+		t.Logf("expected the command not to see the private key and the certificate, and to exit with status 3, got %d", status)
+		t.Fail()
+	}
+}
@@ -0,0 +1,54 @@
+package aws_signing_helper
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// Shells whose syntax export-credentials can print the credentials in
+const (
+	ShellFormatBash       = "bash"
+	ShellFormatZsh        = "zsh"
+	ShellFormatFish       = "fish"
+	ShellFormatPowerShell = "powershell"
+)
+
+// Shell whose syntax the credentials are printed in, if none is given
+func DefaultShellFormat() string {
+	if runtime.GOOS == "windows" {
+		return ShellFormatPowerShell
+	}
+	return ShellFormatBash
+}
+
+// Returns the statements that set the credentials (and, unless the given
+// environment already sets it, the region) as environment variables in the
+// given shell, one per line, so that they can be evaluated by it
+func FormatCredentialsForShell(environ []string, credentials CredentialProcessOutput, region string, shell string) (string, error) {
+	var statement func(name string, value string) string
+	switch shell {
+	case ShellFormatBash, ShellFormatZsh:
+		statement = func(name string, value string) string {
+			return fmt.Sprintf("export %s='%s'", name, strings.ReplaceAll(value, "'", `'\''`))
+		}
+	case ShellFormatFish:
+		statement = func(name string, value string) string {
+			value = strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(value)
+			return fmt.Sprintf("set -gx %s '%s'", name, value)
+		}
+	case ShellFormatPowerShell:
+		statement = func(name string, value string) string {
+			return fmt.Sprintf("Set-Item -Path env:%s -Value '%s'", name, strings.ReplaceAll(value, "'", "''"))
+		}
+	default:
+		return "", fmt.Errorf("unsupported format %s (use bash, zsh, fish, or powershell)", shell)
+	}
+	var output strings.Builder
+	for _, variable := range credentialEnvVars(environ, credentials, region) {
+		nameAndValue := strings.SplitN(variable, "=", 2)
+		output.WriteString(statement(nameAndValue[0], nameAndValue[1]))
+		output.WriteString("\n")
+	}
+	return output.String(), nil
+}
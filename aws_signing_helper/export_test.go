@@ -0,0 +1,49 @@
+package aws_signing_helper
+
+import (
+	"testing"
+)
+
+func TestFormatCredentialsForShell(t *testing.T) {
+	credentials := CredentialProcessOutput{
+		AccessKeyId:     "accessKeyId",
+		SecretAccessKey: `secret'Access\Key`,
+		SessionToken:    "sessionToken",
+		Expiration:      "2022-07-27T04:36:55Z",
+	}
+	fixtures := []struct {
+		shell    string
+		environ  []string
+		expected string
+	}{
+		{ShellFormatBash, nil, `export AWS_ACCESS_KEY_ID='accessKeyId'
+export AWS_SECRET_ACCESS_KEY='secret'\''Access\Key'
+export AWS_SESSION_TOKEN='sessionToken'
+export AWS_CREDENTIAL_EXPIRATION='2022-07-27T04:36:55Z'
+export AWS_REGION='us-east-1'
+export AWS_DEFAULT_REGION='us-east-1'
+`},
+		{ShellFormatFish, []string{"AWS_REGION=eu-west-1"}, `set -gx AWS_ACCESS_KEY_ID 'accessKeyId'
+set -gx AWS_SECRET_ACCESS_KEY 'secret\'Access\\Key'
+set -gx AWS_SESSION_TOKEN 'sessionToken'
+set -gx AWS_CREDENTIAL_EXPIRATION '2022-07-27T04:36:55Z'
+`},
+		{ShellFormatPowerShell, []string{"AWS_DEFAULT_REGION=eu-west-1"}, `Set-Item -Path env:AWS_ACCESS_KEY_ID -Value 'accessKeyId'
+Set-Item -Path env:AWS_SECRET_ACCESS_KEY -Value 'secret''Access\Key'
+Set-Item -Path env:AWS_SESSION_TOKEN -Value 'sessionToken'
+Set-Item -Path env:AWS_CREDENTIAL_EXPIRATION -Value '2022-07-27T04:36:55Z'
+`},
+	}
+	for _, fixture := range fixtures {
+		output, err := FormatCredentialsForShell(fixture.environ, credentials, "us-east-1", fixture.shell)
+		if err != nil || output != fixture.expected {
+			t.Logf("%s: unexpected output %s (%v)", fixture.shell, output, err)
+			t.Fail()
+		}
+	}
+
+	if _, err := FormatCredentialsForShell(nil, credentials, "us-east-1", "cmd"); err == nil {
+		t.Log("expected an unsupported format to be rejected")
+		t.Fail()
+	}
+}
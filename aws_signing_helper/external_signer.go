@@ -0,0 +1,163 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Version of the protocol that is spoken with external signer commands
+const externalSignerVersion = 1
+
+// Maps the supported digests to the names used in the protocol
+var externalSignerAlgorithms = map[crypto.Hash]string{
+	crypto.SHA256: "SHA256",
+	crypto.SHA384: "SHA384",
+	crypto.SHA512: "SHA512",
+}
+
+// Request that is written to the standard input of the signer command
+type ExternalSignerRequest struct {
+	Version   int    `json:"Version"`
+	Operation string `json:"Operation"`
+	Digest    []byte `json:"Digest,omitempty"`
+	Algorithm string `json:"Algorithm,omitempty"`
+}
+
+// Response that the signer command writes to its standard output. Binary
+// values are base64-encoded, and certificates are DER-encoded.
+type ExternalSignerResponse struct {
+	Version          int      `json:"Version"`
+	Signature        []byte   `json:"Signature,omitempty"`
+	Certificate      []byte   `json:"Certificate,omitempty"`
+	CertificateChain [][]byte `json:"CertificateChain,omitempty"`
+}
+
+// Signer that delegates signing to an external command. The command is run
+// once per operation, with a JSON request on its standard input, and has
+// to write a JSON response to its standard output (and exit with status 0).
+// Its standard error is passed through, so that it can prompt the user.
+type ExternalSigner struct {
+	command          []string
+	cert             *x509.Certificate
+	certificateChain []*x509.Certificate
+}
+
+// Creates a signer that runs the given command (which is split on
+// whitespace, without any shell processing). If no certificate is
+// provided, it's obtained from the command through a "certificate" request.
+func GetExternalSigner(command string, certificateId string, certificateBundleId string) (Signer, error) {
+	externalSigner := &ExternalSigner{command: strings.Fields(command)}
+	if len(externalSigner.command) == 0 {
+		return nil, errors.New("empty signer command")
+	}
+
+	var err error
+	if certificateId != "" {
+		if externalSigner.cert, err = readCertificate(certificateId); err != nil {
+			return nil, err
+		}
+	} else {
+		var response ExternalSignerResponse
+		if err = externalSigner.run(ExternalSignerRequest{Operation: "certificate"}, &response); err != nil {
+			return nil, err
+		}
+		if externalSigner.cert, err = x509.ParseCertificate(response.Certificate); err != nil {
+			return nil, fmt.Errorf("invalid certificate from signer command: %w", err)
+		}
+		for _, certData := range response.CertificateChain {
+			cert, err := x509.ParseCertificate(certData)
+			if err != nil {
+				return nil, fmt.Errorf("invalid certificate chain from signer command: %w", err)
+			}
+			externalSigner.certificateChain = append(externalSigner.certificateChain, cert)
+		}
+	}
+	if certificateBundleId != "" {
+		if externalSigner.certificateChain, err = ReadCertificateBundleData(certificateBundleId); err != nil {
+			return nil, err
+		}
+	}
+
+	switch externalSigner.cert.PublicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, errors.New("unsupported certificate key type")
+	}
+	return externalSigner, nil
+}
+
+// Runs the signer command with the given request, and decodes its response
+func (externalSigner *ExternalSigner) run(request ExternalSignerRequest, response *ExternalSignerResponse) error {
+	request.Version = externalSignerVersion
+	input, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	var output bytes.Buffer
+	cmd := exec.Command(externalSigner.command[0], externalSigner.command[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &output
+	cmd.Stderr = os.Stderr
+	if err = cmd.Run(); err != nil {
+		return fmt.Errorf("signer command failed: %w", err)
+	}
+	if err = json.Unmarshal(output.Bytes(), response); err != nil {
+		return fmt.Errorf("invalid response from signer command: %w", err)
+	}
+	if response.Version != externalSignerVersion {
+		return fmt.Errorf("unsupported signer command protocol version: %d", response.Version)
+	}
+	return nil
+}
+
+func (externalSigner *ExternalSigner) Public() crypto.PublicKey {
+	return externalSigner.cert.PublicKey
+}
+
+// Signs the digest through the signer command. RSA signatures have to use
+// PKCS#1 v1.5 padding, and ECDSA signatures have to be ASN.1-encoded. The
+// signature is verified, so that a misbehaving command is reported as such.
+func (externalSigner *ExternalSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	algorithm, ok := externalSignerAlgorithms[opts.HashFunc()]
+	if !ok {
+		return nil, errors.New("unsupported digest")
+	}
+	var response ExternalSignerResponse
+	request := ExternalSignerRequest{Operation: "sign", Digest: digest, Algorithm: algorithm}
+	if err := externalSigner.run(request, &response); err != nil {
+		return nil, err
+	}
+
+	valid := false
+	switch publicKey := externalSigner.cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(publicKey, opts.HashFunc(), digest, response.Signature) == nil
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(publicKey, digest, response.Signature)
+	}
+	if !valid {
+		return nil, errors.New("the signer command returned an invalid signature")
+	}
+	return response.Signature, nil
+}
+
+func (externalSigner *ExternalSigner) Certificate() (*x509.Certificate, error) {
+	return externalSigner.cert, nil
+}
+
+func (externalSigner *ExternalSigner) CertificateChain() ([]*x509.Certificate, error) {
+	return externalSigner.certificateChain, nil
+}
+
+func (externalSigner *ExternalSigner) Close() {
+}
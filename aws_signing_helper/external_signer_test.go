@@ -0,0 +1,111 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// Acts as an external signer command when run by the tests below, using
+// the private key and certificate in the environment
+func TestExternalSignerHelperProcess(t *testing.T) {
+	if os.Getenv("TEST_SIGNER_KEY") == "" {
+		return
+	}
+	defer os.Exit(0)
+
+	var request ExternalSignerRequest
+	if err := json.NewDecoder(os.Stdin).Decode(&request); err != nil {
+		os.Exit(1)
+	}
+	response := ExternalSignerResponse{Version: externalSignerVersion}
+	switch request.Operation {
+	case "certificate":
+		cert, err := readCertificate(os.Getenv("TEST_SIGNER_CERT"))
+		if err != nil {
+			os.Exit(1)
+		}
+		response.Certificate = cert.Raw
+	case "sign":
+		privateKey, err := ReadPrivateKeyData(os.Getenv("TEST_SIGNER_KEY"))
+		if err != nil || request.Algorithm != "SHA256" {
+			os.Exit(1)
+		}
+		switch key := privateKey.(type) {
+		case ecdsa.PrivateKey:
+			response.Signature, err = ecdsa.SignASN1(rand.Reader, &key, request.Digest)
+		case rsa.PrivateKey:
+			response.Signature, err = rsa.SignPKCS1v15(rand.Reader, &key, crypto.SHA256, request.Digest)
+		}
+		if err != nil {
+			os.Exit(1)
+		}
+	default:
+		os.Exit(1)
+	}
+	json.NewEncoder(os.Stdout).Encode(response)
+}
+
+func externalSignerTestCommand(t *testing.T, privateKeyId string, certificateId string) string {
+	t.Setenv("TEST_SIGNER_KEY", privateKeyId)
+	t.Setenv("TEST_SIGNER_CERT", certificateId)
+	return os.Args[0] + " -test.run=TestExternalSignerHelperProcess"
+}
+
+func TestExternalSigner(t *testing.T) {
+	msg := []byte("test message")
+	digest := sha256.Sum256(msg)
+
+	for _, fixture := range []struct{ keyId, certificateId string }{
+		{"../tst/certs/ec-prime256v1-key.pem", "../tst/certs/ec-prime256v1-sha256-cert.pem"},
+		{"../tst/certs/rsa-2048-key.pem", "../tst/certs/rsa-2048-sha256-cert.pem"},
+	} {
+		command := externalSignerTestCommand(t, fixture.keyId, fixture.certificateId)
+		// The certificate is obtained from the command
+		signer, err := GetExternalSigner(command, "", "")
+		if err != nil {
+			t.Log(err)
+			t.Fail()
+			continue
+		}
+		signingResult, err := Sign(msg, SigningOpts{signer, crypto.SHA256})
+		signer.Close()
+		if err != nil {
+			t.Log(err)
+			t.Fail()
+			continue
+		}
+		sig, _ := hex.DecodeString(signingResult.Signature)
+
+		valid := false
+		switch publicKey := signer.Public().(type) {
+		case *ecdsa.PublicKey:
+			valid = ecdsa.VerifyASN1(publicKey, digest[:], sig)
+		case *rsa.PublicKey:
+			valid = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], sig) == nil
+		}
+		if !valid {
+			t.Logf("Failed to verify the external signature for %s", fixture.certificateId)
+			t.Fail()
+		}
+	}
+}
+
+func TestExternalSignerInvalidSignature(t *testing.T) {
+	// The command signs with a key that doesn't match the certificate
+	command := externalSignerTestCommand(t, "../tst/certs/rsa-1024-key.pem", "../tst/certs/rsa-2048-sha256-cert.pem")
+	signer, err := GetExternalSigner(command, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Sign([]byte("test message"), SigningOpts{signer, crypto.SHA256}); err == nil {
+		t.Log("Expected an invalid signature to be rejected")
+		t.Fail()
+	}
+}
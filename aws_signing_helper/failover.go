@@ -0,0 +1,49 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"log"
+)
+
+// Trust anchor and profile (and, optionally, endpoint) to fall back on when
+// the primary ones' region is unreachable: replicas of them in another
+// region, for disaster recovery. The region is that of the ARNs.
+type FailoverTarget struct {
+	TrustAnchorArn string
+	ProfileArn     string
+	Endpoint       string
+}
+
+// Sends the CreateSession request to the primary region, or, if it's
+// unreachable (or fails transiently, even after retries), to each of the
+// failover targets in turn, and returns the credentials, along with the
+// options with which they were obtained (whose region is the one that
+// responded). The primary region is tried first each time, so that requests
+// go back to it once it recovers. Errors that aren't transient (such as the
+// certificate being rejected) aren't failed over, since the replicas would
+// reject it too. The options are copied, so that filling in the region
+// doesn't change the caller's (which the credential cache's keys are
+// derived from).
+func createSessionWithFailover(ctx context.Context, opts *CredentialsOpts, signer Signer) (CredentialProcessOutput, *CredentialsOpts, error) {
+	primaryOpts := *opts
+	opts = &primaryOpts
+	credentialProcessOutput, err := generateCredentialsWithSigner(ctx, opts, signer)
+	if err == nil || !isTransientError(err) {
+		return credentialProcessOutput, opts, err
+	}
+	for _, target := range opts.FailoverTargets {
+		failoverOpts := *opts
+		failoverOpts.TrustAnchorArnStr = target.TrustAnchorArn
+		failoverOpts.ProfileArnStr = target.ProfileArn
+		failoverOpts.Endpoint = target.Endpoint
+		failoverOpts.Region = ""
+		failoverOpts.FailoverTargets = nil
+		log.Printf("unable to obtain credentials through %s, so failing over to %s: %v", opts.TrustAnchorArnStr, target.TrustAnchorArn, err)
+		credentialProcessOutput, err = generateCredentialsWithSigner(ctx, &failoverOpts, signer)
+		if err == nil || !isTransientError(err) {
+			return credentialProcessOutput, &failoverOpts, err
+		}
+		opts = &failoverOpts
+	}
+	return CredentialProcessOutput{}, opts, err
+}
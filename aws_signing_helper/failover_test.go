@@ -0,0 +1,66 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFailover(t *testing.T) {
+	os.Setenv(MaxAttemptsEnvVarName, "1")
+	defer os.Unsetenv(MaxAttemptsEnvVarName)
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+	var requests int32
+	replica := getCountingCreateSessionServer(time.Hour, &requests)
+	defer replica.Close()
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          unreachable.URL,
+		SessionDuration:   900,
+		FailoverTargets: []FailoverTarget{
+			{
+				TrustAnchorArn: "arn:aws:rolesanywhere:us-west-2:000000000000:trust-anchor/52dm1cbf-7894-51e5-bc31-76ed6ea33f56",
+				ProfileArn:     "arn:aws:rolesanywhere:us-west-2:000000000000:profile/52dm1cbf-7894-51e5-bc31-76ed6ea33f56",
+				Endpoint:       unreachable.URL,
+			},
+			{
+				TrustAnchorArn: "arn:aws:rolesanywhere:eu-west-1:000000000000:trust-anchor/63en2dcg-8905-62f6-cd42-87fe7fb44g67",
+				ProfileArn:     "arn:aws:rolesanywhere:eu-west-1:000000000000:profile/63en2dcg-8905-62f6-cd42-87fe7fb44g67",
+				Endpoint:       replica.URL,
+			},
+		},
+	}
+	if _, err := GenerateCredentials(&credentialsOpts); err != nil || atomic.LoadInt32(&requests) != 1 {
+		t.Log("the request didn't fail over to the reachable replica:", err)
+		t.Fail()
+	}
+	signer, err := GetSigner(&credentialsOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+	if _, sessionOpts, err := createSessionWithFailover(context.Background(), &credentialsOpts, signer); err != nil || sessionOpts.Region != "eu-west-1" {
+		t.Log("the region of the replica wasn't used:", sessionOpts.Region, err)
+		t.Fail()
+	}
+
+	// Requests that are rejected aren't failed over
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer rejecting.Close()
+	credentialsOpts.Endpoint = rejecting.URL
+	if _, err := GenerateCredentials(&credentialsOpts); err == nil || atomic.LoadInt32(&requests) != 2 {
+		t.Log("a rejected request was failed over")
+		t.Fail()
+	}
+}
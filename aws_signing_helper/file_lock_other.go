@@ -0,0 +1,19 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly && !windows
+
+package aws_signing_helper
+
+import "os"
+
+// File locking isn't supported on this platform, so concurrent writers
+// aren't excluded
+func lockFile(file *os.File) error {
+	return nil
+}
+
+func tryLockFile(file *os.File) (bool, error) {
+	return true, nil
+}
+
+func unlockFile(file *os.File) error {
+	return nil
+}
@@ -0,0 +1,353 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Signer that uses a private key and certificate read from files on disk
+// (either separate PEM files, a PKCS#12 bundle, or a Java keystore). The files are read
+// again when they change, so that long-running modes pick up certificates
+// that are rotated in place (for example, in a mounted Kubernetes secret,
+// which is updated by swapping a symlink).
+type FileSystemSigner struct {
+	mutex               sync.Mutex
+	privateKeyId        string
+	certificateId       string
+	certificateBundleId string
+	pkcs12Id            string
+	pkcs12Passphrase    string
+	keystoreId          string
+	keystorePassword    string
+	keystoreAlias       string
+	passphraseFile      string
+	passphrase          string
+	ageIdentityFile     string
+	fileVersions        []fileVersion
+	watcher             *fsnotify.Watcher
+	privateKey          crypto.PrivateKey
+	cert                *x509.Certificate
+	certificateChain    []*x509.Certificate
+}
+
+// Identifies the contents of a file, as far as the file system tells
+type fileVersion struct {
+	resolvedPath string
+	modTime      time.Time
+	size         int64
+}
+
+// Creates a signer from the private key, certificate, and (optional)
+// certificate bundle at the provided paths. If the private key is
+// encrypted, it's decrypted with the identities in the age identity file, if
+// one is provided, or else with the passphrase obtained through
+// GetPassphrase.
+func GetFileSystemSigner(privateKeyId string, certificateId string, certificateBundleId string, passphraseFile string, ageIdentityFile string) (Signer, error) {
+	fileSystemSigner := &FileSystemSigner{
+		privateKeyId:        privateKeyId,
+		certificateId:       certificateId,
+		certificateBundleId: certificateBundleId,
+		passphraseFile:      passphraseFile,
+		ageIdentityFile:     ageIdentityFile,
+	}
+	if err := fileSystemSigner.load(); err != nil {
+		return nil, err
+	}
+	return fileSystemSigner, nil
+}
+
+// Paths of the files that the signer reads
+func (fileSystemSigner *FileSystemSigner) paths() []string {
+	var paths []string
+	for _, path := range []string{fileSystemSigner.privateKeyId, fileSystemSigner.certificateId, fileSystemSigner.certificateBundleId, fileSystemSigner.pkcs12Id, fileSystemSigner.keystoreId} {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// Returns the current versions of the signer's files. Symlinks are
+// resolved, since an atomic update may replace the link rather than the
+// file it points to.
+func (fileSystemSigner *FileSystemSigner) currentFileVersions() []fileVersion {
+	var versions []fileVersion
+	for _, path := range fileSystemSigner.paths() {
+		version := fileVersion{}
+		if resolvedPath, err := filepath.EvalSymlinks(path); err == nil {
+			version.resolvedPath = resolvedPath
+			if info, err := os.Stat(resolvedPath); err == nil {
+				version.modTime = info.ModTime()
+				version.size = info.Size()
+			}
+		}
+		versions = append(versions, version)
+	}
+	return versions
+}
+
+// Reads the private key, certificate, and certificate bundle
+func (fileSystemSigner *FileSystemSigner) load() error {
+	fileVersions := fileSystemSigner.currentFileVersions()
+	var privateKey crypto.PrivateKey
+	var cert *x509.Certificate
+	var certificateChain []*x509.Certificate
+	var err error
+	if fileSystemSigner.pkcs12Id != "" {
+		privateKey, cert, certificateChain, err = readPKCS12Bundle(fileSystemSigner.pkcs12Id, fileSystemSigner.pkcs12Passphrase)
+	} else if fileSystemSigner.keystoreId != "" {
+		privateKey, cert, certificateChain, err = readJavaKeyStore(fileSystemSigner.keystoreId, fileSystemSigner.keystorePassword, fileSystemSigner.keystoreAlias)
+	} else {
+		privateKey, err = fileSystemSigner.readPrivateKey()
+		if err == nil {
+			cert, err = readCertificate(fileSystemSigner.certificateId)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if fileSystemSigner.certificateBundleId != "" {
+		certificateChain, err = ReadCertificateBundleData(fileSystemSigner.certificateBundleId)
+		if err != nil {
+			return err
+		}
+	}
+	fileSystemSigner.fileVersions = fileVersions
+	fileSystemSigner.privateKey = privateKey
+	fileSystemSigner.cert = cert
+	fileSystemSigner.certificateChain = certificateChain
+	return nil
+}
+
+// Reads the private key, decrypting it if it's encrypted. A passphrase that
+// was entered at the prompt is kept, so that a rotated key encrypted with the
+// same passphrase can be read without prompting again; a passphrase file is
+// read every time, since it may have been rotated along with the key.
+func (fileSystemSigner *FileSystemSigner) readPrivateKey() (crypto.PrivateKey, error) {
+	privateKey, err := ReadPrivateKeyData(fileSystemSigner.privateKeyId)
+	if !errors.Is(err, ErrEncryptedPrivateKey) {
+		return privateKey, err
+	}
+	if fileSystemSigner.ageIdentityFile != "" {
+		return ReadAgeEncryptedPrivateKeyData(fileSystemSigner.privateKeyId, fileSystemSigner.ageIdentityFile)
+	}
+	passphrase := fileSystemSigner.passphrase
+	if passphrase == "" {
+		passphrase, err = GetPassphrase(fileSystemSigner.passphraseFile, "Please enter the passphrase for the private key:")
+		if err != nil {
+			return nil, err
+		}
+	}
+	privateKey, err = ReadEncryptedPrivateKeyData(fileSystemSigner.privateKeyId, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if fileSystemSigner.passphraseFile == "" {
+		fileSystemSigner.passphrase = passphrase
+	}
+	return privateKey, nil
+}
+
+// Reads the files again if any of them has changed. If they can't be read,
+// or if the new key doesn't match the new certificate (because only some of
+// the files have been updated so far), the current ones keep being used.
+func (fileSystemSigner *FileSystemSigner) reloadIfChanged() {
+	fileVersions := fileSystemSigner.currentFileVersions()
+	changed := len(fileVersions) != len(fileSystemSigner.fileVersions)
+	for i := 0; !changed && i < len(fileVersions); i++ {
+		changed = fileVersions[i] != fileSystemSigner.fileVersions[i]
+	}
+	if changed {
+		fileSystemSigner.reloadFiles()
+	}
+}
+
+// Reads the files again, keeping the current certificate and key if the
+// new ones can't be read or don't match
+func (fileSystemSigner *FileSystemSigner) reloadFiles() {
+	reloaded := &FileSystemSigner{
+		privateKeyId:        fileSystemSigner.privateKeyId,
+		certificateId:       fileSystemSigner.certificateId,
+		certificateBundleId: fileSystemSigner.certificateBundleId,
+		pkcs12Id:            fileSystemSigner.pkcs12Id,
+		pkcs12Passphrase:    fileSystemSigner.pkcs12Passphrase,
+		keystoreId:          fileSystemSigner.keystoreId,
+		keystorePassword:    fileSystemSigner.keystorePassword,
+		keystoreAlias:       fileSystemSigner.keystoreAlias,
+		passphraseFile:      fileSystemSigner.passphraseFile,
+		passphrase:          fileSystemSigner.passphrase,
+		ageIdentityFile:     fileSystemSigner.ageIdentityFile,
+	}
+	if err := reloaded.load(); err != nil {
+		log.Println("unable to reload the certificate and private key, using the current ones:", err)
+		return
+	}
+	if !publicKeysEqual(reloaded.cert.PublicKey, reloaded.public()) {
+		log.Println("the updated private key doesn't match the updated certificate, using the current ones")
+		return
+	}
+	fileSystemSigner.fileVersions = reloaded.fileVersions
+	fileSystemSigner.privateKey = reloaded.privateKey
+	fileSystemSigner.cert = reloaded.cert
+	fileSystemSigner.certificateChain = reloaded.certificateChain
+}
+
+func (fileSystemSigner *FileSystemSigner) Public() crypto.PublicKey {
+	fileSystemSigner.mutex.Lock()
+	defer fileSystemSigner.mutex.Unlock()
+	return fileSystemSigner.public()
+}
+
+func (fileSystemSigner *FileSystemSigner) public() crypto.PublicKey {
+	return privateKeyPublic(fileSystemSigner.privateKey)
+}
+
+// Signs the digest, which has already been computed with the hash
+// function specified in opts (or, for Ed25519 keys, the message itself)
+func (fileSystemSigner *FileSystemSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	fileSystemSigner.mutex.Lock()
+	defer fileSystemSigner.mutex.Unlock()
+	switch key := fileSystemSigner.privateKey.(type) {
+	case ecdsa.PrivateKey:
+		if _, ok := opts.(*deterministicECDSAOptions); ok {
+			return signECDSADeterministic(&key, opts.HashFunc(), digest)
+		}
+		return ecdsa.SignASN1(rand, &key, digest)
+	case rsa.PrivateKey:
+		if pssOpts, ok := opts.(*rsa.PSSOptions); ok {
+			return rsa.SignPSS(rand, &key, opts.HashFunc(), digest, pssOpts)
+		}
+		return rsa.SignPKCS1v15(rand, &key, opts.HashFunc(), digest)
+	case ed25519.PrivateKey:
+		return key.Sign(rand, digest, opts)
+	}
+	log.Println("unsupported algorithm")
+	return nil, errors.New("unsupported algorithm")
+}
+
+// Returns the certificate, after reading the files again if they've
+// changed. Since the certificate is requested before anything is signed,
+// the key that Sign uses afterwards matches it.
+func (fileSystemSigner *FileSystemSigner) Certificate() (*x509.Certificate, error) {
+	fileSystemSigner.mutex.Lock()
+	defer fileSystemSigner.mutex.Unlock()
+	fileSystemSigner.reloadIfChanged()
+	return fileSystemSigner.cert, nil
+}
+
+func (fileSystemSigner *FileSystemSigner) CertificateChain() ([]*x509.Certificate, error) {
+	fileSystemSigner.mutex.Lock()
+	defer fileSystemSigner.mutex.Unlock()
+	return fileSystemSigner.certificateChain, nil
+}
+
+func (fileSystemSigner *FileSystemSigner) supportsPSS() bool {
+	return true
+}
+
+func (fileSystemSigner *FileSystemSigner) supportsDeterministicECDSA() bool {
+	return true
+}
+
+// Watches the directories that hold the signer's files, so that rotated
+// files are reloaded as soon as they've been written, rather than when the
+// signer is next used. Directories are watched (rather than the files
+// themselves), since files are often rotated by renaming a new file, or
+// swapping a symlink, in their place.
+func (fileSystemSigner *FileSystemSigner) watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	dirs := map[string]bool{}
+	for _, path := range fileSystemSigner.paths() {
+		if !isFilePath(path) {
+			continue
+		}
+		dir := filepath.Dir(path)
+		if dirs[dir] {
+			continue
+		}
+		if err = watcher.Add(dir); err != nil {
+			watcher.Close()
+			return err
+		}
+		dirs[dir] = true
+	}
+	fileSystemSigner.mutex.Lock()
+	fileSystemSigner.watcher = watcher
+	fileSystemSigner.mutex.Unlock()
+	go fileSystemSigner.watchEvents(watcher)
+	return nil
+}
+
+// How long to wait for changes to settle before reloading, since the
+// certificate and private key are usually written one after the other
+const watchReloadDelay = 500 * time.Millisecond
+
+func (fileSystemSigner *FileSystemSigner) watchEvents(watcher *fsnotify.Watcher) {
+	var timer *time.Timer
+	for {
+		select {
+		case _, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if timer == nil {
+				timer = time.AfterFunc(watchReloadDelay, fileSystemSigner.reloadWatched)
+			} else {
+				timer.Reset(watchReloadDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Println("error watching the certificate and private key files:", err)
+		}
+	}
+}
+
+// Reads the files again, even if they don't seem to have changed (since
+// a file that is rewritten within the file system's timestamp resolution
+// keeps its modification time), and returns whether the certificate changed
+func (fileSystemSigner *FileSystemSigner) reload() bool {
+	fileSystemSigner.mutex.Lock()
+	defer fileSystemSigner.mutex.Unlock()
+	cert := fileSystemSigner.cert
+	fileSystemSigner.reloadFiles()
+	return !fileSystemSigner.cert.Equal(cert)
+}
+
+func (fileSystemSigner *FileSystemSigner) reloadWatched() {
+	fileSystemSigner.mutex.Lock()
+	defer fileSystemSigner.mutex.Unlock()
+	if fileSystemSigner.watcher == nil {
+		return
+	}
+	cert := fileSystemSigner.cert
+	fileSystemSigner.reloadIfChanged()
+	if fileSystemSigner.cert != cert {
+		log.Println("reloaded the rotated certificate, with serial number", fileSystemSigner.cert.SerialNumber)
+	}
+}
+
+func (fileSystemSigner *FileSystemSigner) Close() {
+	fileSystemSigner.mutex.Lock()
+	defer fileSystemSigner.mutex.Unlock()
+	if fileSystemSigner.watcher != nil {
+		fileSystemSigner.watcher.Close()
+		fileSystemSigner.watcher = nil
+	}
+}
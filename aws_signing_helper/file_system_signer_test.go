@@ -0,0 +1,163 @@
+package aws_signing_helper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Writes the key and certificate into a new timestamped directory, and
+// points the "..data" symlink at it, the way the kubelet updates mounted
+// secrets
+func writeTestSecretVolume(t *testing.T, volume string, version string, privateKeyId string, certificateId string) {
+	dataDir := filepath.Join(volume, "..data_"+version)
+	if err := os.Mkdir(dataDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for source, name := range map[string]string{privateKeyId: "tls.key", certificateId: "tls.crt"} {
+		data, err := os.ReadFile(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(filepath.Join(dataDir, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		link := filepath.Join(volume, name)
+		if _, err = os.Lstat(link); os.IsNotExist(err) {
+			if err = os.Symlink(filepath.Join("..data", name), link); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	tempLink := filepath.Join(volume, "..data_tmp")
+	if err := os.Symlink(filepath.Base(dataDir), tempLink); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tempLink, filepath.Join(volume, "..data")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileSystemSignerReload(t *testing.T) {
+	volume := t.TempDir()
+	writeTestSecretVolume(t, volume, "1", "../tst/certs/ec-prime256v1-key.pem", "../tst/certs/ec-prime256v1-sha256-cert.pem")
+	signer, err := GetFileSystemSigner(filepath.Join(volume, "tls.key"), filepath.Join(volume, "tls.crt"), "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	originalCert, _ := signer.Certificate()
+
+	// The rotated certificate and key are picked up
+	writeTestSecretVolume(t, volume, "2", "../tst/certs/rsa-2048-key.pem", "../tst/certs/rsa-2048-sha256-cert.pem")
+	rotatedCert, _ := signer.Certificate()
+	expectedCert, _ := readCertificate("../tst/certs/rsa-2048-sha256-cert.pem")
+	if !rotatedCert.Equal(expectedCert) || originalCert.Equal(rotatedCert) {
+		t.Log("Expected the rotated certificate to be used")
+		t.Fail()
+	}
+	if !publicKeysEqual(rotatedCert.PublicKey, signer.Public()) {
+		t.Log("Expected the rotated private key to be used")
+		t.Fail()
+	}
+
+	// A key that doesn't match the certificate isn't picked up
+	writeTestSecretVolume(t, volume, "3", "../tst/certs/ec-prime256v1-key.pem", "../tst/certs/rsa-2048-sha256-cert.pem")
+	cert, _ := signer.Certificate()
+	if !cert.Equal(expectedCert) || !publicKeysEqual(cert.PublicKey, signer.Public()) {
+		t.Log("Expected a mismatched key and certificate to be ignored")
+		t.Fail()
+	}
+}
+
+func TestFileSystemSignerWatch(t *testing.T) {
+	volume := t.TempDir()
+	writeTestSecretVolume(t, volume, "1", "../tst/certs/ec-prime256v1-key.pem", "../tst/certs/ec-prime256v1-sha256-cert.pem")
+	signer, err := GetFileSystemSigner(filepath.Join(volume, "tls.key"), filepath.Join(volume, "tls.crt"), "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+	fileSystemSigner := signer.(*FileSystemSigner)
+	if err = fileSystemSigner.watch(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The rotated certificate is loaded without the signer being used
+	writeTestSecretVolume(t, volume, "2", "../tst/certs/rsa-2048-key.pem", "../tst/certs/rsa-2048-sha256-cert.pem")
+	expectedCert, _ := readCertificate("../tst/certs/rsa-2048-sha256-cert.pem")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		fileSystemSigner.mutex.Lock()
+		reloaded := fileSystemSigner.cert.Equal(expectedCert)
+		fileSystemSigner.mutex.Unlock()
+		if reloaded {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the rotated certificate to be loaded")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestCredentialProcessRetryRotatedCertificate(t *testing.T) {
+	volume := t.TempDir()
+	writeTestSecretVolume(t, volume, "1", "../tst/certs/ec-prime256v1-key.pem", "../tst/certs/ec-prime256v1-sha256-cert.pem")
+	signer, err := GetFileSystemSigner(filepath.Join(volume, "tls.key"), filepath.Join(volume, "tls.crt"), "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotatedCert, _ := readCertificate("../tst/certs/rsa-2048-sha256-cert.pem")
+
+	// The service only accepts the rotated certificate, which is written
+	// after the first one was read
+	requests, rotated := 0, false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("X-Amz-X509") != certificateToString(*rotatedCert) {
+			if !rotated {
+				rotated = true
+				writeTestSecretVolume(t, volume, "2", "../tst/certs/rsa-2048-key.pem", "../tst/certs/rsa-2048-sha256-cert.pem")
+			}
+			w.Header().Set("X-Amzn-Errortype", "AccessDeniedException")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message": "Untrusted certificate"}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(mockedCreateSessionResponse))
+	}))
+	defer server.Close()
+
+	credentialsOpts := CredentialsOpts{
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	if _, err = GenerateCredentialsWithSigner(&credentialsOpts, signer); err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+	if requests != 2 {
+		t.Logf("Expected the request to be retried once, got %d requests", requests)
+		t.Fail()
+	}
+
+	// A certificate that is still rejected after being read again isn't
+	// retried again
+	writeTestSecretVolume(t, volume, "3", "../tst/certs/ec-prime256v1-key.pem", "../tst/certs/ec-prime256v1-sha256-cert.pem")
+	requests = 0
+	if _, err = GenerateCredentialsWithSigner(&credentialsOpts, signer); err == nil {
+		t.Log("Expected the rejected certificate to cause an error")
+		t.Fail()
+	}
+	if requests != 1 {
+		t.Logf("Expected no retry when the certificate didn't change, got %d requests", requests)
+		t.Fail()
+	}
+}
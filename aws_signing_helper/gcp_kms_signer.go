@@ -0,0 +1,381 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	gcpKMSScope            = "https://www.googleapis.com/auth/cloudkms"
+	gcpDefaultTokenURI     = "https://oauth2.googleapis.com/token"
+	gcpDefaultMetadataHost = "metadata.google.internal"
+)
+
+// Base URL of the Cloud KMS API (a variable, so that tests can replace it)
+var gcpKMSEndpoint = "https://cloudkms.googleapis.com/v1/"
+
+// Maps the supported digests to the names used by Cloud KMS
+var gcpKMSDigests = map[crypto.Hash]string{
+	crypto.SHA256: "sha256",
+	crypto.SHA384: "sha384",
+	crypto.SHA512: "sha512",
+}
+
+// Signer that uses an asymmetric signing key version in Google Cloud KMS,
+// so that the private key never leaves KMS
+type GCPKMSSigner struct {
+	mutex            sync.Mutex
+	keyVersion       string
+	algorithm        string
+	httpClient       *http.Client
+	credentials      *gcpCredentials
+	token            string
+	tokenExpiry      time.Time
+	cert             *x509.Certificate
+	certificateChain []*x509.Certificate
+}
+
+// Application Default Credentials, as found in GOOGLE_APPLICATION_CREDENTIALS
+// or the file that `gcloud auth application-default login` writes. When
+// neither exists, tokens are obtained from the metadata server.
+type gcpCredentials struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyId string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+	ClientId     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Creates a signer that uses the given KMS key version
+// (projects/<project>/locations/<location>/keyRings/<key ring>/cryptoKeys/<key>/cryptoKeyVersions/<version>),
+// along with the certificate (and, optionally, certificate bundle) at the
+// provided paths. The certificate has to match the key version's public key.
+func GetGCPKMSSigner(keyVersion string, certificateId string, certificateBundleId string) (Signer, error) {
+	keyVersion = strings.Trim(keyVersion, "/")
+	if !strings.HasPrefix(keyVersion, "projects/") || !strings.Contains(keyVersion, "/cryptoKeyVersions/") {
+		return nil, errors.New("the Cloud KMS key has to be the resource name of a key version (projects/.../cryptoKeyVersions/<version>)")
+	}
+	if certificateId == "" {
+		return nil, errors.New("a certificate is required with a Cloud KMS key")
+	}
+	cert, err := readCertificate(certificateId)
+	if err != nil {
+		return nil, err
+	}
+	var certificateChain []*x509.Certificate
+	if certificateBundleId != "" {
+		if certificateChain, err = ReadCertificateBundleData(certificateBundleId); err != nil {
+			return nil, err
+		}
+	}
+	credentials, err := findGCPCredentials()
+	if err != nil {
+		return nil, err
+	}
+	signer := &GCPKMSSigner{
+		keyVersion:       keyVersion,
+		httpClient:       &http.Client{Timeout: 30 * time.Second},
+		credentials:      credentials,
+		cert:             cert,
+		certificateChain: certificateChain,
+	}
+	if err = signer.checkPublicKey(); err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
+
+// Reads the Application Default Credentials file, if there's one
+func findGCPCredentials() (*gcpCredentials, error) {
+	path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if path == "" {
+		if runtime.GOOS == "windows" {
+			path = filepath.Join(os.Getenv("APPDATA"), "gcloud", "application_default_credentials.json")
+		} else if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, ".config", "gcloud", "application_default_credentials.json")
+		}
+		if _, err := os.Stat(path); err != nil {
+			return nil, nil
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var credentials gcpCredentials
+	if err = json.Unmarshal(data, &credentials); err != nil {
+		return nil, fmt.Errorf("could not parse the Google credentials in %s: %w", path, err)
+	}
+	switch credentials.Type {
+	case "service_account", "authorized_user":
+	default:
+		return nil, fmt.Errorf("unsupported Google credentials type %q in %s", credentials.Type, path)
+	}
+	if credentials.TokenURI == "" {
+		credentials.TokenURI = gcpDefaultTokenURI
+	}
+	return &credentials, nil
+}
+
+// Creates the signed JWT with which a service account obtains an access token
+func (credentials *gcpCredentials) jwtAssertion() (string, error) {
+	block, _ := pem.Decode([]byte(credentials.PrivateKey))
+	if block == nil {
+		return "", errors.New("could not parse the service account private key")
+	}
+	parsedKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+	privateKey, ok := parsedKey.(*rsa.PrivateKey)
+	if !ok {
+		return "", errors.New("the service account private key isn't an RSA key")
+	}
+
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": credentials.PrivateKeyId})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   credentials.ClientEmail,
+		"scope": gcpKMSScope,
+		"aud":   credentials.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// Obtains an access token for Cloud KMS, with the service account key or
+// user refresh token in the credentials file, or else from the metadata
+// server of the instance the helper is running on
+func (signer *GCPKMSSigner) getToken() (string, error) {
+	if signer.token != "" && time.Now().Add(5*time.Minute).Before(signer.tokenExpiry) {
+		return signer.token, nil
+	}
+
+	var request *http.Request
+	var err error
+	credentials := signer.credentials
+	if credentials != nil {
+		form := url.Values{}
+		if credentials.Type == "service_account" {
+			assertion, err := credentials.jwtAssertion()
+			if err != nil {
+				return "", err
+			}
+			form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+			form.Set("assertion", assertion)
+		} else {
+			form.Set("grant_type", "refresh_token")
+			form.Set("client_id", credentials.ClientId)
+			form.Set("client_secret", credentials.ClientSecret)
+			form.Set("refresh_token", credentials.RefreshToken)
+		}
+		if request, err = http.NewRequest(http.MethodPost, credentials.TokenURI, strings.NewReader(form.Encode())); err != nil {
+			return "", err
+		}
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		metadataHost := os.Getenv("GCE_METADATA_HOST")
+		if metadataHost == "" {
+			metadataHost = gcpDefaultMetadataHost
+		}
+		tokenURL := "http://" + metadataHost + "/computeMetadata/v1/instance/service-accounts/default/token?scopes=" + url.QueryEscape(gcpKMSScope)
+		if request, err = http.NewRequest(http.MethodGet, tokenURL, nil); err != nil {
+			return "", err
+		}
+		request.Header.Set("Metadata-Flavor", "Google")
+	}
+
+	var response struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err = signer.do(request, &response); err != nil {
+		return "", fmt.Errorf("unable to obtain a Google access token: %w", err)
+	}
+	signer.token = response.AccessToken
+	signer.tokenExpiry = time.Now().Add(time.Duration(response.ExpiresIn) * time.Second)
+	return signer.token, nil
+}
+
+// Makes an authenticated request to the Cloud KMS API
+func (signer *GCPKMSSigner) request(method string, path string, body interface{}, response interface{}) error {
+	token, err := signer.getToken()
+	if err != nil {
+		return err
+	}
+	var requestBody io.Reader
+	if body != nil {
+		bodyData, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		requestBody = bytes.NewReader(bodyData)
+	}
+	request, err := http.NewRequest(method, gcpKMSEndpoint+path, requestBody)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	return signer.do(request, response)
+}
+
+func (signer *GCPKMSSigner) do(request *http.Request, response interface{}) error {
+	httpResponse, err := signer.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer httpResponse.Body.Close()
+	responseData, err := io.ReadAll(httpResponse.Body)
+	if err != nil {
+		return err
+	}
+	if httpResponse.StatusCode < 200 || httpResponse.StatusCode > 299 {
+		// Google APIs return {"error":{"message":...}}, whereas the OAuth
+		// token endpoint returns {"error":...,"error_description":...}
+		var errorResponse struct {
+			Error json.RawMessage `json:"error"`
+		}
+		var apiError struct {
+			Message string `json:"message"`
+		}
+		var oauthError struct {
+			Description string `json:"error_description"`
+		}
+		if json.Unmarshal(responseData, &errorResponse) == nil && json.Unmarshal(errorResponse.Error, &apiError) == nil && apiError.Message != "" {
+			return fmt.Errorf("request failed with status %d: %s", httpResponse.StatusCode, apiError.Message)
+		}
+		if json.Unmarshal(responseData, &oauthError) == nil && oauthError.Description != "" {
+			return fmt.Errorf("request failed with status %d: %s", httpResponse.StatusCode, oauthError.Description)
+		}
+		return fmt.Errorf("request failed with status %d", httpResponse.StatusCode)
+	}
+	return json.Unmarshal(responseData, response)
+}
+
+// Checks that the key version is one that signs in a way that Roles
+// Anywhere accepts, and that it matches the certificate
+func (signer *GCPKMSSigner) checkPublicKey() error {
+	var response struct {
+		Pem       string `json:"pem"`
+		Algorithm string `json:"algorithm"`
+	}
+	if err := signer.request(http.MethodGet, signer.keyVersion+"/publicKey", nil, &response); err != nil {
+		return fmt.Errorf("unable to fetch the Cloud KMS public key: %w", err)
+	}
+	if !strings.HasPrefix(response.Algorithm, "RSA_SIGN_PKCS1_") && !strings.HasPrefix(response.Algorithm, "RSA_SIGN_PSS_") && !strings.HasPrefix(response.Algorithm, "EC_SIGN_P") {
+		return fmt.Errorf("unsupported Cloud KMS key algorithm %s (only PKCS #1 v1.5 and PSS RSA keys, and NIST curve ECDSA keys are supported)", response.Algorithm)
+	}
+	signer.algorithm = response.Algorithm
+	block, _ := pem.Decode([]byte(response.Pem))
+	if block == nil {
+		return errors.New("unexpected public key format from Cloud KMS")
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+	matches := false
+	switch certPublicKey := signer.cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		matches = certPublicKey.Equal(publicKey)
+	case *ecdsa.PublicKey:
+		matches = certPublicKey.Equal(publicKey)
+	default:
+		return errors.New("unsupported certificate key type")
+	}
+	if !matches {
+		return errors.New("the certificate doesn't match the Cloud KMS key version")
+	}
+	return nil
+}
+
+func (signer *GCPKMSSigner) Public() crypto.PublicKey {
+	return signer.cert.PublicKey
+}
+
+// Signs the digest with the key version. Since the digest algorithm is
+// fixed for each key version, KMS rejects digests of other algorithms.
+func (signer *GCPKMSSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	digestName, ok := gcpKMSDigests[opts.HashFunc()]
+	if !ok {
+		return nil, errors.New("unsupported digest")
+	}
+	if _, usePSS := opts.(*rsa.PSSOptions); usePSS != strings.HasPrefix(signer.algorithm, "RSA_SIGN_PSS_") {
+		return nil, fmt.Errorf("the Cloud KMS key algorithm %s doesn't match the requested signing algorithm", signer.algorithm)
+	}
+	signer.mutex.Lock()
+	defer signer.mutex.Unlock()
+	request := map[string]interface{}{
+		"digest": map[string]string{digestName: base64.StdEncoding.EncodeToString(digest)},
+	}
+	var response struct {
+		Signature string `json:"signature"`
+	}
+	if err := signer.request(http.MethodPost, signer.keyVersion+":asymmetricSign", request, &response); err != nil {
+		return nil, fmt.Errorf("Cloud KMS signing failed: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(response.Signature)
+	if err != nil {
+		return nil, errors.New("unexpected signature format from Cloud KMS")
+	}
+
+	valid := false
+	switch publicKey := signer.cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		valid = verifyRSASignature(publicKey, digest, sig, opts)
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(publicKey, digest, sig)
+	}
+	if !valid {
+		return nil, errors.New("the Cloud KMS signature doesn't match the certificate")
+	}
+	return sig, nil
+}
+
+// Only key versions with a PSS algorithm produce PSS signatures
+func (signer *GCPKMSSigner) supportsPSS() bool {
+	return strings.HasPrefix(signer.algorithm, "RSA_SIGN_PSS_")
+}
+
+func (signer *GCPKMSSigner) Certificate() (*x509.Certificate, error) {
+	return signer.cert, nil
+}
+
+func (signer *GCPKMSSigner) CertificateChain() ([]*x509.Certificate, error) {
+	return signer.certificateChain, nil
+}
+
+func (signer *GCPKMSSigner) Close() {
+}
@@ -0,0 +1,161 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testGCPKMSKeyVersion = "projects/test/locations/global/keyRings/test/cryptoKeys/test/cryptoKeyVersions/1"
+
+// Serves the OAuth token endpoint and the Cloud KMS publicKey and
+// asymmetricSign operations for the given key, and points the Application
+// Default Credentials at a test service account
+func startTestGCPKMS(t *testing.T, privateKeyId string) {
+	privateKey, err := ReadPrivateKeyData(privateKeyId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var publicKey crypto.PublicKey
+	var algorithm string
+	switch key := privateKey.(type) {
+	case ecdsa.PrivateKey:
+		publicKey, algorithm = &key.PublicKey, "EC_SIGN_P256_SHA256"
+	case rsa.PrivateKey:
+		publicKey, algorithm = &key.PublicKey, "RSA_SIGN_PKCS1_2048_SHA256"
+	}
+	publicKeyDer, _ := x509.MarshalPKIXPublicKey(publicKey)
+
+	serviceAccountKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	serviceAccountKeyDer, _ := x509.MarshalPKCS8PrivateKey(serviceAccountKey)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		parts := strings.Split(r.PostForm.Get("assertion"), ".")
+		if r.PostForm.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" || len(parts) != 3 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		if rsa.VerifyPKCS1v15(&serviceAccountKey.PublicKey, crypto.SHA256, digest[:], sig) != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "Invalid JWT Signature."})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "test-token", "expires_in": 3600})
+	})
+	mux.HandleFunc("/v1/"+testGCPKMSKeyVersion+"/publicKey", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"pem":       string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDer})),
+			"algorithm": algorithm,
+		})
+	})
+	mux.HandleFunc("/v1/"+testGCPKMSKeyVersion+":asymmetricSign", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var request struct {
+			Digest struct {
+				Sha256 string `json:"sha256"`
+			} `json:"digest"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		digest, _ := base64.StdEncoding.DecodeString(request.Digest.Sha256)
+		var sig []byte
+		switch key := privateKey.(type) {
+		case ecdsa.PrivateKey:
+			sig, _ = ecdsa.SignASN1(rand.Reader, &key, digest)
+		case rsa.PrivateKey:
+			sig, _ = rsa.SignPKCS1v15(rand.Reader, &key, crypto.SHA256, digest)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"signature": base64.StdEncoding.EncodeToString(sig)})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	credentials, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "test@test.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: serviceAccountKeyDer})),
+		"token_uri":    server.URL + "/token",
+	})
+	credentialsPath := filepath.Join(t.TempDir(), "credentials.json")
+	if err = os.WriteFile(credentialsPath, credentials, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", credentialsPath)
+
+	endpoint := gcpKMSEndpoint
+	gcpKMSEndpoint = server.URL + "/v1/"
+	t.Cleanup(func() { gcpKMSEndpoint = endpoint })
+}
+
+func TestGCPKMSSigner(t *testing.T) {
+	fixtures := []struct {
+		privateKeyId  string
+		certificateId string
+	}{
+		{"../tst/certs/ec-prime256v1-key.pem", "../tst/certs/ec-prime256v1-sha256-cert.pem"},
+		{"../tst/certs/rsa-2048-key.pem", "../tst/certs/rsa-2048-sha256-cert.pem"},
+	}
+	msg := []byte("test message")
+	digest := sha256.Sum256(msg)
+	for _, fixture := range fixtures {
+		startTestGCPKMS(t, fixture.privateKeyId)
+		signer, err := GetGCPKMSSigner(testGCPKMSKeyVersion, fixture.certificateId, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, _ := signer.Certificate()
+		signingResult, err := Sign(msg, SigningOpts{signer, crypto.SHA256})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, _ := hex.DecodeString(signingResult.Signature)
+
+		valid := false
+		switch publicKey := cert.PublicKey.(type) {
+		case *ecdsa.PublicKey:
+			valid = ecdsa.VerifyASN1(publicKey, digest[:], sig)
+		case *rsa.PublicKey:
+			valid = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], sig) == nil
+		}
+		if !valid {
+			t.Logf("Failed to verify the signature for %s", fixture.certificateId)
+			t.Fail()
+		}
+	}
+}
+
+func TestGCPKMSSignerMismatchedCertificate(t *testing.T) {
+	startTestGCPKMS(t, "../tst/certs/ec-prime256v1-key.pem")
+	_, err := GetGCPKMSSigner(testGCPKMSKeyVersion, "../tst/certs/rsa-2048-sha256-cert.pem", "")
+	if err == nil || !strings.Contains(err.Error(), "doesn't match") {
+		t.Log("Expected a certificate that doesn't match the key version to be rejected, got:", err)
+		t.Fail()
+	}
+}
+
+func TestGCPKMSSignerKeyName(t *testing.T) {
+	_, err := GetGCPKMSSigner("projects/test/locations/global/keyRings/test/cryptoKeys/test", "../tst/certs/rsa-2048-sha256-cert.pem", "")
+	if err == nil {
+		t.Log("Expected a key name without a version to be rejected")
+		t.Fail()
+	}
+}
@@ -0,0 +1,96 @@
+package aws_signing_helper
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Matches the hosts of CodeCommit's Git HTTPS endpoints, capturing their
+// region
+var codeCommitHostPattern = regexp.MustCompile(`^git-codecommit(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(?:\.cn)?$`)
+
+// Reads the attributes that Git passes to a credential helper, one
+// key=value pair per line, until a blank line or the end of the input
+func readGitCredentialAttributes(in io.Reader) (map[string]string, error) {
+	attributes := make(map[string]string)
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			break
+		}
+		keyAndValue := strings.SplitN(line, "=", 2)
+		if len(keyAndValue) != 2 {
+			return nil, fmt.Errorf("invalid credential attribute: %s", line)
+		}
+		attributes[keyAndValue[0]] = keyAndValue[1]
+	}
+	return attributes, scanner.Err()
+}
+
+// Returns the password with which CodeCommit accepts the given credentials
+// for the repository at the given host and path: the signing time, followed
+// by a Signature Version 4 signature of a GIT request for the repository
+func codeCommitPassword(credentialProcessOutput CredentialProcessOutput, host string, path string, region string, signingTime time.Time) string {
+	timestamp := signingTime.UTC().Format("20060102T150405")
+	date := timestamp[:8]
+	canonicalRequest := fmt.Sprintf("GIT\n%s\n\nhost:%s\n\nhost\n", path, host)
+	canonicalRequestDigest := sha256.Sum256([]byte(canonicalRequest))
+	scope := date + "/" + region + "/codecommit/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + timestamp + "\n" + scope + "\n" + hex.EncodeToString(canonicalRequestDigest[:])
+
+	key := []byte("AWS4" + credentialProcessOutput.SecretAccessKey)
+	for _, data := range []string{date, region, "codecommit", "aws4_request", stringToSign} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(data))
+		key = mac.Sum(nil)
+	}
+	return timestamp + "Z" + hex.EncodeToString(key)
+}
+
+// Implements Git's credential helper protocol for CodeCommit's HTTPS
+// endpoints. For get, temporary credentials for the role are obtained, and
+// turned into the user name and password that CodeCommit accepts for the
+// repository. Requests for other hosts are left to other helpers, and,
+// since the credentials are derived rather than stored, store and erase have
+// nothing to do.
+func ServeGitCredentials(opts *CredentialsOpts, action string, in io.Reader, out io.Writer) error {
+	attributes, err := readGitCredentialAttributes(in)
+	if err != nil {
+		return err
+	}
+	switch action {
+	case "get":
+	case "store", "erase":
+		return nil
+	default:
+		return fmt.Errorf("unknown action: %s", action)
+	}
+	if attributes["protocol"] != "https" {
+		return nil
+	}
+	// CodeCommit doesn't sign the port
+	host := strings.SplitN(attributes["host"], ":", 2)[0]
+	match := codeCommitHostPattern.FindStringSubmatch(host)
+	if match == nil {
+		return nil
+	}
+	credentialProcessOutput, err := GenerateCredentials(opts)
+	if err != nil {
+		return err
+	}
+	username := credentialProcessOutput.AccessKeyId
+	if credentialProcessOutput.SessionToken != "" {
+		username += "%" + credentialProcessOutput.SessionToken
+	}
+	password := codeCommitPassword(credentialProcessOutput, host, "/"+attributes["path"], match[1], signingTime())
+	_, err = fmt.Fprintf(out, "username=%s\npassword=%s\n", username, password)
+	return err
+}
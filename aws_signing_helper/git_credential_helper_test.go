@@ -0,0 +1,53 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCodeCommitPassword(t *testing.T) {
+	credentialProcessOutput := CredentialProcessOutput{
+		AccessKeyId:     "accessKeyId",
+		SecretAccessKey: "secretAccessKey",
+		SessionToken:    "sessionToken",
+	}
+	password := codeCommitPassword(credentialProcessOutput, "git-codecommit.us-east-1.amazonaws.com", "/v1/repos/example", "us-east-1", time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	expected := "20230101T000000Z3804a1979f92e2f5b8399e58b32a55cc47db531136a80f27feb64f269ac7c527"
+	if password != expected {
+		t.Log("unexpected password:", password)
+		t.Fail()
+	}
+}
+
+func TestServeGitCredentials(t *testing.T) {
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+
+	var out bytes.Buffer
+	request := "protocol=https\nhost=git-codecommit.us-east-1.amazonaws.com\npath=v1/repos/example\n\n"
+	if err := ServeGitCredentials(&credentialsOpts, "get", strings.NewReader(request), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "username=accessKeyId%sessionToken\npassword=") {
+		t.Log("unexpected output:", out.String())
+		t.Fail()
+	}
+
+	out.Reset()
+	request = "protocol=https\nhost=github.com\npath=example/example.git\n\n"
+	if err := ServeGitCredentials(&credentialsOpts, "get", strings.NewReader(request), &out); err != nil || out.Len() != 0 {
+		t.Log("unexpected result for a host other than CodeCommit:", out.String(), err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,370 @@
+package aws_signing_helper
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Hash algorithm names, as understood by gpg-agent's SETHASH command
+var gpgHashAlgorithms = map[crypto.Hash]string{
+	crypto.SHA256: "sha256",
+	crypto.SHA384: "sha384",
+	crypto.SHA512: "sha512",
+}
+
+// Signer that uses a key held by gpg-agent (including keys on OpenPGP
+// cards), identified by its keygrip. gpg-agent is spoken to through its
+// Assuan protocol, and takes care of prompting for the PIN itself.
+type GPGAgentSigner struct {
+	socket           string
+	keygrip          string
+	public           crypto.PublicKey
+	cert             *x509.Certificate
+	certificateChain []*x509.Certificate
+}
+
+// Connection to gpg-agent
+type assuanConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// Finds the socket of gpg-agent, preferably by asking gpgconf
+func gpgAgentSocket() (string, error) {
+	output, err := exec.Command("gpgconf", "--list-dirs", "agent-socket").Output()
+	if err == nil && len(bytes.TrimSpace(output)) != 0 {
+		return string(bytes.TrimSpace(output)), nil
+	}
+	gnupgHome := os.Getenv("GNUPGHOME")
+	if gnupgHome == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", errors.New("unable to locate the gpg-agent socket")
+		}
+		gnupgHome = filepath.Join(homeDir, ".gnupg")
+	}
+	return filepath.Join(gnupgHome, "S.gpg-agent"), nil
+}
+
+func dialAssuan(socket string) (*assuanConn, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to gpg-agent: %w", err)
+	}
+	assuan := &assuanConn{conn, bufio.NewReader(conn)}
+	// The server greets the client with an OK line
+	if _, err = assuan.readResponse(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return assuan, nil
+}
+
+// Sends a command, and returns the data that is sent in response to it.
+// Inquiries from the server (for example, about a launched pinentry) are
+// answered with an empty response.
+func (assuan *assuanConn) transact(command string) ([]byte, error) {
+	if _, err := io.WriteString(assuan.conn, command+"\n"); err != nil {
+		return nil, err
+	}
+	return assuan.readResponse()
+}
+
+func (assuan *assuanConn) readResponse() ([]byte, error) {
+	var data []byte
+	for {
+		line, err := assuan.reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the gpg-agent response: %w", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "OK" || strings.HasPrefix(line, "OK "):
+			return data, nil
+		case strings.HasPrefix(line, "ERR "):
+			return nil, fmt.Errorf("gpg-agent error: %s", strings.TrimPrefix(line, "ERR "))
+		case strings.HasPrefix(line, "D "):
+			decoded, err := url.PathUnescape(strings.TrimPrefix(line, "D "))
+			if err != nil {
+				return nil, errors.New("invalid data in the gpg-agent response")
+			}
+			data = append(data, decoded...)
+		case strings.HasPrefix(line, "INQUIRE "):
+			if _, err := io.WriteString(assuan.conn, "END\n"); err != nil {
+				return nil, err
+			}
+		}
+		// Status ("S") and comment ("#") lines are ignored
+	}
+}
+
+func (assuan *assuanConn) Close() {
+	assuan.conn.Close()
+}
+
+// Creates a signer that uses the gpg-agent key with the given keygrip (as
+// shown by `gpg --with-keygrip -K`), along with the certificate (and,
+// optionally, certificate bundle) at the provided paths
+func GetGPGAgentSigner(keygrip string, certificateId string, certificateBundleId string) (Signer, error) {
+	if _, err := hex.DecodeString(keygrip); err != nil || len(keygrip) != 40 {
+		return nil, errors.New("invalid keygrip")
+	}
+	cert, err := readCertificate(certificateId)
+	if err != nil {
+		return nil, err
+	}
+	var certificateChain []*x509.Certificate
+	if certificateBundleId != "" {
+		if certificateChain, err = ReadCertificateBundleData(certificateBundleId); err != nil {
+			return nil, err
+		}
+	}
+
+	socket, err := gpgAgentSocket()
+	if err != nil {
+		return nil, err
+	}
+	assuan, err := dialAssuan(socket)
+	if err != nil {
+		return nil, err
+	}
+	defer assuan.Close()
+	publicKeyData, err := assuan.transact("READKEY " + keygrip)
+	if err != nil {
+		return nil, err
+	}
+	public, err := parseGPGPublicKey(publicKeyData)
+	if err != nil {
+		return nil, err
+	}
+	if !publicKeysEqual(cert.PublicKey, public) {
+		return nil, errors.New("the certificate doesn't match the gpg-agent key")
+	}
+	return &GPGAgentSigner{socket, strings.ToUpper(keygrip), public, cert, certificateChain}, nil
+}
+
+func (gpgAgentSigner *GPGAgentSigner) Public() crypto.PublicKey {
+	return gpgAgentSigner.public
+}
+
+// Signs the digest with the gpg-agent key. A new connection is made to the
+// agent every time, so that a restarted agent doesn't break daemon modes.
+func (gpgAgentSigner *GPGAgentSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hashAlgorithm, ok := gpgHashAlgorithms[opts.HashFunc()]
+	if !ok {
+		return nil, errors.New("unsupported digest")
+	}
+
+	assuan, err := dialAssuan(gpgAgentSigner.socket)
+	if err != nil {
+		return nil, err
+	}
+	defer assuan.Close()
+	if gpgTTY := os.Getenv("GPG_TTY"); gpgTTY != "" {
+		if _, err = assuan.transact("OPTION ttyname=" + gpgTTY); err != nil {
+			return nil, err
+		}
+	}
+	if _, err = assuan.transact("SIGKEY " + gpgAgentSigner.keygrip); err != nil {
+		return nil, err
+	}
+	if _, err = assuan.transact(fmt.Sprintf("SETHASH --hash=%s %X", hashAlgorithm, digest)); err != nil {
+		return nil, err
+	}
+	sigData, err := assuan.transact("PKSIGN")
+	if err != nil {
+		return nil, err
+	}
+	return parseGPGSignature(sigData, gpgAgentSigner.public)
+}
+
+func (gpgAgentSigner *GPGAgentSigner) Certificate() (*x509.Certificate, error) {
+	return gpgAgentSigner.cert, nil
+}
+
+func (gpgAgentSigner *GPGAgentSigner) CertificateChain() ([]*x509.Certificate, error) {
+	return gpgAgentSigner.certificateChain, nil
+}
+
+func (gpgAgentSigner *GPGAgentSigner) Close() {
+}
+
+// Parses a public key S-expression, as returned by READKEY. For example,
+// (10:public-key(3:rsa(1:n...)(1:e...))) or
+// (10:public-key(3:ecc(5:curve10:NIST P-256)(1:q...)))
+func parseGPGPublicKey(data []byte) (crypto.PublicKey, error) {
+	sexp, err := parseSexp(data)
+	if err != nil {
+		return nil, err
+	}
+	key := sexp.sublist("public-key")
+	if key == nil || len(key.items) < 1 {
+		return nil, errors.New("invalid public key")
+	}
+	if rsaKey := key.sublist("rsa"); rsaKey != nil {
+		n, e := rsaKey.value("n"), rsaKey.value("e")
+		if n == nil || e == nil {
+			return nil, errors.New("invalid RSA public key")
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA public key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	}
+	if ecKey := key.sublist("ecc"); ecKey != nil {
+		var curve elliptic.Curve
+		switch string(ecKey.value("curve")) {
+		case "NIST P-256", "nistp256", "prime256v1", "secp256r1":
+			curve = elliptic.P256()
+		case "NIST P-384", "nistp384", "secp384r1":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %s", ecKey.value("curve"))
+		}
+		x, y := elliptic.Unmarshal(curve, ecKey.value("q"))
+		if x == nil {
+			return nil, errors.New("invalid EC public key")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, errors.New("unsupported key type")
+}
+
+// Parses a signature S-expression, as returned by PKSIGN. For example,
+// (7:sig-val(3:rsa(1:s...))) or (7:sig-val(5:ecdsa(1:r...)(1:s...)))
+func parseGPGSignature(data []byte, public crypto.PublicKey) ([]byte, error) {
+	sexp, err := parseSexp(data)
+	if err != nil {
+		return nil, err
+	}
+	sigVal := sexp.sublist("sig-val")
+	if sigVal == nil {
+		return nil, errors.New("invalid signature")
+	}
+	switch publicKey := public.(type) {
+	case *rsa.PublicKey:
+		rsaSig := sigVal.sublist("rsa")
+		if rsaSig == nil || rsaSig.value("s") == nil {
+			return nil, errors.New("invalid RSA signature")
+		}
+		// The signature may have lost its leading zeroes
+		sig := rsaSig.value("s")
+		padded := make([]byte, publicKey.Size())
+		if len(sig) > len(padded) {
+			return nil, errors.New("invalid RSA signature")
+		}
+		copy(padded[len(padded)-len(sig):], sig)
+		return padded, nil
+	case *ecdsa.PublicKey:
+		ecSig := sigVal.sublist("ecdsa")
+		if ecSig == nil || ecSig.value("r") == nil || ecSig.value("s") == nil {
+			return nil, errors.New("invalid ECDSA signature")
+		}
+		return asn1.Marshal(struct {
+			R, S *big.Int
+		}{new(big.Int).SetBytes(ecSig.value("r")), new(big.Int).SetBytes(ecSig.value("s"))})
+	default:
+		return nil, errors.New("unsupported algorithm")
+	}
+}
+
+// Node of a canonical S-expression: either an atom, or a list
+type sexpNode struct {
+	atom  []byte
+	items []*sexpNode
+}
+
+// Parses a canonical S-expression, in which atoms are prefixed with their
+// length (for example, "(3:foo3:bar)")
+func parseSexp(data []byte) (*sexpNode, error) {
+	node, rest, err := parseSexpNode(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimRight(rest, "\x00\n")) != 0 {
+		return nil, errors.New("trailing data after S-expression")
+	}
+	return node, nil
+}
+
+func parseSexpNode(data []byte) (*sexpNode, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, errors.New("truncated S-expression")
+	}
+	if data[0] == '(' {
+		node := &sexpNode{items: []*sexpNode{}}
+		data = data[1:]
+		for {
+			if len(data) == 0 {
+				return nil, nil, errors.New("truncated S-expression")
+			}
+			if data[0] == ')' {
+				return node, data[1:], nil
+			}
+			item, rest, err := parseSexpNode(data)
+			if err != nil {
+				return nil, nil, err
+			}
+			node.items = append(node.items, item)
+			data = rest
+		}
+	}
+
+	colon := bytes.IndexByte(data, ':')
+	if colon <= 0 {
+		return nil, nil, errors.New("invalid S-expression atom")
+	}
+	length, err := strconv.Atoi(string(data[:colon]))
+	if err != nil || length < 0 || len(data)-colon-1 < length {
+		return nil, nil, errors.New("invalid S-expression atom")
+	}
+	atom := data[colon+1 : colon+1+length]
+	return &sexpNode{atom: atom}, data[colon+1+length:], nil
+}
+
+// Returns the list whose first item is the given name, searching the node
+// itself and its immediate children
+func (node *sexpNode) sublist(name string) *sexpNode {
+	if node.isNamed(name) {
+		return node
+	}
+	for _, item := range node.items {
+		if item.isNamed(name) {
+			return item
+		}
+	}
+	return nil
+}
+
+// Returns the value of the (name value) pair among the node's children
+func (node *sexpNode) value(name string) []byte {
+	for _, item := range node.items {
+		if item.isNamed(name) && len(item.items) == 2 {
+			return item.items[1].atom
+		}
+	}
+	return nil
+}
+
+func (node *sexpNode) isNamed(name string) bool {
+	return node.items != nil && len(node.items) > 0 && string(node.items[0].atom) == name
+}
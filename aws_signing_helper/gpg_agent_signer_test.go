@@ -0,0 +1,199 @@
+package aws_signing_helper
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testKeygrip = "0123456789ABCDEF0123456789ABCDEF01234567"
+
+// Encodes the atoms and lists as a canonical S-expression
+func testSexp(items ...interface{}) string {
+	var sexp strings.Builder
+	sexp.WriteString("(")
+	for _, item := range items {
+		switch value := item.(type) {
+		case string:
+			fmt.Fprintf(&sexp, "%d:%s", len(value), value)
+		case []byte:
+			fmt.Fprintf(&sexp, "%d:%s", len(value), value)
+		}
+	}
+	sexp.WriteString(")")
+	return sexp.String()
+}
+
+// Escapes data for an Assuan "D" line
+func testAssuanEscape(data string) string {
+	data = strings.ReplaceAll(data, "%", "%25")
+	data = strings.ReplaceAll(data, "\n", "%0A")
+	return strings.ReplaceAll(data, "\r", "%0D")
+}
+
+// Serves a single gpg-agent connection, using the given private key for the
+// test keygrip
+func serveTestGPGAgent(t *testing.T, conn net.Conn, privateKey crypto.Signer) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	fmt.Fprint(conn, "OK Pleased to meet you\n")
+	var digest []byte
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+			fmt.Fprint(conn, "ERR 1 empty command\n")
+		case fields[0] == "READKEY" || fields[0] == "SIGKEY":
+			if len(fields) != 2 || fields[1] != testKeygrip {
+				fmt.Fprint(conn, "ERR 67108881 No secret key\n")
+				continue
+			}
+			if fields[0] == "READKEY" {
+				var publicKey string
+				switch key := privateKey.Public().(type) {
+				case *rsa.PublicKey:
+					publicKey = "(10:public-key" + testSexp("rsa") + ")"
+					publicKey = publicKey[:len(publicKey)-2] + testSexp("n", key.N.Bytes()) + testSexp("e", big.NewInt(int64(key.E)).Bytes()) + "))"
+				case *ecdsa.PublicKey:
+					q := elliptic.Marshal(key.Curve, key.X, key.Y)
+					publicKey = "(10:public-key(3:ecc" + testSexp("curve", "NIST P-256") + testSexp("q", q) + "))"
+				}
+				fmt.Fprintf(conn, "D %s\n", testAssuanEscape(publicKey))
+			}
+			fmt.Fprint(conn, "OK\n")
+		case fields[0] == "SETHASH":
+			if len(fields) != 3 || fields[1] != "--hash=sha256" {
+				fmt.Fprint(conn, "ERR 1 unsupported hash\n")
+				continue
+			}
+			digest, _ = hex.DecodeString(fields[2])
+			fmt.Fprint(conn, "OK\n")
+		case fields[0] == "PKSIGN":
+			// The client has to answer inquiries before getting the result
+			fmt.Fprint(conn, "INQUIRE PINENTRY_LAUNCHED 1234\n")
+			if response, err := reader.ReadString('\n'); err != nil || response != "END\n" {
+				return
+			}
+			sig, err := privateKey.Sign(rand.Reader, digest, crypto.SHA256)
+			if err != nil {
+				fmt.Fprint(conn, "ERR 1 signing failed\n")
+				continue
+			}
+			var sigVal string
+			switch privateKey.Public().(type) {
+			case *rsa.PublicKey:
+				sigVal = "(7:sig-val(3:rsa" + testSexp("s", sig) + "))"
+			case *ecdsa.PublicKey:
+				var ecSig struct{ R, S *big.Int }
+				asn1.Unmarshal(sig, &ecSig)
+				sigVal = "(7:sig-val(5:ecdsa" + testSexp("r", ecSig.R.Bytes()) + testSexp("s", ecSig.S.Bytes()) + "))"
+			}
+			fmt.Fprint(conn, "S INQUIRE_MAXLEN 255\n")
+			fmt.Fprintf(conn, "D %s\nOK\n", testAssuanEscape(sigVal))
+		default:
+			fmt.Fprint(conn, "OK\n")
+		}
+	}
+}
+
+// Starts an in-process gpg-agent that holds the given private key, and
+// points GNUPGHOME at it
+func startTestGPGAgent(t *testing.T, privateKeyId string) {
+	privateKey, err := ReadPrivateKeyData(privateKeyId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signer crypto.Signer
+	switch key := privateKey.(type) {
+	case ecdsa.PrivateKey:
+		signer = &key
+	case rsa.PrivateKey:
+		signer = &key
+	}
+
+	gnupgHome := t.TempDir()
+	listener, err := net.Listen("unix", filepath.Join(gnupgHome, "S.gpg-agent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestGPGAgent(t, conn, signer)
+		}
+	}()
+
+	// Keep gpgconf from pointing at the real agent
+	t.Setenv("PATH", t.TempDir())
+	t.Setenv("GNUPGHOME", gnupgHome)
+}
+
+func TestGPGAgentSigner(t *testing.T) {
+	msg := []byte("test message")
+	digest := sha256.Sum256(msg)
+
+	for _, fixture := range []struct{ keyId, certificateId string }{
+		{"../tst/certs/ec-prime256v1-key.pem", "../tst/certs/ec-prime256v1-sha256-cert.pem"},
+		{"../tst/certs/rsa-2048-key.pem", "../tst/certs/rsa-2048-sha256-cert.pem"},
+	} {
+		startTestGPGAgent(t, fixture.keyId)
+		signer, err := GetGPGAgentSigner(testKeygrip, fixture.certificateId, "")
+		if err != nil {
+			t.Log(err)
+			t.Fail()
+			continue
+		}
+		signingResult, err := Sign(msg, SigningOpts{signer, crypto.SHA256})
+		signer.Close()
+		if err != nil {
+			t.Log(err)
+			t.Fail()
+			continue
+		}
+		sig, _ := hex.DecodeString(signingResult.Signature)
+
+		valid := false
+		switch publicKey := signer.Public().(type) {
+		case *ecdsa.PublicKey:
+			valid = ecdsa.VerifyASN1(publicKey, digest[:], sig)
+		case *rsa.PublicKey:
+			valid = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], sig) == nil
+		}
+		if !valid {
+			t.Logf("Failed to verify the gpg-agent signature for %s", fixture.certificateId)
+			t.Fail()
+		}
+	}
+}
+
+func TestGPGAgentSignerMismatch(t *testing.T) {
+	startTestGPGAgent(t, "../tst/certs/ec-prime256v1-key.pem")
+	if _, err := GetGPGAgentSigner(testKeygrip, "../tst/certs/rsa-2048-sha256-cert.pem", ""); err == nil {
+		t.Log("Expected a mismatched gpg-agent key to be rejected")
+		t.Fail()
+	}
+	if _, err := GetGPGAgentSigner(strings.Repeat("F", 40), "../tst/certs/ec-prime256v1-sha256-cert.pem", ""); err == nil {
+		t.Log("Expected an unknown keygrip to be rejected")
+		t.Fail()
+	}
+}
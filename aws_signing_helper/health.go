@@ -0,0 +1,88 @@
+package aws_signing_helper
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const HEALTH_RESOURCE_PATH = "/healthz"
+const READINESS_RESOURCE_PATH = "/readyz"
+
+// Registers the health and readiness endpoints (and the metrics endpoint,
+// if enabled), which, unlike the credentials endpoints, don't require a
+// token, so that supervisors (such as Kubernetes probes) and monitoring can
+// use them
+func registerMonitoringHandlers(mux *http.ServeMux, signer Signer, creds []*RefreshableCred) {
+	mux.HandleFunc(HEALTH_RESOURCE_PATH, healthHandler(signer))
+	mux.HandleFunc(READINESS_RESOURCE_PATH, readinessHandler(creds))
+	if MetricsEnabled {
+		mux.HandleFunc(METRICS_RESOURCE_PATH, metricsHandler(signer))
+	}
+}
+
+// Handles GET requests to /healthz, which report whether the signer is
+// usable: whether it can still provide its certificate (which, for hardware
+// tokens, means that the token is still present), and whether the
+// certificate is currently valid
+func healthHandler(signer Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		err := checkSignerHealth(signer, time.Now())
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, err.Error())
+			return
+		}
+		io.WriteString(w, "ok")
+	}
+}
+
+func checkSignerHealth(signer Signer, now time.Time) error {
+	certificate, err := signer.Certificate()
+	if err != nil {
+		return fmt.Errorf("unable to read the certificate: %w", err)
+	}
+	if certificate == nil {
+		return errors.New("the signer provides no certificate")
+	}
+	if now.Before(certificate.NotBefore) || now.After(certificate.NotAfter) {
+		return fmt.Errorf("the certificate isn't valid (it's valid from %s to %s)",
+			certificate.NotBefore.Format(time.RFC3339), certificate.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Handles GET requests to /readyz, which report whether unexpired
+// credentials are cached for every role that's served, and, if the circuit
+// breaker isn't closed, its state
+func readinessHandler(creds []*RefreshableCred) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		now := time.Now()
+		ready := true
+		for _, cred := range creds {
+			current := cred.snapshot()
+			if current.AccessKeyId == "" || !now.Before(current.Expiration) {
+				ready = false
+			}
+		}
+		status := "ok"
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			status = "no unexpired credentials are cached"
+		}
+		if breakerState := describeCircuitBreaker(now); breakerState != "" {
+			status += " (" + breakerState + ")"
+		}
+		io.WriteString(w, status)
+	}
+}
@@ -0,0 +1,53 @@
+package aws_signing_helper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthHandler(t *testing.T) {
+	signer, err := GetFileSystemSigner("../tst/certs/ec-prime256v1-key.pem", "../tst/certs/ec-prime256v1-sha256-cert.pem", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+
+	recorder := httptest.NewRecorder()
+	healthHandler(signer)(recorder, httptest.NewRequest("GET", HEALTH_RESOURCE_PATH, nil))
+	if recorder.Code != http.StatusOK {
+		t.Logf("unexpected status %d: %s", recorder.Code, recorder.Body.String())
+		t.Fail()
+	}
+
+	certificate, _ := signer.Certificate()
+	if checkSignerHealth(signer, certificate.NotAfter.Add(time.Hour)) == nil {
+		t.Log("expected an expired certificate to be reported")
+		t.Fail()
+	}
+}
+
+func TestReadinessHandler(t *testing.T) {
+	fixtures := []struct {
+		name           string
+		creds          []*RefreshableCred
+		expectedStatus int
+	}{
+		{"valid", []*RefreshableCred{{AccessKeyId: "accessKeyId", Expiration: time.Now().Add(time.Hour)}}, http.StatusOK},
+		{"none", []*RefreshableCred{{}}, http.StatusServiceUnavailable},
+		{"expired", []*RefreshableCred{{AccessKeyId: "accessKeyId", Expiration: time.Now().Add(-time.Minute)}}, http.StatusServiceUnavailable},
+		{"one-expired", []*RefreshableCred{
+			{AccessKeyId: "accessKeyId", Expiration: time.Now().Add(time.Hour)},
+			{AccessKeyId: "accessKeyId", Expiration: time.Now().Add(-time.Minute)},
+		}, http.StatusServiceUnavailable},
+	}
+	for _, fixture := range fixtures {
+		recorder := httptest.NewRecorder()
+		readinessHandler(fixture.creds)(recorder, httptest.NewRequest("GET", READINESS_RESOURCE_PATH, nil))
+		if recorder.Code != fixture.expectedStatus {
+			t.Logf("%s: unexpected status %d", fixture.name, recorder.Code)
+			t.Fail()
+		}
+	}
+}
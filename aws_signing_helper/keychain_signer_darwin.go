@@ -0,0 +1,433 @@
+package aws_signing_helper
+
+/*
+#cgo LDFLAGS: -framework CoreFoundation -framework Security
+#include <stdlib.h>
+#include <CoreFoundation/CoreFoundation.h>
+#include <Security/Security.h>
+
+// Returns the identities in the keychain search list, optionally restricted
+// to the ones with the given label
+static CFArrayRef copyIdentities(const char *label, OSStatus *status) {
+	CFMutableDictionaryRef query = CFDictionaryCreateMutable(kCFAllocatorDefault, 0,
+		&kCFTypeDictionaryKeyCallBacks, &kCFTypeDictionaryValueCallBacks);
+	CFDictionarySetValue(query, kSecClass, kSecClassIdentity);
+	CFDictionarySetValue(query, kSecMatchLimit, kSecMatchLimitAll);
+	CFDictionarySetValue(query, kSecReturnRef, kCFBooleanTrue);
+	if (label != NULL) {
+		CFStringRef labelRef = CFStringCreateWithCString(kCFAllocatorDefault, label, kCFStringEncodingUTF8);
+		CFDictionarySetValue(query, kSecAttrLabel, labelRef);
+		CFRelease(labelRef);
+	}
+
+	CFTypeRef result = NULL;
+	*status = SecItemCopyMatching(query, &result);
+	CFRelease(query);
+	return (CFArrayRef)result;
+}
+
+static SecIdentityRef identityAtIndex(CFArrayRef identities, CFIndex i) {
+	return (SecIdentityRef)CFArrayGetValueAtIndex(identities, i);
+}
+
+static CFDataRef copyCertificateData(SecIdentityRef identity, OSStatus *status) {
+	SecCertificateRef cert = NULL;
+	*status = SecIdentityCopyCertificate(identity, &cert);
+	if (*status != errSecSuccess) {
+		return NULL;
+	}
+	CFDataRef data = SecCertificateCopyData(cert);
+	CFRelease(cert);
+	return data;
+}
+
+static SecKeyRef copyPrivateKey(SecIdentityRef identity, OSStatus *status) {
+	SecKeyRef key = NULL;
+	*status = SecIdentityCopyPrivateKey(identity, &key);
+	return key;
+}
+
+// Returns the private key in the Secure Enclave with the given label
+static SecKeyRef copySecureEnclaveKey(const char *label, OSStatus *status) {
+	CFStringRef labelRef = CFStringCreateWithCString(kCFAllocatorDefault, label, kCFStringEncodingUTF8);
+	CFMutableDictionaryRef query = CFDictionaryCreateMutable(kCFAllocatorDefault, 0,
+		&kCFTypeDictionaryKeyCallBacks, &kCFTypeDictionaryValueCallBacks);
+	CFDictionarySetValue(query, kSecClass, kSecClassKey);
+	CFDictionarySetValue(query, kSecAttrKeyClass, kSecAttrKeyClassPrivate);
+	CFDictionarySetValue(query, kSecAttrTokenID, kSecAttrTokenIDSecureEnclave);
+	CFDictionarySetValue(query, kSecAttrLabel, labelRef);
+	CFDictionarySetValue(query, kSecUseDataProtectionKeychain, kCFBooleanTrue);
+	CFDictionarySetValue(query, kSecMatchLimit, kSecMatchLimitOne);
+	CFDictionarySetValue(query, kSecReturnRef, kCFBooleanTrue);
+	CFRelease(labelRef);
+
+	CFTypeRef result = NULL;
+	*status = SecItemCopyMatching(query, &result);
+	CFRelease(query);
+	return (SecKeyRef)result;
+}
+
+// Generates a permanent P-256 private key with the given label in the
+// Secure Enclave
+static SecKeyRef createSecureEnclaveKey(const char *label, CFIndex *errorCode) {
+	CFErrorRef error = NULL;
+	SecAccessControlRef access = SecAccessControlCreateWithFlags(kCFAllocatorDefault,
+		kSecAttrAccessibleWhenUnlockedThisDeviceOnly, kSecAccessControlPrivateKeyUsage, &error);
+	if (access == NULL) {
+		*errorCode = CFErrorGetCode(error);
+		CFRelease(error);
+		return NULL;
+	}
+
+	CFStringRef labelRef = CFStringCreateWithCString(kCFAllocatorDefault, label, kCFStringEncodingUTF8);
+	CFMutableDictionaryRef privateKeyAttributes = CFDictionaryCreateMutable(kCFAllocatorDefault, 0,
+		&kCFTypeDictionaryKeyCallBacks, &kCFTypeDictionaryValueCallBacks);
+	CFDictionarySetValue(privateKeyAttributes, kSecAttrIsPermanent, kCFBooleanTrue);
+	CFDictionarySetValue(privateKeyAttributes, kSecAttrLabel, labelRef);
+	CFDictionarySetValue(privateKeyAttributes, kSecAttrAccessControl, access);
+	CFRelease(labelRef);
+	CFRelease(access);
+
+	int keySize = 256;
+	CFNumberRef keySizeRef = CFNumberCreate(kCFAllocatorDefault, kCFNumberIntType, &keySize);
+	CFMutableDictionaryRef attributes = CFDictionaryCreateMutable(kCFAllocatorDefault, 0,
+		&kCFTypeDictionaryKeyCallBacks, &kCFTypeDictionaryValueCallBacks);
+	CFDictionarySetValue(attributes, kSecAttrKeyType, kSecAttrKeyTypeECSECPrimeRandom);
+	CFDictionarySetValue(attributes, kSecAttrKeySizeInBits, keySizeRef);
+	CFDictionarySetValue(attributes, kSecAttrTokenID, kSecAttrTokenIDSecureEnclave);
+	CFDictionarySetValue(attributes, kSecUseDataProtectionKeychain, kCFBooleanTrue);
+	CFDictionarySetValue(attributes, kSecPrivateKeyAttrs, privateKeyAttributes);
+	CFRelease(keySizeRef);
+	CFRelease(privateKeyAttributes);
+
+	SecKeyRef key = SecKeyCreateRandomKey(attributes, &error);
+	CFRelease(attributes);
+	if (key == NULL) {
+		*errorCode = CFErrorGetCode(error);
+		CFRelease(error);
+	}
+	return key;
+}
+
+// Returns the ANSI X9.63 representation of the key's public key
+static CFDataRef copyPublicKeyData(SecKeyRef key) {
+	SecKeyRef publicKey = SecKeyCopyPublicKey(key);
+	if (publicKey == NULL) {
+		return NULL;
+	}
+	CFDataRef data = SecKeyCopyExternalRepresentation(publicKey, NULL);
+	CFRelease(publicKey);
+	return data;
+}
+
+// Signature algorithms, as passed from Go
+enum {
+	algorithmRSASHA256 = 1,
+	algorithmRSASHA384,
+	algorithmRSASHA512,
+	algorithmECDSASHA256,
+	algorithmECDSASHA384,
+	algorithmECDSASHA512,
+};
+
+static CFDataRef createSignature(SecKeyRef key, int algorithm, const UInt8 *digest, CFIndex digestLen, CFIndex *errorCode) {
+	SecKeyAlgorithm keyAlgorithm;
+	switch (algorithm) {
+	case algorithmRSASHA256: keyAlgorithm = kSecKeyAlgorithmRSASignatureDigestPKCS1v15SHA256; break;
+	case algorithmRSASHA384: keyAlgorithm = kSecKeyAlgorithmRSASignatureDigestPKCS1v15SHA384; break;
+	case algorithmRSASHA512: keyAlgorithm = kSecKeyAlgorithmRSASignatureDigestPKCS1v15SHA512; break;
+	case algorithmECDSASHA256: keyAlgorithm = kSecKeyAlgorithmECDSASignatureDigestX962SHA256; break;
+	case algorithmECDSASHA384: keyAlgorithm = kSecKeyAlgorithmECDSASignatureDigestX962SHA384; break;
+	case algorithmECDSASHA512: keyAlgorithm = kSecKeyAlgorithmECDSASignatureDigestX962SHA512; break;
+	default:
+		*errorCode = errSecParam;
+		return NULL;
+	}
+
+	CFDataRef digestRef = CFDataCreate(kCFAllocatorDefault, digest, digestLen);
+	CFErrorRef error = NULL;
+	CFDataRef signature = SecKeyCreateSignature(key, keyAlgorithm, digestRef, &error);
+	CFRelease(digestRef);
+	if (signature == NULL) {
+		*errorCode = CFErrorGetCode(error);
+		CFRelease(error);
+	}
+	return signature;
+}
+*/
+import "C"
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// Signer that uses an identity (a certificate and its private key) from the
+// macOS Keychain, or a private key in the Secure Enclave
+type KeychainSigner struct {
+	mutex            sync.Mutex
+	identity         C.SecIdentityRef
+	key              C.SecKeyRef
+	public           crypto.PublicKey
+	cert             *x509.Certificate
+	certificateChain []*x509.Certificate
+}
+
+// Creates a signer that uses the Keychain identity with the given label,
+// and/or whose certificate has the given SHA-1 or SHA-256 hash
+func GetKeychainSigner(label string, hash string, certificateBundleId string) (signer Signer, err error) {
+	if label == "" && hash == "" {
+		return nil, errors.New("either a Keychain label or certificate hash has to be provided")
+	}
+	var certHash []byte
+	if hash != "" {
+		certHash, err = hex.DecodeString(strings.NewReplacer(" ", "", ":", "").Replace(hash))
+		if err != nil || (len(certHash) != sha1.Size && len(certHash) != sha256.Size) {
+			return nil, errors.New("invalid certificate hash")
+		}
+	}
+
+	keychainSigner := &KeychainSigner{}
+	defer func() {
+		if err != nil {
+			keychainSigner.Close()
+		}
+	}()
+	if keychainSigner.identity, keychainSigner.cert, err = findKeychainIdentity(label, certHash); err != nil {
+		return nil, err
+	}
+	keychainSigner.public = keychainSigner.cert.PublicKey
+
+	var status C.OSStatus
+	keychainSigner.key = C.copyPrivateKey(keychainSigner.identity, &status)
+	if status != C.errSecSuccess {
+		return nil, fmt.Errorf("unable to obtain the identity's private key (OSStatus %d)", status)
+	}
+
+	if certificateBundleId != "" {
+		if keychainSigner.certificateChain, err = ReadCertificateBundleData(certificateBundleId); err != nil {
+			return nil, err
+		}
+	}
+	return keychainSigner, nil
+}
+
+// Finds the single identity that matches the label and certificate hash.
+// The returned identity has to be released by the caller.
+func findKeychainIdentity(label string, certHash []byte) (C.SecIdentityRef, *x509.Certificate, error) {
+	var cLabel *C.char
+	if label != "" {
+		cLabel = C.CString(label)
+		defer C.free(unsafe.Pointer(cLabel))
+	}
+
+	var status C.OSStatus
+	identities := C.copyIdentities(cLabel, &status)
+	if status == C.errSecItemNotFound {
+		return 0, nil, errors.New("no matching identity found in the Keychain")
+	}
+	if status != C.errSecSuccess {
+		return 0, nil, fmt.Errorf("unable to search the Keychain (OSStatus %d)", status)
+	}
+	defer C.CFRelease(C.CFTypeRef(identities))
+
+	var match C.SecIdentityRef
+	var matchCert *x509.Certificate
+	count := C.CFArrayGetCount(identities)
+	for i := C.CFIndex(0); i < count; i++ {
+		identity := C.identityAtIndex(identities, i)
+		data := C.copyCertificateData(identity, &status)
+		if status != C.errSecSuccess {
+			continue
+		}
+		der := C.GoBytes(unsafe.Pointer(C.CFDataGetBytePtr(data)), C.int(C.CFDataGetLength(data)))
+		C.CFRelease(C.CFTypeRef(data))
+
+		if certHash != nil && !certificateHashMatches(der, certHash) {
+			continue
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			continue
+		}
+		if match != 0 {
+			return 0, nil, errors.New("multiple identities match; use a more specific label or hash")
+		}
+		match = identity
+		matchCert = cert
+	}
+	if match == 0 {
+		return 0, nil, errors.New("no matching identity found in the Keychain")
+	}
+	C.CFRetain(C.CFTypeRef(match))
+	return match, matchCert, nil
+}
+
+// Whether the SHA-1 or SHA-256 hash (depending on its length) of the
+// certificate is the expected one
+func certificateHashMatches(der []byte, certHash []byte) bool {
+	if len(certHash) == sha1.Size {
+		sum := sha1.Sum(der)
+		return string(sum[:]) == string(certHash)
+	}
+	sum := sha256.Sum256(der)
+	return string(sum[:]) == string(certHash)
+}
+
+// Creates a signer that uses the Secure Enclave key with the given label,
+// along with the certificate (and, optionally, certificate bundle) at the
+// provided paths
+func GetSecureEnclaveSigner(label string, certificateId string, certificateBundleId string) (signer Signer, err error) {
+	cLabel := C.CString(label)
+	defer C.free(unsafe.Pointer(cLabel))
+
+	var status C.OSStatus
+	key := C.copySecureEnclaveKey(cLabel, &status)
+	if status == C.errSecItemNotFound {
+		return nil, fmt.Errorf("no Secure Enclave key with label %q found", label)
+	}
+	if status != C.errSecSuccess {
+		return nil, fmt.Errorf("unable to search the Keychain (OSStatus %d)", status)
+	}
+	keychainSigner := &KeychainSigner{key: key}
+	defer func() {
+		if err != nil {
+			keychainSigner.Close()
+		}
+	}()
+
+	if keychainSigner.public, err = secureEnclavePublicKey(key); err != nil {
+		return nil, err
+	}
+	if keychainSigner.cert, err = readCertificate(certificateId); err != nil {
+		return nil, err
+	}
+	if !publicKeysEqual(keychainSigner.cert.PublicKey, keychainSigner.public) {
+		return nil, errors.New("the certificate doesn't match the Secure Enclave key")
+	}
+	if certificateBundleId != "" {
+		if keychainSigner.certificateChain, err = ReadCertificateBundleData(certificateBundleId); err != nil {
+			return nil, err
+		}
+	}
+	return keychainSigner, nil
+}
+
+// Generates a new P-256 key with the given label in the Secure Enclave. The
+// returned signer has no certificate, and is meant to create a CSR with.
+func CreateSecureEnclaveKey(label string) (signer Signer, err error) {
+	cLabel := C.CString(label)
+	defer C.free(unsafe.Pointer(cLabel))
+
+	var status C.OSStatus
+	existingKey := C.copySecureEnclaveKey(cLabel, &status)
+	if status == C.errSecSuccess {
+		C.CFRelease(C.CFTypeRef(existingKey))
+		return nil, fmt.Errorf("a Secure Enclave key with label %q already exists", label)
+	}
+
+	var errorCode C.CFIndex
+	key := C.createSecureEnclaveKey(cLabel, &errorCode)
+	if key == 0 {
+		return nil, fmt.Errorf("unable to create Secure Enclave key (error %d)", errorCode)
+	}
+	keychainSigner := &KeychainSigner{key: key}
+	if keychainSigner.public, err = secureEnclavePublicKey(key); err != nil {
+		keychainSigner.Close()
+		return nil, err
+	}
+	return keychainSigner, nil
+}
+
+func secureEnclavePublicKey(key C.SecKeyRef) (*ecdsa.PublicKey, error) {
+	data := C.copyPublicKeyData(key)
+	if data == 0 {
+		return nil, errors.New("unable to obtain the public key of the Secure Enclave key")
+	}
+	defer C.CFRelease(C.CFTypeRef(data))
+	point := C.GoBytes(unsafe.Pointer(C.CFDataGetBytePtr(data)), C.int(C.CFDataGetLength(data)))
+	x, y := elliptic.Unmarshal(elliptic.P256(), point)
+	if x == nil {
+		return nil, errors.New("invalid Secure Enclave public key")
+	}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+}
+
+func (keychainSigner *KeychainSigner) Public() crypto.PublicKey {
+	return keychainSigner.public
+}
+
+// Signs the digest through SecKeyCreateSignature. The X9.62 ECDSA
+// algorithms already return ASN.1-encoded signatures.
+func (keychainSigner *KeychainSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	var algorithm C.int
+	switch keychainSigner.public.(type) {
+	case *rsa.PublicKey:
+		algorithm = C.algorithmRSASHA256
+	case *ecdsa.PublicKey:
+		algorithm = C.algorithmECDSASHA256
+	default:
+		return nil, errors.New("unsupported algorithm")
+	}
+	switch opts.HashFunc() {
+	case crypto.SHA256:
+	case crypto.SHA384:
+		algorithm += 1
+	case crypto.SHA512:
+		algorithm += 2
+	default:
+		return nil, errors.New("unsupported digest")
+	}
+	if len(digest) == 0 {
+		return nil, errors.New("empty digest")
+	}
+
+	keychainSigner.mutex.Lock()
+	defer keychainSigner.mutex.Unlock()
+	if keychainSigner.key == 0 {
+		return nil, errors.New("signer has been closed")
+	}
+	var errorCode C.CFIndex
+	signature := C.createSignature(keychainSigner.key, algorithm, (*C.UInt8)(unsafe.Pointer(&digest[0])), C.CFIndex(len(digest)), &errorCode)
+	if signature == 0 {
+		return nil, fmt.Errorf("SecKeyCreateSignature failed (error %d)", errorCode)
+	}
+	defer C.CFRelease(C.CFTypeRef(signature))
+	return C.GoBytes(unsafe.Pointer(C.CFDataGetBytePtr(signature)), C.int(C.CFDataGetLength(signature))), nil
+}
+
+func (keychainSigner *KeychainSigner) Certificate() (*x509.Certificate, error) {
+	if keychainSigner.cert == nil {
+		return nil, errors.New("no certificate is associated with the key")
+	}
+	return keychainSigner.cert, nil
+}
+
+func (keychainSigner *KeychainSigner) CertificateChain() ([]*x509.Certificate, error) {
+	return keychainSigner.certificateChain, nil
+}
+
+func (keychainSigner *KeychainSigner) Close() {
+	keychainSigner.mutex.Lock()
+	defer keychainSigner.mutex.Unlock()
+	if keychainSigner.key != 0 {
+		C.CFRelease(C.CFTypeRef(keychainSigner.key))
+		keychainSigner.key = 0
+	}
+	if keychainSigner.identity != 0 {
+		C.CFRelease(C.CFTypeRef(keychainSigner.identity))
+		keychainSigner.identity = 0
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !darwin
+
+package aws_signing_helper
+
+import (
+	"errors"
+)
+
+func GetKeychainSigner(label string, hash string, certificateBundleId string) (Signer, error) {
+	return nil, errors.New("the macOS Keychain is only supported on macOS")
+}
+
+func GetSecureEnclaveSigner(label string, certificateId string, certificateBundleId string) (Signer, error) {
+	return nil, errors.New("Secure Enclave keys are only supported on macOS")
+}
+
+func CreateSecureEnclaveKey(label string) (Signer, error) {
+	return nil, errors.New("Secure Enclave keys are only supported on macOS")
+}
@@ -0,0 +1,51 @@
+package aws_signing_helper
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Reads the payload of the "user" key with the given description from the
+// kernel keyring named in `keyringKeyId` ("user/<description>",
+// "session/<description>", or "persistent/<description>"). The keyring is
+// searched along with the keyrings linked to it.
+func readKeyringKey(keyringKeyId string) ([]byte, error) {
+	keyringName, description, found := strings.Cut(keyringKeyId, "/")
+	if !found || description == "" {
+		return nil, errors.New("keyring key must be specified as keyring://<keyring>/<description>")
+	}
+
+	var keyring int
+	switch keyringName {
+	case "user":
+		keyring = unix.KEY_SPEC_USER_KEYRING
+	case "session":
+		keyring = unix.KEY_SPEC_SESSION_KEYRING
+	case "persistent":
+		// Links the current user's persistent keyring into the process
+		// keyring, and returns its ID
+		var err error
+		if keyring, err = unix.KeyctlInt(unix.KEYCTL_GET_PERSISTENT, -1, unix.KEY_SPEC_PROCESS_KEYRING, 0, 0); err != nil {
+			return nil, fmt.Errorf("unable to get the persistent keyring: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown keyring %q (expected user, session, or persistent)", keyringName)
+	}
+
+	keyId, err := unix.KeyctlSearch(keyring, "user", description, 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find key %q in the %s keyring: %w", description, keyringName, err)
+	}
+	size, err := unix.KeyctlBuffer(unix.KEYCTL_READ, keyId, nil, 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read key %q: %w", description, err)
+	}
+	payload := make([]byte, size)
+	if size, err = unix.KeyctlBuffer(unix.KEYCTL_READ, keyId, payload, 0); err != nil {
+		return nil, fmt.Errorf("unable to read key %q: %w", description, err)
+	}
+	return payload[:size], nil
+}
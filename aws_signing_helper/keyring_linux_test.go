@@ -0,0 +1,38 @@
+package aws_signing_helper
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestKeyringPrivateKey(t *testing.T) {
+	payload, err := os.ReadFile("../tst/certs/ec-prime256v1-key.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	description := fmt.Sprintf("rolesanywhere-test-%d", time.Now().UnixNano())
+	keyId, err := unix.AddKey("user", description, payload, unix.KEY_SPEC_USER_KEYRING)
+	if err != nil {
+		t.Skipf("kernel keyring isn't available: %v", err)
+	}
+	defer unix.KeyctlInt(unix.KEYCTL_UNLINK, keyId, unix.KEY_SPEC_USER_KEYRING, 0, 0)
+
+	signer, err := GetFileSystemSigner("keyring://user/"+description, "../tst/certs/ec-prime256v1-sha256-cert.pem", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := signer.Certificate()
+	if !publicKeysEqual(cert.PublicKey, signer.Public()) {
+		t.Log("Expected the key from the keyring to match the certificate")
+		t.Fail()
+	}
+
+	if _, err = ReadPrivateKeyData("keyring://user/" + description + "-missing"); err == nil {
+		t.Log("Expected a missing key to be rejected")
+		t.Fail()
+	}
+}
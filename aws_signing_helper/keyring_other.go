@@ -0,0 +1,11 @@
+//go:build !linux
+
+package aws_signing_helper
+
+import (
+	"errors"
+)
+
+func readKeyringKey(keyringKeyId string) ([]byte, error) {
+	return nil, errors.New("kernel keyrings are only supported on Linux")
+}
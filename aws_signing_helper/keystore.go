@@ -0,0 +1,369 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ecdsa"
+	"crypto/md5"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	jksMagic   = 0xfeedfeed
+	jceksMagic = 0xcececece
+
+	jksPrivateKeyTag  = 1
+	jksTrustedCertTag = 2
+	jksSecretKeyTag   = 3
+)
+
+var (
+	// Sun's proprietary key protection algorithm, used by JKS keystores
+	oidJKSKeyProtector = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 42, 2, 17, 1, 1}
+	// PBEWithMD5AndTripleDES, used by JCEKS keystores
+	oidPBEWithMD5AndTripleDES = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 42, 2, 19, 1}
+)
+
+// Error returned when the keystore's integrity check fails
+var ErrIncorrectKeystorePassword = errors.New("keystore was tampered with, or password was incorrect")
+
+// PBEParameter, as defined in PKCS#5
+type pbeParams struct {
+	Salt           []byte
+	IterationCount int
+}
+
+// A private key entry of a Java keystore, whose key is still encrypted
+type keystorePrivateKeyEntry struct {
+	alias            string
+	encryptedKey     []byte
+	certificateChain []*x509.Certificate
+}
+
+// Reads the private key entry with the given alias (or the only private key
+// entry, if no alias is provided) from a JKS or JCEKS keystore. The password
+// is used both to check the keystore's integrity and to decrypt the key.
+func readJavaKeyStore(keystoreId string, password string, alias string) (crypto.PrivateKey, *x509.Certificate, []*x509.Certificate, error) {
+	data, err := readCredentialFile(keystoreId)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(data) < 20 {
+		return nil, nil, nil, errors.New("keystore is too short")
+	}
+	if err = checkKeystoreIntegrity(data, password); err != nil {
+		return nil, nil, nil, err
+	}
+	entries, err := parseJavaKeyStore(data[:len(data)-20])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var entry *keystorePrivateKeyEntry
+	for i := range entries {
+		// Aliases are case-insensitive (keytool stores them in lower case)
+		if alias == "" || strings.EqualFold(entries[i].alias, alias) {
+			if entry != nil {
+				return nil, nil, nil, errors.New("keystore contains more than one private key, use --alias to select one")
+			}
+			entry = &entries[i]
+		}
+	}
+	if entry == nil {
+		if alias != "" {
+			return nil, nil, nil, fmt.Errorf("no private key with alias %q found in keystore", alias)
+		}
+		return nil, nil, nil, errors.New("no private key found in keystore")
+	}
+	if len(entry.certificateChain) == 0 {
+		return nil, nil, nil, errors.New("private key in keystore has no certificate")
+	}
+
+	privateKey, err := decryptKeystoreKey(entry.encryptedKey, password)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return privateKey, entry.certificateChain[0], entry.certificateChain[1:], nil
+}
+
+// Verifies the SHA-1 digest at the end of the keystore, which is keyed with
+// the password (encoded as UTF-16) and the string "Mighty Aphrodite"
+func checkKeystoreIntegrity(data []byte, password string) error {
+	hash := sha1.New()
+	hash.Write(utf16BEBytes(password))
+	hash.Write([]byte("Mighty Aphrodite"))
+	hash.Write(data[:len(data)-20])
+	if subtle.ConstantTimeCompare(hash.Sum(nil), data[len(data)-20:]) != 1 {
+		return ErrIncorrectKeystorePassword
+	}
+	return nil
+}
+
+// Parses the private key entries of a keystore (without its digest).
+// Trusted certificate entries are skipped. Secret key entries (which only
+// JCEKS keystores have) are serialized Java objects, which can't be skipped,
+// so the entries that follow them aren't read.
+func parseJavaKeyStore(data []byte) ([]keystorePrivateKeyEntry, error) {
+	reader := &keystoreReader{data: data}
+	magic := reader.uint32()
+	version := reader.uint32()
+	count := reader.uint32()
+	if reader.err != nil || (magic != jksMagic && magic != jceksMagic) {
+		return nil, errors.New("not a JKS or JCEKS keystore")
+	}
+	if version != 1 && version != 2 {
+		return nil, fmt.Errorf("unsupported keystore version %d", version)
+	}
+
+	var entries []keystorePrivateKeyEntry
+	for i := uint32(0); i < count && reader.err == nil; i++ {
+		tag := reader.uint32()
+		alias := reader.utf()
+		reader.bytes(8) // creation date
+		switch tag {
+		case jksPrivateKeyTag:
+			entry := keystorePrivateKeyEntry{alias: alias, encryptedKey: reader.bytes(int(reader.uint32()))}
+			chainLength := reader.uint32()
+			for j := uint32(0); j < chainLength && reader.err == nil; j++ {
+				cert, err := reader.certificate(version)
+				if err != nil {
+					return nil, err
+				}
+				entry.certificateChain = append(entry.certificateChain, cert)
+			}
+			entries = append(entries, entry)
+		case jksTrustedCertTag:
+			if _, err := reader.certificate(version); err != nil {
+				return nil, err
+			}
+		case jksSecretKeyTag:
+			return entries, nil
+		default:
+			return nil, fmt.Errorf("unsupported keystore entry type %d", tag)
+		}
+	}
+	if reader.err != nil {
+		return nil, reader.err
+	}
+	return entries, nil
+}
+
+// Decrypts a private key that's protected either with Sun's proprietary
+// algorithm (JKS) or with PBEWithMD5AndTripleDES (JCEKS)
+func decryptKeystoreKey(der []byte, password string) (crypto.PrivateKey, error) {
+	var keyInfo encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &keyInfo); err != nil {
+		return nil, errors.New("could not parse private key in keystore")
+	}
+	var decrypted []byte
+	var err error
+	switch {
+	case keyInfo.Algorithm.Algorithm.Equal(oidJKSKeyProtector):
+		decrypted, err = decryptJKSKey(keyInfo.EncryptedData, password)
+	case keyInfo.Algorithm.Algorithm.Equal(oidPBEWithMD5AndTripleDES):
+		var params pbeParams
+		if _, err = asn1.Unmarshal(keyInfo.Algorithm.Parameters.FullBytes, &params); err != nil {
+			return nil, errors.New("could not parse private key in keystore")
+		}
+		decrypted, err = decryptJCEKSKey(keyInfo.EncryptedData, password, params)
+	default:
+		return nil, errors.New("unsupported keystore key protection algorithm")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := x509.ParsePKCS8PrivateKey(decrypted)
+	if err != nil {
+		return nil, ErrIncorrectPassphrase
+	}
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		return *key, nil
+	case *ecdsa.PrivateKey:
+		return *key, nil
+	}
+	return nil, errors.New("unsupported private key type in keystore")
+}
+
+// Sun's key protection: the encrypted data is a 20-byte salt, the key XORed
+// with a keystream of chained SHA-1 digests, and a 20-byte SHA-1 check
+func decryptJKSKey(data []byte, password string) ([]byte, error) {
+	if len(data) < 40 {
+		return nil, errors.New("could not parse private key in keystore")
+	}
+	passwordBytes := utf16BEBytes(password)
+	salt := data[:20]
+	encrypted := data[20 : len(data)-20]
+	check := data[len(data)-20:]
+
+	decrypted := make([]byte, len(encrypted))
+	digest := salt
+	for i := 0; i < len(encrypted); i += sha1.Size {
+		hash := sha1.New()
+		hash.Write(passwordBytes)
+		hash.Write(digest)
+		digest = hash.Sum(nil)
+		for j := 0; j < sha1.Size && i+j < len(encrypted); j++ {
+			decrypted[i+j] = encrypted[i+j] ^ digest[j]
+		}
+	}
+
+	hash := sha1.New()
+	hash.Write(passwordBytes)
+	hash.Write(decrypted)
+	if subtle.ConstantTimeCompare(hash.Sum(nil), check) != 1 {
+		return nil, ErrIncorrectPassphrase
+	}
+	return decrypted, nil
+}
+
+// PBEWithMD5AndTripleDES, as implemented by the SunJCE provider: each half
+// of the salt is hashed with the password to derive half of the key and IV
+func decryptJCEKSKey(data []byte, password string, params pbeParams) ([]byte, error) {
+	key, iv, err := deriveJCEKSKey(password, params)
+	if err != nil {
+		return nil, err
+	}
+	block, err := des.NewTripleDESCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, errors.New("could not parse private key in keystore")
+	}
+	decrypted := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, data)
+
+	padding := int(decrypted[len(decrypted)-1])
+	if padding == 0 || padding > block.BlockSize() ||
+		!bytes.Equal(decrypted[len(decrypted)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, ErrIncorrectPassphrase
+	}
+	return decrypted[:len(decrypted)-padding], nil
+}
+
+func deriveJCEKSKey(password string, params pbeParams) ([]byte, []byte, error) {
+	if len(params.Salt) != 8 {
+		return nil, nil, errors.New("unexpected salt length in keystore")
+	}
+	passwordBytes := make([]byte, len(password))
+	for i, c := range []byte(password) {
+		if c < 0x20 || c > 0x7e {
+			return nil, nil, errors.New("keystore passwords must be printable ASCII")
+		}
+		passwordBytes[i] = c
+	}
+
+	salt := append([]byte(nil), params.Salt...)
+	if bytes.Equal(salt[:4], salt[4:]) {
+		salt[0], salt[3] = salt[3], salt[0]
+		salt[1], salt[2] = salt[2], salt[1]
+	}
+	var derived []byte
+	for i := 0; i < 2; i++ {
+		toBeHashed := salt[i*4 : i*4+4]
+		for j := 0; j < params.IterationCount; j++ {
+			hash := md5.New()
+			hash.Write(toBeHashed)
+			hash.Write(passwordBytes)
+			toBeHashed = hash.Sum(nil)
+		}
+		derived = append(derived, toBeHashed...)
+	}
+	return derived[:24], derived[24:], nil
+}
+
+// Encodes the password the way Java's keystores do when computing digests
+func utf16BEBytes(s string) []byte {
+	var encoded []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		encoded = append(encoded, byte(c>>8), byte(c))
+	}
+	return encoded
+}
+
+// Reads the big-endian values of a keystore, remembering the first error
+type keystoreReader struct {
+	data []byte
+	err  error
+}
+
+func (reader *keystoreReader) bytes(n int) []byte {
+	if reader.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(reader.data) {
+		reader.err = errors.New("keystore is truncated")
+		return nil
+	}
+	b := reader.data[:n]
+	reader.data = reader.data[n:]
+	return b
+}
+
+func (reader *keystoreReader) uint32() uint32 {
+	b := reader.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (reader *keystoreReader) utf() string {
+	b := reader.bytes(2)
+	if b == nil {
+		return ""
+	}
+	return string(reader.bytes(int(binary.BigEndian.Uint16(b))))
+}
+
+func (reader *keystoreReader) certificate(version uint32) (*x509.Certificate, error) {
+	if version == 2 {
+		if certType := reader.utf(); reader.err == nil && certType != "X.509" {
+			return nil, fmt.Errorf("unsupported certificate type %q in keystore", certType)
+		}
+	}
+	der := reader.bytes(int(reader.uint32()))
+	if reader.err != nil {
+		return nil, reader.err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// Creates a signer from the private key entry with the given alias (which
+// may be omitted if there's only one) in the JKS or JCEKS keystore at the
+// provided path. If no password is provided, it's obtained through
+// GetPassphrase. The certificates in the entry's chain other than the
+// end-entity certificate make up the certificate chain, unless a
+// certificate bundle is provided.
+func GetKeystoreSigner(keystoreId string, password string, passphraseFile string, alias string, certificateBundleId string) (Signer, error) {
+	var err error
+	if password == "" {
+		password, err = GetPassphrase(passphraseFile, "Please enter the keystore password:")
+		if err != nil {
+			return nil, err
+		}
+	}
+	fileSystemSigner := &FileSystemSigner{
+		keystoreId:          keystoreId,
+		keystorePassword:    password,
+		keystoreAlias:       alias,
+		certificateBundleId: certificateBundleId,
+	}
+	if err = fileSystemSigner.load(); err != nil {
+		return nil, err
+	}
+	return fileSystemSigner, nil
+}
@@ -0,0 +1,184 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// An entry to write into a test keystore; entries without a private key
+// are written as trusted certificates
+type testKeystoreEntry struct {
+	alias      string
+	privateKey crypto.PrivateKey
+	certIds    []string
+}
+
+// Protects a PKCS#8 key the way keytool does for the given keystore type
+func protectTestKeystoreKey(t *testing.T, pkcs8 []byte, password string, jceks bool) []byte {
+	var keyInfo encryptedPrivateKeyInfo
+	if jceks {
+		params := pbeParams{Salt: []byte{1, 2, 3, 4, 5, 6, 7, 8}, IterationCount: 200}
+		paramBytes, _ := asn1.Marshal(params)
+		keyInfo.Algorithm = pkix.AlgorithmIdentifier{Algorithm: oidPBEWithMD5AndTripleDES, Parameters: asn1.RawValue{FullBytes: paramBytes}}
+		key, iv, err := deriveJCEKSKey(password, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, _ := des.NewTripleDESCipher(key)
+		padding := block.BlockSize() - len(pkcs8)%block.BlockSize()
+		padded := append(append([]byte(nil), pkcs8...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+		keyInfo.EncryptedData = make([]byte, len(padded))
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(keyInfo.EncryptedData, padded)
+	} else {
+		keyInfo.Algorithm = pkix.AlgorithmIdentifier{Algorithm: oidJKSKeyProtector, Parameters: asn1.NullRawValue}
+		salt := make([]byte, 20)
+		rand.Read(salt)
+		passwordBytes := utf16BEBytes(password)
+		encrypted := make([]byte, len(pkcs8))
+		digest := salt
+		for i := 0; i < len(pkcs8); i += sha1.Size {
+			hash := sha1.New()
+			hash.Write(passwordBytes)
+			hash.Write(digest)
+			digest = hash.Sum(nil)
+			for j := 0; j < sha1.Size && i+j < len(pkcs8); j++ {
+				encrypted[i+j] = pkcs8[i+j] ^ digest[j]
+			}
+		}
+		check := sha1.Sum(append(passwordBytes, pkcs8...))
+		keyInfo.EncryptedData = append(append(salt, encrypted...), check[:]...)
+	}
+	der, err := asn1.Marshal(keyInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// Writes a version 2 JKS or JCEKS keystore, and returns its path
+func writeTestKeystore(t *testing.T, password string, jceks bool, entries ...testKeystoreEntry) string {
+	var buf bytes.Buffer
+	writeUint32 := func(v uint32) { binary.Write(&buf, binary.BigEndian, v) }
+	writeUTF := func(s string) {
+		binary.Write(&buf, binary.BigEndian, uint16(len(s)))
+		buf.WriteString(s)
+	}
+	writeCert := func(certId string) {
+		cert, err := readCertificate(certId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeUTF("X.509")
+		writeUint32(uint32(len(cert.Raw)))
+		buf.Write(cert.Raw)
+	}
+
+	if jceks {
+		writeUint32(jceksMagic)
+	} else {
+		writeUint32(jksMagic)
+	}
+	writeUint32(2)
+	writeUint32(uint32(len(entries)))
+	for _, entry := range entries {
+		if entry.privateKey == nil {
+			writeUint32(jksTrustedCertTag)
+		} else {
+			writeUint32(jksPrivateKeyTag)
+		}
+		writeUTF(entry.alias)
+		binary.Write(&buf, binary.BigEndian, int64(0))
+		if entry.privateKey == nil {
+			writeCert(entry.certIds[0])
+			continue
+		}
+		var pkcs8 []byte
+		switch key := entry.privateKey.(type) {
+		case ecdsa.PrivateKey:
+			pkcs8, _ = x509.MarshalPKCS8PrivateKey(&key)
+		case rsa.PrivateKey:
+			pkcs8, _ = x509.MarshalPKCS8PrivateKey(&key)
+		}
+		protectedKey := protectTestKeystoreKey(t, pkcs8, password, jceks)
+		writeUint32(uint32(len(protectedKey)))
+		buf.Write(protectedKey)
+		writeUint32(uint32(len(entry.certIds)))
+		for _, certId := range entry.certIds {
+			writeCert(certId)
+		}
+	}
+
+	hash := sha1.New()
+	hash.Write(utf16BEBytes(password))
+	hash.Write([]byte("Mighty Aphrodite"))
+	hash.Write(buf.Bytes())
+	buf.Write(hash.Sum(nil))
+
+	keystoreId := filepath.Join(t.TempDir(), "keystore")
+	if err := os.WriteFile(keystoreId, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return keystoreId
+}
+
+func TestKeystoreSigner(t *testing.T) {
+	ecKey, _ := ReadPrivateKeyData("../tst/certs/ec-prime256v1-key.pem")
+	rsaKey, _ := ReadPrivateKeyData("../tst/certs/rsa-2048-key.pem")
+	entries := []testKeystoreEntry{
+		{"ca", nil, []string{"../tst/certs/rsa-2048-sha256-cert.pem"}},
+		{"ec", ecKey, []string{"../tst/certs/ec-prime256v1-sha256-cert.pem", "../tst/certs/rsa-2048-sha256-cert.pem"}},
+		{"rsa", rsaKey, []string{"../tst/certs/rsa-2048-sha256-cert.pem"}},
+	}
+
+	for _, jceks := range []bool{false, true} {
+		keystoreId := writeTestKeystore(t, "changeit", jceks, entries...)
+		for _, fixture := range []struct {
+			alias       string
+			chainLength int
+		}{{"EC", 1}, {"rsa", 0}} {
+			signer, err := GetKeystoreSigner(keystoreId, "changeit", "", fixture.alias, "")
+			if err != nil {
+				t.Fatalf("Failed to read %s from keystore (JCEKS: %v): %v", fixture.alias, jceks, err)
+			}
+			cert, _ := signer.Certificate()
+			if !publicKeysEqual(cert.PublicKey, signer.Public()) {
+				t.Logf("Expected the %s key to match its certificate", fixture.alias)
+				t.Fail()
+			}
+			if chain, _ := signer.CertificateChain(); len(chain) != fixture.chainLength {
+				t.Logf("Expected %d chain certificates for %s, got %d", fixture.chainLength, fixture.alias, len(chain))
+				t.Fail()
+			}
+		}
+
+		// The alias is required when there's more than one private key
+		if _, err := GetKeystoreSigner(keystoreId, "changeit", "", "", ""); err == nil {
+			t.Log("Expected a missing alias to be rejected")
+			t.Fail()
+		}
+		if _, err := GetKeystoreSigner(keystoreId, "wrong", "", "ec", ""); err != ErrIncorrectKeystorePassword {
+			t.Logf("Expected the wrong password to be rejected, got %v", err)
+			t.Fail()
+		}
+	}
+
+	// With a single private key, the alias may be omitted
+	keystoreId := writeTestKeystore(t, "changeit", false, entries[1])
+	if _, err := GetKeystoreSigner(keystoreId, "changeit", "", "", ""); err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,44 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"encoding/xml"
+)
+
+// Generates the property list of a launchd agent that runs the program
+// with the given arguments when the user logs in, and restarts it if it
+// exits unexpectedly. Anything the program writes to standard error before
+// it logs to unified logging (such as a crash) is appended to the log file.
+func launchdPlist(label string, programArguments []string, logPath string) []byte {
+	var buf bytes.Buffer
+	writeString := func(s string) {
+		buf.WriteString("\t<string>")
+		xml.EscapeText(&buf, []byte(s))
+		buf.WriteString("</string>\n")
+	}
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+`)
+	writeString(label)
+	buf.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, argument := range programArguments {
+		buf.WriteString("\t")
+		writeString(argument)
+	}
+	buf.WriteString(`	</array>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+	<key>StandardErrorPath</key>
+`)
+	writeString(logPath)
+	buf.WriteString("</dict>\n</plist>\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,116 @@
+package aws_signing_helper
+
+/*
+#include <stdlib.h>
+#include <os/log.h>
+
+static void logMessage(os_log_t log, const char *message) {
+	os_log(log, "%{public}s", message);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"unsafe"
+)
+
+// Label of the launchd agent that's installed, if no other is given
+const DefaultServiceName = "com.amazonaws.rolesanywhere.aws_signing_helper"
+
+// Paths of the agent's property list, and of the file that its standard
+// error is appended to, in the user's Library
+func launchdAgentPaths(label string) (string, string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", err
+	}
+	return filepath.Join(homeDir, "Library", "LaunchAgents", label+".plist"),
+		filepath.Join(homeDir, "Library", "Logs", label+".log"), nil
+}
+
+// Domain of the current user's launchd agents
+func launchdDomain() string {
+	return fmt.Sprintf("gui/%d", os.Getuid())
+}
+
+// Installs (and loads) a launchd agent that runs the helper with the given
+// arguments for the current user. The agent starts when the user logs in,
+// and is restarted if it exits unexpectedly (say, because credentials
+// couldn't be obtained). launchd agents have no description, so it's
+// ignored.
+func InstallService(name string, description string, args []string) error {
+	exePath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	plistPath, logPath, err := launchdAgentPaths(name)
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(plistPath); err == nil {
+		return fmt.Errorf("launchd agent %s already exists", name)
+	}
+	if err = os.MkdirAll(filepath.Dir(plistPath), 0755); err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return err
+	}
+	plist := launchdPlist(name, append([]string{exePath}, args...), logPath)
+	if err = os.WriteFile(plistPath, plist, 0644); err != nil {
+		return err
+	}
+	if output, err := exec.Command("launchctl", "bootstrap", launchdDomain(), plistPath).CombinedOutput(); err != nil {
+		os.Remove(plistPath)
+		return fmt.Errorf("unable to load the launchd agent: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Unloads (stopping it) and removes the launchd agent
+func RemoveService(name string) error {
+	plistPath, _, err := launchdAgentPaths(name)
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(plistPath); err != nil {
+		return fmt.Errorf("launchd agent %s isn't installed", name)
+	}
+	// The agent may already have been unloaded
+	exec.Command("launchctl", "bootout", launchdDomain()+"/"+name).Run()
+	return os.Remove(plistPath)
+}
+
+// Runs the given function (which runs one of the long-running modes), as
+// the launchd agent with the given label, logging to unified logging under
+// a subsystem named after the label (so that `log stream --predicate
+// 'subsystem == "<label>"'` shows the agent's logs)
+func RunService(name string, run func()) error {
+	subsystem := C.CString(name)
+	defer C.free(unsafe.Pointer(subsystem))
+	category := C.CString("default")
+	defer C.free(unsafe.Pointer(category))
+	log.SetOutput(unifiedLogWriter{C.os_log_create(subsystem, category)})
+	// Unified logging records when each message was logged
+	log.SetFlags(0)
+	run()
+	return nil
+}
+
+// Writes each log message to unified logging
+type unifiedLogWriter struct {
+	log C.os_log_t
+}
+
+func (writer unifiedLogWriter) Write(p []byte) (int, error) {
+	message := C.CString(strings.TrimSuffix(string(p), "\n"))
+	defer C.free(unsafe.Pointer(message))
+	C.logMessage(writer.log, message)
+	return len(p), nil
+}
@@ -0,0 +1,35 @@
+package aws_signing_helper
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLaunchdPlist(t *testing.T) {
+	plist := launchdPlist("com.example.helper", []string{"/usr/local/bin/aws_signing_helper", "serve", "--role-arn", "arn:aws:iam::000000000000:role/A&B"}, "/Users/me/Library/Logs/com.example.helper.log")
+
+	// The property list is well-formed XML
+	decoder := xml.NewDecoder(strings.NewReader(string(plist)))
+	for {
+		if _, err := decoder.Token(); err != nil {
+			if err != io.EOF {
+				t.Log("invalid property list:", err)
+				t.Fail()
+			}
+			break
+		}
+	}
+	for _, expected := range []string{
+		"<key>Label</key>\n\t<string>com.example.helper</string>",
+		"\t\t<string>serve</string>\n",
+		"<string>arn:aws:iam::000000000000:role/A&amp;B</string>",
+		"<key>StandardErrorPath</key>\n\t<string>/Users/me/Library/Logs/com.example.helper.log</string>",
+	} {
+		if !strings.Contains(string(plist), expected) {
+			t.Logf("expected the property list to contain %q", expected)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package aws_signing_helper
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const METRICS_RESOURCE_PATH = "/metrics"
+
+// Whether the endpoints that serve credentials also expose metrics, in the
+// Prometheus text format, at /metrics
+var MetricsEnabled = false
+
+// Upper bounds, in seconds, of the buckets of the CreateSession latency
+// histogram
+var createSessionDurationBounds = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Counters that the metrics are exported from, over the lifetime of the
+// process
+var metrics struct {
+	sync.Mutex
+	createSessionSuccesses uint64
+	createSessionFailures  uint64
+	// Number of requests in each bucket (not cumulative), and in the last
+	// element, of those that took longer than the last bound
+	createSessionDurationBuckets []uint64
+	createSessionDurationSum     float64
+	refreshSuccesses             uint64
+	refreshFailures              uint64
+	cacheHits                    uint64
+	cacheMisses                  uint64
+	// Number of refreshes that have failed since the last one that succeeded
+	consecutiveRefreshFailures uint64
+	staleCredentialsServed     uint64
+}
+
+// Records the latency and outcome of a CreateSession request
+func observeCreateSession(duration time.Duration, err error) {
+	metrics.Lock()
+	defer metrics.Unlock()
+	if err == nil {
+		metrics.createSessionSuccesses++
+	} else {
+		metrics.createSessionFailures++
+	}
+	if metrics.createSessionDurationBuckets == nil {
+		metrics.createSessionDurationBuckets = make([]uint64, len(createSessionDurationBounds)+1)
+	}
+	seconds := duration.Seconds()
+	bucket := len(createSessionDurationBounds)
+	for i, bound := range createSessionDurationBounds {
+		if seconds <= bound {
+			bucket = i
+			break
+		}
+	}
+	metrics.createSessionDurationBuckets[bucket]++
+	metrics.createSessionDurationSum += seconds
+}
+
+// Records the outcome of a refresh of served credentials
+func countRefresh(err error) {
+	metrics.Lock()
+	defer metrics.Unlock()
+	if err == nil {
+		metrics.refreshSuccesses++
+		metrics.consecutiveRefreshFailures = 0
+	} else {
+		metrics.refreshFailures++
+		metrics.consecutiveRefreshFailures++
+	}
+}
+
+// Records that a request was served credentials that couldn't be refreshed
+// when they were due to be
+func countStaleCredentialsServed() {
+	metrics.Lock()
+	defer metrics.Unlock()
+	metrics.staleCredentialsServed++
+}
+
+// Records whether a request for served credentials was answered from the
+// cache, or had to wait for them to be refreshed
+func countCacheLookup(hit bool) {
+	metrics.Lock()
+	defer metrics.Unlock()
+	if hit {
+		metrics.cacheHits++
+	} else {
+		metrics.cacheMisses++
+	}
+}
+
+// Handles GET requests to /metrics
+func metricsHandler(signer Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w, signer, time.Now())
+	}
+}
+
+// Writes the metrics in the Prometheus text format
+func writeMetrics(w io.Writer, signer Signer, now time.Time) {
+	metrics.Lock()
+	defer metrics.Unlock()
+
+	fmt.Fprintln(w, "# HELP aws_signing_helper_create_session_requests_total CreateSession requests, by result.")
+	fmt.Fprintln(w, "# TYPE aws_signing_helper_create_session_requests_total counter")
+	fmt.Fprintf(w, "aws_signing_helper_create_session_requests_total{result=\"success\"} %d\n", metrics.createSessionSuccesses)
+	fmt.Fprintf(w, "aws_signing_helper_create_session_requests_total{result=\"failure\"} %d\n", metrics.createSessionFailures)
+
+	fmt.Fprintln(w, "# HELP aws_signing_helper_create_session_duration_seconds Latency of CreateSession requests.")
+	fmt.Fprintln(w, "# TYPE aws_signing_helper_create_session_duration_seconds histogram")
+	var count uint64
+	for i, bound := range createSessionDurationBounds {
+		if metrics.createSessionDurationBuckets != nil {
+			count += metrics.createSessionDurationBuckets[i]
+		}
+		fmt.Fprintf(w, "aws_signing_helper_create_session_duration_seconds_bucket{le=\"%s\"} %d\n", strconv.FormatFloat(bound, 'g', -1, 64), count)
+	}
+	if metrics.createSessionDurationBuckets != nil {
+		count += metrics.createSessionDurationBuckets[len(createSessionDurationBounds)]
+	}
+	fmt.Fprintf(w, "aws_signing_helper_create_session_duration_seconds_bucket{le=\"+Inf\"} %d\n", count)
+	fmt.Fprintf(w, "aws_signing_helper_create_session_duration_seconds_sum %s\n", strconv.FormatFloat(metrics.createSessionDurationSum, 'g', -1, 64))
+	fmt.Fprintf(w, "aws_signing_helper_create_session_duration_seconds_count %d\n", count)
+
+	fmt.Fprintln(w, "# HELP aws_signing_helper_credential_refreshes_total Refreshes of served credentials, by result.")
+	fmt.Fprintln(w, "# TYPE aws_signing_helper_credential_refreshes_total counter")
+	fmt.Fprintf(w, "aws_signing_helper_credential_refreshes_total{result=\"success\"} %d\n", metrics.refreshSuccesses)
+	fmt.Fprintf(w, "aws_signing_helper_credential_refreshes_total{result=\"failure\"} %d\n", metrics.refreshFailures)
+
+	fmt.Fprintln(w, "# HELP aws_signing_helper_consecutive_refresh_failures Refreshes of served credentials that have failed since the last one that succeeded.")
+	fmt.Fprintln(w, "# TYPE aws_signing_helper_consecutive_refresh_failures gauge")
+	fmt.Fprintf(w, "aws_signing_helper_consecutive_refresh_failures %d\n", metrics.consecutiveRefreshFailures)
+
+	fmt.Fprintln(w, "# HELP aws_signing_helper_stale_credentials_served_total Requests served credentials that couldn't be refreshed when they were due to be.")
+	fmt.Fprintln(w, "# TYPE aws_signing_helper_stale_credentials_served_total counter")
+	fmt.Fprintf(w, "aws_signing_helper_stale_credentials_served_total %d\n", metrics.staleCredentialsServed)
+
+	fmt.Fprintln(w, "# HELP aws_signing_helper_credential_cache_requests_total Requests for served credentials, by whether they were answered from the cache.")
+	fmt.Fprintln(w, "# TYPE aws_signing_helper_credential_cache_requests_total counter")
+	fmt.Fprintf(w, "aws_signing_helper_credential_cache_requests_total{result=\"hit\"} %d\n", metrics.cacheHits)
+	fmt.Fprintf(w, "aws_signing_helper_credential_cache_requests_total{result=\"miss\"} %d\n", metrics.cacheMisses)
+
+	state, _, _ := breaker.state(now)
+	fmt.Fprintln(w, "# HELP aws_signing_helper_circuit_breaker_state Whether the circuit breaker that holds back CreateSession requests is in each state.")
+	fmt.Fprintln(w, "# TYPE aws_signing_helper_circuit_breaker_state gauge")
+	for _, name := range []string{circuitClosed, circuitOpen, circuitHalfOpen} {
+		value := 0
+		if name == state {
+			value = 1
+		}
+		fmt.Fprintf(w, "aws_signing_helper_circuit_breaker_state{state=\"%s\"} %d\n", name, value)
+	}
+
+	if certificate, err := signer.Certificate(); err == nil && certificate != nil {
+		fmt.Fprintln(w, "# HELP aws_signing_helper_certificate_expiry_days Days until the certificate expires.")
+		fmt.Fprintln(w, "# TYPE aws_signing_helper_certificate_expiry_days gauge")
+		fmt.Fprintf(w, "aws_signing_helper_certificate_expiry_days %s\n", strconv.FormatFloat(certificate.NotAfter.Sub(now).Hours()/24, 'f', 3, 64))
+	}
+}
@@ -0,0 +1,62 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	signer, err := GetFileSystemSigner("../tst/certs/ec-prime256v1-key.pem", "../tst/certs/ec-prime256v1-sha256-cert.pem", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+
+	metrics.Lock()
+	metrics.createSessionSuccesses, metrics.createSessionFailures = 0, 0
+	metrics.createSessionDurationBuckets, metrics.createSessionDurationSum = nil, 0
+	metrics.refreshSuccesses, metrics.refreshFailures = 0, 0
+	metrics.cacheHits, metrics.cacheMisses = 0, 0
+	metrics.consecutiveRefreshFailures, metrics.staleCredentialsServed = 0, 0
+	metrics.Unlock()
+
+	observeCreateSession(200*time.Millisecond, nil)
+	observeCreateSession(20*time.Second, errors.New("failure"))
+	countRefresh(errors.New("failure"))
+	countRefresh(nil)
+	countRefresh(errors.New("failure"))
+	countStaleCredentialsServed()
+	countCacheLookup(true)
+	countCacheLookup(true)
+	countCacheLookup(false)
+
+	certificate, _ := signer.Certificate()
+	var buf bytes.Buffer
+	writeMetrics(&buf, signer, certificate.NotAfter.Add(-36*time.Hour))
+	output := buf.String()
+	for _, expected := range []string{
+		`aws_signing_helper_create_session_requests_total{result="success"} 1`,
+		`aws_signing_helper_create_session_requests_total{result="failure"} 1`,
+		`aws_signing_helper_create_session_duration_seconds_bucket{le="0.1"} 0`,
+		`aws_signing_helper_create_session_duration_seconds_bucket{le="0.25"} 1`,
+		`aws_signing_helper_create_session_duration_seconds_bucket{le="10"} 1`,
+		`aws_signing_helper_create_session_duration_seconds_bucket{le="+Inf"} 2`,
+		`aws_signing_helper_create_session_duration_seconds_sum 20.2`,
+		`aws_signing_helper_create_session_duration_seconds_count 2`,
+		`aws_signing_helper_credential_refreshes_total{result="success"} 1`,
+		`aws_signing_helper_credential_refreshes_total{result="failure"} 2`,
+		`aws_signing_helper_consecutive_refresh_failures 1`,
+		`aws_signing_helper_stale_credentials_served_total 1`,
+		`aws_signing_helper_credential_cache_requests_total{result="hit"} 2`,
+		`aws_signing_helper_credential_cache_requests_total{result="miss"} 1`,
+		`aws_signing_helper_certificate_expiry_days 1.500`,
+	} {
+		if !strings.Contains(output, expected+"\n") {
+			t.Logf("expected the metrics to contain %s", expected)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+
+package aws_signing_helper
+
+import (
+	"errors"
+	"net"
+)
+
+func listenPipe(path string, securityDescriptor string) (net.Listener, error) {
+	return nil, errors.New("named pipes are only supported on Windows")
+}
@@ -0,0 +1,15 @@
+package aws_signing_helper
+
+import (
+	"net"
+
+	"github.com/Microsoft/go-winio"
+)
+
+// Listens on a named pipe (such as \\.\pipe\aws_signing_helper) whose access
+// is controlled by the given security descriptor, in SDDL format (or by the
+// default one, which only lets administrators, SYSTEM, and the pipe's creator
+// write to it, if it's empty)
+func listenPipe(path string, securityDescriptor string) (net.Listener, error) {
+	return winio.ListenPipe(path, &winio.PipeConfig{SecurityDescriptor: securityDescriptor})
+}
@@ -0,0 +1,140 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	ncrypt                        = windows.NewLazySystemDLL("ncrypt.dll")
+	procNCryptOpenStorageProvider = ncrypt.NewProc("NCryptOpenStorageProvider")
+	procNCryptOpenKey             = ncrypt.NewProc("NCryptOpenKey")
+	procNCryptSignHash            = ncrypt.NewProc("NCryptSignHash")
+	procNCryptFreeObject          = ncrypt.NewProc("NCryptFreeObject")
+)
+
+const (
+	msPlatformCryptoProvider = "Microsoft Platform Crypto Provider"
+
+	ncryptMachineKeyFlag = 0x00000020
+	ncryptSilentFlag     = 0x00000040
+	bcryptPadPKCS1       = 0x00000002
+	bcryptPadPSS         = 0x00000008
+)
+
+// BCRYPT_PKCS1_PADDING_INFO
+type bcryptPKCS1PaddingInfo struct {
+	algId *uint16
+}
+
+// BCRYPT_PSS_PADDING_INFO
+type bcryptPSSPaddingInfo struct {
+	algId *uint16
+	salt  uint32
+}
+
+// Names of the CNG hash algorithms, as expected in the padding info
+var cngHashAlgorithms = map[crypto.Hash]string{
+	crypto.SHA256: "SHA256",
+	crypto.SHA384: "SHA384",
+	crypto.SHA512: "SHA512",
+}
+
+// Converts a SECURITY_STATUS returned by an NCrypt function into an error
+func ncryptError(function string, status uintptr) error {
+	if status == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s failed: %w", function, windows.Errno(status))
+}
+
+// Opens the key with the given name in the key storage provider
+func ncryptOpenKey(providerName string, keyName string, machineKey bool) (uintptr, error) {
+	providerNamePtr, err := windows.UTF16PtrFromString(providerName)
+	if err != nil {
+		return 0, err
+	}
+	keyNamePtr, err := windows.UTF16PtrFromString(keyName)
+	if err != nil {
+		return 0, err
+	}
+
+	var provider uintptr
+	status, _, _ := procNCryptOpenStorageProvider.Call(uintptr(unsafe.Pointer(&provider)), uintptr(unsafe.Pointer(providerNamePtr)), 0)
+	if err := ncryptError("NCryptOpenStorageProvider", status); err != nil {
+		return 0, err
+	}
+	defer procNCryptFreeObject.Call(provider)
+
+	var flags uintptr = ncryptSilentFlag
+	if machineKey {
+		flags |= ncryptMachineKeyFlag
+	}
+	var key uintptr
+	status, _, _ = procNCryptOpenKey.Call(provider, uintptr(unsafe.Pointer(&key)), uintptr(unsafe.Pointer(keyNamePtr)), 0, flags)
+	if err := ncryptError("NCryptOpenKey", status); err != nil {
+		return 0, err
+	}
+	return key, nil
+}
+
+func ncryptFreeKey(key uintptr) {
+	procNCryptFreeObject.Call(key)
+}
+
+// Signs the digest with the CNG key. ECDSA signatures are returned by CNG
+// in their raw (r || s) form, and are converted into their ASN.1 encoding.
+// RSA keys produce PSS signatures when opts is an *rsa.PSSOptions.
+func ncryptSignHash(key uintptr, public crypto.PublicKey, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if len(digest) == 0 {
+		return nil, errors.New("empty digest")
+	}
+
+	var paddingInfo unsafe.Pointer
+	var flags uintptr
+	switch public.(type) {
+	case *rsa.PublicKey:
+		algorithm, ok := cngHashAlgorithms[opts.HashFunc()]
+		if !ok {
+			return nil, errors.New("unsupported digest")
+		}
+		algorithmPtr, err := windows.UTF16PtrFromString(algorithm)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := opts.(*rsa.PSSOptions); ok {
+			paddingInfo = unsafe.Pointer(&bcryptPSSPaddingInfo{algorithmPtr, uint32(opts.HashFunc().Size())})
+			flags = bcryptPadPSS
+		} else {
+			paddingInfo = unsafe.Pointer(&bcryptPKCS1PaddingInfo{algorithmPtr})
+			flags = bcryptPadPKCS1
+		}
+	case *ecdsa.PublicKey:
+	default:
+		return nil, errors.New("unsupported algorithm")
+	}
+
+	// The first call obtains the size of the signature
+	var size uint32
+	status, _, _ := procNCryptSignHash.Call(key, uintptr(paddingInfo), uintptr(unsafe.Pointer(&digest[0])), uintptr(len(digest)), 0, 0, uintptr(unsafe.Pointer(&size)), flags)
+	if err := ncryptError("NCryptSignHash", status); err != nil {
+		return nil, err
+	}
+	sig := make([]byte, size)
+	status, _, _ = procNCryptSignHash.Call(key, uintptr(paddingInfo), uintptr(unsafe.Pointer(&digest[0])), uintptr(len(digest)), uintptr(unsafe.Pointer(&sig[0])), uintptr(size), uintptr(unsafe.Pointer(&size)), flags)
+	if err := ncryptError("NCryptSignHash", status); err != nil {
+		return nil, err
+	}
+	sig = sig[:size]
+
+	if _, ok := public.(*ecdsa.PublicKey); ok {
+		return encodeECDSASignature(sig)
+	}
+	return sig, nil
+}
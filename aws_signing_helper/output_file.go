@@ -0,0 +1,41 @@
+package aws_signing_helper
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// Writes the credentials, in the credential process format, to the file at
+// the given path, which only its owner can read. The file is replaced
+// atomically, so that processes reading it (say, tailing it from a sidecar)
+// never see it partially written.
+func WriteCredentialProcessOutput(path string, credentialProcessOutput CredentialProcessOutput) error {
+	buf, err := json.Marshal(credentialProcessOutput)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(path, buf)
+}
+
+// Replaces the file at the given path with one, which only its owner can
+// read, that holds the data
+func writeFileAtomically(path string, data []byte) error {
+	// Temporary files are created with permissions of 0600
+	destFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(destFile.Name())
+	defer destFile.Close()
+	if _, err = destFile.Write(data); err != nil {
+		return err
+	}
+	if err = destFile.Sync(); err != nil {
+		return err
+	}
+	if err = destFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(destFile.Name(), path)
+}
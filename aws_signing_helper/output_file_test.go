@@ -0,0 +1,48 @@
+package aws_signing_helper
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteCredentialProcessOutput(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "credentials.json")
+	// An existing file is replaced, along with its permissions
+	if err := os.WriteFile(outputPath, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	credentialProcessOutput := CredentialProcessOutput{
+		Version:         1,
+		AccessKeyId:     "accessKeyId",
+		SecretAccessKey: "secretAccessKey",
+		SessionToken:    "sessionToken",
+		Expiration:      "2022-07-27T04:36:55Z",
+	}
+	if err := WriteCredentialProcessOutput(outputPath, credentialProcessOutput); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written CredentialProcessOutput
+	if err = json.Unmarshal(data, &written); err != nil || written != credentialProcessOutput {
+		t.Log("unexpected file contents:", string(data))
+		t.Fail()
+	}
+	info, _ := os.Stat(outputPath)
+	if info.Mode() != 0600 {
+		t.Log("unexpected file mode:", info.Mode())
+		t.Fail()
+	}
+	// No temporary files are left behind
+	entries, _ := os.ReadDir(filepath.Dir(outputPath))
+	if len(entries) != 1 {
+		t.Log("expected only the output file in its directory")
+		t.Fail()
+	}
+}
@@ -0,0 +1,130 @@
+package aws_signing_helper
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const PinEnvVarName = "AWS_ROLESANYWHERE_PIN"
+const PassphraseEnvVarName = "AWS_ROLESANYWHERE_PASSPHRASE"
+
+// Sources from which the PIN for a hardware-backed key can be obtained
+type PinOpts struct {
+	// PIN that was provided explicitly (for example, through the
+	// `pin-value` attribute of a PKCS#11 URI)
+	Pin string
+	// Path to a file containing the PIN
+	PinFile string
+	// Whether the token has a protected authentication path (such as a
+	// PIN pad), in which case the PIN is entered on the device itself
+	ProtectedAuthenticationPath bool
+	// Text shown to the user if they have to be prompted for the PIN
+	Prompt string
+}
+
+// Error returned when a PIN is required but none could be obtained
+var ErrPinRequired = errors.New("a PIN is required but was not provided (use --pin-file, the " + PinEnvVarName + " environment variable, or run interactively)")
+
+// Error returned when a passphrase is required but none could be obtained
+var ErrPassphraseRequired = errors.New("a passphrase is required but was not provided (use --passphrase-file, the " + PassphraseEnvVarName + " environment variable, or run interactively)")
+
+// Obtains the PIN from the first available source, in order of precedence:
+// an explicitly provided PIN, the PIN file, the PinEnvVarName environment
+// variable, the token's protected authentication path, and finally an
+// interactive prompt on the terminal. The returned PIN is empty if it is
+// to be entered through the protected authentication path.
+func GetPin(opts PinOpts) (string, error) {
+	if opts.Pin != "" {
+		return opts.Pin, nil
+	}
+	if opts.PinFile != "" {
+		return readSecretFile(opts.PinFile, "PIN")
+	}
+	if pin, ok := os.LookupEnv(PinEnvVarName); ok && pin != "" {
+		return pin, nil
+	}
+	if opts.ProtectedAuthenticationPath {
+		fmt.Fprintln(os.Stderr, "Please enter the PIN on the device")
+		return "", nil
+	}
+	if opts.Prompt == "" {
+		opts.Prompt = "Please enter your PIN:"
+	}
+	return promptForSecret(opts.Prompt, ErrPinRequired)
+}
+
+// Obtains the passphrase for an encrypted private key (or PKCS#12 bundle)
+// from the first available source, in order of precedence: the passphrase
+// file, the PassphraseEnvVarName environment variable, and finally an
+// interactive prompt on the terminal
+func GetPassphrase(passphraseFile string, prompt string) (string, error) {
+	if passphraseFile != "" {
+		return readSecretFile(passphraseFile, "passphrase")
+	}
+	if passphrase, ok := os.LookupEnv(PassphraseEnvVarName); ok {
+		return passphrase, nil
+	}
+	return promptForSecret(prompt, ErrPassphraseRequired)
+}
+
+// Reads a secret (named `name` in errors) from the first line of the file
+// at the provided path
+func readSecretFile(path string, name string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("%s file is empty", name)
+	}
+	secret := strings.TrimRight(scanner.Text(), "\r")
+	if secret == "" {
+		return "", fmt.Errorf("%s file is empty", name)
+	}
+	return secret, nil
+}
+
+// Prompts for a secret on the controlling terminal, without echoing it.
+// The prompt is written to stderr, since stdout is reserved for the output
+// consumed by the SDK. `errRequired` is returned if there's no terminal, or
+// nothing is entered.
+func promptForSecret(prompt string, errRequired error) (string, error) {
+	tty, err := openTerminal()
+	if err != nil {
+		return "", errRequired
+	}
+	defer tty.Close()
+	if !term.IsTerminal(int(tty.Fd())) {
+		return "", errRequired
+	}
+
+	fmt.Fprint(os.Stderr, prompt+" ")
+	secret, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if len(secret) == 0 {
+		return "", errRequired
+	}
+	return string(secret), nil
+}
+
+func openTerminal() (*os.File, error) {
+	if runtime.GOOS == "windows" {
+		return os.OpenFile("CONIN$", os.O_RDWR, 0)
+	}
+	return os.OpenFile("/dev/tty", os.O_RDWR, 0)
+}
@@ -0,0 +1,352 @@
+//go:build piv
+
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/go-piv/piv-go/piv"
+)
+
+// Maps the supported slot names to PIV slots
+var pivSlots = map[string]piv.Slot{
+	"9a": piv.SlotAuthentication,
+	"9c": piv.SlotSignature,
+	"9d": piv.SlotKeyManagement,
+	"9e": piv.SlotCardAuthentication,
+}
+
+// Maps the supported PIN policy names to PIV PIN policies
+var pivPinPolicies = map[string]piv.PINPolicy{
+	"never":  piv.PINPolicyNever,
+	"once":   piv.PINPolicyOnce,
+	"always": piv.PINPolicyAlways,
+}
+
+// Signer that uses a key in a PIV slot of a YubiKey (or another PIV card),
+// talking to the card directly rather than through a PKCS#11 module. If the
+// card is removed and reinserted, the signer reopens it.
+type PIVSigner struct {
+	mutex            sync.Mutex
+	card             string
+	yk               *piv.YubiKey
+	slot             piv.Slot
+	auth             piv.KeyAuth
+	privateKey       crypto.Signer
+	touchRequired    bool
+	pinFile          string
+	pin              string
+	public           crypto.PublicKey
+	cert             *x509.Certificate
+	certificateChain []*x509.Certificate
+}
+
+// Finds the card whose reader name contains `card` (case-insensitively).
+// If no card is specified, the first YubiKey (or else, the first card) is
+// used.
+func findPIVCard(card string) (string, error) {
+	cards, err := piv.Cards()
+	if err != nil {
+		return "", fmt.Errorf("unable to list smart cards: %w", err)
+	}
+	if len(cards) == 0 {
+		return "", errors.New("no smart card found")
+	}
+	if card == "" {
+		for _, name := range cards {
+			if strings.Contains(strings.ToLower(name), "yubikey") {
+				return name, nil
+			}
+		}
+		return cards[0], nil
+	}
+	for _, name := range cards {
+		if strings.Contains(strings.ToLower(name), strings.ToLower(card)) {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("no smart card matching %q found", card)
+}
+
+// Parses a PIV slot name (9a, 9c, 9d, or 9e)
+func parsePIVSlot(slot string) (piv.Slot, error) {
+	if slot == "" {
+		return piv.SlotAuthentication, nil
+	}
+	pivSlot, ok := pivSlots[strings.ToLower(slot)]
+	if !ok {
+		return piv.Slot{}, fmt.Errorf("unsupported PIV slot: %s", slot)
+	}
+	return pivSlot, nil
+}
+
+// Creates a signer that uses the key in the given slot of the PIV card.
+// The certificate is read from the slot, unless `certificateId` is
+// provided. The PIN policy (never, once, or always) is determined from the
+// slot's attestation unless `pinPolicy` is provided, which is necessary for
+// imported keys and older YubiKeys.
+func GetPIVSigner(card string, slot string, pinPolicy string, certificateId string, certificateBundleId string, pinFile string) (signer Signer, err error) {
+	pivSlot, err := parsePIVSlot(slot)
+	if err != nil {
+		return nil, err
+	}
+	auth := piv.KeyAuth{}
+	if pinPolicy != "" {
+		var ok bool
+		if auth.PINPolicy, ok = pivPinPolicies[strings.ToLower(pinPolicy)]; !ok {
+			return nil, fmt.Errorf("unsupported PIN policy: %s", pinPolicy)
+		}
+	}
+
+	pivSigner := &PIVSigner{card: card, slot: pivSlot, auth: auth, pinFile: pinFile}
+	if pivSigner.yk, err = openPIVCard(card); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			pivSigner.Close()
+		}
+	}()
+
+	if certificateId != "" {
+		pivSigner.cert, err = readCertificate(certificateId)
+	} else {
+		pivSigner.cert, err = pivSigner.yk.Certificate(pivSlot)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read certificate: %w", err)
+	}
+	pivSigner.public = pivSigner.cert.PublicKey
+	if certificateBundleId != "" {
+		if pivSigner.certificateChain, err = ReadCertificateBundleData(certificateBundleId); err != nil {
+			return nil, err
+		}
+	}
+	if err = pivSigner.initPrivateKey(); err != nil {
+		return nil, err
+	}
+	return pivSigner, nil
+}
+
+func openPIVCard(card string) (*piv.YubiKey, error) {
+	cardName, err := findPIVCard(card)
+	if err != nil {
+		return nil, err
+	}
+	yk, err := piv.Open(cardName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open smart card: %w", err)
+	}
+	return yk, nil
+}
+
+// Maps the supported key types to PIV algorithms
+var pivAlgorithms = map[string]piv.Algorithm{
+	KeyTypeP256:    piv.AlgorithmEC256,
+	KeyTypeP384:    piv.AlgorithmEC384,
+	KeyTypeRSA2048: piv.AlgorithmRSA2048,
+}
+
+// Generates a key of the given type in the given slot of the PIV card,
+// replacing the key that the slot holds (if any), and authenticating with
+// the hex-encoded management key (or the default one, if none is provided).
+// The key requires the PIN according to the PIN policy (once, by default),
+// but never a touch. The returned signer has no certificate, and is meant to
+// create a CSR with.
+func GeneratePIVKey(card string, slot string, keyType string, pinPolicy string, managementKey string, pinFile string) (signer Signer, err error) {
+	pivSlot, err := parsePIVSlot(slot)
+	if err != nil {
+		return nil, err
+	}
+	if keyType == "" {
+		keyType = KeyTypeP256
+	}
+	algorithm, ok := pivAlgorithms[strings.ToLower(keyType)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type: %s", keyType)
+	}
+	auth := piv.KeyAuth{PINPolicy: piv.PINPolicyOnce}
+	if pinPolicy != "" {
+		if auth.PINPolicy, ok = pivPinPolicies[strings.ToLower(pinPolicy)]; !ok {
+			return nil, fmt.Errorf("unsupported PIN policy: %s", pinPolicy)
+		}
+	}
+	key := piv.DefaultManagementKey
+	if managementKey != "" {
+		keyBytes, err := hex.DecodeString(managementKey)
+		if err != nil || len(keyBytes) != len(key) {
+			return nil, errors.New("the management key has to consist of 48 hex digits")
+		}
+		copy(key[:], keyBytes)
+	}
+
+	pivSigner := &PIVSigner{card: card, slot: pivSlot, auth: auth, pinFile: pinFile}
+	if pivSigner.yk, err = openPIVCard(card); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			pivSigner.Close()
+		}
+	}()
+	pivSigner.public, err = pivSigner.yk.GenerateKey(key, pivSlot, piv.Key{
+		Algorithm:   algorithm,
+		PINPolicy:   auth.PINPolicy,
+		TouchPolicy: piv.TouchPolicyNever,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate a key in slot %s: %w", pivSlot, err)
+	}
+	if err = pivSigner.initPrivateKey(); err != nil {
+		return nil, err
+	}
+	return pivSigner, nil
+}
+
+// Obtains the attestation of the key in the given slot of the PIV card:
+// the slot's attestation certificate, followed by the card's attestation
+// certificate that issued it (which chains to the manufacturer's root, such
+// as the Yubico PIV Root CA), as PEM blocks. Only keys that were generated
+// on the card can be attested.
+func AttestPIVKey(card string, slot string) ([]byte, error) {
+	pivSlot, err := parsePIVSlot(slot)
+	if err != nil {
+		return nil, err
+	}
+	yk, err := openPIVCard(card)
+	if err != nil {
+		return nil, err
+	}
+	defer yk.Close()
+
+	slotAttestationCert, err := yk.Attest(pivSlot)
+	if err != nil {
+		return nil, fmt.Errorf("unable to attest the key in slot %s (was it imported?): %w", pivSlot, err)
+	}
+	attestationCert, err := yk.AttestationCertificate()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the card's attestation certificate: %w", err)
+	}
+	if _, err = piv.Verify(attestationCert, slotAttestationCert); err != nil {
+		return nil, fmt.Errorf("the attestation of the key in slot %s doesn't verify: %w", pivSlot, err)
+	}
+	statement := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: slotAttestationCert.Raw})
+	return append(statement, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: attestationCert.Raw})...), nil
+}
+
+// Sets up the private key in the signer's slot of the currently open card
+func (pivSigner *PIVSigner) initPrivateKey() error {
+	yk := pivSigner.yk
+
+	// The attestation (which is only available for keys that were generated
+	// on the card) tells whether the key requires a touch
+	if slotAttestationCert, err := yk.Attest(pivSigner.slot); err == nil {
+		if attestationCert, err := yk.AttestationCertificate(); err == nil {
+			if attestation, err := piv.Verify(attestationCert, slotAttestationCert); err == nil {
+				pivSigner.touchRequired = attestation.TouchPolicy != piv.TouchPolicyNever
+			}
+		}
+	}
+
+	// The PIN is cached once entered, so that daemon modes don't prompt for
+	// it again when the PIN policy is "always"
+	auth := pivSigner.auth
+	auth.PINPrompt = func() (string, error) {
+		if pivSigner.pin == "" {
+			pin, err := GetPin(PinOpts{PinFile: pivSigner.pinFile, Prompt: "Please enter the PIV PIN:"})
+			if err != nil {
+				return "", err
+			}
+			pivSigner.pin = pin
+		}
+		return pivSigner.pin, nil
+	}
+	privateKey, err := yk.PrivateKey(pivSigner.slot, pivSigner.public, auth)
+	if err != nil {
+		return fmt.Errorf("unable to access the private key in slot %s: %w", pivSigner.slot, err)
+	}
+	var ok bool
+	if pivSigner.privateKey, ok = privateKey.(crypto.Signer); !ok {
+		return errors.New("the private key doesn't support signing")
+	}
+	return nil
+}
+
+// Reopens the card after it has been removed (or reset). The cached PIN is
+// discarded, since the reinserted card may not be the same one.
+func (pivSigner *PIVSigner) reconnect() error {
+	pivSigner.yk.Close()
+	pivSigner.yk = nil
+	pivSigner.pin = ""
+
+	yk, err := openPIVCard(pivSigner.card)
+	if err != nil {
+		return fmt.Errorf("the smart card is unavailable (was it removed?): %w", err)
+	}
+	pivSigner.yk = yk
+	if slotCert, err := yk.Certificate(pivSigner.slot); err == nil && !publicKeysEqual(slotCert.PublicKey, pivSigner.public) {
+		return errors.New("a different smart card has been inserted")
+	}
+	return pivSigner.initPrivateKey()
+}
+
+func (pivSigner *PIVSigner) Public() crypto.PublicKey {
+	return pivSigner.public
+}
+
+func (pivSigner *PIVSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	// A card can only process a single command at a time
+	pivSigner.mutex.Lock()
+	defer pivSigner.mutex.Unlock()
+	if pivSigner.yk == nil {
+		return nil, errors.New("signer has been closed")
+	}
+	if pivSigner.touchRequired {
+		fmt.Fprintln(os.Stderr, "Please touch your security key")
+	}
+	sig, err := pivSigner.privateKey.Sign(rand, digest, opts)
+	if err == nil {
+		return sig, nil
+	}
+
+	// If the card doesn't respond to a command that doesn't require any
+	// authentication either, it has been removed or reset
+	if _, probeErr := pivSigner.yk.Retries(); probeErr == nil {
+		return nil, err
+	}
+	log.Println("smart card is unavailable, reconnecting:", err)
+	if err = pivSigner.reconnect(); err != nil {
+		return nil, err
+	}
+	if pivSigner.touchRequired {
+		fmt.Fprintln(os.Stderr, "Please touch your security key")
+	}
+	return pivSigner.privateKey.Sign(rand, digest, opts)
+}
+
+func (pivSigner *PIVSigner) Certificate() (*x509.Certificate, error) {
+	return pivSigner.cert, nil
+}
+
+func (pivSigner *PIVSigner) CertificateChain() ([]*x509.Certificate, error) {
+	return pivSigner.certificateChain, nil
+}
+
+func (pivSigner *PIVSigner) Close() {
+	pivSigner.mutex.Lock()
+	defer pivSigner.mutex.Unlock()
+	if pivSigner.yk != nil {
+		pivSigner.yk.Close()
+		pivSigner.yk = nil
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !piv
+
+package aws_signing_helper
+
+import (
+	"errors"
+)
+
+func GetPIVSigner(card string, slot string, pinPolicy string, certificateId string, certificateBundleId string, pinFile string) (Signer, error) {
+	return nil, errors.New("PIV support isn't included in this build (rebuild with `-tags piv`)")
+}
+
+func AttestPIVKey(card string, slot string) ([]byte, error) {
+	return nil, errors.New("PIV support isn't included in this build (rebuild with `-tags piv`)")
+}
+
+func GeneratePIVKey(card string, slot string, keyType string, pinPolicy string, managementKey string, pinFile string) (Signer, error) {
+	return nil, errors.New("PIV support isn't included in this build (rebuild with `-tags piv`)")
+}
@@ -0,0 +1,787 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/miekg/pkcs11"
+)
+
+const pkcs11URIScheme = "pkcs11:"
+
+// Order in which path attributes are emitted when building a URI
+var pkcs11PathAttributeOrder = []string{"token", "manufacturer", "model", "serial", "slot-id", "object", "id", "type"}
+
+// Maps the `type` path attribute of a PKCS#11 URI to an object class
+var pkcs11ObjectClasses = map[string]uint{
+	"cert":    pkcs11.CKO_CERTIFICATE,
+	"private": pkcs11.CKO_PRIVATE_KEY,
+	"public":  pkcs11.CKO_PUBLIC_KEY,
+}
+
+// DigestInfo prefixes that have to be prepended to a digest when signing
+// it with CKM_RSA_PKCS (see RFC 8017, section 9.2)
+var pkcs1DigestInfoPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+// Hash and MGF1 mechanisms of the CKM_RSA_PKCS_PSS parameters, for each
+// digest
+var pkcs11PSSParams = map[crypto.Hash][2]uint{
+	crypto.SHA256: {pkcs11.CKM_SHA256, pkcs11.CKG_MGF1_SHA256},
+	crypto.SHA384: {pkcs11.CKM_SHA384, pkcs11.CKG_MGF1_SHA384},
+	crypto.SHA512: {pkcs11.CKM_SHA512, pkcs11.CKG_MGF1_SHA512},
+}
+
+// Parsed representation of a PKCS#11 URI, as specified in RFC 7512
+type pkcs11URI struct {
+	pathAttributes  map[string]string
+	queryAttributes map[string]string
+}
+
+// Maximum number of idle sessions that are kept open for reuse
+const maxIdlePKCS11Sessions = 8
+
+// Signer that uses a private key held on a PKCS#11 token. Sessions are
+// pooled, so that a long-running helper only logs into the token once and
+// concurrent signing operations don't have to wait for each other. If the
+// token is removed and reinserted, the signer reconnects to it.
+type PKCS11Signer struct {
+	module *pkcs11.Ctx
+	// Guards the slot, the key handle, and the generation (which is
+	// incremented whenever the signer reconnects to the token)
+	mutex            sync.RWMutex
+	slot             uint
+	privateKeyHandle pkcs11.ObjectHandle
+	generation       uint
+	idleSessions     chan pkcs11.SessionHandle
+	keyURI           *pkcs11URI
+	keyTemplate      []*pkcs11.Attribute
+	pinFile          string
+	keyType          uint
+	cert             *x509.Certificate
+	certificateChain []*x509.Certificate
+}
+
+// Errors that indicate that the token has been removed (or reset), after
+// which the signer has to reconnect to it
+var pkcs11TokenRemovedErrors = []pkcs11.Error{
+	pkcs11.CKR_DEVICE_REMOVED,
+	pkcs11.CKR_DEVICE_ERROR,
+	pkcs11.CKR_TOKEN_NOT_PRESENT,
+	pkcs11.CKR_TOKEN_NOT_RECOGNIZED,
+	pkcs11.CKR_SESSION_HANDLE_INVALID,
+	pkcs11.CKR_SESSION_CLOSED,
+	pkcs11.CKR_USER_NOT_LOGGED_IN,
+	pkcs11.CKR_KEY_HANDLE_INVALID,
+	pkcs11.CKR_OBJECT_HANDLE_INVALID,
+}
+
+// Container for information about a token, and the objects on it,
+// that is returned by the `list-keys` command
+type PKCS11Slot struct {
+	SlotId       uint
+	TokenLabel   string
+	Manufacturer string
+	Model        string
+	SerialNumber string
+	Objects      []PKCS11Object
+}
+
+// Container for information about an object on a PKCS#11 token
+type PKCS11Object struct {
+	// One of "cert", "private", and "public"
+	Type  string
+	Label string
+	// URI that can be passed to --certificate or --private-key
+	Uri string
+	// Subject of the certificate. Only set for certificates.
+	Subject string
+}
+
+func isPKCS11URI(id string) bool {
+	return strings.HasPrefix(id, pkcs11URIScheme)
+}
+
+// Parses a PKCS#11 URI of the form `pkcs11:attr=value;...?qattr=value&...`
+func parsePKCS11URI(uri string) (*pkcs11URI, error) {
+	if !isPKCS11URI(uri) {
+		return nil, errors.New("not a PKCS#11 URI")
+	}
+	parsed := &pkcs11URI{make(map[string]string), make(map[string]string)}
+
+	path, query, _ := strings.Cut(strings.TrimPrefix(uri, pkcs11URIScheme), "?")
+	parts := []struct {
+		value      string
+		separator  string
+		attributes map[string]string
+	}{
+		{path, ";", parsed.pathAttributes},
+		{query, "&", parsed.queryAttributes},
+	}
+	for _, part := range parts {
+		if part.value == "" {
+			continue
+		}
+		for _, attribute := range strings.Split(part.value, part.separator) {
+			name, value, found := strings.Cut(attribute, "=")
+			if !found || name == "" {
+				return nil, fmt.Errorf("invalid PKCS#11 URI attribute: %s", attribute)
+			}
+			value, err := url.PathUnescape(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid PKCS#11 URI attribute: %s", attribute)
+			}
+			if _, ok := part.attributes[name]; ok {
+				return nil, fmt.Errorf("duplicate PKCS#11 URI attribute: %s", name)
+			}
+			part.attributes[name] = value
+		}
+	}
+
+	if objectType, ok := parsed.pathAttributes["type"]; ok {
+		if _, ok := pkcs11ObjectClasses[objectType]; !ok {
+			return nil, fmt.Errorf("unsupported PKCS#11 object type: %s", objectType)
+		}
+	}
+	if slotId, ok := parsed.pathAttributes["slot-id"]; ok {
+		if _, err := strconv.ParseUint(slotId, 10, 0); err != nil {
+			return nil, fmt.Errorf("invalid PKCS#11 slot-id: %s", slotId)
+		}
+	}
+	return parsed, nil
+}
+
+// Percent-encodes everything except the characters that RFC 7512 allows
+// to appear unescaped in an attribute value
+func pkcs11Escape(value string) string {
+	var builder strings.Builder
+	for _, b := range []byte(value) {
+		if ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') || ('0' <= b && b <= '9') ||
+			strings.IndexByte("-._~:[]@!$'()*+,", b) >= 0 {
+			builder.WriteByte(b)
+		} else {
+			fmt.Fprintf(&builder, "%%%02X", b)
+		}
+	}
+	return builder.String()
+}
+
+// Builds the string representation of the URI. Query attributes are
+// intentionally left out, so that the PIN isn't echoed back.
+func (uri *pkcs11URI) String() string {
+	var attributes []string
+	for _, name := range pkcs11PathAttributeOrder {
+		if value, ok := uri.pathAttributes[name]; ok {
+			attributes = append(attributes, name+"="+pkcs11Escape(value))
+		}
+	}
+	return pkcs11URIScheme + strings.Join(attributes, ";")
+}
+
+// Whether the token in the given slot matches the token-related
+// attributes of the URI
+func (uri *pkcs11URI) matchesToken(slotId uint, tokenInfo pkcs11.TokenInfo) bool {
+	expected := map[string]string{
+		"token":        tokenInfo.Label,
+		"manufacturer": tokenInfo.ManufacturerID,
+		"model":        tokenInfo.Model,
+		"serial":       tokenInfo.SerialNumber,
+		"slot-id":      strconv.FormatUint(uint64(slotId), 10),
+	}
+	for name, value := range expected {
+		if uriValue, ok := uri.pathAttributes[name]; ok && uriValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Builds the search template for the object-related attributes of the URI
+func (uri *pkcs11URI) objectTemplate(class uint) []*pkcs11.Attribute {
+	template := []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_CLASS, class)}
+	if label, ok := uri.pathAttributes["object"]; ok {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_LABEL, label))
+	}
+	if id, ok := uri.pathAttributes["id"]; ok {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_ID, []byte(id)))
+	}
+	return template
+}
+
+// Loads and initializes the PKCS#11 module at the provided path
+func loadPKCS11Module(libPkcs11 string) (*pkcs11.Ctx, error) {
+	if libPkcs11 == "" {
+		return nil, errors.New("no PKCS#11 module specified (use --pkcs11-lib)")
+	}
+	module := pkcs11.New(libPkcs11)
+	if module == nil {
+		return nil, fmt.Errorf("unable to load PKCS#11 module: %s", libPkcs11)
+	}
+	if err := module.Initialize(); err != nil {
+		module.Destroy()
+		return nil, err
+	}
+	return module, nil
+}
+
+func closePKCS11Module(module *pkcs11.Ctx) {
+	module.Finalize()
+	module.Destroy()
+}
+
+// Finds the slot holding the (single) token that matches the URI
+func findPKCS11Slot(module *pkcs11.Ctx, uri *pkcs11URI) (uint, error) {
+	slots, err := module.GetSlotList(true)
+	if err != nil {
+		return 0, err
+	}
+	var matches []uint
+	for _, slot := range slots {
+		tokenInfo, err := module.GetTokenInfo(slot)
+		if err != nil {
+			log.Printf("unable to get token info for slot %d: %s", slot, err)
+			continue
+		}
+		if uri.matchesToken(slot, tokenInfo) {
+			matches = append(matches, slot)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return 0, errors.New("no PKCS#11 token matches the provided URI")
+	case 1:
+		return matches[0], nil
+	default:
+		return 0, errors.New("multiple PKCS#11 tokens match the provided URI; use list-keys to find a more specific one")
+	}
+}
+
+// Finds all objects on the token that match the template
+func findPKCS11Objects(module *pkcs11.Ctx, session pkcs11.SessionHandle, template []*pkcs11.Attribute) ([]pkcs11.ObjectHandle, error) {
+	if err := module.FindObjectsInit(session, template); err != nil {
+		return nil, err
+	}
+	defer module.FindObjectsFinal(session)
+
+	var handles []pkcs11.ObjectHandle
+	for {
+		batch, _, err := module.FindObjects(session, 16)
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		handles = append(handles, batch...)
+	}
+	return handles, nil
+}
+
+// Finds the single object on the token that matches the template
+func findPKCS11Object(module *pkcs11.Ctx, session pkcs11.SessionHandle, template []*pkcs11.Attribute) (pkcs11.ObjectHandle, error) {
+	handles, err := findPKCS11Objects(module, session, template)
+	if err != nil {
+		return 0, err
+	}
+	switch len(handles) {
+	case 0:
+		return 0, errors.New("no PKCS#11 object matches the provided URI")
+	case 1:
+		return handles[0], nil
+	default:
+		return 0, errors.New("multiple PKCS#11 objects match the provided URI; use list-keys to find a more specific one")
+	}
+}
+
+// Reads the given attributes of an object, returning their values in order
+func getPKCS11Attributes(module *pkcs11.Ctx, session pkcs11.SessionHandle, object pkcs11.ObjectHandle, types ...uint) ([][]byte, error) {
+	var template []*pkcs11.Attribute
+	for _, attributeType := range types {
+		template = append(template, pkcs11.NewAttribute(attributeType, nil))
+	}
+	attributes, err := module.GetAttributeValue(session, object, template)
+	if err != nil {
+		return nil, err
+	}
+	values := make([][]byte, len(attributes))
+	for i, attribute := range attributes {
+		values[i] = attribute.Value
+	}
+	return values, nil
+}
+
+// Logs into the token in the session's slot, if the token requires it or
+// if a PIN has been provided explicitly. The PIN is obtained through
+// GetPin; a wrong PIN isn't retried, so as not to lock the token.
+func loginPKCS11(module *pkcs11.Ctx, session pkcs11.SessionHandle, uri *pkcs11URI, pinFile string) error {
+	sessionInfo, err := module.GetSessionInfo(session)
+	if err != nil {
+		return err
+	}
+	tokenInfo, err := module.GetTokenInfo(sessionInfo.SlotID)
+	if err != nil {
+		return err
+	}
+
+	pinOpts := PinOpts{
+		Pin:                         uri.queryAttributes["pin-value"],
+		PinFile:                     pinFile,
+		ProtectedAuthenticationPath: tokenInfo.Flags&pkcs11.CKF_PROTECTED_AUTHENTICATION_PATH != 0,
+		Prompt:                      fmt.Sprintf("Please enter the PIN for token %q:", tokenInfo.Label),
+	}
+	if pinSource, ok := uri.queryAttributes["pin-source"]; ok {
+		pinOpts.PinFile = strings.TrimPrefix(pinSource, "file:")
+	}
+	if tokenInfo.Flags&pkcs11.CKF_LOGIN_REQUIRED == 0 && pinOpts.Pin == "" && pinOpts.PinFile == "" {
+		return nil
+	}
+
+	pin, err := GetPin(pinOpts)
+	if err != nil {
+		return err
+	}
+	err = module.Login(session, pkcs11.CKU_USER, pin)
+	if err != nil && err != pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+		return fmt.Errorf("unable to log into PKCS#11 token %q: %w", tokenInfo.Label, err)
+	}
+	return nil
+}
+
+// Creates a signer that uses the key (and, optionally, the certificate)
+// referenced by the provided PKCS#11 URIs. If no private key URI is
+// provided, the key with the same CKA_ID as the certificate is used.
+func GetPKCS11Signer(libPkcs11 string, certificateId string, privateKeyId string, certificateBundleId string, pinFile string) (signer Signer, err error) {
+	var certURI, keyURI *pkcs11URI
+	if isPKCS11URI(certificateId) {
+		if certURI, err = parsePKCS11URI(certificateId); err != nil {
+			return nil, err
+		}
+	}
+	if isPKCS11URI(privateKeyId) {
+		if keyURI, err = parsePKCS11URI(privateKeyId); err != nil {
+			return nil, err
+		}
+	} else if privateKeyId != "" {
+		return nil, errors.New("the private key must reside on the PKCS#11 token when a PKCS#11 certificate is used")
+	} else {
+		keyURI = certURI
+	}
+
+	if libPkcs11 == "" {
+		libPkcs11 = keyURI.queryAttributes["module-path"]
+	}
+	module, err := loadPKCS11Module(libPkcs11)
+	if err != nil {
+		return nil, err
+	}
+	pkcs11Signer := &PKCS11Signer{
+		module:       module,
+		idleSessions: make(chan pkcs11.SessionHandle, maxIdlePKCS11Sessions),
+		keyURI:       keyURI,
+		pinFile:      pinFile,
+	}
+	defer func() {
+		if err != nil {
+			pkcs11Signer.Close()
+		}
+	}()
+
+	slot, err := findPKCS11Slot(module, keyURI)
+	if err != nil {
+		return nil, err
+	}
+	pkcs11Signer.slot = slot
+	session, err := module.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return nil, err
+	}
+	// The login state is shared by all sessions with the token, so the
+	// pooled sessions that are opened later on don't log in again
+	defer pkcs11Signer.releaseSession(session)
+	if err = loginPKCS11(module, session, keyURI, pinFile); err != nil {
+		return nil, err
+	}
+
+	// Find the certificate, either on the token or on disk
+	var certId []byte
+	if certURI != nil {
+		certSlot, err := findPKCS11Slot(module, certURI)
+		if err != nil {
+			return nil, err
+		}
+		if certSlot != slot {
+			return nil, errors.New("the certificate and private key must reside on the same PKCS#11 token")
+		}
+		certHandle, err := findPKCS11Object(module, session, certURI.objectTemplate(pkcs11.CKO_CERTIFICATE))
+		if err != nil {
+			return nil, err
+		}
+		values, err := getPKCS11Attributes(module, session, certHandle, pkcs11.CKA_VALUE, pkcs11.CKA_ID)
+		if err != nil {
+			return nil, err
+		}
+		pkcs11Signer.cert, err = x509.ParseCertificate(values[0])
+		if err != nil {
+			return nil, errors.New("could not parse certificate")
+		}
+		certId = values[1]
+	} else {
+		pkcs11Signer.cert, err = readCertificate(certificateId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Find the private key
+	keyTemplate := keyURI.objectTemplate(pkcs11.CKO_PRIVATE_KEY)
+	if keyURI == certURI && certId != nil {
+		keyTemplate = []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+			pkcs11.NewAttribute(pkcs11.CKA_ID, certId),
+		}
+	}
+	pkcs11Signer.keyTemplate = keyTemplate
+	pkcs11Signer.privateKeyHandle, err = findPKCS11Object(module, session, keyTemplate)
+	if err != nil {
+		return nil, err
+	}
+	values, err := getPKCS11Attributes(module, session, pkcs11Signer.privateKeyHandle, pkcs11.CKA_KEY_TYPE)
+	if err != nil {
+		return nil, err
+	}
+	pkcs11Signer.keyType = decodePKCS11Ulong(values[0])
+	if pkcs11Signer.keyType != pkcs11.CKK_RSA && pkcs11Signer.keyType != pkcs11.CKK_EC {
+		return nil, errors.New("unsupported PKCS#11 key type")
+	}
+
+	if certificateBundleId != "" {
+		pkcs11Signer.certificateChain, err = ReadCertificateBundleData(certificateBundleId)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pkcs11Signer, nil
+}
+
+func (pkcs11Signer *PKCS11Signer) Public() crypto.PublicKey {
+	if pkcs11Signer.cert == nil {
+		return nil
+	}
+	return pkcs11Signer.cert.PublicKey
+}
+
+// Signs the digest with the key on the token. ECDSA signatures are
+// converted from the raw PKCS#11 format into ASN.1.
+func (pkcs11Signer *PKCS11Signer) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	var mechanism *pkcs11.Mechanism
+	data := digest
+	switch pkcs11Signer.keyType {
+	case pkcs11.CKK_RSA:
+		prefix, ok := pkcs1DigestInfoPrefixes[opts.HashFunc()]
+		if !ok {
+			return nil, errors.New("unsupported digest")
+		}
+		if _, ok := opts.(*rsa.PSSOptions); ok {
+			params, ok := pkcs11PSSParams[opts.HashFunc()]
+			if !ok {
+				return nil, errors.New("unsupported digest")
+			}
+			mechanism = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_PSS, pkcs11.NewPSSParams(params[0], params[1], uint(opts.HashFunc().Size())))
+		} else {
+			mechanism = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)
+			data = append(append([]byte{}, prefix...), digest...)
+		}
+	case pkcs11.CKK_EC:
+		mechanism = pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)
+	default:
+		return nil, errors.New("unsupported algorithm")
+	}
+
+	sig, generation, err := pkcs11Signer.signWithPooledSession(mechanism, data)
+	if isPKCS11TokenRemovedError(err) {
+		log.Println("PKCS#11 token is unavailable, reconnecting:", err)
+		if err = pkcs11Signer.reconnect(generation); err != nil {
+			return nil, err
+		}
+		sig, _, err = pkcs11Signer.signWithPooledSession(mechanism, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if pkcs11Signer.keyType == pkcs11.CKK_EC {
+		return encodeECDSASignature(sig)
+	}
+	return sig, nil
+}
+
+func (pkcs11Signer *PKCS11Signer) supportsPSS() bool {
+	return true
+}
+
+// Signs the data with a session from the pool. The generation of the
+// signer at the time is returned as well, so that a failure can be
+// attributed to a particular connection with the token.
+func (pkcs11Signer *PKCS11Signer) signWithPooledSession(mechanism *pkcs11.Mechanism, data []byte) ([]byte, uint, error) {
+	pkcs11Signer.mutex.RLock()
+	defer pkcs11Signer.mutex.RUnlock()
+	generation := pkcs11Signer.generation
+
+	session, err := pkcs11Signer.acquireSession()
+	if err != nil {
+		return nil, generation, err
+	}
+	sig, err := pkcs11Signer.signWithSession(session, mechanism, data)
+	if err == pkcs11.Error(pkcs11.CKR_SESSION_HANDLE_INVALID) || err == pkcs11.Error(pkcs11.CKR_SESSION_CLOSED) {
+		// The pooled session is no longer usable; try once more with a new one
+		if session, err = pkcs11Signer.acquireSession(); err != nil {
+			return nil, generation, err
+		}
+		sig, err = pkcs11Signer.signWithSession(session, mechanism, data)
+	}
+	if err != nil {
+		pkcs11Signer.module.CloseSession(session)
+		return nil, generation, err
+	}
+	pkcs11Signer.releaseSession(session)
+	return sig, generation, nil
+}
+
+// Reconnects to the token after it has been removed (or reset): the
+// pooled sessions are discarded, and the token is looked up, logged into
+// (obtaining the PIN again), and searched for the private key anew. Nothing
+// is done if another signing operation has already reconnected since
+// `failedGeneration`.
+func (pkcs11Signer *PKCS11Signer) reconnect(failedGeneration uint) error {
+	pkcs11Signer.mutex.Lock()
+	defer pkcs11Signer.mutex.Unlock()
+	if pkcs11Signer.generation != failedGeneration {
+		return nil
+	}
+
+	module := pkcs11Signer.module
+	for idle := true; idle; {
+		select {
+		case session := <-pkcs11Signer.idleSessions:
+			module.CloseSession(session)
+		default:
+			idle = false
+		}
+	}
+	module.CloseAllSessions(pkcs11Signer.slot)
+
+	slot, err := findPKCS11Slot(module, pkcs11Signer.keyURI)
+	if err != nil {
+		return fmt.Errorf("the PKCS#11 token is unavailable (was it removed?): %w", err)
+	}
+	session, err := module.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return err
+	}
+	if err = loginPKCS11(module, session, pkcs11Signer.keyURI, pkcs11Signer.pinFile); err != nil {
+		module.CloseSession(session)
+		return err
+	}
+	privateKeyHandle, err := findPKCS11Object(module, session, pkcs11Signer.keyTemplate)
+	if err != nil {
+		module.CloseSession(session)
+		return err
+	}
+
+	pkcs11Signer.slot = slot
+	pkcs11Signer.privateKeyHandle = privateKeyHandle
+	pkcs11Signer.generation++
+	pkcs11Signer.releaseSession(session)
+	return nil
+}
+
+// Whether the error indicates that the token has been removed or reset
+func isPKCS11TokenRemovedError(err error) bool {
+	for _, tokenRemovedError := range pkcs11TokenRemovedErrors {
+		if err == tokenRemovedError {
+			return true
+		}
+	}
+	return false
+}
+
+func (pkcs11Signer *PKCS11Signer) signWithSession(session pkcs11.SessionHandle, mechanism *pkcs11.Mechanism, data []byte) ([]byte, error) {
+	module := pkcs11Signer.module
+	err := module.SignInit(session, []*pkcs11.Mechanism{mechanism}, pkcs11Signer.privateKeyHandle)
+	if err != nil {
+		return nil, err
+	}
+	return module.Sign(session, data)
+}
+
+// Obtains an idle session from the pool, or opens a new one if there are
+// none available
+func (pkcs11Signer *PKCS11Signer) acquireSession() (pkcs11.SessionHandle, error) {
+	select {
+	case session := <-pkcs11Signer.idleSessions:
+		return session, nil
+	default:
+		return pkcs11Signer.module.OpenSession(pkcs11Signer.slot, pkcs11.CKF_SERIAL_SESSION)
+	}
+}
+
+// Returns a session to the pool, closing it if the pool is already full
+func (pkcs11Signer *PKCS11Signer) releaseSession(session pkcs11.SessionHandle) {
+	select {
+	case pkcs11Signer.idleSessions <- session:
+	default:
+		pkcs11Signer.module.CloseSession(session)
+	}
+}
+
+func (pkcs11Signer *PKCS11Signer) Certificate() (*x509.Certificate, error) {
+	return pkcs11Signer.cert, nil
+}
+
+func (pkcs11Signer *PKCS11Signer) CertificateChain() ([]*x509.Certificate, error) {
+	return pkcs11Signer.certificateChain, nil
+}
+
+func (pkcs11Signer *PKCS11Signer) Close() {
+	pkcs11Signer.mutex.Lock()
+	defer pkcs11Signer.mutex.Unlock()
+	if pkcs11Signer.module == nil {
+		return
+	}
+	pkcs11Signer.module.CloseAllSessions(pkcs11Signer.slot)
+	closePKCS11Module(pkcs11Signer.module)
+	pkcs11Signer.module = nil
+}
+
+// Converts a raw (r || s) ECDSA signature into its ASN.1 DER encoding
+func encodeECDSASignature(sig []byte) ([]byte, error) {
+	if len(sig) == 0 || len(sig)%2 != 0 {
+		return nil, errors.New("invalid ECDSA signature")
+	}
+	half := len(sig) / 2
+	return asn1.Marshal(struct {
+		R, S *big.Int
+	}{new(big.Int).SetBytes(sig[:half]), new(big.Int).SetBytes(sig[half:])})
+}
+
+// Decodes a CK_ULONG attribute value. Values are returned in the native
+// byte order of the platform, which is little-endian on all supported ones.
+func decodePKCS11Ulong(value []byte) uint {
+	switch len(value) {
+	case 4:
+		return uint(binary.LittleEndian.Uint32(value))
+	case 8:
+		return uint(binary.LittleEndian.Uint64(value))
+	}
+	return ^uint(0)
+}
+
+// Enumerates the tokens available through the PKCS#11 module and the
+// certificate and key objects on each of them. If a URI is provided, only
+// matching tokens are listed. Tokens that require it are logged into, so
+// that private objects are visible.
+func ListPKCS11Objects(libPkcs11 string, filter string, pinFile string) ([]PKCS11Slot, error) {
+	uri := &pkcs11URI{make(map[string]string), make(map[string]string)}
+	if filter != "" {
+		var err error
+		if uri, err = parsePKCS11URI(filter); err != nil {
+			return nil, err
+		}
+	}
+	if libPkcs11 == "" {
+		libPkcs11 = uri.queryAttributes["module-path"]
+	}
+	module, err := loadPKCS11Module(libPkcs11)
+	if err != nil {
+		return nil, err
+	}
+	defer closePKCS11Module(module)
+
+	slots, err := module.GetSlotList(true)
+	if err != nil {
+		return nil, err
+	}
+	var result []PKCS11Slot
+	for _, slot := range slots {
+		tokenInfo, err := module.GetTokenInfo(slot)
+		if err != nil {
+			log.Printf("unable to get token info for slot %d: %s", slot, err)
+			continue
+		}
+		if !uri.matchesToken(slot, tokenInfo) {
+			continue
+		}
+		slotInfo := PKCS11Slot{
+			SlotId:       slot,
+			TokenLabel:   tokenInfo.Label,
+			Manufacturer: tokenInfo.ManufacturerID,
+			Model:        tokenInfo.Model,
+			SerialNumber: tokenInfo.SerialNumber,
+		}
+		slotInfo.Objects, err = listPKCS11SlotObjects(module, slot, tokenInfo, uri, pinFile)
+		if err != nil {
+			log.Printf("unable to list objects in slot %d: %s", slot, err)
+		}
+		result = append(result, slotInfo)
+	}
+	return result, nil
+}
+
+func listPKCS11SlotObjects(module *pkcs11.Ctx, slot uint, tokenInfo pkcs11.TokenInfo, uri *pkcs11URI, pinFile string) ([]PKCS11Object, error) {
+	session, err := module.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return nil, err
+	}
+	defer module.CloseSession(session)
+	if err = loginPKCS11(module, session, uri, pinFile); err != nil {
+		return nil, err
+	}
+
+	var objects []PKCS11Object
+	for _, objectType := range []string{"cert", "private", "public"} {
+		handles, err := findPKCS11Objects(module, session, uri.objectTemplate(pkcs11ObjectClasses[objectType]))
+		if err != nil {
+			return nil, err
+		}
+		for _, handle := range handles {
+			values, err := getPKCS11Attributes(module, session, handle, pkcs11.CKA_LABEL, pkcs11.CKA_ID)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			objectURI := &pkcs11URI{pathAttributes: map[string]string{
+				"token":        tokenInfo.Label,
+				"manufacturer": tokenInfo.ManufacturerID,
+				"serial":       tokenInfo.SerialNumber,
+				"object":       string(values[0]),
+				"id":           string(values[1]),
+				"type":         objectType,
+			}}
+			object := PKCS11Object{Type: objectType, Label: string(values[0]), Uri: objectURI.String()}
+			if objectType == "cert" {
+				if certValues, err := getPKCS11Attributes(module, session, handle, pkcs11.CKA_VALUE); err == nil {
+					if cert, err := x509.ParseCertificate(certValues[0]); err == nil {
+						object.Subject = cert.Subject.String()
+					}
+				}
+			}
+			objects = append(objects, object)
+		}
+	}
+	return objects, nil
+}
@@ -0,0 +1,79 @@
+package aws_signing_helper
+
+import (
+	"testing"
+)
+
+func TestParsePKCS11URI(t *testing.T) {
+	uri, err := parsePKCS11URI("pkcs11:token=My%20Token;object=client;id=%01%02;type=private?pin-value=1234&module-path=/usr/lib/softhsm/libsofthsm2.so")
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+		return
+	}
+
+	expectedPathAttributes := map[string]string{
+		"token":  "My Token",
+		"object": "client",
+		"id":     "\x01\x02",
+		"type":   "private",
+	}
+	for name, value := range expectedPathAttributes {
+		if uri.pathAttributes[name] != value {
+			t.Logf("Wrong value for %s. Expected %q, got %q", name, value, uri.pathAttributes[name])
+			t.Fail()
+		}
+	}
+	if uri.queryAttributes["pin-value"] != "1234" {
+		t.Log("Failed to parse pin-value query attribute")
+		t.Fail()
+	}
+	if uri.queryAttributes["module-path"] != "/usr/lib/softhsm/libsofthsm2.so" {
+		t.Log("Failed to parse module-path query attribute")
+		t.Fail()
+	}
+
+	// The PIN shouldn't be part of the string representation
+	expectedString := "pkcs11:token=My%20Token;object=client;id=%01%02;type=private"
+	if uri.String() != expectedString {
+		t.Logf("Wrong string representation. Expected %s, got %s", expectedString, uri.String())
+		t.Fail()
+	}
+}
+
+func TestParseInvalidPKCS11URI(t *testing.T) {
+	fixtures := []string{
+		"/path/to/cert.pem",
+		"pkcs11:token",
+		"pkcs11:token=a;token=b",
+		"pkcs11:type=secret-key",
+		"pkcs11:slot-id=abc",
+		"pkcs11:object=%zz",
+	}
+	for _, fixture := range fixtures {
+		_, err := parsePKCS11URI(fixture)
+		if err == nil {
+			t.Logf("Expected %s to be rejected", fixture)
+			t.Fail()
+		}
+	}
+}
+
+func TestEncodeECDSASignature(t *testing.T) {
+	_, err := encodeECDSASignature([]byte{1, 2, 3})
+	if err == nil {
+		t.Log("Expected odd-length signature to be rejected")
+		t.Fail()
+	}
+
+	sig, err := encodeECDSASignature([]byte{0, 1, 0, 2})
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+	expected := []byte{0x30, 0x06, 0x02, 0x01, 0x01, 0x02, 0x01, 0x02}
+	if string(sig) != string(expected) {
+		t.Logf("Unexpected encoding: %x", sig)
+		t.Fail()
+	}
+}
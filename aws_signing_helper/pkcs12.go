@@ -0,0 +1,64 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// Reads the private key, certificate, and any other certificates (which
+// make up the chain) from the PKCS#12 bundle at the provided path
+func readPKCS12Bundle(pkcs12Id string, passphrase string) (crypto.PrivateKey, *x509.Certificate, []*x509.Certificate, error) {
+	pfxData, err := readCredentialFile(pkcs12Id)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	privateKey, cert, caCerts, err := pkcs12.DecodeChain(pfxData, passphrase)
+	if err != nil {
+		if errors.Is(err, pkcs12.ErrIncorrectPassword) {
+			return nil, nil, nil, err
+		}
+		return nil, nil, nil, fmt.Errorf("could not parse PKCS#12 bundle: %w", err)
+	}
+	switch key := privateKey.(type) {
+	case *ecdsa.PrivateKey:
+		return *key, cert, caCerts, nil
+	case *rsa.PrivateKey:
+		return *key, cert, caCerts, nil
+	}
+	return nil, nil, nil, errors.New("unsupported private key type in PKCS#12 bundle")
+}
+
+// Creates a signer from the PKCS#12 (.p12 or .pfx) bundle at the provided
+// path. Any certificates in the bundle other than the end-entity
+// certificate make up the certificate chain, unless a certificate bundle
+// is provided. Bundles without a passphrase are read without asking for
+// one; otherwise, the passphrase is obtained through GetPassphrase.
+func GetPKCS12Signer(pkcs12Id string, passphraseFile string, certificateBundleId string) (Signer, error) {
+	fileSystemSigner := &FileSystemSigner{pkcs12Id: pkcs12Id, certificateBundleId: certificateBundleId}
+	var err error
+	if passphraseFile == "" {
+		err = fileSystemSigner.load()
+		if err == nil {
+			return fileSystemSigner, nil
+		}
+		if !errors.Is(err, pkcs12.ErrIncorrectPassword) {
+			return nil, err
+		}
+	}
+
+	passphrase, err := GetPassphrase(passphraseFile, "Please enter the passphrase for the PKCS#12 bundle:")
+	if err != nil {
+		return nil, err
+	}
+	fileSystemSigner.pkcs12Passphrase = passphrase
+	if err = fileSystemSigner.load(); err != nil {
+		return nil, err
+	}
+	return fileSystemSigner, nil
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package aws_signing_helper
+
+import (
+	"errors"
+)
+
+func GetPlatformCryptoSigner(keyContainer string, machineKey bool, certificateId string, certificateBundleId string) (Signer, error) {
+	return nil, errors.New("keys held by the Microsoft Platform Crypto Provider are only supported on Windows")
+}
@@ -0,0 +1,74 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"io"
+	"sync"
+)
+
+// Signer that uses a TPM-bound key held by the Microsoft Platform Crypto
+// Provider
+type PlatformCryptoSigner struct {
+	mutex            sync.Mutex
+	key              uintptr
+	cert             *x509.Certificate
+	certificateChain []*x509.Certificate
+}
+
+// Creates a signer that uses the key in the given container of the
+// Microsoft Platform Crypto Provider, along with the certificate (and,
+// optionally, certificate bundle) at the provided paths
+func GetPlatformCryptoSigner(keyContainer string, machineKey bool, certificateId string, certificateBundleId string) (Signer, error) {
+	cert, err := readCertificate(certificateId)
+	if err != nil {
+		return nil, err
+	}
+	var certificateChain []*x509.Certificate
+	if certificateBundleId != "" {
+		if certificateChain, err = ReadCertificateBundleData(certificateBundleId); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := ncryptOpenKey(msPlatformCryptoProvider, keyContainer, machineKey)
+	if err != nil {
+		return nil, err
+	}
+	return &PlatformCryptoSigner{key: key, cert: cert, certificateChain: certificateChain}, nil
+}
+
+func (platformCryptoSigner *PlatformCryptoSigner) Public() crypto.PublicKey {
+	return platformCryptoSigner.cert.PublicKey
+}
+
+func (platformCryptoSigner *PlatformCryptoSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	platformCryptoSigner.mutex.Lock()
+	defer platformCryptoSigner.mutex.Unlock()
+	if platformCryptoSigner.key == 0 {
+		return nil, errors.New("signer has been closed")
+	}
+	return ncryptSignHash(platformCryptoSigner.key, platformCryptoSigner.cert.PublicKey, digest, opts)
+}
+
+func (platformCryptoSigner *PlatformCryptoSigner) supportsPSS() bool {
+	return true
+}
+
+func (platformCryptoSigner *PlatformCryptoSigner) Certificate() (*x509.Certificate, error) {
+	return platformCryptoSigner.cert, nil
+}
+
+func (platformCryptoSigner *PlatformCryptoSigner) CertificateChain() ([]*x509.Certificate, error) {
+	return platformCryptoSigner.certificateChain, nil
+}
+
+func (platformCryptoSigner *PlatformCryptoSigner) Close() {
+	platformCryptoSigner.mutex.Lock()
+	defer platformCryptoSigner.mutex.Unlock()
+	if platformCryptoSigner.key != 0 {
+		ncryptFreeKey(platformCryptoSigner.key)
+		platformCryptoSigner.key = 0
+	}
+}
@@ -0,0 +1,199 @@
+package aws_signing_helper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+)
+
+// Address on which the EKS Pod Identity Agent listens, and to which the
+// AWS_CONTAINER_CREDENTIALS_FULL_URI of pods that use Pod Identity points
+const DefaultPodIdentityAddress = "169.254.170.23:80"
+
+const POD_IDENTITY_CREDENTIALS_RESOURCE_PATH = "/v1/credentials"
+
+// Audience of the projected service account tokens that pods using Pod
+// Identity present
+const PodIdentityAudience = "pods.eks.amazonaws.com"
+
+const serviceAccountSubjectPrefix = "system:serviceaccount:"
+
+// Credentials served from the local endpoint, in the format of the EKS Pod
+// Identity Agent
+type PodIdentityCredentials struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	Token           string
+	AccountId       string
+	Expiration      time.Time
+}
+
+// Options with which the projected service account tokens that requests
+// carry are verified
+type PodIdentityOpts struct {
+	// Path to the JSON Web Key Set of the cluster's service account issuer
+	JWKSFile string
+	// Issuer that the tokens have to be issued by (any, if empty)
+	Issuer string
+	// Service accounts (as "namespace/name") that are served credentials
+	// (all, if empty)
+	ServiceAccounts []string
+}
+
+// Verifies a projected service account token, as the Pod Identity Agent
+// receives it in the Authorization header (the SDK reads it from the file in
+// AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE on every request): that it's signed
+// by one of the cluster's keys, is meant for Pod Identity, is currently
+// valid, and identifies one of the allowed service accounts. Returns the
+// service account, as "namespace/name".
+func verifyServiceAccountToken(token string, keys *jose.JSONWebKeySet, podIdentityOpts *PodIdentityOpts, now time.Time) (string, error) {
+	parsed, err := jwt.ParseSigned(token)
+	if err != nil {
+		return "", errors.New("the token isn't a signed JWT")
+	}
+	var claims jwt.Claims
+	if err = parsed.Claims(keys, &claims); err != nil {
+		return "", errors.New("the token isn't signed by any of the service account issuer's keys")
+	}
+	if claims.Expiry == nil {
+		return "", errors.New("the token doesn't expire")
+	}
+	err = claims.Validate(jwt.Expected{
+		Issuer:   podIdentityOpts.Issuer,
+		Audience: jwt.Audience{PodIdentityAudience},
+		Time:     now,
+	})
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(claims.Subject, serviceAccountSubjectPrefix) {
+		return "", errors.New("the token doesn't identify a service account")
+	}
+	serviceAccount := strings.Replace(strings.TrimPrefix(claims.Subject, serviceAccountSubjectPrefix), ":", "/", 1)
+	if len(podIdentityOpts.ServiceAccounts) == 0 {
+		return serviceAccount, nil
+	}
+	for _, allowed := range podIdentityOpts.ServiceAccounts {
+		if allowed == serviceAccount {
+			return serviceAccount, nil
+		}
+	}
+	return "", fmt.Errorf("service account %s isn't allowed", serviceAccount)
+}
+
+// Reads the JSON Web Key Set of the cluster's service account issuer (as
+// served by the API server at /openid/v1/jwks)
+func readJWKS(path string) (*jose.JSONWebKeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys jose.JSONWebKeySet
+	if err = json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("invalid JSON Web Key Set: %w", err)
+	}
+	if len(keys.Keys) == 0 {
+		return nil, errors.New("the JSON Web Key Set contains no keys")
+	}
+	return &keys, nil
+}
+
+// Handles GET requests to the Pod Identity credentials endpoint, which have
+// to carry a projected service account token in their Authorization header
+func PodIdentityHandler(cred *RefreshableCred, podIdentityOpts *PodIdentityOpts, opts *CredentialsOpts, signer Signer) http.HandlerFunc {
+	var accountId string
+	if roleArn, err := arn.Parse(opts.RoleArn); err == nil {
+		accountId = roleArn.AccountID
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		token := r.Header.Get("Authorization")
+		if token == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, "no service account token provided")
+			return
+		}
+		// The key set is read for every request, so that keys that the
+		// cluster rotates in are picked up
+		keys, err := readJWKS(podIdentityOpts.JWKSFile)
+		if err != nil {
+			log.Println("unable to read the service account issuer's keys:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, "unable to verify service account token")
+			return
+		}
+		serviceAccount, err := verifyServiceAccountToken(token, keys, podIdentityOpts, time.Now())
+		if err != nil {
+			log.Println("rejected service account token:", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, "invalid service account token provided")
+			return
+		}
+
+		current, err := currentCredentials(cred, opts, signer)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, "unable to obtain credentials")
+			return
+		}
+		log.Println("serving credentials to service account", serviceAccount)
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(PodIdentityCredentials{
+			AccessKeyId:     current.AccessKeyId,
+			SecretAccessKey: current.SecretAccessKey,
+			Token:           current.Token,
+			AccountId:       accountId,
+			Expiration:      current.Expiration,
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, "failed to encode credentials")
+			return
+		}
+	}
+}
+
+// Vends temporary credentials to pods, in place of the EKS Pod Identity
+// Agent, so that pods on self-managed Kubernetes nodes can obtain them in
+// the same way as they do on EKS
+func ServePodIdentity(listenAddr string, podIdentityOpts PodIdentityOpts, credentialsOptions CredentialsOpts) {
+	if _, err := readJWKS(podIdentityOpts.JWKSFile); err != nil {
+		log.Println("unable to read the service account issuer's keys:", err)
+		syscall.Exit(1)
+	}
+
+	signer, refreshableCred := startRefreshingCredentials(&credentialsOptions)
+	defer signer.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(POD_IDENTITY_CREDENTIALS_RESOURCE_PATH, PodIdentityHandler(refreshableCred, &podIdentityOpts, &credentialsOptions, signer))
+	registerMonitoringHandlers(mux, signer, []*RefreshableCred{refreshableCred})
+
+	listener, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		log.Println("failed to create listener:", err)
+		syscall.Exit(1)
+	}
+	log.Println("Pod Identity endpoint started on:", listener.Addr())
+	notifySystemdReady()
+	if err := serveUntilTerminated(&http.Server{Handler: mux}, listener); err != nil {
+		log.Println("Httpserver: Serve() error")
+		syscall.Exit(1)
+	}
+}
@@ -0,0 +1,133 @@
+package aws_signing_helper
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+)
+
+func createTestServiceAccountToken(t *testing.T, key *ecdsa.PrivateKey, keyId string, claims jwt.Claims) string {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jose.JSONWebKey{Key: key, KeyID: keyId}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestVerifyServiceAccountToken(t *testing.T) {
+	issuerKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	keys := &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: issuerKey.Public(), KeyID: "issuer", Algorithm: string(jose.ES256), Use: "sig"}}}
+	now := time.Now()
+	validClaims := jwt.Claims{
+		Issuer:   "https://oidc.example.com",
+		Subject:  "system:serviceaccount:default:app",
+		Audience: jwt.Audience{PodIdentityAudience},
+		Expiry:   jwt.NewNumericDate(now.Add(time.Hour)),
+		IssuedAt: jwt.NewNumericDate(now),
+	}
+	withClaims := func(modify func(*jwt.Claims)) jwt.Claims {
+		claims := validClaims
+		modify(&claims)
+		return claims
+	}
+	podIdentityOpts := &PodIdentityOpts{Issuer: "https://oidc.example.com", ServiceAccounts: []string{"default/app"}}
+
+	fixtures := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"valid", createTestServiceAccountToken(t, issuerKey, "issuer", validClaims), true},
+		{"other-key", createTestServiceAccountToken(t, otherKey, "issuer", validClaims), false},
+		{"other-audience", createTestServiceAccountToken(t, issuerKey, "issuer", withClaims(func(c *jwt.Claims) { c.Audience = jwt.Audience{"sts.amazonaws.com"} })), false},
+		{"other-issuer", createTestServiceAccountToken(t, issuerKey, "issuer", withClaims(func(c *jwt.Claims) { c.Issuer = "https://other.example.com" })), false},
+		{"expired", createTestServiceAccountToken(t, issuerKey, "issuer", withClaims(func(c *jwt.Claims) { c.Expiry = jwt.NewNumericDate(now.Add(-time.Hour)) })), false},
+		{"no-expiry", createTestServiceAccountToken(t, issuerKey, "issuer", withClaims(func(c *jwt.Claims) { c.Expiry = nil })), false},
+		{"other-service-account", createTestServiceAccountToken(t, issuerKey, "issuer", withClaims(func(c *jwt.Claims) { c.Subject = "system:serviceaccount:default:other" })), false},
+		{"not-a-service-account", createTestServiceAccountToken(t, issuerKey, "issuer", withClaims(func(c *jwt.Claims) { c.Subject = "user" })), false},
+		{"not-a-jwt", "token", false},
+	}
+	for _, fixture := range fixtures {
+		serviceAccount, err := verifyServiceAccountToken(fixture.token, keys, podIdentityOpts, now)
+		if fixture.valid && (err != nil || serviceAccount != "default/app") {
+			t.Logf("%s: expected the token to be valid, got %v", fixture.name, err)
+			t.Fail()
+		}
+		if !fixture.valid && err == nil {
+			t.Logf("%s: expected the token to be rejected", fixture.name)
+			t.Fail()
+		}
+	}
+}
+
+func TestPodIdentityHandler(t *testing.T) {
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	signer, err := GetSigner(&credentialsOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+
+	issuerKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	keys := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: issuerKey.Public(), KeyID: "issuer", Algorithm: string(jose.ES256), Use: "sig"}}}
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	data, _ := json.Marshal(keys)
+	if err = os.WriteFile(jwksFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	token := createTestServiceAccountToken(t, issuerKey, "issuer", jwt.Claims{
+		Subject:  "system:serviceaccount:default:app",
+		Audience: jwt.Audience{PodIdentityAudience},
+		Expiry:   jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+	handler := PodIdentityHandler(&RefreshableCred{}, &PodIdentityOpts{JWKSFile: jwksFile}, &credentialsOpts, signer)
+
+	request := httptest.NewRequest("GET", POD_IDENTITY_CREDENTIALS_RESOURCE_PATH, nil)
+	recorder := httptest.NewRecorder()
+	handler(recorder, request)
+	if recorder.Code != http.StatusBadRequest {
+		t.Logf("expected a request without a token to be rejected, got status %d", recorder.Code)
+		t.Fail()
+	}
+
+	request = httptest.NewRequest("GET", POD_IDENTITY_CREDENTIALS_RESOURCE_PATH, nil)
+	request.Header.Set("Authorization", token)
+	recorder = httptest.NewRecorder()
+	handler(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", recorder.Code)
+	}
+	var served PodIdentityCredentials
+	if err = json.NewDecoder(recorder.Body).Decode(&served); err != nil {
+		t.Fatal(err)
+	}
+	if served.AccessKeyId != "accessKeyId" || served.Token != "sessionToken" || served.AccountId != "000000000000" {
+		t.Log("unexpected credentials served:", served)
+		t.Fail()
+	}
+}
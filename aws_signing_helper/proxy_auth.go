@@ -0,0 +1,354 @@
+package aws_signing_helper
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4"
+)
+
+// How the helper authenticates to the proxy, if it has credentials for it:
+// with Basic authentication (which the proxy URL's credentials also select),
+// or with NTLM, which proxies in Windows domains often require
+const (
+	ProxyAuthBasic = "basic"
+	ProxyAuthNTLM  = "ntlm"
+)
+
+// Environment variable from which the password of the proxy user is read,
+// if there's no password file
+const ProxyPasswordEnvVarName = "AWS_ROLESANYWHERE_PROXY_PASSWORD"
+
+// Checks the scheme of authentication to the proxy in the options
+func checkProxyAuth(opts *CredentialsOpts) error {
+	switch opts.ProxyAuth {
+	case "", ProxyAuthBasic, ProxyAuthNTLM:
+		return nil
+	}
+	return fmt.Errorf("unknown proxy authentication %s (expected %s or %s)", opts.ProxyAuth, ProxyAuthBasic, ProxyAuthNTLM)
+}
+
+// Returns the credentials of the proxy user in the options, whose password is
+// read from the password file, or else from the ProxyPasswordEnvVarName
+// environment variable, so that it isn't exposed on the command line. It's
+// read again for each connection, so that it can be rotated.
+func proxyUserinfo(opts *CredentialsOpts) (*url.Userinfo, error) {
+	if opts.ProxyPasswordFile != "" {
+		password, err := readSecretFile(opts.ProxyPasswordFile, "proxy password")
+		if err != nil {
+			return nil, err
+		}
+		return url.UserPassword(opts.ProxyUser, password), nil
+	}
+	if password, ok := os.LookupEnv(ProxyPasswordEnvVarName); ok {
+		return url.UserPassword(opts.ProxyUser, password), nil
+	}
+	return nil, fmt.Errorf("no password for the proxy user %s (pass --proxy-password-file, or set %s)", opts.ProxyUser, ProxyPasswordEnvVarName)
+}
+
+// Dials the endpoint through a tunnel that's opened with a CONNECT request to
+// the proxy that the proxy function selects, authenticating with NTLM, which
+// takes several requests on the same connection, and which Go's transport
+// can't do itself. The credentials are those in the proxy's URL. Requests
+// to HTTP endpoints go through the tunnel too.
+type ntlmProxyDialer struct {
+	proxy func(*http.Request) (*url.URL, error)
+	dial  func(ctx context.Context, network string, addr string) (net.Conn, error)
+}
+
+func (d ntlmProxyDialer) DialContext(ctx context.Context, network string, addr string) (net.Conn, error) {
+	proxyURL, err := d.proxy(&http.Request{URL: &url.URL{Scheme: "https", Host: addr}})
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL == nil {
+		return d.dial(ctx, network, addr)
+	}
+	if proxyURL.Scheme != "http" {
+		return nil, fmt.Errorf("NTLM authentication is only supported with http:// proxies, not %s", proxyURL.Scheme)
+	}
+	if proxyURL.User == nil || proxyURL.User.Username() == "" {
+		return nil, errors.New("NTLM authentication to the proxy requires a user (pass --proxy-user)")
+	}
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), "80")
+	}
+	conn, err := d.dial(ctx, network, proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	tunnel, err := connectWithNTLM(conn, addr, proxyURL.User)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tunnel, nil
+}
+
+// Opens a tunnel to the given address through the proxy on the connection,
+// authenticating with NTLM: the negotiate message is sent with the first
+// CONNECT request, and the authenticate message, which answers the proxy's
+// challenge, with the second
+func connectWithNTLM(conn net.Conn, addr string, user *url.Userinfo) (net.Conn, error) {
+	reader := bufio.NewReader(conn)
+	resp, err := sendConnect(conn, reader, addr, "NTLM "+base64.StdEncoding.EncodeToString(ntlmNegotiateMessage()))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return &bufferedConn{conn, reader}, nil
+	}
+	if resp.StatusCode != http.StatusProxyAuthRequired {
+		return nil, fmt.Errorf("the proxy refused to connect to %s: %s", addr, resp.Status)
+	}
+	if resp.Close {
+		return nil, errors.New("the proxy closed the connection during NTLM authentication")
+	}
+	challenge, err := ntlmChallengeFromResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	domain, username := splitNTLMUser(user.Username())
+	password, _ := user.Password()
+	authenticate, err := ntlmAuthenticateMessage(challenge, domain, username, password, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	resp, err = sendConnect(conn, reader, addr, "NTLM "+base64.StdEncoding.EncodeToString(authenticate))
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return &bufferedConn{conn, reader}, nil
+	case http.StatusProxyAuthRequired:
+		return nil, fmt.Errorf("the proxy rejected the NTLM credentials of %s", user.Username())
+	}
+	return nil, fmt.Errorf("the proxy refused to connect to %s: %s", addr, resp.Status)
+}
+
+// Sends a CONNECT request to the proxy, and reads its response. The body of
+// a response that refuses the tunnel is drained, so that the next request
+// can be sent on the same connection.
+func sendConnect(conn net.Conn, reader *bufio.Reader, addr string, authorization string) (*http.Response, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{
+			"Proxy-Authorization": {authorization},
+			"Proxy-Connection":    {"Keep-Alive"},
+		},
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	return resp, nil
+}
+
+// Connection whose first bytes were already buffered by a reader
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// Splits a user into its domain and its name (DOMAIN\user). A user without
+// a domain (including a user principal name, user@domain) is sent as is.
+func splitNTLMUser(user string) (string, string) {
+	if i := strings.Index(user, `\`); i >= 0 {
+		return user[:i], user[i+1:]
+	}
+	return "", user
+}
+
+// NTLM negotiate flags (MS-NLMP 2.2.2.5)
+const (
+	ntlmNegotiateUnicode                 = 0x00000001
+	ntlmRequestTarget                    = 0x00000004
+	ntlmNegotiateNTLM                    = 0x00000200
+	ntlmNegotiateAlwaysSign              = 0x00008000
+	ntlmNegotiateExtendedSessionSecurity = 0x00080000
+	ntlmNegotiateTargetInfo              = 0x00800000
+	ntlmNegotiate128                     = 0x20000000
+	ntlmNegotiate56                      = 0x80000000
+
+	ntlmNegotiateFlags = ntlmNegotiateUnicode | ntlmRequestTarget | ntlmNegotiateNTLM | ntlmNegotiateAlwaysSign |
+		ntlmNegotiateExtendedSessionSecurity | ntlmNegotiateTargetInfo | ntlmNegotiate128 | ntlmNegotiate56
+)
+
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+// Identifiers of the AV pairs in the target info that are used
+const (
+	ntlmAvEOL       = 0
+	ntlmAvTimestamp = 7
+)
+
+// The parts of the proxy's challenge message that the response depends on
+type ntlmChallenge struct {
+	flags           uint32
+	serverChallenge []byte
+	targetInfo      []byte
+}
+
+func ntlmNegotiateMessage() []byte {
+	message := make([]byte, 32)
+	copy(message, ntlmSignature)
+	binary.LittleEndian.PutUint32(message[8:], 1)
+	binary.LittleEndian.PutUint32(message[12:], ntlmNegotiateFlags)
+	return message
+}
+
+// Returns the challenge in the NTLM Proxy-Authenticate header of the response
+func ntlmChallengeFromResponse(resp *http.Response) (ntlmChallenge, error) {
+	schemes := resp.Header.Values("Proxy-Authenticate")
+	for _, value := range schemes {
+		if data := strings.TrimPrefix(value, "NTLM "); data != value {
+			message, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+			if err != nil {
+				return ntlmChallenge{}, errors.New("the proxy's NTLM challenge isn't base64-encoded")
+			}
+			return parseNTLMChallenge(message)
+		}
+	}
+	return ntlmChallenge{}, fmt.Errorf("the proxy doesn't accept NTLM authentication (it asks for %s)", strings.Join(schemes, ", "))
+}
+
+func parseNTLMChallenge(message []byte) (ntlmChallenge, error) {
+	if len(message) < 32 || string(message[:8]) != string(ntlmSignature) || binary.LittleEndian.Uint32(message[8:]) != 2 {
+		return ntlmChallenge{}, errors.New("invalid NTLM challenge message")
+	}
+	challenge := ntlmChallenge{
+		flags:           binary.LittleEndian.Uint32(message[20:]),
+		serverChallenge: message[24:32],
+	}
+	if len(message) >= 48 {
+		length := int(binary.LittleEndian.Uint16(message[40:]))
+		offset := int(binary.LittleEndian.Uint32(message[44:]))
+		if offset+length > len(message) {
+			return ntlmChallenge{}, errors.New("invalid NTLM challenge message")
+		}
+		challenge.targetInfo = message[offset : offset+length]
+	}
+	return challenge, nil
+}
+
+// Returns the value of the AV pair with the given identifier in the target
+// info, if there's one
+func ntlmAvPair(targetInfo []byte, id uint16) ([]byte, bool) {
+	for len(targetInfo) >= 4 {
+		pairId := binary.LittleEndian.Uint16(targetInfo)
+		length := int(binary.LittleEndian.Uint16(targetInfo[2:]))
+		if pairId == ntlmAvEOL || 4+length > len(targetInfo) {
+			break
+		}
+		if pairId == id {
+			return targetInfo[4 : 4+length], true
+		}
+		targetInfo = targetInfo[4+length:]
+	}
+	return nil, false
+}
+
+// Returns the authenticate message that answers the challenge with an NTLMv2
+// response (MS-NLMP 3.3.2)
+func ntlmAuthenticateMessage(challenge ntlmChallenge, domain string, user string, password string, now time.Time) ([]byte, error) {
+	clientChallenge := make([]byte, 8)
+	if _, err := rand.Read(clientChallenge); err != nil {
+		return nil, err
+	}
+	// The proxy's timestamp is used if it sent one, since its clock may
+	// differ from the local one
+	timestamp, hasTimestamp := ntlmAvPair(challenge.targetInfo, ntlmAvTimestamp)
+	if !hasTimestamp || len(timestamp) != 8 {
+		timestamp = make([]byte, 8)
+		// Windows file time: 100-nanosecond intervals since 1601
+		binary.LittleEndian.PutUint64(timestamp, uint64(now.UnixNano()/100+116444736000000000))
+	}
+	ntResponse, lmResponse := ntlmv2Response(ntowfv2(domain, user, password), challenge.serverChallenge, clientChallenge, timestamp, challenge.targetInfo)
+	if hasTimestamp {
+		lmResponse = make([]byte, 24)
+	}
+
+	fields := [][]byte{lmResponse, ntResponse, utf16LE(domain), utf16LE(user), nil, nil}
+	const headerLength = 64
+	message := make([]byte, headerLength)
+	copy(message, ntlmSignature)
+	binary.LittleEndian.PutUint32(message[8:], 3)
+	for i, field := range fields {
+		binary.LittleEndian.PutUint16(message[12+8*i:], uint16(len(field)))
+		binary.LittleEndian.PutUint16(message[14+8*i:], uint16(len(field)))
+		binary.LittleEndian.PutUint32(message[16+8*i:], uint32(len(message)))
+		message = append(message, field...)
+	}
+	binary.LittleEndian.PutUint32(message[60:], challenge.flags&ntlmNegotiateFlags|ntlmNegotiateUnicode)
+	return message, nil
+}
+
+// Returns the NTLMv2 hash of the password: the HMAC-MD5, keyed by the MD4
+// digest of the password, of the upper-cased user and the domain
+func ntowfv2(domain string, user string, password string) []byte {
+	digest := md4.New()
+	digest.Write(utf16LE(password))
+	return hmacMD5(digest.Sum(nil), utf16LE(strings.ToUpper(user)+domain))
+}
+
+// Returns the NTLMv2 and LMv2 responses to the server's challenge
+func ntlmv2Response(hash []byte, serverChallenge []byte, clientChallenge []byte, timestamp []byte, targetInfo []byte) ([]byte, []byte) {
+	temp := []byte{1, 1, 0, 0, 0, 0, 0, 0}
+	temp = append(temp, timestamp...)
+	temp = append(temp, clientChallenge...)
+	temp = append(temp, 0, 0, 0, 0)
+	temp = append(temp, targetInfo...)
+	temp = append(temp, 0, 0, 0, 0)
+	ntProof := hmacMD5(hash, append(append([]byte{}, serverChallenge...), temp...))
+	lmProof := hmacMD5(hash, append(append([]byte{}, serverChallenge...), clientChallenge...))
+	return append(ntProof, temp...), append(lmProof, clientChallenge...)
+}
+
+func hmacMD5(key []byte, data []byte) []byte {
+	mac := hmac.New(md5.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func utf16LE(s string) []byte {
+	encoded := utf16.Encode([]rune(s))
+	data := make([]byte, 2*len(encoded))
+	for i, r := range encoded {
+		binary.LittleEndian.PutUint16(data[2*i:], r)
+	}
+	return data
+}
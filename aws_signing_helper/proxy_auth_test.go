@@ -0,0 +1,163 @@
+package aws_signing_helper
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNTOWFv2(t *testing.T) {
+	// From MS-NLMP 4.2.4.1.1
+	expected, _ := hex.DecodeString("0c868a403bfd7a93a3001ef22ef02e3f")
+	if hash := ntowfv2("Domain", "User", "Password"); !bytes.Equal(hash, expected) {
+		t.Log("unexpected NTLMv2 hash:", hex.EncodeToString(hash))
+		t.Fail()
+	}
+}
+
+func TestProxyUser(t *testing.T) {
+	var proxyAuthorization string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxyAuthorization = r.Header.Get("Proxy-Authorization")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(mockedCreateSessionResponse))
+	}))
+	defer proxy.Close()
+	passwordFile := filepath.Join(t.TempDir(), "proxy-password")
+	os.WriteFile(passwordFile, []byte("p@ssword\n"), 0600)
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          "http://rolesanywhere.example.com",
+		SessionDuration:   900,
+		ProxyURL:          proxy.URL,
+		ProxyUser:         "proxy-user",
+		ProxyPasswordFile: passwordFile,
+	}
+	expected := "Basic " + base64.StdEncoding.EncodeToString([]byte("proxy-user:p@ssword"))
+	if _, err := GenerateCredentials(&credentialsOpts); err != nil || proxyAuthorization != expected {
+		t.Log("the proxy credentials weren't sent:", proxyAuthorization, err)
+		t.Fail()
+	}
+
+	credentialsOpts.ProxyPasswordFile = ""
+	os.Unsetenv(ProxyPasswordEnvVarName)
+	if _, err := GenerateCredentials(&credentialsOpts); err == nil {
+		t.Log("the proxy user was used without a password")
+		t.Fail()
+	}
+}
+
+// Proxy that requires NTLM authentication of DOMAIN\user (with the password
+// "password") before it opens a tunnel
+func serveNTLMProxy(listener net.Listener) {
+	serverChallenge := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	targetInfo := []byte{ntlmAvTimestamp, 0, 8, 0, 0, 0x80, 0x56, 0x3a, 0x9d, 0x1e, 0xd9, 0x01, ntlmAvEOL, 0, 0, 0}
+	challenge := make([]byte, 48)
+	copy(challenge, ntlmSignature)
+	binary.LittleEndian.PutUint32(challenge[8:], 2)
+	binary.LittleEndian.PutUint32(challenge[20:], ntlmNegotiateFlags)
+	copy(challenge[24:], serverChallenge)
+	binary.LittleEndian.PutUint16(challenge[40:], uint16(len(targetInfo)))
+	binary.LittleEndian.PutUint32(challenge[44:], 48)
+	challenge = append(challenge, targetInfo...)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			reader := bufio.NewReader(conn)
+			req, err := http.ReadRequest(reader)
+			if err != nil || !strings.HasPrefix(req.Header.Get("Proxy-Authorization"), "NTLM ") {
+				io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\nProxy-Authenticate: NTLM\r\nContent-Length: 0\r\n\r\n")
+				return
+			}
+			io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\nProxy-Authenticate: NTLM "+
+				base64.StdEncoding.EncodeToString(challenge)+"\r\nContent-Length: 0\r\n\r\n")
+
+			req, err = http.ReadRequest(reader)
+			if err != nil {
+				return
+			}
+			authenticate, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(req.Header.Get("Proxy-Authorization"), "NTLM "))
+			field := func(i int) []byte {
+				length := int(binary.LittleEndian.Uint16(authenticate[12+8*i:]))
+				offset := int(binary.LittleEndian.Uint32(authenticate[16+8*i:]))
+				return authenticate[offset : offset+length]
+			}
+			if len(authenticate) < 64 || !bytes.Equal(field(3), utf16LE("user")) {
+				io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\nContent-Length: 0\r\n\r\n")
+				return
+			}
+			ntResponse := field(1)
+			expected := hmacMD5(ntowfv2("DOMAIN", "user", "password"), append(append([]byte{}, serverChallenge...), ntResponse[16:]...))
+			if !bytes.Equal(ntResponse[:16], expected) {
+				io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\nContent-Length: 0\r\n\r\n")
+				return
+			}
+			target, err := net.Dial("tcp", req.Host)
+			if err != nil {
+				io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\nContent-Length: 0\r\n\r\n")
+				return
+			}
+			defer target.Close()
+			io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+			go io.Copy(target, reader)
+			io.Copy(conn, target)
+		}()
+	}
+}
+
+func TestNTLMProxy(t *testing.T) {
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go serveNTLMProxy(listener)
+
+	os.Setenv(ProxyPasswordEnvVarName, "password")
+	defer os.Unsetenv(ProxyPasswordEnvVarName)
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+		ProxyURL:          listener.Addr().String(),
+		ProxyUser:         `DOMAIN\user`,
+		ProxyAuth:         ProxyAuthNTLM,
+	}
+	if _, err := GenerateCredentials(&credentialsOpts); err != nil {
+		t.Log("unable to obtain credentials through the NTLM proxy:", err)
+		t.Fail()
+	}
+
+	os.Setenv(ProxyPasswordEnvVarName, "wrong")
+	os.Setenv(MaxAttemptsEnvVarName, "1")
+	defer os.Unsetenv(MaxAttemptsEnvVarName)
+	if _, err := GenerateCredentials(&credentialsOpts); err == nil || !strings.Contains(err.Error(), "rejected the NTLM credentials") {
+		t.Log("the wrong NTLM credentials weren't rejected:", err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,48 @@
+package aws_signing_helper
+
+import (
+	"crypto/rand"
+	"math/big"
+	"time"
+)
+
+// Fraction of the lifetime of credentials after which the long-running
+// modes refresh them. If it's 0, they're refreshed a fixed time before they
+// expire instead.
+var RefreshFraction = 0.0
+
+// Largest fraction of the time until credentials are due to be refreshed
+// by which their refresh is brought forward, at random, so that the
+// instances of a fleet that started at the same time don't keep refreshing
+// their credentials at the same time
+var RefreshJitter = 0.1
+
+// Returns when to refresh credentials that were issued and expire at the
+// given times: after RefreshFraction of their lifetime, or else the given
+// lead time before they expire, brought forward by a random jitter. Since
+// the jitter only ever brings the refresh forward, it never makes it race
+// the expiry.
+func scheduleRefresh(issued time.Time, expiration time.Time, lead time.Duration) time.Time {
+	refreshTime := expiration.Add(-lead)
+	if !issued.Before(expiration) {
+		return refreshTime
+	}
+	if RefreshFraction > 0 {
+		refreshTime = issued.Add(time.Duration(RefreshFraction * float64(expiration.Sub(issued))))
+	}
+	maxJitter := time.Duration(RefreshJitter * float64(refreshTime.Sub(issued)))
+	return refreshTime.Add(-randomDuration(maxJitter))
+}
+
+// Returns a random duration between 0 and the given one, or 0, if there's
+// no randomness to be had
+func randomDuration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
+	if err != nil {
+		return 0
+	}
+	return time.Duration(n.Int64())
+}
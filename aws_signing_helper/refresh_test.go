@@ -0,0 +1,51 @@
+package aws_signing_helper
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleRefresh(t *testing.T) {
+	defer func(fraction, jitter float64) {
+		RefreshFraction, RefreshJitter = fraction, jitter
+	}(RefreshFraction, RefreshJitter)
+	issued := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	expiration := issued.Add(time.Hour)
+
+	// Without jitter, credentials are refreshed exactly when they're due
+	RefreshJitter = 0
+	RefreshFraction = 0
+	if refreshTime := scheduleRefresh(issued, expiration, 10*time.Minute); !refreshTime.Equal(expiration.Add(-10 * time.Minute)) {
+		t.Log("unexpected refresh time without a refresh fraction:", refreshTime)
+		t.Fail()
+	}
+	RefreshFraction = 0.5
+	if refreshTime := scheduleRefresh(issued, expiration, 10*time.Minute); !refreshTime.Equal(issued.Add(30 * time.Minute)) {
+		t.Log("unexpected refresh time with a refresh fraction of 0.5:", refreshTime)
+		t.Fail()
+	}
+
+	// With jitter, they're refreshed up to that fraction of the time until
+	// they're due earlier, and never later
+	RefreshJitter = 0.2
+	distinct := map[time.Time]bool{}
+	for i := 0; i < 100; i++ {
+		refreshTime := scheduleRefresh(issued, expiration, 10*time.Minute)
+		if refreshTime.Before(issued.Add(24*time.Minute)) || refreshTime.After(issued.Add(30*time.Minute)) {
+			t.Log("refresh time out of the jitter's range:", refreshTime)
+			t.Fail()
+		}
+		distinct[refreshTime] = true
+	}
+	if len(distinct) < 2 {
+		t.Log("jitter didn't vary the refresh time")
+		t.Fail()
+	}
+
+	// Credentials that were issued after they expire (as far as the local
+	// clock is concerned) are refreshed the lead time before they expire
+	if refreshTime := scheduleRefresh(expiration, expiration, 10*time.Minute); !refreshTime.Equal(expiration.Add(-10 * time.Minute)) {
+		t.Log("unexpected refresh time of expired credentials:", refreshTime)
+		t.Fail()
+	}
+}
@@ -0,0 +1,62 @@
+package aws_signing_helper
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Returns a channel that receives SIGHUP, which the long-running modes
+// handle by reading the signer's certificate and key again
+func notifyHangup() <-chan os.Signal {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	return hangups
+}
+
+// Reads the signer's certificate and key from their sources again, if the
+// signer supports it, and returns whether the certificate changed
+func reloadSigner(signer Signer) bool {
+	reloadable, ok := signer.(reloadableSigner)
+	if !ok {
+		log.Println("received SIGHUP, but the certificate and private key can't be read again from where they're stored")
+		return false
+	}
+	if !reloadable.reload() {
+		log.Println("received SIGHUP, and read the certificate and private key again, which haven't changed")
+		return false
+	}
+	if certificate, err := signer.Certificate(); err == nil && certificate != nil {
+		log.Println("received SIGHUP, and reloaded the certificate, with serial number", certificate.SerialNumber)
+	}
+	return true
+}
+
+// Reads the signer's certificate and key again, and, if the certificate
+// changed, replaces the served credentials with ones obtained with it.
+// Requests that are served meanwhile are served the previous credentials,
+// which are also kept if new ones couldn't be obtained. A refresh that was
+// in flight may have been signed with the previous key, so it's waited for,
+// rather than joined.
+func reloadCredentials(signer Signer, creds []*RefreshableCred, roles []*CredentialsOpts) {
+	if !reloadSigner(signer) {
+		return
+	}
+	for i, cred := range creds {
+		cred.waitForRefresh()
+		if err := refreshCredentials(cred, roles[i], signer); err != nil {
+			log.Println("unable to refresh credentials with the reloaded certificate:", err)
+		}
+	}
+}
+
+// Reloads the served credentials whenever the process receives SIGHUP
+func reloadCredentialsOnHangup(signer Signer, creds []*RefreshableCred, roles []*CredentialsOpts) {
+	hangups := notifyHangup()
+	go func() {
+		for range hangups {
+			reloadCredentials(signer, creds, roles)
+		}
+	}()
+}
@@ -0,0 +1,49 @@
+package aws_signing_helper
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestReloadCredentials(t *testing.T) {
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	volume := t.TempDir()
+	writeTestSecretVolume(t, volume, "1", "../tst/certs/ec-prime256v1-key.pem", "../tst/certs/ec-prime256v1-sha256-cert.pem")
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      filepath.Join(volume, "tls.key"),
+		CertificateId:     filepath.Join(volume, "tls.crt"),
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	signer, err := GetSigner(&credentialsOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+
+	// The credentials aren't refreshed if the certificate hasn't changed
+	var cred RefreshableCred
+	reloadCredentials(signer, []*RefreshableCred{&cred}, []*CredentialsOpts{&credentialsOpts})
+	if cred.AccessKeyId != "" {
+		t.Log("expected the credentials not to be refreshed with an unchanged certificate")
+		t.Fail()
+	}
+
+	// They're refreshed with the new certificate, if it changed
+	writeTestSecretVolume(t, volume, "2", "../tst/certs/rsa-2048-key.pem", "../tst/certs/rsa-2048-sha256-cert.pem")
+	reloadCredentials(signer, []*RefreshableCred{&cred}, []*CredentialsOpts{&credentialsOpts})
+	if cred.AccessKeyId != "accessKeyId" {
+		t.Log("expected the credentials to be refreshed with the reloaded certificate")
+		t.Fail()
+	}
+	certificate, _ := signer.Certificate()
+	expected, _ := readCertificate("../tst/certs/rsa-2048-sha256-cert.pem")
+	if !certificate.Equal(expected) {
+		t.Log("expected the reloaded certificate to be used")
+		t.Fail()
+	}
+}
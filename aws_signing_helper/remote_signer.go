@@ -0,0 +1,167 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/aws/rolesanywhere-credential-helper/aws_signing_helper/remotesigner"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Time allowed for each call to a remote signer
+const remoteSignerTimeout = 30 * time.Second
+
+// Maps the supported digests to their protocol values
+var remoteSignerDigests = map[crypto.Hash]remotesigner.Digest{
+	crypto.SHA256: remotesigner.Digest_SHA256,
+	crypto.SHA384: remotesigner.Digest_SHA384,
+	crypto.SHA512: remotesigner.Digest_SHA512,
+}
+
+// Signer that delegates signing to a remote signing service, which
+// implements the RemoteSigner gRPC service (see
+// remotesigner/remote_signer.proto)
+type RemoteSigner struct {
+	conn             *grpc.ClientConn
+	client           remotesigner.RemoteSignerClient
+	keyId            string
+	cert             *x509.Certificate
+	certificateChain []*x509.Certificate
+}
+
+// Creates a signer that uses the remote signer at the given endpoint. A
+// "unix://" endpoint is reached over a Unix domain socket, whose
+// permissions control access to the signer, and a "vsock://<cid>:<port>"
+// endpoint is reached over vsock (as served by serve-signer within a Nitro
+// Enclave); other endpoints ("host:port") are reached over TLS. The
+// certificate (and certificate chain) are obtained from the signer, unless
+// they are provided.
+func GetRemoteSigner(endpoint string, keyId string, certificateId string, certificateBundleId string) (signer Signer, err error) {
+	var transportCredentials credentials.TransportCredentials
+	dialOpts := []grpc.DialOption{}
+	if strings.HasPrefix(endpoint, vsockEndpointPrefix) {
+		addr, err := parseVsockEndpoint(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		// vsock connections can't leave the instance
+		transportCredentials = insecure.NewCredentials()
+		dialOpts = append(dialOpts, grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return dialVsock(addr)
+		}))
+		endpoint = "passthrough:///" + addr.String()
+	} else if strings.HasPrefix(endpoint, "unix:") {
+		transportCredentials = insecure.NewCredentials()
+	} else {
+		transportCredentials = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	}
+	dialOpts = append(dialOpts, grpc.WithTransportCredentials(transportCredentials))
+	conn, err := grpc.Dial(endpoint, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to the remote signer: %w", err)
+	}
+	remoteSigner := &RemoteSigner{conn: conn, client: remotesigner.NewRemoteSignerClient(conn), keyId: keyId}
+	defer func() {
+		if err != nil {
+			remoteSigner.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), remoteSignerTimeout)
+	defer cancel()
+	if certificateId != "" {
+		if remoteSigner.cert, err = readCertificate(certificateId); err != nil {
+			return nil, err
+		}
+	} else {
+		response, err := remoteSigner.client.GetCertificate(ctx, &remotesigner.GetCertificateRequest{KeyId: keyId})
+		if err != nil {
+			return nil, fmt.Errorf("unable to get the certificate from the remote signer: %w", err)
+		}
+		if remoteSigner.cert, err = x509.ParseCertificate(response.Certificate); err != nil {
+			return nil, fmt.Errorf("invalid certificate from the remote signer: %w", err)
+		}
+	}
+	if certificateBundleId != "" {
+		if remoteSigner.certificateChain, err = ReadCertificateBundleData(certificateBundleId); err != nil {
+			return nil, err
+		}
+	} else {
+		response, err := remoteSigner.client.GetChain(ctx, &remotesigner.GetChainRequest{KeyId: keyId})
+		if err != nil {
+			return nil, fmt.Errorf("unable to get the certificate chain from the remote signer: %w", err)
+		}
+		for _, certData := range response.Certificates {
+			cert, err := x509.ParseCertificate(certData)
+			if err != nil {
+				return nil, fmt.Errorf("invalid certificate chain from the remote signer: %w", err)
+			}
+			remoteSigner.certificateChain = append(remoteSigner.certificateChain, cert)
+		}
+	}
+
+	switch remoteSigner.cert.PublicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, errors.New("unsupported certificate key type")
+	}
+	return remoteSigner, nil
+}
+
+func (remoteSigner *RemoteSigner) Public() crypto.PublicKey {
+	return remoteSigner.cert.PublicKey
+}
+
+// Signs the digest through the remote signer. As with external signer
+// commands, the signature is verified before it's used.
+func (remoteSigner *RemoteSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	algorithm, ok := remoteSignerDigests[opts.HashFunc()]
+	if !ok {
+		return nil, errors.New("unsupported digest")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), remoteSignerTimeout)
+	defer cancel()
+	response, err := remoteSigner.client.Sign(ctx, &remotesigner.SignRequest{KeyId: remoteSigner.keyId, Digest: digest, Algorithm: algorithm})
+	if err != nil {
+		return nil, fmt.Errorf("remote signing failed: %w", err)
+	}
+
+	valid := false
+	switch publicKey := remoteSigner.cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(publicKey, opts.HashFunc(), digest, response.Signature) == nil
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(publicKey, digest, response.Signature)
+	}
+	if !valid {
+		return nil, errors.New("the remote signer returned an invalid signature")
+	}
+	return response.Signature, nil
+}
+
+func (remoteSigner *RemoteSigner) Certificate() (*x509.Certificate, error) {
+	return remoteSigner.cert, nil
+}
+
+func (remoteSigner *RemoteSigner) CertificateChain() ([]*x509.Certificate, error) {
+	return remoteSigner.certificateChain, nil
+}
+
+func (remoteSigner *RemoteSigner) Close() {
+	if remoteSigner.conn != nil {
+		remoteSigner.conn.Close()
+		remoteSigner.conn = nil
+	}
+}
@@ -0,0 +1,130 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/rolesanywhere-credential-helper/aws_signing_helper/remotesigner"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Remote signer that holds a single key, with the ID "test-key"
+type testRemoteSigner struct {
+	remotesigner.UnimplementedRemoteSignerServer
+	privateKey crypto.Signer
+	cert       *x509.Certificate
+}
+
+func (server *testRemoteSigner) Sign(ctx context.Context, request *remotesigner.SignRequest) (*remotesigner.SignResponse, error) {
+	if request.KeyId != "test-key" {
+		return nil, status.Error(codes.NotFound, "no such key")
+	}
+	if request.Algorithm != remotesigner.Digest_SHA256 {
+		return nil, status.Error(codes.InvalidArgument, "unsupported digest")
+	}
+	sig, err := server.privateKey.Sign(rand.Reader, request.Digest, crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	return &remotesigner.SignResponse{Signature: sig}, nil
+}
+
+func (server *testRemoteSigner) GetCertificate(ctx context.Context, request *remotesigner.GetCertificateRequest) (*remotesigner.GetCertificateResponse, error) {
+	return &remotesigner.GetCertificateResponse{Certificate: server.cert.Raw}, nil
+}
+
+func (server *testRemoteSigner) GetChain(ctx context.Context, request *remotesigner.GetChainRequest) (*remotesigner.GetChainResponse, error) {
+	return &remotesigner.GetChainResponse{}, nil
+}
+
+// Starts an in-process remote signer on a Unix domain socket, and returns
+// its endpoint
+func startTestRemoteSigner(t *testing.T, privateKeyId string, certificateId string) string {
+	privateKey, err := ReadPrivateKeyData(privateKeyId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &testRemoteSigner{}
+	switch key := privateKey.(type) {
+	case ecdsa.PrivateKey:
+		server.privateKey = &key
+	case rsa.PrivateKey:
+		server.privateKey = &key
+	}
+	if server.cert, err = readCertificate(certificateId); err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(t.TempDir(), "signer.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcServer := grpc.NewServer()
+	remotesigner.RegisterRemoteSignerServer(grpcServer, server)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+	return "unix://" + socket
+}
+
+func TestRemoteSigner(t *testing.T) {
+	msg := []byte("test message")
+	digest := sha256.Sum256(msg)
+
+	for _, fixture := range []struct{ keyId, certificateId string }{
+		{"../tst/certs/ec-prime256v1-key.pem", "../tst/certs/ec-prime256v1-sha256-cert.pem"},
+		{"../tst/certs/rsa-2048-key.pem", "../tst/certs/rsa-2048-sha256-cert.pem"},
+	} {
+		endpoint := startTestRemoteSigner(t, fixture.keyId, fixture.certificateId)
+		signer, err := GetRemoteSigner(endpoint, "test-key", "", "")
+		if err != nil {
+			t.Log(err)
+			t.Fail()
+			continue
+		}
+		signingResult, err := Sign(msg, SigningOpts{signer, crypto.SHA256})
+		signer.Close()
+		if err != nil {
+			t.Log(err)
+			t.Fail()
+			continue
+		}
+		sig, _ := hex.DecodeString(signingResult.Signature)
+
+		valid := false
+		switch publicKey := signer.Public().(type) {
+		case *ecdsa.PublicKey:
+			valid = ecdsa.VerifyASN1(publicKey, digest[:], sig)
+		case *rsa.PublicKey:
+			valid = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], sig) == nil
+		}
+		if !valid {
+			t.Logf("Failed to verify the remote signature for %s", fixture.certificateId)
+			t.Fail()
+		}
+	}
+}
+
+func TestRemoteSignerUnknownKey(t *testing.T) {
+	endpoint := startTestRemoteSigner(t, "../tst/certs/ec-prime256v1-key.pem", "../tst/certs/ec-prime256v1-sha256-cert.pem")
+	signer, err := GetRemoteSigner(endpoint, "other-key", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+	if _, err = Sign([]byte("test message"), SigningOpts{signer, crypto.SHA256}); err == nil {
+		t.Log("Expected signing with an unknown key to fail")
+		t.Fail()
+	}
+}
@@ -0,0 +1,62 @@
+package aws_signing_helper
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+)
+
+// Environment variables that set how many times, and how, requests to AWS
+// that fail transiently are attempted (the same ones as the AWS SDKs')
+const (
+	MaxAttemptsEnvVarName = "AWS_MAX_ATTEMPTS"
+	RetryModeEnvVarName   = "AWS_RETRY_MODE"
+)
+
+// Retry modes, as in the AWS SDKs: the standard mode (the default) retries
+// the errors that the SDK deems retryable, with exponential backoff and a
+// retry quota; the adaptive one also rate limits requests on the client
+// side, once they're throttled
+const (
+	RetryModeStandard = "standard"
+	RetryModeAdaptive = "adaptive"
+)
+
+// Number of times that a request is attempted, including the first one, if
+// AWS_MAX_ATTEMPTS isn't set
+const defaultMaxAttempts = 3
+
+// How long to wait before attempting a request again, if not the SDK's
+// default (exponential backoff with full jitter, of at most 20 seconds)
+var retryBackoff retry.BackoffDelayer
+
+// Returns the retryer for requests to AWS, as set by AWS_RETRY_MODE and
+// AWS_MAX_ATTEMPTS
+func newRetryer() (aws.Retryer, error) {
+	maxAttempts := defaultMaxAttempts
+	if value := os.Getenv(MaxAttemptsEnvVarName); value != "" {
+		var err error
+		if maxAttempts, err = strconv.Atoi(value); err != nil || maxAttempts < 1 {
+			return nil, fmt.Errorf("invalid %s %s (expected a positive number)", MaxAttemptsEnvVarName, value)
+		}
+	}
+	standardOptions := func(options *retry.StandardOptions) {
+		options.MaxAttempts = maxAttempts
+		if retryBackoff != nil {
+			options.Backoff = retryBackoff
+		}
+	}
+	switch mode := os.Getenv(RetryModeEnvVarName); mode {
+	case "", RetryModeStandard:
+		return retry.NewStandard(standardOptions), nil
+	case RetryModeAdaptive:
+		return retry.NewAdaptiveMode(func(options *retry.AdaptiveModeOptions) {
+			options.StandardOptions = append(options.StandardOptions, standardOptions)
+		}), nil
+	default:
+		return nil, fmt.Errorf("invalid %s %s (expected %s or %s)", RetryModeEnvVarName, mode, RetryModeStandard, RetryModeAdaptive)
+	}
+}
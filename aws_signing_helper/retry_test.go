@@ -0,0 +1,98 @@
+package aws_signing_helper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+)
+
+func TestNewRetryer(t *testing.T) {
+	fixtures := []struct {
+		envVar   string
+		mode     string
+		valid    bool
+		adaptive bool
+		attempts int
+	}{
+		{"", "", true, false, 3},
+		{"5", "standard", true, false, 5},
+		{"1", "adaptive", true, true, 1},
+		{"4", "legacy", false, false, 0},
+		{"0", "", false, false, 0},
+		{"three", "", false, false, 0},
+		{"", "eventually", false, false, 0},
+	}
+	for _, fixture := range fixtures {
+		t.Setenv(MaxAttemptsEnvVarName, fixture.envVar)
+		t.Setenv(RetryModeEnvVarName, fixture.mode)
+		retryer, err := newRetryer()
+		if (err == nil) != fixture.valid {
+			t.Logf("unexpected result for %q and %q: %v", fixture.envVar, fixture.mode, err)
+			t.Fail()
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		_, standard := retryer.(*retry.Standard)
+		_, adaptive := retryer.(*retry.AdaptiveMode)
+		if standard == fixture.adaptive || adaptive != fixture.adaptive || retryer.MaxAttempts() != fixture.attempts {
+			t.Logf("unexpected retryer for %q and %q: %#v", fixture.envVar, fixture.mode, retryer)
+			t.Fail()
+		}
+	}
+}
+
+func TestCreateSessionRetries(t *testing.T) {
+	defer func(backoff retry.BackoffDelayer) { retryBackoff = backoff }(retryBackoff)
+	retryBackoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) {
+		return time.Millisecond, nil
+	})
+
+	// The server throttles the first request, fails the second, and only
+	// then issues credentials
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&requests, 1) {
+		case 1:
+			w.Header().Set("X-Amzn-Errortype", "ThrottlingException")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(mockedCreateSessionResponse))
+		}
+	}))
+	defer server.Close()
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+
+	for _, fixture := range []struct {
+		maxAttempts int
+		succeeds    bool
+	}{
+		{3, true},
+		{2, false},
+	} {
+		atomic.StoreInt32(&requests, 0)
+		t.Setenv(MaxAttemptsEnvVarName, strconv.Itoa(fixture.maxAttempts))
+		_, err := GenerateCredentials(&credentialsOpts)
+		if (err == nil) != fixture.succeeds || atomic.LoadInt32(&requests) != int32(fixture.maxAttempts) {
+			t.Logf("unexpected result with %d attempts, after %d requests: %v", fixture.maxAttempts, atomic.LoadInt32(&requests), err)
+			t.Fail()
+		}
+	}
+}
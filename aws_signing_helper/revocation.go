@@ -0,0 +1,149 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+var revocationHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// Returned when the certificate has been revoked, since IAM Roles Anywhere
+// only reports that access is denied
+var ErrCertificateRevoked = errors.New("certificate revoked")
+
+// Checks whether the certificate has been revoked, through its OCSP
+// responder or, if it has none (or the responder can't tell), its CRL.
+// Only revocation is reported as an error: if the status can't be
+// determined, a warning is logged, and IAM Roles Anywhere is left to decide.
+func checkRevocation(certificate *x509.Certificate, chain []*x509.Certificate) error {
+	issuer := findIssuer(certificate, chain)
+	if issuer == nil {
+		var err error
+		if issuer, err = fetchIssuer(certificate); err != nil {
+			log.Println("unable to check whether the certificate is revoked, since its issuer isn't known:", err)
+			return nil
+		}
+	}
+
+	for _, server := range certificate.OCSPServer {
+		revoked, revokedAt, err := checkOCSP(certificate, issuer, server)
+		if err != nil {
+			log.Println("unable to check the certificate's status with", server, "-", err)
+			continue
+		}
+		if revoked {
+			return revocationError(certificate, revokedAt, server)
+		}
+		return nil
+	}
+	for _, url := range certificate.CRLDistributionPoints {
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			continue
+		}
+		revoked, revokedAt, err := checkCRL(certificate, issuer, url)
+		if err != nil {
+			log.Println("unable to check the certificate against the CRL at", url, "-", err)
+			continue
+		}
+		if revoked {
+			return revocationError(certificate, revokedAt, url)
+		}
+		return nil
+	}
+	if len(certificate.OCSPServer) == 0 && len(certificate.CRLDistributionPoints) == 0 {
+		log.Println("unable to check whether the certificate is revoked, since it has neither an OCSP responder nor a CRL")
+	}
+	return nil
+}
+
+func revocationError(certificate *x509.Certificate, revokedAt time.Time, source string) error {
+	return fmt.Errorf("%w: the certificate %s (serial number %s) was revoked on %s, according to %s; it has to be replaced",
+		ErrCertificateRevoked, certificate.Subject, certificate.SerialNumber, revokedAt.Format(time.RFC3339), source)
+}
+
+// Finds the certificate's issuer among the others
+func findIssuer(certificate *x509.Certificate, certs []*x509.Certificate) *x509.Certificate {
+	for _, cert := range certs {
+		if bytes.Equal(certificate.RawIssuer, cert.RawSubject) && certificate.CheckSignatureFrom(cert) == nil {
+			return cert
+		}
+	}
+	return nil
+}
+
+// Asks the OCSP responder whether the certificate has been revoked (and
+// when). An error is returned if the responder doesn't know.
+func checkOCSP(certificate *x509.Certificate, issuer *x509.Certificate, server string) (bool, time.Time, error) {
+	request, err := ocsp.CreateRequest(certificate, issuer, nil)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	resp, err := revocationHTTPClient.Post(server, "application/ocsp-request", bytes.NewReader(request))
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, time.Time{}, errors.New("unexpected status: " + resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	response, err := ocsp.ParseResponseForCert(data, certificate, issuer)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	switch response.Status {
+	case ocsp.Good:
+		return false, time.Time{}, nil
+	case ocsp.Revoked:
+		return true, response.RevokedAt, nil
+	}
+	return false, time.Time{}, errors.New("the responder doesn't know the certificate")
+}
+
+// Looks the certificate up in the CRL at the given URL, which has to be
+// signed by the certificate's issuer, and returns whether (and when) it has
+// been revoked
+func checkCRL(certificate *x509.Certificate, issuer *x509.Certificate, url string) (bool, time.Time, error) {
+	resp, err := revocationHTTPClient.Get(url)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, time.Time{}, errors.New("unexpected status: " + resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	//lint:ignore SA1019 x509.ParseRevocationList requires Go 1.19
+	crl, err := x509.ParseCRL(data)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	//lint:ignore SA1019 x509.RevocationList.CheckSignatureFrom requires Go 1.19
+	if err = issuer.CheckCRLSignature(crl); err != nil {
+		return false, time.Time{}, err
+	}
+	if crl.HasExpired(time.Now()) {
+		log.Println("the CRL at", url, "is out of date")
+	}
+	for _, revoked := range crl.TBSCertList.RevokedCertificates {
+		if revoked.SerialNumber.Cmp(certificate.SerialNumber) == 0 {
+			return true, revoked.RevocationTime, nil
+		}
+	}
+	return false, time.Time{}, nil
+}
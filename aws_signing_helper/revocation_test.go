@@ -0,0 +1,121 @@
+package aws_signing_helper
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestCheckRevocation(t *testing.T) {
+	ca, caKey := createChainTestCertificate(t, "Revocation CA", nil, nil)
+	revokedSerial := big.NewInt(2)
+	revokedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	ocspAvailable := true
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ocsp":
+			if !ocspAvailable {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			request, err := ocsp.ParseRequest(body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			template := ocsp.Response{
+				Status:       ocsp.Good,
+				SerialNumber: request.SerialNumber,
+				ThisUpdate:   time.Now(),
+				NextUpdate:   time.Now().Add(time.Hour),
+			}
+			if request.SerialNumber.Cmp(revokedSerial) == 0 {
+				template.Status = ocsp.Revoked
+				template.RevokedAt = revokedAt
+			}
+			response, err := ocsp.CreateResponse(ca, ca, template, caKey)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Write(response)
+		case "/crl":
+			crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+				Number:     big.NewInt(1),
+				ThisUpdate: time.Now(),
+				NextUpdate: time.Now().Add(time.Hour),
+				RevokedCertificates: []pkix.RevokedCertificate{
+					{SerialNumber: revokedSerial, RevocationTime: revokedAt},
+				},
+			}, ca, caKey)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Write(crl)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	issue := func(serial int64, ocspServer bool) *x509.Certificate {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(serial),
+			Subject:               pkix.Name{CommonName: "host"},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			CRLDistributionPoints: []string{server.URL + "/crl"},
+		}
+		if ocspServer {
+			template.OCSPServer = []string{server.URL + "/ocsp"}
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, _ := x509.ParseCertificate(der)
+		return cert
+	}
+
+	fixtures := []struct {
+		name          string
+		certificate   *x509.Certificate
+		ocspAvailable bool
+		revoked       bool
+	}{
+		{"good (OCSP)", issue(1, true), true, false},
+		{"revoked (OCSP)", issue(2, true), true, true},
+		{"revoked (CRL, after OCSP failed)", issue(2, true), false, true},
+		{"good (CRL)", issue(1, false), true, false},
+		{"revoked (CRL)", issue(2, false), true, true},
+	}
+	for _, fixture := range fixtures {
+		ocspAvailable = fixture.ocspAvailable
+		err := checkRevocation(fixture.certificate, []*x509.Certificate{ca})
+		if errors.Is(err, ErrCertificateRevoked) != fixture.revoked || (err != nil && !fixture.revoked) {
+			t.Logf("Unexpected result for %s: %v", fixture.name, err)
+			t.Fail()
+		}
+	}
+
+	// Without its issuer, the certificate's status can't be checked
+	if err := checkRevocation(issue(2, true), nil); err != nil {
+		t.Log("Expected an unknown status not to be an error:", err)
+		t.Fail()
+	}
+}
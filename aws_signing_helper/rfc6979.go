@@ -0,0 +1,109 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+)
+
+// Options with which ECDSA keys produce deterministic signatures, whose
+// nonce is derived from the key and digest as described in RFC 6979, rather
+// than read from a random source (which may be weak on embedded devices)
+type deterministicECDSAOptions struct {
+	Hash crypto.Hash
+}
+
+func (opts *deterministicECDSAOptions) HashFunc() crypto.Hash {
+	return opts.Hash
+}
+
+// Implemented by signers whose ECDSA keys can produce deterministic
+// signatures, when they're passed *deterministicECDSAOptions
+type deterministicECDSASigner interface {
+	supportsDeterministicECDSA() bool
+}
+
+// Converts a bit string to an integer, keeping its leftmost qlen bits
+// (bits2int in RFC 6979, section 2.3.2)
+func bits2int(b []byte, qlen int) *big.Int {
+	x := new(big.Int).SetBytes(b)
+	if blen := len(b) * 8; blen > qlen {
+		x.Rsh(x, uint(blen-qlen))
+	}
+	return x
+}
+
+// Encodes an integer in as many octets as the curve order takes
+// (int2octets in RFC 6979, section 2.3.3)
+func int2octets(x *big.Int, rlen int) []byte {
+	out := make([]byte, rlen)
+	return x.FillBytes(out)
+}
+
+// Signs the digest with the ECDSA key, using the nonce generation of RFC
+// 6979, section 3.2. The signature is ASN.1-encoded, as ecdsa.SignASN1's is.
+func signECDSADeterministic(privateKey *ecdsa.PrivateKey, hash crypto.Hash, digest []byte) ([]byte, error) {
+	if !hash.Available() {
+		return nil, errors.New("unsupported digest")
+	}
+	curve := privateKey.Curve
+	q := curve.Params().N
+	qlen := q.BitLen()
+	rlen := (qlen + 7) / 8
+
+	// bits2octets(h1) reduces the digest modulo q
+	z := bits2int(digest, qlen)
+	if z.Cmp(q) >= 0 {
+		z.Sub(z, q)
+	}
+	x := int2octets(privateKey.D, rlen)
+	h1 := int2octets(z, rlen)
+
+	mac := func(key []byte, data ...[]byte) []byte {
+		h := hmac.New(hash.New, key)
+		for _, d := range data {
+			h.Write(d)
+		}
+		return h.Sum(nil)
+	}
+	v := make([]byte, hash.Size())
+	k := make([]byte, hash.Size())
+	for i := range v {
+		v[i] = 0x01
+	}
+	k = mac(k, v, []byte{0x00}, x, h1)
+	v = mac(k, v)
+	k = mac(k, v, []byte{0x01}, x, h1)
+	v = mac(k, v)
+
+	e := bits2int(digest, qlen)
+	for {
+		var t []byte
+		for len(t)*8 < qlen {
+			v = mac(k, v)
+			t = append(t, v...)
+		}
+		nonce := bits2int(t, qlen)
+		if nonce.Sign() > 0 && nonce.Cmp(q) < 0 {
+			// r = (nonce * G).x mod q, s = nonce^-1 * (e + r * d) mod q
+			rx, _ := curve.ScalarBaseMult(int2octets(nonce, rlen))
+			r := new(big.Int).Mod(rx, q)
+			if r.Sign() != 0 {
+				s := new(big.Int).Mul(r, privateKey.D)
+				s.Add(s, e)
+				s.Mul(s, new(big.Int).ModInverse(nonce, q))
+				s.Mod(s, q)
+				if s.Sign() != 0 {
+					return asn1.Marshal(struct {
+						R, S *big.Int
+					}{r, s})
+				}
+			}
+		}
+		k = mac(k, v, []byte{0x00})
+		v = mac(k, v)
+	}
+}
@@ -0,0 +1,121 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/asn1"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func hexInt(s string) *big.Int {
+	x, _ := new(big.Int).SetString(s, 16)
+	return x
+}
+
+// Test vectors from RFC 6979, appendix A.2.5 and A.2.6
+func TestSignECDSADeterministic(t *testing.T) {
+	fixtures := []struct {
+		curve   elliptic.Curve
+		key     string
+		hash    crypto.Hash
+		message string
+		r       string
+		s       string
+	}{
+		{
+			elliptic.P256(),
+			"C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721",
+			crypto.SHA256,
+			"sample",
+			"EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716",
+			"F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8",
+		},
+		{
+			elliptic.P256(),
+			"C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721",
+			crypto.SHA256,
+			"test",
+			"F1ABB023518351CD71D881567B1EA663ED3EFCF6C5132B354F28D3B0B7D38367",
+			"019F4113742A2B14BD25926B49C649155F267E60D3814B4C0CC84250E46F0083",
+		},
+		{
+			elliptic.P384(),
+			"6B9D3DAD2E1B8C1C05B19875B6659F4DE23C3B667BF297BA9AA47740787137D896D5724E4C70A825F872C9EA60D2EDF5",
+			crypto.SHA384,
+			"sample",
+			"94EDBB92A5ECB8AAD4736E56C691916B3F88140666CE9FA73D64C4EA95AD133C81A648152E44ACF96E36DD1E80FABE46",
+			"99EF4AEB15F178CEA1FE40DB2603138F130E740A19624526203B6351D0A3A94FA329C145786E679E7B82C71A38628AC8",
+		},
+	}
+	for _, fixture := range fixtures {
+		privateKey := &ecdsa.PrivateKey{D: hexInt(fixture.key)}
+		privateKey.Curve = fixture.curve
+		privateKey.X, privateKey.Y = fixture.curve.ScalarBaseMult(privateKey.D.Bytes())
+		h := fixture.hash.New()
+		h.Write([]byte(fixture.message))
+		digest := h.Sum(nil)
+
+		sig, err := signECDSADeterministic(privateKey, fixture.hash, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var parsed struct {
+			R, S *big.Int
+		}
+		if _, err = asn1.Unmarshal(sig, &parsed); err != nil {
+			t.Fatal(err)
+		}
+		if parsed.R.Cmp(hexInt(fixture.r)) != 0 || parsed.S.Cmp(hexInt(fixture.s)) != 0 {
+			t.Logf("Unexpected signature of %q: r = %X, s = %X", fixture.message, parsed.R, parsed.S)
+			t.Fail()
+		}
+		if !ecdsa.VerifyASN1(&privateKey.PublicKey, digest, sig) {
+			t.Log("Failed to verify the deterministic signature")
+			t.Fail()
+		}
+	}
+}
+
+func TestSignPayloadDeterministic(t *testing.T) {
+	msg := []byte("test message")
+	privateKey, _ := ReadPrivateKeyData("../tst/certs/ec-prime256v1-key.pem")
+	fileSystemSigner, err := GetFileSystemSigner("../tst/certs/ec-prime256v1-key.pem", "../tst/certs/ec-prime256v1-sha256-cert.pem", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []crypto.PrivateKey{privateKey, fileSystemSigner} {
+		for _, digest := range []crypto.Hash{crypto.SHA256, crypto.SHA384, crypto.SHA512} {
+			first, err := signPayload(msg, key, &deterministicECDSAOptions{digest})
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, _ := signPayload(msg, key, &deterministicECDSAOptions{digest})
+			if first.Signature != second.Signature {
+				t.Log("Expected deterministic signatures to be identical")
+				t.Fail()
+			}
+			var sum []byte
+			switch digest {
+			case crypto.SHA256:
+				s := sha256.Sum256(msg)
+				sum = s[:]
+			case crypto.SHA384:
+				s := sha512.Sum384(msg)
+				sum = s[:]
+			case crypto.SHA512:
+				s := sha512.Sum512(msg)
+				sum = s[:]
+			}
+			sig, _ := hex.DecodeString(first.Signature)
+			if !ecdsa.VerifyASN1(fileSystemSigner.Public().(*ecdsa.PublicKey), sum, sig) {
+				t.Log("Failed to verify the deterministic signature")
+				t.Fail()
+			}
+		}
+	}
+}
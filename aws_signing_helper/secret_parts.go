@@ -0,0 +1,55 @@
+package aws_signing_helper
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Secret stores that cap the size of what they hold (the Credential Manager
+// takes at most 2560 bytes per credential, which cached credentials, with
+// their session token, can exceed) keep larger secrets in parts: the first
+// one under the key itself, and the following ones under the key suffixed
+// with their index. A part that's shorter than the cap is the last one, so
+// a secret whose size is a multiple of the cap ends with an empty part, and
+// parts left over from a larger secret that was replaced aren't read.
+func secretPartName(key string, index int) string {
+	if index == 0 {
+		return key
+	}
+	return key + "/" + strconv.Itoa(index)
+}
+
+// Writes the secret in parts of at most maxPartSize bytes, through writePart
+func writeSecretParts(key string, secret []byte, maxPartSize int, writePart func(name string, part []byte) error) error {
+	for index := 0; ; index++ {
+		part := secret[:min(len(secret), maxPartSize)]
+		if err := writePart(secretPartName(key, index), part); err != nil {
+			return err
+		}
+		if len(part) < maxPartSize {
+			return nil
+		}
+		secret = secret[len(part):]
+	}
+}
+
+// Reads the secret that writeSecretParts wrote, through readPart
+func readSecretParts(key string, maxPartSize int, readPart func(name string) ([]byte, error)) ([]byte, error) {
+	var secret []byte
+	for index := 0; ; index++ {
+		part, err := readPart(secretPartName(key, index))
+		if index > 0 && errors.Is(err, errSecretNotFound) {
+			return nil, errors.New("a part of the secret is missing")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(part) > maxPartSize {
+			return nil, errors.New("a part of the secret is larger than the secret store allows")
+		}
+		secret = append(secret, part...)
+		if len(part) < maxPartSize {
+			return secret, nil
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// A secret store that, like the Credential Manager, caps what each of its
+// secrets holds
+type cappedSecretStore struct {
+	secrets map[string][]byte
+	maxSize int
+}
+
+func (store cappedSecretStore) read(name string) ([]byte, error) {
+	secret, ok := store.secrets[name]
+	if !ok {
+		return nil, errSecretNotFound
+	}
+	return secret, nil
+}
+
+func (store cappedSecretStore) write(name string, secret []byte) error {
+	if len(secret) > store.maxSize {
+		return errors.New("the secret is too large")
+	}
+	store.secrets[name] = append([]byte(nil), secret...)
+	return nil
+}
+
+func TestSecretPartsWithLargeToken(t *testing.T) {
+	store := cappedSecretStore{map[string][]byte{}, 2560}
+	credentials, err := json.Marshal(CredentialProcessOutput{
+		Version:         1,
+		AccessKeyId:     "ASIAEXAMPLE",
+		SecretAccessKey: "secret",
+		SessionToken:    strings.Repeat("t", 6000),
+		Expiration:      "2026-10-16T00:00:00Z",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, secret := range [][]byte{
+		credentials,
+		bytes.Repeat([]byte("s"), 2*2560),
+		[]byte("short"),
+		nil,
+	} {
+		if err := writeSecretParts("key", secret, store.maxSize, store.write); err != nil {
+			t.Log("unable to write a secret of", len(secret), "bytes:", err)
+			t.Fail()
+			continue
+		}
+		read, err := readSecretParts("key", store.maxSize, store.read)
+		if err != nil || !bytes.Equal(read, secret) {
+			t.Log("a secret of", len(secret), "bytes wasn't read back:", len(read), err)
+			t.Fail()
+		}
+	}
+	if len(store.secrets) != 3 {
+		t.Log("expected the large token to be split across three parts, got", len(store.secrets))
+		t.Fail()
+	}
+
+	if err := writeSecretParts("key", credentials, store.maxSize, store.write); err != nil {
+		t.Fatal(err)
+	}
+	delete(store.secrets, "key/1")
+	if _, err := readSecretParts("key", store.maxSize, store.read); err == nil || errors.Is(err, errSecretNotFound) {
+		t.Log("a secret with a missing part was read:", err)
+		t.Fail()
+	}
+	if _, err := readSecretParts("missing", store.maxSize, store.read); !errors.Is(err, errSecretNotFound) {
+		t.Log("a missing secret wasn't reported as such:", err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,93 @@
+package aws_signing_helper
+
+/*
+#cgo LDFLAGS: -framework CoreFoundation -framework Security
+#include <stdlib.h>
+#include <CoreFoundation/CoreFoundation.h>
+#include <Security/Security.h>
+
+static CFMutableDictionaryRef genericPasswordQuery(const char *service, const char *account) {
+	CFStringRef serviceRef = CFStringCreateWithCString(kCFAllocatorDefault, service, kCFStringEncodingUTF8);
+	CFStringRef accountRef = CFStringCreateWithCString(kCFAllocatorDefault, account, kCFStringEncodingUTF8);
+	CFMutableDictionaryRef query = CFDictionaryCreateMutable(kCFAllocatorDefault, 0,
+		&kCFTypeDictionaryKeyCallBacks, &kCFTypeDictionaryValueCallBacks);
+	CFDictionarySetValue(query, kSecClass, kSecClassGenericPassword);
+	CFDictionarySetValue(query, kSecAttrService, serviceRef);
+	CFDictionarySetValue(query, kSecAttrAccount, accountRef);
+	CFRelease(serviceRef);
+	CFRelease(accountRef);
+	return query;
+}
+
+// Stores the data as the generic password of the given service and account,
+// replacing the one that's there, if any
+static OSStatus storeGenericPassword(const char *service, const char *account, const void *data, CFIndex length) {
+	CFMutableDictionaryRef query = genericPasswordQuery(service, account);
+	CFDataRef dataRef = CFDataCreate(kCFAllocatorDefault, data, length);
+	CFMutableDictionaryRef attributes = CFDictionaryCreateMutable(kCFAllocatorDefault, 0,
+		&kCFTypeDictionaryKeyCallBacks, &kCFTypeDictionaryValueCallBacks);
+	CFDictionarySetValue(attributes, kSecValueData, dataRef);
+	OSStatus status = SecItemUpdate(query, attributes);
+	if (status == errSecItemNotFound) {
+		CFDictionarySetValue(query, kSecValueData, dataRef);
+		status = SecItemAdd(query, NULL);
+	}
+	CFRelease(attributes);
+	CFRelease(dataRef);
+	CFRelease(query);
+	return status;
+}
+
+static CFDataRef copyGenericPassword(const char *service, const char *account, OSStatus *status) {
+	CFMutableDictionaryRef query = genericPasswordQuery(service, account);
+	CFDictionarySetValue(query, kSecReturnData, kCFBooleanTrue);
+	CFDictionarySetValue(query, kSecMatchLimit, kSecMatchLimitOne);
+	CFTypeRef result = NULL;
+	*status = SecItemCopyMatching(query, &result);
+	CFRelease(query);
+	return (CFDataRef)result;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// Reads the secret stored under the given key, as a generic password in
+// the login keychain
+func readSecret(key string) ([]byte, error) {
+	service := C.CString(secretStoreService)
+	defer C.free(unsafe.Pointer(service))
+	account := C.CString(key)
+	defer C.free(unsafe.Pointer(account))
+
+	var status C.OSStatus
+	data := C.copyGenericPassword(service, account, &status)
+	if status == C.errSecItemNotFound {
+		return nil, errSecretNotFound
+	}
+	if status != C.errSecSuccess {
+		return nil, fmt.Errorf("unable to read from the keychain (OSStatus %d)", int(status))
+	}
+	defer C.CFRelease(C.CFTypeRef(data))
+	return C.GoBytes(unsafe.Pointer(C.CFDataGetBytePtr(data)), C.int(C.CFDataGetLength(data))), nil
+}
+
+// Stores the secret under the given key, as a generic password in the
+// login keychain
+func writeSecret(key string, secret []byte) error {
+	if len(secret) == 0 {
+		return fmt.Errorf("unable to store an empty secret")
+	}
+	service := C.CString(secretStoreService)
+	defer C.free(unsafe.Pointer(service))
+	account := C.CString(key)
+	defer C.free(unsafe.Pointer(account))
+
+	if status := C.storeGenericPassword(service, account, unsafe.Pointer(&secret[0]), C.CFIndex(len(secret))); status != C.errSecSuccess {
+		return fmt.Errorf("unable to write to the keychain (OSStatus %d)", int(status))
+	}
+	return nil
+}
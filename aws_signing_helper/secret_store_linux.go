@@ -0,0 +1,40 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Reads the secret stored under the given key in the Secret Service (such
+// as GNOME Keyring or KWallet), through libsecret's secret-tool. secret-tool
+// exits with 1 either way, but only explains failures, so a lookup that
+// fails without saying why didn't find the secret.
+func readSecret(key string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", "lookup", "service", secretStoreService, "key", key)
+	cmd.Stderr = &stderr
+	secret, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 && strings.TrimSpace(stderr.String()) == "" {
+		return nil, errSecretNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read from the Secret Service: %w %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return secret, nil
+}
+
+// Stores the secret under the given key in the Secret Service, through
+// libsecret's secret-tool. The secret is passed on its standard input,
+// rather than as an argument, which other processes could see.
+func writeSecret(key string, secret []byte) error {
+	cmd := exec.Command("secret-tool", "store", "--label", "AWS credentials ("+secretStoreService+")", "service", secretStoreService, "key", key)
+	cmd.Stdin = bytes.NewReader(secret)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("unable to write to the Secret Service: %w %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package aws_signing_helper
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Puts a secret-tool on the PATH that runs the given shell script
+func fakeSecretTool(t *testing.T, script string) string {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "secret-tool"), []byte("#!/bin/sh\n"+script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+	return dir
+}
+
+func TestReadSecretNotFound(t *testing.T) {
+	fakeSecretTool(t, "exit 1\n")
+	if _, err := readSecret("missing"); !errors.Is(err, errSecretNotFound) {
+		t.Log("a missing secret wasn't reported as such:", err)
+		t.Fail()
+	}
+
+	fakeSecretTool(t, "echo 'Cannot autolaunch D-Bus without X11 $DISPLAY' >&2\nexit 1\n")
+	if _, err := readSecret("missing"); err == nil || errors.Is(err, errSecretNotFound) {
+		t.Log("a failing Secret Service was reported as a missing secret:", err)
+		t.Fail()
+	}
+}
+
+func TestKeychainCacheKeyIsNotReplaced(t *testing.T) {
+	// The Secret Service fails (as a locked one does), so the key that it
+	// holds isn't replaced with a new one
+	dir := fakeSecretTool(t, `if [ "$1" = store ]; then : > "${0%/*}/stored"; exit 0; fi
+echo 'Cannot unlock the collection' >&2
+exit 1
+`)
+	if _, err := keychainCacheKey(filepath.Join(t.TempDir(), "key.lock")); err == nil {
+		t.Log("a key that couldn't be read was returned")
+		t.Fail()
+	}
+	if _, err := os.Stat(filepath.Join(dir, "stored")); err == nil {
+		t.Log("a key that couldn't be read was replaced")
+		t.Fail()
+	}
+}
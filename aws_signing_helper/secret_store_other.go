@@ -0,0 +1,15 @@
+//go:build !darwin && !windows && !linux
+
+package aws_signing_helper
+
+import "errors"
+
+var errSecretStoreUnsupported = errors.New("the keychain cache backend is only supported on macOS, Windows, and Linux")
+
+func readSecret(key string) ([]byte, error) {
+	return nil, errSecretStoreUnsupported
+}
+
+func writeSecret(key string, secret []byte) error {
+	return errSecretStoreUnsupported
+}
@@ -0,0 +1,92 @@
+package aws_signing_helper
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	advapi32       = windows.NewLazySystemDLL("advapi32.dll")
+	procCredReadW  = advapi32.NewProc("CredReadW")
+	procCredWriteW = advapi32.NewProc("CredWriteW")
+	procCredFree   = advapi32.NewProc("CredFree")
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+	// CRED_MAX_CREDENTIAL_BLOB_SIZE
+	credMaxCredentialBlobSize = 5 * 512
+)
+
+// CREDENTIALW
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        windows.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// Reads the secret stored under the given key, as generic credentials in
+// the Credential Manager (which protects them with DPAPI)
+func readSecret(key string) ([]byte, error) {
+	return readSecretParts(key, credMaxCredentialBlobSize, readCredential)
+}
+
+// Stores the secret under the given key, as generic credentials in the
+// Credential Manager, which keeps them for the current user on this machine.
+// A credential holds at most 2560 bytes, so larger secrets (such as cached
+// credentials with a long session token) are split across several.
+func writeSecret(key string, secret []byte) error {
+	return writeSecretParts(key, secret, credMaxCredentialBlobSize, writeCredential)
+}
+
+func readCredential(name string) ([]byte, error) {
+	targetName, err := windows.UTF16PtrFromString(secretStoreService + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	var cred *credential
+	if ret, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(targetName)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred))); ret == 0 {
+		if err == windows.ERROR_NOT_FOUND {
+			return nil, errSecretNotFound
+		}
+		return nil, err
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+	return append([]byte(nil), unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)...), nil
+}
+
+func writeCredential(name string, secret []byte) error {
+	targetName, err := windows.UTF16PtrFromString(secretStoreService + "/" + name)
+	if err != nil {
+		return err
+	}
+	userName, err := windows.UTF16PtrFromString(secretStoreService)
+	if err != nil {
+		return err
+	}
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         targetName,
+		CredentialBlobSize: uint32(len(secret)),
+		Persist:            credPersistLocalMachine,
+		UserName:           userName,
+	}
+	if len(secret) != 0 {
+		cred.CredentialBlob = &secret[0]
+	}
+	if ret, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0); ret == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Payload that the self-test signs, shaped like a string to sign
+const selfTestPayload = "AWS4-X509-SELF-TEST\n20060102T150405Z\n20060102/us-east-1/rolesanywhere/aws4_request\n" +
+	"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// Outcome of one of the checks that SelfTest and Validate perform
+type CheckResult struct {
+	// Description of the check
+	Check string
+	// Why the check failed, or nil if it passed
+	Err error
+}
+
+// Checks, without contacting IAM Roles Anywhere, that the certificate and
+// private key selected by the options can be used: that they can be loaded
+// (from any key source), that the certificate is currently valid, that the
+// key matches the certificate, that a payload signed with the key (as
+// requests are, according to the signing options) verifies with the
+// certificate's public key, and that the intermediate certificates, if any,
+// lead from the certificate. Checks that depend on an earlier one that
+// failed are skipped.
+func SelfTest(opts *CredentialsOpts) []CheckResult {
+	return selfTest(opts, nil)
+}
+
+// Performs the checks of SelfTest and, if trust anchors are provided, also
+// checks that the certificate chains up to one of them
+func selfTest(opts *CredentialsOpts, trustAnchors []*x509.Certificate) []CheckResult {
+	var results []CheckResult
+	check := func(description string, err error) bool {
+		results = append(results, CheckResult{description, err})
+		return err == nil
+	}
+
+	signer, err := GetSigner(opts)
+	if !check("load the certificate and private key", err) {
+		return results
+	}
+	defer signer.Close()
+	certificate, err := signer.Certificate()
+	if err == nil && certificate == nil {
+		err = errors.New("the key source provides no certificate")
+	}
+	if !check("read the certificate", err) {
+		return results
+	}
+	check(fmt.Sprintf("certificate %s (serial number %s) is valid", certificate.Subject, certificate.SerialNumber),
+		checkCertificateValidity(certificate, opts.ExpiryWarningDays, time.Now()))
+
+	err = nil
+	if public := signer.Public(); public != nil && !publicKeysEqual(certificate.PublicKey, public) {
+		err = errors.New("the private key doesn't match the certificate")
+	}
+	check("private key matches the certificate", err)
+
+	digest, err := checkSigningOptions(opts, signer, certificate)
+	if check("signing options are supported", err) {
+		signingAlgorithm, signerOpts, err := requestSigningAlgorithm(signer, opts.SigningAlgorithm, digest)
+		if err == nil {
+			err = selfTestSignature(signer, certificate.PublicKey, signerOpts)
+		}
+		if signingAlgorithm == "" {
+			signingAlgorithm = "request"
+		}
+		check(signingAlgorithm+" signature verifies with the certificate's public key", err)
+	}
+
+	chain, err := signer.CertificateChain()
+	if err == nil && len(chain) > 0 {
+		chain = orderCertificateChain(certificate, chain)
+		if len(chain) == 0 || certificate.CheckSignatureFrom(chain[0]) != nil {
+			err = errors.New("the intermediate certificates don't include the certificate's issuer")
+		}
+	}
+	check("intermediate certificates (if any) lead from the certificate", err)
+
+	if len(trustAnchors) > 0 {
+		roots := x509.NewCertPool()
+		for _, trustAnchor := range trustAnchors {
+			roots.AddCert(trustAnchor)
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range chain {
+			intermediates.AddCert(cert)
+		}
+		_, err = certificate.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		check("certificate chains up to the trust anchor's CA certificate", err)
+	}
+	return results
+}
+
+// Signs the self-test payload with the signer, and verifies the signature
+// with the public key
+func selfTestSignature(signer Signer, publicKey crypto.PublicKey, signerOpts crypto.SignerOpts) error {
+	payload := []byte(selfTestPayload)
+	signingResult, err := signPayload(payload, signer, signerOpts)
+	if err != nil {
+		return err
+	}
+	sig, err := hex.DecodeString(signingResult.Signature)
+	if err != nil {
+		return err
+	}
+	var verified bool
+	switch key := publicKey.(type) {
+	case ed25519.PublicKey:
+		verified = ed25519.Verify(key, payload, sig)
+	case *ecdsa.PublicKey:
+		hash := signerOpts.HashFunc().New()
+		hash.Write(payload)
+		verified = ecdsa.VerifyASN1(key, hash.Sum(nil), sig)
+	case *rsa.PublicKey:
+		hash := signerOpts.HashFunc().New()
+		hash.Write(payload)
+		verified = verifyRSASignature(key, hash.Sum(nil), sig, signerOpts)
+	default:
+		return errors.New("unsupported public key type")
+	}
+	if !verified {
+		return errors.New("the signature doesn't verify, so the private key doesn't match the certificate (or the key source signs incorrectly)")
+	}
+	return nil
+}
+
+// Whether all the checks passed
+func ChecksPassed(results []CheckResult) bool {
+	for _, result := range results {
+		if result.Err != nil {
+			return false
+		}
+	}
+	return true
+}
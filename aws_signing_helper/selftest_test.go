@@ -0,0 +1,56 @@
+package aws_signing_helper
+
+import (
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	fixtures := []struct {
+		name   string
+		opts   CredentialsOpts
+		passed bool
+	}{
+		{"ECDSA key", CredentialsOpts{
+			CertificateId: "../tst/certs/ec-prime256v1-sha256-cert.pem",
+			PrivateKeyId:  "../tst/certs/ec-prime256v1-key.pem",
+		}, true},
+		{"RSA key", CredentialsOpts{
+			CertificateId: "../tst/certs/rsa-2048-sha256-cert.pem",
+			PrivateKeyId:  "../tst/certs/rsa-2048-key.pem",
+		}, true},
+		{"RSASSA-PSS with SHA-384", CredentialsOpts{
+			CertificateId:    "../tst/certs/rsa-2048-sha256-cert.pem",
+			PrivateKeyId:     "../tst/certs/rsa-2048-key.pem",
+			SigningAlgorithm: SigningAlgorithmPSS,
+			Digest:           "SHA384",
+		}, true},
+		{"deterministic ECDSA", CredentialsOpts{
+			CertificateId:    "../tst/certs/ec-prime256v1-sha256-cert.pem",
+			PrivateKeyId:     "../tst/certs/ec-prime256v1-key.pem",
+			SigningAlgorithm: SigningAlgorithmRFC6979,
+		}, true},
+		{"mismatched key", CredentialsOpts{
+			CertificateId: "../tst/certs/ec-prime256v1-sha256-cert.pem",
+			PrivateKeyId:  "../tst/certs/ec-secp384r1-key.pem",
+		}, false},
+		{"deterministic ECDSA with an RSA key", CredentialsOpts{
+			CertificateId:    "../tst/certs/rsa-2048-sha256-cert.pem",
+			PrivateKeyId:     "../tst/certs/rsa-2048-key.pem",
+			SigningAlgorithm: SigningAlgorithmRFC6979,
+		}, false},
+		{"missing certificate", CredentialsOpts{
+			CertificateId: "../tst/certs/nonexistent-cert.pem",
+			PrivateKeyId:  "../tst/certs/ec-prime256v1-key.pem",
+		}, false},
+	}
+	for _, fixture := range fixtures {
+		results := SelfTest(&fixture.opts)
+		if ChecksPassed(results) != fixture.passed {
+			t.Logf("Unexpected self-test outcome for the %s:", fixture.name)
+			for _, result := range results {
+				t.Log(result.Check, result.Err)
+			}
+			t.Fail()
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package aws_signing_helper
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
@@ -10,13 +11,15 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
 )
 
 const DefaultPort = 9911
@@ -24,13 +27,40 @@ const LocalHostAddress = "127.0.0.1"
 
 var RefreshTime = time.Minute * time.Duration(5)
 
+// Credentials served from the local endpoint, in the format of the
+// instance metadata service
 type RefreshableCred struct {
+	Code            string `json:",omitempty"`
+	LastUpdated     time.Time
+	Type            string `json:",omitempty"`
 	AccessKeyId     string
 	SecretAccessKey string
 	Token           string
 	Expiration      time.Time
+
+	// When the last attempt to refresh the credentials failed, if it did
+	refreshFailedAt time.Time
+	// The refresh in flight, if there's one, which other refreshes wait for
+	// rather than each sending CreateSession (and signing with the key)
+	refresh *refreshCall
+	// Guards the credentials, which requests and the background refresh both
+	// update. It's only held to read or replace them, not while they're
+	// being refreshed, and each role's credentials have their own, so that
+	// a slow refresh of one role's doesn't hold up requests for another's.
+	mu sync.Mutex
+}
+
+// A refresh of credentials, whose error is set before done is closed
+type refreshCall struct {
+	done chan struct{}
+	err  error
 }
 
+// How long after a refresh of served credentials fails requests are served
+// the previous ones (while they're valid) without another attempt, which is
+// left to the background refresh
+const staleRetryInterval = time.Minute
+
 type Endpoint struct {
 	PortNum int
 	Server  *http.Server
@@ -52,6 +82,18 @@ const X_FORWARDED_FOR_HEADER = "X-Forwarded-For"
 
 const MAX_TOKENS = 256
 
+// Longest TTL, in seconds, of the session tokens that the local endpoint
+// issues (and the TTL of the ones that are requested without a TTL)
+var MaxTokenTTL = 21600
+
+// Whether requests for credentials have to present a session token (as
+// with IMDSv2), or may also be made without one (as with IMDSv1)
+var TokensRequired = true
+
+// How long the local endpoint waits, once it's been told to stop, for the
+// requests that it's serving to complete
+var ShutdownGracePeriod = 10 * time.Second
+
 var mutex sync.Mutex
 var tokenMap = make(map[string]time.Time)
 
@@ -93,6 +135,9 @@ func InsertToken(token string, expirationTime time.Time) error {
 // Helper function that checks to see whether the token provided in the request is valid
 func CheckValidToken(w http.ResponseWriter, r *http.Request) error {
 	token := r.Header.Get(EC2_METADATA_TOKEN_HEADER)
+	if token == "" && !TokensRequired {
+		return nil
+	}
 	if token == "" {
 		w.WriteHeader(http.StatusUnauthorized)
 		msg := "no token provided"
@@ -120,7 +165,7 @@ func CheckValidToken(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
-func AllIssuesHandlers(cred *RefreshableCred, roleName string, opts *CredentialsOpts) (http.HandlerFunc, http.HandlerFunc, http.HandlerFunc) {
+func AllIssuesHandlers(cred *RefreshableCred, roleName string, opts *CredentialsOpts, signer Signer) (http.HandlerFunc, http.HandlerFunc, http.HandlerFunc) {
 	// Handles PUT requests to /latest/api/token/
 	putTokenHandler := func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "PUT" {
@@ -137,15 +182,15 @@ func AllIssuesHandlers(cred *RefreshableCred, roleName string, opts *Credentials
 		}
 
 		// Obtain the token TTL
-		tokenTTLStr := r.Header.Get(EC2_METADATA_TOKEN_TTL_HEADER)
-		if tokenTTLStr == "" {
-			tokenTTLStr = DEFAULT_TOKEN_TTL_SECONDS
-		}
-		tokenTTL, err := strconv.Atoi(tokenTTLStr)
-		if err != nil || tokenTTL < 1 || tokenTTL > 21600 {
-			w.WriteHeader(http.StatusBadRequest)
-			io.WriteString(w, "invalid token TTL")
-			return
+		tokenTTL := MaxTokenTTL
+		if tokenTTLStr := r.Header.Get(EC2_METADATA_TOKEN_TTL_HEADER); tokenTTLStr != "" {
+			var err error
+			tokenTTL, err = strconv.Atoi(tokenTTLStr)
+			if err != nil || tokenTTL < 1 || tokenTTL > MaxTokenTTL {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, "invalid token TTL")
+				return
+			}
 		}
 
 		// Generate token and insert it into map
@@ -188,55 +233,358 @@ func AllIssuesHandlers(cred *RefreshableCred, roleName string, opts *Credentials
 			return
 		}
 
-		var nextRefreshTime = cred.Expiration.Add(-RefreshTime)
-		if time.Until(nextRefreshTime) < RefreshTime {
-			credentialProcessOutput, _ := GenerateCredentials(opts)
-			cred.AccessKeyId = credentialProcessOutput.AccessKeyId
-			cred.SecretAccessKey = credentialProcessOutput.SecretAccessKey
-			cred.Token = credentialProcessOutput.SessionToken
-			cred.Expiration, _ = time.Parse(time.RFC3339, credentialProcessOutput.Expiration)
-			err := json.NewEncoder(w).Encode(cred)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				io.WriteString(w, "failed to encode credentials")
-				return
-			}
-		} else {
-			err := json.NewEncoder(w).Encode(cred)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				io.WriteString(w, "failed to encode credentials")
-				return
-			}
+		current, err := currentCredentials(cred, opts, signer)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, "unable to obtain credentials")
+			return
+		}
+		err = json.NewEncoder(w).Encode(current)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, "failed to encode credentials")
+			return
 		}
 	}
 
 	return putTokenHandler, getRoleNameHandler, getCredentialsHandler
 }
 
-func Serve(port int, credentialsOptions CredentialsOpts) {
-	var refreshableCred = RefreshableCred{}
+// Returns the credentials to serve, refreshing them first if they're about
+// to expire. Credentials that haven't expired yet keep being served if they
+// can't be refreshed (stale-if-error), and, while they're being refreshed or
+// refreshes keep failing, requests don't each wait for another attempt.
+func currentCredentials(cred *RefreshableCred, opts *CredentialsOpts, signer Signer) (*RefreshableCred, error) {
+	current := cred.snapshot()
+	var nextRefreshTime = current.Expiration.Add(-RefreshTime)
+	refresh := time.Until(nextRefreshTime) < RefreshTime
+	valid := time.Now().Before(current.Expiration)
+	if refresh && valid && (current.refresh != nil || time.Since(current.refreshFailedAt) < staleRetryInterval) {
+		countStaleCredentialsServed()
+		return current, nil
+	}
+	countCacheLookup(!refresh)
+	if !refresh {
+		return current, nil
+	}
+	err := refreshCredentials(cred, opts, signer)
+	current = cred.snapshot()
+	if err != nil {
+		logRefreshFailure(cred, err)
+		if !time.Now().Before(current.Expiration) {
+			return nil, err
+		}
+		countStaleCredentialsServed()
+	}
+	return current, nil
+}
+
+// Returns a copy of the credentials, which can be served without holding
+// the lock on them
+func (cred *RefreshableCred) snapshot() *RefreshableCred {
+	cred.mu.Lock()
+	defer cred.mu.Unlock()
+	return &RefreshableCred{
+		Code:            cred.Code,
+		LastUpdated:     cred.LastUpdated,
+		Type:            cred.Type,
+		AccessKeyId:     cred.AccessKeyId,
+		SecretAccessKey: cred.SecretAccessKey,
+		Token:           cred.Token,
+		Expiration:      cred.Expiration,
+		refreshFailedAt: cred.refreshFailedAt,
+		refresh:         cred.refresh,
+	}
+}
+
+// Replaces the credentials with new ones from CreateSession, leaving them
+// unchanged if that fails (or the circuit breaker is open). The lock on the
+// credentials isn't held while waiting for CreateSession, only to replace
+// them, so the previous ones keep being served meanwhile. If a refresh is
+// already in flight, this waits for it, and returns its result, so that
+// concurrent requests for credentials that have expired send CreateSession
+// once between them.
+func refreshCredentials(cred *RefreshableCred, opts *CredentialsOpts, signer Signer) error {
+	cred.mu.Lock()
+	if call := cred.refresh; call != nil {
+		cred.mu.Unlock()
+		<-call.done
+		return call.err
+	}
+	call := &refreshCall{done: make(chan struct{})}
+	cred.refresh = call
+	cred.mu.Unlock()
+
+	credentialProcessOutput, err := generateCredentialsWithBreaker(opts, signer)
+	countRefresh(err)
+	call.err = cred.update(credentialProcessOutput, err)
+	close(call.done)
+	return call.err
+}
+
+// Replaces the credentials with the ones that a refresh obtained, unless it
+// failed, and ends the refresh
+func (cred *RefreshableCred) update(credentialProcessOutput CredentialProcessOutput, err error) error {
+	var expiration time.Time
+	if err == nil {
+		expiration, err = time.Parse(time.RFC3339, credentialProcessOutput.Expiration)
+	}
+
+	cred.mu.Lock()
+	defer cred.mu.Unlock()
+	cred.refresh = nil
+	if err != nil {
+		cred.refreshFailedAt = time.Now()
+		return err
+	}
+	cred.Code = "Success"
+	cred.LastUpdated = time.Now().UTC().Truncate(time.Second)
+	cred.Type = "AWS-HMAC"
+	cred.AccessKeyId = credentialProcessOutput.AccessKeyId
+	cred.SecretAccessKey = credentialProcessOutput.SecretAccessKey
+	cred.Token = credentialProcessOutput.SessionToken
+	cred.Expiration = expiration
+	cred.refreshFailedAt = time.Time{}
+	return nil
+}
+
+// Waits for the refresh in flight, if there's one, to complete
+func (cred *RefreshableCred) waitForRefresh() {
+	cred.mu.Lock()
+	call := cred.refresh
+	cred.mu.Unlock()
+	if call != nil {
+		<-call.done
+	}
+}
+
+// Logs that the credentials couldn't be refreshed, and, if they're still
+// valid, that they keep being served meanwhile
+func logRefreshFailure(cred *RefreshableCred, err error) {
+	expiration := cred.snapshot().Expiration
+	if !time.Now().Before(expiration) {
+		log.Println("unable to refresh credentials:", err)
+		return
+	}
+	kind := "error"
+	if isTransientError(err) {
+		kind = "transient error"
+	}
+	log.Printf("unable to refresh credentials (%s), so the previous ones, which expire at %s, keep being served: %v", kind, expiration.Format(time.RFC3339), err)
+}
 
-	roleArn, err := arn.Parse(credentialsOptions.RoleArn)
+// Refreshes the credentials in the background before they're about to
+// expire, so that requests for them don't have to wait for CreateSession
+func refreshCredentialsPeriodically(cred *RefreshableCred, opts *CredentialsOpts, signer Signer) {
+	for {
+		current := cred.snapshot()
+		nextRefreshTime := scheduleRefresh(current.LastUpdated, current.Expiration, 2*RefreshTime)
+		// Credentials that expire too soon to be refreshed ahead of time are
+		// still not refreshed more often than once a minute
+		if wait := time.Until(nextRefreshTime); wait > time.Minute {
+			time.Sleep(wait)
+		} else {
+			time.Sleep(time.Minute)
+		}
+
+		// Failed refreshes are retried a minute later, by the wait above
+		if err := refreshCredentials(cred, opts, signer); err != nil {
+			logRefreshFailure(cred, err)
+		}
+	}
+}
+
+func Serve(port int, credentialsOptions CredentialsOpts, additionalRoles ...CredentialsOpts) {
+	endpoint, signer := newMetadataEndpoint(port, credentialsOptions, additionalRoles)
+	defer signer.Close()
+
+	// Start the credentials endpoint, on the socket that systemd passed, if
+	// the helper was socket-activated
+	listener, err := systemdListener()
 	if err != nil {
-		log.Println("invalid role ARN")
+		log.Println("unable to use the socket passed by systemd:", err)
 		syscall.Exit(1)
 	}
+	if listener != nil {
+		log.Println("Local server started on the socket passed by systemd:", listener.Addr())
+	} else {
+		listener, err = net.Listen("tcp", fmt.Sprintf("%s:%d", LocalHostAddress, endpoint.PortNum))
+		if err != nil {
+			log.Println("failed to create listener")
+			syscall.Exit(1)
+		}
+		endpoint.PortNum = listener.Addr().(*net.TCPAddr).Port
+		log.Println("Local server started on port:", endpoint.PortNum)
+		log.Println("Make it available to the sdk by running:")
+		log.Printf("export AWS_EC2_METADATA_SERVICE_ENDPOINT=http://%s:%d/", LocalHostAddress, endpoint.PortNum)
+	}
+	notifySystemdReady()
+	if err := serveUntilTerminated(endpoint.Server, listener); err != nil {
+		log.Println("Httpserver: ListenAndServe() error")
+		syscall.Exit(1)
+	}
+}
+
+// Serves the same endpoint as Serve, on a Unix domain socket rather than a
+// TCP port, so that access to it can be restricted by the socket's
+// permissions (and those of the directory that holds it)
+func ServeUnixSocket(socketPath string, socketMode os.FileMode, credentialsOptions CredentialsOpts, additionalRoles ...CredentialsOpts) {
+	endpoint, signer := newMetadataEndpoint(0, credentialsOptions, additionalRoles)
+	defer signer.Close()
+
+	listener, err := listenUnix(socketPath, socketMode)
+	if err != nil {
+		log.Println("failed to create listener:", err)
+		syscall.Exit(1)
+	}
+	defer listener.Close()
+	log.Println("Local server started on socket:", socketPath)
+	notifySystemdReady()
+	if err := serveUntilTerminated(endpoint.Server, listener); err != nil {
+		log.Println("Httpserver: Serve() error")
+		syscall.Exit(1)
+	}
+}
 
-	credentialProcessOutput, _ := GenerateCredentials(&credentialsOptions)
-	refreshableCred.AccessKeyId = credentialProcessOutput.AccessKeyId
-	refreshableCred.SecretAccessKey = credentialProcessOutput.SecretAccessKey
-	refreshableCred.Token = credentialProcessOutput.SessionToken
-	refreshableCred.Expiration, _ = time.Parse(time.RFC3339, credentialProcessOutput.Expiration)
-	endpoint := &Endpoint{PortNum: port, TmpCred: refreshableCred}
-	endpoint.Server = &http.Server{}
-	roleResourceParts := strings.Split(roleArn.Resource, "/")
-	roleName := roleResourceParts[len(roleResourceParts)-1] // Find role name without path
-	putTokenHandler, getRoleNameHandler, getCredentialsHandler := AllIssuesHandlers(&endpoint.TmpCred, roleName, &credentialsOptions)
+// Serves the same endpoint as Serve, on a Windows named pipe rather than a
+// TCP port, with access to it controlled by the given security descriptor
+func ServeNamedPipe(pipePath string, securityDescriptor string, credentialsOptions CredentialsOpts, additionalRoles ...CredentialsOpts) {
+	endpoint, signer := newMetadataEndpoint(0, credentialsOptions, additionalRoles)
+	defer signer.Close()
 
-	http.HandleFunc(TOKEN_RESOURCE_PATH, putTokenHandler)
-	http.HandleFunc(SECURITY_CREDENTIALS_RESOURCE_PATH, getRoleNameHandler)
-	http.HandleFunc(SECURITY_CREDENTIALS_RESOURCE_PATH+roleName, getCredentialsHandler)
+	listener, err := listenPipe(pipePath, securityDescriptor)
+	if err != nil {
+		log.Println("failed to create listener:", err)
+		syscall.Exit(1)
+	}
+	defer listener.Close()
+	log.Println("Local server started on named pipe:", pipePath)
+	notifySystemdReady()
+	if err := serveUntilTerminated(endpoint.Server, listener); err != nil {
+		log.Println("Httpserver: Serve() error")
+		syscall.Exit(1)
+	}
+}
+
+// Serves requests on the listener until the process receives SIGTERM (or
+// SIGINT), and then stops accepting new ones, and waits for up to
+// ShutdownGracePeriod for the ones being served (which may be waiting for
+// credentials to be refreshed) to complete
+func serveUntilTerminated(server *http.Server, listener net.Listener) error {
+	terminated := make(chan os.Signal, 1)
+	signal.Notify(terminated, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(terminated)
+	return serveUntil(server, listener, terminated)
+}
+
+func serveUntil(server *http.Server, listener net.Listener, stop <-chan os.Signal) error {
+	shutdownErr := make(chan error, 1)
+	go func() {
+		sig := <-stop
+		log.Printf("received %s, waiting for up to %s for requests being served to complete", sig, ShutdownGracePeriod)
+		ctx, cancel := context.WithTimeout(context.Background(), ShutdownGracePeriod)
+		defer cancel()
+		shutdownErr <- server.Shutdown(ctx)
+	}()
+	if err := server.Serve(listener); err != http.ErrServerClosed {
+		return err
+	}
+	if err := <-shutdownErr; err != nil {
+		log.Println("stopped before all the requests being served completed:", err)
+	}
+	return nil
+}
+
+// Listens on a Unix domain socket at the given path, replacing a socket left
+// behind by a previous run, and setting the socket's permissions, if any
+// are given
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 {
+		if err = os.Chmod(path, mode); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+	return listener, nil
+}
+
+// Obtains the first set of credentials for each role (exiting if they can't
+// be obtained), and creates the endpoint that serves them, along with
+// session tokens. The additional roles are obtained with the same
+// certificate, and differ from the first one in their role, profile, and
+// trust anchor ARNs. The instance metadata paths list (and serve) all the
+// roles, the first one first; the same paths under /<role name> (such as
+// /<role name>/latest/meta-data/iam/security-credentials/) only list (and
+// serve) that role, so that each application can be pointed at its own.
+func newMetadataEndpoint(port int, credentialsOptions CredentialsOpts, additionalRoles []CredentialsOpts) (*Endpoint, Signer) {
+	roles := append([]CredentialsOpts{credentialsOptions}, additionalRoles...)
+	var roleNames []string
+	for _, role := range roles {
+		roleArn, err := arn.Parse(role.RoleArn)
+		if err != nil {
+			log.Println("invalid role ARN:", role.RoleArn)
+			syscall.Exit(1)
+		}
+		roleResourceParts := strings.Split(roleArn.Resource, "/")
+		roleName := roleResourceParts[len(roleResourceParts)-1] // Find role name without path
+		for _, other := range roleNames {
+			if other == roleName {
+				log.Println("more than one role is named", roleName)
+				syscall.Exit(1)
+			}
+		}
+		roleNames = append(roleNames, roleName)
+	}
+
+	signer, err := GetSigner(&roles[0])
+	if err != nil {
+		log.Println(err)
+		syscall.Exit(1)
+	}
+	watchSigner(signer)
+
+	endpoint := &Endpoint{PortNum: port}
+	mux := http.NewServeMux()
+	endpoint.Server = &http.Server{Handler: mux}
+	var creds []*RefreshableCred
+	var credsOpts []*CredentialsOpts
+	for i := range roles {
+		var cred *RefreshableCred
+		if i == 0 {
+			cred = &endpoint.TmpCred
+		} else {
+			cred = &RefreshableCred{}
+		}
+		creds = append(creds, cred)
+		credsOpts = append(credsOpts, &roles[i])
+		if err = refreshCredentials(cred, &roles[i], signer); err != nil {
+			log.Println(err)
+			syscall.Exit(1)
+		}
+		putTokenHandler, getRoleNameHandler, getCredentialsHandler := AllIssuesHandlers(cred, roleNames[i], &roles[i], signer)
+		if i == 0 {
+			mux.HandleFunc(TOKEN_RESOURCE_PATH, putTokenHandler)
+		}
+		mux.HandleFunc(SECURITY_CREDENTIALS_RESOURCE_PATH+roleNames[i], getCredentialsHandler)
+		prefix := "/" + roleNames[i]
+		mux.HandleFunc(prefix+TOKEN_RESOURCE_PATH, putTokenHandler)
+		mux.HandleFunc(prefix+SECURITY_CREDENTIALS_RESOURCE_PATH, getRoleNameHandler)
+		mux.HandleFunc(prefix+SECURITY_CREDENTIALS_RESOURCE_PATH+roleNames[i], getCredentialsHandler)
+		go refreshCredentialsPeriodically(cred, &roles[i], signer)
+	}
+	// The handler that lists the role names is the same as the one for a
+	// single role, listing all of them, one per line
+	_, getRoleNamesHandler, _ := AllIssuesHandlers(&endpoint.TmpCred, strings.Join(roleNames, "\n"), &roles[0], signer)
+	mux.HandleFunc(SECURITY_CREDENTIALS_RESOURCE_PATH, getRoleNamesHandler)
+	registerMonitoringHandlers(mux, signer, creds)
+	reloadCredentialsOnHangup(signer, creds, credsOpts)
 
 	// Background thread that cleans up expired tokens
 	ticker := time.NewTicker(5 * time.Second)
@@ -253,19 +601,5 @@ func Serve(port int, credentialsOptions CredentialsOpts) {
 			mutex.Unlock()
 		}
 	}()
-
-	// Start the credentials endpoint
-	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", LocalHostAddress, endpoint.PortNum))
-	if err != nil {
-		log.Println("failed to create listener")
-		syscall.Exit(1)
-	}
-	endpoint.PortNum = listener.Addr().(*net.TCPAddr).Port
-	log.Println("Local server started on port:", endpoint.PortNum)
-	log.Println("Make it available to the sdk by running:")
-	log.Printf("export AWS_EC2_METADATA_SERVICE_ENDPOINT=http://%s:%d/", LocalHostAddress, endpoint.PortNum)
-	if err := endpoint.Server.Serve(listener); err != nil {
-		log.Println("Httpserver: ListenAndServe() error")
-		syscall.Exit(1)
-	}
+	return endpoint, signer
 }
@@ -0,0 +1,116 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/aws/rolesanywhere-credential-helper/aws_signing_helper/remotesigner"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Serves the RemoteSigner gRPC service for a signer, so that the private
+// key can be kept apart from the workloads that use it (in particular,
+// within a Nitro Enclave, with the parent instance reaching it over vsock)
+type remoteSignerServer struct {
+	remotesigner.UnimplementedRemoteSignerServer
+	// Signers aren't all safe for concurrent use
+	mutex  sync.Mutex
+	signer Signer
+}
+
+func (server *remoteSignerServer) Sign(ctx context.Context, request *remotesigner.SignRequest) (*remotesigner.SignResponse, error) {
+	var hash crypto.Hash
+	for supportedHash, digest := range remoteSignerDigests {
+		if digest == request.Algorithm {
+			hash = supportedHash
+		}
+	}
+	if hash == 0 {
+		return nil, status.Error(codes.InvalidArgument, "unsupported digest")
+	}
+	if len(request.Digest) != hash.Size() {
+		return nil, status.Error(codes.InvalidArgument, "invalid digest length")
+	}
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	// The signer may reload its certificate (and key) when it's asked for it
+	if _, err := server.signer.Certificate(); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	sig, err := server.signer.Sign(rand.Reader, request.Digest, hash)
+	if err != nil {
+		log.Println("signing failed:", err)
+		return nil, status.Error(codes.Internal, "signing failed")
+	}
+	return &remotesigner.SignResponse{Signature: sig}, nil
+}
+
+func (server *remoteSignerServer) GetCertificate(ctx context.Context, request *remotesigner.GetCertificateRequest) (*remotesigner.GetCertificateResponse, error) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	cert, err := server.signer.Certificate()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &remotesigner.GetCertificateResponse{Certificate: cert.Raw}, nil
+}
+
+func (server *remoteSignerServer) GetChain(ctx context.Context, request *remotesigner.GetChainRequest) (*remotesigner.GetChainResponse, error) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	chain, err := server.signer.CertificateChain()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	response := &remotesigner.GetChainResponse{}
+	for _, cert := range chain {
+		response.Certificates = append(response.Certificates, cert.Raw)
+	}
+	return response, nil
+}
+
+// Listens on the given address: "vsock://:<port>" for connections from any
+// CID (such as the parent instance of a Nitro Enclave), or
+// "unix:///path/to/socket"
+func listenSigner(listenAddr string) (net.Listener, error) {
+	if strings.HasPrefix(listenAddr, vsockEndpointPrefix) {
+		addr, err := parseVsockEndpoint(listenAddr)
+		if err != nil {
+			return nil, err
+		}
+		return listenVsock(addr.Port)
+	}
+	if strings.HasPrefix(listenAddr, "unix://") {
+		return listenUnix(strings.TrimPrefix(listenAddr, "unix://"), 0)
+	}
+	return nil, errors.New("the signer can only listen on vsock://:<port> or unix:///path/to/socket")
+}
+
+// Serves the signer described by the credentials options to remote signer
+// clients (see GetRemoteSigner), until the listener fails
+func ServeSigner(listenAddr string, credentialsOptions CredentialsOpts) error {
+	signer, err := GetSigner(&credentialsOptions)
+	if err != nil {
+		return err
+	}
+	defer signer.Close()
+	watchSigner(signer)
+	listener, err := listenSigner(listenAddr)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	server := grpc.NewServer()
+	remotesigner.RegisterRemoteSignerServer(server, &remoteSignerServer{signer: signer})
+	log.Println("Signer listening on", listenAddr)
+	return server.Serve(listener)
+}
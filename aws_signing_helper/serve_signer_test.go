@@ -0,0 +1,99 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/rolesanywhere-credential-helper/aws_signing_helper/remotesigner"
+	"google.golang.org/grpc"
+)
+
+// Serves a file system signer on the given listener, as serve-signer does
+func startTestSignerServer(t *testing.T, listener net.Listener) {
+	signer, err := GetFileSystemSigner("../tst/certs/ec-prime256v1-key.pem", "../tst/certs/ec-prime256v1-sha256-cert.pem", "../tst/certs/cert-bundle.pem", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	remotesigner.RegisterRemoteSignerServer(server, &remoteSignerServer{signer: signer})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+}
+
+func checkServedSigner(t *testing.T, endpoint string) {
+	signer, err := GetRemoteSigner(endpoint, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+	chain, _ := signer.CertificateChain()
+	if len(chain) == 0 {
+		t.Log("Expected the certificate chain to be served")
+		t.Fail()
+	}
+
+	msg := []byte("test message")
+	signingResult, err := Sign(msg, SigningOpts{signer, crypto.SHA256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, _ := hex.DecodeString(signingResult.Signature)
+	digest := sha256.Sum256(msg)
+	cert, _ := signer.Certificate()
+	if !ecdsa.VerifyASN1(cert.PublicKey.(*ecdsa.PublicKey), digest[:], sig) {
+		t.Log("Failed to verify the signature from the served signer")
+		t.Fail()
+	}
+}
+
+func TestServeSignerUnixSocket(t *testing.T) {
+	endpoint := "unix://" + filepath.Join(t.TempDir(), "signer.sock")
+	listener, err := listenSigner(endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	startTestSignerServer(t, listener)
+	checkServedSigner(t, endpoint)
+}
+
+func TestServeSignerVsock(t *testing.T) {
+	// Requires the vsock_loopback module, through which the local CID (1)
+	// reaches listeners on the host itself
+	listener, err := listenSigner("vsock://:5005")
+	if err != nil {
+		t.Skip("vsock isn't available:", err)
+	}
+	conn, err := dialVsock(vsockAddr{1, 5005})
+	if err != nil {
+		listener.Close()
+		t.Skip("vsock loopback isn't available:", err)
+	}
+	conn.Close()
+	startTestSignerServer(t, listener)
+	checkServedSigner(t, "vsock://1:5005")
+}
+
+func TestParseVsockEndpoint(t *testing.T) {
+	fixtures := []struct {
+		endpoint string
+		addr     vsockAddr
+		valid    bool
+	}{
+		{"vsock://16:5000", vsockAddr{16, 5000}, true},
+		{"vsock://:5000", vsockAddr{0, 5000}, true},
+		{"vsock://16", vsockAddr{}, false},
+		{"vsock://enclave:5000", vsockAddr{}, false},
+	}
+	for _, fixture := range fixtures {
+		addr, err := parseVsockEndpoint(fixture.endpoint)
+		if (err == nil) != fixture.valid || addr != fixture.addr {
+			t.Logf("Unexpected result for %s: %v, %v", fixture.endpoint, addr, err)
+			t.Fail()
+		}
+	}
+}
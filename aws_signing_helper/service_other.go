@@ -0,0 +1,21 @@
+//go:build !windows && !darwin
+
+package aws_signing_helper
+
+import "errors"
+
+const DefaultServiceName = "AWSSigningHelper"
+
+var errServicesUnsupported = errors.New("services are only supported on Windows and macOS (use systemd, or another supervisor, elsewhere)")
+
+func InstallService(name string, description string, args []string) error {
+	return errServicesUnsupported
+}
+
+func RemoveService(name string) error {
+	return errServicesUnsupported
+}
+
+func RunService(name string, run func()) error {
+	return errServicesUnsupported
+}
@@ -0,0 +1,52 @@
+package aws_signing_helper
+
+import (
+	"crypto/x509"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Environment variable that holds the role session name, if it isn't
+// passed on the command line (the same one as the AWS SDKs')
+const RoleSessionNameEnvVarName = "AWS_ROLE_SESSION_NAME"
+
+// Longest role session name that IAM Roles Anywhere and STS accept
+const maxRoleSessionNameLength = 64
+
+// Matches the characters that can't appear in role session names
+var invalidRoleSessionNameCharacters = regexp.MustCompile(`[^\w+=,.@-]`)
+
+// Returns the role session name: the one in the options, with the
+// references to attributes of the certificate in it replaced, or else one
+// derived from the certificate's common name and serial number. Also
+// returns whether the name was chosen explicitly.
+func roleSessionName(opts *CredentialsOpts, certificate *x509.Certificate) (string, bool, error) {
+	if opts.RoleSessionName == "" {
+		return defaultRoleSessionName(certificate), false, nil
+	}
+	name, err := expandCertificateTemplate(opts.RoleSessionName, certificate)
+	if err != nil {
+		return "", true, fmt.Errorf("invalid role session name: %w", err)
+	}
+	if len(name) < 2 || len(name) > maxRoleSessionNameLength || invalidRoleSessionNameCharacters.MatchString(name) {
+		return "", true, fmt.Errorf("invalid role session name %s (expected 2 to %d letters, digits, and characters among +=,.@_-)", name, maxRoleSessionNameLength)
+	}
+	return name, true, nil
+}
+
+// Returns a role session name that identifies the certificate, so that the
+// sessions of different hosts can be told apart in CloudTrail: its common
+// name (with the characters that can't appear in role session names
+// replaced, and shortened if need be), followed by its serial number
+func defaultRoleSessionName(certificate *x509.Certificate) string {
+	serial := fmt.Sprintf("%x", certificate.SerialNumber)
+	commonName := invalidRoleSessionNameCharacters.ReplaceAllString(certificate.Subject.CommonName, "-")
+	if commonName == "" {
+		commonName = "serial"
+	}
+	if maxLength := maxRoleSessionNameLength - len(serial) - 1; len(commonName) > maxLength {
+		commonName = commonName[:maxLength]
+	}
+	return strings.Trim(commonName+"-"+serial, "-")
+}
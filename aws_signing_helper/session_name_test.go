@@ -0,0 +1,74 @@
+package aws_signing_helper
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRoleSessionName(t *testing.T) {
+	fixtures := []struct {
+		commonName      string
+		roleSessionName string
+		expected        string
+		explicit        bool
+	}{
+		{"host.example.com", "", "host.example.com-1f", false},
+		{"Example Host (lab)", "", "Example-Host--lab--1f", false},
+		{"", "", "serial-1f", false},
+		{strings.Repeat("a", 80), "", strings.Repeat("a", 61) + "-1f", false},
+		{"host.example.com", "ci-${subject.CN}", "ci-host.example.com", true},
+		{"host.example.com", "invalid name", "", true},
+		{"host.example.com", "${san.dns}", "", true},
+	}
+	for _, fixture := range fixtures {
+		certificate := &x509.Certificate{Subject: pkix.Name{CommonName: fixture.commonName}, SerialNumber: big.NewInt(0x1f)}
+		opts := CredentialsOpts{RoleSessionName: fixture.roleSessionName}
+		name, explicit, err := roleSessionName(&opts, certificate)
+		if name != fixture.expected || explicit != fixture.explicit || (err != nil) != (fixture.expected == "") {
+			t.Logf("%s, %s: unexpected result %s, %v, %v", fixture.commonName, fixture.roleSessionName, name, explicit, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestDefaultRoleSessionNameIsOptIn(t *testing.T) {
+	var sessionNames []*string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SessionName *string `json:"sessionName"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		sessionNames = append(sessionNames, body.SessionName)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(mockedCreateSessionResponse))
+	}))
+	defer server.Close()
+
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	// The default name is only sent if asked for, since profiles that don't
+	// accept role session names reject requests that have one
+	for _, sendDefaultName := range []bool{false, true} {
+		credentialsOpts.SendDefaultName = sendDefaultName
+		if _, err := GenerateCredentials(&credentialsOpts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(sessionNames) != 2 || sessionNames[0] != nil || sessionNames[1] == nil || *sessionNames[1] == "" {
+		t.Log("expected the default role session name to be sent only when asked for, got", sessionNames)
+		t.Fail()
+	}
+}
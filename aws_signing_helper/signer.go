@@ -2,8 +2,10 @@ package aws_signing_helper
 
 import (
 	"bytes"
+	"context"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -17,13 +19,12 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"os"
 	"sort"
 	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 )
 
 type SigningOpts struct {
@@ -101,25 +102,98 @@ type CredentialProcessOutput struct {
 	Expiration string `json:"Expiration"`
 }
 
+// Interface that all signing backends have to implement. Since it embeds
+// crypto.Signer, a Signer can be used anywhere a private key is expected.
+type Signer interface {
+	crypto.Signer
+	// Certificate that corresponds to the signing key
+	Certificate() (*x509.Certificate, error)
+	// Intermediate certificates, if any, that should be sent along with
+	// the end-entity certificate
+	CertificateChain() ([]*x509.Certificate, error)
+	// Releases any resources (sessions, handles) held by the signer
+	Close()
+}
+
+// Implemented by signers that can only sign complete messages, rather
+// than digests (such as keys held by an ssh-agent, which hashes the data
+// itself)
+type messageSigner interface {
+	SignMessage(message []byte, hash crypto.Hash) ([]byte, error)
+}
+
+// Implemented by signers that can watch their sources (such as files) for
+// changes, so that long-running modes pick up rotated certificates and keys
+// as soon as they're written
+type watchableSigner interface {
+	watch() error
+}
+
+// Starts watching the signer's sources, if the signer supports it. Failures
+// are only logged, since signers also pick up changes when they're used.
+func watchSigner(signer Signer) {
+	if watchable, ok := signer.(watchableSigner); ok {
+		if err := watchable.watch(); err != nil {
+			log.Println("unable to watch for rotated certificates:", err)
+		}
+	}
+}
+
+// Implemented by signers that can read their certificate and key from their
+// sources again on demand. Returns whether the certificate changed.
+type reloadableSigner interface {
+	reload() bool
+}
+
+// Implemented by signers whose RSA keys can produce RSASSA-PSS signatures,
+// when they're passed *rsa.PSSOptions
+type pssSigner interface {
+	supportsPSS() bool
+}
+
 type RolesAnywhereSigner struct {
 	PrivateKey       crypto.PrivateKey
 	Certificate      x509.Certificate
 	CertificateChain []x509.Certificate
+	// Signature scheme: SigningAlgorithmPKCS1v15 (the default) or
+	// SigningAlgorithmPSS for RSA keys, or SigningAlgorithmRFC6979 for ECDSA
+	// keys
+	SigningAlgorithm string
+	// Digest with which the request is signed (SHA-256, by default)
+	Digest crypto.Hash
+}
+
+// Names of the digests that requests can be signed with, as they appear in
+// the signing algorithm
+var signingDigestNames = map[crypto.Hash]string{
+	crypto.SHA256: "SHA256",
+	crypto.SHA384: "SHA384",
+	crypto.SHA512: "SHA512",
 }
 
+// Signature schemes for RSA keys and, with RFC 6979 (deterministic ECDSA),
+// ECDSA keys
+const (
+	SigningAlgorithmPKCS1v15 = "pkcs1v15"
+	SigningAlgorithmPSS      = "pss"
+	SigningAlgorithmRFC6979  = "rfc6979"
+)
+
 // Define constants used in signing
 const (
-	aws4_x509_rsa_sha256   = "AWS4-X509-RSA-SHA256"
-	aws4_x509_ecdsa_sha256 = "AWS4-X509-ECDSA-SHA256"
-	timeFormat             = "20060102T150405Z"
-	shortTimeFormat        = "20060102"
-	x_amz_date             = "X-Amz-Date"
-	x_amz_x509             = "X-Amz-X509"
-	x_amz_x509_chain       = "X-Amz-X509-Chain"
-	x_amz_content_sha256   = "X-Amz-Content-Sha256"
-	authorization          = "Authorization"
-	host                   = "Host"
-	emptyStringSHA256      = `e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855`
+	aws4_x509_rsa        = "AWS4-X509-RSA"
+	aws4_x509_rsa_pss    = "AWS4-X509-RSA-PSS"
+	aws4_x509_ecdsa      = "AWS4-X509-ECDSA"
+	aws4_x509_ed25519    = "AWS4-X509-ED25519"
+	timeFormat           = "20060102T150405Z"
+	shortTimeFormat      = "20060102"
+	x_amz_date           = "X-Amz-Date"
+	x_amz_x509           = "X-Amz-X509"
+	x_amz_x509_chain     = "X-Amz-X509-Chain"
+	x_amz_content_sha256 = "X-Amz-Content-Sha256"
+	authorization        = "Authorization"
+	host                 = "Host"
+	emptyStringSHA256    = `e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855`
 )
 
 // Headers that aren't included in calculating the signature
@@ -169,67 +243,138 @@ func certificateChainToString(certificateChain []x509.Certificate) string {
 	return x509ChainString.String()
 }
 
-// Create a function that will sign requests, given the signing certificate, optional certificate chain, and the private key
-func CreateSignFunction(privateKey crypto.PrivateKey, certificate x509.Certificate, certificateChain []x509.Certificate) func(*request.Request) {
-	v4x509 := RolesAnywhereSigner{privateKey, certificate, certificateChain}
-	return func(r *request.Request) {
-		v4x509.SignWithCurrTime(r)
-	}
-}
-
-// Sign the request using the current time
-func (v4x509 RolesAnywhereSigner) SignWithCurrTime(req *request.Request) error {
-	// Find the signing algorithm
-	var signingAlgorithm string
-	_, isRsaKey := v4x509.PrivateKey.(rsa.PrivateKey)
-	if isRsaKey {
-		signingAlgorithm = aws4_x509_rsa_sha256
-	}
-	_, isEcKey := v4x509.PrivateKey.(ecdsa.PrivateKey)
-	if isEcKey {
-		signingAlgorithm = aws4_x509_ecdsa_sha256
-	}
-	if signingAlgorithm == "" {
-		log.Println("unsupported algorithm")
-		return errors.New("unsupported algorithm")
-	}
-
-	region := req.ClientInfo.SigningRegion
-	if region == "" {
-		region = aws.StringValue(req.Config.Region)
+// Orders an intermediate certificate bundle into the chain that leads from
+// the end-entity certificate towards the trust anchor, so that bundles
+// don't have to be assembled in order by hand. Each certificate is followed
+// by its issuer, as long as the issuer is in the bundle; certificates that
+// aren't part of the chain (such as cross-signed ones) are kept, after it,
+// in their original order.
+func orderCertificateChain(certificate *x509.Certificate, bundle []*x509.Certificate) []*x509.Certificate {
+	remaining := make([]*x509.Certificate, 0, len(bundle))
+	for _, cert := range bundle {
+		if !cert.Equal(certificate) {
+			remaining = append(remaining, cert)
+		}
 	}
-
-	name := req.ClientInfo.SigningName
-	if name == "" {
-		name = req.ClientInfo.ServiceName
+	var chain []*x509.Certificate
+	current := certificate
+	for {
+		// Self-signed certificates (trust anchors) end the chain
+		if bytes.Equal(current.RawIssuer, current.RawSubject) && current.CheckSignatureFrom(current) == nil {
+			break
+		}
+		issuerIndex := -1
+		for i, cert := range remaining {
+			if bytes.Equal(current.RawIssuer, cert.RawSubject) && current.CheckSignatureFrom(cert) == nil {
+				issuerIndex = i
+				break
+			}
+		}
+		if issuerIndex == -1 {
+			break
+		}
+		current = remaining[issuerIndex]
+		chain = append(chain, current)
+		remaining = append(remaining[:issuerIndex], remaining[issuerIndex+1:]...)
+	}
+	return append(chain, remaining...)
+}
+
+// Signs the request with the certificate's key (SigV4-X509), in place of
+// aws-sdk-go-v2's SigV4 signer, which makes it an HTTPSignerV4 of the IAM
+// Roles Anywhere client. The credentials are ignored, since the certificate
+// takes their place, and the signing time is corrected by the offset of the
+// local clock from the server's, if it's known. The payload hash is that of
+// the body, or, if it's empty, the one in the X-Amz-Content-Sha256 header
+// (or else that of an empty body).
+func (v4x509 RolesAnywhereSigner) SignHTTP(ctx context.Context, credentials aws.Credentials, r *http.Request, payloadHash string, service string, region string, signingTime time.Time, optFns ...func(*v4.SignerOptions)) error {
+	digest := v4x509.Digest
+	if digest == 0 {
+		digest = crypto.SHA256
+	}
+	signingAlgorithm, signerOpts, err := requestSigningAlgorithm(v4x509.PrivateKey, v4x509.SigningAlgorithm, digest)
+	if err != nil {
+		return err
 	}
 
-	signerParams := SignerParams{time.Now(), region, name, signingAlgorithm}
+	signerParams := SignerParams{correctedTime(signingTime), region, service, signingAlgorithm}
 
 	// Set headers that are necessary for signing
-	req.HTTPRequest.Header.Set(host, req.HTTPRequest.URL.Host)
-	req.HTTPRequest.Header.Set(x_amz_date, signerParams.GetFormattedSigningDateTime())
-	req.HTTPRequest.Header.Set(x_amz_x509, certificateToString(v4x509.Certificate))
+	r.Header.Set(host, r.URL.Host)
+	r.Header.Set(x_amz_date, signerParams.GetFormattedSigningDateTime())
+	r.Header.Set(x_amz_x509, certificateToString(v4x509.Certificate))
 	if v4x509.CertificateChain != nil {
-		req.HTTPRequest.Header.Set(x_amz_x509_chain, certificateChainToString(v4x509.CertificateChain))
+		r.Header.Set(x_amz_x509_chain, certificateChainToString(v4x509.CertificateChain))
 	}
 
-	contentSha256 := calculateContentHash(req.HTTPRequest, req.Body)
-	if req.HTTPRequest.Header.Get(x_amz_content_sha256) == "required" {
-		req.HTTPRequest.Header.Set(x_amz_content_sha256, contentSha256)
+	contentSha256 := payloadHash
+	if contentSha256 == "" {
+		contentSha256 = calculateContentHash(r, nil)
+	}
+	if r.Header.Get(x_amz_content_sha256) == "required" {
+		r.Header.Set(x_amz_content_sha256, contentSha256)
 	}
 
-	canonicalRequest, signedHeadersString := createCanonicalRequest(req.HTTPRequest, req.Body, contentSha256)
+	canonicalRequest, signedHeadersString := createCanonicalRequest(r, nil, contentSha256)
 
 	stringToSign := CreateStringToSign(canonicalRequest, signerParams)
 
-	signingResult, _ := Sign([]byte(stringToSign), SigningOpts{v4x509.PrivateKey, crypto.SHA256})
+	signingResult, err := signPayload([]byte(stringToSign), v4x509.PrivateKey, signerOpts)
+	if err != nil {
+		return err
+	}
 
-	req.HTTPRequest.Header.Set(authorization, BuildAuthorizationHeader(req.HTTPRequest, req.Body, signedHeadersString, signingResult.Signature, v4x509.Certificate, signerParams))
-	req.SignedHeaderVals = req.HTTPRequest.Header
+	r.Header.Set(authorization, BuildAuthorizationHeader(r, nil, signedHeadersString, signingResult.Signature, v4x509.Certificate, signerParams))
 	return nil
 }
 
+// Finds the algorithm (such as AWS4-X509-ECDSA-SHA256) with which the
+// private key signs requests, given the signature scheme (--signing-algorithm)
+// and digest, along with the options to pass to signPayload
+func requestSigningAlgorithm(privateKey crypto.PrivateKey, signatureScheme string, digest crypto.Hash) (string, crypto.SignerOpts, error) {
+	digestName, ok := signingDigestNames[digest]
+	if !ok {
+		return "", nil, errors.New("unsupported digest")
+	}
+
+	var signingAlgorithm string
+	_, isRsaKey := privateKey.(rsa.PrivateKey)
+	if isRsaKey {
+		signingAlgorithm = aws4_x509_rsa
+	}
+	_, isEcKey := privateKey.(ecdsa.PrivateKey)
+	if isEcKey {
+		signingAlgorithm = aws4_x509_ecdsa
+	}
+	signer, isSigner := privateKey.(crypto.Signer)
+	if isSigner {
+		switch signer.Public().(type) {
+		case *rsa.PublicKey:
+			signingAlgorithm = aws4_x509_rsa
+		case *ecdsa.PublicKey:
+			signingAlgorithm = aws4_x509_ecdsa
+		case ed25519.PublicKey:
+			signingAlgorithm = aws4_x509_ed25519
+		}
+	}
+	if signingAlgorithm == "" {
+		return "", nil, errors.New("unsupported algorithm")
+	}
+	var signerOpts crypto.SignerOpts = digest
+	if signingAlgorithm == aws4_x509_rsa && signatureScheme == SigningAlgorithmPSS {
+		signingAlgorithm = aws4_x509_rsa_pss
+		signerOpts = pssOptions(digest)
+	}
+	if signingAlgorithm == aws4_x509_ecdsa && signatureScheme == SigningAlgorithmRFC6979 {
+		signerOpts = &deterministicECDSAOptions{digest}
+	}
+	// Ed25519 signatures don't use a separate digest
+	if signingAlgorithm != aws4_x509_ed25519 {
+		signingAlgorithm += "-" + digestName
+	}
+	return signingAlgorithm, signerOpts, nil
+}
+
 // Find the SHA256 hash of the provided request body as a io.ReadSeeker
 func makeSha256Reader(reader io.ReadSeeker) []byte {
 	hash := sha256.New()
@@ -390,8 +535,30 @@ func BuildAuthorizationHeader(request *http.Request, body io.ReadSeeker, signedH
 
 // Sign the provided payload with the specified options.
 func Sign(payload []byte, opts SigningOpts) (SigningResult, error) {
+	return signPayload(payload, opts.PrivateKey, opts.Digest)
+}
+
+// Options with which RSA keys produce RSASSA-PSS signatures, with a salt as
+// long as the digest
+func pssOptions(hash crypto.Hash) *rsa.PSSOptions {
+	return &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash}
+}
+
+// Verifies an RSA signature over the digest, with RSASSA-PSS if the signer
+// options ask for it, or else with PKCS #1 v1.5
+func verifyRSASignature(publicKey *rsa.PublicKey, digest []byte, sig []byte, opts crypto.SignerOpts) bool {
+	if pssOpts, ok := opts.(*rsa.PSSOptions); ok {
+		return rsa.VerifyPSS(publicKey, opts.HashFunc(), digest, sig, pssOpts) == nil
+	}
+	return rsa.VerifyPKCS1v15(publicKey, opts.HashFunc(), digest, sig) == nil
+}
+
+// Signs the payload with the private key. RSA keys produce RSASSA-PSS
+// signatures when signerOpts is an *rsa.PSSOptions, and PKCS #1 v1.5
+// signatures otherwise.
+func signPayload(payload []byte, privateKey crypto.PrivateKey, signerOpts crypto.SignerOpts) (SigningResult, error) {
 	var hash []byte
-	switch opts.Digest {
+	switch signerOpts.HashFunc() {
 	case crypto.SHA256:
 		sum := sha256.Sum256(payload)
 		hash = sum[:]
@@ -405,21 +572,72 @@ func Sign(payload []byte, opts SigningOpts) (SigningResult, error) {
 		log.Println("unsupported digest")
 		return SigningResult{}, errors.New("unsupported digest")
 	}
+	pssOpts, usePSS := signerOpts.(*rsa.PSSOptions)
+	_, useRFC6979 := signerOpts.(*deterministicECDSAOptions)
+
+	ecdsaPrivateKey, ok := privateKey.(ecdsa.PrivateKey)
+	if ok {
+		var sig []byte
+		var err error
+		if useRFC6979 {
+			sig, err = signECDSADeterministic(&ecdsaPrivateKey, signerOpts.HashFunc(), hash[:])
+		} else {
+			sig, err = ecdsa.SignASN1(rand.Reader, &ecdsaPrivateKey, hash[:])
+		}
+		if err == nil {
+			return SigningResult{hex.EncodeToString(sig)}, nil
+		}
+	}
+
+	rsaPrivateKey, ok := privateKey.(rsa.PrivateKey)
+	if ok {
+		var sig []byte
+		var err error
+		if usePSS {
+			sig, err = rsa.SignPSS(rand.Reader, &rsaPrivateKey, signerOpts.HashFunc(), hash[:], pssOpts)
+		} else {
+			sig, err = rsa.SignPKCS1v15(rand.Reader, &rsaPrivateKey, signerOpts.HashFunc(), hash[:])
+		}
+		if err == nil {
+			return SigningResult{hex.EncodeToString(sig)}, nil
+		}
+	}
 
-	ecdsaPrivateKey, ok := opts.PrivateKey.(ecdsa.PrivateKey)
+	// Ed25519 keys sign the message itself, rather than a digest of it
+	if signer, ok := privateKey.(crypto.Signer); ok {
+		if _, ok := signer.Public().(ed25519.PublicKey); ok {
+			sig, err := signer.Sign(rand.Reader, payload, crypto.Hash(0))
+			if err != nil {
+				log.Println(err)
+				return SigningResult{}, err
+			}
+			return SigningResult{hex.EncodeToString(sig)}, nil
+		}
+	}
+
+	msgSigner, ok := privateKey.(messageSigner)
 	if ok {
-		sig, err := ecdsa.SignASN1(rand.Reader, &ecdsaPrivateKey, hash[:])
+		if usePSS {
+			log.Println("RSASSA-PSS signatures aren't supported with this key source")
+			return SigningResult{}, errors.New("RSASSA-PSS signatures aren't supported with this key source")
+		}
+		sig, err := msgSigner.SignMessage(payload, signerOpts.HashFunc())
 		if err == nil {
 			return SigningResult{hex.EncodeToString(sig)}, nil
 		}
+		log.Println(err)
+		return SigningResult{}, err
 	}
 
-	rsaPrivateKey, ok := opts.PrivateKey.(rsa.PrivateKey)
+	// Keys that aren't held in memory (for example, on a hardware token)
+	// sign the digest themselves
+	signer, ok := privateKey.(crypto.Signer)
 	if ok {
-		sig, err := rsa.SignPKCS1v15(rand.Reader, &rsaPrivateKey, opts.Digest, hash[:])
+		sig, err := signer.Sign(rand.Reader, hash[:], signerOpts)
 		if err == nil {
 			return SigningResult{hex.EncodeToString(sig)}, nil
 		}
+		log.Println(err)
 	}
 
 	log.Println("unsupported algorithm")
@@ -435,11 +653,14 @@ func encodeDer(der []byte) (string, error) {
 }
 
 func parseDERFromPEM(pemDataId string, blockType string) (*pem.Block, error) {
-	bytes, err := os.ReadFile(pemDataId)
+	bytes, err := readCredentialFile(pemDataId)
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
+	if !isPEM(bytes) {
+		return decodeDER(bytes, blockType)
+	}
 
 	var block *pem.Block
 	for len(bytes) > 0 {
@@ -454,13 +675,21 @@ func parseDERFromPEM(pemDataId string, blockType string) (*pem.Block, error) {
 	return nil, errors.New("requested block type could not be found")
 }
 
-// Reads certificate bundle data from a file, whose path is provided
+// Reads certificate bundle data from a file, whose path is provided. The
+// file may contain PEM certificates or PKCS#7 bundles, or DER data (either
+// concatenated certificates or a PKCS#7 bundle).
 func ReadCertificateBundleData(certificateBundleId string) ([]*x509.Certificate, error) {
-	bytes, err := os.ReadFile(certificateBundleId)
+	bytes, err := readCredentialFile(certificateBundleId)
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
+	if !isPEM(bytes) {
+		if certs, err := parsePKCS7Certificates(bytes); err == nil {
+			return certs, nil
+		}
+		return x509.ParseCertificates(bytes)
+	}
 
 	var derBytes []byte
 	var block *pem.Block
@@ -469,11 +698,20 @@ func ReadCertificateBundleData(certificateBundleId string) ([]*x509.Certificate,
 		if block == nil {
 			return nil, errors.New("unable to parse PEM data")
 		}
-		if block.Type != "CERTIFICATE" {
+		switch block.Type {
+		case "CERTIFICATE":
+			derBytes = append(derBytes, block.Bytes...)
+		case "PKCS7":
+			certs, err := parsePKCS7Certificates(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			for _, cert := range certs {
+				derBytes = append(derBytes, cert.Raw...)
+			}
+		default:
 			return nil, errors.New("invalid certificate chain")
 		}
-		blockBytes := block.Bytes
-		derBytes = append(derBytes, blockBytes...)
 	}
 
 	return x509.ParseCertificates(derBytes)
@@ -528,11 +766,20 @@ func readPKCS8PrivateKey(privateKeyId string) (crypto.PrivateKey, error) {
 		return *ecPrivateKey, nil
 	}
 
+	ed25519PrivateKey, ok := privateKey.(ed25519.PrivateKey)
+	if ok {
+		return ed25519PrivateKey, nil
+	}
+
 	return nil, errors.New("could not parse PKCS8 private key")
 }
 
 // Load the private key referenced by `privateKeyId`.
 func ReadPrivateKeyData(privateKeyId string) (crypto.PrivateKey, error) {
+	if _, encrypted, err := readPrivateKeyBlock(privateKeyId); err == nil && encrypted {
+		return nil, ErrEncryptedPrivateKey
+	}
+
 	if key, err := readPKCS8PrivateKey(privateKeyId); err == nil {
 		return key, nil
 	}
@@ -548,6 +795,148 @@ func ReadPrivateKeyData(privateKeyId string) (crypto.PrivateKey, error) {
 	return nil, errors.New("unable to parse private key")
 }
 
+// Parses a private key from PEM or DER data, which may be in the PKCS#8,
+// SEC 1 (EC), or PKCS#1 (RSA) format
+func parsePrivateKey(data []byte) (crypto.PrivateKey, error) {
+	ders := [][]byte{data}
+	if isPEM(data) {
+		ders = nil
+		for len(data) > 0 {
+			var block *pem.Block
+			block, data = pem.Decode(data)
+			if block == nil {
+				break
+			}
+			switch block.Type {
+			case "PRIVATE KEY", "EC PRIVATE KEY", "RSA PRIVATE KEY":
+				ders = append(ders, block.Bytes)
+			}
+		}
+	}
+
+	for _, der := range ders {
+		if privateKey, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+			switch key := privateKey.(type) {
+			case *rsa.PrivateKey:
+				return *key, nil
+			case *ecdsa.PrivateKey:
+				return *key, nil
+			case ed25519.PrivateKey:
+				return key, nil
+			}
+		}
+		if privateKey, err := x509.ParseECPrivateKey(der); err == nil {
+			return *privateKey, nil
+		}
+		if privateKey, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+			return *privateKey, nil
+		}
+	}
+	return nil, errors.New("unable to parse private key")
+}
+
+// Load the certificate referenced by `certificateId`.
+func readCertificate(certificateId string) (*x509.Certificate, error) {
+	block, err := parseDERFromPEM(certificateId, "CERTIFICATE")
+	if err != nil {
+		return nil, errors.New("could not parse PEM data")
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		log.Println("could not parse certificate", err)
+		return nil, errors.New("could not parse certificate")
+	}
+	return cert, nil
+}
+
+// Obtain the signer for the key and certificate sources in `opts`.
+func GetSigner(opts *CredentialsOpts) (Signer, error) {
+	if isDirectory(opts.CertificateId) {
+		resolvedOpts, err := resolveCertificateDirectory(*opts)
+		if err != nil {
+			return nil, err
+		}
+		opts = &resolvedOpts
+	}
+	if isPKCS11URI(opts.CertificateId) || isPKCS11URI(opts.PrivateKeyId) {
+		return GetPKCS11Signer(opts.LibPkcs11, opts.CertificateId, opts.PrivateKeyId, opts.CertificateBundleId, opts.PinFile)
+	}
+	if opts.SignerCommand != "" {
+		return GetExternalSigner(opts.SignerCommand, opts.CertificateId, opts.CertificateBundleId)
+	}
+	if opts.SignerEndpoint != "" {
+		return GetRemoteSigner(opts.SignerEndpoint, opts.SignerKeyId, opts.CertificateId, opts.CertificateBundleId)
+	}
+	if opts.SPIFFESocket != "" || opts.SPIFFEId != "" {
+		return GetSPIFFESigner(opts.SPIFFESocket, opts.SPIFFEId)
+	}
+	if opts.AzureKeyVault != "" || opts.AzureCertificate != "" {
+		azureOpts := AzureKeyVaultOpts{VaultURL: opts.AzureKeyVault, CertificateName: opts.AzureCertificate, ClientId: opts.AzureClientId}
+		return GetAzureKeyVaultSigner(azureOpts, opts.CertificateBundleId)
+	}
+	if opts.GCPKMSKey != "" {
+		return GetGCPKMSSigner(opts.GCPKMSKey, opts.CertificateId, opts.CertificateBundleId)
+	}
+	if opts.VaultKey != "" || opts.VaultPKIRole != "" {
+		vaultOpts := VaultOpts{Addr: opts.VaultAddr, RoleId: opts.VaultRoleId, SecretIdFile: opts.VaultSecretIdFile}
+		if opts.VaultPKIRole != "" {
+			pkiOpts := VaultPKIOpts{
+				Mount:      opts.VaultPKIMount,
+				Role:       opts.VaultPKIRole,
+				CommonName: opts.VaultPKICommonName,
+				TTL:        opts.VaultPKITTL,
+				CacheDir:   opts.VaultPKICacheDir,
+			}
+			return GetVaultPKISigner(vaultOpts, pkiOpts)
+		}
+		return GetVaultTransitSigner(vaultOpts, opts.VaultTransitMount, opts.VaultKey, opts.CertificateId, opts.CertificateBundleId)
+	}
+	if opts.CertThumbprint != "" || opts.CertSubject != "" || opts.CertSelector != "" {
+		var certSelector *CertSelector
+		if opts.CertSelector != "" {
+			parsedCertSelector, err := ParseCertSelector(opts.CertSelector)
+			if err != nil {
+				return nil, err
+			}
+			certSelector = &parsedCertSelector
+		}
+		return GetWindowsCertStoreSigner(opts.CertStoreLocation, opts.CertThumbprint, opts.CertSubject, certSelector, opts.CertificateBundleId)
+	}
+	if opts.SSHAgentKey != "" {
+		return GetSSHAgentSigner(opts.SSHAgentKey, opts.CertificateId, opts.CertificateBundleId)
+	}
+	if opts.GPGKeygrip != "" {
+		return GetGPGAgentSigner(opts.GPGKeygrip, opts.CertificateId, opts.CertificateBundleId)
+	}
+	if opts.PivSlot != "" || opts.PivCard != "" {
+		return GetPIVSigner(opts.PivCard, opts.PivSlot, opts.PivPinPolicy, opts.CertificateId, opts.CertificateBundleId, opts.PinFile)
+	}
+	if opts.SecureEnclaveKey != "" {
+		return GetSecureEnclaveSigner(opts.SecureEnclaveKey, opts.CertificateId, opts.CertificateBundleId)
+	}
+	if opts.KeychainLabel != "" || opts.KeychainHash != "" {
+		return GetKeychainSigner(opts.KeychainLabel, opts.KeychainHash, opts.CertificateBundleId)
+	}
+	if opts.KeyContainer != "" {
+		return GetPlatformCryptoSigner(opts.KeyContainer, opts.MachineKey, opts.CertificateId, opts.CertificateBundleId)
+	}
+	if isTPMKeyFile(opts.PrivateKeyId) {
+		keyPassword, err := getTPMKeyPassword(opts)
+		if err != nil {
+			return nil, err
+		}
+		return GetTPMv2Signer(opts.TpmDevice, opts.PrivateKeyId, opts.CertificateId, opts.CertificateBundleId, keyPassword, opts.PinFile)
+	}
+	if opts.Keystore != "" {
+		return GetKeystoreSigner(opts.Keystore, opts.KeystorePassword, opts.PassphraseFile, opts.KeystoreAlias, opts.CertificateBundleId)
+	}
+	if opts.Pkcs12Bundle != "" {
+		return GetPKCS12Signer(opts.Pkcs12Bundle, opts.PassphraseFile, opts.CertificateBundleId)
+	}
+	return GetFileSystemSigner(opts.PrivateKeyId, opts.CertificateId, opts.CertificateBundleId, opts.PassphraseFile, opts.AgeIdentity)
+}
+
 // Load the certificate referenced by `certificateId` and extract
 // details required by the SDK to construct the StringToSign.
 func ReadCertificateData(certificateId string) (CertificateData, error) {
@@ -575,6 +964,8 @@ func ReadCertificateData(certificateId string) (CertificateData, error) {
 		keyType = "RSA"
 	case x509.ECDSA:
 		keyType = "EC"
+	case x509.Ed25519:
+		keyType = "ED25519"
 	default:
 		keyType = ""
 	}
@@ -584,6 +975,10 @@ func ReadCertificateData(certificateId string) (CertificateData, error) {
 		fmt.Sprintf("%sSHA384", keyType),
 		fmt.Sprintf("%sSHA512", keyType),
 	}
+	// Ed25519 signatures don't use a separate digest
+	if keyType == "ED25519" {
+		supportedAlgorithms = []string{keyType}
+	}
 
 	//return struct
 	return CertificateData{keyType, encodedDer, serialNumber, supportedAlgorithms}, nil
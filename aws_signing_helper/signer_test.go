@@ -1,29 +1,49 @@
 package aws_signing_helper
 
 import (
+	"bytes"
+	"context"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/sha512"
+	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 	"unicode/utf8"
 
-	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/rolesanywhere-credential-helper/rolesanywhere/types"
+	smithy "github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 )
 
 const TestCredentialsFilePath = "/tmp/credentials"
@@ -41,6 +61,11 @@ func setup() error {
 }
 
 func TestMain(m *testing.M) {
+	// The fixtures are already in place when the test binary is run as an
+	// external signer command
+	if os.Getenv("TEST_SIGNER_KEY") != "" {
+		os.Exit(m.Run())
+	}
 	err := setup()
 	if err != nil {
 		log.Println(err.Error())
@@ -62,6 +87,9 @@ func TestReadCertificateData(t *testing.T) {
 	fixtures := []CertData{
 		{"../tst/certs/ec-prime256v1-sha256-cert.pem", "EC"},
 		{"../tst/certs/rsa-2048-sha256-cert.pem", "RSA"},
+		{"../tst/certs/rsa-2048-sha256-cert.der", "RSA"},
+		{"../tst/certs/ec-prime256v1-sha256-cert.p7b", "EC"},
+		{"../tst/certs/ed25519-cert.pem", "ED25519"},
 	}
 	for _, fixture := range fixtures {
 		certData, err := ReadCertificateData(fixture.CertPath)
@@ -87,10 +115,18 @@ func TestReadInvalidCertificateData(t *testing.T) {
 }
 
 func TestReadCertificateBundleData(t *testing.T) {
-	_, err := ReadCertificateBundleData("../tst/certs/cert-bundle.pem")
-	if err != nil {
-		t.Log("Failed to read certificate bundle data")
-		t.Fail()
+	fixtures := []string{
+		"../tst/certs/cert-bundle.pem",
+		"../tst/certs/cert-bundle.p7b",
+		"../tst/certs/cert-bundle-pkcs7.pem",
+		"../tst/certs/rsa-2048-sha256-cert.der",
+	}
+	for _, fixture := range fixtures {
+		certs, err := ReadCertificateBundleData(fixture)
+		if err != nil || len(certs) == 0 {
+			t.Logf("Failed to read certificate bundle data from %s: %v", fixture, err)
+			t.Fail()
+		}
 	}
 }
 
@@ -100,6 +136,9 @@ func TestReadPrivateKeyData(t *testing.T) {
 		"../tst/certs/ec-prime256v1-key-pkcs8.pem",
 		"../tst/certs/rsa-2048-key.pem",
 		"../tst/certs/rsa-2048-key-pkcs8.pem",
+		"../tst/certs/ec-prime256v1-key.der",
+		"../tst/certs/rsa-2048-key.der",
+		"../tst/certs/ed25519-key.pem",
 	}
 
 	for _, fixture := range fixtures {
@@ -134,18 +173,246 @@ func TestBuildAuthorizationHeader(t *testing.T) {
 	certificateDerData, _ := base64.StdEncoding.DecodeString(certificateData.CertificateData)
 	certificate, _ := x509.ParseCertificate([]byte(certificateDerData))
 
-	awsRequest := request.Request{HTTPRequest: testRequest}
 	v4x509 := RolesAnywhereSigner{
 		PrivateKey:  privateKey,
 		Certificate: *certificate,
 	}
-	err = v4x509.SignWithCurrTime(&awsRequest)
+	err = v4x509.SignHTTP(context.Background(), aws.Credentials{}, testRequest, emptyStringSHA256, "rolesanywhere", "us-west-2", time.Now())
 	if err != nil {
 		t.Log(err)
 		t.Fail()
 	}
 }
 
+func TestBuildAuthorizationHeaderPSS(t *testing.T) {
+	testRequest, err := http.NewRequest("POST", "https://rolesanywhere.us-west-2.amazonaws.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, _ := ReadPrivateKeyData("../tst/certs/rsa-2048-key.pem")
+	certificate, _ := readCertificate("../tst/certs/rsa-2048-sha256-cert.pem")
+
+	v4x509 := RolesAnywhereSigner{
+		PrivateKey:       privateKey,
+		Certificate:      *certificate,
+		SigningAlgorithm: SigningAlgorithmPSS,
+	}
+	if err = v4x509.SignHTTP(context.Background(), aws.Credentials{}, testRequest, emptyStringSHA256, "rolesanywhere", "us-west-2", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	authorization := testRequest.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "AWS4-X509-RSA-PSS-SHA256 ") {
+		t.Log("Unexpected authorization header:", authorization)
+		t.Fail()
+	}
+}
+
+func TestBuildAuthorizationHeaderDigest(t *testing.T) {
+	privateKey, _ := ReadPrivateKeyData("../tst/certs/ec-secp384r1-key.pem")
+	certificate, _ := readCertificate("../tst/certs/ec-secp384r1-sha384-cert.pem")
+	for digest, prefix := range map[crypto.Hash]string{
+		0:             "AWS4-X509-ECDSA-SHA256 ",
+		crypto.SHA384: "AWS4-X509-ECDSA-SHA384 ",
+		crypto.SHA512: "AWS4-X509-ECDSA-SHA512 ",
+	} {
+		testRequest, err := http.NewRequest("POST", "https://rolesanywhere.us-west-2.amazonaws.com", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v4x509 := RolesAnywhereSigner{
+			PrivateKey:  privateKey,
+			Certificate: *certificate,
+			Digest:      digest,
+		}
+		if err = v4x509.SignHTTP(context.Background(), aws.Credentials{}, testRequest, emptyStringSHA256, "rolesanywhere", "us-west-2", time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		authorization := testRequest.Header.Get("Authorization")
+		if !strings.HasPrefix(authorization, prefix) {
+			t.Log("Unexpected authorization header:", authorization)
+			t.Fail()
+		}
+	}
+}
+
+func TestSigningDigest(t *testing.T) {
+	ecKey, _ := ReadPrivateKeyData("../tst/certs/ec-secp384r1-key.pem")
+	rsaKey, _ := ReadPrivateKeyData("../tst/certs/rsa-2048-key.pem")
+	ed25519Key, _ := ReadPrivateKeyData("../tst/certs/ed25519-key.pem")
+	p256Key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p521Key, _ := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	ecPrivateKey, rsaPrivateKey := ecKey.(ecdsa.PrivateKey), rsaKey.(rsa.PrivateKey)
+	ecPublicKey, rsaPublicKey := &ecPrivateKey.PublicKey, &rsaPrivateKey.PublicKey
+	p256PublicKey, p521PublicKey := &p256Key.PublicKey, &p521Key.PublicKey
+	ed25519PublicKey := ed25519Key.(ed25519.PrivateKey).Public()
+	fixtures := []struct {
+		digestName string
+		publicKey  crypto.PublicKey
+		digest     crypto.Hash
+		valid      bool
+	}{
+		{"", ecPublicKey, crypto.SHA384, true},
+		{"", p256PublicKey, crypto.SHA256, true},
+		{"", p521PublicKey, crypto.SHA512, true},
+		{"", rsaPublicKey, crypto.SHA256, true},
+		{"sha384", ecPublicKey, crypto.SHA384, true},
+		{"SHA256", p256PublicKey, crypto.SHA256, true},
+		{"SHA-512", rsaPublicKey, crypto.SHA512, true},
+		{"SHA384", rsaPublicKey, crypto.SHA384, true},
+		{"auto", ecPublicKey, crypto.SHA384, true},
+		{"auto", p521PublicKey, crypto.SHA512, true},
+		{"auto", rsaPublicKey, crypto.SHA256, true},
+		{"", ed25519PublicKey, crypto.SHA256, true},
+		// Digests that don't match the ECDSA curve
+		{"SHA256", ecPublicKey, 0, false},
+		{"SHA512", ecPublicKey, 0, false},
+		{"SHA512", p256PublicKey, 0, false},
+		{"SHA384", p256PublicKey, 0, false},
+		{"SHA256", p521PublicKey, 0, false},
+		{"SHA384", p521PublicKey, 0, false},
+		{"SHA384", ed25519PublicKey, 0, false},
+		{"MD5", rsaPublicKey, 0, false},
+	}
+	for _, fixture := range fixtures {
+		digest, err := signingDigest(fixture.digestName, fixture.publicKey)
+		if (err == nil) != fixture.valid || digest != fixture.digest {
+			t.Logf("Unexpected result for %q: %v, %v", fixture.digestName, digest, err)
+			t.Fail()
+		}
+	}
+}
+
+// Issues a certificate with the given common name, signed by the parent
+// (or self-signed, when there's no parent)
+func createChainTestCertificate(t *testing.T, commonName string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestOrderCertificateChain(t *testing.T) {
+	root, rootKey := createChainTestCertificate(t, "Root", nil, nil)
+	intermediate, intermediateKey := createChainTestCertificate(t, "Intermediate", root, rootKey)
+	issuing, issuingKey := createChainTestCertificate(t, "Issuing", intermediate, intermediateKey)
+	leaf, _ := createChainTestCertificate(t, "Leaf", issuing, issuingKey)
+	unrelated, _ := createChainTestCertificate(t, "Unrelated", nil, nil)
+
+	fixtures := []struct {
+		bundle   []*x509.Certificate
+		expected []*x509.Certificate
+	}{
+		{[]*x509.Certificate{root, intermediate, issuing}, []*x509.Certificate{issuing, intermediate, root}},
+		{[]*x509.Certificate{intermediate, issuing}, []*x509.Certificate{issuing, intermediate}},
+		{[]*x509.Certificate{unrelated, intermediate, leaf, issuing}, []*x509.Certificate{issuing, intermediate, unrelated}},
+		{[]*x509.Certificate{intermediate, root}, []*x509.Certificate{intermediate, root}},
+		{nil, nil},
+	}
+	for _, fixture := range fixtures {
+		chain := orderCertificateChain(leaf, fixture.bundle)
+		var names, expectedNames []string
+		for _, cert := range chain {
+			names = append(names, cert.Subject.CommonName)
+		}
+		for _, cert := range fixture.expected {
+			expectedNames = append(expectedNames, cert.Subject.CommonName)
+		}
+		if !reflect.DeepEqual(names, expectedNames) {
+			t.Logf("Unexpected chain order: %v (expected %v)", names, expectedNames)
+			t.Fail()
+		}
+	}
+}
+
+func TestCheckCertificateValidity(t *testing.T) {
+	now := time.Now()
+	fixtures := []struct {
+		notBefore   time.Time
+		notAfter    time.Time
+		warningDays int
+		valid       bool
+		warning     bool
+	}{
+		{now.Add(-time.Hour), now.Add(30 * 24 * time.Hour), 7, true, false},
+		{now.Add(-time.Hour), now.Add(3 * 24 * time.Hour), 7, true, true},
+		{now.Add(-time.Hour), now.Add(3 * 24 * time.Hour), 0, true, false},
+		{now.Add(-48 * time.Hour), now.Add(-time.Hour), 7, false, false},
+		{now.Add(time.Hour), now.Add(30 * 24 * time.Hour), 7, false, false},
+	}
+	var logOutput bytes.Buffer
+	log.SetOutput(&logOutput)
+	defer log.SetOutput(os.Stderr)
+	for _, fixture := range fixtures {
+		logOutput.Reset()
+		certificate := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "host"},
+			NotBefore:    fixture.notBefore,
+			NotAfter:     fixture.notAfter,
+		}
+		err := checkCertificateValidity(certificate, fixture.warningDays, now)
+		if (err == nil) != fixture.valid {
+			t.Logf("Unexpected result for a certificate valid from %s to %s: %v", fixture.notBefore, fixture.notAfter, err)
+			t.Fail()
+		}
+		if strings.Contains(logOutput.String(), "expires in") != fixture.warning {
+			t.Logf("Unexpected warning for a certificate expiring on %s: %q", fixture.notAfter, logOutput.String())
+			t.Fail()
+		}
+	}
+}
+
+func TestSignPSS(t *testing.T) {
+	msg := []byte("test message")
+	privateKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	fileSystemSigner, err := GetFileSystemSigner("../tst/certs/rsa-2048-key.pem", "../tst/certs/rsa-2048-sha256-cert.pem", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []crypto.PrivateKey{*privateKey, fileSystemSigner} {
+		for _, digest := range []crypto.Hash{crypto.SHA256, crypto.SHA384, crypto.SHA512} {
+			signingResult, err := signPayload(msg, key, pssOptions(digest))
+			if err != nil {
+				t.Fatal(err)
+			}
+			sig, _ := hex.DecodeString(signingResult.Signature)
+			var publicKey *rsa.PublicKey
+			if signer, ok := key.(crypto.Signer); ok {
+				publicKey = signer.Public().(*rsa.PublicKey)
+			} else {
+				publicKey = &privateKey.PublicKey
+			}
+			h := digest.New()
+			h.Write(msg)
+			if !verifyRSASignature(publicKey, h.Sum(nil), sig, pssOptions(digest)) {
+				t.Log("Failed to verify the PSS signature")
+				t.Fail()
+			}
+		}
+	}
+}
+
 // Verify that the provided payload was signed correctly with the provided options.
 // This function is specifically used for unit testing.
 func Verify(payload []byte, opts SigningOpts, sig []byte) (bool, error) {
@@ -185,13 +452,20 @@ func Verify(payload []byte, opts SigningOpts, sig []byte) (bool, error) {
 		}
 	}
 
+	{
+		privateKey, ok := opts.PrivateKey.(ed25519.PrivateKey)
+		if ok {
+			return ed25519.Verify(privateKey.Public().(ed25519.PublicKey), payload, sig), nil
+		}
+	}
+
 	return false, nil
 }
 
 func TestSign(t *testing.T) {
 	msg := "test message"
 
-	var privateKeyList [2]crypto.PrivateKey
+	var privateKeyList [3]crypto.PrivateKey
 	{
 		privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 		privateKeyList[0] = *privateKey
@@ -200,6 +474,10 @@ func TestSign(t *testing.T) {
 		privateKey, _ := rsa.GenerateKey(rand.Reader, 2048)
 		privateKeyList[1] = *privateKey
 	}
+	{
+		_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+		privateKeyList[2] = privateKey
+	}
 	digestList := []crypto.Hash{crypto.SHA256, crypto.SHA384, crypto.SHA512}
 
 	for _, privateKey := range privateKeyList {
@@ -270,6 +548,309 @@ func TestCredentialProcess(t *testing.T) {
 	}
 }
 
+func TestExpirationBuffer(t *testing.T) {
+	var requests int32
+	server := getCountingCreateSessionServer(time.Hour, &requests)
+	defer server.Close()
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   3600,
+		ExpirationBuffer:  600,
+	}
+	resp, err := GenerateCredentials(&credentialsOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiration, err := time.Parse(time.RFC3339, resp.Expiration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remaining := time.Until(expiration); remaining > 50*time.Minute || remaining < 49*time.Minute {
+		t.Log("the expiration wasn't brought forward by the buffer:", resp.Expiration)
+		t.Fail()
+	}
+
+	// A buffer that's longer than the credentials' lifetime, or negative, is
+	// an error
+	for _, buffer := range []int{7200, -1} {
+		credentialsOpts.ExpirationBuffer = buffer
+		if _, err = GenerateCredentials(&credentialsOpts); err == nil {
+			t.Logf("an expiration buffer of %d seconds was accepted", buffer)
+			t.Fail()
+		}
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	t.Setenv(MaxAttemptsEnvVarName, "1")
+	released := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-released
+	}))
+	defer server.Close()
+	defer close(released)
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+		RequestTimeout:    100 * time.Millisecond,
+	}
+	start := time.Now()
+	if _, err := GenerateCredentials(&credentialsOpts); err == nil {
+		t.Log("a request that never completed succeeded")
+		t.Fail()
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Log("the request didn't time out in time:", elapsed)
+		t.Fail()
+	}
+
+	// Timeouts that aren't set are the defaults
+	client, err := createHTTPClient(&CredentialsOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Timeout != DefaultRequestTimeout || client.Transport.(*http.Transport).TLSHandshakeTimeout != DefaultTLSHandshakeTimeout {
+		t.Log("the default timeouts weren't applied")
+		t.Fail()
+	}
+}
+
+func TestProxyURL(t *testing.T) {
+	// The proxy answers the requests that it's asked to forward itself
+	var proxiedHost string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxiedHost = r.URL.Host
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(mockedCreateSessionResponse))
+	}))
+	defer proxy.Close()
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          "http://rolesanywhere.example.com",
+		SessionDuration:   900,
+		ProxyURL:          strings.TrimPrefix(proxy.URL, "http://"),
+	}
+	if _, err := GenerateCredentials(&credentialsOpts); err != nil || proxiedHost != "rolesanywhere.example.com" {
+		t.Log("the request wasn't sent through the proxy:", proxiedHost, err)
+		t.Fail()
+	}
+
+	for _, value := range []string{"ftp://proxy.example.com", "http://"} {
+		if _, err := ParseProxyURL(value); err == nil {
+			t.Logf("the proxy URL %s was accepted", value)
+			t.Fail()
+		}
+	}
+}
+
+func TestCredentialProcessInconsistentArns(t *testing.T) {
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-west-2:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	if _, err := GenerateCredentials(&credentialsOpts); err == nil {
+		t.Log("a profile and a trust anchor in different regions were accepted")
+		t.Fail()
+	}
+
+	// Without a region, the ARNs' is used
+	credentialsOpts.ProfileArnStr = "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45"
+	signer, err := GetSigner(&credentialsOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+	if _, err := generateCredentialsWithSigner(context.Background(), &credentialsOpts, signer); err != nil || credentialsOpts.Region != "us-east-1" {
+		t.Log("the region wasn't derived from the ARNs:", credentialsOpts.Region, err)
+		t.Fail()
+	}
+}
+
+func TestCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(mockedCreateSessionResponse))
+	}))
+	defer server.Close()
+	caBundle := filepath.Join(t.TempDir(), "ca-bundle.pem")
+	os.WriteFile(caBundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	if _, err := GenerateCredentials(&credentialsOpts); err == nil {
+		t.Log("an endpoint whose certificate isn't trusted was accepted")
+		t.Fail()
+	}
+	credentialsOpts.CABundle = caBundle
+	if _, err := GenerateCredentials(&credentialsOpts); err != nil {
+		t.Log("the endpoint's certificate wasn't verified against the CA bundle:", err)
+		t.Fail()
+	}
+	credentialsOpts.CABundle = "../credential-process-data/client-key.pem"
+	if _, err := GenerateCredentials(&credentialsOpts); err == nil {
+		t.Log("a CA bundle without certificates was accepted")
+		t.Fail()
+	}
+}
+
+func TestTLSPolicy(t *testing.T) {
+	// TLS 1.2 with the default cipher suites can be negotiated with a server
+	// that supports them
+	startServer := func(tlsConfig *tls.Config) *httptest.Server {
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(mockedCreateSessionResponse))
+		}))
+		server.TLS = tlsConfig
+		server.StartTLS()
+		return server
+	}
+	server := startServer(&tls.Config{MaxVersion: tls.VersionTLS12})
+	defer server.Close()
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+		NoVerifySSL:       true,
+	}
+	if _, err := GenerateCredentials(&credentialsOpts); err != nil {
+		t.Log("unable to connect with TLS 1.2:", err)
+		t.Fail()
+	}
+
+	// A server that only supports TLS 1.2 is rejected if TLS 1.3 is required,
+	// or if it has no cipher suite in common with the client
+	os.Setenv(MaxAttemptsEnvVarName, "1")
+	defer os.Unsetenv(MaxAttemptsEnvVarName)
+	credentialsOpts.TLSMinVersion = TLSVersion13
+	if _, err := GenerateCredentials(&credentialsOpts); err == nil {
+		t.Log("a server without TLS 1.3 was accepted")
+		t.Fail()
+	}
+	credentialsOpts.TLSMinVersion = TLSVersion12
+	cbcServer := startServer(&tls.Config{MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA}})
+	defer cbcServer.Close()
+	credentialsOpts.Endpoint = cbcServer.URL
+	if _, err := GenerateCredentials(&credentialsOpts); err == nil {
+		t.Log("a server with only a CBC cipher suite was accepted")
+		t.Fail()
+	}
+	credentialsOpts.TLSCipherSuites = []string{"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA"}
+	if _, err := GenerateCredentials(&credentialsOpts); err != nil {
+		t.Log("unable to connect with the cipher suite that was selected:", err)
+		t.Fail()
+	}
+
+	for _, fixture := range []struct {
+		minVersion   string
+		cipherSuites []string
+	}{
+		{"1.1", nil},
+		{TLSVersion12, []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+		{TLSVersion12, []string{"TLS_NOT_A_SUITE"}},
+		{TLSVersion12, []string{"TLS_AES_128_GCM_SHA256"}},
+	} {
+		if _, err := newTLSConfig(&CredentialsOpts{TLSMinVersion: fixture.minVersion, TLSCipherSuites: fixture.cipherSuites}); err == nil {
+			t.Log("an invalid TLS policy was accepted:", fixture.minVersion, fixture.cipherSuites)
+			t.Fail()
+		}
+	}
+}
+
+func TestCredentialProcessEd25519(t *testing.T) {
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../tst/certs/ed25519-key.pem",
+		CertificateId:     "../tst/certs/ed25519-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	if _, err := GenerateCredentials(&credentialsOpts); err == nil {
+		t.Log("Expected Ed25519 certificates to be rejected unless they're enabled")
+		t.Fail()
+	}
+
+	credentialsOpts.EnableEd25519 = true
+	resp, err := GenerateCredentials(&credentialsOpts)
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+	} else if resp.AccessKeyId != "accessKeyId" {
+		t.Log("Incorrect access key id")
+		t.Fail()
+	}
+}
+
+func TestCredentialProcessSigningAlgorithm(t *testing.T) {
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	fixtures := []struct {
+		privateKeyId     string
+		certificateId    string
+		signingAlgorithm string
+		valid            bool
+	}{
+		{"../tst/certs/rsa-2048-key.pem", "../tst/certs/rsa-2048-sha256-cert.pem", SigningAlgorithmPSS, true},
+		{"../tst/certs/rsa-2048-key.pem", "../tst/certs/rsa-2048-sha256-cert.pem", SigningAlgorithmPKCS1v15, true},
+		{"../tst/certs/ec-prime256v1-key.pem", "../tst/certs/ec-prime256v1-sha256-cert.pem", SigningAlgorithmPSS, false},
+		{"../tst/certs/rsa-2048-key.pem", "../tst/certs/rsa-2048-sha256-cert.pem", "rsa-oaep", false},
+		{"../tst/certs/ec-prime256v1-key.pem", "../tst/certs/ec-prime256v1-sha256-cert.pem", SigningAlgorithmRFC6979, true},
+		{"../tst/certs/rsa-2048-key.pem", "../tst/certs/rsa-2048-sha256-cert.pem", SigningAlgorithmRFC6979, false},
+	}
+	for _, fixture := range fixtures {
+		credentialsOpts := CredentialsOpts{
+			PrivateKeyId:      fixture.privateKeyId,
+			CertificateId:     fixture.certificateId,
+			SigningAlgorithm:  fixture.signingAlgorithm,
+			RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+			ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+			TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+			Endpoint:          server.URL,
+			SessionDuration:   900,
+		}
+		_, err := GenerateCredentials(&credentialsOpts)
+		if (err == nil) != fixture.valid {
+			t.Logf("Unexpected result for %s with %s: %v", fixture.certificateId, fixture.signingAlgorithm, err)
+			t.Fail()
+		}
+	}
+}
+
 func TestUpdate(t *testing.T) {
 	testTable := []struct {
 		name                 string
@@ -505,6 +1086,479 @@ aws_session_token = sessionToken
 	}
 }
 
+func TestUpdateCustomCredentialsFile(t *testing.T) {
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	credentialsFilePath := filepath.Join(t.TempDir(), "cron", "credentials.ini")
+
+	UpdateFile(credentialsOpts, credentialsFilePath, "cron", true)
+
+	fileByteContents, _ := ioutil.ReadFile(credentialsFilePath)
+	expectedFileContents := `[cron]
+aws_access_key_id = accessKeyId
+aws_secret_access_key = secretAccessKey
+aws_session_token = sessionToken
+
+`
+	if string(fileByteContents) != expectedFileContents {
+		t.Log("unexpected file contents")
+		t.Fail()
+	}
+}
+
+func TestUpdateConcurrently(t *testing.T) {
+	credentialsFilePath := filepath.Join(t.TempDir(), "credentials")
+
+	// Processes updating different profiles at the same time don't lose
+	// each other's changes
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cred := TemporaryCredential{AccessKeyId: fmt.Sprintf("accessKeyId%d", i), SecretAccessKey: "secretAccessKey", SessionToken: "sessionToken"}
+			if err := updateCredentialsFile(credentialsFilePath, fmt.Sprintf("profile%d", i), &cred); err != nil {
+				t.Log(err)
+				t.Fail()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	fileByteContents, _ := ioutil.ReadFile(credentialsFilePath)
+	for i := 0; i < 10; i++ {
+		if !strings.Contains(string(fileByteContents), fmt.Sprintf("[profile%d]\naws_access_key_id = accessKeyId%d\n", i, i)) {
+			t.Logf("profile%d is missing from the credentials file", i)
+			t.Fail()
+		}
+	}
+	// Only the credentials file and its lock remain
+	entries, _ := os.ReadDir(filepath.Dir(credentialsFilePath))
+	if len(entries) != 2 {
+		t.Logf("expected no temporary files to remain, found %d files", len(entries))
+		t.Fail()
+	}
+}
+
+func TestServeCredentials(t *testing.T) {
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	signer, err := GetSigner(&credentialsOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+
+	// The credentials haven't been obtained yet, so they're obtained when
+	// they're first requested
+	var cred RefreshableCred
+	putTokenHandler, getRoleNameHandler, getCredentialsHandler := AllIssuesHandlers(&cred, "ExampleS3WriteRole", &credentialsOpts, signer)
+	mux := http.NewServeMux()
+	mux.HandleFunc(TOKEN_RESOURCE_PATH, putTokenHandler)
+	mux.HandleFunc(SECURITY_CREDENTIALS_RESOURCE_PATH, getRoleNameHandler)
+	mux.HandleFunc(SECURITY_CREDENTIALS_RESOURCE_PATH+"ExampleS3WriteRole", getCredentialsHandler)
+	endpoint := httptest.NewServer(mux)
+	defer endpoint.Close()
+
+	request, _ := http.NewRequest("PUT", endpoint.URL+TOKEN_RESOURCE_PATH, nil)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+
+	request, _ = http.NewRequest("GET", endpoint.URL+SECURITY_CREDENTIALS_RESOURCE_PATH+"ExampleS3WriteRole", nil)
+	request.Header.Add(EC2_METADATA_TOKEN_HEADER, string(token))
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var served RefreshableCred
+	if err = json.NewDecoder(response.Body).Decode(&served); err != nil {
+		t.Fatal(err)
+	}
+	if served.Code != "Success" || served.Type != "AWS-HMAC" || served.AccessKeyId != "accessKeyId" ||
+		served.Token != "sessionToken" || served.LastUpdated.IsZero() {
+		t.Log("unexpected credentials served:", served)
+		t.Fail()
+	}
+}
+
+func TestServeStaleCredentials(t *testing.T) {
+	t.Setenv(MaxAttemptsEnvVarName, "1")
+	// The endpoint can't be reached
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	signer, err := GetSigner(&credentialsOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+
+	// Credentials that are due to be refreshed, but haven't expired, keep
+	// being served when they can't be refreshed
+	cred := RefreshableCred{AccessKeyId: "accessKeyId", Expiration: time.Now().Add(RefreshTime)}
+	served, err := currentCredentials(&cred, &credentialsOpts, signer)
+	if err != nil || served.AccessKeyId != "accessKeyId" || cred.refreshFailedAt.IsZero() {
+		t.Log("unexpected result of a failed refresh:", served, err)
+		t.Fail()
+	}
+	// Until it's time to try again, requests don't wait for another attempt
+	cred.refreshFailedAt = time.Now()
+	if served, err = currentCredentials(&cred, &credentialsOpts, signer); err != nil || served.AccessKeyId != "accessKeyId" {
+		t.Log("stale credentials weren't served:", served, err)
+		t.Fail()
+	}
+
+	// Expired credentials aren't
+	cred.Expiration = time.Now().Add(-time.Minute)
+	if _, err = currentCredentials(&cred, &credentialsOpts, signer); err == nil {
+		t.Log("expired credentials were served")
+		t.Fail()
+	}
+}
+
+func TestServeCredentialsWhileRefreshing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Log("CreateSession was called while the credentials were being refreshed")
+		t.Fail()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	signer, err := GetSigner(&credentialsOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+
+	// Credentials that are due to be refreshed, but haven't expired, are
+	// served without waiting while a refresh is in flight
+	cred := RefreshableCred{AccessKeyId: "accessKeyId", Expiration: time.Now().Add(RefreshTime), refresh: &refreshCall{done: make(chan struct{})}}
+	served, err := currentCredentials(&cred, &credentialsOpts, signer)
+	if err != nil || served.AccessKeyId != "accessKeyId" {
+		t.Log("credentials weren't served while being refreshed:", served, err)
+		t.Fail()
+	}
+}
+
+func TestServeRoleWhileAnotherIsRefreshing(t *testing.T) {
+	t.Setenv(MaxAttemptsEnvVarName, "1")
+	received := make(chan struct{}, 1)
+	release := make(chan struct{})
+	slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(mockedCreateSessionResponse))
+	}))
+	defer slowServer.Close()
+	defer close(release)
+	var requests int32
+	server := getCountingCreateSessionServer(time.Hour, &requests)
+	defer server.Close()
+	slowRole := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          slowServer.URL,
+		SessionDuration:   900,
+	}
+	role := slowRole
+	role.RoleArn = "arn:aws:iam::000000000000:role/ExampleS3ReadRole"
+	role.Endpoint = server.URL
+	signer, err := GetSigner(&slowRole)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+
+	// Neither role's credentials can be served until they're refreshed, and
+	// the first role's refresh doesn't complete until the end of the test
+	var slowCred, cred RefreshableCred
+	go currentCredentials(&slowCred, &slowRole, signer)
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the first role's credentials weren't refreshed")
+	}
+
+	served := make(chan *RefreshableCred, 1)
+	go func() {
+		current, _ := currentCredentials(&cred, &role, signer)
+		served <- current
+	}()
+	select {
+	case current := <-served:
+		if current == nil || current.AccessKeyId != "accessKeyId" {
+			t.Log("unexpected credentials for the second role:", current)
+			t.Fail()
+		}
+	case <-time.After(5 * time.Second):
+		t.Log("the second role's credentials waited for the first role's refresh")
+		t.Fail()
+	}
+}
+
+func TestConcurrentRefreshesSendOneCreateSession(t *testing.T) {
+	var requests int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(strings.Replace(mockedCreateSessionResponse, "2022-07-27T04:36:55Z", time.Now().Add(time.Hour).UTC().Format(time.RFC3339), 1)))
+	}))
+	defer server.Close()
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	signer, err := GetSigner(&credentialsOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+
+	// No credentials can be served until they're refreshed, so each request
+	// needs a refresh, but they wait for the one in flight
+	var cred RefreshableCred
+	var wg sync.WaitGroup
+	served := make(chan *RefreshableCred, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			current, _ := currentCredentials(&cred, &credentialsOpts, signer)
+			served <- current
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(served)
+
+	for current := range served {
+		if current == nil || current.AccessKeyId != "accessKeyId" {
+			t.Log("unexpected credentials:", current)
+			t.Fail()
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Logf("expected concurrent refreshes to send one CreateSession, got %d", n)
+		t.Fail()
+	}
+}
+
+// Returns the error with which a request fails when the service responds
+// with the given status and error
+func newResponseError(statusCode int, err error) error {
+	return &awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: statusCode}},
+			Err:      err,
+		},
+	}
+}
+
+func TestIsTransientError(t *testing.T) {
+	fixtures := []struct {
+		err      error
+		expected bool
+	}{
+		{newResponseError(http.StatusInternalServerError, &smithy.GenericAPIError{Code: "InternalServerException"}), true},
+		{newResponseError(http.StatusBadRequest, &smithy.GenericAPIError{Code: "ThrottlingException"}), true},
+		{newResponseError(http.StatusTooManyRequests, &smithy.GenericAPIError{Code: "TooManyRequestsException"}), true},
+		{newResponseError(http.StatusForbidden, &types.AccessDeniedException{}), false},
+		{newResponseError(http.StatusBadRequest, &types.ValidationException{}), false},
+		{&smithyhttp.RequestSendError{Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}, true},
+		{fmt.Errorf("unable to assume the chained role: %w", newResponseError(http.StatusBadRequest, &smithy.GenericAPIError{Code: "Throttling"})), true},
+		{errors.New("invalid certificate"), false},
+	}
+	for _, fixture := range fixtures {
+		if isTransientError(fixture.err) != fixture.expected {
+			t.Logf("Unexpected result for %v", fixture.err)
+			t.Fail()
+		}
+	}
+}
+
+func TestServeMultipleRoles(t *testing.T) {
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	additionalRole := credentialsOpts
+	additionalRole.RoleArn = "arn:aws:iam::000000000000:role/path/ExampleReadOnlyRole"
+	endpoint, signer := newMetadataEndpoint(0, credentialsOpts, []CredentialsOpts{additionalRole})
+	defer signer.Close()
+	metadataServer := httptest.NewServer(endpoint.Server.Handler)
+	defer metadataServer.Close()
+
+	get := func(path string, token string) string {
+		request, _ := http.NewRequest("GET", metadataServer.URL+path, nil)
+		request.Header.Add(EC2_METADATA_TOKEN_HEADER, token)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		body, _ := ioutil.ReadAll(response.Body)
+		if response.StatusCode != http.StatusOK {
+			t.Logf("unexpected status %d for %s", response.StatusCode, path)
+			t.Fail()
+		}
+		return string(body)
+	}
+	request, _ := http.NewRequest("PUT", metadataServer.URL+"/ExampleReadOnlyRole"+TOKEN_RESOURCE_PATH, nil)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+
+	if roleNames := get(SECURITY_CREDENTIALS_RESOURCE_PATH, string(token)); roleNames != "ExampleS3WriteRole\nExampleReadOnlyRole" {
+		t.Logf("unexpected role names: %q", roleNames)
+		t.Fail()
+	}
+	if roleNames := get("/ExampleReadOnlyRole"+SECURITY_CREDENTIALS_RESOURCE_PATH, string(token)); roleNames != "ExampleReadOnlyRole" {
+		t.Logf("unexpected role names: %q", roleNames)
+		t.Fail()
+	}
+	var served RefreshableCred
+	json.Unmarshal([]byte(get("/ExampleReadOnlyRole"+SECURITY_CREDENTIALS_RESOURCE_PATH+"ExampleReadOnlyRole", string(token))), &served)
+	if served.AccessKeyId != "accessKeyId" {
+		t.Log("unexpected credentials served:", served)
+		t.Fail()
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "credentials.sock")
+	listener, err := listenUnix(socketPath, 0660)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(socketPath)
+	if info.Mode().Perm() != 0660 {
+		t.Logf("unexpected socket mode %v", info.Mode().Perm())
+		t.Fail()
+	}
+
+	// A socket left behind (here, by a listener that's still open) is
+	// replaced
+	defer listener.Close()
+	listener, err = listenUnix(socketPath, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	info, _ = os.Stat(socketPath)
+	if info.Mode().Perm() != 0600 {
+		t.Logf("unexpected socket mode %v", info.Mode().Perm())
+		t.Fail()
+	}
+}
+
+func TestServeUntilStopped(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		io.WriteString(w, "ok")
+	})}
+	stop := make(chan os.Signal, 1)
+	served := make(chan error, 1)
+	go func() {
+		served <- serveUntil(server, listener, stop)
+	}()
+
+	// The request that's being served when the server is stopped completes
+	responses := make(chan string, 1)
+	go func() {
+		response, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			responses <- err.Error()
+			return
+		}
+		defer response.Body.Close()
+		body, _ := ioutil.ReadAll(response.Body)
+		responses <- string(body)
+	}()
+	<-started
+	stop <- os.Interrupt
+	if err = <-served; err != nil {
+		t.Log("unexpected error:", err)
+		t.Fail()
+	}
+	if response := <-responses; response != "ok" {
+		t.Log("expected the request being served to complete, got:", response)
+		t.Fail()
+	}
+
+	// New requests aren't accepted
+	if _, err = http.Get("http://" + listener.Addr().String()); err == nil {
+		t.Log("expected new requests to be refused")
+		t.Fail()
+	}
+}
+
 func TestGenerateLongToken(t *testing.T) {
 	_, err := GenerateToken(150)
 	if err == nil {
@@ -559,6 +1613,56 @@ func TestStoreValidToken(t *testing.T) {
 	}
 }
 
+func TestOptionalToken(t *testing.T) {
+	defer func() { TokensRequired = true }()
+	httpRequest, err := http.NewRequest("GET", "http://127.0.0.1", nil)
+	if err != nil {
+		t.Log("unable to create test http request")
+		t.Fail()
+	}
+
+	TokensRequired = false
+	if err = CheckValidToken(nil, httpRequest); err != nil {
+		t.Log("expected a request without a token to be accepted when tokens are optional")
+		t.Fail()
+	}
+
+	// A token that is presented has to be valid, even if it's optional
+	httpRequest.Header.Add(EC2_METADATA_TOKEN_HEADER, "invalid")
+	if err = CheckValidToken(httptest.NewRecorder(), httpRequest); err == nil {
+		t.Log("expected an invalid token to be rejected")
+		t.Fail()
+	}
+}
+
+func TestMaxTokenTTL(t *testing.T) {
+	defer func() { MaxTokenTTL = 21600 }()
+	MaxTokenTTL = 60
+	putTokenHandler, _, _ := AllIssuesHandlers(&RefreshableCred{}, "", &CredentialsOpts{}, nil)
+
+	fixtures := []struct {
+		ttl            string
+		expectedStatus int
+	}{
+		{"", http.StatusOK},
+		{"60", http.StatusOK},
+		{"61", http.StatusBadRequest},
+		{"0", http.StatusBadRequest},
+	}
+	for _, fixture := range fixtures {
+		httpRequest := httptest.NewRequest("PUT", TOKEN_RESOURCE_PATH, nil)
+		if fixture.ttl != "" {
+			httpRequest.Header.Add(EC2_METADATA_TOKEN_TTL_HEADER, fixture.ttl)
+		}
+		recorder := httptest.NewRecorder()
+		putTokenHandler(recorder, httpRequest)
+		if recorder.Code != fixture.expectedStatus {
+			t.Logf("unexpected status %d for token TTL %q", recorder.Code, fixture.ttl)
+			t.Fail()
+		}
+	}
+}
+
 func Test(t *testing.T) {
 	httpRequest, err := http.NewRequest("GET", "http://127.0.0.1", nil)
 	if err != nil {
@@ -589,10 +1693,8 @@ func trimLastChar(s string) string {
 	return s[:len(s)-size]
 }
 
-func GetMockedCreateSessionResponseServer() *httptest.Server {
-	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusCreated)
-		w.Write([]byte(`{
+// Response of the mocked CreateSession API
+const mockedCreateSessionResponse = `{
 			"credentialSet":[
 			  {
 				"assumedRoleUser": {
@@ -611,6 +1713,253 @@ func GetMockedCreateSessionResponseServer() *httptest.Server {
 			  }
 			],
 			"subjectArn": "arn:aws:rolesanywhere:us-east-1:000000000000:subject/41cl0bae-6783-40d4-ab20-65dc5d922e45"
-		  }`))
+		  }`
+
+func GetMockedCreateSessionResponseServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(mockedCreateSessionResponse))
 	}))
 }
+
+func TestGetPin(t *testing.T) {
+	pinFile := "/tmp/rolesanywhere-test-pin"
+	os.WriteFile(pinFile, []byte("5678\n"), 0600)
+	defer os.Remove(pinFile)
+	os.Setenv(PinEnvVarName, "9012")
+	defer os.Unsetenv(PinEnvVarName)
+
+	testTable := []struct {
+		name        string
+		opts        PinOpts
+		expectedPin string
+	}{
+		{"explicit-pin", PinOpts{Pin: "1234", PinFile: pinFile}, "1234"},
+		{"pin-file", PinOpts{PinFile: pinFile}, "5678"},
+		{"environment-variable", PinOpts{}, "9012"},
+	}
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			pin, err := GetPin(tc.opts)
+			if err != nil {
+				t.Log(err)
+				t.Fail()
+			}
+			if pin != tc.expectedPin {
+				t.Logf("Expected PIN %s, got %s", tc.expectedPin, pin)
+				t.Fail()
+			}
+		})
+	}
+
+	os.Unsetenv(PinEnvVarName)
+	pin, err := GetPin(PinOpts{ProtectedAuthenticationPath: true})
+	if err != nil || pin != "" {
+		t.Log("Expected an empty PIN for a protected authentication path")
+		t.Fail()
+	}
+}
+
+func TestReadTPMKey(t *testing.T) {
+	der, err := asn1.Marshal(tpmKey{
+		Type:       oidLoadableKey,
+		EmptyAuth:  true,
+		Parent:     0x40000001,
+		PublicKey:  []byte{0x00, 0x02, 0xaa, 0xbb},
+		PrivateKey: []byte{0x00, 0x01, 0xcc},
+	})
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	keyPath := "/tmp/rolesanywhere-test-tpm-key.pem"
+	os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: tss2PrivateKeyBlockType, Bytes: der}), 0600)
+	defer os.Remove(keyPath)
+
+	if !isTPMKeyFile(keyPath) {
+		t.Log("Failed to detect TSS2 private key")
+		t.Fail()
+	}
+	if isTPMKeyFile("../tst/certs/rsa-2048-key.pem") {
+		t.Log("Detected a regular private key as a TSS2 private key")
+		t.Fail()
+	}
+
+	key, err := readTPMKey(keyPath)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if !key.EmptyAuth || key.Parent != 0x40000001 {
+		t.Log("Unexpected TPM key attributes")
+		t.Fail()
+	}
+	publicBlob, err := unmarshalTPM2B(key.PublicKey)
+	if err != nil || !bytes.Equal(publicBlob, []byte{0xaa, 0xbb}) {
+		t.Log("Failed to unmarshal TPM2B public key")
+		t.Fail()
+	}
+	if _, err := unmarshalTPM2B([]byte{0x00, 0x05, 0xcc}); err == nil {
+		t.Log("Expected a TPM2B structure with the wrong size to be rejected")
+		t.Fail()
+	}
+}
+
+func TestGetTPMKeyPassword(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "tpm-key-password")
+	os.WriteFile(passwordFile, []byte("password\n"), 0600)
+
+	testTable := []struct {
+		name     string
+		opts     CredentialsOpts
+		expected string
+	}{
+		{"none", CredentialsOpts{}, ""},
+		{"file", CredentialsOpts{TpmKeyPasswordFile: passwordFile}, "password"},
+		{"given", CredentialsOpts{TpmKeyPassword: "given", TpmKeyPasswordFile: passwordFile}, "given"},
+	}
+	for _, tc := range testTable {
+		password, err := getTPMKeyPassword(&tc.opts)
+		if err != nil || password != tc.expected {
+			t.Logf("%s: expected password %q, got %q (%v)", tc.name, tc.expected, password, err)
+			t.Fail()
+		}
+	}
+
+	if _, err := getTPMKeyPassword(&CredentialsOpts{TpmKeyPasswordFile: filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Log("Expected a missing password file to be an error")
+		t.Fail()
+	}
+}
+
+func TestCreateCertificateRequest(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrPem, err := CreateCertificateRequest(key, "host.example.com")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	block, _ := pem.Decode(csrPem)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		t.Log("Expected a PEM-encoded certificate request")
+		t.FailNow()
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil || csr.CheckSignature() != nil {
+		t.Log("Failed to parse or verify the certificate request")
+		t.FailNow()
+	}
+	if csr.Subject.CommonName != "host.example.com" {
+		t.Logf("Unexpected subject: %s", csr.Subject)
+		t.Fail()
+	}
+}
+
+func TestPKCS12Signer(t *testing.T) {
+	msg := []byte("test message")
+	digest := sha256.Sum256(msg)
+
+	passphraseFile := t.TempDir() + "/passphrase"
+	os.WriteFile(passphraseFile, []byte("test-passphrase\n"), 0600)
+	fixtures := []struct {
+		pkcs12Id       string
+		passphraseFile string
+		chainLength    int
+	}{
+		{"../tst/certs/ec-prime256v1-sha256.p12", "", 1},
+		{"../tst/certs/rsa-2048-sha256-encrypted.p12", passphraseFile, 0},
+	}
+	for _, fixture := range fixtures {
+		signer, err := GetPKCS12Signer(fixture.pkcs12Id, fixture.passphraseFile, "")
+		if err != nil {
+			t.Log(err)
+			t.Fail()
+			continue
+		}
+		cert, _ := signer.Certificate()
+		if chain, _ := signer.CertificateChain(); len(chain) != fixture.chainLength {
+			t.Logf("Expected %d chain certificates in %s, got %d", fixture.chainLength, fixture.pkcs12Id, len(chain))
+			t.Fail()
+		}
+		signingResult, err := Sign(msg, SigningOpts{signer, crypto.SHA256})
+		if err != nil {
+			t.Log(err)
+			t.Fail()
+			continue
+		}
+		sig, _ := hex.DecodeString(signingResult.Signature)
+
+		valid := false
+		switch publicKey := cert.PublicKey.(type) {
+		case *ecdsa.PublicKey:
+			valid = ecdsa.VerifyASN1(publicKey, digest[:], sig)
+		case *rsa.PublicKey:
+			valid = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], sig) == nil
+		}
+		if !valid {
+			t.Logf("Failed to verify the signature for %s", fixture.pkcs12Id)
+			t.Fail()
+		}
+	}
+
+	// The wrong passphrase is rejected
+	os.WriteFile(passphraseFile, []byte("wrong-passphrase\n"), 0600)
+	if _, err := GetPKCS12Signer("../tst/certs/rsa-2048-sha256-encrypted.p12", passphraseFile, ""); err == nil {
+		t.Log("Expected the wrong passphrase to be rejected")
+		t.Fail()
+	}
+}
+
+func TestReadEncryptedPrivateKeyData(t *testing.T) {
+	fixtures := map[string]string{
+		"../tst/certs/ec-prime256v1-key-pkcs8-encrypted.pem": "../tst/certs/ec-prime256v1-key.pem",
+		"../tst/certs/rsa-2048-key-pkcs8-encrypted.pem":      "../tst/certs/rsa-2048-key.pem",
+		"../tst/certs/ec-prime256v1-key-encrypted.pem":       "../tst/certs/ec-prime256v1-key.pem",
+		"../tst/certs/rsa-2048-key-encrypted.pem":            "../tst/certs/rsa-2048-key.pem",
+		"../tst/certs/ec-prime256v1-key-pkcs8-encrypted.der": "../tst/certs/ec-prime256v1-key.pem",
+	}
+	for encryptedKeyId, privateKeyId := range fixtures {
+		if _, err := ReadPrivateKeyData(encryptedKeyId); err != ErrEncryptedPrivateKey {
+			t.Logf("Expected %s to be reported as encrypted, got %v", encryptedKeyId, err)
+			t.Fail()
+		}
+		if _, err := ReadEncryptedPrivateKeyData(encryptedKeyId, "wrong-passphrase"); err == nil {
+			t.Logf("Expected the wrong passphrase to be rejected for %s", encryptedKeyId)
+			t.Fail()
+		}
+		privateKey, err := ReadEncryptedPrivateKeyData(encryptedKeyId, "test-passphrase")
+		if err != nil {
+			t.Logf("Failed to decrypt %s: %v", encryptedKeyId, err)
+			t.Fail()
+			continue
+		}
+		expectedKey, _ := ReadPrivateKeyData(privateKeyId)
+		if !reflect.DeepEqual(privateKey, expectedKey) {
+			t.Logf("Decrypted key from %s doesn't match %s", encryptedKeyId, privateKeyId)
+			t.Fail()
+		}
+	}
+}
+
+func TestFileSystemSignerEncryptedKey(t *testing.T) {
+	passphraseFile := t.TempDir() + "/passphrase"
+	os.WriteFile(passphraseFile, []byte("test-passphrase\n"), 0600)
+	signer, err := GetFileSystemSigner("../tst/certs/ec-prime256v1-key-pkcs8-encrypted.pem", "../tst/certs/ec-prime256v1-sha256-cert.pem", "", passphraseFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := signer.Certificate()
+	if !publicKeysEqual(cert.PublicKey, signer.Public()) {
+		t.Log("Expected the decrypted key to match the certificate")
+		t.Fail()
+	}
+
+	t.Setenv(PassphraseEnvVarName, "test-passphrase")
+	if _, err = GetFileSystemSigner("../tst/certs/rsa-2048-key-encrypted.pem", "../tst/certs/rsa-2048-sha256-cert.pem", "", "", ""); err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+}
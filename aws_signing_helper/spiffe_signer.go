@@ -0,0 +1,116 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+	"github.com/spiffe/go-spiffe/v2/workloadapi"
+)
+
+// Time allowed for the Workload API to provide the initial X.509-SVID
+const spiffeFetchTimeout = 30 * time.Second
+
+// Signer that uses an X.509-SVID obtained from the SPIFFE Workload API (for
+// example, from a SPIRE agent). The SVID is kept up to date in the
+// background, as it's rotated.
+type SPIFFESigner struct {
+	mutex  sync.Mutex
+	source *workloadapi.X509Source
+	// SVID that was returned by the last call to Certificate, which Sign
+	// uses, so that the key matches the certificate even if a rotation
+	// happens in between
+	svid *x509svid.SVID
+}
+
+// Creates a signer that uses the X.509-SVID from the Workload API at the
+// given socket (SPIFFE_ENDPOINT_SOCKET, if not provided). If a SPIFFE ID is
+// provided, the SVID with that ID is used; otherwise, the default one is.
+func GetSPIFFESigner(socket string, spiffeId string) (Signer, error) {
+	var clientOptions []workloadapi.ClientOption
+	if socket != "" {
+		if strings.HasPrefix(socket, "/") {
+			socket = "unix://" + socket
+		}
+		clientOptions = append(clientOptions, workloadapi.WithAddr(socket))
+	}
+	sourceOptions := []workloadapi.X509SourceOption{workloadapi.WithClientOptions(clientOptions...)}
+	if spiffeId != "" {
+		sourceOptions = append(sourceOptions, workloadapi.WithDefaultX509SVIDPicker(func(svids []*x509svid.SVID) *x509svid.SVID {
+			for _, svid := range svids {
+				if svid.ID.String() == spiffeId {
+					return svid
+				}
+			}
+			return nil
+		}))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), spiffeFetchTimeout)
+	defer cancel()
+	source, err := workloadapi.NewX509Source(ctx, sourceOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to obtain an X.509-SVID from the Workload API: %w", err)
+	}
+	spiffeSigner := &SPIFFESigner{source: source}
+	if spiffeSigner.svid, err = spiffeSigner.currentSVID(); err != nil {
+		source.Close()
+		return nil, err
+	}
+	return spiffeSigner, nil
+}
+
+// Returns the current X.509-SVID. The source holds none when there's no
+// SVID with the requested SPIFFE ID.
+func (spiffeSigner *SPIFFESigner) currentSVID() (*x509svid.SVID, error) {
+	svid, err := spiffeSigner.source.GetX509SVID()
+	if err != nil || len(svid.Certificates) == 0 {
+		return nil, errors.New("no matching X.509-SVID available from the Workload API")
+	}
+	return svid, nil
+}
+
+func (spiffeSigner *SPIFFESigner) Public() crypto.PublicKey {
+	spiffeSigner.mutex.Lock()
+	defer spiffeSigner.mutex.Unlock()
+	return spiffeSigner.svid.PrivateKey.Public()
+}
+
+func (spiffeSigner *SPIFFESigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	spiffeSigner.mutex.Lock()
+	defer spiffeSigner.mutex.Unlock()
+	return spiffeSigner.svid.PrivateKey.Sign(rand, digest, opts)
+}
+
+func (spiffeSigner *SPIFFESigner) supportsPSS() bool {
+	return true
+}
+
+// Returns the certificate of the current X.509-SVID
+func (spiffeSigner *SPIFFESigner) Certificate() (*x509.Certificate, error) {
+	spiffeSigner.mutex.Lock()
+	defer spiffeSigner.mutex.Unlock()
+	svid, err := spiffeSigner.currentSVID()
+	if err != nil {
+		return nil, err
+	}
+	spiffeSigner.svid = svid
+	return svid.Certificates[0], nil
+}
+
+func (spiffeSigner *SPIFFESigner) CertificateChain() ([]*x509.Certificate, error) {
+	spiffeSigner.mutex.Lock()
+	defer spiffeSigner.mutex.Unlock()
+	return spiffeSigner.svid.Certificates[1:], nil
+}
+
+func (spiffeSigner *SPIFFESigner) Close() {
+	spiffeSigner.source.Close()
+}
@@ -0,0 +1,156 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"math/big"
+	"net"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/proto/spiffe/workload"
+	"google.golang.org/grpc"
+)
+
+// Workload API that serves X.509-SVIDs for the given SPIFFE IDs, and
+// serves a new set of SVIDs whenever something is sent on `rotate`
+type testWorkloadAPI struct {
+	workload.UnimplementedSpiffeWorkloadAPIServer
+	caKey     *ecdsa.PrivateKey
+	caCert    *x509.Certificate
+	spiffeIds []string
+	rotate    chan struct{}
+}
+
+func (api *testWorkloadAPI) issueSVIDs() (*workload.X509SVIDResponse, error) {
+	response := &workload.X509SVIDResponse{}
+	for _, spiffeId := range api.spiffeIds {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		uri, _ := url.Parse(spiffeId)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			NotBefore:    time.Now().Add(-time.Minute),
+			NotAfter:     time.Now().Add(time.Hour),
+			URIs:         []*url.URL{uri},
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, api.caCert, key.Public(), api.caKey)
+		if err != nil {
+			return nil, err
+		}
+		keyDer, _ := x509.MarshalPKCS8PrivateKey(key)
+		response.Svids = append(response.Svids, &workload.X509SVID{
+			SpiffeId:    spiffeId,
+			X509Svid:    der,
+			X509SvidKey: keyDer,
+			Bundle:      api.caCert.Raw,
+		})
+	}
+	return response, nil
+}
+
+func (api *testWorkloadAPI) FetchX509SVID(request *workload.X509SVIDRequest, stream workload.SpiffeWorkloadAPI_FetchX509SVIDServer) error {
+	for {
+		response, err := api.issueSVIDs()
+		if err != nil {
+			return err
+		}
+		if err = stream.Send(response); err != nil {
+			return err
+		}
+		select {
+		case <-api.rotate:
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// Starts a Workload API on a Unix domain socket, and returns its address
+func startTestWorkloadAPI(t *testing.T, spiffeIds ...string) (string, *testWorkloadAPI) {
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test SPIFFE CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDer, _ := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	caCert, _ := x509.ParseCertificate(caDer)
+	api := &testWorkloadAPI{caKey: caKey, caCert: caCert, spiffeIds: spiffeIds, rotate: make(chan struct{})}
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	workload.RegisterSpiffeWorkloadAPIServer(server, api)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return "unix://" + socket, api
+}
+
+func TestSPIFFESigner(t *testing.T) {
+	socket, api := startTestWorkloadAPI(t, "spiffe://example.org/a", "spiffe://example.org/b")
+	signer, err := GetSPIFFESigner(socket, "spiffe://example.org/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+
+	cert, err := signer.Certificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.URIs) != 1 || cert.URIs[0].String() != "spiffe://example.org/b" {
+		t.Logf("Unexpected SVID: %v", cert.URIs)
+		t.Fail()
+	}
+
+	msg := []byte("test message")
+	digest := sha256.Sum256(msg)
+	signingResult, err := Sign(msg, SigningOpts{signer, crypto.SHA256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, _ := hex.DecodeString(signingResult.Signature)
+	if !ecdsa.VerifyASN1(cert.PublicKey.(*ecdsa.PublicKey), digest[:], sig) {
+		t.Log("Failed to verify the signature")
+		t.Fail()
+	}
+
+	// A rotated SVID is picked up
+	api.rotate <- struct{}{}
+	for i := 0; i < 50; i++ {
+		rotatedCert, err := signer.Certificate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !rotatedCert.Equal(cert) {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Log("Expected the rotated SVID to be used")
+	t.Fail()
+}
+
+func TestSPIFFESignerUnknownID(t *testing.T) {
+	socket, _ := startTestWorkloadAPI(t, "spiffe://example.org/a")
+	if _, err := GetSPIFFESigner(socket, "spiffe://example.org/other"); err == nil {
+		t.Log("Expected an unknown SPIFFE ID to be rejected")
+		t.Fail()
+	}
+}
@@ -0,0 +1,173 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Signer that uses a key held by a running ssh-agent. Since an agent
+// only signs complete messages (which it hashes itself), rather than
+// digests, this signer implements messageSigner.
+type SSHAgentSigner struct {
+	socket           string
+	publicKey        ssh.PublicKey
+	cert             *x509.Certificate
+	certificateChain []*x509.Certificate
+}
+
+// Creates a signer that uses the ssh-agent key with the given fingerprint
+// (as shown by `ssh-add -l`), along with the certificate (and, optionally,
+// certificate bundle) at the provided paths. If the fingerprint is "any",
+// the key that matches the certificate is used. The agent is reached
+// through the socket in the SSH_AUTH_SOCK environment variable.
+func GetSSHAgentSigner(fingerprint string, certificateId string, certificateBundleId string) (Signer, error) {
+	if fingerprint == "any" {
+		fingerprint = ""
+	}
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, errors.New("SSH_AUTH_SOCK is not set; is ssh-agent running?")
+	}
+	cert, err := readCertificate(certificateId)
+	if err != nil {
+		return nil, err
+	}
+	var certificateChain []*x509.Certificate
+	if certificateBundleId != "" {
+		if certificateChain, err = ReadCertificateBundleData(certificateBundleId); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to ssh-agent: %w", err)
+	}
+	defer conn.Close()
+	keys, err := agent.NewClient(conn).List()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list ssh-agent keys: %w", err)
+	}
+
+	var publicKey ssh.PublicKey
+	for _, key := range keys {
+		if fingerprint != "" && !sshFingerprintMatches(key, fingerprint) {
+			continue
+		}
+		parsedKey, err := ssh.ParsePublicKey(key.Blob)
+		if err != nil {
+			continue
+		}
+		cryptoPublicKey, ok := parsedKey.(ssh.CryptoPublicKey)
+		if !ok || !publicKeysEqual(cert.PublicKey, cryptoPublicKey.CryptoPublicKey()) {
+			if fingerprint != "" {
+				return nil, errors.New("the certificate doesn't match the ssh-agent key")
+			}
+			continue
+		}
+		publicKey = parsedKey
+		break
+	}
+	if publicKey == nil {
+		return nil, errors.New("no matching key found in ssh-agent")
+	}
+
+	switch publicKey.Type() {
+	case ssh.KeyAlgoRSA:
+	case ssh.KeyAlgoECDSA256:
+	default:
+		return nil, fmt.Errorf("unsupported ssh-agent key type: %s", publicKey.Type())
+	}
+	return &SSHAgentSigner{socket, publicKey, cert, certificateChain}, nil
+}
+
+// Whether the agent key has the given SHA-256 (or legacy MD5) fingerprint
+func sshFingerprintMatches(key *agent.Key, fingerprint string) bool {
+	if strings.HasPrefix(fingerprint, "SHA256:") {
+		return ssh.FingerprintSHA256(key) == fingerprint
+	}
+	return ssh.FingerprintLegacyMD5(key) == strings.TrimPrefix(fingerprint, "MD5:")
+}
+
+func (sshAgentSigner *SSHAgentSigner) Public() crypto.PublicKey {
+	return sshAgentSigner.cert.PublicKey
+}
+
+func (sshAgentSigner *SSHAgentSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return nil, errors.New("ssh-agent keys can only sign complete messages")
+}
+
+// Signs the message with the agent key. A new connection is made to the
+// agent every time, so that a restarted agent doesn't break daemon modes.
+func (sshAgentSigner *SSHAgentSigner) SignMessage(message []byte, hash crypto.Hash) ([]byte, error) {
+	var flags agent.SignatureFlags
+	switch sshAgentSigner.publicKey.Type() {
+	case ssh.KeyAlgoRSA:
+		switch hash {
+		case crypto.SHA256:
+			flags = agent.SignatureFlagRsaSha256
+		case crypto.SHA512:
+			flags = agent.SignatureFlagRsaSha512
+		default:
+			return nil, errors.New("unsupported digest")
+		}
+	case ssh.KeyAlgoECDSA256:
+		// The agent always uses the digest that corresponds to the curve
+		if hash != crypto.SHA256 {
+			return nil, errors.New("unsupported digest")
+		}
+	}
+
+	conn, err := net.Dial("unix", sshAgentSigner.socket)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to ssh-agent: %w", err)
+	}
+	defer conn.Close()
+	client, ok := agent.NewClient(conn).(agent.ExtendedAgent)
+	if !ok {
+		return nil, errors.New("unsupported ssh-agent client")
+	}
+	sig, err := client.SignWithFlags(sshAgentSigner.publicKey, message, flags)
+	if err != nil {
+		return nil, fmt.Errorf("ssh-agent signing failed: %w", err)
+	}
+
+	switch sig.Format {
+	case ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSASHA512:
+		return sig.Blob, nil
+	case ssh.KeyAlgoECDSA256:
+		// The SSH signature blob consists of r and s as mpints
+		var ecSig struct {
+			R *big.Int
+			S *big.Int
+		}
+		if err := ssh.Unmarshal(sig.Blob, &ecSig); err != nil {
+			return nil, err
+		}
+		return asn1.Marshal(ecSig)
+	default:
+		return nil, fmt.Errorf("unexpected ssh-agent signature format: %s", sig.Format)
+	}
+}
+
+func (sshAgentSigner *SSHAgentSigner) Certificate() (*x509.Certificate, error) {
+	return sshAgentSigner.cert, nil
+}
+
+func (sshAgentSigner *SSHAgentSigner) CertificateChain() ([]*x509.Certificate, error) {
+	return sshAgentSigner.certificateChain, nil
+}
+
+func (sshAgentSigner *SSHAgentSigner) Close() {
+}
@@ -0,0 +1,131 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Starts an in-process ssh-agent that holds the given private keys, and
+// points SSH_AUTH_SOCK at it
+func startTestSSHAgent(t *testing.T, privateKeyIds ...string) {
+	keyring := agent.NewKeyring()
+	for _, privateKeyId := range privateKeyIds {
+		privateKey, err := ReadPrivateKeyData(privateKeyId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch key := privateKey.(type) {
+		case ecdsa.PrivateKey:
+			err = keyring.Add(agent.AddedKey{PrivateKey: &key})
+		case rsa.PrivateKey:
+			err = keyring.Add(agent.AddedKey{PrivateKey: &key})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				agent.ServeAgent(keyring, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	oldSocket, hadSocket := os.LookupEnv("SSH_AUTH_SOCK")
+	os.Setenv("SSH_AUTH_SOCK", socket)
+	t.Cleanup(func() {
+		if hadSocket {
+			os.Setenv("SSH_AUTH_SOCK", oldSocket)
+		} else {
+			os.Unsetenv("SSH_AUTH_SOCK")
+		}
+	})
+}
+
+func TestSSHAgentSigner(t *testing.T) {
+	startTestSSHAgent(t, "../tst/certs/ec-prime256v1-key.pem", "../tst/certs/rsa-2048-key.pem")
+	msg := []byte("test message")
+	digest := sha256.Sum256(msg)
+
+	for _, certificateId := range []string{"../tst/certs/ec-prime256v1-sha256-cert.pem", "../tst/certs/rsa-2048-sha256-cert.pem"} {
+		signer, err := GetSSHAgentSigner("any", certificateId, "")
+		if err != nil {
+			t.Log(err)
+			t.Fail()
+			continue
+		}
+		signingResult, err := Sign(msg, SigningOpts{signer, crypto.SHA256})
+		signer.Close()
+		if err != nil {
+			t.Log(err)
+			t.Fail()
+			continue
+		}
+		sig, _ := hex.DecodeString(signingResult.Signature)
+
+		valid := false
+		switch publicKey := signer.Public().(type) {
+		case *ecdsa.PublicKey:
+			valid = ecdsa.VerifyASN1(publicKey, digest[:], sig)
+		case *rsa.PublicKey:
+			valid = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], sig) == nil
+		}
+		if !valid {
+			t.Logf("Failed to verify the ssh-agent signature for %s", certificateId)
+			t.Fail()
+		}
+	}
+}
+
+func TestSSHAgentSignerFingerprint(t *testing.T) {
+	startTestSSHAgent(t, "../tst/certs/ec-prime256v1-key.pem", "../tst/certs/rsa-2048-key.pem")
+	certificateId := "../tst/certs/rsa-2048-sha256-cert.pem"
+
+	cert, err := readCertificate(certificateId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := ssh.NewPublicKey(cert.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := GetSSHAgentSigner(ssh.FingerprintSHA256(publicKey), certificateId, "")
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+	} else {
+		signer.Close()
+	}
+
+	// The EC key doesn't match the RSA certificate
+	ecKey, _ := ReadPrivateKeyData("../tst/certs/ec-prime256v1-key.pem")
+	ecPrivateKey := ecKey.(ecdsa.PrivateKey)
+	ecPublicKey, _ := ssh.NewPublicKey(&ecPrivateKey.PublicKey)
+	if _, err = GetSSHAgentSigner(ssh.FingerprintSHA256(ecPublicKey), certificateId, ""); err == nil {
+		t.Log("Expected a mismatched ssh-agent key to be rejected")
+		t.Fail()
+	}
+}
@@ -0,0 +1,123 @@
+package aws_signing_helper
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Path that refers to standard input
+const stdinPath = "-"
+
+// Prefix of paths that refer to an inherited file descriptor (fd://3)
+const fdPathPrefix = "fd://"
+
+// Prefix of paths that refer to an environment variable (env://NAME),
+// holding either PEM data or base64-encoded PEM (or DER) data
+const envPathPrefix = "env://"
+
+// Prefix of paths that refer to a key in a Linux kernel keyring
+// (keyring://user/<description>)
+const keyringPathPrefix = "keyring://"
+
+// Environment variables from which the certificate and private key are
+// read, if they aren't otherwise specified
+const (
+	CertificateEnvVarName = "AWS_ROLESANYWHERE_CERTIFICATE"
+	PrivateKeyEnvVarName  = "AWS_ROLESANYWHERE_PRIVATE_KEY"
+)
+
+var (
+	streamMutex    sync.Mutex
+	streamContents = map[string][]byte{}
+)
+
+// Returns the path through which the credential in the given environment
+// variable is read, or an empty string if the variable isn't set
+func EnvCredentialPath(envVarName string) string {
+	if _, ok := os.LookupEnv(envVarName); !ok {
+		return ""
+	}
+	return envPathPrefix + envVarName
+}
+
+// Whether the path refers to a file, rather than to a stream, an
+// environment variable, or a keyring key
+func isFilePath(path string) bool {
+	return path != stdinPath && !strings.HasPrefix(path, fdPathPrefix) &&
+		!strings.HasPrefix(path, envPathPrefix) && !strings.HasPrefix(path, keyringPathPrefix)
+}
+
+// Reads a file that holds certificates or keys. Besides regular paths, "-"
+// reads standard input, "fd://N" reads the inherited file descriptor N,
+// "env://NAME" reads the environment variable NAME, and
+// "keyring://<keyring>/<description>" reads a key from a Linux kernel
+// keyring, so that credentials can be passed in without being written to
+// disk. Since a stream can only be read once, its contents are kept, so
+// that the certificate and the private key can both be read from the same
+// stream. Files that are protected with DPAPI (or DPAPI-NG) are decrypted
+// on Windows.
+func readCredentialFile(path string) ([]byte, error) {
+	data, err := readCredentialSource(path)
+	if err != nil {
+		return nil, err
+	}
+	return unprotectDPAPI(data)
+}
+
+func readCredentialSource(path string) ([]byte, error) {
+	if strings.HasPrefix(path, envPathPrefix) {
+		return readEnvCredential(strings.TrimPrefix(path, envPathPrefix))
+	}
+	if strings.HasPrefix(path, keyringPathPrefix) {
+		return readKeyringKey(strings.TrimPrefix(path, keyringPathPrefix))
+	}
+	if path != stdinPath && !strings.HasPrefix(path, fdPathPrefix) {
+		return os.ReadFile(path)
+	}
+
+	streamMutex.Lock()
+	defer streamMutex.Unlock()
+	if data, ok := streamContents[path]; ok {
+		return data, nil
+	}
+	var file *os.File
+	if path == stdinPath {
+		file = os.Stdin
+	} else {
+		fd, err := strconv.ParseUint(strings.TrimPrefix(path, fdPathPrefix), 10, 32)
+		if err != nil {
+			return nil, errors.New("invalid file descriptor path: " + path)
+		}
+		file = os.NewFile(uintptr(fd), path)
+		if file == nil {
+			return nil, errors.New("invalid file descriptor: " + path)
+		}
+		defer file.Close()
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	streamContents[path] = data
+	return data, nil
+}
+
+func readEnvCredential(envVarName string) ([]byte, error) {
+	value, ok := os.LookupEnv(envVarName)
+	if !ok {
+		return nil, errors.New("environment variable " + envVarName + " isn't set")
+	}
+	if strings.Contains(value, "-----BEGIN") {
+		return []byte(value), nil
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+	if err != nil {
+		return nil, errors.New("environment variable " + envVarName + " doesn't contain PEM or base64-encoded data")
+	}
+	return data, nil
+}
@@ -0,0 +1,73 @@
+package aws_signing_helper
+
+import (
+	"encoding/base64"
+	"os"
+	"testing"
+)
+
+func TestReadCredentialsFromStdin(t *testing.T) {
+	var data []byte
+	for _, path := range []string{"../tst/certs/rsa-2048-sha256-cert.pem", "../tst/certs/rsa-2048-key.pem"} {
+		fileData, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, fileData...)
+	}
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		writer.Write(data)
+		writer.Close()
+	}()
+	stdin := os.Stdin
+	os.Stdin = reader
+	defer func() {
+		os.Stdin = stdin
+		reader.Close()
+		delete(streamContents, stdinPath)
+	}()
+
+	// Both the certificate and the key are read from the same stream
+	signer, err := GetFileSystemSigner(stdinPath, stdinPath, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := signer.Certificate()
+	if !publicKeysEqual(cert.PublicKey, signer.Public()) {
+		t.Log("Expected the key read from standard input to match the certificate")
+		t.Fail()
+	}
+}
+
+func TestReadCredentialsFromInvalidFd(t *testing.T) {
+	if _, err := readCredentialFile("fd://not-a-number"); err == nil {
+		t.Log("Expected an invalid file descriptor path to be rejected")
+		t.Fail()
+	}
+}
+
+func TestReadCredentialsFromEnv(t *testing.T) {
+	certData, _ := os.ReadFile("../tst/certs/ec-prime256v1-sha256-cert.pem")
+	keyData, _ := os.ReadFile("../tst/certs/ec-prime256v1-key.pem")
+	t.Setenv(CertificateEnvVarName, base64.StdEncoding.EncodeToString(certData))
+	t.Setenv(PrivateKeyEnvVarName, string(keyData))
+
+	signer, err := GetFileSystemSigner(EnvCredentialPath(PrivateKeyEnvVarName), EnvCredentialPath(CertificateEnvVarName), "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := signer.Certificate()
+	if !publicKeysEqual(cert.PublicKey, signer.Public()) {
+		t.Log("Expected the key from the environment to match the certificate")
+		t.Fail()
+	}
+
+	if path := EnvCredentialPath("AWS_ROLESANYWHERE_UNSET_VARIABLE"); path != "" {
+		t.Logf("Expected no path for an unset variable, got %s", path)
+		t.Fail()
+	}
+}
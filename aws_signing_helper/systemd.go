@@ -0,0 +1,143 @@
+package aws_signing_helper
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Environment variables in which systemd passes the sockets of a
+// socket-activated service (see sd_listen_fds(3))
+const (
+	listenPidEnvVarName     = "LISTEN_PID"
+	listenFdsEnvVarName     = "LISTEN_FDS"
+	listenFdNamesEnvVarName = "LISTEN_FDNAMES"
+)
+
+// Environment variables in which systemd passes the socket that
+// notifications are sent to, and the watchdog interval (see sd_notify(3)
+// and sd_watchdog_enabled(3))
+const (
+	notifySocketEnvVarName = "NOTIFY_SOCKET"
+	watchdogUsecEnvVarName = "WATCHDOG_USEC"
+	watchdogPidEnvVarName  = "WATCHDOG_PID"
+)
+
+// First file descriptor that systemd passes sockets in
+const listenFdsStart = 3
+
+// Returns the number of sockets that systemd passed to the process, which
+// is 0 if it wasn't socket-activated
+func systemdListenFds() (int, error) {
+	pid, fds := os.Getenv(listenPidEnvVarName), os.Getenv(listenFdsEnvVarName)
+	if pid == "" || fds == "" {
+		return 0, nil
+	}
+	// The sockets were passed to another process (say, one that exec'd the
+	// helper), if the PID doesn't match
+	if pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil
+	}
+	count, err := strconv.Atoi(fds)
+	if err != nil || count < 0 {
+		return 0, fmt.Errorf("invalid %s: %s", listenFdsEnvVarName, fds)
+	}
+	return count, nil
+}
+
+// Returns the listening socket that systemd passed to the process, if it
+// was socket-activated, or nil otherwise. The environment variables that
+// pass it are cleared, so that processes the helper starts don't take it
+// for their own.
+func systemdListener() (net.Listener, error) {
+	count, err := systemdListenFds()
+	if err != nil {
+		return nil, err
+	}
+	os.Unsetenv(listenPidEnvVarName)
+	os.Unsetenv(listenFdsEnvVarName)
+	os.Unsetenv(listenFdNamesEnvVarName)
+	if count == 0 {
+		return nil, nil
+	}
+	if count > 1 {
+		return nil, fmt.Errorf("expected one socket from systemd, but got %d", count)
+	}
+	file := os.NewFile(uintptr(listenFdsStart), "systemd socket")
+	defer file.Close()
+	return net.FileListener(file)
+}
+
+var notifyReadyOnce sync.Once
+
+// Notifies systemd that the helper is ready (for units with Type=notify),
+// and, if the unit has a watchdog, starts pinging it at half its interval.
+// Does nothing if the helper isn't run by systemd, and only notifies once.
+func notifySystemdReady() {
+	notifyReadyOnce.Do(func() {
+		if os.Getenv(notifySocketEnvVarName) == "" {
+			return
+		}
+		if err := systemdNotify("READY=1"); err != nil {
+			log.Println("unable to notify systemd:", err)
+			return
+		}
+		interval, err := systemdWatchdogInterval()
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if interval == 0 {
+			return
+		}
+		go func() {
+			for range time.Tick(interval / 2) {
+				if err := systemdNotify("WATCHDOG=1"); err != nil {
+					log.Println("unable to notify the systemd watchdog:", err)
+				}
+			}
+		}()
+	})
+}
+
+// Sends a notification to systemd, through the socket in NOTIFY_SOCKET
+func systemdNotify(state string) error {
+	socketPath := os.Getenv(notifySocketEnvVarName)
+	if socketPath == "" {
+		return errors.New("no notification socket")
+	}
+	// Sockets in the abstract namespace are passed with a leading "@"
+	if socketPath[0] == '@' {
+		socketPath = "\x00" + socketPath[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// Returns the interval within which systemd expects the watchdog to be
+// pinged, or 0 if the unit doesn't have a watchdog (or it's meant for a
+// different process)
+func systemdWatchdogInterval() (time.Duration, error) {
+	usec := os.Getenv(watchdogUsecEnvVarName)
+	if usec == "" {
+		return 0, nil
+	}
+	if pid := os.Getenv(watchdogPidEnvVarName); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil
+	}
+	interval, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil || interval <= 0 {
+		return 0, fmt.Errorf("invalid %s: %s", watchdogUsecEnvVarName, usec)
+	}
+	return time.Duration(interval) * time.Microsecond, nil
+}
@@ -0,0 +1,36 @@
+package aws_signing_helper
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Environment variable in which systemd passes the directory that holds
+// the unit's credentials (as set up by LoadCredential= and
+// LoadCredentialEncrypted=)
+const credentialsDirectoryEnvVarName = "CREDENTIALS_DIRECTORY"
+
+// Names of the systemd credentials from which the certificate, private key,
+// and intermediate certificates are read, if they aren't otherwise specified
+const (
+	CertificateCredentialName   = "rolesanywhere-certificate"
+	PrivateKeyCredentialName    = "rolesanywhere-private-key"
+	IntermediatesCredentialName = "rolesanywhere-intermediates"
+)
+
+// Returns the path of the systemd credential with the given name, or an
+// empty string if the helper isn't running in a unit that has it. Since
+// systemd decrypts encrypted credentials (which may be sealed to the TPM)
+// into a non-swappable file system that only the unit can read, they're
+// read the same way as any other file.
+func SystemdCredentialPath(name string) string {
+	credentialsDirectory := os.Getenv(credentialsDirectoryEnvVarName)
+	if credentialsDirectory == "" {
+		return ""
+	}
+	path := filepath.Join(credentialsDirectory, name)
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
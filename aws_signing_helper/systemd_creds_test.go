@@ -0,0 +1,28 @@
+package aws_signing_helper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSystemdCredentialPath(t *testing.T) {
+	credentialsDirectory := t.TempDir()
+	os.WriteFile(filepath.Join(credentialsDirectory, PrivateKeyCredentialName), []byte("key"), 0400)
+
+	t.Setenv(credentialsDirectoryEnvVarName, "")
+	if path := SystemdCredentialPath(PrivateKeyCredentialName); path != "" {
+		t.Logf("Expected no path outside of a unit, got %s", path)
+		t.Fail()
+	}
+
+	t.Setenv(credentialsDirectoryEnvVarName, credentialsDirectory)
+	if path := SystemdCredentialPath(PrivateKeyCredentialName); path != filepath.Join(credentialsDirectory, PrivateKeyCredentialName) {
+		t.Logf("Unexpected credential path %s", path)
+		t.Fail()
+	}
+	if path := SystemdCredentialPath(CertificateCredentialName); path != "" {
+		t.Logf("Expected no path for a missing credential, got %s", path)
+		t.Fail()
+	}
+}
@@ -0,0 +1,83 @@
+package aws_signing_helper
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSystemdListenFds(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	fixtures := []struct {
+		pid           string
+		fds           string
+		expectedCount int
+		expectError   bool
+	}{
+		{"", "", 0, false},
+		{pid, "1", 1, false},
+		{pid, "2", 2, false},
+		{"1", "1", 0, false},
+		{pid, "one", 0, true},
+	}
+	for _, fixture := range fixtures {
+		t.Setenv(listenPidEnvVarName, fixture.pid)
+		t.Setenv(listenFdsEnvVarName, fixture.fds)
+		count, err := systemdListenFds()
+		if count != fixture.expectedCount || (err != nil) != fixture.expectError {
+			t.Logf("LISTEN_PID=%s LISTEN_FDS=%s: unexpected result %d, %v", fixture.pid, fixture.fds, count, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestSystemdNotify(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		t.Skip("unixgram sockets aren't supported:", err)
+	}
+	defer conn.Close()
+	t.Setenv(notifySocketEnvVarName, socketPath)
+
+	if err = systemdNotify("READY=1"); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "READY=1" {
+		t.Logf("unexpected notification %q", buf[:n])
+		t.Fail()
+	}
+}
+
+func TestSystemdWatchdogInterval(t *testing.T) {
+	fixtures := []struct {
+		usec             string
+		pid              string
+		expectedInterval time.Duration
+		expectError      bool
+	}{
+		{"", "", 0, false},
+		{"30000000", "", 30 * time.Second, false},
+		{"30000000", strconv.Itoa(os.Getpid()), 30 * time.Second, false},
+		{"30000000", "1", 0, false},
+		{"-1", "", 0, true},
+	}
+	for _, fixture := range fixtures {
+		t.Setenv(watchdogUsecEnvVarName, fixture.usec)
+		t.Setenv(watchdogPidEnvVarName, fixture.pid)
+		interval, err := systemdWatchdogInterval()
+		if interval != fixture.expectedInterval || (err != nil) != fixture.expectError {
+			t.Logf("WATCHDOG_USEC=%s WATCHDOG_PID=%s: unexpected result %s, %v", fixture.usec, fixture.pid, interval, err)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package aws_signing_helper
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+)
+
+// Minimum TLS versions that can be required of the connection to the
+// endpoint (TLS 1.2 by default)
+const (
+	TLSVersion12 = "1.2"
+	TLSVersion13 = "1.3"
+)
+
+// Cipher suites offered with TLS 1.2, unless the options select others: only
+// those with forward secrecy and authenticated encryption, which the
+// endpoints support
+var defaultCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// Returns the configuration of TLS connections to the endpoint: the minimum
+// version and the cipher suites that the options select, and the CAs
+// against which the endpoint's certificate is verified
+func newTLSConfig(opts *CredentialsOpts) (*tls.Config, error) {
+	minVersion, err := tlsMinVersion(opts.TLSMinVersion)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{MinVersion: minVersion, InsecureSkipVerify: opts.NoVerifySSL}
+	// Cipher suites don't apply if TLS 1.3 is required
+	if minVersion < tls.VersionTLS13 {
+		if tlsConfig.CipherSuites, err = tlsCipherSuites(opts.TLSCipherSuites); err != nil {
+			return nil, err
+		}
+	}
+	if opts.CABundle != "" {
+		if tlsConfig.RootCAs, err = loadCABundle(opts.CABundle); err != nil {
+			return nil, err
+		}
+	}
+	return tlsConfig, nil
+}
+
+// Returns the TLS version that the options require at least
+func tlsMinVersion(version string) (uint16, error) {
+	switch version {
+	case "", TLSVersion12:
+		return tls.VersionTLS12, nil
+	case TLSVersion13:
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported minimum TLS version %s (expected %s or %s)", version, TLSVersion12, TLSVersion13)
+}
+
+// Returns the TLS 1.2 cipher suites with the given (IANA) names, or the
+// default ones, if there are none. Suites that Go deems insecure aren't
+// accepted. TLS 1.3 suites can be named, but they're always offered, since
+// TLS 1.3 only has secure ones.
+func tlsCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return defaultCipherSuites, nil
+	}
+	suitesByName := map[string]*tls.CipherSuite{}
+	for _, suite := range tls.CipherSuites() {
+		suitesByName[suite.Name] = suite
+	}
+	insecure := map[string]bool{}
+	for _, suite := range tls.InsecureCipherSuites() {
+		insecure[suite.Name] = true
+	}
+	var ids []uint16
+	tls12 := false
+	for _, name := range names {
+		suite, ok := suitesByName[name]
+		if !ok {
+			if insecure[name] {
+				return nil, fmt.Errorf("the cipher suite %s is insecure", name)
+			}
+			return nil, fmt.Errorf("unknown cipher suite %s", name)
+		}
+		for _, version := range suite.SupportedVersions {
+			if version == tls.VersionTLS12 {
+				ids = append(ids, suite.ID)
+				tls12 = true
+				break
+			}
+		}
+	}
+	if !tls12 {
+		// An empty list would select Go's defaults, rather than none
+		return nil, errors.New("none of the cipher suites apply to TLS 1.2 (the TLS 1.3 ones are always offered)")
+	}
+	return ids, nil
+}
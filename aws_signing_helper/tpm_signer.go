@@ -0,0 +1,346 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+)
+
+const tss2PrivateKeyBlockType = "TSS2 PRIVATE KEY"
+
+// Default TPM device on Linux; the in-kernel resource manager is used,
+// so that transient handles don't leak between processes
+const DefaultTPMDevice = "/dev/tpmrm0"
+
+// OID identifying a loadable TPM key (as opposed to an importable or
+// sealed one) in the TSS2 PEM format
+var oidLoadableKey = asn1.ObjectIdentifier{2, 23, 133, 10, 1, 3}
+
+// ASN.1 structure of a `TSS2 PRIVATE KEY` PEM block, as defined by the
+// OpenSSL TPM 2.0 engine and provider
+type tpmKey struct {
+	Type      asn1.ObjectIdentifier
+	EmptyAuth bool          `asn1:"optional,explicit,tag:0"`
+	Policy    asn1.RawValue `asn1:"optional,explicit,tag:1"`
+	Secret    []byte        `asn1:"optional,explicit,tag:2"`
+	Parent    int64
+	PublicKey []byte
+	// Private portion of the key, encrypted by the parent
+	PrivateKey []byte
+}
+
+// Template of the primary storage key that TSS2 keys with TPM_RH_OWNER as
+// their parent are created under (see the TCG TPM v2.0 Provisioning
+// Guidance)
+var tpmSRKTemplate = tpm2.Public{
+	Type:       tpm2.AlgECC,
+	NameAlg:    tpm2.AlgSHA256,
+	Attributes: tpm2.FlagFixedTPM | tpm2.FlagFixedParent | tpm2.FlagSensitiveDataOrigin | tpm2.FlagUserWithAuth | tpm2.FlagRestricted | tpm2.FlagDecrypt | tpm2.FlagNoDA,
+	ECCParameters: &tpm2.ECCParams{
+		Symmetric: &tpm2.SymScheme{Alg: tpm2.AlgAES, KeyBits: 128, Mode: tpm2.AlgCFB},
+		CurveID:   tpm2.CurveNISTP256,
+	},
+}
+
+// Signer that uses a private key that is sealed to a TPM 2.0
+type TPMv2Signer struct {
+	mutex            sync.Mutex
+	rw               io.ReadWriteCloser
+	keyHandle        tpmutil.Handle
+	keyPassword      string
+	public           crypto.PublicKey
+	cert             *x509.Certificate
+	certificateChain []*x509.Certificate
+}
+
+// Whether the file at the provided path contains a TSS2 private key
+func isTPMKeyFile(privateKeyId string) bool {
+	_, err := parseDERFromPEM(privateKeyId, tss2PrivateKeyBlockType)
+	return err == nil
+}
+
+// Parses the TSS2 private key in the file at the provided path
+func readTPMKey(privateKeyId string) (tpmKey, error) {
+	var key tpmKey
+	block, err := parseDERFromPEM(privateKeyId, tss2PrivateKeyBlockType)
+	if err != nil {
+		return key, errors.New("could not parse PEM data")
+	}
+	rest, err := asn1.Unmarshal(block.Bytes, &key)
+	if err != nil || len(rest) != 0 {
+		return key, errors.New("could not parse TPM key")
+	}
+	if !key.Type.Equal(oidLoadableKey) {
+		return key, errors.New("only loadable TPM keys are supported")
+	}
+	if len(key.Policy.FullBytes) != 0 {
+		return key, errors.New("TPM keys with policies aren't supported")
+	}
+	return key, nil
+}
+
+// Strips the size prefix of a TPM2B structure
+func unmarshalTPM2B(buf []byte) ([]byte, error) {
+	if len(buf) < 2 || int(buf[0])<<8|int(buf[1]) != len(buf)-2 {
+		return nil, errors.New("invalid TPM2B structure")
+	}
+	return buf[2:], nil
+}
+
+// Adds the size prefix of a TPM2B structure
+func marshalTPM2B(buf []byte) []byte {
+	return append([]byte{byte(len(buf) >> 8), byte(len(buf))}, buf...)
+}
+
+// Creates a signer that uses the TSS2 private key at the provided path,
+// loading it into the TPM at `tpmDevice`. The key password, if the key
+// has one, is obtained through GetPin.
+// Returns the password of the TPM key in the options, if one is given, or
+// else the one read from the key password file. If neither is, the password
+// is obtained in the same way as a PIN, once it's known that the key has
+// one.
+func getTPMKeyPassword(opts *CredentialsOpts) (string, error) {
+	if opts.TpmKeyPassword != "" || opts.TpmKeyPasswordFile == "" {
+		return opts.TpmKeyPassword, nil
+	}
+	return readSecretFile(opts.TpmKeyPasswordFile, "TPM key password")
+}
+
+func GetTPMv2Signer(tpmDevice string, privateKeyId string, certificateId string, certificateBundleId string, keyPassword string, pinFile string) (signer Signer, err error) {
+	key, err := readTPMKey(privateKeyId)
+	if err != nil {
+		return nil, err
+	}
+	publicBlob, err := unmarshalTPM2B(key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	public, err := tpm2.DecodePublic(publicBlob)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := public.Key()
+	if err != nil {
+		return nil, err
+	}
+
+	tpmSigner := &TPMv2Signer{public: publicKey}
+	if tpmSigner.cert, err = readCertificate(certificateId); err != nil {
+		return nil, err
+	}
+	if !publicKeysEqual(tpmSigner.cert.PublicKey, publicKey) {
+		return nil, errors.New("the certificate doesn't match the TPM key")
+	}
+	if certificateBundleId != "" {
+		if tpmSigner.certificateChain, err = ReadCertificateBundleData(certificateBundleId); err != nil {
+			return nil, err
+		}
+	}
+	if !key.EmptyAuth {
+		tpmSigner.keyPassword, err = GetPin(PinOpts{Pin: keyPassword, PinFile: pinFile, Prompt: "Please enter the password for the TPM key:"})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if tpmDevice == "" && runtime.GOOS != "windows" {
+		tpmDevice = DefaultTPMDevice
+	}
+	if tpmSigner.rw, err = openTPM(tpmDevice); err != nil {
+		return nil, fmt.Errorf("unable to open TPM: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tpmSigner.Close()
+		}
+	}()
+
+	if tpmSigner.keyHandle, err = loadTPMKey(tpmSigner.rw, key); err != nil {
+		return nil, err
+	}
+	return tpmSigner, nil
+}
+
+// Loads the TSS2 key into the TPM, under its parent (which is created
+// first, if it's the primary storage key)
+func loadTPMKey(rw io.ReadWriter, key tpmKey) (tpmutil.Handle, error) {
+	publicBlob, err := unmarshalTPM2B(key.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	privateBlob, err := unmarshalTPM2B(key.PrivateKey)
+	if err != nil {
+		return 0, err
+	}
+	parentHandle := tpmutil.Handle(key.Parent)
+	if parentHandle == tpm2.HandleOwner {
+		parentHandle, _, err = tpm2.CreatePrimary(rw, tpm2.HandleOwner, tpm2.PCRSelection{}, "", "", tpmSRKTemplate)
+		if err != nil {
+			return 0, fmt.Errorf("unable to create primary key: %w", err)
+		}
+		defer tpm2.FlushContext(rw, parentHandle)
+	}
+	keyHandle, _, err := tpm2.Load(rw, parentHandle, "", publicBlob, privateBlob)
+	if err != nil {
+		return 0, fmt.Errorf("unable to load TPM key: %w", err)
+	}
+	return keyHandle, nil
+}
+
+// Generates a key of the given type in the TPM, under the primary storage
+// key, and writes it to the given path (which mustn't exist yet) as a TSS2
+// private key without a password, which only this TPM can load. The
+// returned signer has no certificate, and is meant to create a CSR with.
+func GenerateTPMKey(tpmDevice string, keyType string, privateKeyId string) (signer Signer, err error) {
+	template := tpm2.Public{
+		NameAlg:    tpm2.AlgSHA256,
+		Attributes: tpm2.FlagSign | tpm2.FlagFixedTPM | tpm2.FlagFixedParent | tpm2.FlagSensitiveDataOrigin | tpm2.FlagUserWithAuth,
+	}
+	switch strings.ToLower(keyType) {
+	case KeyTypeP256, "":
+		template.Type = tpm2.AlgECC
+		template.ECCParameters = &tpm2.ECCParams{CurveID: tpm2.CurveNISTP256}
+	case KeyTypeP384:
+		template.Type = tpm2.AlgECC
+		template.ECCParameters = &tpm2.ECCParams{CurveID: tpm2.CurveNISTP384}
+	case KeyTypeRSA2048:
+		template.Type = tpm2.AlgRSA
+		template.RSAParameters = &tpm2.RSAParams{KeyBits: 2048}
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", keyType)
+	}
+
+	if tpmDevice == "" && runtime.GOOS != "windows" {
+		tpmDevice = DefaultTPMDevice
+	}
+	tpmSigner := &TPMv2Signer{}
+	if tpmSigner.rw, err = openTPM(tpmDevice); err != nil {
+		return nil, fmt.Errorf("unable to open TPM: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tpmSigner.Close()
+		}
+	}()
+
+	srkHandle, _, err := tpm2.CreatePrimary(tpmSigner.rw, tpm2.HandleOwner, tpm2.PCRSelection{}, "", "", tpmSRKTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create primary key: %w", err)
+	}
+	privateBlob, publicBlob, _, _, _, err := tpm2.CreateKey(tpmSigner.rw, srkHandle, tpm2.PCRSelection{}, "", "", template)
+	tpm2.FlushContext(tpmSigner.rw, srkHandle)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create TPM key: %w", err)
+	}
+	public, err := tpm2.DecodePublic(publicBlob)
+	if err != nil {
+		return nil, err
+	}
+	if tpmSigner.public, err = public.Key(); err != nil {
+		return nil, err
+	}
+
+	key := tpmKey{
+		Type:       oidLoadableKey,
+		EmptyAuth:  true,
+		Parent:     int64(tpm2.HandleOwner),
+		PublicKey:  marshalTPM2B(publicBlob),
+		PrivateKey: marshalTPM2B(privateBlob),
+	}
+	der, err := asn1.Marshal(key)
+	if err != nil {
+		return nil, err
+	}
+	if err = writeNewFile(privateKeyId, pem.EncodeToMemory(&pem.Block{Type: tss2PrivateKeyBlockType, Bytes: der})); err != nil {
+		return nil, err
+	}
+	if tpmSigner.keyHandle, err = loadTPMKey(tpmSigner.rw, key); err != nil {
+		return nil, err
+	}
+	return tpmSigner, nil
+}
+
+func openTPM(tpmDevice string) (io.ReadWriteCloser, error) {
+	if tpmDevice == "" {
+		return tpm2.OpenTPM()
+	}
+	if _, err := os.Stat(tpmDevice); err != nil {
+		return nil, err
+	}
+	return tpm2.OpenTPM(tpmDevice)
+}
+
+func (tpmSigner *TPMv2Signer) Public() crypto.PublicKey {
+	return tpmSigner.public
+}
+
+// Signs the digest with the key in the TPM. ECDSA signatures are
+// converted into their ASN.1 encoding.
+func (tpmSigner *TPMv2Signer) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hashAlg, err := tpm2.HashToAlgorithm(opts.HashFunc())
+	if err != nil {
+		return nil, errors.New("unsupported digest")
+	}
+	var scheme *tpm2.SigScheme
+	switch tpmSigner.public.(type) {
+	case *rsa.PublicKey:
+		scheme = &tpm2.SigScheme{Alg: tpm2.AlgRSASSA, Hash: hashAlg}
+	case *ecdsa.PublicKey:
+		scheme = &tpm2.SigScheme{Alg: tpm2.AlgECDSA, Hash: hashAlg}
+	default:
+		return nil, errors.New("unsupported algorithm")
+	}
+
+	// A TPM can only process a single command at a time
+	tpmSigner.mutex.Lock()
+	defer tpmSigner.mutex.Unlock()
+	sig, err := tpm2.Sign(tpmSigner.rw, tpmSigner.keyHandle, tpmSigner.keyPassword, digest, nil, scheme)
+	if err != nil {
+		return nil, err
+	}
+	if sig.ECC != nil {
+		return asn1.Marshal(struct {
+			R, S *big.Int
+		}{sig.ECC.R, sig.ECC.S})
+	}
+	return sig.RSA.Signature, nil
+}
+
+func (tpmSigner *TPMv2Signer) Certificate() (*x509.Certificate, error) {
+	return tpmSigner.cert, nil
+}
+
+func (tpmSigner *TPMv2Signer) CertificateChain() ([]*x509.Certificate, error) {
+	return tpmSigner.certificateChain, nil
+}
+
+func (tpmSigner *TPMv2Signer) Close() {
+	if tpmSigner.rw == nil {
+		return
+	}
+	if tpmSigner.keyHandle != 0 {
+		tpm2.FlushContext(tpmSigner.rw, tpmSigner.keyHandle)
+	}
+	tpmSigner.rw.Close()
+	tpmSigner.rw = nil
+}
+
+// Whether the two public keys are the same
+func publicKeysEqual(a crypto.PublicKey, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
@@ -3,7 +3,6 @@ package aws_signing_helper
 import (
 	"bufio"
 	"log"
-	"math"
 	"os"
 	"path/filepath"
 	"strings"
@@ -24,11 +23,50 @@ type TemporaryCredential struct {
 
 // Updates credentials in the credentials file for the specified profile
 func Update(credentialsOptions CredentialsOpts, profile string, once bool) {
+	UpdateFile(credentialsOptions, "", profile, once)
+}
+
+// Updates credentials for the specified profile in the given credentials
+// file (an INI file in the format of the shared credentials file), or, if
+// none is given, in the shared credentials file
+func UpdateFile(credentialsOptions CredentialsOpts, credentialsFile string, profile string, once bool) {
 	var refreshableCred = TemporaryCredential{}
 	var nextRefreshTime time.Time
+
+	signer, err := GetSigner(&credentialsOptions)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer signer.Close()
+	watchSigner(signer)
+	hangups := notifyHangup()
+	// On SIGHUP, the certificate and key are read again, and, if the
+	// certificate changed, the credentials are refreshed with it right away
+	waitForRefresh := func() {
+		for waiting := true; waiting; {
+			select {
+			case <-time.After(time.Until(nextRefreshTime)):
+				waiting = false
+			case <-hangups:
+				waiting = !reloadSigner(signer)
+			}
+		}
+	}
+
 	for {
-		credentialProcessOutput, err := GenerateCredentials(&credentialsOptions)
+		issued := time.Now()
+		credentialProcessOutput, err := generateCredentialsWithBreaker(&credentialsOptions, signer)
 		if err != nil {
+			// The credentials in the file can still be used until they
+			// expire, so they're left there if new ones can't be obtained
+			// because of a transient failure, and obtaining new ones is
+			// retried a minute later
+			if !once && isTransientError(err) && time.Now().Add(time.Minute).Before(refreshableCred.Expiration) {
+				log.Printf("unable to refresh credentials (transient error), so the previous ones, which expire at %s, are left in the credentials file: %v", refreshableCred.Expiration.Format(time.RFC3339), err)
+				nextRefreshTime = time.Now().Add(time.Minute)
+				waitForRefresh()
+				continue
+			}
 			log.Fatal(err)
 		}
 
@@ -42,42 +80,84 @@ func Update(credentialsOptions CredentialsOpts, profile string, once bool) {
 			syscall.Exit(1)
 		}
 
-		// Get credentials file contents
-		lines, err := GetCredentialsFileContents()
-		if err != nil {
-			log.Println("unable to get credentials file contents")
-			syscall.Exit(1)
-		}
-
-		// Write to credentials file
-		err = WriteTo(profile, lines, &refreshableCred)
-		if err != nil {
-			log.Println("unable to write to AWS credentials file")
+		// Update the credentials file, while holding its lock so that other
+		// processes updating it (say, for other profiles) don't interleave
+		// their changes with these
+		if err = updateCredentialsFile(credentialsFile, profile, &refreshableCred); err != nil {
+			log.Println("unable to update AWS credentials file:", err)
 			syscall.Exit(1)
 		}
 
 		if once {
 			break
 		}
-		nextRefreshTime = refreshableCred.Expiration.Add(-UpdateRefreshTime)
+		notifySystemdReady()
+		nextRefreshTime = scheduleRefresh(issued, refreshableCred.Expiration, UpdateRefreshTime)
 		log.Println("Credentials will be refreshed at", nextRefreshTime.String())
-		time.Sleep(time.Until(nextRefreshTime))
+		waitForRefresh()
 	}
 }
 
-// Assume that the credentials file is located in the default path: `~/.aws/credentials`
-func GetCredentialsFileContents() ([]string, error) {
+// Updates the credentials of the profile in the credentials file, while
+// holding a lock on it
+func updateCredentialsFile(credentialsFile string, profile string, cred *TemporaryCredential) error {
+	awsCredentialsPath, err := credentialsFilePath(credentialsFile)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(awsCredentialsPath), 0700); err != nil {
+		return err
+	}
+	// The credentials file itself is replaced when it's written, so a
+	// separate file is locked
+	lock, err := os.OpenFile(awsCredentialsPath+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err = lockFile(lock); err != nil {
+		return err
+	}
+	defer unlockFile(lock)
+
+	lines, err := readCredentialsFile(awsCredentialsPath)
+	if err != nil {
+		return err
+	}
+	return writeCredentialsFile(awsCredentialsPath, profile, lines, cred)
+}
+
+// Finds the credentials file: the given one, or else the one in the
+// AWS_SHARED_CREDENTIALS_FILE environment variable, or else the one in the
+// default path: `~/.aws/credentials`
+func credentialsFilePath(credentialsFile string) (string, error) {
+	if credentialsFile != "" {
+		return credentialsFile, nil
+	}
+	awsCredentialsPath := os.Getenv(AwsSharedCredentialsFileEnvVarName)
+	if awsCredentialsPath != "" {
+		return awsCredentialsPath, nil
+	}
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		log.Println("unable to locate the home directory")
-		return nil, err
+		return "", err
 	}
+	return filepath.Join(homeDir, ".aws", "credentials"), nil
+}
 
-	awsCredentialsPath := os.Getenv(AwsSharedCredentialsFileEnvVarName)
-	if awsCredentialsPath == "" {
-		awsCredentialsPath = filepath.Join(homeDir, ".aws", "credentials")
+// Reads the lines of the shared credentials file, creating it if it doesn't
+// exist
+func GetCredentialsFileContents() ([]string, error) {
+	awsCredentialsPath, err := credentialsFilePath("")
+	if err != nil {
+		return nil, err
 	}
-	if err = os.MkdirAll(filepath.Dir(awsCredentialsPath), 0600); err != nil {
+	return readCredentialsFile(awsCredentialsPath)
+}
+
+func readCredentialsFile(awsCredentialsPath string) ([]string, error) {
+	if err := os.MkdirAll(filepath.Dir(awsCredentialsPath), 0700); err != nil {
 		log.Println("unable to create credentials file")
 		return nil, err
 	}
@@ -85,7 +165,7 @@ func GetCredentialsFileContents() ([]string, error) {
 	readOnlyCredentialsFile, err := os.OpenFile(awsCredentialsPath, os.O_RDONLY|os.O_CREATE, 0600)
 	if err != nil {
 		log.Println("unable to get or create read-only AWS credentials file")
-		syscall.Exit(1)
+		return nil, err
 	}
 	defer readOnlyCredentialsFile.Close()
 
@@ -100,25 +180,35 @@ func GetCredentialsFileContents() ([]string, error) {
 
 // Assume that the credentials file exists already and open it for write operations
 func GetWriteOnlyCredentialsFile() (*os.File, error) {
-	homeDir, _ := os.UserHomeDir()
-	awsCredentialsPath := os.Getenv(AwsSharedCredentialsFileEnvVarName)
-	if awsCredentialsPath == "" {
-		awsCredentialsPath = filepath.Join(homeDir, ".aws", "credentials")
+	awsCredentialsPath, err := credentialsFilePath("")
+	if err != nil {
+		return nil, err
 	}
 	return os.OpenFile(awsCredentialsPath, os.O_WRONLY, 0200)
 }
 
-// Function to write existing credentials and newly-created credentials to a destination file
+// Function to write existing credentials and newly-created credentials to a
+// destination file. The contents are written to a temporary file that then
+// replaces the credentials file, so that readers never see a partially
+// written one.
 func WriteTo(profileName string, writeLines []string, cred *TemporaryCredential) error {
-	destFile, err := GetWriteOnlyCredentialsFile()
+	awsCredentialsPath, err := credentialsFilePath("")
+	if err != nil {
+		return err
+	}
+	return writeCredentialsFile(awsCredentialsPath, profileName, writeLines, cred)
+}
+
+func writeCredentialsFile(awsCredentialsPath string, profileName string, writeLines []string, cred *TemporaryCredential) error {
+	destFile, err := os.CreateTemp(filepath.Dir(awsCredentialsPath), "."+filepath.Base(awsCredentialsPath)+".*")
 	if err != nil {
-		log.Println("unable to get write-only AWS credentials file")
-		syscall.Exit(1)
+		log.Println("unable to create temporary AWS credentials file")
+		return err
 	}
+	defer os.Remove(destFile.Name())
 	defer destFile.Close()
 
-	// Create buffered writer with a buffer of maximum size
-	destFileWriter := bufio.NewWriterSize(destFile, math.MaxInt32)
+	destFileWriter := bufio.NewWriter(destFile)
 
 	var profileExist = false
 	var profileSection = "[" + profileName + "]"
@@ -185,7 +275,15 @@ func WriteTo(profileName string, writeLines []string, cred *TemporaryCredential)
 		return err
 	}
 
-	// Flush the contents of the buffer
-	destFileWriter.Flush()
-	return nil
+	// Flush the contents of the buffer, and replace the credentials file
+	if err = destFileWriter.Flush(); err != nil {
+		return err
+	}
+	if err = destFile.Sync(); err != nil {
+		return err
+	}
+	if err = destFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(destFile.Name(), awsCredentialsPath)
 }
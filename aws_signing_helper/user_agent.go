@@ -0,0 +1,106 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Environment variable that sets the application ID in the User-Agent, as
+// with the AWS SDKs
+const UserAgentAppIdEnvVarName = "AWS_SDK_UA_APP_ID"
+
+// Longest application ID that the SDKs accept
+const maxUserAgentAppIdLength = 50
+
+// Returns the application ID that the options set, or else the one in the
+// environment
+func userAgentAppId(opts *CredentialsOpts) string {
+	if opts.UserAgentAppId != "" {
+		return opts.UserAgentAppId
+	}
+	return os.Getenv(UserAgentAppIdEnvVarName)
+}
+
+// Returns what's appended to the User-Agent of requests, in the format of
+// the SDKs: md/<key>#<value> for each key=value pair of metadata, and then
+// app/<id> for the application ID, so that requests from different fleets or
+// tools can be told apart in the service's logs
+func userAgentSuffix(opts *CredentialsOpts) (string, error) {
+	var parts []string
+	for _, metadata := range opts.UserAgentMetadata {
+		key, value, ok := strings.Cut(metadata, "=")
+		if !ok || key == "" || value == "" {
+			return "", fmt.Errorf("invalid User-Agent metadata %s (expected key=value)", metadata)
+		}
+		if !isUserAgentToken(key) || !isUserAgentToken(value) {
+			return "", fmt.Errorf("invalid User-Agent metadata %s (only letters, digits, and !$%%&'*+-.^_`|~ are allowed)", metadata)
+		}
+		parts = append(parts, "md/"+key+"#"+value)
+	}
+	if appId := userAgentAppId(opts); appId != "" {
+		if len(appId) > maxUserAgentAppIdLength {
+			return "", fmt.Errorf("the application ID %s is longer than %d characters", appId, maxUserAgentAppIdLength)
+		}
+		if !isUserAgentToken(appId) {
+			return "", errors.New("invalid application ID " + appId + " (only letters, digits, and !$%&'*+-.^_`|~ are allowed)")
+		}
+		parts = append(parts, "app/"+appId)
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// Whether the string only has characters that can appear in a token of the
+// User-Agent (other than #, which separates the keys of metadata from their
+// values)
+func isUserAgentToken(s string) bool {
+	for _, c := range s {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.ContainsRune("!$%&'*+-.^_`|~", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns an API option that appends the given product (if there's one),
+// and then the application ID and metadata that the options set, to the
+// User-Agent of requests, after whatever the SDK sets it to
+func addToUserAgent(opts *CredentialsOpts, product string) (func(*middleware.Stack) error, error) {
+	suffix, err := userAgentSuffix(opts)
+	if err != nil {
+		return nil, err
+	}
+	value := strings.TrimSpace(product + " " + suffix)
+	return func(stack *middleware.Stack) error {
+		if value == "" {
+			return nil
+		}
+		return stack.Build.Add(&userAgentAppender{value}, middleware.After)
+	}, nil
+}
+
+type userAgentAppender struct {
+	value string
+}
+
+func (*userAgentAppender) ID() string {
+	return "v4x509.UserAgent"
+}
+
+func (appender *userAgentAppender) HandleBuild(ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler) (
+	out middleware.BuildOutput, metadata middleware.Metadata, err error,
+) {
+	if request, ok := in.Request.(*smithyhttp.Request); ok {
+		value := appender.value
+		if userAgent := request.Header.Get("User-Agent"); userAgent != "" {
+			value = userAgent + " " + value
+		}
+		request.Header.Set("User-Agent", value)
+	}
+	return next.HandleBuild(ctx, in)
+}
@@ -0,0 +1,60 @@
+package aws_signing_helper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestUserAgentAppId(t *testing.T) {
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(mockedCreateSessionResponse))
+	}))
+	defer server.Close()
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+		Version:           "1.0.0",
+		UserAgentAppId:    "payments-batch",
+		UserAgentMetadata: []string{"fleet=on-prem-east"},
+	}
+	if _, err := GenerateCredentials(&credentialsOpts); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(userAgent, "CredHelper/1.0.0") || !strings.HasSuffix(userAgent, " md/fleet#on-prem-east app/payments-batch") {
+		t.Log("unexpected User-Agent:", userAgent)
+		t.Fail()
+	}
+
+	// The application ID can also come from the environment
+	os.Setenv(UserAgentAppIdEnvVarName, "from-env")
+	defer os.Unsetenv(UserAgentAppIdEnvVarName)
+	credentialsOpts.UserAgentAppId = ""
+	credentialsOpts.UserAgentMetadata = nil
+	if _, err := GenerateCredentials(&credentialsOpts); err != nil || !strings.HasSuffix(userAgent, " app/from-env") {
+		t.Log("the application ID in the environment wasn't used:", userAgent, err)
+		t.Fail()
+	}
+
+	for _, opts := range []CredentialsOpts{
+		{UserAgentAppId: "has spaces"},
+		{UserAgentAppId: strings.Repeat("a", maxUserAgentAppIdLength+1)},
+		{UserAgentMetadata: []string{"no-value"}},
+		{UserAgentMetadata: []string{"key=has#hash"}},
+	} {
+		if _, err := userAgentSuffix(&opts); err == nil {
+			t.Log("invalid User-Agent options were accepted:", opts.UserAgentAppId, opts.UserAgentMetadata)
+			t.Fail()
+		}
+	}
+}
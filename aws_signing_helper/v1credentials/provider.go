@@ -0,0 +1,61 @@
+// Package v1credentials provides credentials obtained from IAM Roles
+// Anywhere to sessions of aws-sdk-go (v1), which haven't migrated to
+// aws-sdk-go-v2. It's kept apart from the aws_signing_helper package so
+// that only the applications that use it depend on aws-sdk-go.
+package v1credentials
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+)
+
+// Provider of credentials, obtained from IAM Roles Anywhere with the given
+// options, for sessions of aws-sdk-go (v1). The credentials.Credentials
+// that wrap it keep the credentials until they expire (or until
+// ExpiryWindow before that).
+type RolesAnywhereCredentialsProvider struct {
+	credentials.Expiry
+
+	// How long before the credentials expire that they're reported as
+	// expired, and obtained again, so that they don't expire mid-request
+	ExpiryWindow time.Duration
+
+	provider *helper.RolesAnywhereCredentialsProvider
+}
+
+// Returns a provider of credentials obtained with the given options, which
+// are copied, so later changes to them don't affect the provider
+func NewRolesAnywhereCredentialsProvider(opts helper.CredentialsOpts) *RolesAnywhereCredentialsProvider {
+	return &RolesAnywhereCredentialsProvider{provider: helper.NewRolesAnywhereCredentialsProvider(opts)}
+}
+
+// Returns credentials, for sessions of aws-sdk-go (v1), that are obtained
+// with the given options
+func NewRolesAnywhereCredentials(opts helper.CredentialsOpts) *credentials.Credentials {
+	return credentials.NewCredentials(NewRolesAnywhereCredentialsProvider(opts))
+}
+
+// Obtains credentials from IAM Roles Anywhere (assuming the chained roles
+// in the options, if there are any)
+func (p *RolesAnywhereCredentialsProvider) Retrieve() (credentials.Value, error) {
+	return p.RetrieveWithContext(context.Background())
+}
+
+// Obtains credentials from IAM Roles Anywhere, abandoning the requests in
+// flight when the context is done
+func (p *RolesAnywhereCredentialsProvider) RetrieveWithContext(ctx credentials.Context) (credentials.Value, error) {
+	creds, err := p.provider.Retrieve(ctx)
+	if err != nil {
+		return credentials.Value{ProviderName: helper.CredentialsSource}, err
+	}
+	p.SetExpiration(creds.Expires, p.ExpiryWindow)
+	return credentials.Value{
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.SessionToken,
+		ProviderName:    creds.Source,
+	}, nil
+}
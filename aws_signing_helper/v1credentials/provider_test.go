@@ -0,0 +1,122 @@
+package v1credentials
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+)
+
+// Response of the mocked CreateSession API, with the expiration replaced by
+// the server
+const mockedCreateSessionResponse = `{
+			"credentialSet":[
+			  {
+				"assumedRoleUser": {
+				"arn": "arn:aws:sts::000000000000:assumed-role/ExampleS3WriteRole",
+				"assumedRoleId": "assumedRoleId"
+				},
+				"credentials":{
+				  "accessKeyId": "accessKeyId",
+				  "expiration": "2022-07-27T04:36:55Z",
+				  "secretAccessKey": "secretAccessKey",
+				  "sessionToken": "sessionToken"
+				},
+				"packedPolicySize": 10,
+				"roleArn": "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+				"sourceIdentity": "sourceIdentity"
+			  }
+			],
+			"subjectArn": "arn:aws:rolesanywhere:us-east-1:000000000000:subject/41cl0bae-6783-40d4-ab20-65dc5d922e45"
+		  }`
+
+// Returns the options with which credentials are obtained from the server
+func getCredentialsOpts(server *httptest.Server) helper.CredentialsOpts {
+	return helper.CredentialsOpts{
+		PrivateKeyId:      "../../credential-process-data/client-key.pem",
+		CertificateId:     "../../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+}
+
+func TestRolesAnywhereCredentialsProvider(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		expiration := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(strings.Replace(mockedCreateSessionResponse, "2022-07-27T04:36:55Z", expiration, 1)))
+	}))
+	defer server.Close()
+	credentialsOpts := getCredentialsOpts(server)
+	creds := NewRolesAnywhereCredentials(credentialsOpts)
+
+	value, err := creds.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value.AccessKeyID != "accessKeyId" || value.SecretAccessKey != "secretAccessKey" || value.SessionToken != "sessionToken" ||
+		value.ProviderName != helper.CredentialsSource {
+		t.Log("unexpected credentials:", value)
+		t.Fail()
+	}
+	if expiresAt, err := creds.ExpiresAt(); err != nil || time.Until(expiresAt) < 59*time.Minute {
+		t.Log("unexpected expiration:", expiresAt, err)
+		t.Fail()
+	}
+	// The credentials are kept until they expire
+	if _, err := creds.Get(); err != nil || atomic.LoadInt32(&requests) != 1 {
+		t.Log("the credentials weren't kept:", err)
+		t.Fail()
+	}
+
+	// With an expiry window longer than their lifetime, they're obtained
+	// again each time
+	provider := NewRolesAnywhereCredentialsProvider(credentialsOpts)
+	provider.ExpiryWindow = 2 * time.Hour
+	if _, err := provider.Retrieve(); err != nil || !provider.IsExpired() {
+		t.Log("the expiry window wasn't applied:", err)
+		t.Fail()
+	}
+}
+
+func TestRolesAnywhereCredentialsProviderCancellation(t *testing.T) {
+	t.Setenv(helper.MaxAttemptsEnvVarName, "1")
+	// The server holds requests until they're abandoned (or for at most 10
+	// seconds, so that the test fails rather than hangs)
+	received := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		received <- struct{}{}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	// Canceling the context abandons the request that's in flight. (Sessions'
+	// credentials.Credentials return as soon as their context is done, but
+	// don't pass that on to the provider, so it's called directly.)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-received
+		cancel()
+	}()
+	start := time.Now()
+	if _, err := NewRolesAnywhereCredentialsProvider(getCredentialsOpts(server)).RetrieveWithContext(ctx); !errors.Is(err, context.Canceled) || time.Since(start) > 5*time.Second {
+		t.Log("the request in flight wasn't abandoned:", err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,106 @@
+package aws_signing_helper
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+// Limits of the duration of the sessions that CreateSession vends, in
+// seconds
+const (
+	MinSessionDuration = 900
+	MaxSessionDuration = 43200
+)
+
+// Checks the configuration of credential-process (or update, or serve)
+// without calling AWS: that the ARNs are consistent with each other (and
+// with the region), that the session duration is within the limits, and
+// everything that SelfTest checks. If the trust anchor's CA certificates
+// (or a bundle of them) are provided, it's also checked that the
+// certificate chains up to one of them.
+func Validate(opts *CredentialsOpts, trustAnchorCertificateId string) []CheckResult {
+	results := []CheckResult{
+		{"role, profile, and trust anchor ARNs are consistent", validateArns(opts)},
+		{fmt.Sprintf("session duration is between %d and %d seconds", MinSessionDuration, MaxSessionDuration), validateSessionDuration(opts.SessionDuration)},
+	}
+
+	var trustAnchors []*x509.Certificate
+	if trustAnchorCertificateId != "" {
+		certs, err := ReadCertificateBundleData(trustAnchorCertificateId)
+		if err == nil && len(certs) == 0 {
+			err = errors.New("no certificates found")
+		}
+		results = append(results, CheckResult{"read the trust anchor's CA certificates", err})
+		if err != nil {
+			return results
+		}
+		trustAnchors = certs
+	}
+	return append(results, selfTest(opts, trustAnchors)...)
+}
+
+// Checks that the role, profile, and trust anchor ARNs are valid, and that
+// they're in the same partition and account, and (apart from the role,
+// since IAM is global) in the same region, which is also the one that
+// requests are sent to
+func validateArns(opts *CredentialsOpts) error {
+	var problems []string
+	parse := func(name string, value string, service string, resourceType string) *arn.ARN {
+		if value == "" {
+			problems = append(problems, "the "+name+" ARN is missing")
+			return nil
+		}
+		parsed, err := arn.Parse(value)
+		if err != nil {
+			problems = append(problems, "the "+name+" ARN is invalid: "+err.Error())
+			return nil
+		}
+		if parsed.Service != service || !strings.HasPrefix(parsed.Resource, resourceType+"/") {
+			problems = append(problems, fmt.Sprintf("the %s ARN doesn't identify a %s (%s:%s/...)", name, name, service, resourceType))
+			return nil
+		}
+		return &parsed
+	}
+	roleArn := parse("role", opts.RoleArn, "iam", "role")
+	profileArn := parse("profile", opts.ProfileArnStr, "rolesanywhere", "profile")
+	trustAnchorArn := parse("trust anchor", opts.TrustAnchorArnStr, "rolesanywhere", "trust-anchor")
+
+	if profileArn != nil && trustAnchorArn != nil {
+		if profileArn.Partition != trustAnchorArn.Partition || profileArn.Region != trustAnchorArn.Region {
+			problems = append(problems, fmt.Sprintf("the profile (in %s) and the trust anchor (in %s) are in different regions",
+				profileArn.Region, trustAnchorArn.Region))
+		}
+		if profileArn.AccountID != trustAnchorArn.AccountID {
+			problems = append(problems, fmt.Sprintf("the profile (in account %s) and the trust anchor (in account %s) are in different accounts",
+				profileArn.AccountID, trustAnchorArn.AccountID))
+		}
+		if opts.Region != "" && opts.Region != trustAnchorArn.Region {
+			problems = append(problems, fmt.Sprintf("requests are sent to %s, but the trust anchor is in %s", opts.Region, trustAnchorArn.Region))
+		}
+	}
+	if roleArn != nil && profileArn != nil {
+		if roleArn.Partition != profileArn.Partition {
+			problems = append(problems, fmt.Sprintf("the role (in partition %s) and the profile (in partition %s) are in different partitions",
+				roleArn.Partition, profileArn.Partition))
+		}
+		if roleArn.AccountID != profileArn.AccountID {
+			problems = append(problems, fmt.Sprintf("the role (in account %s) and the profile (in account %s) are in different accounts",
+				roleArn.AccountID, profileArn.AccountID))
+		}
+	}
+	if len(problems) != 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func validateSessionDuration(sessionDuration int) error {
+	if sessionDuration < MinSessionDuration || sessionDuration > MaxSessionDuration {
+		return fmt.Errorf("the session duration (%d seconds) has to be between %d and %d seconds", sessionDuration, MinSessionDuration, MaxSessionDuration)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package aws_signing_helper
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateArns(t *testing.T) {
+	const (
+		role        = "arn:aws:iam::000000000000:role/ExampleS3WriteRole"
+		profile     = "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45"
+		trustAnchor = "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45"
+	)
+	fixtures := []struct {
+		name  string
+		opts  CredentialsOpts
+		valid bool
+	}{
+		{"consistent ARNs", CredentialsOpts{RoleArn: role, ProfileArnStr: profile, TrustAnchorArnStr: trustAnchor}, true},
+		{"matching region", CredentialsOpts{RoleArn: role, ProfileArnStr: profile, TrustAnchorArnStr: trustAnchor, Region: "us-east-1"}, true},
+		{"missing role", CredentialsOpts{ProfileArnStr: profile, TrustAnchorArnStr: trustAnchor}, false},
+		{"invalid profile", CredentialsOpts{RoleArn: role, ProfileArnStr: "profile", TrustAnchorArnStr: trustAnchor}, false},
+		{"swapped profile and trust anchor", CredentialsOpts{RoleArn: role, ProfileArnStr: trustAnchor, TrustAnchorArnStr: profile}, false},
+		{"different regions", CredentialsOpts{RoleArn: role, ProfileArnStr: profile,
+			TrustAnchorArnStr: "arn:aws:rolesanywhere:us-west-2:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45"}, false},
+		{"different accounts", CredentialsOpts{RoleArn: "arn:aws:iam::111111111111:role/ExampleS3WriteRole", ProfileArnStr: profile, TrustAnchorArnStr: trustAnchor}, false},
+		{"different partitions", CredentialsOpts{RoleArn: "arn:aws-cn:iam::000000000000:role/ExampleS3WriteRole", ProfileArnStr: profile, TrustAnchorArnStr: trustAnchor}, false},
+		{"different signing region", CredentialsOpts{RoleArn: role, ProfileArnStr: profile, TrustAnchorArnStr: trustAnchor, Region: "eu-west-1"}, false},
+	}
+	for _, fixture := range fixtures {
+		err := validateArns(&fixture.opts)
+		if (err == nil) != fixture.valid {
+			t.Logf("Unexpected result for %s: %v", fixture.name, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestValidateSessionDuration(t *testing.T) {
+	fixtures := []struct {
+		sessionDuration int
+		valid           bool
+	}{
+		{899, false},
+		{900, true},
+		{3600, true},
+		{43200, true},
+		{43201, false},
+	}
+	for _, fixture := range fixtures {
+		if err := validateSessionDuration(fixture.sessionDuration); (err == nil) != fixture.valid {
+			t.Logf("Unexpected result for a session duration of %d seconds: %v", fixture.sessionDuration, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestValidateTrustAnchor(t *testing.T) {
+	dir := t.TempDir()
+	writePEM := func(name string, blockType string, der []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	root, rootKey := createChainTestCertificate(t, "Root", nil, nil)
+	intermediate, intermediateKey := createChainTestCertificate(t, "Intermediate", root, rootKey)
+	leaf, leafKey := createChainTestCertificate(t, "Leaf", intermediate, intermediateKey)
+	otherRoot, _ := createChainTestCertificate(t, "Other Root", nil, nil)
+	leafKeyDer, err := x509.MarshalECPrivateKey(leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := CredentialsOpts{
+		CertificateId:       writePEM("leaf.pem", "CERTIFICATE", leaf.Raw),
+		PrivateKeyId:        writePEM("leaf-key.pem", "EC PRIVATE KEY", leafKeyDer),
+		CertificateBundleId: writePEM("intermediate.pem", "CERTIFICATE", intermediate.Raw),
+		RoleArn:             "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:       "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr:   "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		SessionDuration:     3600,
+	}
+	fixtures := []struct {
+		name        string
+		trustAnchor string
+		valid       bool
+	}{
+		{"without a trust anchor", "", true},
+		{"with the root", writePEM("root.pem", "CERTIFICATE", root.Raw), true},
+		{"with another root", writePEM("other-root.pem", "CERTIFICATE", otherRoot.Raw), false},
+		{"with a missing file", filepath.Join(dir, "missing.pem"), false},
+	}
+	for _, fixture := range fixtures {
+		results := Validate(&opts, fixture.trustAnchor)
+		if ChecksPassed(results) != fixture.valid {
+			t.Logf("Unexpected validation outcome %s:", fixture.name)
+			for _, result := range results {
+				t.Log(result.Check, result.Err)
+			}
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options for reaching HashiCorp Vault
+type VaultOpts struct {
+	// Address of the Vault server (VAULT_ADDR, if not provided)
+	Addr string
+	// AppRole credentials. If no role ID is provided, the token in
+	// VAULT_TOKEN (or else, ~/.vault-token) is used.
+	RoleId       string
+	SecretIdFile string
+}
+
+// Minimal client for the Vault HTTP API
+type vaultClient struct {
+	mutex        sync.Mutex
+	addr         string
+	namespace    string
+	httpClient   *http.Client
+	token        string
+	roleId       string
+	secretIdFile string
+}
+
+func newVaultClient(opts VaultOpts) (*vaultClient, error) {
+	addr := opts.Addr
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+	if addr == "" {
+		return nil, errors.New("no Vault address provided (use --vault-addr or VAULT_ADDR)")
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caCertPath := os.Getenv("VAULT_CACERT"); caCertPath != "" {
+		caCertData, err := os.ReadFile(caCertPath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read VAULT_CACERT: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCertData) {
+			return nil, errors.New("no certificates found in VAULT_CACERT")
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	client := &vaultClient{
+		addr:         strings.TrimSuffix(addr, "/"),
+		namespace:    os.Getenv("VAULT_NAMESPACE"),
+		httpClient:   &http.Client{Transport: transport, Timeout: 30 * time.Second},
+		roleId:       opts.RoleId,
+		secretIdFile: opts.SecretIdFile,
+	}
+	if client.roleId == "" {
+		client.token = os.Getenv("VAULT_TOKEN")
+		if client.token == "" {
+			homeDir, err := os.UserHomeDir()
+			if err == nil {
+				tokenData, err := os.ReadFile(filepath.Join(homeDir, ".vault-token"))
+				if err == nil {
+					client.token = strings.TrimSpace(string(tokenData))
+				}
+			}
+		}
+		if client.token == "" {
+			return nil, errors.New("no Vault token found (set VAULT_TOKEN, or use --vault-role-id)")
+		}
+	} else if client.secretIdFile == "" {
+		return nil, errors.New("--vault-secret-id-file is required with --vault-role-id")
+	}
+	return client, nil
+}
+
+// Logs in with the AppRole credentials. The secret ID is read every time,
+// so that it can be rotated.
+func (client *vaultClient) login() error {
+	secretId, err := os.ReadFile(client.secretIdFile)
+	if err != nil {
+		return fmt.Errorf("unable to read the Vault secret ID: %w", err)
+	}
+	request := map[string]string{"role_id": client.roleId, "secret_id": strings.TrimSpace(string(secretId))}
+	var response struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if err = client.do(http.MethodPost, "auth/approle/login", "", request, &response); err != nil {
+		return fmt.Errorf("Vault AppRole login failed: %w", err)
+	}
+	client.token = response.Auth.ClientToken
+	return nil
+}
+
+// Makes an authenticated request to the Vault API. With AppRole, a new
+// token is obtained when there is none yet, or when it's been rejected
+// (because it expired, for example).
+func (client *vaultClient) request(method string, path string, body interface{}, response interface{}) error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if client.token == "" {
+		if err := client.login(); err != nil {
+			return err
+		}
+	}
+	err := client.do(method, path, client.token, body, response)
+	var vaultErr *vaultError
+	if client.roleId != "" && errors.As(err, &vaultErr) && vaultErr.statusCode == http.StatusForbidden {
+		if err = client.login(); err != nil {
+			return err
+		}
+		err = client.do(method, path, client.token, body, response)
+	}
+	return err
+}
+
+// Error that is returned by the Vault API
+type vaultError struct {
+	statusCode int
+	errors     []string
+}
+
+func (err *vaultError) Error() string {
+	if len(err.errors) == 0 {
+		return fmt.Sprintf("Vault request failed with status %d", err.statusCode)
+	}
+	return fmt.Sprintf("Vault request failed with status %d: %s", err.statusCode, strings.Join(err.errors, "; "))
+}
+
+func (client *vaultClient) do(method string, path string, token string, body interface{}, response interface{}) error {
+	var requestBody io.Reader
+	if body != nil {
+		bodyData, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		requestBody = bytes.NewReader(bodyData)
+	}
+	request, err := http.NewRequest(method, client.addr+"/v1/"+path, requestBody)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		request.Header.Set("X-Vault-Token", token)
+	}
+	if client.namespace != "" {
+		request.Header.Set("X-Vault-Namespace", client.namespace)
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	httpResponse, err := client.httpClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("unable to reach Vault: %w", err)
+	}
+	defer httpResponse.Body.Close()
+	responseData, err := io.ReadAll(httpResponse.Body)
+	if err != nil {
+		return err
+	}
+	if httpResponse.StatusCode < 200 || httpResponse.StatusCode > 299 {
+		vaultErr := &vaultError{statusCode: httpResponse.StatusCode}
+		var errorResponse struct {
+			Errors []string `json:"errors"`
+		}
+		if json.Unmarshal(responseData, &errorResponse) == nil {
+			vaultErr.errors = errorResponse.Errors
+		}
+		return vaultErr
+	}
+	if response == nil {
+		return nil
+	}
+	return json.Unmarshal(responseData, response)
+}
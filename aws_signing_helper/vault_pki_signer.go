@@ -0,0 +1,278 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options for obtaining certificates from Vault's PKI secrets engine
+type VaultPKIOpts struct {
+	// Path at which the PKI engine is mounted ("pki", if not provided)
+	Mount      string
+	Role       string
+	CommonName string
+	// Requested lifetime of the certificates (for example, "24h"). The
+	// role's default is used if not provided.
+	TTL string
+	// Directory in which the current certificate and key are kept, so that
+	// they can be reused across invocations (by default, a directory in the
+	// user's cache directory)
+	CacheDir string
+}
+
+// Signer that obtains a short-lived certificate from a Vault PKI role, and
+// obtains a new one when two thirds of its lifetime have passed. The key is
+// generated locally, and only a CSR is sent to Vault.
+type VaultPKISigner struct {
+	mutex            sync.Mutex
+	client           *vaultClient
+	opts             VaultPKIOpts
+	privateKey       *ecdsa.PrivateKey
+	cert             *x509.Certificate
+	certificateChain []*x509.Certificate
+}
+
+// Creates a signer that uses certificates issued by the given Vault PKI
+// role. A cached certificate is used if there is one that doesn't need to
+// be renewed yet; otherwise, a certificate is issued right away.
+func GetVaultPKISigner(vaultOpts VaultOpts, pkiOpts VaultPKIOpts) (Signer, error) {
+	if pkiOpts.Role == "" || pkiOpts.CommonName == "" {
+		return nil, errors.New("a Vault PKI role and common name are required")
+	}
+	if pkiOpts.Mount == "" {
+		pkiOpts.Mount = "pki"
+	}
+	pkiOpts.Mount = strings.Trim(pkiOpts.Mount, "/")
+	if pkiOpts.CacheDir == "" {
+		if userCacheDir, err := os.UserCacheDir(); err == nil {
+			pkiOpts.CacheDir = filepath.Join(userCacheDir, "aws_signing_helper", "vault-pki")
+		}
+	}
+	client, err := newVaultClient(vaultOpts)
+	if err != nil {
+		return nil, err
+	}
+	vaultPKISigner := &VaultPKISigner{client: client, opts: pkiOpts}
+
+	if pkiOpts.CacheDir != "" {
+		if err = vaultPKISigner.readCache(); err != nil && !os.IsNotExist(err) {
+			log.Println("ignoring the cached Vault certificate:", err)
+		}
+	}
+	if err = vaultPKISigner.renewIfNeeded(); err != nil {
+		return nil, err
+	}
+	return vaultPKISigner, nil
+}
+
+// Whether the certificate has less than a third of its lifetime left
+func (vaultPKISigner *VaultPKISigner) needsRenewal() bool {
+	cert := vaultPKISigner.cert
+	if cert == nil {
+		return true
+	}
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	return time.Until(cert.NotAfter) < lifetime/3
+}
+
+func (vaultPKISigner *VaultPKISigner) renewIfNeeded() error {
+	if !vaultPKISigner.needsRenewal() {
+		return nil
+	}
+	if err := vaultPKISigner.issue(); err != nil {
+		// A certificate that is about to expire is still better than none
+		if vaultPKISigner.cert != nil && time.Now().Before(vaultPKISigner.cert.NotAfter) {
+			log.Println("unable to renew the Vault certificate, using the current one:", err)
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// Generates a new key, and has Vault sign a certificate for it
+func (vaultPKISigner *VaultPKISigner) issue() error {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := CreateCertificateRequest(privateKey, vaultPKISigner.opts.CommonName)
+	if err != nil {
+		return err
+	}
+	request := map[string]string{"csr": string(csr), "common_name": vaultPKISigner.opts.CommonName}
+	if vaultPKISigner.opts.TTL != "" {
+		request["ttl"] = vaultPKISigner.opts.TTL
+	}
+	var response struct {
+		Data struct {
+			Certificate string   `json:"certificate"`
+			CAChain     []string `json:"ca_chain"`
+		} `json:"data"`
+	}
+	path := fmt.Sprintf("%s/sign/%s", vaultPKISigner.opts.Mount, url.PathEscape(vaultPKISigner.opts.Role))
+	if err = vaultPKISigner.client.request(http.MethodPost, path, request, &response); err != nil {
+		return err
+	}
+
+	certs, err := parseVaultCertificates(append([]string{response.Data.Certificate}, response.Data.CAChain...))
+	if err != nil || len(certs) == 0 {
+		return errors.New("invalid certificate from Vault")
+	}
+	if !publicKeysEqual(certs[0].PublicKey, privateKey.Public()) {
+		return errors.New("the certificate from Vault doesn't match the key")
+	}
+	vaultPKISigner.privateKey = privateKey
+	vaultPKISigner.cert = certs[0]
+	vaultPKISigner.certificateChain = withoutRootCertificates(certs[1:])
+
+	if vaultPKISigner.opts.CacheDir != "" {
+		if err = vaultPKISigner.writeCache(); err != nil {
+			log.Println("unable to cache the Vault certificate:", err)
+		}
+	}
+	return nil
+}
+
+// Parses PEM-encoded certificates, each of which may contain several
+// certificates
+func parseVaultCertificates(pemCerts []string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for _, pemCert := range pemCerts {
+		rest := []byte(pemCert)
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			certs = append(certs, cert)
+		}
+	}
+	return certs, nil
+}
+
+// Drops self-signed certificates, which don't belong in the chain that is
+// sent along with requests
+func withoutRootCertificates(certs []*x509.Certificate) []*x509.Certificate {
+	var chain []*x509.Certificate
+	for _, cert := range certs {
+		if cert.CheckSignatureFrom(cert) != nil {
+			chain = append(chain, cert)
+		}
+	}
+	return chain
+}
+
+func (vaultPKISigner *VaultPKISigner) cachePaths() (string, string) {
+	name := strings.ReplaceAll(vaultPKISigner.opts.Mount+"-"+vaultPKISigner.opts.Role, "/", "-")
+	certPath := filepath.Join(vaultPKISigner.opts.CacheDir, name+"-cert.pem")
+	keyPath := filepath.Join(vaultPKISigner.opts.CacheDir, name+"-key.pem")
+	return certPath, keyPath
+}
+
+func (vaultPKISigner *VaultPKISigner) readCache() error {
+	certPath, keyPath := vaultPKISigner.cachePaths()
+	certData, err := os.ReadFile(certPath)
+	if err != nil {
+		return err
+	}
+	certs, err := parseVaultCertificates([]string{string(certData)})
+	if err != nil || len(certs) == 0 {
+		return errors.New("invalid cached certificate")
+	}
+	privateKey, err := ReadPrivateKeyData(keyPath)
+	if err != nil {
+		return err
+	}
+	ecPrivateKey, ok := privateKey.(ecdsa.PrivateKey)
+	if !ok || !publicKeysEqual(certs[0].PublicKey, ecPrivateKey.Public()) {
+		return errors.New("the cached key doesn't match the cached certificate")
+	}
+	vaultPKISigner.privateKey = &ecPrivateKey
+	vaultPKISigner.cert = certs[0]
+	vaultPKISigner.certificateChain = certs[1:]
+	return nil
+}
+
+// Writes the certificate (followed by its chain) and the key to the cache
+// directory, replacing the files atomically
+func (vaultPKISigner *VaultPKISigner) writeCache() error {
+	if err := os.MkdirAll(vaultPKISigner.opts.CacheDir, 0700); err != nil {
+		return err
+	}
+	var certData []byte
+	for _, cert := range append([]*x509.Certificate{vaultPKISigner.cert}, vaultPKISigner.certificateChain...) {
+		certData = append(certData, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(vaultPKISigner.privateKey)
+	if err != nil {
+		return err
+	}
+	keyData := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer})
+
+	certPath, keyPath := vaultPKISigner.cachePaths()
+	if err = writeFileAtomically(keyPath, keyData); err != nil {
+		return err
+	}
+	return writeFileAtomically(certPath, certData)
+}
+
+func (vaultPKISigner *VaultPKISigner) Public() crypto.PublicKey {
+	vaultPKISigner.mutex.Lock()
+	defer vaultPKISigner.mutex.Unlock()
+	return vaultPKISigner.privateKey.Public()
+}
+
+func (vaultPKISigner *VaultPKISigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	vaultPKISigner.mutex.Lock()
+	defer vaultPKISigner.mutex.Unlock()
+	return vaultPKISigner.privateKey.Sign(rand, digest, opts)
+}
+
+func (vaultPKISigner *VaultPKISigner) supportsPSS() bool {
+	return true
+}
+
+// Returns the current certificate, renewing it first if needed. Since the
+// certificate is requested before anything is signed, the key that Sign
+// uses afterwards matches it.
+func (vaultPKISigner *VaultPKISigner) Certificate() (*x509.Certificate, error) {
+	vaultPKISigner.mutex.Lock()
+	defer vaultPKISigner.mutex.Unlock()
+	if err := vaultPKISigner.renewIfNeeded(); err != nil {
+		return nil, err
+	}
+	return vaultPKISigner.cert, nil
+}
+
+func (vaultPKISigner *VaultPKISigner) CertificateChain() ([]*x509.Certificate, error) {
+	vaultPKISigner.mutex.Lock()
+	defer vaultPKISigner.mutex.Unlock()
+	return vaultPKISigner.certificateChain, nil
+}
+
+func (vaultPKISigner *VaultPKISigner) Close() {
+}
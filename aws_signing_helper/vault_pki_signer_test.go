@@ -0,0 +1,156 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// Starts a fake Vault server with a PKI role named "test-role", which
+// issues certificates with the given lifetime. The returned counter tracks
+// the number of certificates issued.
+func startTestVaultPKI(t *testing.T, lifetime time.Duration) (*httptest.Server, *int) {
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDer, _ := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	caCert, _ := x509.ParseCertificate(caDer)
+	caPem := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDer}))
+
+	issued := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/pki/sign/test-role" || r.Header.Get("X-Vault-Token") != "test-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var request map[string]string
+		json.NewDecoder(r.Body).Decode(&request)
+		block, _ := pem.Decode([]byte(request["csr"]))
+		if block == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil || csr.CheckSignature() != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		issued++
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(issued + 1)),
+			Subject:      pkix.Name{CommonName: request["common_name"]},
+			NotBefore:    time.Now().Add(-lifetime / 10),
+			NotAfter:     time.Now().Add(lifetime * 9 / 10),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		der, _ := x509.CreateCertificate(rand.Reader, template, caCert, csr.PublicKey, caKey)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"certificate": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+				"ca_chain":    []string{caPem},
+			},
+		})
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("VAULT_TOKEN", "test-token")
+	return server, &issued
+}
+
+func TestVaultPKISigner(t *testing.T) {
+	server, issued := startTestVaultPKI(t, time.Hour)
+	pkiOpts := VaultPKIOpts{Role: "test-role", CommonName: "workload", CacheDir: t.TempDir()}
+	signer, err := GetVaultPKISigner(VaultOpts{Addr: server.URL}, pkiOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := signer.Certificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Subject.CommonName != "workload" {
+		t.Logf("Unexpected common name: %s", cert.Subject.CommonName)
+		t.Fail()
+	}
+	// The self-signed CA isn't part of the chain
+	if chain, _ := signer.CertificateChain(); len(chain) != 0 {
+		t.Logf("Expected an empty chain, got %d certificates", len(chain))
+		t.Fail()
+	}
+
+	msg := []byte("test message")
+	digest := sha256.Sum256(msg)
+	signingResult, err := Sign(msg, SigningOpts{signer, crypto.SHA256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, _ := hex.DecodeString(signingResult.Signature)
+	if !ecdsa.VerifyASN1(cert.PublicKey.(*ecdsa.PublicKey), digest[:], sig) {
+		t.Log("Failed to verify the signature")
+		t.Fail()
+	}
+
+	// The cached certificate is reused
+	cachedSigner, err := GetVaultPKISigner(VaultOpts{Addr: server.URL}, pkiOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cachedCert, _ := cachedSigner.Certificate()
+	if *issued != 1 || !cachedCert.Equal(cert) {
+		t.Log("Expected the cached certificate to be reused")
+		t.Fail()
+	}
+}
+
+func TestVaultPKISignerRenewal(t *testing.T) {
+	server, issued := startTestVaultPKI(t, time.Hour)
+	cacheDir := t.TempDir()
+	pkiOpts := VaultPKIOpts{Role: "test-role", CommonName: "workload", CacheDir: cacheDir}
+	signer, err := GetVaultPKISigner(VaultOpts{Addr: server.URL}, pkiOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Make the certificate look older, so that it's due for renewal
+	vaultPKISigner := signer.(*VaultPKISigner)
+	vaultPKISigner.cert.NotBefore = time.Now().Add(-2 * time.Hour)
+
+	if _, err = signer.Certificate(); err != nil {
+		t.Fatal(err)
+	}
+	if *issued != 2 {
+		t.Logf("Expected the certificate to be renewed, %d issued", *issued)
+		t.Fail()
+	}
+
+	// The current certificate keeps being used if Vault is unreachable
+	server.Close()
+	vaultPKISigner.cert.NotBefore = time.Now().Add(-2 * time.Hour)
+	if _, err = signer.Certificate(); err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+	if entries, _ := os.ReadDir(cacheDir); len(entries) != 2 {
+		t.Logf("Expected a cached certificate and key, found %d files", len(entries))
+		t.Fail()
+	}
+}
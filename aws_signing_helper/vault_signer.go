@@ -0,0 +1,139 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Maps the supported digests to the names used by the transit engine
+var vaultHashAlgorithms = map[crypto.Hash]string{
+	crypto.SHA256: "sha2-256",
+	crypto.SHA384: "sha2-384",
+	crypto.SHA512: "sha2-512",
+}
+
+// Signer that uses a key in Vault's transit secrets engine, so that the
+// private key never leaves Vault
+type VaultTransitSigner struct {
+	client           *vaultClient
+	mount            string
+	key              string
+	cert             *x509.Certificate
+	certificateChain []*x509.Certificate
+}
+
+// Creates a signer that uses the named transit key (in the engine mounted
+// at `mount`, "transit" by default), along with the certificate (and,
+// optionally, certificate bundle) at the provided paths
+func GetVaultTransitSigner(vaultOpts VaultOpts, mount string, key string, certificateId string, certificateBundleId string) (Signer, error) {
+	if certificateId == "" {
+		return nil, errors.New("a certificate is required with a Vault transit key")
+	}
+	if mount == "" {
+		mount = "transit"
+	}
+	client, err := newVaultClient(vaultOpts)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := readCertificate(certificateId)
+	if err != nil {
+		return nil, err
+	}
+	var certificateChain []*x509.Certificate
+	if certificateBundleId != "" {
+		if certificateChain, err = ReadCertificateBundleData(certificateBundleId); err != nil {
+			return nil, err
+		}
+	}
+	switch cert.PublicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, errors.New("unsupported certificate key type")
+	}
+	return &VaultTransitSigner{client, strings.Trim(mount, "/"), key, cert, certificateChain}, nil
+}
+
+func (vaultSigner *VaultTransitSigner) Public() crypto.PublicKey {
+	return vaultSigner.cert.PublicKey
+}
+
+// Signs the digest with the transit key. The signature is verified, since
+// Vault signs with the latest version of the key, which may no longer match
+// the certificate after a rotation.
+func (vaultSigner *VaultTransitSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hashAlgorithm, ok := vaultHashAlgorithms[opts.HashFunc()]
+	if !ok {
+		return nil, errors.New("unsupported digest")
+	}
+	request := map[string]interface{}{
+		"input":     base64.StdEncoding.EncodeToString(digest),
+		"prehashed": true,
+	}
+	if _, ok := vaultSigner.cert.PublicKey.(*rsa.PublicKey); ok {
+		if _, ok := opts.(*rsa.PSSOptions); ok {
+			request["signature_algorithm"] = "pss"
+			request["salt_length"] = "hash"
+		} else {
+			request["signature_algorithm"] = "pkcs1v15"
+		}
+	} else {
+		request["marshaling_algorithm"] = "asn1"
+	}
+
+	var response struct {
+		Data struct {
+			Signature string `json:"signature"`
+		} `json:"data"`
+	}
+	path := fmt.Sprintf("%s/sign/%s/%s", vaultSigner.mount, url.PathEscape(vaultSigner.key), hashAlgorithm)
+	if err := vaultSigner.client.request(http.MethodPost, path, request, &response); err != nil {
+		return nil, err
+	}
+
+	// Signatures are of the form "vault:v<key version>:<base64 signature>"
+	parts := strings.SplitN(response.Data.Signature, ":", 3)
+	if len(parts) != 3 || parts[0] != "vault" {
+		return nil, errors.New("unexpected signature format from Vault")
+	}
+	sig, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("unexpected signature format from Vault")
+	}
+
+	valid := false
+	switch publicKey := vaultSigner.cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		valid = verifyRSASignature(publicKey, digest, sig, opts)
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(publicKey, digest, sig)
+	}
+	if !valid {
+		return nil, fmt.Errorf("the Vault signature (key version %s) doesn't match the certificate", strings.TrimPrefix(parts[1], "v"))
+	}
+	return sig, nil
+}
+
+func (vaultSigner *VaultTransitSigner) supportsPSS() bool {
+	return true
+}
+
+func (vaultSigner *VaultTransitSigner) Certificate() (*x509.Certificate, error) {
+	return vaultSigner.cert, nil
+}
+
+func (vaultSigner *VaultTransitSigner) CertificateChain() ([]*x509.Certificate, error) {
+	return vaultSigner.certificateChain, nil
+}
+
+func (vaultSigner *VaultTransitSigner) Close() {
+}
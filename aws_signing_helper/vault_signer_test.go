@@ -0,0 +1,165 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Starts a fake Vault server whose transit engine holds the given private
+// key under the name "test-key", and which accepts AppRole logins with the
+// role ID "test-role" and secret ID "test-secret". The returned counter
+// tracks the number of logins.
+func startTestVault(t *testing.T, privateKeyId string) (*httptest.Server, *int) {
+	privateKey, err := ReadPrivateKeyData(privateKeyId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signer crypto.Signer
+	switch key := privateKey.(type) {
+	case ecdsa.PrivateKey:
+		signer = &key
+	case rsa.PrivateKey:
+		signer = &key
+	}
+
+	logins := 0
+	validToken := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&request)
+		switch {
+		case r.URL.Path == "/v1/auth/approle/login":
+			if request["role_id"] != "test-role" || request["secret_id"] != "test-secret" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			logins++
+			validToken = "token-" + strings.Repeat("x", logins)
+			json.NewEncoder(w).Encode(map[string]interface{}{"auth": map[string]string{"client_token": validToken}})
+		case r.URL.Path == "/v1/transit/sign/test-key/sha2-256":
+			if r.Header.Get("X-Vault-Token") != validToken {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"errors":["permission denied"]}`))
+				return
+			}
+			digest, _ := base64.StdEncoding.DecodeString(request["input"].(string))
+			var signerOpts crypto.SignerOpts = crypto.SHA256
+			if request["signature_algorithm"] == "pss" {
+				signerOpts = pssOptions(crypto.SHA256)
+			}
+			sig, err := signer.Sign(rand.Reader, digest, signerOpts)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]string{"signature": "vault:v1:" + base64.StdEncoding.EncodeToString(sig)},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &logins
+}
+
+func TestVaultTransitSigner(t *testing.T) {
+	msg := []byte("test message")
+	digest := sha256.Sum256(msg)
+	secretIdFile := filepath.Join(t.TempDir(), "secret-id")
+	os.WriteFile(secretIdFile, []byte("test-secret\n"), 0600)
+
+	for _, fixture := range []struct{ keyId, certificateId string }{
+		{"../tst/certs/ec-prime256v1-key.pem", "../tst/certs/ec-prime256v1-sha256-cert.pem"},
+		{"../tst/certs/rsa-2048-key.pem", "../tst/certs/rsa-2048-sha256-cert.pem"},
+	} {
+		server, _ := startTestVault(t, fixture.keyId)
+		vaultOpts := VaultOpts{Addr: server.URL, RoleId: "test-role", SecretIdFile: secretIdFile}
+		signer, err := GetVaultTransitSigner(vaultOpts, "", "test-key", fixture.certificateId, "")
+		if err != nil {
+			t.Log(err)
+			t.Fail()
+			continue
+		}
+		signingResult, err := Sign(msg, SigningOpts{signer, crypto.SHA256})
+		signer.Close()
+		if err != nil {
+			t.Log(err)
+			t.Fail()
+			continue
+		}
+		sig, _ := hex.DecodeString(signingResult.Signature)
+
+		valid := false
+		switch publicKey := signer.Public().(type) {
+		case *ecdsa.PublicKey:
+			valid = ecdsa.VerifyASN1(publicKey, digest[:], sig)
+		case *rsa.PublicKey:
+			valid = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], sig) == nil
+		}
+		if !valid {
+			t.Logf("Failed to verify the Vault signature for %s", fixture.certificateId)
+			t.Fail()
+		}
+	}
+}
+
+func TestVaultTransitSignerPSS(t *testing.T) {
+	msg := []byte("test message")
+	digest := sha256.Sum256(msg)
+	secretIdFile := filepath.Join(t.TempDir(), "secret-id")
+	os.WriteFile(secretIdFile, []byte("test-secret\n"), 0600)
+
+	server, _ := startTestVault(t, "../tst/certs/rsa-2048-key.pem")
+	vaultOpts := VaultOpts{Addr: server.URL, RoleId: "test-role", SecretIdFile: secretIdFile}
+	signer, err := GetVaultTransitSigner(vaultOpts, "", "test-key", "../tst/certs/rsa-2048-sha256-cert.pem", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+	signingResult, err := signPayload(msg, signer, pssOptions(crypto.SHA256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, _ := hex.DecodeString(signingResult.Signature)
+	if rsa.VerifyPSS(signer.Public().(*rsa.PublicKey), crypto.SHA256, digest[:], sig, pssOptions(crypto.SHA256)) != nil {
+		t.Log("Failed to verify the Vault PSS signature")
+		t.Fail()
+	}
+}
+
+func TestVaultTransitSignerRelogin(t *testing.T) {
+	server, logins := startTestVault(t, "../tst/certs/ec-prime256v1-key.pem")
+	secretIdFile := filepath.Join(t.TempDir(), "secret-id")
+	os.WriteFile(secretIdFile, []byte("test-secret"), 0600)
+	vaultOpts := VaultOpts{Addr: server.URL, RoleId: "test-role", SecretIdFile: secretIdFile}
+	signer, err := GetVaultTransitSigner(vaultOpts, "transit", "test-key", "../tst/certs/ec-prime256v1-sha256-cert.pem", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = Sign([]byte("test message"), SigningOpts{signer, crypto.SHA256}); err != nil {
+		t.Fatal(err)
+	}
+	// An expired token is replaced by logging in again
+	signer.(*VaultTransitSigner).client.token = "expired"
+	if _, err = Sign([]byte("test message"), SigningOpts{signer, crypto.SHA256}); err != nil {
+		t.Fatal(err)
+	}
+	if *logins != 2 {
+		t.Logf("Expected 2 logins, got %d", *logins)
+		t.Fail()
+	}
+}
@@ -0,0 +1,47 @@
+package aws_signing_helper
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Prefix of vsock endpoints (vsock://<cid>:<port>), through which the
+// parent instance reaches a Nitro Enclave
+const vsockEndpointPrefix = "vsock://"
+
+// Address of a vsock socket
+type vsockAddr struct {
+	CID  uint32
+	Port uint32
+}
+
+func (addr vsockAddr) Network() string {
+	return "vsock"
+}
+
+func (addr vsockAddr) String() string {
+	return fmt.Sprintf("vsock://%d:%d", addr.CID, addr.Port)
+}
+
+// Parses a vsock endpoint of the form vsock://<cid>:<port>. The CID can be
+// omitted (vsock://:<port>), when listening.
+func parseVsockEndpoint(endpoint string) (vsockAddr, error) {
+	invalid := errors.New("invalid vsock endpoint (expected vsock://<cid>:<port>): " + endpoint)
+	cidStr, portStr, found := strings.Cut(strings.TrimPrefix(endpoint, vsockEndpointPrefix), ":")
+	if !found {
+		return vsockAddr{}, invalid
+	}
+	port, err := strconv.ParseUint(portStr, 10, 32)
+	if err != nil {
+		return vsockAddr{}, invalid
+	}
+	var cid uint64
+	if cidStr != "" {
+		if cid, err = strconv.ParseUint(cidStr, 10, 32); err != nil {
+			return vsockAddr{}, invalid
+		}
+	}
+	return vsockAddr{uint32(cid), uint32(port)}, nil
+}
@@ -0,0 +1,116 @@
+package aws_signing_helper
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Connection over an AF_VSOCK socket. The socket is non-blocking, so that
+// os.File integrates it with the runtime poller, which provides deadlines.
+type vsockConn struct {
+	*os.File
+	local  vsockAddr
+	remote vsockAddr
+}
+
+func (conn *vsockConn) LocalAddr() net.Addr {
+	return conn.local
+}
+
+func (conn *vsockConn) RemoteAddr() net.Addr {
+	return conn.remote
+}
+
+// Listener on an AF_VSOCK socket
+type vsockListener struct {
+	file *os.File
+	addr vsockAddr
+}
+
+func (listener *vsockListener) Accept() (net.Conn, error) {
+	rawConn, err := listener.file.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var fd int
+	var sa unix.Sockaddr
+	var acceptErr error
+	err = rawConn.Read(func(listenerFd uintptr) bool {
+		fd, sa, acceptErr = unix.Accept4(int(listenerFd), unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC)
+		return acceptErr != unix.EAGAIN
+	})
+	if err != nil {
+		return nil, err
+	}
+	if acceptErr != nil {
+		return nil, acceptErr
+	}
+	remote := vsockAddr{}
+	if vm, ok := sa.(*unix.SockaddrVM); ok {
+		remote = vsockAddr{vm.CID, vm.Port}
+	}
+	return &vsockConn{os.NewFile(uintptr(fd), "vsock"), listener.addr, remote}, nil
+}
+
+func (listener *vsockListener) Close() error {
+	return listener.file.Close()
+}
+
+func (listener *vsockListener) Addr() net.Addr {
+	return listener.addr
+}
+
+func newVsockSocket() (int, error) {
+	fd, err := unix.Socket(unix.AF_VSOCK, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return -1, fmt.Errorf("unable to create a vsock socket: %w", err)
+	}
+	return fd, nil
+}
+
+// Connects to the given port of the VM (or enclave) with the given CID
+func dialVsock(addr vsockAddr) (net.Conn, error) {
+	fd, err := newVsockSocket()
+	if err != nil {
+		return nil, err
+	}
+	if err = unix.Connect(fd, &unix.SockaddrVM{CID: addr.CID, Port: addr.Port}); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("unable to connect to %s: %w", addr, err)
+	}
+	if err = unix.SetNonblock(fd, true); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	local := vsockAddr{}
+	if sa, err := unix.Getsockname(fd); err == nil {
+		if vm, ok := sa.(*unix.SockaddrVM); ok {
+			local = vsockAddr{vm.CID, vm.Port}
+		}
+	}
+	return &vsockConn{os.NewFile(uintptr(fd), "vsock"), local, addr}, nil
+}
+
+// Listens on the given port, for connections from any CID
+func listenVsock(port uint32) (net.Listener, error) {
+	fd, err := newVsockSocket()
+	if err != nil {
+		return nil, err
+	}
+	if err = unix.Bind(fd, &unix.SockaddrVM{CID: unix.VMADDR_CID_ANY, Port: port}); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("unable to bind to vsock port %d: %w", port, err)
+	}
+	if err = unix.Listen(fd, unix.SOMAXCONN); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	if err = unix.SetNonblock(fd, true); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	return &vsockListener{os.NewFile(uintptr(fd), "vsock"), vsockAddr{unix.VMADDR_CID_ANY, port}}, nil
+}
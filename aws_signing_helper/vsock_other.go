@@ -0,0 +1,16 @@
+//go:build !linux
+
+package aws_signing_helper
+
+import (
+	"errors"
+	"net"
+)
+
+func dialVsock(addr vsockAddr) (net.Conn, error) {
+	return nil, errors.New("vsock is only supported on Linux")
+}
+
+func listenVsock(port uint32) (net.Listener, error) {
+	return nil, errors.New("vsock is only supported on Linux")
+}
@@ -0,0 +1,127 @@
+package aws_signing_helper
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// Name of the Windows service that's installed, if no other is given
+const DefaultServiceName = "AWSSigningHelper"
+
+// Installs a Windows service that runs the helper with the given arguments.
+// The service starts along with the system, and is restarted if it exits
+// unexpectedly (say, because credentials couldn't be obtained). It's also
+// registered as an event log source, which it logs to.
+func InstallService(name string, description string, args []string) error {
+	exePath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	manager, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer manager.Disconnect()
+	if service, err := manager.OpenService(name); err == nil {
+		service.Close()
+		return fmt.Errorf("service %s already exists", name)
+	}
+	service, err := manager.CreateService(name, exePath, mgr.Config{
+		DisplayName: name,
+		Description: description,
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return err
+	}
+	defer service.Close()
+	err = service.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 10 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: time.Minute},
+	}, uint32((24 * time.Hour).Seconds()))
+	if err == nil {
+		err = eventlog.InstallAsEventCreate(name, eventlog.Error|eventlog.Warning|eventlog.Info)
+	}
+	if err != nil {
+		service.Delete()
+		return err
+	}
+	return nil
+}
+
+// Stops and removes the Windows service, along with its event log source
+func RemoveService(name string) error {
+	manager, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer manager.Disconnect()
+	service, err := manager.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %s isn't installed", name)
+	}
+	defer service.Close()
+	// The service is only removed once it has stopped, so it's stopped
+	// first, if it's running
+	service.Control(svc.Stop)
+	if err = service.Delete(); err != nil {
+		return err
+	}
+	eventlog.Remove(name)
+	return nil
+}
+
+// Runs the given function (which runs one of the long-running modes, and
+// doesn't return) as the Windows service with the given name, once the
+// service control manager has started the process. Logs are written to the
+// event log. The service is stopped by returning, which lets the process
+// exit.
+func RunService(name string, run func()) error {
+	if events, err := eventlog.Open(name); err == nil {
+		defer events.Close()
+		log.SetOutput(eventLogWriter{events})
+		// The event log records when each event happened
+		log.SetFlags(0)
+	}
+	return svc.Run(name, serviceHandler{run})
+}
+
+type serviceHandler struct {
+	run func()
+}
+
+func (handler serviceHandler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	go handler.run()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for request := range requests {
+		switch request.Cmd {
+		case svc.Interrogate:
+			status <- request.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			log.Println("stopping the service")
+			status <- svc.Status{State: svc.StopPending}
+			return false, 0
+		}
+	}
+	return false, 0
+}
+
+// Writes each log message to the event log, as an information event
+type eventLogWriter struct {
+	events *eventlog.Log
+}
+
+func (writer eventLogWriter) Write(p []byte) (int, error) {
+	if err := writer.events.Info(1, strings.TrimSuffix(string(p), "\n")); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -6,13 +6,17 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
 )
@@ -22,35 +26,177 @@ var (
 	privateKeyId        string
 	certificateId       string
 	certificateBundleId string
+	libPkcs11           string
+	pinFile             string
+	tpmDevice           string
+	tpmKeyPasswordFile  string
+	keyContainer        string
+	machineKey          bool
+	certStoreLocation   string
+	certThumbprint      string
+	certSubject         string
+	certSelector        string
+	keychainLabel       string
+	keychainHash        string
+	secureEnclaveKey    string
+	pivCard             string
+	pivSlot             string
+	pivPinPolicy        string
+	sshAgentKey         string
+	gpgKeygrip          string
+	signerCommand       string
+	signerEndpoint      string
+	signerKeyId         string
+	vaultAddr           string
+	vaultKey            string
+	vaultTransitMount   string
+	vaultRoleId         string
+	vaultSecretIdFile   string
+	vaultPKIMount       string
+	vaultPKIRole        string
+	vaultPKICommonName  string
+	vaultPKITTL         string
+	vaultPKICacheDir    string
+	azureKeyVault       string
+	azureCertificate    string
+	azureClientId       string
+	gcpKMSKey           string
+	spiffeSocket        string
+	spiffeId            string
+	pkcs12Bundle        string
+	keystore            string
+	keystorePassword    string
+	keystoreAlias       string
+	passphraseFile      string
+	ageIdentity         string
+	enableEd25519       bool
+	signingAlgorithm    string
 	digestArg           string
+	fetchIntermediates  bool
+	expiryWarningDays   int
+	checkRevocation     bool
 	roleArnStr          string
 	profileArnStr       string
 	trustAnchorArnStr   string
 	sessionDuration     int
+	roleSessionName     string
+	sendDefaultName     bool
+	chainedRoleArns     []string
+	sessionTags         []helper.SessionTag
+	transitiveTagKeys   []string
+	externalId          string
+	sessionPolicyFile   string
+	policyArns          []string
+	sourceIdentity      string
+	expirationBuffer    int
 
-	region      string
-	endpoint    string
-	noVerifySSL bool
-	withProxy   bool
-	debug       bool
-	format      string
+	region              string
+	endpoint            string
+	useFIPSEndpoint     bool
+	useDualStack        bool
+	failoverTargets     []helper.FailoverTarget
+	noVerifySSL         bool
+	caBundle            string
+	tlsMinVersion       string
+	tlsCipherSuites     []string
+	withProxy           bool
+	proxyURL            string
+	proxyUser           string
+	proxyPasswordFile   string
+	proxyAuth           string
+	connectTimeout      time.Duration
+	tlsHandshakeTimeout time.Duration
+	requestTimeout      time.Duration
+	debug               bool
+	userAgentAppId      string
+	userAgentMetadata   []string
+	format              string
 
-	profile string
-	once    bool
+	profile         string
+	once            bool
+	credentialsFile string
 
-	port int
+	port        int
+	maxTokenTTL int
+	httpTokens  string
+	socketPath  string
+	socketMode  string
+	pipePath    string
+	pipeSDDL    string
+	roleSpecs   []string
+
+	restartOnExpiry bool
+
+	outputFile      string
+	useCache        bool
+	cacheBackend    string
+	cacheDir        string
+	cacheEncryption string
+
+	clusterName string
+
+	metricsEnabled      bool
+	shutdownGracePeriod int
+
+	refreshFraction         float64
+	refreshJitter           float64
+	circuitBreakerThreshold int
+
+	authorizationTokenFile string
+
+	jwksFile             string
+	serviceAccountIssuer string
+	serviceAccounts      string
+
+	listenAddr string
+
+	pkcs11Uri string
+
+	commonName string
+
+	attestNonce string
+
+	keyType          string
+	tpmKey           bool
+	pivManagementKey string
+	subject          string
+	subjectAltNames  string
+
+	trustAnchorCert string
 
 	credentialProcessCmd   = flag.NewFlagSet("credential-process", flag.ExitOnError)
 	signStringCmd          = flag.NewFlagSet("sign-string", flag.ExitOnError)
 	readCertificateDataCmd = flag.NewFlagSet("read-certificate-data", flag.ExitOnError)
 	updateCmd              = flag.NewFlagSet("update", flag.ExitOnError)
+	writeCredentialsCmd    = flag.NewFlagSet("write-credentials", flag.ExitOnError)
 	serveCmd               = flag.NewFlagSet("serve", flag.ExitOnError)
+	serveContainerCmd      = flag.NewFlagSet("serve-container", flag.ExitOnError)
+	servePodIdentityCmd    = flag.NewFlagSet("serve-pod-identity", flag.ExitOnError)
+	serveSignerCmd         = flag.NewFlagSet("serve-signer", flag.ExitOnError)
+	execCmd                = flag.NewFlagSet("exec", flag.ExitOnError)
+	exportCredentialsCmd   = flag.NewFlagSet("export-credentials", flag.ExitOnError)
+	eksTokenCmd            = flag.NewFlagSet("eks-token", flag.ExitOnError)
+	ecrCredentialsCmd      = flag.NewFlagSet("ecr-credential-provider", flag.ExitOnError)
+	dockerCredentialCmd    = flag.NewFlagSet("docker-credential", flag.ExitOnError)
+	gitCredentialCmd       = flag.NewFlagSet("git-credential", flag.ExitOnError)
 	versionCmd             = flag.NewFlagSet("version", flag.ExitOnError)
+	listKeysCmd            = flag.NewFlagSet("list-keys", flag.ExitOnError)
+	generateSEKeyCmd       = flag.NewFlagSet("generate-secure-enclave-key", flag.ExitOnError)
+	attestCmd              = flag.NewFlagSet("attest", flag.ExitOnError)
+	generateCSRCmd         = flag.NewFlagSet("generate-csr", flag.ExitOnError)
+	selfTestCmd            = flag.NewFlagSet("self-test", flag.ExitOnError)
+	validateCmd            = flag.NewFlagSet("validate", flag.ExitOnError)
+	diagnoseCmd            = flag.NewFlagSet("diagnose", flag.ExitOnError)
+	serviceCmd             = flag.NewFlagSet("service", flag.ExitOnError)
 )
 
 var Version string
 var globalOptSet = map[string]bool{"--region": true, "--endpoint": true}
-var credentialCommands = map[string]struct{}{"credential-process": {}, "update": {}, "serve": {}}
+
+// Commands that can be run as a Windows service (or a launchd agent, on
+// macOS)
+var serviceCommands = map[string]struct{}{"update": {}, "serve": {}, "serve-container": {}, "serve-pod-identity": {}, "serve-signer": {}}
+var credentialCommands = map[string]struct{}{"credential-process": {}, "update": {}, "write-credentials": {}, "serve": {}, "serve-container": {}, "serve-pod-identity": {}, "serve-signer": {}, "exec": {}, "export-credentials": {}, "eks-token": {}, "ecr-credential-provider": {}, "docker-credential": {}, "git-credential": {}, "self-test": {}, "validate": {}}
 
 // Maps each command name to a flagset
 var commands = map[string]*flag.FlagSet{
@@ -58,8 +204,25 @@ var commands = map[string]*flag.FlagSet{
 	signStringCmd.Name():          signStringCmd,
 	readCertificateDataCmd.Name(): readCertificateDataCmd,
 	updateCmd.Name():              updateCmd,
+	writeCredentialsCmd.Name():    writeCredentialsCmd,
 	serveCmd.Name():               serveCmd,
+	serveContainerCmd.Name():      serveContainerCmd,
+	servePodIdentityCmd.Name():    servePodIdentityCmd,
+	serveSignerCmd.Name():         serveSignerCmd,
+	execCmd.Name():                execCmd,
+	exportCredentialsCmd.Name():   exportCredentialsCmd,
+	eksTokenCmd.Name():            eksTokenCmd,
+	ecrCredentialsCmd.Name():      ecrCredentialsCmd,
+	dockerCredentialCmd.Name():    dockerCredentialCmd,
+	gitCredentialCmd.Name():       gitCredentialCmd,
 	versionCmd.Name():             versionCmd,
+	listKeysCmd.Name():            listKeysCmd,
+	generateSEKeyCmd.Name():       generateSEKeyCmd,
+	attestCmd.Name():              attestCmd,
+	generateCSRCmd.Name():         generateCSRCmd,
+	selfTestCmd.Name():            selfTestCmd,
+	validateCmd.Name():            validateCmd,
+	diagnoseCmd.Name():            diagnoseCmd,
 }
 
 // Finds global parameters that can appear in any position
@@ -72,6 +235,11 @@ func findGlobalVar(argList []string) (map[string]string, []string) {
 
 	for i := 0; i < len(argList); i++ {
 
+		// Arguments after "--" belong to the command that exec runs
+		if argList[i] == "--" {
+			parseList = append(parseList, argList[i:]...)
+			break
+		}
 		if globalOptSet[argList[i]] {
 
 			if !strings.HasPrefix(argList[i+1], "--") {
@@ -94,36 +262,497 @@ func setupFlags() {
 	for command, fs := range commands {
 		// Common flags for all credential-related commands
 		if _, ok := credentialCommands[command]; ok {
-			fs.StringVar(&certificateId, "certificate", "", "Path to certificate file")
-			fs.StringVar(&privateKeyId, "private-key", "", "Path to private key file")
+			fs.StringVar(&certificateId, "certificate", "", "Path to certificate file, directory of certificates (see --cert-selector), or PKCS#11 URI")
+			fs.StringVar(&privateKeyId, "private-key", "", "Path to private key file, directory of private keys, or PKCS#11 URI")
+			fs.StringVar(&libPkcs11, "pkcs11-lib", "", "Path to the PKCS#11 module to use")
+			fs.StringVar(&pinFile, "pin-file", "", "Path to a file containing the PIN for a hardware-backed key")
+			fs.StringVar(&tpmDevice, "tpm-device", "", "TPM device to use for TSS2 private keys (default: /dev/tpmrm0)")
+			fs.StringVar(&tpmKeyPasswordFile, "tpm-key-password-file", "", "Path to a file containing the password of the TSS2 private key (default: obtained in the same way as a PIN)")
+			fs.StringVar(&keyContainer, "key-container", "", "Name of the Microsoft Platform Crypto Provider key container to use (Windows only)")
+			fs.BoolVar(&machineKey, "machine-key", false, "Whether the key container is a machine key, rather than a user key (Windows only)")
+			fs.StringVar(&certStoreLocation, "cert-store-location", "CurrentUser", "Location of the MY certificate store to use, CurrentUser or LocalMachine (Windows only)")
+			fs.StringVar(&certThumbprint, "cert-thumbprint", "", "SHA-1 thumbprint of the certificate to use from the Windows certificate store")
+			fs.StringVar(&certSubject, "cert-subject", "", "Subject of the certificate to use from the Windows certificate store")
+			fs.StringVar(&certSelector, "cert-selector", "", "Criteria (subject, issuer, serial, san, eku, template) that the certificate to use from the Windows certificate store or a certificate directory has to match, as JSON or key=value pairs")
+			fs.StringVar(&keychainLabel, "keychain-label", "", "Label of the macOS Keychain identity to use")
+			fs.StringVar(&keychainHash, "keychain-hash", "", "SHA-1 or SHA-256 hash of the certificate of the macOS Keychain identity to use")
+			fs.StringVar(&secureEnclaveKey, "secure-enclave-key", "", "Label of the macOS Secure Enclave key to use")
+			fs.StringVar(&pivCard, "piv-card", "", "Name (or part of the name) of the PIV card to use (default: the first YubiKey)")
+			fs.StringVar(&pivSlot, "piv-slot", "", "PIV slot of the key to use: 9a, 9c, 9d, or 9e (default: 9a)")
+			fs.StringVar(&pivPinPolicy, "piv-pin-policy", "", "PIN policy of the PIV key: never, once, or always (default: determined from the key's attestation)")
+			fs.StringVar(&sshAgentKey, "ssh-agent-key", "", "Fingerprint of the ssh-agent key to use, as shown by ssh-add -l (use \"any\" to select the key that matches the certificate)")
+			fs.StringVar(&gpgKeygrip, "gpg-keygrip", "", "Keygrip of the gpg-agent key to use, as shown by gpg --with-keygrip -K")
+			fs.StringVar(&signerCommand, "signer-command", "", "External command that signs digests, using the JSON protocol described in the README")
+			fs.StringVar(&signerEndpoint, "signer-endpoint", "", "Endpoint of a remote signer (unix:///path/to/socket, vsock://<cid>:<port>, or host:port for TLS)")
+			fs.StringVar(&signerKeyId, "signer-key-id", "", "Identifier of the key to use, if the remote signer holds more than one")
+			fs.StringVar(&vaultAddr, "vault-addr", "", "Address of the Vault server (defaults to VAULT_ADDR)")
+			fs.StringVar(&vaultKey, "vault-key", "", "Name of the Vault transit key to sign with")
+			fs.StringVar(&vaultTransitMount, "vault-transit-mount", "transit", "Path at which the Vault transit engine is mounted")
+			fs.StringVar(&vaultRoleId, "vault-role-id", "", "Vault AppRole role ID (if not provided, VAULT_TOKEN or ~/.vault-token is used)")
+			fs.StringVar(&vaultSecretIdFile, "vault-secret-id-file", "", "File that contains the Vault AppRole secret ID")
+			fs.StringVar(&vaultPKIMount, "vault-pki-mount", "pki", "Path at which the Vault PKI engine is mounted")
+			fs.StringVar(&vaultPKIRole, "vault-pki-role", "", "Vault PKI role from which to obtain short-lived certificates")
+			fs.StringVar(&vaultPKICommonName, "vault-pki-common-name", "", "Common name of the certificates obtained from Vault")
+			fs.StringVar(&vaultPKITTL, "vault-pki-ttl", "", "Lifetime of the certificates obtained from Vault (defaults to the role's)")
+			fs.StringVar(&vaultPKICacheDir, "vault-pki-cache-dir", "", "Directory in which to cache the certificate and key obtained from Vault")
+			fs.StringVar(&azureKeyVault, "azure-key-vault", "", "URL of the Azure Key Vault that holds the certificate and key (https://<name>.vault.azure.net)")
+			fs.StringVar(&azureCertificate, "azure-certificate", "", "Name of the Azure Key Vault certificate whose key to sign with")
+			fs.StringVar(&azureClientId, "azure-client-id", "", "Client ID of the user-assigned managed identity to authenticate to Azure Key Vault with")
+			fs.StringVar(&gcpKMSKey, "gcp-kms-key", "", "Resource name of the Google Cloud KMS key version to sign with (projects/.../cryptoKeyVersions/<version>)")
+			fs.StringVar(&spiffeSocket, "spiffe-socket", "", "SPIFFE Workload API socket from which to obtain an X.509-SVID (defaults to SPIFFE_ENDPOINT_SOCKET)")
+			fs.StringVar(&spiffeId, "spiffe-id", "", "SPIFFE ID of the X.509-SVID to use, if the workload has more than one")
+			fs.StringVar(&pkcs12Bundle, "pkcs12-bundle", "", "Path to a PKCS#12 (.p12 or .pfx) bundle containing the certificate, private key, and chain")
+			fs.StringVar(&keystore, "keystore", "", "Path to a Java keystore (JKS or JCEKS) containing the certificate, private key, and chain")
+			fs.StringVar(&keystorePassword, "keystore-password", "", "Password of the Java keystore (if not provided, it's obtained in the same way as a passphrase)")
+			fs.StringVar(&keystoreAlias, "alias", "", "Alias of the keystore entry to use, if the keystore holds more than one private key")
+			fs.StringVar(&passphraseFile, "passphrase-file", "", "Path to a file containing the passphrase for the encrypted private key or PKCS#12 bundle")
+			fs.StringVar(&ageIdentity, "age-identity", "", "Path to an age identity file with which to decrypt an age-encrypted private key")
+			fs.BoolVar(&enableEd25519, "enable-ed25519", false, "To sign with Ed25519 keys, which IAM Roles Anywhere doesn't accept yet")
+			fs.StringVar(&signingAlgorithm, "signing-algorithm", "pkcs1v15", "Signature scheme: pkcs1v15 or pss (RSASSA-PSS) for RSA keys, or rfc6979 (deterministic ECDSA) for ECDSA keys")
+			fs.IntVar(&expiryWarningDays, "expiry-warning-days", 7, "Warn when the certificate expires within this many days (0 disables the warning)")
+			fs.BoolVar(&checkRevocation, "check-revocation", false, "To check whether the certificate has been revoked, through its OCSP responder or CRL, before using it")
+			fs.StringVar(&digestArg, "digest", "", "Digest with which requests are signed: SHA256, SHA384, or SHA512, which has to match the size of the ECDSA curve (default: the one that matches the ECDSA curve, or else SHA256)")
 			fs.StringVar(&roleArnStr, "role-arn", "", "Target role to assume")
 			fs.StringVar(&profileArnStr, "profile-arn", "", "Profile to to pull policies from")
 			fs.StringVar(&trustAnchorArnStr, "trust-anchor-arn", "", "Trust anchor to to use for authentication")
 			fs.IntVar(&sessionDuration, "session-duration", 3600, "Duration, in seconds, for the resulting session")
-			fs.StringVar(&region, "region", "", "Signing region")
+			fs.StringVar(&roleSessionName, "role-session-name", "", "Name of the role session, which can refer to the certificate's attributes, such as ${subject.CN} (default: "+helper.RoleSessionNameEnvVarName+", or else the certificate's common name and serial number)")
+			fs.BoolVar(&sendDefaultName, "send-default-role-session-name", false, "To send the role session name derived from the certificate's common name and serial number to IAM Roles Anywhere, when none is given (the profile has to accept role session names)")
+			fs.Func("chained-role-arn", "Role to assume with the credentials obtained from IAM Roles Anywhere (can be repeated, to assume each role with the credentials of the previous one)", func(value string) error {
+				chainedRoleArns = append(chainedRoleArns, value)
+				return nil
+			})
+			fs.Func("session-tag", "Tag of the sessions of the chained roles, as key=value, where the value can refer to the certificate's attributes, such as ${subject.CN} (can be repeated)", func(value string) error {
+				key, tagValue, found := strings.Cut(value, "=")
+				if !found || key == "" {
+					return errors.New("expected key=value")
+				}
+				sessionTags = append(sessionTags, helper.SessionTag{Key: key, Value: tagValue})
+				return nil
+			})
+			fs.Func("transitive-tag", "Key of a session tag to pass on to roles that are chained after it (can be repeated)", func(value string) error {
+				transitiveTagKeys = append(transitiveTagKeys, value)
+				return nil
+			})
+			fs.StringVar(&externalId, "external-id", "", "External ID to pass when assuming the chained roles")
+			fs.StringVar(&sessionPolicyFile, "session-policy", "", "Path to a JSON session policy that scopes down the credentials of the last chained role")
+			fs.Func("policy-arn", "ARN of a managed policy that scopes down the credentials of the last chained role (can be repeated)", func(value string) error {
+				policyArns = append(policyArns, value)
+				return nil
+			})
+			fs.StringVar(&sourceIdentity, "source-identity", "", "Source identity to set on the sessions of the chained roles, which can refer to the certificate's attributes, such as ${san.dns}")
+			fs.IntVar(&expirationBuffer, "expiration-buffer", 0, "Seconds before the credentials expire at which to report them as expiring, so that they're replaced early enough for slow applications")
+			fs.StringVar(&region, "region", "", "Signing region (default: the region of the trust anchor and profile ARNs)")
 			fs.StringVar(&endpoint, "endpoint", "", "Endpoint to retrieve session from")
+			fs.Func("failover", "Trust anchor and profile ARNs (and, optionally, endpoint) of replicas in another region to fail over to when the primary one is unreachable, as trust-anchor-arn,profile-arn[,endpoint] (can be repeated, in order of preference)", func(value string) error {
+				parts := strings.Split(value, ",")
+				if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+					return errors.New("expected trust-anchor-arn,profile-arn[,endpoint]")
+				}
+				target := helper.FailoverTarget{TrustAnchorArn: parts[0], ProfileArn: parts[1]}
+				if len(parts) == 3 {
+					target.Endpoint = parts[2]
+				}
+				failoverTargets = append(failoverTargets, target)
+				return nil
+			})
+			fs.BoolVar(&useFIPSEndpoint, "use-fips-endpoint", false, "To send requests to the FIPS endpoints (default: "+helper.UseFIPSEndpointEnvVarName+")")
+			fs.BoolVar(&useDualStack, "use-dualstack-endpoint", false, "To send requests to the dual-stack (IPv6 and IPv4) endpoints (default: "+helper.UseDualStackEndpointEnvVarName+")")
 			fs.StringVar(&certificateBundleId, "intermediates", "", "Path to intermediate certificate bundle")
+			fs.BoolVar(&fetchIntermediates, "fetch-intermediates", false, "To fetch intermediate certificates that are missing from the bundle, through the Authority Information Access extension")
 			fs.BoolVar(&noVerifySSL, "no-verify-ssl", false, "To disable SSL verification")
-			fs.BoolVar(&withProxy, "with-proxy", false, "To use credential-process with a proxy")
+			fs.StringVar(&caBundle, "ca-bundle", "", "Path to a PEM bundle of the CA certificates against which to verify the endpoint's certificate, instead of the system's (default: "+helper.CABundleEnvVarName+")")
+			fs.StringVar(&tlsMinVersion, "tls-min-version", helper.TLSVersion12, "Minimum TLS version of the connection to the endpoint: 1.2 or 1.3")
+			fs.Func("tls-cipher-suites", "Comma-separated TLS 1.2 cipher suites to offer, such as TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384 (default: the ECDHE suites with AES-GCM or ChaCha20-Poly1305)", func(value string) error {
+				tlsCipherSuites = append(tlsCipherSuites, strings.Split(value, ",")...)
+				return nil
+			})
+			fs.BoolVar(&withProxy, "with-proxy", false, "Deprecated: the proxy in the environment (HTTPS_PROXY, HTTP_PROXY, and NO_PROXY) is always used")
+			fs.StringVar(&proxyURL, "proxy-url", "", "URL of the proxy through which to connect to the endpoint, instead of the one in the environment")
+			fs.StringVar(&proxyUser, "proxy-user", "", "User to authenticate to the proxy as (DOMAIN\\user for NTLM), instead of the one in the proxy's URL")
+			fs.StringVar(&proxyPasswordFile, "proxy-password-file", "", "Path to a file containing the password of the proxy user (default: the "+helper.ProxyPasswordEnvVarName+" environment variable)")
+			fs.StringVar(&proxyAuth, "proxy-auth", helper.ProxyAuthBasic, "How to authenticate to the proxy: basic or ntlm")
+			fs.DurationVar(&connectTimeout, "connect-timeout", helper.DefaultConnectTimeout, "How long to wait to connect to the endpoint, such as 5s")
+			fs.DurationVar(&tlsHandshakeTimeout, "tls-handshake-timeout", helper.DefaultTLSHandshakeTimeout, "How long to wait for the TLS handshake with the endpoint")
+			fs.DurationVar(&requestTimeout, "request-timeout", helper.DefaultRequestTimeout, "How long to wait for each attempt at a request to the endpoint, in all")
 			fs.BoolVar(&debug, "debug", false, "To print debug output when SDK calls are made")
+			fs.StringVar(&userAgentAppId, "user-agent-app-id", "", "Application ID to append to the User-Agent of requests, to tell fleets or tools apart in the service's logs (default: "+helper.UserAgentAppIdEnvVarName+")")
+			fs.Func("user-agent-metadata", "Metadata to append to the User-Agent of requests, as key=value (can be repeated)", func(value string) error {
+				userAgentMetadata = append(userAgentMetadata, value)
+				return nil
+			})
 		}
 
-		if command == "read-certificate-data" {
+		if command == "credential-process" {
+			fs.StringVar(&outputFile, "output-file", "", "Path of a file to also write the credentials to, atomically, and readable only by its owner")
+			fs.BoolVar(&useCache, "cache", false, "Reuse credentials cached in ~/.aws/rolesanywhere/cache until shortly before they expire, and cache new ones there")
+			fs.StringVar(&cacheBackend, "cache-backend", helper.CacheBackendFile, "Where to cache credentials: file, or keychain (the OS's secret store)")
+			fs.StringVar(&cacheDir, "cache-dir", "", "Directory in which to cache credentials (default: ~/.aws/rolesanywhere/cache)")
+			fs.StringVar(&cacheEncryption, "cache-encryption", "", "How to encrypt cached credentials: tpm, dpapi, or keychain (default: not encrypted)")
+		} else if command == "read-certificate-data" {
 			fs.StringVar(&certificateId, "certificate", "", "Path to certificate file")
 		} else if command == "sign-string" {
 			fs.StringVar(&privateKeyId, "private-key", "", "Path to private key file")
+			fs.StringVar(&passphraseFile, "passphrase-file", "", "Path to a file containing the passphrase for the encrypted private key")
+			fs.StringVar(&ageIdentity, "age-identity", "", "Path to an age identity file with which to decrypt an age-encrypted private key")
 			fs.StringVar(&format, "format", "json", "Output format. One of json, text, and bin")
 			fs.StringVar(&digestArg, "digest", "SHA256", "One of SHA256, SHA384 and SHA512")
-		} else if command == "update" {
+		} else if command == "update" || command == "write-credentials" {
 			fs.StringVar(&profile, "profile", "default", "The aws profile to use (default 'default')")
-			fs.BoolVar(&once, "once", false, "Update the credentials once")
+			fs.StringVar(&credentialsFile, "credentials-file", "", "Path to the credentials file to write to (default: the shared credentials file)")
+			if command == "update" {
+				fs.BoolVar(&once, "once", false, "Update the credentials once")
+				addRefreshFlags(fs)
+			}
 		} else if command == "serve" {
 			fs.IntVar(&port, "port", helper.DefaultPort, "The port used to run local server (default: 9911)")
+			fs.IntVar(&maxTokenTTL, "max-token-ttl", helper.MaxTokenTTL, "Longest TTL of session tokens, in seconds (default: 21600)")
+			fs.StringVar(&httpTokens, "http-tokens", "required", "Whether credentials can be requested without a session token: required (IMDSv2 only) or optional (IMDSv1 as well)")
+			fs.StringVar(&socketPath, "socket", "", "Path of a Unix domain socket to listen on, instead of a TCP port")
+			fs.BoolVar(&metricsEnabled, "metrics", false, "Expose metrics in the Prometheus text format at /metrics")
+			addShutdownFlags(fs)
+			fs.StringVar(&socketMode, "socket-mode", "0600", "Permissions of the Unix domain socket, in octal")
+			fs.StringVar(&pipePath, "pipe", "", "Path of a Windows named pipe to listen on (such as \\\\.\\pipe\\aws_signing_helper), instead of a TCP port")
+			fs.StringVar(&pipeSDDL, "pipe-security-descriptor", "", "Security descriptor of the named pipe, in SDDL format (default: the default security descriptor of named pipes)")
+			addRefreshFlags(fs)
+			fs.Func("role", "Additional role to serve, as <role-arn>[,<profile-arn>[,<trust-anchor-arn>]] (can be repeated)", func(value string) error {
+				roleSpecs = append(roleSpecs, value)
+				return nil
+			})
+		} else if command == "serve-container" {
+			fs.IntVar(&port, "port", helper.DefaultContainerPort, "The port used to run local server (default: 9912)")
+			fs.StringVar(&authorizationTokenFile, "authorization-token-file", "", "Path to a file containing the token that requests have to carry in their Authorization header (default: a generated token)")
+			fs.BoolVar(&metricsEnabled, "metrics", false, "Expose metrics in the Prometheus text format at /metrics")
+			addShutdownFlags(fs)
+			addRefreshFlags(fs)
+		} else if command == "serve-pod-identity" {
+			fs.StringVar(&listenAddr, "listen", helper.DefaultPodIdentityAddress, "Address on which to serve credentials to pods")
+			fs.StringVar(&jwksFile, "jwks-file", "", "Path to the JSON Web Key Set of the cluster's service account issuer")
+			fs.StringVar(&serviceAccountIssuer, "service-account-issuer", "", "Issuer of the cluster's service account tokens (default: any)")
+			fs.StringVar(&serviceAccounts, "service-account", "", "Comma-separated service accounts (as namespace/name) to serve credentials to (default: all)")
+			fs.BoolVar(&metricsEnabled, "metrics", false, "Expose metrics in the Prometheus text format at /metrics")
+			addShutdownFlags(fs)
+			addRefreshFlags(fs)
+		} else if command == "exec" {
+			fs.BoolVar(&restartOnExpiry, "restart", false, "Restart the command with new credentials shortly before its credentials expire")
+		} else if command == "export-credentials" {
+			fs.StringVar(&format, "format", helper.DefaultShellFormat(), "Shell whose syntax to print the credentials in: bash, zsh, fish, or powershell (default: powershell on Windows, and bash elsewhere)")
+		} else if command == "eks-token" {
+			fs.StringVar(&clusterName, "cluster-name", "", "Name of the EKS cluster to obtain a token for")
+		} else if command == "serve-signer" {
+			fs.StringVar(&listenAddr, "listen", "", "Address on which to serve the signer: vsock://:<port> (within a Nitro Enclave) or unix:///path/to/socket")
+		} else if command == "list-keys" {
+			fs.StringVar(&libPkcs11, "pkcs11-lib", "", "Path to the PKCS#11 module to use")
+			fs.StringVar(&pkcs11Uri, "pkcs11-uri", "", "PKCS#11 URI that restricts the tokens and objects listed")
+			fs.StringVar(&pinFile, "pin-file", "", "Path to a file containing the PIN for the token")
+		} else if command == "generate-secure-enclave-key" {
+			fs.StringVar(&secureEnclaveKey, "secure-enclave-key", "", "Label of the Secure Enclave key to generate")
+			fs.StringVar(&commonName, "common-name", "", "Common name of the subject of the CSR (default: the key's label)")
+		} else if command == "attest" {
+			fs.StringVar(&pivCard, "piv-card", "", "Name (or part of the name) of the PIV card whose key to attest (default: the first YubiKey)")
+			fs.StringVar(&pivSlot, "piv-slot", "", "PIV slot of the key to attest: 9a, 9c, 9d, or 9e")
+			fs.StringVar(&privateKeyId, "private-key", "", "Path to the TSS2 private key to attest")
+			fs.StringVar(&tpmDevice, "tpm-device", "", "TPM device that holds the key (default: /dev/tpmrm0)")
+			fs.StringVar(&pinFile, "pin-file", "", "Path to a file containing the password for the TPM key")
+			fs.StringVar(&attestNonce, "nonce", "", "Hex-encoded nonce from the verifier, to include in the TPM attestation")
+		} else if command == "validate" {
+			fs.StringVar(&trustAnchorCert, "trust-anchor-certificate", "", "Path to the CA certificate (or bundle of CA certificates) of the trust anchor, to check that the certificate chains up to it")
+		} else if command == "diagnose" {
+			fs.StringVar(&region, "region", "", "Region whose endpoint to diagnose")
+			fs.StringVar(&endpoint, "endpoint", "", "Endpoint to diagnose")
+			fs.BoolVar(&useFIPSEndpoint, "use-fips-endpoint", false, "To send requests to the FIPS endpoints (default: "+helper.UseFIPSEndpointEnvVarName+")")
+			fs.BoolVar(&useDualStack, "use-dualstack-endpoint", false, "To send requests to the dual-stack (IPv6 and IPv4) endpoints (default: "+helper.UseDualStackEndpointEnvVarName+")")
+			fs.StringVar(&trustAnchorArnStr, "trust-anchor-arn", "", "Trust anchor whose region's endpoint to diagnose")
+			fs.BoolVar(&withProxy, "with-proxy", false, "Deprecated: the proxy in the environment (HTTPS_PROXY, HTTP_PROXY, and NO_PROXY) is always used")
+			fs.StringVar(&proxyURL, "proxy-url", "", "URL of the proxy through which to connect to the endpoint, instead of the one in the environment")
+			fs.StringVar(&proxyUser, "proxy-user", "", "User to authenticate to the proxy as (DOMAIN\\user for NTLM), instead of the one in the proxy's URL")
+			fs.StringVar(&proxyPasswordFile, "proxy-password-file", "", "Path to a file containing the password of the proxy user (default: the "+helper.ProxyPasswordEnvVarName+" environment variable)")
+			fs.StringVar(&proxyAuth, "proxy-auth", helper.ProxyAuthBasic, "How to authenticate to the proxy: basic or ntlm")
+			fs.BoolVar(&noVerifySSL, "no-verify-ssl", false, "To disable SSL verification")
+			fs.StringVar(&caBundle, "ca-bundle", "", "Path to a PEM bundle of the CA certificates against which to verify the endpoint's certificate, instead of the system's (default: "+helper.CABundleEnvVarName+")")
+			fs.StringVar(&tlsMinVersion, "tls-min-version", helper.TLSVersion12, "Minimum TLS version of the connection to the endpoint: 1.2 or 1.3")
+			fs.Func("tls-cipher-suites", "Comma-separated TLS 1.2 cipher suites to offer, such as TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384 (default: the ECDHE suites with AES-GCM or ChaCha20-Poly1305)", func(value string) error {
+				tlsCipherSuites = append(tlsCipherSuites, strings.Split(value, ",")...)
+				return nil
+			})
+		} else if command == "generate-csr" {
+			fs.StringVar(&keyType, "key-type", helper.KeyTypeP256, "Type of the key to generate: p256, p384, or rsa2048")
+			fs.StringVar(&privateKeyId, "private-key", "", "Path to which to write the generated software key (or, with --tpm, TSS2 key)")
+			fs.BoolVar(&tpmKey, "tpm", false, "To generate the key in the TPM")
+			fs.StringVar(&tpmDevice, "tpm-device", "", "TPM device in which to generate the key (default: /dev/tpmrm0)")
+			fs.StringVar(&pivCard, "piv-card", "", "Name (or part of the name) of the PIV card in which to generate the key (default: the first YubiKey)")
+			fs.StringVar(&pivSlot, "piv-slot", "", "PIV slot in which to generate the key: 9a, 9c, 9d, or 9e")
+			fs.StringVar(&pivPinPolicy, "piv-pin-policy", "", "PIN policy of the generated PIV key: never, once, or always (default: once)")
+			fs.StringVar(&pivManagementKey, "piv-management-key", "", "Hex-encoded management key of the PIV card (default: the factory default)")
+			fs.StringVar(&pinFile, "pin-file", "", "Path to a file containing the PIN of the PIV card")
+			fs.StringVar(&subject, "subject", "", "Subject of the CSR, such as CN=host.example.com,O=Example (default: CN=<hostname>)")
+			fs.StringVar(&subjectAltNames, "san", "", "Comma-separated subject alternative names of the CSR: DNS names, IP addresses, email addresses, or URIs")
 		}
 	}
 }
 
+// Adds the flags that control when the long-running modes refresh
+// credentials, and when they hold back from it, which setRefreshSchedule
+// then applies
+func addRefreshFlags(fs *flag.FlagSet) {
+	fs.Float64Var(&refreshFraction, "refresh-fraction", 0, "Fraction of the lifetime of credentials after which to refresh them (default: shortly before they expire)")
+	fs.Float64Var(&refreshJitter, "refresh-jitter", helper.RefreshJitter, "Largest fraction of the time until credentials are refreshed by which to refresh them earlier, at random (default: 0.1)")
+	fs.IntVar(&circuitBreakerThreshold, "circuit-breaker-threshold", helper.CircuitBreakerThreshold, "Consecutive failures to obtain credentials after which to stop trying for a while, backing off (0 never stops; default: 5)")
+}
+
+// Adds the flag that sets how long the serve modes wait, on SIGTERM, for
+// the requests being served to complete, which setShutdownGracePeriod then
+// applies
+func addShutdownFlags(fs *flag.FlagSet) {
+	fs.IntVar(&shutdownGracePeriod, "shutdown-grace-period", 10, "Seconds to wait, on SIGTERM, for requests being served to complete (default: 10)")
+}
+
+// Options that select the private key and the certificate, which all the
+// commands that sign take
+const signerOptionsUsage = `[--intermediates <value>]
+			[--pkcs11-lib <value>]
+			[--pin-file <value>]
+			[--tpm-device <value>]
+			[--tpm-key-password-file <value>]
+			[--key-container <value>]
+			[--machine-key]
+			[--cert-store-location <value>]
+			[--cert-thumbprint <value>]
+			[--cert-subject <value>]
+			[--cert-selector <value>]
+			[--keychain-label <value>]
+			[--keychain-hash <value>]
+			[--secure-enclave-key <value>]
+			[--piv-card <value>]
+			[--piv-slot <value>]
+			[--piv-pin-policy <value>]
+			[--ssh-agent-key <value>]
+			[--gpg-keygrip <value>]
+			[--signer-command <value>]
+			[--signer-endpoint <value>]
+			[--signer-key-id <value>]
+			[--vault-addr <value>]
+			[--vault-key <value>]
+			[--vault-transit-mount <value>]
+			[--vault-role-id <value>]
+			[--vault-secret-id-file <value>]
+			[--vault-pki-mount <value>]
+			[--vault-pki-role <value>]
+			[--vault-pki-common-name <value>]
+			[--vault-pki-ttl <value>]
+			[--vault-pki-cache-dir <value>]
+			[--azure-key-vault <value>]
+			[--azure-certificate <value>]
+			[--azure-client-id <value>]
+			[--gcp-kms-key <value>]
+			[--spiffe-socket <value>]
+			[--spiffe-id <value>]
+			[--pkcs12-bundle <value>]
+			[--keystore <value>]
+			[--keystore-password <value>]
+			[--alias <value>]
+			[--passphrase-file <value>]
+			[--age-identity <value>]`
+
+// Options that control how requests are signed, and when the certificate is
+// warned about
+const signingOptionsUsage = `[--enable-ed25519]
+			[--signing-algorithm <value>]
+			[--digest <value>]
+			[--expiry-warning-days <value>]`
+
+// Options that all the commands that obtain credentials take, beyond the
+// key, certificate, profile, trust anchor, and role
+const credentialsOptionsUsage = `[--endpoint <value>]
+			[--use-fips-endpoint]
+			[--use-dualstack-endpoint]
+			[--failover <value>]
+			[--region <value>]
+			[--session-duration <value>]
+			[--with-proxy]
+			[--proxy-url <value>]
+			[--proxy-user <value>]
+			[--proxy-password-file <value>]
+			[--proxy-auth <value>]
+			[--no-verify-ssl]
+			[--ca-bundle <value>]
+			[--tls-min-version <value>]
+			[--tls-cipher-suites <value>]
+			[--debug]
+			` + signerOptionsUsage + `
+			` + signingOptionsUsage + `
+			[--fetch-intermediates]
+			[--check-revocation]
+			[--role-session-name <value>]
+			[--send-default-role-session-name]
+			[--chained-role-arn <value>]
+			[--session-tag <value>]
+			[--transitive-tag <value>]
+			[--external-id <value>]
+			[--session-policy <value>]
+			[--policy-arn <value>]
+			[--source-identity <value>]
+			[--expiration-buffer <value>]
+			[--connect-timeout <value>]
+			[--tls-handshake-timeout <value>]
+			[--request-timeout <value>]
+			[--user-agent-app-id <value>]
+			[--user-agent-metadata <key>=<value>]`
+
+// Options that control when the long-running modes refresh credentials
+const refreshOptionsUsage = `[--refresh-fraction <value>]
+			[--refresh-jitter <value>]
+			[--circuit-breaker-threshold <value>]`
+
+// Returns the usage message of a command, made up of its own arguments and
+// the blocks of options that it shares with other commands
+func usage(blocks ...string) string {
+	return strings.Join(blocks, "\n\t\t\t")
+}
+
+// Checks that a certificate has been provided, along with a private key.
+// The private key can be omitted if the certificate resides on a PKCS#11
+// token, in which case the key with the matching CKA_ID is used.
+func hasKeyAndCertificate() bool {
+	if certThumbprint != "" || certSubject != "" || certSelector != "" || keychainLabel != "" || keychainHash != "" || signerCommand != "" || signerEndpoint != "" || vaultPKIRole != "" || azureKeyVault != "" || azureCertificate != "" || spiffeSocket != "" || spiffeId != "" || pkcs12Bundle != "" || keystore != "" || pivCard != "" || pivSlot != "" {
+		return true
+	}
+	if certificateId == "" {
+		return false
+	}
+	// The private key can be found in a certificate directory
+	if info, err := os.Stat(certificateId); err == nil && info.IsDir() {
+		return true
+	}
+	return privateKeyId != "" || keyContainer != "" || secureEnclaveKey != "" || sshAgentKey != "" || gpgKeygrip != "" || vaultKey != "" || gcpKMSKey != "" || strings.HasPrefix(certificateId, "pkcs11:")
+}
+
+// Sets when the long-running modes refresh credentials, and when they hold
+// back from it, from the --refresh-fraction, --refresh-jitter, and
+// --circuit-breaker-threshold flags
+func setRefreshSchedule() {
+	if refreshFraction < 0 || refreshFraction >= 1 {
+		log.Println("the refresh fraction has to be between 0 and 1:", refreshFraction)
+		syscall.Exit(1)
+	}
+	if refreshJitter < 0 || refreshJitter >= 1 {
+		log.Println("the refresh jitter has to be between 0 and 1:", refreshJitter)
+		syscall.Exit(1)
+	}
+	helper.RefreshFraction = refreshFraction
+	helper.RefreshJitter = refreshJitter
+	if circuitBreakerThreshold < 0 {
+		log.Println("the circuit breaker threshold can't be negative:", circuitBreakerThreshold)
+		syscall.Exit(1)
+	}
+	helper.CircuitBreakerThreshold = circuitBreakerThreshold
+}
+
+// Sets how long the serve modes wait, on SIGTERM, for the requests being
+// served to complete, from the --shutdown-grace-period flag
+func setShutdownGracePeriod() {
+	if shutdownGracePeriod < 0 {
+		log.Println("the shutdown grace period can't be negative:", shutdownGracePeriod)
+		syscall.Exit(1)
+	}
+	helper.ShutdownGracePeriod = time.Duration(shutdownGracePeriod) * time.Second
+}
+
+// Prints the outcome of each check, and exits with an error status if any
+// of them failed
+func printChecks(results []helper.CheckResult) {
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Printf("FAIL: %s: %v\n", result.Check, result.Err)
+		} else {
+			fmt.Printf("PASS: %s\n", result.Check)
+		}
+	}
+	if !helper.ChecksPassed(results) {
+		syscall.Exit(1)
+	}
+}
+
+// Handles the service command, which installs or removes a Windows service
+// (or, on macOS, a launchd agent) that runs one of the long-running
+// commands, or, when the service control manager (or launchd) starts it,
+// runs that command as the service. Since the arguments
+// that follow the command belong to it, they're handled before (and apart
+// from) those of the other commands.
+func serviceCommand(args []string) {
+	msg := `Usage: aws_signing_helper service
+			install [--name <value>] [--description <value>] <command> [<command parameters>]
+			remove [--name <value>]`
+	if len(args) == 0 {
+		log.Println(msg)
+		syscall.Exit(1)
+	}
+	var serviceName, description string
+	serviceCmd.StringVar(&serviceName, "name", helper.DefaultServiceName, "Name of the Windows service (or label of the launchd agent)")
+	serviceCmd.StringVar(&description, "description", "Provides temporary AWS credentials through IAM Roles Anywhere", "Description of the Windows service")
+	switch args[0] {
+	case "install":
+		serviceCmd.Parse(args[1:])
+		commandArgs := serviceCmd.Args()
+		if len(commandArgs) == 0 {
+			log.Println(msg)
+			syscall.Exit(1)
+		}
+		if _, ok := serviceCommands[commandArgs[0]]; !ok {
+			log.Println("only update, serve, serve-container, serve-pod-identity, and serve-signer can be run as a service")
+			syscall.Exit(1)
+		}
+		err := helper.InstallService(serviceName, description, append([]string{"service", "run", serviceName}, commandArgs...))
+		if err != nil {
+			log.Println("unable to install the service:", err)
+			syscall.Exit(1)
+		}
+		log.Println("installed the service", serviceName)
+	case "remove":
+		serviceCmd.Parse(args[1:])
+		if err := helper.RemoveService(serviceName); err != nil {
+			log.Println("unable to remove the service:", err)
+			syscall.Exit(1)
+		}
+		log.Println("removed the service", serviceName)
+	case "run":
+		if len(args) < 3 {
+			log.Println(msg)
+			syscall.Exit(1)
+		}
+		os.Args = append([]string{os.Args[0]}, args[2:]...)
+		if err := helper.RunService(args[1], run); err != nil {
+			log.Println("unable to run the service:", err)
+			syscall.Exit(1)
+		}
+	default:
+		log.Println(msg)
+		syscall.Exit(1)
+	}
+}
+
 func main() {
+	// When Docker runs the helper as a credential helper (through a link
+	// named docker-credential-<name>), it only passes the action, so the
+	// parameters are taken from the environment
+	if strings.HasPrefix(filepath.Base(os.Args[0]), helper.DockerCredentialHelperPrefix) {
+		dockerArgs, err := helper.SplitDockerCredentialArgs(os.Getenv(helper.DockerCredentialArgsEnvVarName))
+		if err != nil {
+			// Docker reads errors from standard output
+			fmt.Println(err)
+			syscall.Exit(1)
+		}
+		args := append([]string{os.Args[0], "docker-credential"}, dockerArgs...)
+		os.Args = append(args, os.Args[1:]...)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "service" {
+		serviceCommand(os.Args[2:])
+		return
+	}
+	run()
+}
+
+func run() {
 	setupFlags()
 
 	// find and remove global variables
@@ -152,53 +781,201 @@ func main() {
 	if endpointDetected {
 		endpoint = tmpEndpoint
 	}
+	// fall back to the certificate and private key in the environment, or
+	// else in the systemd credentials of the unit
+	if !hasKeyAndCertificate() {
+		if certificateId == "" {
+			certificateId = helper.EnvCredentialPath(helper.CertificateEnvVarName)
+		}
+		if privateKeyId == "" {
+			privateKeyId = helper.EnvCredentialPath(helper.PrivateKeyEnvVarName)
+		}
+		if certificateId == "" {
+			certificateId = helper.SystemdCredentialPath(helper.CertificateCredentialName)
+		}
+		if privateKeyId == "" {
+			privateKeyId = helper.SystemdCredentialPath(helper.PrivateKeyCredentialName)
+		}
+		if certificateBundleId == "" {
+			certificateBundleId = helper.SystemdCredentialPath(helper.IntermediatesCredentialName)
+		}
+	}
+	if roleSessionName == "" {
+		roleSessionName = os.Getenv(helper.RoleSessionNameEnvVarName)
+	}
+	if caBundle == "" {
+		caBundle = os.Getenv(helper.CABundleEnvVarName)
+	}
+	var sessionPolicy string
+	if sessionPolicyFile != "" {
+		data, err := os.ReadFile(sessionPolicyFile)
+		if err != nil {
+			log.Println("unable to read the session policy:", err)
+			syscall.Exit(1)
+		}
+		if !json.Valid(data) {
+			log.Println("the session policy isn't valid JSON")
+			syscall.Exit(1)
+		}
+		sessionPolicy = string(data)
+	}
 	credentialsOptions := helper.CredentialsOpts{
-		PrivateKeyId:        privateKeyId,
-		CertificateId:       certificateId,
-		CertificateBundleId: certificateBundleId,
-		RoleArn:             roleArnStr,
-		ProfileArnStr:       profileArnStr,
-		TrustAnchorArnStr:   trustAnchorArnStr,
-		SessionDuration:     sessionDuration,
-		Region:              region,
-		Endpoint:            endpoint,
-		NoVerifySSL:         noVerifySSL,
-		WithProxy:           withProxy,
-		Debug:               debug,
-		Version:             Version,
+		PrivateKeyId:         privateKeyId,
+		CertificateId:        certificateId,
+		CertificateBundleId:  certificateBundleId,
+		LibPkcs11:            libPkcs11,
+		PinFile:              pinFile,
+		TpmDevice:            tpmDevice,
+		TpmKeyPasswordFile:   tpmKeyPasswordFile,
+		KeyContainer:         keyContainer,
+		MachineKey:           machineKey,
+		CertStoreLocation:    certStoreLocation,
+		CertThumbprint:       certThumbprint,
+		CertSubject:          certSubject,
+		CertSelector:         certSelector,
+		KeychainLabel:        keychainLabel,
+		KeychainHash:         keychainHash,
+		SecureEnclaveKey:     secureEnclaveKey,
+		PivCard:              pivCard,
+		PivSlot:              pivSlot,
+		PivPinPolicy:         pivPinPolicy,
+		SSHAgentKey:          sshAgentKey,
+		GPGKeygrip:           gpgKeygrip,
+		SignerCommand:        signerCommand,
+		SignerEndpoint:       signerEndpoint,
+		SignerKeyId:          signerKeyId,
+		VaultAddr:            vaultAddr,
+		VaultKey:             vaultKey,
+		VaultTransitMount:    vaultTransitMount,
+		VaultRoleId:          vaultRoleId,
+		VaultSecretIdFile:    vaultSecretIdFile,
+		VaultPKIMount:        vaultPKIMount,
+		VaultPKIRole:         vaultPKIRole,
+		VaultPKICommonName:   vaultPKICommonName,
+		VaultPKITTL:          vaultPKITTL,
+		VaultPKICacheDir:     vaultPKICacheDir,
+		AzureKeyVault:        azureKeyVault,
+		AzureCertificate:     azureCertificate,
+		AzureClientId:        azureClientId,
+		GCPKMSKey:            gcpKMSKey,
+		SPIFFESocket:         spiffeSocket,
+		SPIFFEId:             spiffeId,
+		Pkcs12Bundle:         pkcs12Bundle,
+		Keystore:             keystore,
+		KeystorePassword:     keystorePassword,
+		KeystoreAlias:        keystoreAlias,
+		PassphraseFile:       passphraseFile,
+		AgeIdentity:          ageIdentity,
+		EnableEd25519:        enableEd25519,
+		SigningAlgorithm:     signingAlgorithm,
+		Digest:               digestArg,
+		FetchIntermediates:   fetchIntermediates,
+		ExpiryWarningDays:    expiryWarningDays,
+		CheckRevocation:      checkRevocation,
+		RoleArn:              roleArnStr,
+		ProfileArnStr:        profileArnStr,
+		TrustAnchorArnStr:    trustAnchorArnStr,
+		SessionDuration:      sessionDuration,
+		RoleSessionName:      roleSessionName,
+		SendDefaultName:      sendDefaultName,
+		ChainedRoleArns:      chainedRoleArns,
+		SessionTags:          sessionTags,
+		TransitiveTagKeys:    transitiveTagKeys,
+		ExternalId:           externalId,
+		SessionPolicy:        sessionPolicy,
+		PolicyArns:           policyArns,
+		SourceIdentity:       sourceIdentity,
+		ExpirationBuffer:     expirationBuffer,
+		Region:               region,
+		Endpoint:             endpoint,
+		UseFIPSEndpoint:      useFIPSEndpoint,
+		UseDualStackEndpoint: useDualStack,
+		FailoverTargets:      failoverTargets,
+		NoVerifySSL:          noVerifySSL,
+		CABundle:             caBundle,
+		TLSMinVersion:        tlsMinVersion,
+		TLSCipherSuites:      tlsCipherSuites,
+		WithProxy:            withProxy,
+		ProxyURL:             proxyURL,
+		ProxyUser:            proxyUser,
+		ProxyPasswordFile:    proxyPasswordFile,
+		ProxyAuth:            proxyAuth,
+		ConnectTimeout:       connectTimeout,
+		TLSHandshakeTimeout:  tlsHandshakeTimeout,
+		RequestTimeout:       requestTimeout,
+		Debug:                debug,
+		Version:              Version,
+		UserAgentAppId:       userAgentAppId,
+		UserAgentMetadata:    userAgentMetadata,
 	}
 
 	switch command {
 	case "credential-process":
 		// First check whether required arguments are present
-		if privateKeyId == "" || certificateId == "" || profileArnStr == "" ||
+		if !hasKeyAndCertificate() || profileArnStr == "" ||
 			trustAnchorArnStr == "" || roleArnStr == "" {
-			msg := `Usage: aws_signing_helper credential-process
-			--private-key <value> 
-			--certificate <value> 
-			--profile-arn <value> 
+			msg := usage(`Usage: aws_signing_helper credential-process
+			--private-key <value>
+			--certificate <value>
+			--profile-arn <value>
 			--trust-anchor-arn <value>
-			--role-arn <value> 
-			[--endpoint <value>] 
-			[--region <value>] 
-			[--session-duration <value>]
-			[--with-proxy]
-			[--no-verify-ssl]
-			[--debug]
-			[--intermediates <value>]`
+			--role-arn <value>`,
+				credentialsOptionsUsage,
+				`[--output-file <value>]
+			[--cache]
+			[--cache-backend <value>]
+			[--cache-dir <value>]
+			[--cache-encryption <value>]`)
 			log.Println(msg)
 			syscall.Exit(1)
 		}
-		credentialProcessOutput, err := helper.GenerateCredentials(&credentialsOptions)
+		var credentialProcessOutput helper.CredentialProcessOutput
+		var err error
+		if useCache {
+			credentialProcessOutput, err = helper.GenerateCachedCredentials(&credentialsOptions, helper.CacheOpts{
+				Dir:        cacheDir,
+				Backend:    cacheBackend,
+				Encryption: cacheEncryption,
+				TpmDevice:  tpmDevice,
+			})
+		} else {
+			credentialProcessOutput, err = helper.GenerateCredentials(&credentialsOptions)
+		}
 		if err != nil {
 			log.Println(err)
 			syscall.Exit(1)
 		}
+		if outputFile != "" {
+			if err = helper.WriteCredentialProcessOutput(outputFile, credentialProcessOutput); err != nil {
+				log.Println("unable to write the credentials to the output file:", err)
+				syscall.Exit(1)
+			}
+		}
 		buf, _ := json.Marshal(credentialProcessOutput)
 		fmt.Print(string(buf[:]))
 	case "sign-string":
+		if privateKeyId == "-" {
+			log.Println("the private key can't be read from standard input, which holds the string to sign")
+			syscall.Exit(1)
+		}
 		stringToSign, _ := ioutil.ReadAll(bufio.NewReader(os.Stdin))
-		privateKey, _ := helper.ReadPrivateKeyData(privateKeyId)
+		privateKey, err := helper.ReadPrivateKeyData(privateKeyId)
+		if errors.Is(err, helper.ErrEncryptedPrivateKey) && ageIdentity != "" {
+			if privateKey, err = helper.ReadAgeEncryptedPrivateKeyData(privateKeyId, ageIdentity); err != nil {
+				log.Println(err)
+				syscall.Exit(1)
+			}
+		} else if errors.Is(err, helper.ErrEncryptedPrivateKey) {
+			passphrase, err := helper.GetPassphrase(passphraseFile, "Please enter the passphrase for the private key:")
+			if err != nil {
+				log.Println(err)
+				syscall.Exit(1)
+			}
+			if privateKey, err = helper.ReadEncryptedPrivateKeyData(privateKeyId, passphrase); err != nil {
+				log.Println(err)
+				syscall.Exit(1)
+			}
+		}
 		var digest crypto.Hash
 		switch strings.ToUpper(digestArg) {
 		case "SHA256":
@@ -230,48 +1007,502 @@ func main() {
 	case "version":
 		fmt.Println(Version)
 	case "update":
-		if privateKeyId == "" || certificateId == "" ||
+		if !hasKeyAndCertificate() ||
 			profileArnStr == "" || trustAnchorArnStr == "" || roleArnStr == "" {
-			msg := `Usage: aws_signing_helper update
-			--private-key <value> 
-			--certificate <value> 
-			--profile-arn <value> 
+			msg := usage(`Usage: aws_signing_helper update
+			--private-key <value>
+			--certificate <value>
+			--profile-arn <value>
 			--trust-anchor-arn <value>
-			--role-arn <value> 
-			[--endpoint <value>] 
-			[--region <value>]
-			[--session-duration <value>]
-			[--with-proxy]
-			[--no-verify-ssl]
-			[--intermediates <value>]
-			[--profile <value>]
-			[--once]`
+			--role-arn <value>`,
+				credentialsOptionsUsage,
+				`[--profile <value>]
+			[--credentials-file <value>]
+			[--once]`,
+				refreshOptionsUsage)
+			log.Println(msg)
+			syscall.Exit(1)
+		}
+		setRefreshSchedule()
+		helper.UpdateFile(credentialsOptions, credentialsFile, profile, once)
+	case "write-credentials":
+		if !hasKeyAndCertificate() ||
+			profileArnStr == "" || trustAnchorArnStr == "" || roleArnStr == "" {
+			msg := usage(`Usage: aws_signing_helper write-credentials
+			--private-key <value>
+			--certificate <value>
+			--profile-arn <value>
+			--trust-anchor-arn <value>
+			--role-arn <value>`,
+				credentialsOptionsUsage,
+				`[--profile <value>]
+			[--credentials-file <value>]`)
 			log.Println(msg)
 			syscall.Exit(1)
 		}
-		helper.Update(credentialsOptions, profile, once)
+		helper.UpdateFile(credentialsOptions, credentialsFile, profile, true)
 	case "serve":
 		// First check whether required arguments are present
-		if privateKeyId == "" || certificateId == "" || profileArnStr == "" ||
+		if !hasKeyAndCertificate() || profileArnStr == "" ||
 			trustAnchorArnStr == "" || roleArnStr == "" {
-			msg := `Usage: aws_signing_helper serve
-			--private-key <value> 
-			--certificate <value> 
-			--profile-arn <value> 
+			msg := usage(`Usage: aws_signing_helper serve
+			--private-key <value>
+			--certificate <value>
+			--profile-arn <value>
 			--trust-anchor-arn <value>
-			--role-arn <value> 
-			[--endpoint <value>] 
-			[--region <value>] 
-			[--session-duration <value>]
+			--role-arn <value>`,
+				credentialsOptionsUsage,
+				`[--port <value>]
+			[--max-token-ttl <value>]
+			[--http-tokens <value>]
+			[--socket <value>]
+			[--socket-mode <value>]
+			[--pipe <value>]
+			[--pipe-security-descriptor <value>]
+			[--role <value>]...
+			[--metrics]
+			[--shutdown-grace-period <value>]`,
+				refreshOptionsUsage)
+			log.Println(msg)
+			syscall.Exit(1)
+		}
+		if maxTokenTTL < 1 || maxTokenTTL > 21600 {
+			log.Println("the maximum token TTL has to be between 1 and 21600 seconds")
+			syscall.Exit(1)
+		}
+		switch httpTokens {
+		case "required":
+			helper.TokensRequired = true
+		case "optional":
+			helper.TokensRequired = false
+		default:
+			log.Println("--http-tokens has to be required or optional")
+			syscall.Exit(1)
+		}
+		helper.MaxTokenTTL = maxTokenTTL
+		// Additional roles use the same options apart from their ARNs, which
+		// default to those of the first role
+		var additionalRoles []helper.CredentialsOpts
+		for _, roleSpec := range roleSpecs {
+			arns := strings.Split(roleSpec, ",")
+			if len(arns) > 3 || arns[0] == "" {
+				log.Println("invalid role (expected <role-arn>[,<profile-arn>[,<trust-anchor-arn>]]):", roleSpec)
+				syscall.Exit(1)
+			}
+			role := credentialsOptions
+			role.RoleArn = arns[0]
+			if len(arns) > 1 && arns[1] != "" {
+				role.ProfileArnStr = arns[1]
+			}
+			if len(arns) > 2 && arns[2] != "" {
+				role.TrustAnchorArnStr = arns[2]
+			}
+			additionalRoles = append(additionalRoles, role)
+		}
+		helper.MetricsEnabled = metricsEnabled
+		setShutdownGracePeriod()
+		setRefreshSchedule()
+		if socketPath != "" {
+			mode, err := strconv.ParseUint(socketMode, 8, 32)
+			if err != nil || mode > 0777 {
+				log.Println("invalid socket mode:", socketMode)
+				syscall.Exit(1)
+			}
+			helper.ServeUnixSocket(socketPath, os.FileMode(mode), credentialsOptions, additionalRoles...)
+		} else if pipePath != "" {
+			helper.ServeNamedPipe(pipePath, pipeSDDL, credentialsOptions, additionalRoles...)
+		} else {
+			helper.Serve(port, credentialsOptions, additionalRoles...)
+		}
+	case "serve-container":
+		// First check whether required arguments are present
+		if !hasKeyAndCertificate() || profileArnStr == "" ||
+			trustAnchorArnStr == "" || roleArnStr == "" {
+			msg := usage(`Usage: aws_signing_helper serve-container
+			--private-key <value>
+			--certificate <value>
+			--profile-arn <value>
+			--trust-anchor-arn <value>
+			--role-arn <value>`,
+				credentialsOptionsUsage,
+				`[--port <value>]
+			[--authorization-token-file <value>]
+			[--metrics]
+			[--shutdown-grace-period <value>]`,
+				refreshOptionsUsage)
+			log.Println(msg)
+			syscall.Exit(1)
+		}
+		var authorizationToken string
+		if authorizationTokenFile != "" {
+			data, err := os.ReadFile(authorizationTokenFile)
+			if err != nil {
+				log.Println("unable to read authorization token file:", err)
+				syscall.Exit(1)
+			}
+			authorizationToken = strings.TrimSpace(string(data))
+			if authorizationToken == "" {
+				log.Println("the authorization token file is empty")
+				syscall.Exit(1)
+			}
+		}
+		helper.MetricsEnabled = metricsEnabled
+		setShutdownGracePeriod()
+		setRefreshSchedule()
+		helper.ServeContainerCredentials(port, authorizationToken, credentialsOptions)
+	case "serve-pod-identity":
+		// First check whether required arguments are present
+		if !hasKeyAndCertificate() || profileArnStr == "" || jwksFile == "" ||
+			trustAnchorArnStr == "" || roleArnStr == "" {
+			msg := usage(`Usage: aws_signing_helper serve-pod-identity
+			--private-key <value>
+			--certificate <value>
+			--profile-arn <value>
+			--trust-anchor-arn <value>
+			--role-arn <value>
+			--jwks-file <value>`,
+				credentialsOptionsUsage,
+				`[--listen <value>]
+			[--service-account-issuer <value>]
+			[--service-account <value>]
+			[--metrics]
+			[--shutdown-grace-period <value>]`,
+				refreshOptionsUsage)
+			log.Println(msg)
+			syscall.Exit(1)
+		}
+		podIdentityOpts := helper.PodIdentityOpts{JWKSFile: jwksFile, Issuer: serviceAccountIssuer}
+		for _, serviceAccount := range strings.Split(serviceAccounts, ",") {
+			if serviceAccount = strings.TrimSpace(serviceAccount); serviceAccount != "" {
+				podIdentityOpts.ServiceAccounts = append(podIdentityOpts.ServiceAccounts, serviceAccount)
+			}
+		}
+		helper.MetricsEnabled = metricsEnabled
+		setShutdownGracePeriod()
+		setRefreshSchedule()
+		helper.ServePodIdentity(listenAddr, podIdentityOpts, credentialsOptions)
+	case "exec":
+		if !hasKeyAndCertificate() || profileArnStr == "" ||
+			trustAnchorArnStr == "" || roleArnStr == "" || len(commandFs.Args()) == 0 {
+			msg := usage(`Usage: aws_signing_helper exec
+			--private-key <value>
+			--certificate <value>
+			--profile-arn <value>
+			--trust-anchor-arn <value>
+			--role-arn <value>`,
+				credentialsOptionsUsage,
+				`[--restart]
+			-- <command> [<arguments>]`)
+			log.Println(msg)
+			syscall.Exit(1)
+		}
+		status, err := helper.Exec(&credentialsOptions, commandFs.Args(), restartOnExpiry)
+		if err != nil {
+			log.Println(err)
+			syscall.Exit(1)
+		}
+		syscall.Exit(status)
+	case "export-credentials":
+		if !hasKeyAndCertificate() || profileArnStr == "" ||
+			trustAnchorArnStr == "" || roleArnStr == "" {
+			msg := usage(`Usage: aws_signing_helper export-credentials
+			--private-key <value>
+			--certificate <value>
+			--profile-arn <value>
+			--trust-anchor-arn <value>
+			--role-arn <value>`,
+				credentialsOptionsUsage,
+				`[--format <value>]`)
+			log.Println(msg)
+			syscall.Exit(1)
+		}
+		credentialProcessOutput, err := helper.GenerateCredentials(&credentialsOptions)
+		if err != nil {
+			log.Println(err)
+			syscall.Exit(1)
+		}
+		region, err := helper.CredentialsRegion(&credentialsOptions)
+		if err != nil {
+			log.Println(err)
+			syscall.Exit(1)
+		}
+		statements, err := helper.FormatCredentialsForShell(os.Environ(), credentialProcessOutput, region, format)
+		if err != nil {
+			log.Println(err)
+			syscall.Exit(1)
+		}
+		fmt.Print(statements)
+	case "eks-token":
+		if !hasKeyAndCertificate() || profileArnStr == "" ||
+			trustAnchorArnStr == "" || roleArnStr == "" || clusterName == "" {
+			msg := usage(`Usage: aws_signing_helper eks-token
+			--private-key <value>
+			--certificate <value>
+			--profile-arn <value>
+			--trust-anchor-arn <value>
+			--role-arn <value>
+			--cluster-name <value>`,
+				credentialsOptionsUsage)
+			log.Println(msg)
+			syscall.Exit(1)
+		}
+		execCredential, err := helper.GetEKSExecCredential(&credentialsOptions, clusterName)
+		if err != nil {
+			log.Println(err)
+			syscall.Exit(1)
+		}
+		buf, _ := json.Marshal(execCredential)
+		fmt.Print(string(buf[:]))
+	case "ecr-credential-provider":
+		if !hasKeyAndCertificate() || profileArnStr == "" ||
+			trustAnchorArnStr == "" || roleArnStr == "" {
+			msg := usage(`Usage: aws_signing_helper ecr-credential-provider
+			--private-key <value>
+			--certificate <value>
+			--profile-arn <value>
+			--trust-anchor-arn <value>
+			--role-arn <value>`,
+				credentialsOptionsUsage)
+			log.Println(msg)
+			syscall.Exit(1)
+		}
+		if certificateId == "-" || privateKeyId == "-" || certificateBundleId == "-" || pkcs12Bundle == "-" || keystore == "-" {
+			log.Println("the certificate and private key can't be read from standard input, which holds the kubelet's request")
+			syscall.Exit(1)
+		}
+		if err := helper.ProvideECRCredentials(&credentialsOptions, os.Stdin, os.Stdout); err != nil {
+			log.Println(err)
+			syscall.Exit(1)
+		}
+	case "docker-credential":
+		if !hasKeyAndCertificate() || profileArnStr == "" ||
+			trustAnchorArnStr == "" || roleArnStr == "" || len(commandFs.Args()) != 1 {
+			msg := usage(`Usage: aws_signing_helper docker-credential
+			--private-key <value>
+			--certificate <value>
+			--profile-arn <value>
+			--trust-anchor-arn <value>
+			--role-arn <value>`,
+				credentialsOptionsUsage,
+				`get | store | erase | list`)
+			log.Println(msg)
+			syscall.Exit(1)
+		}
+		if certificateId == "-" || privateKeyId == "-" || certificateBundleId == "-" || pkcs12Bundle == "-" || keystore == "-" {
+			log.Println("the certificate and private key can't be read from standard input, which holds Docker's request")
+			syscall.Exit(1)
+		}
+		// Docker reads errors from standard output
+		if err := helper.ServeDockerCredentials(&credentialsOptions, commandFs.Arg(0), os.Stdin, os.Stdout); err != nil {
+			fmt.Println(err)
+			syscall.Exit(1)
+		}
+	case "git-credential":
+		if !hasKeyAndCertificate() || profileArnStr == "" ||
+			trustAnchorArnStr == "" || roleArnStr == "" || len(commandFs.Args()) != 1 {
+			msg := usage(`Usage: aws_signing_helper git-credential
+			--private-key <value>
+			--certificate <value>
+			--profile-arn <value>
+			--trust-anchor-arn <value>
+			--role-arn <value>`,
+				credentialsOptionsUsage,
+				`get | store | erase`)
+			log.Println(msg)
+			syscall.Exit(1)
+		}
+		if certificateId == "-" || privateKeyId == "-" || certificateBundleId == "-" || pkcs12Bundle == "-" || keystore == "-" {
+			log.Println("the certificate and private key can't be read from standard input, which holds Git's request")
+			syscall.Exit(1)
+		}
+		if err := helper.ServeGitCredentials(&credentialsOptions, commandFs.Arg(0), os.Stdin, os.Stdout); err != nil {
+			log.Println(err)
+			syscall.Exit(1)
+		}
+	case "serve-signer":
+		if !hasKeyAndCertificate() || listenAddr == "" {
+			msg := usage(`Usage: aws_signing_helper serve-signer
+			--private-key <value>
+			--certificate <value>
+			--listen <value>`,
+				signerOptionsUsage)
+			log.Println(msg)
+			syscall.Exit(1)
+		}
+		if err := helper.ServeSigner(listenAddr, credentialsOptions); err != nil {
+			log.Println(err)
+			syscall.Exit(1)
+		}
+	case "self-test":
+		if !hasKeyAndCertificate() {
+			msg := usage(`Usage: aws_signing_helper self-test
+			--private-key <value>
+			--certificate <value>`,
+				signerOptionsUsage,
+				signingOptionsUsage)
+			log.Println(msg)
+			syscall.Exit(1)
+		}
+		results := helper.SelfTest(&credentialsOptions)
+		printChecks(results)
+	case "validate":
+		if !hasKeyAndCertificate() {
+			msg := usage(`Usage: aws_signing_helper validate
+			--private-key <value>
+			--certificate <value>
+			--profile-arn <value>
+			--trust-anchor-arn <value>
+			--role-arn <value>
+			[--region <value>]
+			[--session-duration <value>]`,
+				signerOptionsUsage,
+				signingOptionsUsage,
+				`[--trust-anchor-certificate <value>]`)
+			log.Println(msg)
+			syscall.Exit(1)
+		}
+		results := helper.Validate(&credentialsOptions, trustAnchorCert)
+		printChecks(results)
+	case "diagnose":
+		if region == "" && endpoint == "" && trustAnchorArnStr == "" {
+			msg := `Usage: aws_signing_helper diagnose
+			--region <value> | --trust-anchor-arn <value> | --endpoint <value>
+			[--use-fips-endpoint]
+			[--use-dualstack-endpoint]
 			[--with-proxy]
+			[--proxy-url <value>]
+			[--proxy-user <value>]
+			[--proxy-password-file <value>]
+			[--proxy-auth <value>]
 			[--no-verify-ssl]
-			[--debug]
-			[--intermediates <value>]
-			[--port <value>]`
+			[--ca-bundle <value>]
+			[--tls-min-version <value>]
+			[--tls-cipher-suites <value>]`
+			log.Println(msg)
+			syscall.Exit(1)
+		}
+		printChecks(helper.Diagnose(&credentialsOptions))
+	case "list-keys":
+		slots, err := helper.ListPKCS11Objects(libPkcs11, pkcs11Uri, pinFile)
+		if err != nil {
+			log.Println(err)
+			syscall.Exit(1)
+		}
+		for _, slot := range slots {
+			fmt.Printf("Slot %d: token %q (manufacturer %q, model %q, serial %q)\n",
+				slot.SlotId, slot.TokenLabel, slot.Manufacturer, slot.Model, slot.SerialNumber)
+			for _, object := range slot.Objects {
+				fmt.Printf("\t%s\n", object.Uri)
+				if object.Subject != "" {
+					fmt.Printf("\t\tSubject: %s\n", object.Subject)
+				}
+			}
+		}
+	case "generate-secure-enclave-key":
+		if secureEnclaveKey == "" {
+			msg := `Usage: aws_signing_helper generate-secure-enclave-key
+			--secure-enclave-key <value>
+			[--common-name <value>]`
+			log.Println(msg)
+			syscall.Exit(1)
+		}
+		if commonName == "" {
+			commonName = secureEnclaveKey
+		}
+		signer, err := helper.CreateSecureEnclaveKey(secureEnclaveKey)
+		if err != nil {
+			log.Println(err)
+			syscall.Exit(1)
+		}
+		csr, err := helper.CreateCertificateRequest(signer, commonName)
+		signer.Close()
+		if err != nil {
+			log.Println(err)
+			syscall.Exit(1)
+		}
+		fmt.Print(string(csr))
+	case "attest":
+		var statement []byte
+		var err error
+		if pivCard != "" || pivSlot != "" {
+			statement, err = helper.AttestPIVKey(pivCard, pivSlot)
+		} else if privateKeyId != "" {
+			var nonce []byte
+			if nonce, err = hex.DecodeString(attestNonce); err != nil {
+				log.Println("invalid nonce:", err)
+				syscall.Exit(1)
+			}
+			statement, err = helper.AttestTPMKey(tpmDevice, privateKeyId, "", pinFile, nonce)
+		} else {
+			msg := `Usage: aws_signing_helper attest
+			--piv-slot <value> | --private-key <value>
+			[--piv-card <value>]
+			[--tpm-device <value>]
+			[--pin-file <value>]
+			[--nonce <value>]`
+			log.Println(msg)
+			syscall.Exit(1)
+		}
+		if err != nil {
+			log.Println(err)
+			syscall.Exit(1)
+		}
+		fmt.Print(string(statement))
+	case "generate-csr":
+		if pivCard == "" && pivSlot == "" && privateKeyId == "" {
+			msg := `Usage: aws_signing_helper generate-csr
+			--private-key <value> | --piv-slot <value>
+			[--key-type <value>]
+			[--subject <value>]
+			[--san <value>]
+			[--tpm]
+			[--tpm-device <value>]
+			[--piv-card <value>]
+			[--piv-pin-policy <value>]
+			[--piv-management-key <value>]
+			[--pin-file <value>]`
 			log.Println(msg)
 			syscall.Exit(1)
 		}
-		helper.Serve(port, credentialsOptions)
+		if subject == "" {
+			hostname, err := os.Hostname()
+			if err != nil {
+				log.Println("unable to determine the subject from the hostname:", err)
+				syscall.Exit(1)
+			}
+			subject = "CN=" + hostname
+		}
+		var signer crypto.Signer
+		closeSigner := func() {}
+		var err error
+		if pivCard != "" || pivSlot != "" {
+			var pivSigner helper.Signer
+			if pivSigner, err = helper.GeneratePIVKey(pivCard, pivSlot, keyType, pivPinPolicy, pivManagementKey, pinFile); err == nil {
+				signer, closeSigner = pivSigner, pivSigner.Close
+			}
+		} else if tpmKey {
+			var tpmSigner helper.Signer
+			if tpmSigner, err = helper.GenerateTPMKey(tpmDevice, keyType, privateKeyId); err == nil {
+				signer, closeSigner = tpmSigner, tpmSigner.Close
+			}
+		} else {
+			signer, err = helper.GenerateSoftwareKey(keyType, privateKeyId)
+		}
+		if err != nil {
+			log.Println(err)
+			syscall.Exit(1)
+		}
+		var sans []string
+		if subjectAltNames != "" {
+			sans = strings.Split(subjectAltNames, ",")
+		}
+		csr, err := helper.CreateCertificateRequestWithSubject(signer, subject, sans)
+		closeSigner()
+		if err != nil {
+			log.Println(err)
+			syscall.Exit(1)
+		}
+		fmt.Print(string(csr))
 	case "":
 		log.Println("No command provided")
 		syscall.Exit(1)
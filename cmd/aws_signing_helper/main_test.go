@@ -1,16 +1,20 @@
 package main
 
 import (
+	"sync"
 	"testing"
 )
 
+// The flags can only be set up once, since the flag sets are shared
+var setupFlagsOnce sync.Once
+
 func TestParseArgs(t *testing.T) {
 	args := []string{
 		"read-certificate-data",
 		"--certificate",
 		"/path/to/cert.pem",
 	}
-	setupFlags()
+	setupFlagsOnce.Do(setupFlags)
 	var command = commands[args[0]]
 	command.Parse(args[1:])
 
@@ -18,3 +22,33 @@ func TestParseArgs(t *testing.T) {
 		t.Errorf("Expected %s, got %s", "/path/to/cert.pem", certificateId)
 	}
 }
+
+func TestFindGlobalVarStopsAtCommand(t *testing.T) {
+	globalVars, parseList := findGlobalVar([]string{"exec", "--region", "us-west-2", "--", "aws", "--region", "eu-west-1"})
+	if globalVars["--region"] != "us-west-2" {
+		t.Errorf("Expected region %s, got %s", "us-west-2", globalVars["--region"])
+	}
+	if len(parseList) != 5 || parseList[4] != "eu-west-1" {
+		t.Errorf("Expected the command's arguments to be kept, got %v", parseList)
+	}
+}
+
+func TestRefreshFlags(t *testing.T) {
+	setupFlagsOnce.Do(setupFlags)
+	for _, command := range []string{"update", "serve", "serve-container", "serve-pod-identity"} {
+		for _, name := range []string{"refresh-fraction", "refresh-jitter", "circuit-breaker-threshold"} {
+			if commands[command].Lookup(name) == nil {
+				t.Errorf("Expected %s to take --%s", command, name)
+			}
+		}
+	}
+}
+
+func TestShutdownFlags(t *testing.T) {
+	setupFlagsOnce.Do(setupFlags)
+	for _, command := range []string{"serve", "serve-container", "serve-pod-identity"} {
+		if commands[command].Lookup("shutdown-grace-period") == nil {
+			t.Errorf("Expected %s to take --shutdown-grace-period", command)
+		}
+	}
+}
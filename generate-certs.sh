@@ -48,6 +48,72 @@ for l in $rsa_key_lengths; do
 	done;
 done;
 
+# Create an Ed25519 key and certificate (Ed25519 signatures don't use a
+# separate digest)
+openssl genpkey -algorithm ed25519 -out ${basedir}/tst/certs/ed25519-key.pem
+openssl req -x509 -new \
+	-key ${basedir}/tst/certs/ed25519-key.pem \
+	-out ${basedir}/tst/certs/ed25519-cert.pem \
+	-days 365 \
+	-subj "/CN=roles-anywhere-ed25519"
+
 # Create certificate bundle
 cp ${basedir}/tst/certs/rsa-2048-sha256-cert.pem ${basedir}/tst/certs/cert-bundle.pem
 cat ${basedir}/tst/certs/ec-prime256v1-sha256-cert.pem >> ${basedir}/tst/certs/cert-bundle.pem
+
+# Create PKCS#12 bundles (with an extra certificate as the chain), with and
+# without a passphrase
+openssl pkcs12 -export \
+	-inkey ${basedir}/tst/certs/ec-prime256v1-key.pem \
+	-in ${basedir}/tst/certs/ec-prime256v1-sha256-cert.pem \
+	-certfile ${basedir}/tst/certs/rsa-2048-sha256-cert.pem \
+	-out ${basedir}/tst/certs/ec-prime256v1-sha256.p12 \
+	-passout pass:
+openssl pkcs12 -export \
+	-inkey ${basedir}/tst/certs/rsa-2048-key.pem \
+	-in ${basedir}/tst/certs/rsa-2048-sha256-cert.pem \
+	-out ${basedir}/tst/certs/rsa-2048-sha256-encrypted.p12 \
+	-passout pass:test-passphrase
+
+# Create encrypted private keys, both as encrypted PKCS#8 keys and with the
+# legacy OpenSSL PEM encryption
+openssl pkcs8 -topk8 -v2 aes-256-cbc -v2prf hmacWithSHA256 \
+	-in ${basedir}/tst/certs/ec-prime256v1-key.pem \
+	-out ${basedir}/tst/certs/ec-prime256v1-key-pkcs8-encrypted.pem \
+	-passout pass:test-passphrase
+openssl pkcs8 -topk8 -v2 des3 -v2prf hmacWithSHA1 \
+	-in ${basedir}/tst/certs/rsa-2048-key.pem \
+	-out ${basedir}/tst/certs/rsa-2048-key-pkcs8-encrypted.pem \
+	-passout pass:test-passphrase
+openssl ec -aes256 \
+	-in ${basedir}/tst/certs/ec-prime256v1-key.pem \
+	-out ${basedir}/tst/certs/ec-prime256v1-key-encrypted.pem \
+	-passout pass:test-passphrase
+openssl rsa -aes256 -traditional \
+	-in ${basedir}/tst/certs/rsa-2048-key.pem \
+	-out ${basedir}/tst/certs/rsa-2048-key-encrypted.pem \
+	-passout pass:test-passphrase
+
+# Create DER-encoded certificates, keys, and PKCS#7 bundles
+openssl x509 -outform DER \
+	-in ${basedir}/tst/certs/rsa-2048-sha256-cert.pem \
+	-out ${basedir}/tst/certs/rsa-2048-sha256-cert.der
+openssl pkcs8 -topk8 -nocrypt -outform DER \
+	-in ${basedir}/tst/certs/rsa-2048-key.pem \
+	-out ${basedir}/tst/certs/rsa-2048-key.der
+openssl ec -outform DER \
+	-in ${basedir}/tst/certs/ec-prime256v1-key.pem \
+	-out ${basedir}/tst/certs/ec-prime256v1-key.der
+openssl pkcs8 -topk8 -v2 aes-256-cbc -outform DER \
+	-in ${basedir}/tst/certs/ec-prime256v1-key.pem \
+	-out ${basedir}/tst/certs/ec-prime256v1-key-pkcs8-encrypted.der \
+	-passout pass:test-passphrase
+openssl crl2pkcs7 -nocrl -outform DER \
+	-certfile ${basedir}/tst/certs/ec-prime256v1-sha256-cert.pem \
+	-out ${basedir}/tst/certs/ec-prime256v1-sha256-cert.p7b
+openssl crl2pkcs7 -nocrl -outform DER \
+	-certfile ${basedir}/tst/certs/cert-bundle.pem \
+	-out ${basedir}/tst/certs/cert-bundle.p7b
+openssl crl2pkcs7 -nocrl \
+	-certfile ${basedir}/tst/certs/cert-bundle.pem \
+	-out ${basedir}/tst/certs/cert-bundle-pkcs7.pem
@@ -1,7 +1,39 @@
 module github.com/aws/rolesanywhere-credential-helper
 
-go 1.18
+go 1.24
 
-require github.com/aws/aws-sdk-go v1.44.57
+require (
+	filippo.io/age v1.0.0
+	github.com/Microsoft/go-winio v0.6.0
+	github.com/aws/aws-sdk-go v1.44.57
+	github.com/aws/aws-sdk-go-v2 v1.41.5
+	github.com/aws/aws-sdk-go-v2/service/ecr v1.44.0
+	github.com/aws/aws-sdk-go-v2/service/sts v1.41.10
+	github.com/aws/smithy-go v1.24.2
+	github.com/fsnotify/fsnotify v1.6.0
+	github.com/go-jose/go-jose/v3 v3.0.0
+	github.com/go-piv/piv-go v1.11.0
+	github.com/google/go-tpm v0.3.3
+	github.com/miekg/pkcs11 v1.1.1
+	github.com/spiffe/go-spiffe/v2 v2.1.4
+	golang.org/x/crypto v0.6.0
+	golang.org/x/sys v0.5.0
+	golang.org/x/term v0.5.0
+	google.golang.org/grpc v1.53.0
+	google.golang.org/protobuf v1.28.1
+	software.sslmate.com/src/go-pkcs12 v0.2.0
+)
 
-require github.com/jmespath/go-jmespath v0.4.0 // indirect
+require (
+	github.com/aws/aws-sdk-go-v2/internal/configsources v1.4.21 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/endpoints/v2 v2.7.21 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/accept-encoding v1.13.7 // indirect
+	github.com/aws/aws-sdk-go-v2/service/internal/presigned-url v1.13.21 // indirect
+	github.com/golang/protobuf v1.5.2 // indirect
+	github.com/zeebo/errs v1.3.0 // indirect
+	golang.org/x/mod v0.8.0 // indirect
+	golang.org/x/net v0.7.0 // indirect
+	golang.org/x/text v0.7.0 // indirect
+	golang.org/x/tools v0.6.0 // indirect
+	google.golang.org/genproto v0.0.0-20230223222841-637eb2293923 // indirect
+)
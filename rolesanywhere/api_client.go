@@ -0,0 +1,191 @@
+package rolesanywhere
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	smithy "github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/logging"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Identifiers of the service, as they appear in errors, and with which
+// requests are signed
+const (
+	ServiceID   = "RolesAnywhere"
+	SigningName = "rolesanywhere"
+)
+
+// Client of IAM Roles Anywhere's CreateSession operation
+type Client struct {
+	options Options
+}
+
+type HTTPClient interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// Signs requests. It has the signature of aws-sdk-go-v2's SigV4 signer, so
+// that it can be used in its place, although the credentials passed to it
+// are always empty: implementations sign requests with the key of an X.509
+// certificate instead.
+type HTTPSignerV4 interface {
+	SignHTTP(ctx context.Context, credentials aws.Credentials, r *http.Request, payloadHash string, service string, region string, signingTime time.Time, optFns ...func(*v4.SignerOptions)) error
+}
+
+type Options struct {
+	// Functions that modify the middleware stack of each operation, after
+	// the client's own middleware has been added to it
+	APIOptions []func(*middleware.Stack) error
+
+	// URL of the endpoint that requests are sent to. If it isn't set, the
+	// regional endpoint (in the aws partition) is used.
+	BaseEndpoint *string
+
+	// What the logger logs
+	ClientLogMode aws.ClientLogMode
+
+	// Client through which requests are sent. If it isn't set, the SDK's
+	// default one is used.
+	HTTPClient HTTPClient
+
+	// Signer of requests, which has to be set
+	HTTPSignerV4 HTTPSignerV4
+
+	Logger logging.Logger
+
+	// Region in which requests are signed
+	Region string
+
+	// Retryer of requests. If it isn't set, the SDK's standard retryer is
+	// used.
+	Retryer aws.Retryer
+}
+
+// Returns a copy of the options, which can be changed without changing
+// these
+func (o Options) Copy() Options {
+	to := o
+	to.APIOptions = make([]func(*middleware.Stack) error, len(o.APIOptions))
+	copy(to.APIOptions, o.APIOptions)
+	return to
+}
+
+// Returns a client with the given options, after applying the functions
+// to them
+func New(options Options, optFns ...func(*Options)) *Client {
+	options = options.Copy()
+	for _, fn := range optFns {
+		fn(&options)
+	}
+	if options.HTTPClient == nil {
+		options.HTTPClient = awshttp.NewBuildableClient()
+	}
+	if options.Retryer == nil {
+		options.Retryer = retry.NewStandard()
+	}
+	if options.Logger == nil {
+		options.Logger = logging.Nop{}
+	}
+	return &Client{options: options}
+}
+
+// Returns a copy of the client's options
+func (c *Client) Options() Options {
+	return c.options.Copy()
+}
+
+func (c *Client) invokeOperation(ctx context.Context, opID string, params interface{}, optFns []func(*Options), stackFns ...func(*middleware.Stack, Options) error) (result interface{}, metadata middleware.Metadata, err error) {
+	ctx = middleware.ClearStackValues(ctx)
+	stack := middleware.NewStack(opID, smithyhttp.NewStackRequest)
+	options := c.options.Copy()
+	for _, fn := range optFns {
+		fn(&options)
+	}
+	if options.HTTPSignerV4 == nil {
+		return nil, metadata, &smithy.OperationError{ServiceID: ServiceID, OperationName: opID, Err: errors.New("no signer is set")}
+	}
+	for _, fn := range stackFns {
+		if err := fn(stack, options); err != nil {
+			return nil, metadata, err
+		}
+	}
+	for _, fn := range options.APIOptions {
+		if err := fn(stack); err != nil {
+			return nil, metadata, err
+		}
+	}
+	handler := middleware.DecorateHandler(smithyhttp.NewClientHandler(options.HTTPClient), stack)
+	result, metadata, err = handler.Handle(ctx, params)
+	if err != nil {
+		err = &smithy.OperationError{ServiceID: ServiceID, OperationName: opID, Err: err}
+	}
+	return result, metadata, err
+}
+
+// Adds the middleware that every operation shares
+func addClientMiddlewares(stack *middleware.Stack, options Options, opID string) error {
+	if err := stack.Initialize.Add(&awsmiddleware.RegisterServiceMetadata{
+		Region:        options.Region,
+		ServiceID:     ServiceID,
+		SigningName:   SigningName,
+		OperationName: opID,
+	}, middleware.Before); err != nil {
+		return err
+	}
+	if err := middleware.AddSetLoggerMiddleware(stack, options.Logger); err != nil {
+		return err
+	}
+	if err := stack.Serialize.Add(&resolveEndpoint{options: options}, middleware.Before); err != nil {
+		return err
+	}
+	if err := awsmiddleware.AddClientRequestIDMiddleware(stack); err != nil {
+		return err
+	}
+	if err := smithyhttp.AddComputeContentLengthMiddleware(stack); err != nil {
+		return err
+	}
+	// Retries are inserted before signing, so that each attempt is signed
+	// (with the time at which it's sent)
+	if err := stack.Finalize.Add(&signRequest{signer: options.HTTPSignerV4}, middleware.After); err != nil {
+		return err
+	}
+	if err := retry.AddRetryMiddlewares(stack, retry.AddRetryMiddlewaresOptions{
+		Retryer:          options.Retryer,
+		LogRetryAttempts: options.ClientLogMode.IsRetries(),
+	}); err != nil {
+		return err
+	}
+	if err := stack.Finalize.Add(&v4.ComputePayloadSHA256{}, middleware.Before); err != nil {
+		return err
+	}
+	if err := awsmiddleware.AddRequestIDRetrieverMiddleware(stack); err != nil {
+		return err
+	}
+	if err := awshttp.AddResponseErrorMiddleware(stack); err != nil {
+		return err
+	}
+	if err := awsmiddleware.AddRecordResponseTiming(stack); err != nil {
+		return err
+	}
+	if err := smithyhttp.AddErrorCloseResponseBodyMiddleware(stack); err != nil {
+		return err
+	}
+	if err := smithyhttp.AddCloseResponseBodyMiddleware(stack); err != nil {
+		return err
+	}
+	return stack.Deserialize.Add(&smithyhttp.RequestResponseLogger{
+		LogRequest:          options.ClientLogMode.IsRequest(),
+		LogRequestWithBody:  options.ClientLogMode.IsRequestWithBody(),
+		LogResponse:         options.ClientLogMode.IsResponse(),
+		LogResponseWithBody: options.ClientLogMode.IsResponseWithBody(),
+	}, middleware.After)
+}
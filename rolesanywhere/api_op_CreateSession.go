@@ -0,0 +1,75 @@
+package rolesanywhere
+
+import (
+	"context"
+
+	"github.com/aws/rolesanywhere-credential-helper/rolesanywhere/types"
+	"github.com/aws/smithy-go/middleware"
+)
+
+const opCreateSession = "CreateSession"
+
+// Obtains temporary credentials for a role, with a request signed with the
+// key of a certificate that the trust anchor trusts.
+//
+// Returned errors (wrapped) include types.AccessDeniedException,
+// types.ResourceNotFoundException, and types.ValidationException.
+func (c *Client) CreateSession(ctx context.Context, params *CreateSessionInput, optFns ...func(*Options)) (*CreateSessionOutput, error) {
+	if params == nil {
+		params = &CreateSessionInput{}
+	}
+	result, metadata, err := c.invokeOperation(ctx, opCreateSession, params, optFns, addOperationCreateSessionMiddlewares)
+	if err != nil {
+		return nil, err
+	}
+	out := result.(*CreateSessionOutput)
+	out.ResultMetadata = metadata
+	return out, nil
+}
+
+type CreateSessionInput struct {
+	// ARN of the profile, which is required
+	ProfileArn *string
+
+	// ARN of the role, which is required
+	RoleArn *string
+
+	// ARN of the trust anchor
+	TrustAnchorArn *string
+
+	// Certificate (in base64-encoded DER) whose key signs the request
+	Cert *string
+
+	// How long the credentials are valid for, which is at least 900 seconds
+	DurationSeconds *int32
+
+	InstanceProperties map[string]string
+
+	// Role session name, of at least 2 characters. The profile has to accept
+	// role session names for it to be set.
+	SessionName *string
+}
+
+type CreateSessionOutput struct {
+	CredentialSet []types.CredentialResponse
+
+	EnrollmentArn *string
+
+	SubjectArn *string
+
+	// Metadata of the operation's result
+	ResultMetadata middleware.Metadata
+}
+
+func addOperationCreateSessionMiddlewares(stack *middleware.Stack, options Options) error {
+	if err := stack.Serialize.Add(&restjson1SerializeOpCreateSession{}, middleware.After); err != nil {
+		return err
+	}
+	if err := stack.Deserialize.Add(&restjson1DeserializeOpCreateSession{}, middleware.After); err != nil {
+		return err
+	}
+	if err := addClientMiddlewares(stack, options, opCreateSession); err != nil {
+		return err
+	}
+	return stack.Initialize.Add(&validateOpCreateSession{}, middleware.After)
+}
@@ -0,0 +1,36 @@
+package rolesanywhere
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Signs each attempt at a request with the signer in the options, at the
+// time at which it's sent
+type signRequest struct {
+	signer HTTPSignerV4
+}
+
+func (*signRequest) ID() string {
+	return "Signing"
+}
+
+func (m *signRequest) HandleFinalize(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (
+	out middleware.FinalizeOutput, metadata middleware.Metadata, err error,
+) {
+	request, ok := in.Request.(*smithyhttp.Request)
+	if !ok {
+		return out, metadata, fmt.Errorf("unknown transport type %T", in.Request)
+	}
+	if err := m.signer.SignHTTP(ctx, aws.Credentials{}, request.Request, v4.GetPayloadHash(ctx), awsmiddleware.GetSigningName(ctx), awsmiddleware.GetRegion(ctx), time.Now()); err != nil {
+		return out, metadata, fmt.Errorf("failed to sign the request: %w", err)
+	}
+	return next.HandleFinalize(ctx, in)
+}
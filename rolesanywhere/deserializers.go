@@ -0,0 +1,122 @@
+package rolesanywhere
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/rolesanywhere-credential-helper/rolesanywhere/types"
+	smithy "github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+type restjson1DeserializeOpCreateSession struct{}
+
+func (*restjson1DeserializeOpCreateSession) ID() string {
+	return "OperationDeserializer"
+}
+
+func (m *restjson1DeserializeOpCreateSession) HandleDeserialize(ctx context.Context, in middleware.DeserializeInput, next middleware.DeserializeHandler) (
+	out middleware.DeserializeOutput, metadata middleware.Metadata, err error,
+) {
+	out, metadata, err = next.HandleDeserialize(ctx, in)
+	if err != nil {
+		return out, metadata, err
+	}
+	response, ok := out.RawResponse.(*smithyhttp.Response)
+	if !ok {
+		return out, metadata, &smithy.DeserializationError{Err: fmt.Errorf("unknown transport type %T", out.RawResponse)}
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return out, metadata, restjson1DeserializeOpErrorCreateSession(response)
+	}
+
+	output := &CreateSessionOutput{}
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return out, metadata, &smithy.DeserializationError{Err: fmt.Errorf("failed to read the response body: %w", err)}
+	}
+	if len(bytes.TrimSpace(body)) != 0 {
+		var document struct {
+			CredentialSet []types.CredentialResponse `json:"credentialSet"`
+			EnrollmentArn *string                    `json:"enrollmentArn"`
+			SubjectArn    *string                    `json:"subjectArn"`
+		}
+		if err := json.Unmarshal(body, &document); err != nil {
+			return out, metadata, &smithy.DeserializationError{Err: fmt.Errorf("failed to decode the response body: %w", err), Snapshot: body}
+		}
+		output.CredentialSet = document.CredentialSet
+		output.EnrollmentArn = document.EnrollmentArn
+		output.SubjectArn = document.SubjectArn
+	}
+	out.Result = output
+	return out, metadata, nil
+}
+
+// Returns the error in a response that isn't successful: the error type
+// that its code names, if it's one of CreateSession's, or else a generic
+// one with its code and message
+func restjson1DeserializeOpErrorCreateSession(response *smithyhttp.Response) error {
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return &smithy.DeserializationError{Err: fmt.Errorf("failed to read the response body: %w", err)}
+	}
+	var document struct {
+		Type        string  `json:"__type"`
+		Code        string  `json:"code"`
+		Message     *string `json:"message"`
+		MessageCaps *string `json:"Message"`
+	}
+	// The body may well be empty, or not JSON, in which case the code can
+	// only come from the header
+	_ = json.Unmarshal(body, &document)
+
+	code := response.Header.Get("X-Amzn-ErrorType")
+	if code == "" {
+		code = document.Type
+	}
+	if code == "" {
+		code = document.Code
+	}
+	code = sanitizeErrorCode(code)
+	message := document.Message
+	if message == nil {
+		message = document.MessageCaps
+	}
+
+	switch code {
+	case "AccessDeniedException":
+		return &types.AccessDeniedException{Message: message}
+	case "ResourceNotFoundException":
+		return &types.ResourceNotFoundException{Message: message}
+	case "ValidationException":
+		return &types.ValidationException{Message: message}
+	}
+	genericError := &smithy.GenericAPIError{Code: code}
+	if code == "" {
+		genericError.Code = "UnknownError"
+	}
+	if message != nil {
+		genericError.Message = *message
+	}
+	if response.StatusCode >= 500 {
+		genericError.Fault = smithy.FaultServer
+	}
+	return genericError
+}
+
+// Strips the namespace and the URL that error codes may come with
+// (aws.protocoltests#Code:http://...)
+func sanitizeErrorCode(code string) string {
+	if i := strings.Index(code, ":"); i != -1 {
+		code = code[:i]
+	}
+	if i := strings.LastIndex(code, "#"); i != -1 {
+		code = code[i+1:]
+	}
+	return code
+}
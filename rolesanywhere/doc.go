@@ -1,26 +1,10 @@
-// Code generated by private/model/cli/gen-api/main.go. DO NOT EDIT.
-
-// Package rolesanywhere provides the client and types for making API
-// requests to RolesAnywhere Service.
-//
-// See https://docs.aws.amazon.com/goto/WebAPI/roles-anywhere-2018-05-10 for more information on this service.
-//
-// See rolesanywhere package documentation for more information.
-// https://docs.aws.amazon.com/sdk-for-go/api/service/rolesanywhere/
-//
-// Using the Client
-//
-// To contact RolesAnywhere Service with the SDK use the New function to create
-// a new service client. With that client you can make API requests to the service.
-// These clients are safe to use concurrently.
-//
-// See the SDK's documentation for more information on how to use the SDK.
-// https://docs.aws.amazon.com/sdk-for-go/api/
-//
-// See aws.Config documentation for more information on configuring SDK clients.
-// https://docs.aws.amazon.com/sdk-for-go/api/aws/#Config
-//
-// See the RolesAnywhere Service client RolesAnywhere for more
-// information on creating client for this service.
-// https://docs.aws.amazon.com/sdk-for-go/api/service/rolesanywhere/#New
+// Package rolesanywhere provides a client for the CreateSession operation of
+// IAM Roles Anywhere, which exchanges a request signed with an X.509
+// certificate's private key (Signature Version 4, with the certificate in
+// place of an access key) for temporary credentials.
+//
+// The client is built on aws-sdk-go-v2's middleware stack, so it takes the
+// SDK's retryers, HTTP clients, and API options. CreateSession isn't signed
+// with AWS credentials, so the client has no credentials provider: requests
+// are signed by the HTTPSignerV4 in its options, which has to be set.
 package rolesanywhere
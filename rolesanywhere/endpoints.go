@@ -0,0 +1,46 @@
+package rolesanywhere
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Points requests at the endpoint in the options, or else at the regional
+// endpoint
+type resolveEndpoint struct {
+	options Options
+}
+
+func (*resolveEndpoint) ID() string {
+	return "ResolveEndpoint"
+}
+
+func (m *resolveEndpoint) HandleSerialize(ctx context.Context, in middleware.SerializeInput, next middleware.SerializeHandler) (
+	out middleware.SerializeOutput, metadata middleware.Metadata, err error,
+) {
+	request, ok := in.Request.(*smithyhttp.Request)
+	if !ok {
+		return out, metadata, fmt.Errorf("unknown transport type %T", in.Request)
+	}
+	endpoint := "https://rolesanywhere." + m.options.Region + ".amazonaws.com"
+	if m.options.BaseEndpoint != nil {
+		endpoint = *m.options.BaseEndpoint
+	} else if m.options.Region == "" {
+		return out, metadata, fmt.Errorf("neither an endpoint nor a region is set")
+	}
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return out, metadata, fmt.Errorf("invalid endpoint %s: %w", endpoint, err)
+	}
+	request.URL.Scheme = endpointURL.Scheme
+	request.URL.Host = endpointURL.Host
+	request.URL.Path = strings.TrimSuffix(endpointURL.Path, "/")
+	request.URL.RawPath = strings.TrimSuffix(endpointURL.RawPath, "/")
+	request.Host = endpointURL.Host
+	return next.HandleSerialize(ctx, in)
+}
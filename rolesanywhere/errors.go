@@ -1,28 +0,0 @@
-// Code generated by private/model/cli/gen-api/main.go. DO NOT EDIT.
-
-package rolesanywhere
-
-import (
-	"github.com/aws/aws-sdk-go/private/protocol"
-)
-
-const (
-
-	// ErrCodeAccessDeniedException for service response error code
-	// "AccessDeniedException".
-	ErrCodeAccessDeniedException = "AccessDeniedException"
-
-	// ErrCodeResourceNotFoundException for service response error code
-	// "ResourceNotFoundException".
-	ErrCodeResourceNotFoundException = "ResourceNotFoundException"
-
-	// ErrCodeValidationException for service response error code
-	// "ValidationException".
-	ErrCodeValidationException = "ValidationException"
-)
-
-var exceptionFromCode = map[string]func(protocol.ResponseMetadata) error{
-	"AccessDeniedException":                 newErrorAccessDeniedException,
-	"ResourceNotFoundException":             newErrorResourceNotFoundException,
-	"ValidationException":                   newErrorValidationException,
-}
@@ -1,68 +1,31 @@
-// Code generated by private/model/cli/gen-api/main.go. DO NOT EDIT.
-
-// Package rolesanywhereiface provides an interface to enable mocking the RolesAnywhere Service service client
-// for testing your code.
+// Package rolesanywhereiface provides an interface to enable mocking the
+// RolesAnywhere client for testing your code.
 //
-// It is important to note that this interface will have breaking changes
-// when the service model is updated and adds new API operations, paginators,
-// and waiters.
+// The client is built on the AWS SDK for Go v2, so CreateSession takes a
+// context and functional options, as in the SDK's v2 clients, and
+// CreateSessionWithContext and CreateSessionRequest, which were only part of
+// the v1 client, are no longer part of the interface.
 package rolesanywhereiface
 
 import (
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/request"
+	"context"
+
 	"github.com/aws/rolesanywhere-credential-helper/rolesanywhere"
 )
 
 // RolesAnywhereAPI provides an interface to enable mocking the
-// rolesanywhere.RolesAnywhere service client's API operation,
-// paginators, and waiters. This make unit testing your code that calls out
-// to the SDK's service client's calls easier.
-//
-// The best way to use this interface is so the SDK's service client's calls
-// can be stubbed out for unit testing your code with the SDK without needing
-// to inject custom request handlers into the SDK's request pipeline.
-//
-//    // myFunc uses an SDK service client to make a request to
-//    // RolesAnywhere Service.
-//    func myFunc(svc rolesanywhereiface.RolesAnywhereAPI) bool {
-//        // Make svc.CreateSession request
-//    }
-//
-//    func main() {
-//        sess := session.New()
-//        svc := rolesanywhere.New(sess)
-//
-//        myFunc(svc)
-//    }
-//
-// In your _test.go file:
-//
-//    // Define a mock struct to be used in your unit tests of myFunc.
-//    type mockRolesAnywhereClient struct {
-//        rolesanywhereiface.RolesAnywhereAPI
-//    }
-//    func (m *mockRolesAnywhereClient) CreateSession(input *rolesanywhere.CreateSessionInput) (*rolesanywhere.CreateSessionOutput, error) {
-//        // mock response/functionality
-//    }
-//
-//    func TestMyFunc(t *testing.T) {
-//        // Setup Test
-//        mockSvc := &mockRolesAnywhereClient{}
-//
-//        myfunc(mockSvc)
-//
-//        // Verify myFunc's functionality
-//    }
-//
-// It is important to note that this interface will have breaking changes
-// when the service model is updated and adds new API operations, paginators,
-// and waiters. Its suggested to use the pattern above for testing, or using
-// tooling to generate mocks to satisfy the interfaces.
+// rolesanywhere.Client's API operations, so that code that calls them can
+// be unit tested without sending requests.
+//
+//	// Define a mock struct to be used in your unit tests of myFunc.
+//	type mockRolesAnywhereClient struct {
+//	    rolesanywhereiface.RolesAnywhereAPI
+//	}
+//	func (m *mockRolesAnywhereClient) CreateSession(ctx context.Context, input *rolesanywhere.CreateSessionInput, optFns ...func(*rolesanywhere.Options)) (*rolesanywhere.CreateSessionOutput, error) {
+//	    // mock response/functionality
+//	}
 type RolesAnywhereAPI interface {
-	CreateSession(*rolesanywhere.CreateSessionInput) (*rolesanywhere.CreateSessionOutput, error)
-	CreateSessionWithContext(aws.Context, *rolesanywhere.CreateSessionInput, ...request.Option) (*rolesanywhere.CreateSessionOutput, error)
-	CreateSessionRequest(*rolesanywhere.CreateSessionInput) (*request.Request, *rolesanywhere.CreateSessionOutput)
+	CreateSession(context.Context, *rolesanywhere.CreateSessionInput, ...func(*rolesanywhere.Options)) (*rolesanywhere.CreateSessionOutput, error)
 }
 
-var _ RolesAnywhereAPI = (*rolesanywhere.RolesAnywhere)(nil)
+var _ RolesAnywhereAPI = (*rolesanywhere.Client)(nil)
@@ -0,0 +1,76 @@
+package rolesanywhere
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	smithy "github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+type restjson1SerializeOpCreateSession struct{}
+
+func (*restjson1SerializeOpCreateSession) ID() string {
+	return "OperationSerializer"
+}
+
+// Body of a CreateSession request
+type createSessionBody struct {
+	DurationSeconds    *int32            `json:"durationSeconds,omitempty"`
+	InstanceProperties map[string]string `json:"instanceProperties,omitempty"`
+	SessionName        *string           `json:"sessionName,omitempty"`
+}
+
+// Serializes CreateSession as a POST to /sessions, with the ARNs in the
+// query, the certificate in the X-Amz-X509 header, and the rest in the
+// JSON body
+func (m *restjson1SerializeOpCreateSession) HandleSerialize(ctx context.Context, in middleware.SerializeInput, next middleware.SerializeHandler) (
+	out middleware.SerializeOutput, metadata middleware.Metadata, err error,
+) {
+	request, ok := in.Request.(*smithyhttp.Request)
+	if !ok {
+		return out, metadata, fmt.Errorf("unknown transport type %T", in.Request)
+	}
+	input, ok := in.Parameters.(*CreateSessionInput)
+	if !ok {
+		return out, metadata, fmt.Errorf("unknown input parameters type %T", in.Parameters)
+	}
+
+	request.Method = "POST"
+	request.URL.Path += "/sessions"
+	if request.URL.RawPath != "" {
+		request.URL.RawPath += "/sessions"
+	}
+	query := request.URL.Query()
+	if input.ProfileArn != nil {
+		query.Set("profileArn", *input.ProfileArn)
+	}
+	if input.RoleArn != nil {
+		query.Set("roleArn", *input.RoleArn)
+	}
+	if input.TrustAnchorArn != nil {
+		query.Set("trustAnchorArn", *input.TrustAnchorArn)
+	}
+	request.URL.RawQuery = query.Encode()
+	if input.Cert != nil {
+		request.Header.Set("X-Amz-X509", *input.Cert)
+	}
+
+	body, err := json.Marshal(createSessionBody{
+		DurationSeconds:    input.DurationSeconds,
+		InstanceProperties: input.InstanceProperties,
+		SessionName:        input.SessionName,
+	})
+	if err != nil {
+		return out, metadata, &smithy.SerializationError{Err: err}
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if request, err = request.SetStream(bytes.NewReader(body)); err != nil {
+		return out, metadata, &smithy.SerializationError{Err: err}
+	}
+	in.Request = request
+	return next.HandleSerialize(ctx, in)
+}
@@ -0,0 +1,26 @@
+package types
+
+// The role that the credentials were issued for
+type AssumedRoleUser struct {
+	Arn           *string `json:"arn,omitempty"`
+	AssumedRoleId *string `json:"assumedRoleId,omitempty"`
+}
+
+// Temporary credentials issued by CreateSession, and the role session that
+// they belong to
+type CredentialResponse struct {
+	AssumedRoleUser  *AssumedRoleUser `json:"assumedRoleUser,omitempty"`
+	Credentials      *Credentials     `json:"credentials,omitempty"`
+	PackedPolicySize *int32           `json:"packedPolicySize,omitempty"`
+	RoleArn          *string          `json:"roleArn,omitempty"`
+	SourceIdentity   *string          `json:"sourceIdentity,omitempty"`
+}
+
+// Temporary credentials. Their expiration is in the ISO 8601 format in
+// which IAM Roles Anywhere returns it.
+type Credentials struct {
+	AccessKeyId     *string `json:"accessKeyId,omitempty"`
+	Expiration      *string `json:"expiration,omitempty"`
+	SecretAccessKey *string `json:"secretAccessKey,omitempty"`
+	SessionToken    *string `json:"sessionToken,omitempty"`
+}
@@ -0,0 +1,76 @@
+package rolesanywhere
+
+import (
+	"context"
+	"fmt"
+
+	smithy "github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+)
+
+type validateOpCreateSession struct{}
+
+func (*validateOpCreateSession) ID() string {
+	return "OperationInputValidation"
+}
+
+func (m *validateOpCreateSession) HandleInitialize(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (
+	out middleware.InitializeOutput, metadata middleware.Metadata, err error,
+) {
+	input, ok := in.Parameters.(*CreateSessionInput)
+	if !ok {
+		return out, metadata, fmt.Errorf("unknown input parameters type %T", in.Parameters)
+	}
+	if err := validateOpCreateSessionInput(input); err != nil {
+		return out, metadata, err
+	}
+	return next.HandleInitialize(ctx, in)
+}
+
+// Checks the input as IAM Roles Anywhere would, so that a request that it
+// would reject isn't sent
+func validateOpCreateSessionInput(v *CreateSessionInput) error {
+	invalidParams := smithy.InvalidParamsError{Context: "CreateSessionInput"}
+	if v.ProfileArn == nil {
+		invalidParams.Add(smithy.NewErrParamRequired("ProfileArn"))
+	}
+	if v.RoleArn == nil {
+		invalidParams.Add(smithy.NewErrParamRequired("RoleArn"))
+	}
+	if v.DurationSeconds != nil && *v.DurationSeconds < 900 {
+		invalidParams.Add(newErrParamMinValue("DurationSeconds", 900))
+	}
+	if v.SessionName != nil && len(*v.SessionName) < 2 {
+		invalidParams.Add(newErrParamMinLen("SessionName", 2))
+	}
+	if invalidParams.Len() > 0 {
+		return invalidParams
+	}
+	return nil
+}
+
+// A parameter that's out of range
+type invalidParamError struct {
+	field   string
+	context string
+	reason  string
+}
+
+func (e *invalidParamError) Error() string {
+	field := e.field
+	if e.context != "" {
+		field = e.context + "." + field
+	}
+	return fmt.Sprintf("%s, %s.", e.reason, field)
+}
+func (e *invalidParamError) Field() string               { return e.field }
+func (e *invalidParamError) SetContext(ctx string)       { e.context = ctx }
+func (e *invalidParamError) AddNestedContext(ctx string) { e.field = ctx + "." + e.field }
+
+func newErrParamMinValue(field string, min int) *invalidParamError {
+	return &invalidParamError{field: field, reason: fmt.Sprintf("minimum field value of %d", min)}
+}
+
+func newErrParamMinLen(field string, min int) *invalidParamError {
+	return &invalidParamError{field: field, reason: fmt.Sprintf("minimum field size of %d", min)}
+}